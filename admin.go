@@ -0,0 +1,39 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+
+	"github.com/yurimachados/rinha-backend-go/config"
+	"github.com/yurimachados/rinha-backend-go/handlers"
+)
+
+// startAdmin serve as rotas de admin que mudam o estado da instância em um
+// listener próprio (ADMIN_ADDR), como o pprof: a porta pública só tem as
+// leituras. Um endereço que cairia na porta pública, na do gRPC ou na do
+// pprof já foi recusado pelo config.Validate.
+func startAdmin(cfg config.Server, handler *handlers.PaymentHandler) (*http.Server, error) {
+	listener, err := net.Listen("tcp", cfg.AdminAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	handler.RegisterAdminRoutes(mux)
+
+	server := &http.Server{
+		Handler:      handlers.RequestID(handlers.Recover(mux)),
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			slog.Error("admin server failed", "error", err)
+		}
+	}()
+
+	slog.Info("admin server listening", "addr", listener.Addr().String())
+	return server, nil
+}
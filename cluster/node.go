@@ -0,0 +1,153 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+const (
+	leaderKey       = "rinha:health:leader"
+	healthKeyPrefix = "rinha:health:"
+)
+
+// Papéis possíveis de uma instância
+const (
+	RoleStandalone = "standalone" // sem Redis, a instância decide sozinha
+	RoleLeader     = "leader"
+	RoleFollower   = "follower"
+)
+
+// renewScript estende o TTL apenas se a liderança ainda for desta instância
+var renewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// releaseScript remove a liderança apenas se ela for desta instância
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// Node coordena as instâncias via Redis: elege um líder (SET NX com TTL)
+// responsável por consultar o health dos processadores e compartilha o
+// resultado para que os seguidores não consumam o rate limit do endpoint.
+type Node struct {
+	client   *redis.Client
+	id       string
+	ttl      time.Duration
+	isLeader int32
+}
+
+// NewNode cria o nó do cluster; a liderança expira após ttl sem renovação
+func NewNode(redisURL string, ttl time.Duration) (*Node, error) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, err
+	}
+	opts.DialTimeout = 200 * time.Millisecond
+
+	hostname, _ := os.Hostname()
+	return &Node{
+		client: redis.NewClient(opts),
+		id:     fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		ttl:    ttl,
+	}, nil
+}
+
+// Elect tenta adquirir ou renovar a liderança e retorna se esta instância é
+// a líder. Qualquer falha na renovação perde a liderança imediatamente.
+func (n *Node) Elect(ctx context.Context) bool {
+	var leader bool
+	var err error
+
+	if n.IsLeader() {
+		var renewed int64
+		renewed, err = renewScript.Run(ctx, n.client, []string{leaderKey}, n.id, n.ttl.Milliseconds()).Int64()
+		leader = err == nil && renewed == 1
+	} else {
+		leader, err = n.client.SetNX(ctx, leaderKey, n.id, n.ttl).Result()
+	}
+	if err != nil {
+		slog.Warn("leader election failed", "error", err)
+		leader = false
+	}
+
+	n.setLeader(leader)
+	return leader
+}
+
+// IsLeader informa se esta instância é a líder atual
+func (n *Node) IsLeader() bool {
+	return atomic.LoadInt32(&n.isLeader) == 1
+}
+
+// Role retorna o papel atual da instância
+func (n *Node) Role() string {
+	if n.IsLeader() {
+		return RoleLeader
+	}
+	return RoleFollower
+}
+
+// PublishHealth grava o health de um processador para os seguidores
+func (n *Node) PublishHealth(ctx context.Context, processor string, health types.ServiceHealth) error {
+	payload, err := json.Marshal(health)
+	if err != nil {
+		return err
+	}
+	return n.client.Set(ctx, healthKeyPrefix+processor, payload, n.ttl*2).Err()
+}
+
+// ReadHealth lê o health de um processador publicado pelo líder
+func (n *Node) ReadHealth(ctx context.Context, processor string) (types.ServiceHealth, bool, error) {
+	var health types.ServiceHealth
+
+	payload, err := n.client.Get(ctx, healthKeyPrefix+processor).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return health, false, nil
+	}
+	if err != nil {
+		return health, false, err
+	}
+	if err := json.Unmarshal(payload, &health); err != nil {
+		return health, false, err
+	}
+	return health, true, nil
+}
+
+// Close libera a liderança para que outra instância assuma sem esperar o TTL
+func (n *Node) Close() error {
+	if n.IsLeader() {
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		releaseScript.Run(ctx, n.client, []string{leaderKey}, n.id)
+		cancel()
+		n.setLeader(false)
+	}
+	return n.client.Close()
+}
+
+// setLeader atualiza o papel logando as transições
+func (n *Node) setLeader(leader bool) {
+	if leader {
+		if atomic.CompareAndSwapInt32(&n.isLeader, 0, 1) {
+			slog.Info("health check leadership acquired", "instance", n.id, "role", RoleLeader)
+		}
+		return
+	}
+	if atomic.CompareAndSwapInt32(&n.isLeader, 1, 0) {
+		slog.Info("health check leadership lost", "instance", n.id, "role", RoleFollower)
+	}
+}
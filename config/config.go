@@ -0,0 +1,1342 @@
+// Package config reúne a configuração de inicialização do serviço: lida
+// das variáveis de ambiente uma única vez e validada antes de qualquer
+// componente subir, para que um valor inválido derrube o boot com a lista
+// completa de problemas em vez de aparecer depois, em produção.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/queue"
+	"github.com/yurimachados/rinha-backend-go/store"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// Padrões do ingest, fora do Default por servirem também de base para
+// outros padrões
+const (
+	// DefaultMaxBodyBytes é o limite padrão do corpo do POST /payments; um
+	// payment válido tem poucas centenas de bytes
+	DefaultMaxBodyBytes = 4 << 10
+
+	// DefaultMaxBatchItems é o máximo padrão de payments por POST /payments/batch
+	DefaultMaxBatchItems = 100
+
+	// inFlightPerWorker deriva o MAX_IN_FLIGHT padrão do número de workers: o
+	// ingest responde em microssegundos, então o limite só pesa sob
+	// sobrecarga ou com payments processados na requisição (sync/inline)
+	inFlightPerWorker = 64
+
+	// syncWriteMargin é a folga que o modo síncrono deixa do WriteTimeout do
+	// servidor para ainda escrever a resposta (handlers.EnableSyncMode)
+	syncWriteMargin = 250 * time.Millisecond
+)
+
+// Config é a configuração de inicialização do serviço. As partes que
+// pertencem a um pacote usam o tipo de configuração dele.
+type Config struct {
+	Processors queue.ProcessorConfig
+	Pool       queue.PoolConfig
+	Server     Server
+	Ingest     Ingest
+	CORS       CORS
+	RateLimit  RateLimit
+	Admission  Admission
+	CPUShed    CPUShed
+
+	ProcessorBulk bool // envio em lote aos endpoints de Bulk
+	Bulk          queue.BulkConfig
+	Callbacks     bool // callback ao callbackUrl do payment
+	Callback      queue.CallbackConfig
+	PeerURLs      []string            // instâncias irmãs para o summary agregado
+	Journal       queue.JournalConfig // Path vazio desliga o journal de falhas
+
+	Expvar bool                 // contadores em /debug/vars, no listener de admin
+	StatsD metrics.StatsDConfig // Addr vazio desliga o envio ao DogStatsD
+	Pprof  Pprof
+
+	QueueBackend string // "memory" ou "redis"
+	RedisURL     string // opcional; pode conter senha
+	DatabaseURL  string // opcional; pode conter senha
+
+	MaxAmount       int      // maior amount aceito, em centavos
+	PaymentTypes    []string // types aceitos, em minúsculas; vazio aceita qualquer um
+	KeepNewlines    bool     // mantém as quebras de linha do description
+	DefaultCurrency string   // moeda dos payments enviados sem currency
+	ExtraCurrencies []string // códigos ISO 4217 aceitos além dos embutidos
+
+	MemoryStore store.MemoryOptions
+	Postgres    store.PostgresOptions // só com DatabaseURL
+
+	LogSampleEvery        int    // erros repetidos logados na 1ª e a cada N ocorrências
+	MemoryHeadroomPercent int    // folga do GOMEMLIMIT sobre o limite de memória do container
+	ServiceName           string // service.name dos traces
+	FastJSON              bool   // codec JSON do payment escrito à mão em vez do encoding/json
+
+	loadErrs []error // valores que nem puderam ser lidos
+	file     *file   // para os avisos de chaves desconhecidas
+}
+
+// Server configura os listeners e os timeouts do servidor HTTP
+type Server struct {
+	Engine     string // "nethttp" ou "fasthttp"
+	Addr       string // endereço TCP
+	ListenTCP  bool
+	ReusePort  bool
+	Socket     string      // Unix socket opcional
+	SocketMode os.FileMode // permissões do Unix socket
+	GRPCAddr   string      // endereço TCP do servidor gRPC; vazio desliga
+	AdminAddr  string      // endereço TCP das rotas de admin que mudam estado; vazio desliga
+
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration // também deriva o prazo do modo síncrono
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration // espera pelas requisições em andamento no desligamento
+
+	ReadyQueuePercent   int           // ocupação da fila, em % da capacidade, com o /readyz em 503
+	ReadyUnhealthyGrace time.Duration // tempo sem processador saudável até o /readyz ir a 503
+	ShutdownReadyDelay  time.Duration // /readyz em 503 antes de fechar os listeners
+	ShutdownReportFile  string        // relatório do desligamento em JSON (opcional)
+
+	MaxInFlight          int           // requisições simultâneas; 0 desliga o limite
+	InFlightWait         time.Duration // espera por uma vaga antes do 503
+	AccessLogSampleEvery int           // respostas de sucesso logadas 1 a cada N; 0 desliga o access log
+	GzipResponses        bool          // summary e admin comprimidos quando o cliente aceita
+	GzipMinBytes         int           // tamanho mínimo da resposta comprimida
+}
+
+// Ingest limita o recebimento de payments pelo HTTP
+type Ingest struct {
+	MaxBodyBytes        int64  // corpo do POST /payments
+	MaxBatchItems       int    // payments por POST /payments/batch
+	MaxBatchBodyBytes   int64  // corpo do POST /payments/batch
+	ContentTypeMode     string // "lenient" lê como JSON o corpo sem Content-Type, "strict" recusa com 415
+	InlineFallback      bool   // com a fila cheia, processa na requisição em vez do 503
+	InlineMaxConcurrent int
+	SyncMaxConcurrent   int // POST /payments?sync=true simultâneos; 0 desliga o modo síncrono
+}
+
+// CORS define quem pode chamar a API de outra origem pelo navegador; sem
+// origens fica desligado
+type CORS struct {
+	Origins          []string // origens exatas (scheme://host[:porta]) ou "*"
+	Routes           []string // caminhos como registrados no mux, ex: /payments/{id}
+	Headers          []string // headers aceitos no preflight
+	AllowCredentials bool     // só vale para origens listadas, nunca para "*"
+	MaxAge           time.Duration
+}
+
+// RateLimit dimensiona o rate limit por IP dos payments recebidos (POST
+// /payments, cada item do POST /payments/batch e o gRPC)
+type RateLimit struct {
+	Enabled    bool
+	Rate       float64 // payments por segundo por IP
+	Burst      int     // payments seguidos aceitos com o bucket cheio
+	MaxClients int     // IPs com bucket em memória
+	TrustProxy bool    // usa X-Real-IP / X-Forwarded-For em vez do endereço da conexão
+}
+
+// Admission recusa parte dos payments com 429 antes de a fila encher; os
+// watermarks são percentuais da capacidade da fila
+type Admission struct {
+	Enabled       bool
+	HighWatermark int
+	LowWatermark  int
+	RejectPercent int // fração dos payments novos recusada acima do high watermark
+}
+
+// CPUShed dimensiona a recusa de payments por uso de CPU
+type CPUShed struct {
+	Enabled          bool
+	ThresholdPercent int           // uso de CPU, em % da capacidade, a partir do qual payments são recusados
+	MaxRejectPercent int           // teto da fração recusada, para o uso continuar sendo medido com tráfego
+	Interval         time.Duration // janela de cada amostra do uso
+}
+
+// Pprof configura o listener próprio dos handlers do net/http/pprof
+type Pprof struct {
+	Enabled       bool
+	Addr          string // endereço TCP, fora da porta pública
+	BlockRate     int    // runtime.SetBlockProfileRate; 0 mantém o perfil de block desligado
+	MutexFraction int    // runtime.SetMutexProfileFraction; 0 mantém o perfil de mutex desligado
+}
+
+// Default retorna a configuração sem nenhuma variável de ambiente
+func Default() Config {
+	pool := queue.DefaultPoolConfig()
+	return Config{
+		Processors:   queue.DefaultProcessorConfig(),
+		Pool:         pool,
+		QueueBackend: "memory",
+
+		MaxAmount:       types.DefaultMaxAmount,
+		DefaultCurrency: "BRL",
+		Server: Server{
+			Engine:          "nethttp",
+			Addr:            ":8080",
+			ListenTCP:       true,
+			SocketMode:      0o666,
+			ReadTimeout:     2 * time.Second, // timeout agressivo
+			WriteTimeout:    2 * time.Second,
+			IdleTimeout:     10 * time.Second,
+			ShutdownTimeout: 5 * time.Second,
+
+			ReadyQueuePercent:   90,
+			ReadyUnhealthyGrace: 10 * time.Second,
+
+			MaxInFlight:          defaultMaxInFlight(pool),
+			AccessLogSampleEvery: 100,
+			GzipResponses:        true,
+			GzipMinBytes:         1 << 10, // abaixo disso o cabeçalho do gzip não compensa
+		},
+		Ingest: Ingest{
+			MaxBodyBytes:        DefaultMaxBodyBytes,
+			MaxBatchItems:       DefaultMaxBatchItems,
+			MaxBatchBodyBytes:   DefaultMaxBatchItems * DefaultMaxBodyBytes,
+			ContentTypeMode:     "lenient",
+			InlineMaxConcurrent: 64,
+			SyncMaxConcurrent:   32,
+		},
+		CORS: CORS{
+			Routes:  []string{"/payments-summary", "/payments/{id}"},
+			Headers: []string{"Content-Type", logging.RequestIDHeader},
+			MaxAge:  10 * time.Minute,
+		},
+		RateLimit: RateLimit{Rate: 100, Burst: 200, MaxClients: 10000},
+		Admission: Admission{HighWatermark: 80, LowWatermark: 50, RejectPercent: 50},
+		CPUShed:   CPUShed{ThresholdPercent: 85, MaxRejectPercent: 90, Interval: 250 * time.Millisecond},
+
+		Bulk:     queue.BulkConfig{MaxItems: 10},
+		Callback: queue.DefaultCallbackConfig(),
+		Journal:  queue.DefaultJournalConfig(),
+		StatsD:   metrics.DefaultStatsDConfig(),
+		Pprof:    Pprof{Addr: "127.0.0.1:6060"},
+
+		MemoryStore: store.MemoryOptions{Capacity: store.DefaultCapacity, BucketRetention: store.DefaultBucketRetention},
+		Postgres: store.PostgresOptions{
+			MaxConns:        10,
+			MaxConnLifetime: time.Hour,
+			MaxConnIdleTime: 5 * time.Minute,
+			BufferSize:      50000,
+			BatchSize:       500,
+		},
+
+		LogSampleEvery:        100,
+		MemoryHeadroomPercent: 10,
+		ServiceName:           "rinha-backend-go",
+		FastJSON:              true,
+	}
+}
+
+// defaultMaxInFlight deriva o MAX_IN_FLIGHT padrão dos workers do pool,
+// com piso de 256
+func defaultMaxInFlight(pool queue.PoolConfig) int {
+	return max(max(pool.Workers, pool.MaxWorkers)*inFlightPerWorker, 256)
+}
+
+// Load lê a configuração do arquivo em path (opcional) e das variáveis de
+// ambiente, que têm precedência sobre ele; o que nenhum dos dois define
+// fica com o padrão. Erros de leitura não interrompem o Load: são
+// guardados e reportados pelo Validate junto com os demais. Chaves
+// desconhecidas do arquivo só geram aviso, no WarnUnknownKeys, já que o
+// log é configurado a partir do que o Load leu.
+func Load(path string) Config {
+	return LoadFrom(path, os.Getenv, nil)
+}
+
+// Override é um valor com precedência sobre o ambiente e o arquivo, como o
+// de uma flag da linha de comando; Source o identifica nos erros
+type Override struct {
+	Value  string
+	Source string
+}
+
+// LoadFrom é o Load lendo o ambiente de getenv e com overrides, por nome
+// de variável, acima dele. Como os overrides passam pelo mesmo loader, os
+// padrões derivados (MAX_IN_FLIGHT dos workers, as URLs de lote da URL do
+// processador) os acompanham.
+func LoadFrom(path string, getenv func(string) string, overrides map[string]Override) Config {
+	cfg := Default()
+	env := &loader{getenv: getenv, overrides: overrides}
+	if path != "" {
+		f, err := readFile(path)
+		if err != nil {
+			env.errs = append(env.errs, err)
+		}
+		env.file = f
+	}
+	populate(env, &cfg)
+	cfg.loadErrs = env.errs
+	cfg.file = env.file
+	return cfg
+}
+
+// WarnUnknownKeys avisa no log as chaves do arquivo que o Load não leu,
+// normalmente erros de digitação
+func (c Config) WarnUnknownKeys() {
+	c.file.warnUnknown()
+}
+
+// Variable é uma variável de ambiente (e chave do arquivo) lida pelo Load
+type Variable struct {
+	Key     string
+	Default string
+}
+
+// Variables lista as variáveis lidas pelo Load, na ordem da leitura, com o
+// padrão de cada uma, para a ajuda da linha de comando
+func Variables() []Variable {
+	cfg := Default()
+	env := &loader{describe: true}
+	populate(env, &cfg)
+	return env.vars
+}
+
+// populate preenche cfg com o que o loader encontrar, chave a chave
+func populate(env *loader, cfg *Config) {
+	cfg.Processors.DefaultURL = env.string("DEFAULT_PROCESSOR_URL", cfg.Processors.DefaultURL)
+	cfg.Processors.FallbackURL = env.string("FALLBACK_PROCESSOR_URL", cfg.Processors.FallbackURL)
+	cfg.Processors.DefaultReplicaURLs = env.list("DEFAULT_PROCESSOR_REPLICA_URLS", cfg.Processors.DefaultReplicaURLs)
+	cfg.Processors.FallbackReplicaURLs = env.list("FALLBACK_PROCESSOR_REPLICA_URLS", cfg.Processors.FallbackReplicaURLs)
+	cfg.Processors.Timeout = env.millis("PROCESSOR_TIMEOUT_MS", cfg.Processors.Timeout)
+	cfg.Processors.HealthCheckInterval = env.millis("HEALTH_CHECK_INTERVAL_MS", cfg.Processors.HealthCheckInterval)
+	cfg.Processors.WarmupConnections = env.int("WARMUP_CONNECTIONS", cfg.Processors.WarmupConnections)
+	cfg.Processors.WarmupTimeout = env.millis("WARMUP_TIMEOUT_MS", cfg.Processors.WarmupTimeout)
+	cfg.Processors.AdaptiveTimeout = env.bool("ADAPTIVE_TIMEOUT", cfg.Processors.AdaptiveTimeout)
+	cfg.Processors.TimeoutMin = env.millis("PROCESSOR_TIMEOUT_MIN_MS", cfg.Processors.TimeoutMin)
+	cfg.Processors.TimeoutMax = env.millis("PROCESSOR_TIMEOUT_MAX_MS", cfg.Processors.TimeoutMax)
+	cfg.Processors.TimeoutP99Percent = env.int("PROCESSOR_TIMEOUT_P99_PERCENT", cfg.Processors.TimeoutP99Percent)
+	cfg.Processors.RateLimit = env.int("PROCESSOR_RATE_LIMIT_RPS", cfg.Processors.RateLimit)
+	cfg.Processors.RateBurst = env.int("PROCESSOR_RATE_LIMIT_BURST", cfg.Processors.RateBurst)
+	cfg.Processors.RateAuto = env.bool("PROCESSOR_RATE_LIMIT_AUTO", cfg.Processors.RateAuto)
+	cfg.Processors.BreakerWindow = env.millis("BREAKER_WINDOW_MS", cfg.Processors.BreakerWindow)
+	cfg.Processors.BreakerFailurePercent = env.int("BREAKER_FAILURE_PERCENT", cfg.Processors.BreakerFailurePercent)
+	cfg.Processors.BreakerMinRequests = env.int("BREAKER_MIN_REQUESTS", cfg.Processors.BreakerMinRequests)
+	cfg.Processors.BreakerOpenBase = env.millis("BREAKER_OPEN_BASE_MS", cfg.Processors.BreakerOpenBase)
+	cfg.Processors.BreakerOpenMultiplier = env.int("BREAKER_OPEN_MULTIPLIER", cfg.Processors.BreakerOpenMultiplier)
+	cfg.Processors.BreakerOpenMax = env.millis("BREAKER_OPEN_MAX_MS", cfg.Processors.BreakerOpenMax)
+	cfg.Processors.BreakerOpenReset = env.millis("BREAKER_OPEN_RESET_MS", cfg.Processors.BreakerOpenReset)
+	cfg.Processors.Retries = env.int("PROCESSOR_RETRIES", cfg.Processors.Retries)
+	cfg.Processors.RetryDelay = env.millis("PROCESSOR_RETRY_DELAY_MS", cfg.Processors.RetryDelay)
+	cfg.Processors.RetryAfterSend = env.bool("PROCESSOR_RETRY_AFTER_SEND", cfg.Processors.RetryAfterSend)
+	cfg.Processors.ConnMetrics = env.bool("PROCESSOR_CONN_METRICS", cfg.Processors.ConnMetrics)
+	cfg.Processors.DefaultH2C = env.bool("DEFAULT_PROCESSOR_H2C", cfg.Processors.DefaultH2C)
+	cfg.Processors.FallbackH2C = env.bool("FALLBACK_PROCESSOR_H2C", cfg.Processors.FallbackH2C)
+	cfg.Processors.DNSCacheTTL = env.millis("DNS_CACHE_TTL_MS", cfg.Processors.DNSCacheTTL)
+	cfg.Processors.Chaos = env.bool("CHAOS", cfg.Processors.Chaos)
+	cfg.Processors.ExchangeLogEvery = env.int("PROCESSOR_EXCHANGE_LOG_EVERY", cfg.Processors.ExchangeLogEvery)
+	cfg.Processors.ExchangeLogErrorsPerSec = env.int("PROCESSOR_EXCHANGE_LOG_ERRORS_PER_SEC", cfg.Processors.ExchangeLogErrorsPerSec)
+	cfg.Processors.ExchangeLogMaxBytes = env.int("PROCESSOR_EXCHANGE_LOG_MAX_BYTES", cfg.Processors.ExchangeLogMaxBytes)
+	cfg.Processors.ClockSkewWarn = env.millis("CLOCK_SKEW_WARN_MS", cfg.Processors.ClockSkewWarn)
+	cfg.Processors.ClockSkewCorrection = env.bool("CLOCK_SKEW_CORRECTION", cfg.Processors.ClockSkewCorrection)
+	cfg.Processors.Snapshot = env.bool("SUMMARY_SNAPSHOT", cfg.Processors.Snapshot)
+	cfg.Processors.SnapshotPath = env.string("SUMMARY_SNAPSHOT_FILE", cfg.Processors.SnapshotPath)
+	cfg.Processors.SnapshotInterval = env.millis("SUMMARY_SNAPSHOT_INTERVAL_MS", cfg.Processors.SnapshotInterval)
+	cfg.Processors.ReceiptMaxBytes = env.int("PROCESSOR_RECEIPT_MAX_BYTES", cfg.Processors.ReceiptMaxBytes)
+	cfg.Processors.ReceiptStrict = env.bool("PROCESSOR_RECEIPT_STRICT", cfg.Processors.ReceiptStrict)
+	cfg.Processors.DefaultIdempotencyHeaders = env.list("DEFAULT_PROCESSOR_IDEMPOTENCY_HEADERS", cfg.Processors.DefaultIdempotencyHeaders)
+	cfg.Processors.FallbackIdempotencyHeaders = env.list("FALLBACK_PROCESSOR_IDEMPOTENCY_HEADERS", cfg.Processors.FallbackIdempotencyHeaders)
+	cfg.Processors.DuplicateStatuses = env.int64s("PROCESSOR_DUPLICATE_STATUSES", cfg.Processors.DuplicateStatuses)
+	cfg.Processors.AmountBuckets = env.int64s("AMOUNT_BUCKETS", cfg.Processors.AmountBuckets)
+	cfg.Processors.RoutingRules = env.routingRules("ROUTING_RULES", cfg.Processors.RoutingRules)
+	cfg.Processors.DefaultWeight = env.int("DEFAULT_PROCESSOR_WEIGHT", cfg.Processors.DefaultWeight)
+	cfg.Processors.FallbackWeight = env.int("FALLBACK_PROCESSOR_WEIGHT", cfg.Processors.FallbackWeight)
+	cfg.Processors.RoutingStrategy = env.string("ROUTING_STRATEGY", cfg.Processors.RoutingStrategy)
+	cfg.Processors.ShadowPercent = env.int("SHADOW_PERCENT", cfg.Processors.ShadowPercent)
+	cfg.Processors.ShadowMaxInFlight = env.int("SHADOW_MAX_IN_FLIGHT", cfg.Processors.ShadowMaxInFlight)
+	cfg.Processors.ShadowHeader = env.string("SHADOW_HEADER", cfg.Processors.ShadowHeader)
+	cfg.Processors.DefaultToken = env.secret("DEFAULT_PROCESSOR_TOKEN", cfg.Processors.DefaultToken)
+	cfg.Processors.FallbackToken = env.secret("FALLBACK_PROCESSOR_TOKEN", cfg.Processors.FallbackToken)
+	cfg.Processors.TokenHeader = env.string("PROCESSOR_TOKEN_HEADER", cfg.Processors.TokenHeader)
+	cfg.Processors.DefaultHeaders = env.headers("DEFAULT_PROCESSOR_HEADERS", cfg.Processors.DefaultHeaders)
+	cfg.Processors.FallbackHeaders = env.headers("FALLBACK_PROCESSOR_HEADERS", cfg.Processors.FallbackHeaders)
+
+	pool := &cfg.Pool
+	pool.Workers = env.int("WORKER_COUNT", pool.Workers)
+	pool.QueueSize = env.int("QUEUE_SIZE", pool.QueueSize)
+	pool.BatchSize = env.int("BATCH_SIZE", pool.BatchSize)
+	pool.BatchFlush = env.millis("BATCH_FLUSH_MS", pool.BatchFlush)
+	// O padrão acompanha um BATCH_SIZE menor que ele
+	pool.BatchParallelism = env.int("BATCH_PARALLELISM", min(pool.BatchParallelism, pool.BatchSize))
+	pool.QueueTTL = env.millis("QUEUE_TTL_MS", pool.QueueTTL)
+	pool.RetryMaxAttempts = env.int("RETRY_MAX_ATTEMPTS", pool.RetryMaxAttempts)
+	pool.RetryMaxElapsed = env.millis("RETRY_MAX_ELAPSED_MS", pool.RetryMaxElapsed)
+	pool.QueueWaitWarn = env.millis("QUEUE_WAIT_WARN_MS", pool.QueueWaitWarn)
+	pool.PriorityThreshold = env.int("PRIORITY_AMOUNT_THRESHOLD", pool.PriorityThreshold)
+	pool.PriorityMaxWait = env.millis("PRIORITY_MAX_WAIT_MS", pool.PriorityMaxWait)
+	pool.ResumeRamp = env.millis("RESUME_RAMP_MS", pool.ResumeRamp)
+	pool.SpillPath = env.string("QUEUE_SPILL_FILE", pool.SpillPath)
+	pool.Autoscale = env.bool("AUTOSCALE", pool.Autoscale)
+	pool.MinWorkers = env.int("MIN_WORKERS", pool.MinWorkers)
+	pool.MaxWorkers = env.int("MAX_WORKERS", pool.MaxWorkers)
+	pool.ScaleHighWatermark = env.int("SCALE_HIGH_WATERMARK", pool.ScaleHighWatermark)
+	pool.ScaleLowWatermark = env.int("SCALE_LOW_WATERMARK", pool.ScaleLowWatermark)
+	pool.ScaleInterval = env.millis("SCALE_INTERVAL_MS", pool.ScaleInterval)
+	pool.ScaleUpAfter = env.int("SCALE_UP_INTERVALS", pool.ScaleUpAfter)
+	pool.ScaleDownAfter = env.int("SCALE_DOWN_INTERVALS", pool.ScaleDownAfter)
+
+	cfg.QueueBackend = env.string("QUEUE_BACKEND", cfg.QueueBackend)
+	cfg.RedisURL = env.string("REDIS_URL", cfg.RedisURL)
+	cfg.DatabaseURL = env.string("DATABASE_URL", cfg.DatabaseURL)
+
+	cfg.MaxAmount = env.int("MAX_AMOUNT", cfg.MaxAmount)
+	cfg.KeepNewlines = env.bool("DESCRIPTION_KEEP_NEWLINES", cfg.KeepNewlines)
+	cfg.PaymentTypes = mapStrings(env.list("PAYMENT_TYPES", cfg.PaymentTypes), strings.ToLower)
+	cfg.DefaultCurrency = strings.ToUpper(env.string("DEFAULT_CURRENCY", cfg.DefaultCurrency))
+	cfg.ExtraCurrencies = mapStrings(env.list("EXTRA_CURRENCIES", cfg.ExtraCurrencies), strings.ToUpper)
+
+	server := &cfg.Server
+	server.Engine = env.string("HTTP_ENGINE", server.Engine)
+	server.Addr = env.string("HTTP_ADDR", server.Addr)
+	server.ListenTCP = env.bool("LISTEN_TCP", server.ListenTCP)
+	server.ReusePort = env.bool("REUSE_PORT", server.ReusePort)
+	server.Socket = env.string("LISTEN_SOCKET", server.Socket)
+	server.SocketMode = env.fileMode("LISTEN_SOCKET_MODE", server.SocketMode)
+	server.GRPCAddr = env.string("GRPC_ADDR", server.GRPCAddr)
+	server.AdminAddr = env.string("ADMIN_ADDR", server.AdminAddr)
+	server.ReadTimeout = env.millis("SERVER_READ_TIMEOUT_MS", server.ReadTimeout)
+	server.WriteTimeout = env.millis("SERVER_WRITE_TIMEOUT_MS", server.WriteTimeout)
+	server.IdleTimeout = env.millis("SERVER_IDLE_TIMEOUT_MS", server.IdleTimeout)
+	server.ShutdownTimeout = env.millis("SHUTDOWN_TIMEOUT_MS", server.ShutdownTimeout)
+	server.ReadyQueuePercent = env.int("READY_QUEUE_PERCENT", server.ReadyQueuePercent)
+	server.ReadyUnhealthyGrace = env.millis("READY_UNHEALTHY_GRACE_MS", server.ReadyUnhealthyGrace)
+	server.ShutdownReadyDelay = env.millis("SHUTDOWN_READY_DELAY_MS", server.ShutdownReadyDelay)
+	server.ShutdownReportFile = env.string("SHUTDOWN_REPORT_FILE", server.ShutdownReportFile)
+	server.MaxInFlight = env.int("MAX_IN_FLIGHT", defaultMaxInFlight(*pool))
+	server.InFlightWait = env.millis("IN_FLIGHT_WAIT_MS", server.InFlightWait)
+	server.AccessLogSampleEvery = env.int("ACCESS_LOG_SAMPLE_EVERY", server.AccessLogSampleEvery)
+	server.GzipResponses = env.bool("GZIP_RESPONSES", server.GzipResponses)
+	server.GzipMinBytes = env.int("GZIP_MIN_BYTES", server.GzipMinBytes)
+
+	ingest := &cfg.Ingest
+	ingest.MaxBodyBytes = int64(env.int("MAX_BODY_BYTES", int(ingest.MaxBodyBytes)))
+	ingest.MaxBatchItems = env.int("MAX_BATCH_ITEMS", ingest.MaxBatchItems)
+	// O padrão cabe MAX_BATCH_ITEMS payments do tamanho máximo
+	ingest.MaxBatchBodyBytes = int64(env.int("MAX_BATCH_BODY_BYTES", ingest.MaxBatchItems*int(ingest.MaxBodyBytes)))
+	ingest.ContentTypeMode = env.string("CONTENT_TYPE_MODE", ingest.ContentTypeMode)
+	ingest.InlineFallback = env.bool("INLINE_FALLBACK", ingest.InlineFallback)
+	ingest.InlineMaxConcurrent = env.int("INLINE_MAX_CONCURRENT", ingest.InlineMaxConcurrent)
+	ingest.SyncMaxConcurrent = env.int("SYNC_MAX_CONCURRENT", ingest.SyncMaxConcurrent)
+
+	cors := &cfg.CORS
+	cors.Origins = env.list("CORS_ALLOWED_ORIGINS", cors.Origins)
+	cors.Routes = env.list("CORS_ROUTES", cors.Routes)
+	cors.Headers = env.list("CORS_ALLOWED_HEADERS", cors.Headers)
+	cors.AllowCredentials = env.bool("CORS_ALLOW_CREDENTIALS", cors.AllowCredentials)
+	cors.MaxAge = env.duration("CORS_MAX_AGE_SECONDS", cors.MaxAge, time.Second)
+
+	rate := &cfg.RateLimit
+	rate.Enabled = env.bool("RATE_LIMIT", rate.Enabled)
+	rate.Rate = float64(env.int("RATE_LIMIT_RPS", int(rate.Rate)))
+	rate.Burst = env.int("RATE_LIMIT_BURST", rate.Burst)
+	rate.MaxClients = env.int("RATE_LIMIT_MAX_CLIENTS", rate.MaxClients)
+	rate.TrustProxy = env.bool("RATE_LIMIT_TRUST_PROXY", rate.TrustProxy)
+
+	admission := &cfg.Admission
+	admission.Enabled = env.bool("ADMISSION_CONTROL", admission.Enabled)
+	admission.HighWatermark = env.int("ADMISSION_HIGH_WATERMARK", admission.HighWatermark)
+	admission.LowWatermark = env.int("ADMISSION_LOW_WATERMARK", admission.LowWatermark)
+	admission.RejectPercent = env.int("ADMISSION_REJECT_PERCENT", admission.RejectPercent)
+
+	cfg.ProcessorBulk = env.bool("PROCESSOR_BULK", cfg.ProcessorBulk)
+	// Por padrão o endpoint de lote fica em /batch abaixo da URL de payments
+	cfg.Bulk.DefaultURL = env.string("DEFAULT_PROCESSOR_BULK_URL", cfg.Processors.DefaultURL+"/batch")
+	cfg.Bulk.FallbackURL = env.string("FALLBACK_PROCESSOR_BULK_URL", cfg.Processors.FallbackURL+"/batch")
+	cfg.Bulk.MaxItems = env.int("PROCESSOR_BULK_SIZE", cfg.Bulk.MaxItems)
+
+	callback := &cfg.Callback
+	cfg.Callbacks = env.bool("CALLBACKS", cfg.Callbacks)
+	callback.Workers = env.int("CALLBACK_WORKERS", callback.Workers)
+	callback.QueueSize = env.int("CALLBACK_QUEUE_SIZE", callback.QueueSize)
+	callback.Timeout = env.millis("CALLBACK_TIMEOUT_MS", callback.Timeout)
+	callback.MaxAttempts = env.int("CALLBACK_MAX_ATTEMPTS", callback.MaxAttempts)
+	callback.AllowPrivate = env.bool("CALLBACK_ALLOW_PRIVATE", callback.AllowPrivate)
+
+	shed := &cfg.CPUShed
+	shed.Enabled = env.bool("CPU_SHED", shed.Enabled)
+	shed.ThresholdPercent = env.int("CPU_SHED_THRESHOLD_PERCENT", shed.ThresholdPercent)
+	shed.MaxRejectPercent = env.int("CPU_SHED_MAX_REJECT_PERCENT", shed.MaxRejectPercent)
+	shed.Interval = env.millis("CPU_SHED_INTERVAL_MS", shed.Interval)
+
+	cfg.PeerURLs = env.list("PEER_URLS", cfg.PeerURLs)
+
+	journal := &cfg.Journal
+	journal.Path = env.string("FAILURE_JOURNAL_FILE", journal.Path)
+	journal.MaxBytes = int64(env.int("FAILURE_JOURNAL_MAX_BYTES", int(journal.MaxBytes)))
+	journal.Retain = env.int("FAILURE_JOURNAL_RETAIN", journal.Retain)
+	journal.FlushInterval = env.millis("FAILURE_JOURNAL_FLUSH_MS", journal.FlushInterval)
+	journal.QueueSize = env.int("FAILURE_JOURNAL_QUEUE_SIZE", journal.QueueSize)
+
+	cfg.Expvar = env.bool("EXPVAR", cfg.Expvar)
+	statsd := &cfg.StatsD
+	statsd.Addr = env.string("STATSD_ADDR", statsd.Addr)
+	statsd.Tags = env.list("STATSD_TAGS", statsd.Tags)
+	statsd.FlushInterval = env.millis("STATSD_FLUSH_MS", statsd.FlushInterval)
+	statsd.QueueSize = env.int("STATSD_QUEUE_SIZE", statsd.QueueSize)
+	pprof := &cfg.Pprof
+	pprof.Enabled = env.bool("ENABLE_PPROF", pprof.Enabled)
+	pprof.Addr = env.string("PPROF_ADDR", pprof.Addr)
+	pprof.BlockRate = env.int("PPROF_BLOCK_RATE", pprof.BlockRate)
+	pprof.MutexFraction = env.int("PPROF_MUTEX_FRACTION", pprof.MutexFraction)
+
+	cfg.MemoryStore.BucketRetention = env.duration("STORE_BUCKET_HOURS", cfg.MemoryStore.BucketRetention, time.Hour)
+	pg := &cfg.Postgres
+	pg.MaxConns = int32(env.int("PG_MAX_CONNS", int(pg.MaxConns)))
+	pg.MinConns = int32(env.int("PG_MIN_CONNS", int(pg.MinConns)))
+	pg.MaxConnLifetime = env.duration("PG_MAX_CONN_LIFETIME_SEC", pg.MaxConnLifetime, time.Second)
+	pg.MaxConnIdleTime = env.duration("PG_MAX_CONN_IDLE_SEC", pg.MaxConnIdleTime, time.Second)
+	pg.BufferSize = env.int("PG_BUFFER_SIZE", pg.BufferSize)
+	pg.BatchSize = env.int("PG_BATCH_SIZE", pg.BatchSize)
+
+	cfg.LogSampleEvery = env.int("LOG_SAMPLE_EVERY", cfg.LogSampleEvery)
+	cfg.MemoryHeadroomPercent = env.int("MEMORY_HEADROOM_PERCENT", cfg.MemoryHeadroomPercent)
+	cfg.ServiceName = env.string("OTEL_SERVICE_NAME", cfg.ServiceName)
+	cfg.FastJSON = env.bool("FAST_JSON", cfg.FastJSON)
+}
+
+// Validate retorna todos os valores inválidos de uma vez, cada um com a
+// variável de ambiente correspondente, ou nil. É a única validação da
+// configuração; valores válidos, mas incomuns, ficam para os avisos do
+// queue.PoolConfig.Normalize.
+func (c Config) Validate() error {
+	v := &validator{errs: c.loadErrs}
+
+	v.url("DEFAULT_PROCESSOR_URL", c.Processors.DefaultURL, "http", "https")
+	v.url("FALLBACK_PROCESSOR_URL", c.Processors.FallbackURL, "http", "https")
+	for _, replica := range c.Processors.DefaultReplicaURLs {
+		v.url("DEFAULT_PROCESSOR_REPLICA_URLS", replica, "http", "https")
+	}
+	for _, replica := range c.Processors.FallbackReplicaURLs {
+		v.url("FALLBACK_PROCESSOR_REPLICA_URLS", replica, "http", "https")
+	}
+	if c.Processors.DefaultH2C {
+		for _, raw := range append([]string{c.Processors.DefaultURL}, c.Processors.DefaultReplicaURLs...) {
+			v.check(strings.HasPrefix(raw, "http://"),
+				"DEFAULT_PROCESSOR_H2C: h2c needs http:// DEFAULT_PROCESSOR_URL and DEFAULT_PROCESSOR_REPLICA_URLS, got %s", raw)
+		}
+	}
+	if c.Processors.FallbackH2C {
+		for _, raw := range append([]string{c.Processors.FallbackURL}, c.Processors.FallbackReplicaURLs...) {
+			v.check(strings.HasPrefix(raw, "http://"),
+				"FALLBACK_PROCESSOR_H2C: h2c needs http:// FALLBACK_PROCESSOR_URL and FALLBACK_PROCESSOR_REPLICA_URLS, got %s", raw)
+		}
+	}
+	positive(v, "PROCESSOR_TIMEOUT_MS", c.Processors.Timeout)
+	positive(v, "HEALTH_CHECK_INTERVAL_MS", c.Processors.HealthCheckInterval)
+	nonNegative(v, "WARMUP_CONNECTIONS", c.Processors.WarmupConnections)
+	positive(v, "WARMUP_TIMEOUT_MS", c.Processors.WarmupTimeout)
+	if c.Processors.AdaptiveTimeout {
+		positive(v, "PROCESSOR_TIMEOUT_MIN_MS", c.Processors.TimeoutMin)
+		v.check(c.Processors.TimeoutMax >= c.Processors.TimeoutMin,
+			"PROCESSOR_TIMEOUT_MAX_MS: %s is below PROCESSOR_TIMEOUT_MIN_MS %s", c.Processors.TimeoutMax, c.Processors.TimeoutMin)
+		v.check(c.Processors.Timeout >= c.Processors.TimeoutMin && c.Processors.Timeout <= c.Processors.TimeoutMax,
+			"PROCESSOR_TIMEOUT_MS: %s is outside PROCESSOR_TIMEOUT_MIN_MS..PROCESSOR_TIMEOUT_MAX_MS", c.Processors.Timeout)
+		v.check(c.Processors.TimeoutP99Percent >= 100,
+			"PROCESSOR_TIMEOUT_P99_PERCENT: %d would cut off responses below the p99, must be at least 100", c.Processors.TimeoutP99Percent)
+	}
+	nonNegative(v, "PROCESSOR_RATE_LIMIT_RPS", c.Processors.RateLimit)
+	if c.Processors.RateLimit > 0 {
+		positive(v, "PROCESSOR_RATE_LIMIT_BURST", c.Processors.RateBurst)
+	}
+	v.check(c.Processors.BreakerWindow >= time.Second, "BREAKER_WINDOW_MS: %s is shorter than the 1s buckets of the window", c.Processors.BreakerWindow)
+	v.check(c.Processors.BreakerFailurePercent > 0 && c.Processors.BreakerFailurePercent <= 100,
+		"BREAKER_FAILURE_PERCENT: must be between 1 and 100, got %d", c.Processors.BreakerFailurePercent)
+	positive(v, "BREAKER_MIN_REQUESTS", c.Processors.BreakerMinRequests)
+	positive(v, "BREAKER_OPEN_BASE_MS", c.Processors.BreakerOpenBase)
+	positive(v, "BREAKER_OPEN_MULTIPLIER", c.Processors.BreakerOpenMultiplier)
+	v.check(c.Processors.BreakerOpenMax >= c.Processors.BreakerOpenBase,
+		"BREAKER_OPEN_MAX_MS: %s is below BREAKER_OPEN_BASE_MS %s", c.Processors.BreakerOpenMax, c.Processors.BreakerOpenBase)
+	positive(v, "BREAKER_OPEN_RESET_MS", c.Processors.BreakerOpenReset)
+	nonNegative(v, "PROCESSOR_RETRIES", c.Processors.Retries)
+	v.check(c.Processors.Retries <= 2, "PROCESSOR_RETRIES: %d is more than 2; a payment should move on to the fallback instead", c.Processors.Retries)
+	nonNegative(v, "PROCESSOR_RETRY_DELAY_MS", c.Processors.RetryDelay)
+	nonNegative(v, "CLOCK_SKEW_WARN_MS", c.Processors.ClockSkewWarn)
+	nonNegative(v, "DNS_CACHE_TTL_MS", c.Processors.DNSCacheTTL)
+	nonNegative(v, "PROCESSOR_EXCHANGE_LOG_EVERY", c.Processors.ExchangeLogEvery)
+	nonNegative(v, "PROCESSOR_EXCHANGE_LOG_ERRORS_PER_SEC", c.Processors.ExchangeLogErrorsPerSec)
+	nonNegative(v, "PROCESSOR_EXCHANGE_LOG_MAX_BYTES", c.Processors.ExchangeLogMaxBytes)
+	if c.Processors.Snapshot {
+		v.check(c.Processors.SnapshotPath != "", "SUMMARY_SNAPSHOT_FILE: must not be empty with SUMMARY_SNAPSHOT")
+		positive(v, "SUMMARY_SNAPSHOT_INTERVAL_MS", c.Processors.SnapshotInterval)
+	}
+	nonNegative(v, "PROCESSOR_RECEIPT_MAX_BYTES", c.Processors.ReceiptMaxBytes)
+	v.check(!c.Processors.ReceiptStrict || c.Processors.ReceiptMaxBytes > 0,
+		"PROCESSOR_RECEIPT_STRICT: requires PROCESSOR_RECEIPT_MAX_BYTES above 0, or no receipt is ever read")
+	for _, name := range c.Processors.DefaultIdempotencyHeaders {
+		v.check(validHeaderName(name), "DEFAULT_PROCESSOR_IDEMPOTENCY_HEADERS: %q is not a valid header name", name)
+	}
+	for _, name := range c.Processors.FallbackIdempotencyHeaders {
+		v.check(validHeaderName(name), "FALLBACK_PROCESSOR_IDEMPOTENCY_HEADERS: %q is not a valid header name", name)
+	}
+	for _, code := range c.Processors.DuplicateStatuses {
+		v.check(code >= 400 && code < 500 && code != 401 && code != 403 && code != 429,
+			"PROCESSOR_DUPLICATE_STATUSES: %d is not a 4xx status a processor would use for an already processed payment", code)
+	}
+	v.check(len(c.Processors.AmountBuckets) > 0, "AMOUNT_BUCKETS: must list at least one bound")
+	for i, bound := range c.Processors.AmountBuckets {
+		v.check(bound > 0, "AMOUNT_BUCKETS: %d is not a positive amount in cents", bound)
+		v.check(i == 0 || bound > c.Processors.AmountBuckets[i-1], "AMOUNT_BUCKETS: %d must be greater than the previous bound", bound)
+	}
+	if c.Processors.DefaultToken != "" || c.Processors.FallbackToken != "" {
+		v.check(validHeaderName(c.Processors.TokenHeader), "PROCESSOR_TOKEN_HEADER: %q is not a valid header name", c.Processors.TokenHeader)
+	}
+
+	pool := c.Pool
+	positive(v, "WORKER_COUNT", pool.Workers)
+	positive(v, "QUEUE_SIZE", pool.QueueSize)
+	positive(v, "BATCH_SIZE", pool.BatchSize)
+	v.check(pool.Workers <= pool.QueueSize, "WORKER_COUNT: %d workers exceed QUEUE_SIZE %d", pool.Workers, pool.QueueSize)
+	v.check(pool.BatchSize <= pool.QueueSize, "BATCH_SIZE: %d exceeds QUEUE_SIZE %d", pool.BatchSize, pool.QueueSize)
+	// 0 é o padrão: o lote leva o que já está na fila, sem esperar, para um
+	// payment sozinho não aguardar o lote encher
+	nonNegative(v, "BATCH_FLUSH_MS", pool.BatchFlush)
+	positive(v, "BATCH_PARALLELISM", pool.BatchParallelism)
+	v.check(pool.BatchParallelism <= pool.BatchSize, "BATCH_PARALLELISM: %d exceeds BATCH_SIZE %d", pool.BatchParallelism, pool.BatchSize)
+	nonNegative(v, "QUEUE_TTL_MS", pool.QueueTTL)
+	nonNegative(v, "RETRY_MAX_ATTEMPTS", pool.RetryMaxAttempts)
+	nonNegative(v, "RETRY_MAX_ELAPSED_MS", pool.RetryMaxElapsed)
+	nonNegative(v, "QUEUE_WAIT_WARN_MS", pool.QueueWaitWarn)
+	nonNegative(v, "PRIORITY_AMOUNT_THRESHOLD", pool.PriorityThreshold)
+	positive(v, "PRIORITY_MAX_WAIT_MS", pool.PriorityMaxWait)
+	nonNegative(v, "RESUME_RAMP_MS", pool.ResumeRamp)
+	if pool.Autoscale {
+		positive(v, "MIN_WORKERS", pool.MinWorkers)
+		v.check(pool.MaxWorkers >= pool.MinWorkers, "MAX_WORKERS: %d is below MIN_WORKERS %d", pool.MaxWorkers, pool.MinWorkers)
+		v.check(pool.MaxWorkers <= pool.QueueSize, "MAX_WORKERS: %d workers exceed QUEUE_SIZE %d", pool.MaxWorkers, pool.QueueSize)
+		nonNegative(v, "SCALE_LOW_WATERMARK", pool.ScaleLowWatermark)
+		v.check(pool.ScaleHighWatermark > pool.ScaleLowWatermark,
+			"SCALE_HIGH_WATERMARK: %d must exceed SCALE_LOW_WATERMARK %d", pool.ScaleHighWatermark, pool.ScaleLowWatermark)
+		positive(v, "SCALE_INTERVAL_MS", pool.ScaleInterval)
+		positive(v, "SCALE_UP_INTERVALS", pool.ScaleUpAfter)
+		positive(v, "SCALE_DOWN_INTERVALS", pool.ScaleDownAfter)
+	}
+
+	v.oneOf("QUEUE_BACKEND", c.QueueBackend, "memory", "redis")
+	v.check(c.QueueBackend != "redis" || c.RedisURL != "", "QUEUE_BACKEND: redis requires REDIS_URL")
+	v.check(c.QueueBackend != "redis" || c.Pool.SpillPath == "", "QUEUE_SPILL_FILE: the redis queue is already durable, the spill file is for the in-memory queue")
+	if c.RedisURL != "" {
+		v.url("REDIS_URL", c.RedisURL, "redis", "rediss", "unix")
+	}
+	// Sem "://" é uma connection string no formato chave=valor do libpq
+	if strings.Contains(c.DatabaseURL, "://") {
+		v.url("DATABASE_URL", c.DatabaseURL, "postgres", "postgresql")
+	}
+
+	positive(v, "MAX_AMOUNT", c.MaxAmount)
+	for i, name := range c.PaymentTypes {
+		v.check(validLabel(name), "PAYMENT_TYPES: %q must contain only letters, digits, '_' or '-'", name)
+		v.check(!slices.Contains(c.PaymentTypes[:i], name), "PAYMENT_TYPES: %q is listed twice", name)
+	}
+	nonNegative(v, "DEFAULT_PROCESSOR_WEIGHT", c.Processors.DefaultWeight)
+	nonNegative(v, "FALLBACK_PROCESSOR_WEIGHT", c.Processors.FallbackWeight)
+	v.check(c.Processors.DefaultWeight <= queue.MaxWeight, "DEFAULT_PROCESSOR_WEIGHT: %d is more than %d", c.Processors.DefaultWeight, queue.MaxWeight)
+	v.check(c.Processors.FallbackWeight <= queue.MaxWeight, "FALLBACK_PROCESSOR_WEIGHT: %d is more than %d", c.Processors.FallbackWeight, queue.MaxWeight)
+	v.oneOf("ROUTING_STRATEGY", c.Processors.RoutingStrategy, queue.RoutingPriority, queue.RoutingSticky)
+	v.check(c.Processors.RoutingStrategy != queue.RoutingSticky || (c.Processors.DefaultWeight == 0 && c.Processors.FallbackWeight == 0),
+		"DEFAULT_PROCESSOR_WEIGHT/FALLBACK_PROCESSOR_WEIGHT: weights only apply to ROUTING_STRATEGY=priority")
+	v.check(c.Processors.ShadowPercent >= 0 && c.Processors.ShadowPercent <= 100,
+		"SHADOW_PERCENT: must be between 0 and 100, got %d", c.Processors.ShadowPercent)
+	positive(v, "SHADOW_MAX_IN_FLIGHT", c.Processors.ShadowMaxInFlight)
+	v.check(validHeaderName(c.Processors.ShadowHeader), "SHADOW_HEADER: %q is not a valid header name", c.Processors.ShadowHeader)
+	for i, rule := range c.Processors.RoutingRules {
+		v.check(validLabel(rule.Type), "ROUTING_RULES: type %q must contain only letters, digits, '_' or '-'", rule.Type)
+		v.check(len(c.PaymentTypes) == 0 || slices.Contains(c.PaymentTypes, rule.Type),
+			"ROUTING_RULES: type %q is not listed in PAYMENT_TYPES", rule.Type)
+		v.check(!slices.ContainsFunc(c.Processors.RoutingRules[:i], func(other queue.RoutingRule) bool { return other.Type == rule.Type }),
+			"ROUTING_RULES: type %q has more than one rule", rule.Type)
+		v.check(len(rule.Processors) > 0, "ROUTING_RULES: type %q lists no processor", rule.Type)
+		for j, processor := range rule.Processors {
+			v.check(processor == "default" || processor == "fallback",
+				"ROUTING_RULES: type %q: unknown processor %q, expected default or fallback", rule.Type, processor)
+			v.check(!slices.Contains(rule.Processors[:j], processor), "ROUTING_RULES: type %q lists %q twice", rule.Type, processor)
+		}
+	}
+	for _, code := range c.ExtraCurrencies {
+		v.check(types.IsCurrencyCode(code), "EXTRA_CURRENCIES: %q is not a 3-letter ISO 4217 code", code)
+	}
+	v.check(slices.Contains(types.BuiltinCurrencies, c.DefaultCurrency) || slices.Contains(c.ExtraCurrencies, c.DefaultCurrency),
+		"DEFAULT_CURRENCY: %q is not a built-in currency nor listed in EXTRA_CURRENCIES", c.DefaultCurrency)
+
+	server := c.Server
+	v.oneOf("HTTP_ENGINE", server.Engine, "nethttp", "fasthttp")
+	v.check(server.ListenTCP || server.Socket != "", "LISTEN_TCP: false requires LISTEN_SOCKET")
+	v.check(!server.ListenTCP || server.Addr != "", "HTTP_ADDR: must not be empty")
+	if server.GRPCAddr != "" {
+		v.hostPort("GRPC_ADDR", server.GRPCAddr)
+		v.check(!server.ListenTCP || !samePort(server.GRPCAddr, server.Addr),
+			"GRPC_ADDR: %s would share the public port of HTTP_ADDR %s", server.GRPCAddr, server.Addr)
+	}
+	if server.AdminAddr != "" {
+		v.hostPort("ADMIN_ADDR", server.AdminAddr)
+		v.check(!server.ListenTCP || !samePort(server.AdminAddr, server.Addr),
+			"ADMIN_ADDR: %s would share the public port of HTTP_ADDR %s", server.AdminAddr, server.Addr)
+		v.check(server.GRPCAddr == "" || !samePort(server.AdminAddr, server.GRPCAddr),
+			"ADMIN_ADDR: %s would share the port of GRPC_ADDR %s", server.AdminAddr, server.GRPCAddr)
+		v.check(!c.Pprof.Enabled || !samePort(server.AdminAddr, c.Pprof.Addr),
+			"ADMIN_ADDR: %s would share the port of PPROF_ADDR %s", server.AdminAddr, c.Pprof.Addr)
+	}
+	positive(v, "SERVER_READ_TIMEOUT_MS", server.ReadTimeout)
+	positive(v, "SERVER_WRITE_TIMEOUT_MS", server.WriteTimeout)
+	positive(v, "SERVER_IDLE_TIMEOUT_MS", server.IdleTimeout)
+	positive(v, "SHUTDOWN_TIMEOUT_MS", server.ShutdownTimeout)
+	v.check(server.ReadyQueuePercent >= 1 && server.ReadyQueuePercent <= 100,
+		"READY_QUEUE_PERCENT: must be between 1 and 100, got %d", server.ReadyQueuePercent)
+	nonNegative(v, "READY_UNHEALTHY_GRACE_MS", server.ReadyUnhealthyGrace)
+	nonNegative(v, "SHUTDOWN_READY_DELAY_MS", server.ShutdownReadyDelay)
+	nonNegative(v, "MAX_IN_FLIGHT", server.MaxInFlight)
+	nonNegative(v, "IN_FLIGHT_WAIT_MS", server.InFlightWait)
+	nonNegative(v, "ACCESS_LOG_SAMPLE_EVERY", server.AccessLogSampleEvery)
+	if server.GzipResponses {
+		positive(v, "GZIP_MIN_BYTES", server.GzipMinBytes)
+	}
+
+	ingest := c.Ingest
+	positive(v, "MAX_BODY_BYTES", ingest.MaxBodyBytes)
+	positive(v, "MAX_BATCH_ITEMS", ingest.MaxBatchItems)
+	positive(v, "MAX_BATCH_BODY_BYTES", ingest.MaxBatchBodyBytes)
+	v.oneOf("CONTENT_TYPE_MODE", ingest.ContentTypeMode, "lenient", "strict")
+	if ingest.InlineFallback {
+		positive(v, "INLINE_MAX_CONCURRENT", ingest.InlineMaxConcurrent)
+	}
+	nonNegative(v, "SYNC_MAX_CONCURRENT", ingest.SyncMaxConcurrent)
+	v.check(ingest.SyncMaxConcurrent == 0 || server.WriteTimeout > syncWriteMargin,
+		"SYNC_MAX_CONCURRENT: sync mode needs SERVER_WRITE_TIMEOUT_MS above %s, got %s", syncWriteMargin, server.WriteTimeout)
+
+	for _, origin := range c.CORS.Origins {
+		if origin != "*" {
+			u, err := url.Parse(origin)
+			v.check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && strings.TrimRight(u.Path, "/") == "",
+				"CORS_ALLOWED_ORIGINS: %q is not * nor a scheme://host[:port] origin", origin)
+		}
+	}
+	if len(c.CORS.Origins) > 0 {
+		for _, route := range c.CORS.Routes {
+			v.check(strings.HasPrefix(route, "/"), "CORS_ROUTES: %q is not a path", route)
+		}
+		for _, name := range c.CORS.Headers {
+			v.check(validHeaderName(name), "CORS_ALLOWED_HEADERS: %q is not a valid header name", name)
+		}
+		nonNegative(v, "CORS_MAX_AGE_SECONDS", c.CORS.MaxAge)
+	}
+
+	if c.RateLimit.Enabled {
+		v.check(c.RateLimit.Rate > 0, "RATE_LIMIT_RPS: must be positive, got %v", c.RateLimit.Rate)
+		positive(v, "RATE_LIMIT_BURST", c.RateLimit.Burst)
+		positive(v, "RATE_LIMIT_MAX_CLIENTS", c.RateLimit.MaxClients)
+	}
+	if c.Admission.Enabled {
+		positive(v, "ADMISSION_LOW_WATERMARK", c.Admission.LowWatermark)
+		v.check(c.Admission.HighWatermark > c.Admission.LowWatermark && c.Admission.HighWatermark <= 100,
+			"ADMISSION_HIGH_WATERMARK: must exceed ADMISSION_LOW_WATERMARK %d and be at most 100, got %d", c.Admission.LowWatermark, c.Admission.HighWatermark)
+		v.check(c.Admission.RejectPercent > 0 && c.Admission.RejectPercent <= 100,
+			"ADMISSION_REJECT_PERCENT: must be between 1 and 100, got %d", c.Admission.RejectPercent)
+	}
+
+	if c.ProcessorBulk {
+		v.url("DEFAULT_PROCESSOR_BULK_URL", c.Bulk.DefaultURL, "http", "https")
+		v.url("FALLBACK_PROCESSOR_BULK_URL", c.Bulk.FallbackURL, "http", "https")
+		positive(v, "PROCESSOR_BULK_SIZE", c.Bulk.MaxItems)
+	}
+	if c.Callbacks {
+		positive(v, "CALLBACK_WORKERS", c.Callback.Workers)
+		positive(v, "CALLBACK_QUEUE_SIZE", c.Callback.QueueSize)
+		positive(v, "CALLBACK_TIMEOUT_MS", c.Callback.Timeout)
+		positive(v, "CALLBACK_MAX_ATTEMPTS", c.Callback.MaxAttempts)
+	}
+	if c.CPUShed.Enabled {
+		v.check(c.CPUShed.ThresholdPercent > 0 && c.CPUShed.ThresholdPercent < 100,
+			"CPU_SHED_THRESHOLD_PERCENT: must be between 1 and 99, got %d", c.CPUShed.ThresholdPercent)
+		v.check(c.CPUShed.MaxRejectPercent > 0 && c.CPUShed.MaxRejectPercent <= 100,
+			"CPU_SHED_MAX_REJECT_PERCENT: must be between 1 and 100, got %d", c.CPUShed.MaxRejectPercent)
+		positive(v, "CPU_SHED_INTERVAL_MS", c.CPUShed.Interval)
+	}
+	for _, peer := range c.PeerURLs {
+		v.url("PEER_URLS", peer, "http", "https")
+	}
+	if c.Journal.Path != "" {
+		nonNegative(v, "FAILURE_JOURNAL_MAX_BYTES", c.Journal.MaxBytes)
+		nonNegative(v, "FAILURE_JOURNAL_RETAIN", c.Journal.Retain)
+		positive(v, "FAILURE_JOURNAL_FLUSH_MS", c.Journal.FlushInterval)
+		positive(v, "FAILURE_JOURNAL_QUEUE_SIZE", c.Journal.QueueSize)
+	}
+	v.check(!c.Expvar || c.Server.AdminAddr != "", "EXPVAR: /debug/vars is served only on the admin listener, set ADMIN_ADDR")
+	if c.StatsD.Addr != "" {
+		v.hostPort("STATSD_ADDR", c.StatsD.Addr)
+		positive(v, "STATSD_FLUSH_MS", c.StatsD.FlushInterval)
+		positive(v, "STATSD_QUEUE_SIZE", c.StatsD.QueueSize)
+	}
+	if c.Pprof.Enabled {
+		v.hostPort("PPROF_ADDR", c.Pprof.Addr)
+		v.check(!server.ListenTCP || !samePort(c.Pprof.Addr, server.Addr),
+			"PPROF_ADDR: %s would share the public port of HTTP_ADDR %s", c.Pprof.Addr, server.Addr)
+		nonNegative(v, "PPROF_BLOCK_RATE", c.Pprof.BlockRate)
+		nonNegative(v, "PPROF_MUTEX_FRACTION", c.Pprof.MutexFraction)
+	}
+
+	nonNegative(v, "STORE_BUCKET_HOURS", c.MemoryStore.BucketRetention)
+	if c.DatabaseURL != "" {
+		pg := c.Postgres
+		positive(v, "PG_MAX_CONNS", int(pg.MaxConns))
+		nonNegative(v, "PG_MIN_CONNS", int(pg.MinConns))
+		v.check(pg.MinConns <= pg.MaxConns, "PG_MIN_CONNS: %d exceeds PG_MAX_CONNS %d", pg.MinConns, pg.MaxConns)
+		positive(v, "PG_MAX_CONN_LIFETIME_SEC", pg.MaxConnLifetime)
+		positive(v, "PG_MAX_CONN_IDLE_SEC", pg.MaxConnIdleTime)
+		positive(v, "PG_BUFFER_SIZE", pg.BufferSize)
+		positive(v, "PG_BATCH_SIZE", pg.BatchSize)
+	}
+
+	positive(v, "LOG_SAMPLE_EVERY", c.LogSampleEvery)
+	v.check(c.MemoryHeadroomPercent >= 0 && c.MemoryHeadroomPercent < 100,
+		"MEMORY_HEADROOM_PERCENT: must be between 0 and 99, got %d", c.MemoryHeadroomPercent)
+	v.check(c.ServiceName != "", "OTEL_SERVICE_NAME: must not be empty")
+
+	return errors.Join(v.errs...)
+}
+
+// String resume a configuração em uma linha para o log de boot, com as
+// senhas das URLs mascaradas
+func (c Config) String() string {
+	var b strings.Builder
+	field := func(key string, value any) {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%s=%v", key, value)
+	}
+
+	field("default_processor", redactURL(c.Processors.DefaultURL))
+	field("fallback_processor", redactURL(c.Processors.FallbackURL))
+	if len(c.Processors.DefaultReplicaURLs) > 0 {
+		field("default_processor_replicas", strings.Join(mapStrings(slices.Clone(c.Processors.DefaultReplicaURLs), redactURL), ","))
+	}
+	if len(c.Processors.FallbackReplicaURLs) > 0 {
+		field("fallback_processor_replicas", strings.Join(mapStrings(slices.Clone(c.Processors.FallbackReplicaURLs), redactURL), ","))
+	}
+	field("processor_timeout", c.Processors.Timeout)
+	if c.Processors.AdaptiveTimeout {
+		field("adaptive_timeout", fmt.Sprintf("%d%%_of_p99[%s..%s]", c.Processors.TimeoutP99Percent, c.Processors.TimeoutMin, c.Processors.TimeoutMax))
+	}
+	if c.Processors.RateLimit > 0 {
+		field("processor_rate_limit", fmt.Sprintf("%d/s_burst_%d", c.Processors.RateLimit, c.Processors.RateBurst))
+		field("processor_rate_limit_auto", c.Processors.RateAuto)
+	}
+	field("breaker", fmt.Sprintf("%d%%_of_%d+_in_%s", c.Processors.BreakerFailurePercent, c.Processors.BreakerMinRequests, c.Processors.BreakerWindow))
+	field("breaker_open", fmt.Sprintf("%s_x%d_max_%s_reset_%s", c.Processors.BreakerOpenBase, c.Processors.BreakerOpenMultiplier, c.Processors.BreakerOpenMax, c.Processors.BreakerOpenReset))
+	field("processor_retries", c.Processors.Retries)
+	if c.Processors.Retries > 0 {
+		field("processor_retry_delay", c.Processors.RetryDelay)
+		field("processor_retry_after_send", c.Processors.RetryAfterSend)
+	}
+	field("processor_conn_metrics", c.Processors.ConnMetrics)
+	field("default_processor_h2c", c.Processors.DefaultH2C)
+	field("fallback_processor_h2c", c.Processors.FallbackH2C)
+	field("dns_cache_ttl", c.Processors.DNSCacheTTL)
+	field("chaos", c.Processors.Chaos)
+	field("processor_exchange_log_every", c.Processors.ExchangeLogEvery)
+	field("processor_exchange_log_errors_per_sec", c.Processors.ExchangeLogErrorsPerSec)
+	if c.Processors.ExchangeLogEvery > 0 || c.Processors.ExchangeLogErrorsPerSec > 0 {
+		field("processor_exchange_log_max_bytes", c.Processors.ExchangeLogMaxBytes)
+	}
+	field("clock_skew_warn", c.Processors.ClockSkewWarn)
+	field("clock_skew_correction", c.Processors.ClockSkewCorrection)
+	if c.Processors.Snapshot {
+		field("summary_snapshot", fmt.Sprintf("%s_every_%s", c.Processors.SnapshotPath, c.Processors.SnapshotInterval))
+	}
+	field("processor_receipt_max_bytes", c.Processors.ReceiptMaxBytes)
+	if c.Processors.ReceiptMaxBytes > 0 {
+		field("processor_receipt_strict", c.Processors.ReceiptStrict)
+	}
+	field("default_processor_idempotency_headers", strings.Join(c.Processors.DefaultIdempotencyHeaders, ","))
+	field("fallback_processor_idempotency_headers", strings.Join(c.Processors.FallbackIdempotencyHeaders, ","))
+	field("processor_duplicate_statuses", strings.ReplaceAll(fmt.Sprint(c.Processors.DuplicateStatuses), " ", ","))
+	field("amount_buckets", strings.ReplaceAll(fmt.Sprint(c.Processors.AmountBuckets), " ", ","))
+	field("health_check_interval", c.Processors.HealthCheckInterval)
+	field("warmup_connections", c.Processors.WarmupConnections)
+	if c.Processors.DefaultToken != "" || c.Processors.FallbackToken != "" {
+		field("processor_token_header", c.Processors.TokenHeader)
+		field("default_processor_token", redactSecret(c.Processors.DefaultToken))
+		field("fallback_processor_token", redactSecret(c.Processors.FallbackToken))
+	}
+	if len(c.Processors.DefaultHeaders) > 0 {
+		field("default_processor_headers", headerNames(c.Processors.DefaultHeaders))
+	}
+	if len(c.Processors.FallbackHeaders) > 0 {
+		field("fallback_processor_headers", headerNames(c.Processors.FallbackHeaders))
+	}
+
+	field("workers", c.Pool.Workers)
+	field("queue_size", c.Pool.QueueSize)
+	field("batch_size", c.Pool.BatchSize)
+	field("batch_flush", c.Pool.BatchFlush)
+	field("batch_parallelism", c.Pool.BatchParallelism)
+	field("queue_ttl", c.Pool.QueueTTL)
+	field("retry_budget", fmt.Sprintf("%d_attempts_%s", c.Pool.RetryMaxAttempts, c.Pool.RetryMaxElapsed))
+	field("autoscale", c.Pool.Autoscale)
+	if c.Pool.Autoscale {
+		field("min_workers", c.Pool.MinWorkers)
+		field("max_workers", c.Pool.MaxWorkers)
+	}
+
+	field("queue_backend", c.QueueBackend)
+	if c.Pool.SpillPath != "" {
+		field("queue_spill_file", c.Pool.SpillPath)
+	}
+	field("redis_url", redactURL(c.RedisURL))
+	field("database_url", redactURL(c.DatabaseURL))
+	field("max_amount", c.MaxAmount)
+	if len(c.PaymentTypes) > 0 {
+		field("payment_types", "["+strings.Join(c.PaymentTypes, ",")+"]")
+	}
+	if len(c.Processors.RoutingRules) > 0 {
+		field("routing_rules", formatRoutingRules(c.Processors.RoutingRules))
+	}
+	field("routing_strategy", c.Processors.RoutingStrategy)
+	if c.Processors.ShadowPercent > 0 {
+		field("shadow", fmt.Sprintf("%d%%_max_%d_in_flight", c.Processors.ShadowPercent, c.Processors.ShadowMaxInFlight))
+	}
+	if c.Processors.DefaultWeight > 0 || c.Processors.FallbackWeight > 0 {
+		field("processor_weights", fmt.Sprintf("default_%d_fallback_%d", c.Processors.DefaultWeight, c.Processors.FallbackWeight))
+	}
+	field("default_currency", c.DefaultCurrency)
+	if len(c.ExtraCurrencies) > 0 {
+		field("extra_currencies", "["+strings.Join(c.ExtraCurrencies, ",")+"]")
+	}
+
+	field("engine", c.Server.Engine)
+	if c.Server.ListenTCP {
+		field("addr", c.Server.Addr)
+	}
+	if c.Server.Socket != "" {
+		field("socket", c.Server.Socket)
+	}
+	if c.Server.GRPCAddr != "" {
+		field("grpc_addr", c.Server.GRPCAddr)
+	}
+	if c.Server.AdminAddr != "" {
+		field("admin_addr", c.Server.AdminAddr)
+	}
+	field("read_timeout", c.Server.ReadTimeout)
+	field("write_timeout", c.Server.WriteTimeout)
+	field("idle_timeout", c.Server.IdleTimeout)
+	field("shutdown_timeout", c.Server.ShutdownTimeout)
+	field("ready_queue_percent", c.Server.ReadyQueuePercent)
+	field("ready_unhealthy_grace", c.Server.ReadyUnhealthyGrace)
+	if c.Server.ShutdownReadyDelay > 0 {
+		field("shutdown_ready_delay", c.Server.ShutdownReadyDelay)
+	}
+	if c.Server.ShutdownReportFile != "" {
+		field("shutdown_report_file", c.Server.ShutdownReportFile)
+	}
+	field("max_in_flight", c.Server.MaxInFlight)
+	if c.Server.MaxInFlight > 0 {
+		field("in_flight_wait", c.Server.InFlightWait)
+	}
+	field("access_log_sample_every", c.Server.AccessLogSampleEvery)
+	if c.Server.GzipResponses {
+		field("gzip_min_bytes", c.Server.GzipMinBytes)
+	}
+
+	field("max_body_bytes", c.Ingest.MaxBodyBytes)
+	field("max_batch", fmt.Sprintf("%d_items_%d_bytes", c.Ingest.MaxBatchItems, c.Ingest.MaxBatchBodyBytes))
+	field("content_type_mode", c.Ingest.ContentTypeMode)
+	if c.Ingest.InlineFallback {
+		field("inline_max_concurrent", c.Ingest.InlineMaxConcurrent)
+	}
+	field("sync_max_concurrent", c.Ingest.SyncMaxConcurrent)
+	if len(c.CORS.Origins) > 0 {
+		field("cors_origins", "["+strings.Join(c.CORS.Origins, ",")+"]")
+		field("cors_allow_credentials", c.CORS.AllowCredentials)
+	}
+	if c.RateLimit.Enabled {
+		field("rate_limit", fmt.Sprintf("%v/s_burst_%d", c.RateLimit.Rate, c.RateLimit.Burst))
+		field("rate_limit_trust_proxy", c.RateLimit.TrustProxy)
+	}
+	if c.CPUShed.Enabled {
+		field("cpu_shed", fmt.Sprintf("%d%%_max_reject_%d%%_every_%s", c.CPUShed.ThresholdPercent, c.CPUShed.MaxRejectPercent, c.CPUShed.Interval))
+	}
+	if c.Admission.Enabled {
+		field("admission", fmt.Sprintf("%d%%..%d%%_reject_%d%%", c.Admission.LowWatermark, c.Admission.HighWatermark, c.Admission.RejectPercent))
+	}
+	if c.ProcessorBulk {
+		field("processor_bulk", fmt.Sprintf("%d_per_call", c.Bulk.MaxItems))
+	}
+	field("callbacks", c.Callbacks)
+	if len(c.PeerURLs) > 0 {
+		field("peers", strings.Join(mapStrings(slices.Clone(c.PeerURLs), redactURL), ","))
+	}
+	if c.Journal.Path != "" {
+		field("failure_journal", c.Journal.Path)
+	}
+	field("expvar", c.Expvar)
+	if c.StatsD.Addr != "" {
+		field("statsd", c.StatsD.Addr)
+	}
+	if c.Pprof.Enabled {
+		field("pprof_addr", c.Pprof.Addr)
+	}
+	field("fast_json", c.FastJSON)
+	return b.String()
+}
+
+// redactURL mascara a senha de uma URL. O que não é URL (uma connection
+// string chave=valor, por exemplo) é omitido por inteiro.
+func redactURL(raw string) string {
+	if raw == "" {
+		return `""`
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" {
+		return "[redacted]"
+	}
+	return u.Redacted()
+}
+
+// redactSecret indica apenas se o segredo está definido
+func redactSecret(secret string) string {
+	if secret == "" {
+		return `""`
+	}
+	return "[redacted]"
+}
+
+// headerNames lista os headers configurados sem os valores, que podem
+// conter credenciais
+func headerNames(headers http.Header) string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return "[" + strings.Join(names, ",") + "]"
+}
+
+// validHeaderName aceita os caracteres de token de um nome de header HTTP
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c > unicode.MaxASCII || c <= ' ' || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// validLabel aceita valores que viram label de métrica sem escape
+func validLabel(value string) bool {
+	for _, c := range value {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return value != ""
+}
+
+// mapStrings aplica fn a cada item da lista
+func mapStrings(items []string, fn func(string) string) []string {
+	for i, item := range items {
+		items[i] = fn(item)
+	}
+	return items
+}
+
+// loader lê cada chave dos overrides, do ambiente ou, se ausente, do
+// arquivo de configuração, acumulando os valores ilegíveis. Com describe
+// ele não lê nada: apenas registra as chaves e os padrões em vars.
+type loader struct {
+	getenv    func(string) string
+	overrides map[string]Override
+	file      *file // nil sem arquivo
+	errs      []error
+
+	describe bool
+	vars     []Variable
+}
+
+// described registra a chave quando o loader só descreve as variáveis
+func (l *loader) described(key, defaultValue string) bool {
+	if l.describe {
+		l.vars = append(l.vars, Variable{Key: key, Default: defaultValue})
+	}
+	return l.describe
+}
+
+// lookup retorna o valor da chave e como citá-la em um erro: a flag, o
+// nome da variável ou a chave e a linha do arquivo. O arquivo é consultado
+// mesmo quando o ambiente prevalece, para a chave não ser tida como
+// desconhecida.
+func (l *loader) lookup(key string) (value, source string, ok bool) {
+	value, source, ok = l.file.lookup(key)
+	if override, set := l.overrides[key]; set {
+		return override.Value, override.Source, true
+	}
+	if env := l.getenv(key); env != "" {
+		return env, key, true
+	}
+	return value, source, ok
+}
+
+func (l *loader) string(key, defaultValue string) string {
+	if l.described(key, defaultValue) {
+		return defaultValue
+	}
+	if value, _, ok := l.lookup(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
+func (l *loader) int(key string, defaultValue int) int {
+	if l.described(key, strconv.Itoa(defaultValue)) {
+		return defaultValue
+	}
+	value, source, ok := l.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: %q is not an integer", source, value))
+		return defaultValue
+	}
+	return n
+}
+
+// millis lê uma duração em milissegundos
+func (l *loader) millis(key string, defaultValue time.Duration) time.Duration {
+	return l.duration(key, defaultValue, time.Millisecond)
+}
+
+// duration lê uma duração como um número inteiro de unit
+func (l *loader) duration(key string, defaultValue, unit time.Duration) time.Duration {
+	return time.Duration(l.int(key, int(defaultValue/unit))) * unit
+}
+
+func (l *loader) bool(key string, defaultValue bool) bool {
+	if l.described(key, strconv.FormatBool(defaultValue)) {
+		return defaultValue
+	}
+	value, source, ok := l.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: %q is not a boolean", source, value))
+		return defaultValue
+	}
+	return b
+}
+
+// secret lê um valor secreto; na descrição das variáveis o padrão não
+// aparece
+func (l *loader) secret(key, defaultValue string) string {
+	if l.described(key, "") {
+		return defaultValue
+	}
+	return l.string(key, defaultValue)
+}
+
+// list lê uma lista separada por vírgulas, descartando os itens vazios
+func (l *loader) list(key string, defaultValue []string) []string {
+	if l.described(key, strings.Join(defaultValue, ",")) {
+		return defaultValue
+	}
+	value, _, ok := l.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// int64s lê uma lista de inteiros separada por vírgulas
+func (l *loader) int64s(key string, defaultValue []int64) []int64 {
+	formatted := make([]string, len(defaultValue))
+	for i, n := range defaultValue {
+		formatted[i] = strconv.FormatInt(n, 10)
+	}
+	if l.described(key, strings.Join(formatted, ",")) {
+		return defaultValue
+	}
+	value, source, ok := l.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+
+	var items []int64
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(item, 10, 64)
+		if err != nil {
+			l.errs = append(l.errs, fmt.Errorf("%s: %q is not an integer", source, item))
+			return defaultValue
+		}
+		items = append(items, n)
+	}
+	return items
+}
+
+// headers lê uma lista "Nome=valor,Nome=valor". Os erros citam a posição
+// da entrada e nunca o valor, que pode ser uma credencial.
+func (l *loader) headers(key string, defaultValue http.Header) http.Header {
+	if l.described(key, "") {
+		return defaultValue
+	}
+	value, source, ok := l.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+
+	headers := make(http.Header)
+	for i, entry := range strings.Split(value, ",") {
+		name, headerValue, found := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !found || !validHeaderName(name) || strings.ContainsAny(headerValue, "\r\n") {
+			l.errs = append(l.errs, fmt.Errorf("%s: entry %d is not a valid header=value pair", source, i+1))
+			continue
+		}
+		headers.Add(name, strings.TrimSpace(headerValue))
+	}
+	return headers
+}
+
+// routingRules lê as regras "type:processador,processador;type:processador",
+// com o type em minúsculas como em PAYMENT_TYPES
+func (l *loader) routingRules(key string, defaultValue []queue.RoutingRule) []queue.RoutingRule {
+	if l.described(key, formatRoutingRules(defaultValue)) {
+		return defaultValue
+	}
+	value, source, ok := l.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+
+	var rules []queue.RoutingRule
+	for i, entry := range strings.Split(value, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		paymentType, processors, found := strings.Cut(entry, ":")
+		if !found {
+			l.errs = append(l.errs, fmt.Errorf("%s: entry %d (%q) is not a type:processors pair", source, i+1, strings.TrimSpace(entry)))
+			continue
+		}
+		rule := queue.RoutingRule{Type: strings.ToLower(strings.TrimSpace(paymentType))}
+		for _, processor := range strings.Split(processors, ",") {
+			if processor = strings.TrimSpace(processor); processor != "" {
+				rule.Processors = append(rule.Processors, processor)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// formatRoutingRules escreve as regras no formato do ROUTING_RULES
+func formatRoutingRules(rules []queue.RoutingRule) string {
+	entries := make([]string, len(rules))
+	for i, rule := range rules {
+		entries[i] = rule.Type + ":" + strings.Join(rule.Processors, ",")
+	}
+	return strings.Join(entries, ";")
+}
+
+// fileMode lê permissões em octal, como no chmod
+func (l *loader) fileMode(key string, defaultValue os.FileMode) os.FileMode {
+	if l.described(key, fmt.Sprintf("%#o", uint32(defaultValue))) {
+		return defaultValue
+	}
+	value, source, ok := l.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0o777 {
+		l.errs = append(l.errs, fmt.Errorf("%s: %q is not an octal file mode", source, value))
+		return defaultValue
+	}
+	return os.FileMode(mode)
+}
+
+// validator acumula os erros de validação
+type validator struct {
+	errs []error
+}
+
+func (v *validator) check(ok bool, format string, args ...any) {
+	if !ok {
+		v.errs = append(v.errs, fmt.Errorf(format, args...))
+	}
+}
+
+// positive exige valor maior que zero (contagens e durações)
+func positive[T int | int64 | time.Duration](v *validator, key string, value T) {
+	v.check(value > 0, "%s: must be positive, got %v", key, value)
+}
+
+// nonNegative aceita zero, que desliga a opção
+func nonNegative[T int | int64 | time.Duration](v *validator, key string, value T) {
+	v.check(value >= 0, "%s: must not be negative, got %v", key, value)
+}
+
+// oneOf exige um dos valores aceitos
+func (v *validator) oneOf(key, value string, accepted ...string) {
+	v.check(slices.Contains(accepted, value), "%s: %q must be one of %s", key, value, strings.Join(accepted, ", "))
+}
+
+// hostPort exige um endereço host:porta, com host opcional
+func (v *validator) hostPort(key, addr string) {
+	_, port, err := net.SplitHostPort(addr)
+	if err == nil {
+		_, err = net.LookupPort("tcp", port)
+	}
+	v.check(err == nil, "%s: %q is not a host:port address", key, addr)
+}
+
+// samePort indica se os dois endereços TCP disputariam a mesma porta: porta
+// igual e o mesmo host, ou um deles em todas as interfaces
+func samePort(a, b string) bool {
+	hostA, portA, errA := net.SplitHostPort(a)
+	hostB, portB, errB := net.SplitHostPort(b)
+	if errA != nil || errB != nil || portA != portB {
+		return false
+	}
+	return hostA == hostB || wildcardHost(hostA) || wildcardHost(hostB)
+}
+
+func wildcardHost(host string) bool {
+	return host == "" || host == "0.0.0.0" || host == "::"
+}
+
+// url exige uma URL absoluta com um dos schemes aceitos
+func (v *validator) url(key, raw string, schemes ...string) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		v.errs = append(v.errs, fmt.Errorf("%s: invalid URL: %w", key, err))
+		return
+	}
+	v.check(slices.Contains(schemes, u.Scheme), "%s: scheme %q must be one of %s", key, u.Scheme, strings.Join(schemes, ", "))
+	v.check(u.Host != "" || u.Scheme == "unix", "%s: URL has no host", key)
+}
@@ -0,0 +1,285 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validateErr valida cfg e retorna o texto do erro, vazio se válida
+func validateErr(cfg Config) string {
+	if err := cfg.Validate(); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func TestValidatePoolBatching(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*Config)
+		wantErr string // trecho esperado no erro; vazio aceita
+	}{
+		{"defaults", func(c *Config) {}, ""},
+		{"zero flush processes at once", func(c *Config) { c.Pool.BatchFlush = 0 }, ""},
+		{"negative flush", func(c *Config) { c.Pool.BatchFlush = -time.Millisecond }, "BATCH_FLUSH_MS"},
+		{"parallelism equal to batch size", func(c *Config) { c.Pool.BatchSize, c.Pool.BatchParallelism = 4, 4 }, ""},
+		{"parallelism above batch size", func(c *Config) { c.Pool.BatchSize, c.Pool.BatchParallelism = 4, 5 }, "BATCH_PARALLELISM: 5 exceeds BATCH_SIZE 4"},
+		{"zero parallelism", func(c *Config) { c.Pool.BatchParallelism = 0 }, "BATCH_PARALLELISM"},
+		{"zero batch size", func(c *Config) { c.Pool.BatchSize = 0 }, "BATCH_SIZE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.modify(&cfg)
+			got := validateErr(cfg)
+			if tt.wantErr == "" && got != "" {
+				t.Fatalf("Validate() = %q, want nil", got)
+			}
+			if !strings.Contains(got, tt.wantErr) {
+				t.Fatalf("Validate() = %q, want it to mention %q", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateFeatures(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*Config)
+		wantErr string
+	}{
+		{"strict content type", func(c *Config) { c.Ingest.ContentTypeMode = "strict" }, ""},
+		{"unknown content type mode", func(c *Config) { c.Ingest.ContentTypeMode = "json" }, "CONTENT_TYPE_MODE"},
+		{"zero body limit", func(c *Config) { c.Ingest.MaxBodyBytes = 0 }, "MAX_BODY_BYTES"},
+		{"sync mode off with short write timeout", func(c *Config) {
+			c.Ingest.SyncMaxConcurrent, c.Server.WriteTimeout = 0, 100*time.Millisecond
+		}, ""},
+		{"sync mode with short write timeout", func(c *Config) { c.Server.WriteTimeout = 100 * time.Millisecond }, "SYNC_MAX_CONCURRENT"},
+		{"disabled rate limit is not checked", func(c *Config) { c.RateLimit.Burst = 0 }, ""},
+		{"rate limit without burst", func(c *Config) { c.RateLimit.Enabled, c.RateLimit.Burst = true, 0 }, "RATE_LIMIT_BURST"},
+		{"admission watermarks inverted", func(c *Config) {
+			c.Admission.Enabled, c.Admission.HighWatermark, c.Admission.LowWatermark = true, 40, 60
+		}, "ADMISSION_HIGH_WATERMARK"},
+		{"cors origin with path", func(c *Config) { c.CORS.Origins = []string{"https://dash.example.com/app"} }, "CORS_ALLOWED_ORIGINS"},
+		{"cors any origin", func(c *Config) { c.CORS.Origins = []string{"*"} }, ""},
+		{"bulk with relative url", func(c *Config) { c.ProcessorBulk, c.Bulk.DefaultURL = true, "/batch" }, "DEFAULT_PROCESSOR_BULK_URL"},
+		{"callbacks without workers", func(c *Config) { c.Callbacks, c.Callback.Workers = true, 0 }, "CALLBACK_WORKERS"},
+		{"peer without scheme", func(c *Config) { c.PeerURLs = []string{"api2:8080"} }, "PEER_URLS"},
+		{"postgres pool inverted", func(c *Config) {
+			c.DatabaseURL, c.Postgres.MinConns, c.Postgres.MaxConns = "postgres://db/rinha", 5, 2
+		}, "PG_MIN_CONNS"},
+		{"cpu shed threshold at 100%", func(c *Config) { c.CPUShed.Enabled, c.CPUShed.ThresholdPercent = true, 100 }, "CPU_SHED_THRESHOLD_PERCENT"},
+		{"journal without queue", func(c *Config) { c.Journal.Path, c.Journal.QueueSize = "failed.jsonl", 0 }, "FAILURE_JOURNAL_QUEUE_SIZE"},
+		{"statsd address without port", func(c *Config) { c.StatsD.Addr = "datadog-agent" }, "STATSD_ADDR"},
+		{"pprof on the public port", func(c *Config) { c.Pprof.Enabled, c.Pprof.Addr = true, "127.0.0.1:8080" }, "PPROF_ADDR: 127.0.0.1:8080 would share the public port"},
+		{"pprof on another port", func(c *Config) { c.Pprof.Enabled, c.Pprof.Addr = true, ":6060" }, ""},
+		{"pprof off is not checked", func(c *Config) { c.Pprof.Addr = ":8080" }, ""},
+		{"grpc on the public port", func(c *Config) { c.Server.GRPCAddr = "0.0.0.0:8080" }, "GRPC_ADDR"},
+		{"admin on the public port", func(c *Config) { c.Server.AdminAddr = ":8080" }, "ADMIN_ADDR: :8080 would share the public port"},
+		{"admin on the pprof port", func(c *Config) {
+			c.Server.AdminAddr, c.Pprof.Enabled = "127.0.0.1:6060", true
+		}, "ADMIN_ADDR: 127.0.0.1:6060 would share the port of PPROF_ADDR"},
+		{"admin without port", func(c *Config) { c.Server.AdminAddr = "localhost" }, "ADMIN_ADDR"},
+		{"admin on its own port", func(c *Config) { c.Server.AdminAddr = "127.0.0.1:9090" }, ""},
+		{"expvar without admin listener", func(c *Config) { c.Expvar = true }, "EXPVAR"},
+		{"expvar on the admin listener", func(c *Config) { c.Expvar, c.Server.AdminAddr = true, "127.0.0.1:9090" }, ""},
+		{"headroom of 100%", func(c *Config) { c.MemoryHeadroomPercent = 100 }, "MEMORY_HEADROOM_PERCENT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.modify(&cfg)
+			got := validateErr(cfg)
+			if tt.wantErr == "" && got != "" {
+				t.Fatalf("Validate() = %q, want nil", got)
+			}
+			if !strings.Contains(got, tt.wantErr) {
+				t.Fatalf("Validate() = %q, want it to mention %q", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsUnreadableValues(t *testing.T) {
+	t.Setenv("MAX_BODY_BYTES", "4k")
+	t.Setenv("GZIP_RESPONSES", "yes please")
+
+	got := validateErr(Load(""))
+	for _, want := range []string{`MAX_BODY_BYTES: "4k" is not an integer`, `GZIP_RESPONSES: "yes please" is not a boolean`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Validate() = %q, want it to report %s", got, want)
+		}
+	}
+}
+
+func TestLoadDerivesDefaults(t *testing.T) {
+	t.Setenv("WORKER_COUNT", "300") // acima do MAX_WORKERS padrão
+	t.Setenv("DEFAULT_PROCESSOR_URL", "http://pd:8080/payments")
+	t.Setenv("MAX_BATCH_ITEMS", "5")
+
+	cfg := Load("")
+	if cfg.Server.MaxInFlight != 300*inFlightPerWorker {
+		t.Errorf("MaxInFlight = %d, want %d for 300 workers", cfg.Server.MaxInFlight, 300*inFlightPerWorker)
+	}
+	if cfg.Bulk.DefaultURL != "http://pd:8080/payments/batch" {
+		t.Errorf("Bulk.DefaultURL = %q, want it under DEFAULT_PROCESSOR_URL", cfg.Bulk.DefaultURL)
+	}
+	if want := int64(5 * DefaultMaxBodyBytes); cfg.Ingest.MaxBatchBodyBytes != want {
+		t.Errorf("MaxBatchBodyBytes = %d, want %d", cfg.Ingest.MaxBatchBodyBytes, want)
+	}
+}
+
+// writeConfigFile grava o arquivo de configuração do teste
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// envFrom é um getenv que lê só de vars
+func envFrom(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+// loaded é a configuração lida sem o estado do loader, para comparar com
+// reflect.DeepEqual
+func loaded(t *testing.T, path string, vars map[string]string) Config {
+	t.Helper()
+	cfg := LoadFrom(path, envFrom(vars), nil)
+	if len(cfg.loadErrs) > 0 {
+		t.Fatalf("load errors: %v", errors.Join(cfg.loadErrs...))
+	}
+	cfg.file = nil
+	return cfg
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfigFile(t, "worker_count: 8\nqueue_size: 500\n")
+
+	tests := []struct {
+		name        string
+		path        string
+		env         map[string]string
+		wantWorkers int
+		wantQueue   int
+	}{
+		{"defaults", "", nil, 4, 20000},
+		{"file over defaults", path, nil, 8, 500},
+		{"env over file", path, map[string]string{"WORKER_COUNT": "16"}, 16, 500},
+		{"env without file", "", map[string]string{"QUEUE_SIZE": "300"}, 4, 300},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loaded(t, tt.path, tt.env)
+			if cfg.Pool.Workers != tt.wantWorkers || cfg.Pool.QueueSize != tt.wantQueue {
+				t.Errorf("workers %d, queue %d; want %d and %d",
+					cfg.Pool.Workers, cfg.Pool.QueueSize, tt.wantWorkers, tt.wantQueue)
+			}
+		})
+	}
+}
+
+// changedValue é um valor diferente do padrão para cada variável; as de
+// padrão vazio ou com formato próprio estão em samples
+func changedValue(t *testing.T, v Variable) string {
+	samples := map[string]string{
+		"DEFAULT_PROCESSOR_REPLICA_URLS":  "http://pd2:8080/payments",
+		"FALLBACK_PROCESSOR_REPLICA_URLS": "http://pf2:8080/payments",
+		"PROCESSOR_DUPLICATE_STATUSES":    "409,410",
+		"AMOUNT_BUCKETS":                  "100,200",
+		"ROUTING_RULES":                   "pix:fallback",
+		"DEFAULT_PROCESSOR_TOKEN":         "default-token",
+		"FALLBACK_PROCESSOR_TOKEN":        "fallback-token",
+		"DEFAULT_PROCESSOR_HEADERS":       "X-Tenant=a",
+		"FALLBACK_PROCESSOR_HEADERS":      "X-Tenant=b",
+		"QUEUE_SPILL_FILE":                "spill.jsonl",
+		"REDIS_URL":                       "redis://redis:6379/0",
+		"DATABASE_URL":                    "postgres://db/rinha",
+		"PAYMENT_TYPES":                   "credit,debit",
+		"EXTRA_CURRENCIES":                "ARS",
+		"LISTEN_SOCKET":                   "/tmp/rinha.sock",
+		"GRPC_ADDR":                       ":9000",
+		"ADMIN_ADDR":                      "127.0.0.1:9090",
+		"SHUTDOWN_REPORT_FILE":            "report.json",
+		"CORS_ALLOWED_ORIGINS":            "https://dash.example.com",
+		"PEER_URLS":                       "http://api2:8080",
+		"FAILURE_JOURNAL_FILE":            "failed.jsonl",
+		"STATSD_ADDR":                     "datadog-agent:8125",
+		"STATSD_TAGS":                     "env:test",
+	}
+	if value, ok := samples[v.Key]; ok {
+		return value
+	}
+	if n, err := strconv.Atoi(v.Default); err == nil {
+		return strconv.Itoa(n + 1) // também um modo octal válido para o 0666
+	}
+	if b, err := strconv.ParseBool(v.Default); err == nil {
+		return strconv.FormatBool(!b)
+	}
+	if v.Default == "" {
+		t.Fatalf("%s has no default; add a sample value for it", v.Key)
+	}
+	return v.Default + "x"
+}
+
+func TestEveryVariableRoundTripsThroughTheFile(t *testing.T) {
+	// Os padrões escritos no arquivo voltam como os padrões (com os
+	// derivados, como as URLs de lote), sem chave desconhecida
+	defaults := loaded(t, "", nil)
+	var content strings.Builder
+	for _, v := range Variables() {
+		if v.Default != "" {
+			fmt.Fprintf(&content, "%s: %s\n", strings.ToLower(v.Key), strconv.Quote(v.Default))
+		}
+	}
+	path := writeConfigFile(t, content.String())
+	raw := LoadFrom(path, envFrom(nil), nil)
+	for _, value := range raw.file.values {
+		if !value.used {
+			t.Errorf("key %s (line %d) was not read", value.key, value.line)
+		}
+	}
+	if cfg := loaded(t, path, nil); !reflect.DeepEqual(cfg, defaults) {
+		t.Errorf("defaults written to the file load as\n%s\nwant\n%s", cfg, defaults)
+	}
+
+	// Cada variável chega a um campo, e pelo arquivo ou pelo ambiente dá a
+	// mesma configuração
+	for _, v := range Variables() {
+		t.Run(v.Key, func(t *testing.T) {
+			value := changedValue(t, v)
+			fromFile := loaded(t, writeConfigFile(t, strings.ToLower(v.Key)+": "+strconv.Quote(value)+"\n"), nil)
+			if reflect.DeepEqual(fromFile, defaults) {
+				t.Fatalf("%s=%q left the config at its defaults", v.Key, value)
+			}
+			fromEnv := loaded(t, "", map[string]string{v.Key: value})
+			if !reflect.DeepEqual(fromFile, fromEnv) {
+				t.Errorf("%s=%q loads differently from the file and the environment", v.Key, value)
+			}
+		})
+	}
+}
+
+func TestLoadFileErrorsNameKeyAndLine(t *testing.T) {
+	path := writeConfigFile(t, "worker_count: 8\nqueue_size: lots\nworker_count: 9\n")
+
+	got := validateErr(LoadFrom(path, envFrom(nil), nil))
+	for _, want := range []string{
+		fmt.Sprintf(`queue_size (%s line 2): "lots" is not an integer`, path),
+		fmt.Sprintf("worker_count (%s line 3): duplicate key, first set on line 1", path),
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Validate() = %q, want it to report %s", got, want)
+		}
+	}
+}
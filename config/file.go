@@ -0,0 +1,113 @@
+package config
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// file é o arquivo de configuração: um mapa plano de chaves iguais às
+// variáveis de ambiente, em minúsculas, para valores simples
+//
+//	default_processor_url: http://localhost:8001/payments
+//	worker_count: 8
+//	processor_timeout_ms: 500
+//
+// JSON também é aceito ({"worker_count": 8}), por ser YAML válido.
+type file struct {
+	path   string
+	values map[string]*fileValue // variável de ambiente → valor
+}
+
+// fileValue é um valor do arquivo com a posição para as mensagens de erro
+type fileValue struct {
+	key   string // como escrita no arquivo
+	value string
+	line  int
+	used  bool // lido pelo Load; os demais são chaves desconhecidas
+}
+
+// readFile lê o arquivo de configuração. Os erros citam o arquivo e a
+// linha; chaves válidas são aproveitadas mesmo com erro em outras.
+func readFile(path string) (*file, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config file: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	f := &file{path: path, values: make(map[string]*fileValue)}
+	if len(root.Content) == 0 {
+		return f, nil // arquivo vazio
+	}
+	doc := root.Content[0]
+	if doc.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("config file %s: line %d: expected a mapping of keys to values", path, doc.Line)
+	}
+
+	var errs []error
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		k, v := doc.Content[i], doc.Content[i+1]
+		switch {
+		case v.Kind != yaml.ScalarNode:
+			errs = append(errs, fmt.Errorf("%s: expected a single value", f.position(k.Value, k.Line)))
+			continue
+		case v.Tag == "!!null":
+			continue // "chave:" sem valor mantém o padrão
+		}
+
+		name := strings.ToUpper(k.Value)
+		if prev, ok := f.values[name]; ok {
+			errs = append(errs, fmt.Errorf("%s: duplicate key, first set on line %d", f.position(k.Value, k.Line), prev.line))
+			continue
+		}
+		f.values[name] = &fileValue{key: k.Value, value: v.Value, line: k.Line}
+	}
+	return f, errors.Join(errs...)
+}
+
+// lookup retorna o valor da variável no arquivo e sua posição
+func (f *file) lookup(key string) (value, source string, ok bool) {
+	if f == nil {
+		return "", "", false
+	}
+	v, ok := f.values[key]
+	if !ok {
+		return "", "", false
+	}
+	v.used = true
+	return v.value, f.position(v.key, v.line), true
+}
+
+// position cita uma chave do arquivo nas mensagens
+func (f *file) position(key string, line int) string {
+	return fmt.Sprintf("%s (%s line %d)", key, f.path, line)
+}
+
+// warnUnknown avisa as chaves que o Load não leu, normalmente erros de
+// digitação, na ordem do arquivo
+func (f *file) warnUnknown() {
+	if f == nil {
+		return
+	}
+	var unknown []*fileValue
+	for _, v := range f.values {
+		if !v.used {
+			unknown = append(unknown, v)
+		}
+	}
+	slices.SortFunc(unknown, func(a, b *fileValue) int { return cmp.Compare(a.line, b.line) })
+	for _, v := range unknown {
+		slog.Warn("unknown config file key, ignoring", "key", v.key, "file", f.path, "line", v.line)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/valyala/fasthttp"
+
+	"github.com/yurimachados/rinha-backend-go/config"
+	"github.com/yurimachados/rinha-backend-go/handlers"
+)
+
+// httpEngine é o servidor HTTP escolhido por HTTP_ENGINE
+type httpEngine interface {
+	// Serve atende o listener até o Shutdown
+	Serve(listener net.Listener) error
+	// Shutdown fecha os listeners e espera as requisições em andamento
+	Shutdown(ctx context.Context) error
+}
+
+// newHTTPEngine monta o net/http (padrão) ou o fasthttp, que atende o
+// ingest diretamente e repassa as demais rotas ao mux. Nos dois toda
+// requisição recebe um id, um pânico em um handler vira 500 em vez de
+// derrubar o processo e o log de acesso (nil desliga) é a camada mais
+// externa, vendo o status final. Logo abaixo dele a duração por rota é
+// medida, incluindo a espera por vaga no limite de requisições simultâneas
+// (nil desliga), que recusa o excesso antes de qualquer trabalho.
+func newHTTPEngine(cfg config.Server, mux *http.ServeMux, paymentHandler *handlers.PaymentHandler, accessLog *handlers.AccessLog, inFlight *handlers.InFlightLimiter) httpEngine {
+	handler := handlers.RequestID(handlers.Recover(mux))
+	routeLatency := paymentHandler.RouteLatency()
+
+	if cfg.Engine == "fasthttp" {
+		return &fastHTTPEngine{server: &fasthttp.Server{
+			Handler:      accessLog.WrapFastHTTP(routeLatency.WrapFastHTTP(inFlight.WrapFastHTTP(paymentHandler.FastHTTPHandler(handler)))),
+			ReadTimeout:  cfg.ReadTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+			IdleTimeout:  cfg.IdleTimeout,
+			// Corpos acima do limite são recusados sem leitura completa e
+			// respondidos com 413 pelo ErrorHandler
+			MaxRequestBodySize:    int(paymentHandler.MaxBodyBytes()),
+			ErrorHandler:          paymentHandler.FastHTTPErrorHandler,
+			NoDefaultServerHeader: true,
+		}}
+	}
+
+	return &http.Server{
+		Handler:      accessLog.Wrap(routeLatency.Wrap(inFlight.Wrap(handler))),
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}
+}
+
+// fastHTTPEngine adapta o fasthttp.Server à interface httpEngine
+type fastHTTPEngine struct {
+	server *fasthttp.Server
+}
+
+// Serve atende o listener; retorna nil após o Shutdown
+func (e *fastHTTPEngine) Serve(listener net.Listener) error {
+	return e.server.Serve(listener)
+}
+
+// Shutdown encerra os listeners e espera as conexões ociosas fecharem
+func (e *fastHTTPEngine) Shutdown(ctx context.Context) error {
+	return e.server.ShutdownWithContext(ctx)
+}
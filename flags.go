@@ -0,0 +1,163 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/yurimachados/rinha-backend-go/config"
+)
+
+// programName aparece na ajuda e no -version
+const programName = "rinha-backend-go"
+
+// cliFlags são as opções de linha de comando. As que foram passadas têm
+// precedência sobre o ambiente e o arquivo de configuração.
+type cliFlags struct {
+	configFile string
+	logLevel   string
+	version    bool
+
+	port        int
+	defaultURL  string
+	fallbackURL string
+	workers     int
+	queueSize   int
+
+	set map[string]bool // flags passadas na linha de comando
+}
+
+// parseFlags lê os argumentos (sem o nome do programa) em um FlagSet
+// próprio; erros e a ajuda do -h saem em output. Retorna flag.ErrHelp
+// para -h.
+func parseFlags(args []string, output io.Writer, getenv func(string) string) (*cliFlags, error) {
+	f := &cliFlags{set: make(map[string]bool)}
+
+	fs := flag.NewFlagSet(programName, flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.StringVar(&f.configFile, "config", getenv("CONFIG_FILE"), "YAML or JSON config `file` (CONFIG_FILE)")
+	fs.StringVar(&f.logLevel, "log-level", getenv("LOG_LEVEL"), "log `level`: debug, info, warn or error (LOG_LEVEL, default info)")
+	fs.BoolVar(&f.version, "version", false, "print build information and exit")
+	fs.Func("port", "TCP `port` to listen on, keeping the host of HTTP_ADDR", func(value string) error {
+		port, err := strconv.Atoi(value)
+		if err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("must be between 1 and 65535")
+		}
+		f.port = port
+		return nil
+	})
+	fs.StringVar(&f.defaultURL, "default-url", "", "default payment processor `URL` (DEFAULT_PROCESSOR_URL)")
+	fs.StringVar(&f.fallbackURL, "fallback-url", "", "fallback payment processor `URL` (FALLBACK_PROCESSOR_URL)")
+	fs.IntVar(&f.workers, "workers", 0, "`count` of workers consuming the queue (WORKER_COUNT)")
+	fs.IntVar(&f.queueSize, "queue-size", 0, "queue `capacity` (QUEUE_SIZE)")
+	fs.Usage = func() { usage(fs) }
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		err := fmt.Errorf("unexpected argument %q", fs.Arg(0))
+		fmt.Fprintln(output, err)
+		fs.Usage()
+		return nil, err
+	}
+	fs.Visit(func(fl *flag.Flag) { f.set[fl.Name] = true })
+	return f, nil
+}
+
+// overrides são as flags passadas, pelo nome da variável que substituem,
+// para o config.LoadFrom: os padrões derivados delas (MAX_IN_FLIGHT dos
+// workers, as URLs de lote) as acompanham. A validação fica para o
+// config.Validate, como para os demais valores.
+func (f *cliFlags) overrides() map[string]config.Override {
+	overrides := make(map[string]config.Override)
+	override := func(name, key, value string) {
+		if f.set[name] {
+			overrides[key] = config.Override{Value: value, Source: "-" + name}
+		}
+	}
+	override("default-url", "DEFAULT_PROCESSOR_URL", f.defaultURL)
+	override("fallback-url", "FALLBACK_PROCESSOR_URL", f.fallbackURL)
+	override("workers", "WORKER_COUNT", strconv.Itoa(f.workers))
+	override("queue-size", "QUEUE_SIZE", strconv.Itoa(f.queueSize))
+	return overrides
+}
+
+// applyPort troca a porta do HTTP_ADDR pela do -port. Ela mantém o host
+// lido pelo Load, então é aplicada sobre a configuração carregada; nenhum
+// padrão deriva dela.
+func (f *cliFlags) applyPort(cfg *config.Config) {
+	if !f.set["port"] {
+		return
+	}
+	host, _, err := net.SplitHostPort(cfg.Server.Addr)
+	if err != nil {
+		host = ""
+	}
+	cfg.Server.Addr = net.JoinHostPort(host, strconv.Itoa(f.port))
+}
+
+// loadConfig carrega a configuração com a precedência das flags sobre o
+// ambiente (env) e do ambiente sobre o arquivo
+func loadConfig(f *cliFlags, env func(string) string) config.Config {
+	cfg := config.LoadFrom(f.configFile, env, f.overrides())
+	f.applyPort(&cfg)
+	return cfg
+}
+
+// usage imprime as flags e, a partir do pacote config, as variáveis de
+// ambiente com seus padrões
+func usage(fs *flag.FlagSet) {
+	out := fs.Output()
+	fmt.Fprintf(out, "Usage: %s [flags]\n\n", programName)
+	fmt.Fprintf(out, "Flags take precedence over environment variables, which take precedence over the -config file.\n\n")
+	fs.PrintDefaults()
+
+	fmt.Fprintf(out, "\nEnvironment variables (lowercase as -config file keys) and defaults:\n")
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, v := range config.Variables() {
+		if v.Default == "" {
+			v.Default = `""`
+		}
+		fmt.Fprintf(tw, "  %s\t%s\n", v.Key, v.Default)
+	}
+	tw.Flush()
+}
+
+// versionString descreve o build a partir das informações que o Go grava
+// no binário: versão do módulo, commit e versão do Go
+func versionString() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return programName + " (no build information)"
+	}
+
+	version := info.Main.Version
+	var revision, built string
+	modified := false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value[:min(len(setting.Value), 12)]
+		case "vcs.time":
+			built = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if revision != "" {
+		version += " " + revision
+		if modified {
+			version += "-dirty"
+		}
+	}
+	if built != "" {
+		version += " " + built
+	}
+	return fmt.Sprintf("%s %s %s %s/%s", programName, version, info.GoVersion, runtime.GOOS, runtime.GOARCH)
+}
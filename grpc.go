@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+
+	"google.golang.org/grpc"
+
+	"github.com/yurimachados/rinha-backend-go/config"
+	"github.com/yurimachados/rinha-backend-go/handlers"
+)
+
+// startGRPC serve o serviço Payments do gRPC em GRPC_ADDR, um listener
+// próprio ao lado do HTTP. Como no pprof, um endereço que cairia na mesma
+// porta TCP do servidor público já foi recusado pelo config.Validate.
+func startGRPC(public config.Server, handler *handlers.PaymentHandler) (*grpc.Server, error) {
+	listener, err := net.Listen("tcp", public.GRPCAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	server := handler.NewGRPCServer()
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			slog.Error("grpc server failed", "error", err)
+		}
+	}()
+
+	slog.Info("grpc server listening", "addr", listener.Addr().String())
+	return server, nil
+}
+
+// stopGRPC para o servidor gRPC com a mesma semântica do Shutdown do HTTP:
+// o listener fecha na hora, as chamadas em andamento (streams inclusive)
+// têm até o fim de ctx para terminar e as que restarem são encerradas
+func stopGRPC(ctx context.Context, server *grpc.Server) error {
+	done := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		server.Stop()
+		<-done
+		return ctx.Err()
+	}
+}
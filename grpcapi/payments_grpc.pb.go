@@ -0,0 +1,176 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: grpcapi/payments.proto
+
+// Ingestão de payments por gRPC, ao lado do POST /payments. Os payments
+// passam pela mesma validação e pela mesma fila do HTTP.
+//
+// Para regenerar o código Go (protoc-gen-go e protoc-gen-go-grpc):
+//
+//	protoc --go_out=. --go_opt=paths=source_relative \
+//	  --go-grpc_out=. --go-grpc_opt=paths=source_relative \
+//	  grpcapi/payments.proto
+
+package grpcapi
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Payments_SubmitPayment_FullMethodName  = "/rinha.payments.v1.Payments/SubmitPayment"
+	Payments_SubmitPayments_FullMethodName = "/rinha.payments.v1.Payments/SubmitPayments"
+)
+
+// PaymentsClient is the client API for Payments service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type PaymentsClient interface {
+	// SubmitPayment enfileira um payment, como o POST /payments. Recusas por
+	// validação voltam como INVALID_ARGUMENT e por fila cheia ou
+	// backpressure como RESOURCE_EXHAUSTED, com RetryInfo nos detalhes.
+	SubmitPayment(ctx context.Context, in *PaymentRequest, opts ...grpc.CallOption) (*SubmitPaymentResponse, error)
+	// SubmitPayments enfileira os payments do stream um a um. Recusas por
+	// validação não interrompem o stream; a primeira por fila cheia ou
+	// backpressure encerra o RPC com RESOURCE_EXHAUSTED, e o
+	// SubmitPaymentsResponse até ali vai nos detalhes do status.
+	SubmitPayments(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[PaymentRequest, SubmitPaymentsResponse], error)
+}
+
+type paymentsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPaymentsClient(cc grpc.ClientConnInterface) PaymentsClient {
+	return &paymentsClient{cc}
+}
+
+func (c *paymentsClient) SubmitPayment(ctx context.Context, in *PaymentRequest, opts ...grpc.CallOption) (*SubmitPaymentResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SubmitPaymentResponse)
+	err := c.cc.Invoke(ctx, Payments_SubmitPayment_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *paymentsClient) SubmitPayments(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[PaymentRequest, SubmitPaymentsResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Payments_ServiceDesc.Streams[0], Payments_SubmitPayments_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[PaymentRequest, SubmitPaymentsResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Payments_SubmitPaymentsClient = grpc.ClientStreamingClient[PaymentRequest, SubmitPaymentsResponse]
+
+// PaymentsServer is the server API for Payments service.
+// All implementations must embed UnimplementedPaymentsServer
+// for forward compatibility.
+type PaymentsServer interface {
+	// SubmitPayment enfileira um payment, como o POST /payments. Recusas por
+	// validação voltam como INVALID_ARGUMENT e por fila cheia ou
+	// backpressure como RESOURCE_EXHAUSTED, com RetryInfo nos detalhes.
+	SubmitPayment(context.Context, *PaymentRequest) (*SubmitPaymentResponse, error)
+	// SubmitPayments enfileira os payments do stream um a um. Recusas por
+	// validação não interrompem o stream; a primeira por fila cheia ou
+	// backpressure encerra o RPC com RESOURCE_EXHAUSTED, e o
+	// SubmitPaymentsResponse até ali vai nos detalhes do status.
+	SubmitPayments(grpc.ClientStreamingServer[PaymentRequest, SubmitPaymentsResponse]) error
+	mustEmbedUnimplementedPaymentsServer()
+}
+
+// UnimplementedPaymentsServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedPaymentsServer struct{}
+
+func (UnimplementedPaymentsServer) SubmitPayment(context.Context, *PaymentRequest) (*SubmitPaymentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubmitPayment not implemented")
+}
+func (UnimplementedPaymentsServer) SubmitPayments(grpc.ClientStreamingServer[PaymentRequest, SubmitPaymentsResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method SubmitPayments not implemented")
+}
+func (UnimplementedPaymentsServer) mustEmbedUnimplementedPaymentsServer() {}
+func (UnimplementedPaymentsServer) testEmbeddedByValue()                  {}
+
+// UnsafePaymentsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PaymentsServer will
+// result in compilation errors.
+type UnsafePaymentsServer interface {
+	mustEmbedUnimplementedPaymentsServer()
+}
+
+func RegisterPaymentsServer(s grpc.ServiceRegistrar, srv PaymentsServer) {
+	// If the following call pancis, it indicates UnimplementedPaymentsServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Payments_ServiceDesc, srv)
+}
+
+func _Payments_SubmitPayment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PaymentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentsServer).SubmitPayment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Payments_SubmitPayment_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentsServer).SubmitPayment(ctx, req.(*PaymentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Payments_SubmitPayments_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(PaymentsServer).SubmitPayments(&grpc.GenericServerStream[PaymentRequest, SubmitPaymentsResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Payments_SubmitPaymentsServer = grpc.ClientStreamingServer[PaymentRequest, SubmitPaymentsResponse]
+
+// Payments_ServiceDesc is the grpc.ServiceDesc for Payments service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Payments_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "rinha.payments.v1.Payments",
+	HandlerType: (*PaymentsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SubmitPayment",
+			Handler:    _Payments_SubmitPayment_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SubmitPayments",
+			Handler:       _Payments_SubmitPayments_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "grpcapi/payments.proto",
+}
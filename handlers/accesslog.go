@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+)
+
+// AccessLog emite uma linha estruturada por requisição com método, caminho,
+// status, duração, tamanhos e o id da requisição (o da resposta, que inclui
+// os gerados pelo RequestID). Respostas de sucesso são amostradas (1 a cada
+// sampleEvery) e erros (4xx e 5xx) são sempre logados, já que logar tudo
+// sob a carga da Rinha seria um gargalo por si só.
+type AccessLog struct {
+	logger      *slog.Logger
+	sampleEvery int64
+	successes   atomic.Int64
+}
+
+// NewAccessLog cria o log de acesso; sampleEvery 1 loga todas as
+// requisições. O logger é injetável para testes; nil usa o slog.Default.
+func NewAccessLog(logger *slog.Logger, sampleEvery int64) *AccessLog {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if sampleEvery <= 0 {
+		sampleEvery = 1
+	}
+	return &AccessLog{logger: logger, sampleEvery: sampleEvery}
+}
+
+// Wrap envolve um handler net/http; com o AccessLog nil retorna o próprio
+// handler
+func (a *AccessLog) Wrap(next http.Handler) http.Handler {
+	if a == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK // handler que não escreveu nada
+		}
+		a.log(r.Method, r.URL.Path, status, time.Since(start),
+			max(r.ContentLength, 0), sw.bytes, w.Header().Get(logging.RequestIDHeader))
+	})
+}
+
+// WrapFastHTTP envolve o handler do fasthttp; com o AccessLog nil retorna o
+// próprio handler
+func (a *AccessLog) WrapFastHTTP(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	if a == nil {
+		return next
+	}
+
+	return func(ctx *fasthttp.RequestCtx) {
+		start := time.Now()
+		next(ctx)
+
+		// Body() leria o stream inteiro; o tamanho de um stream não é conhecido
+		var respBytes int64
+		if !ctx.Response.IsBodyStream() {
+			respBytes = int64(len(ctx.Response.Body()))
+		}
+		a.log(string(ctx.Method()), string(ctx.Path()), ctx.Response.StatusCode(), time.Since(start),
+			int64(len(ctx.Request.Body())), respBytes, string(ctx.Response.Header.Peek(logging.RequestIDHeader)))
+	}
+}
+
+// log aplica a amostragem e emite a linha; erros de servidor saem em warn
+func (a *AccessLog) log(method, path string, status int, elapsed time.Duration, reqBytes, respBytes int64, requestID string) {
+	if status < http.StatusBadRequest && (a.successes.Add(1)-1)%a.sampleEvery != 0 {
+		return
+	}
+
+	level := slog.LevelInfo
+	if status >= http.StatusInternalServerError {
+		level = slog.LevelWarn
+	}
+	a.logger.LogAttrs(context.Background(), level, "http request",
+		slog.String("method", method),
+		slog.String("path", path),
+		slog.Int(logging.KeyStatus, status),
+		slog.Float64(logging.KeyLatencyMs, float64(elapsed.Microseconds())/1000),
+		slog.Int64("request_bytes", reqBytes),
+		slog.Int64("response_bytes", respBytes),
+		slog.String("request_id", requestID))
+}
+
+// statusWriter registra o status e os bytes escritos para o log de acesso
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush mantém o streaming do /payments/events
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+// Unwrap expõe o ResponseWriter original ao http.ResponseController
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/queue"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// maxAdminBodyBytes limita o corpo dos endpoints de admin
+const maxAdminBodyBytes = 1 << 10
+
+// GetAdminWorkers endpoint com os contadores de cada worker do pool
+func (h *PaymentHandler) GetAdminWorkers(w http.ResponseWriter, r *http.Request) {
+	res := h.compressible(httpResponder{w}, r.Header.Get("Accept-Encoding"))
+	writeJSON(res, http.StatusOK, h.workerPool.WorkerStats())
+}
+
+// GetAdminProcessors endpoint com o estado efetivo de cada processador e se
+// ele foi fixado manualmente
+func (h *PaymentHandler) GetAdminProcessors(w http.ResponseWriter, r *http.Request) {
+	res := h.compressible(httpResponder{w}, r.Header.Get("Accept-Encoding"))
+	writeJSON(res, http.StatusOK, h.processor.ProcessorStates())
+}
+
+// PostAdminPause pausa o processamento: os payments continuam sendo aceitos
+// e ficam na fila até o POST /admin/resume
+func (h *PaymentHandler) PostAdminPause(w http.ResponseWriter, r *http.Request) {
+	h.setPaused(w, r, true)
+}
+
+// PostAdminResume retoma o processamento, liberando os workers aos poucos
+func (h *PaymentHandler) PostAdminResume(w http.ResponseWriter, r *http.Request) {
+	h.setPaused(w, r, false)
+}
+
+// setPaused aplica a pausa ou a retomada e responde com o estado atual;
+// repetir o pedido não muda nada
+func (h *PaymentHandler) setPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	if paused {
+		h.workerPool.Pause()
+	} else {
+		h.workerPool.Resume()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.workerPool.PauseStats())
+}
+
+// PostAdminProcessorState atende POST /admin/processors/{name}/state com
+// {"state": "healthy" | "unhealthy" | "auto"}, fixando o processador dentro
+// ou fora do roteamento até nova mudança ou restart
+func (h *PaymentHandler) PostAdminProcessorState(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	var body struct {
+		State string `json:"state"`
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxAdminBodyBytes)
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, metrics.ReasonInvalidJSON, "Invalid JSON")
+		return
+	}
+
+	state, err := h.processor.SetOverride(name, body.State)
+	switch {
+	case errors.Is(err, queue.ErrUnknownProcessor):
+		writeError(w, http.StatusNotFound, codeUnknownProcessor, err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusBadRequest, codeInvalidState, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(state)
+}
+
+// PostAdminQueueCapacity atende POST /admin/queue/capacity com
+// {"capacity": N}. Reduzida abaixo da profundidade atual, a fila só recusa
+// payments novos até drenar; a fila com prioridade tem capacidade fixa.
+func (h *PaymentHandler) PostAdminQueueCapacity(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Capacity int `json:"capacity"`
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxAdminBodyBytes)
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, metrics.ReasonInvalidJSON, "Invalid JSON")
+		return
+	}
+
+	capacity, err := h.workerPool.SetQueueCapacity(body.Capacity)
+	switch {
+	case errors.Is(err, queue.ErrQueueNotResizable):
+		writeError(w, http.StatusConflict, codeQueueNotResizable, err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusBadRequest, codeInvalidCapacity, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(capacity)
+}
+
+// GetAdminChaos endpoint com as regras de injeção de falhas de cada
+// processador e as falhas já injetadas
+func (h *PaymentHandler) GetAdminChaos(w http.ResponseWriter, r *http.Request) {
+	writeJSON(httpResponder{w}, http.StatusOK, h.processor.ChaosStats())
+}
+
+// PostAdminChaos atende POST /admin/chaos com as regras por processador,
+// ex: {"default": {"error_percent": 20, "error_status": 503}}. Os
+// processadores ausentes mantêm a regra e {} para a injeção em um deles.
+func (h *PaymentHandler) PostAdminChaos(w http.ResponseWriter, r *http.Request) {
+	var rules map[string]types.ChaosRule
+	r.Body = http.MaxBytesReader(w, r.Body, maxAdminBodyBytes)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rules); err != nil {
+		writeError(w, http.StatusBadRequest, metrics.ReasonInvalidJSON, "Invalid JSON")
+		return
+	}
+
+	stats, err := h.processor.SetChaos(rules)
+	switch {
+	case errors.Is(err, queue.ErrChaosDisabled):
+		writeError(w, http.StatusConflict, codeChaosDisabled, err.Error())
+		return
+	case errors.Is(err, queue.ErrUnknownProcessor):
+		writeError(w, http.StatusNotFound, codeUnknownProcessor, err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusBadRequest, codeInvalidChaosRule, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(stats)
+}
+
+// GetAdminExchangeLog atende GET /admin/exchange-log com a amostragem atual
+// do log das chamadas aos processadores
+func (h *PaymentHandler) GetAdminExchangeLog(w http.ResponseWriter, r *http.Request) {
+	writeJSON(httpResponder{w}, http.StatusOK, h.processor.ExchangeLogStats())
+}
+
+// PostAdminExchangeLog atende POST /admin/exchange-log, ex:
+// {"every": 1, "duration_ms": 60000}, que loga todas as chamadas por um
+// minuto e depois volta à amostragem do boot
+func (h *PaymentHandler) PostAdminExchangeLog(w http.ResponseWriter, r *http.Request) {
+	var req types.ExchangeLogRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxAdminBodyBytes)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, metrics.ReasonInvalidJSON, "Invalid JSON")
+		return
+	}
+
+	stats, err := h.processor.SetExchangeLog(req.Every, time.Duration(req.DurationMs)*time.Millisecond)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidExchangeLog, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(stats)
+}
+
+// GetAdminShadow atende GET /admin/shadow com o estado do modo shadow e os
+// desfechos das cópias ao fallback
+func (h *PaymentHandler) GetAdminShadow(w http.ResponseWriter, r *http.Request) {
+	writeJSON(httpResponder{w}, http.StatusOK, h.processor.ShadowStats())
+}
+
+// PostAdminShadow atende POST /admin/shadow, ex: {"enabled": true,
+// "percent": 5}, que copia 5% dos payments aceitos pelo default ao
+// fallback; campos ausentes mantêm o valor atual
+func (h *PaymentHandler) PostAdminShadow(w http.ResponseWriter, r *http.Request) {
+	var req types.ShadowRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxAdminBodyBytes)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, metrics.ReasonInvalidJSON, "Invalid JSON")
+		return
+	}
+
+	stats, err := h.processor.SetShadow(req.Enabled, req.Percent)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidShadow, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(stats)
+}
+
+// GetAdminWeights atende GET /admin/weights com os pesos de cada
+// processador e as picks desde a última mudança
+func (h *PaymentHandler) GetAdminWeights(w http.ResponseWriter, r *http.Request) {
+	writeJSON(httpResponder{w}, http.StatusOK, h.processor.WeightStats())
+}
+
+// PostAdminWeights atende POST /admin/weights com o peso de cada
+// processador a mudar, ex: {"default": 90, "fallback": 10}. Os ausentes
+// mantêm o seu e todos em zero voltam ao default primeiro.
+func (h *PaymentHandler) PostAdminWeights(w http.ResponseWriter, r *http.Request) {
+	var weights map[string]int64
+	r.Body = http.MaxBytesReader(w, r.Body, maxAdminBodyBytes)
+	if err := json.NewDecoder(r.Body).Decode(&weights); err != nil {
+		writeError(w, http.StatusBadRequest, metrics.ReasonInvalidJSON, "Invalid JSON")
+		return
+	}
+
+	stats, err := h.processor.SetWeights(weights)
+	switch {
+	case errors.Is(err, queue.ErrWeightsDisabled):
+		writeError(w, http.StatusConflict, codeWeightsDisabled, err.Error())
+		return
+	case errors.Is(err, queue.ErrUnknownProcessor):
+		writeError(w, http.StatusNotFound, codeUnknownProcessor, err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusBadRequest, codeInvalidWeight, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(stats)
+}
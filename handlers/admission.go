@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+)
+
+// Limites do Retry-After das recusas por backpressure, em segundos
+const (
+	minRetryAfter = 1
+	maxRetryAfter = 10
+)
+
+// drainSampleInterval é a janela da amostra da taxa de drenagem da fila;
+// janelas em curso mais curtas que minDrainWindow são ruidosas demais
+const (
+	drainSampleInterval = time.Second
+	minDrainWindow      = 100 * time.Millisecond
+)
+
+// admission recusa parte dos payments antes de a fila encher. Acima do high
+// watermark passa a recusar rejectPercent% dos payments novos e só volta a
+// aceitar tudo abaixo do low watermark (histerese, para não oscilar).
+type admission struct {
+	highPercent   int // percentuais da capacidade atual da fila
+	lowPercent    int
+	rejectPercent uint64
+
+	shedding atomic.Bool
+	arrivals atomic.Uint64 // distribui as recusas de forma uniforme
+
+	// Taxa de drenagem (payments/s) amostrada a cada drainSampleInterval
+	sampleMu        sync.Mutex
+	sampledAt       atomic.Int64 // unix nanos da última amostra
+	sampledDequeued atomic.Int64
+	drainRate       atomic.Int64
+}
+
+// EnableAdmissionControl liga o controle de admissão. Os watermarks são
+// percentuais da capacidade da fila e rejectPercent é a fração dos payments
+// novos recusada com 429 enquanto a fila está acima do high watermark. Os
+// watermarks acompanham a capacidade mudada pelo POST /admin/queue/capacity.
+func (h *PaymentHandler) EnableAdmissionControl(highPercent, lowPercent, rejectPercent int) {
+	if lowPercent <= 0 || highPercent <= lowPercent || highPercent > 100 || rejectPercent <= 0 || rejectPercent > 100 {
+		slog.Warn("invalid admission control settings, admission control disabled",
+			"high_percent", highPercent,
+			"low_percent", lowPercent,
+			"reject_percent", rejectPercent)
+		return
+	}
+
+	a := &admission{
+		highPercent:   highPercent,
+		lowPercent:    lowPercent,
+		rejectPercent: uint64(rejectPercent),
+	}
+	a.sampledAt.Store(time.Now().UnixNano())
+	a.sampledDequeued.Store(metrics.PaymentsDequeued.Value())
+	h.admission = a
+
+	metrics.RegisterGauge("rinha_admission_shedding", "1 se o controle de admissão está recusando payments.", "", func() float64 {
+		if a.shedding.Load() {
+			return 1
+		}
+		return 0
+	})
+}
+
+// admit decide se o payment entra, dadas a profundidade e a capacidade
+// atuais da fila. Na recusa retorna o Retry-After em segundos.
+func (a *admission) admit(depth, capacity int) (retryAfter int, ok bool) {
+	a.sampleDrainRate()
+
+	low := capacity * a.lowPercent / 100
+	switch {
+	case depth >= capacity*a.highPercent/100:
+		a.shedding.Store(true)
+	case depth <= low:
+		a.shedding.Store(false)
+	}
+	if !a.shedding.Load() {
+		return 0, true
+	}
+
+	// Recusa quando n*p/100 muda de valor: exatamente p a cada 100 chegadas,
+	// intercaladas em vez de em rajadas
+	n := a.arrivals.Add(1)
+	if n*a.rejectPercent/100 == (n-1)*a.rejectPercent/100 {
+		return 0, true
+	}
+	return a.retryAfter(depth, low), false
+}
+
+// retryAfter estima em quantos segundos a fila volta ao low watermark na
+// taxa de drenagem atual
+func (a *admission) retryAfter(depth, low int) int {
+	// A última janela pode ter pegado a fila ociosa (ex.: logo após o boot),
+	// então vale a maior taxa entre ela e a janela em curso
+	rate := a.drainRate.Load()
+	if elapsed := time.Duration(time.Now().UnixNano() - a.sampledAt.Load()); elapsed >= minDrainWindow {
+		current := int64(float64(metrics.PaymentsDequeued.Value()-a.sampledDequeued.Load()) / elapsed.Seconds())
+		rate = max(rate, current)
+	}
+	if rate <= 0 {
+		return maxRetryAfter
+	}
+
+	seconds := (int64(depth-low) + rate - 1) / rate
+	return int(min(max(seconds, minRetryAfter), maxRetryAfter))
+}
+
+// sampleDrainRate atualiza a taxa de drenagem quando a janela venceu. Só uma
+// requisição faz a amostra; as demais seguem sem esperar o lock.
+func (a *admission) sampleDrainRate() {
+	now := time.Now().UnixNano()
+	last := a.sampledAt.Load()
+	if now-last < int64(drainSampleInterval) || !a.sampleMu.TryLock() {
+		return
+	}
+	defer a.sampleMu.Unlock()
+
+	if last != a.sampledAt.Load() {
+		return // outra requisição já amostrou
+	}
+
+	dequeued := metrics.PaymentsDequeued.Value()
+	elapsed := time.Duration(now - last)
+	a.drainRate.Store(int64(float64(dequeued-a.sampledDequeued.Load()) / elapsed.Seconds()))
+	a.sampledDequeued.Store(dequeued)
+	a.sampledAt.Store(now)
+}
+
+// rejectBackpressure recusa o payment com 429 e Retry-After
+func (h *PaymentHandler) rejectBackpressure(res responder, retryAfter int) {
+	metrics.PaymentsRejected.Inc(metrics.ReasonBackpressure)
+	res.SetHeader("Retry-After", strconv.Itoa(retryAfter))
+	res.Error(http.StatusTooManyRequests, metrics.ReasonBackpressure, "Queue under pressure, retry later")
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/tracing"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// Erros da leitura do lote
+var (
+	errBatchNotArray = errors.New("batch must be a JSON array")
+	errBatchTooLarge = errors.New("batch has too many items")
+)
+
+// PostPaymentsBatch recebe um array de payments (adaptador net/http)
+func (h *PaymentHandler) PostPaymentsBatch(w http.ResponseWriter, r *http.Request) {
+	res := httpResponder{w}
+	ctx := r.Context()
+	if tracing.Enabled() {
+		var span trace.Span
+		ctx, span = startAcceptSpan(ctx, "POST /payments/batch", r.Header)
+		defer span.End()
+	}
+
+	if !h.acceptsContentType(r.Header.Get("Content-Type")) {
+		h.rejectUnsupportedMediaType(res, "application/json")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBatchBytes)
+
+	body := bodyPool.Get().(*bytes.Buffer)
+	body.Reset()
+	defer bodyPool.Put(body)
+
+	if _, err := body.ReadFrom(r.Body); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			h.rejectTooLarge(res, tooLarge.Limit)
+			return
+		}
+		h.rejectInvalidJSON(res)
+		return
+	}
+
+	client := h.rateLimitClient(r.RemoteAddr, r.Header.Get("X-Real-IP"), r.Header.Get("X-Forwarded-For"))
+	h.ingestBatch(ctx, body.Bytes(), res, client)
+}
+
+// ingestBatch é o núcleo do POST /payments/batch. O lote inteiro é
+// recusado se não for um array JSON válido ou passar do máximo de itens;
+// fora isso cada item é validado e enfileirado de forma independente, pelo
+// mesmo caminho do POST /payments, e a resposta é 207 com um resultado por
+// item. Itens recusados por fila cheia não usam o processamento inline.
+//
+// Com o rate limit ligado (client é o IP cobrado), cada item consome um
+// token: sem nenhum o lote inteiro recebe 429, como o POST /payments, e
+// com parte deles os itens que sobram são recusados com rate_limited.
+func (h *PaymentHandler) ingestBatch(ctx context.Context, body []byte, res responder, client string) {
+	items, err := splitBatch(body, h.maxBatchItems)
+	switch {
+	case errors.Is(err, errBatchTooLarge):
+		metrics.PaymentsRejected.Inc(metrics.ReasonBodyTooLarge)
+		res.Error(http.StatusRequestEntityTooLarge, codeBatchTooLarge,
+			"batch exceeds "+strconv.Itoa(h.maxBatchItems)+" payments")
+		return
+	case err != nil:
+		h.rejectInvalidJSON(res)
+		return
+	case len(items) == 0:
+		metrics.PaymentsRejected.Inc(metrics.ReasonValidation)
+		res.Error(http.StatusBadRequest, codeEmptyBatch, "Empty batch")
+		return
+	}
+
+	granted, retryAfter := len(items), 0
+	if client != "" {
+		var wait time.Duration
+		granted, wait = h.rateLimit.take(client, len(items), time.Now())
+		if granted == 0 {
+			rejectRateLimited(res, wait)
+			return
+		}
+		if granted < len(items) {
+			retryAfter = retryAfterSeconds(wait)
+		}
+	}
+
+	response := types.BatchResponse{Results: make([]types.BatchItemResult, len(items))}
+	for i, raw := range items {
+		var item types.BatchItemResult
+		itemRetryAfter := 0
+		if i < granted {
+			item, itemRetryAfter = h.ingestBatchItem(ctx, raw)
+		} else {
+			metrics.PaymentsRejected.Inc(metrics.ReasonRateLimited)
+			item = rejectedItem(metrics.ReasonRateLimited, rateLimitedMessage)
+		}
+		item.Index = i
+		response.Results[i] = item
+
+		if item.Status == "accepted" {
+			response.Accepted++
+		} else {
+			response.Rejected++
+		}
+		retryAfter = max(retryAfter, itemRetryAfter)
+	}
+
+	// Algum item recusado por rate limit, backpressure ou fila cheia: o
+	// cliente pode reenviar depois
+	if retryAfter > 0 {
+		res.SetHeader("Retry-After", strconv.Itoa(retryAfter))
+	}
+	writeJSON(res, http.StatusMultiStatus, response)
+}
+
+// ingestBatchItem decodifica e enfileira um item do lote, contabilizando a
+// recusa como no POST /payments
+func (h *PaymentHandler) ingestBatchItem(ctx context.Context, raw []byte) (types.BatchItemResult, int) {
+	payment := types.AcquirePayment()
+
+	if err := types.DecodePayment(raw, payment); err != nil {
+		types.ReleasePayment(payment)
+		metrics.PaymentsRejected.Inc(metrics.ReasonInvalidJSON)
+		return rejectedItem(metrics.ReasonInvalidJSON, invalidJSONMessage(err)), 0
+	}
+
+	result := h.enqueue(ctx, payment)
+	if result.queued {
+		return types.BatchItemResult{ID: result.correlationID, Status: "accepted"}, 0
+	}
+	types.ReleasePayment(payment)
+
+	var item types.BatchItemResult
+	switch result.reason {
+	case metrics.ReasonValidation:
+		metrics.PaymentsRejected.Inc(metrics.ReasonValidation)
+		item = rejectedItem(metrics.ReasonValidation, result.err.Error())
+	case metrics.ReasonBackpressure:
+		metrics.PaymentsRejected.Inc(metrics.ReasonBackpressure)
+		item = rejectedItem(metrics.ReasonBackpressure, "Queue under pressure, retry later")
+	case metrics.ReasonDuplicate:
+		metrics.PaymentsRejected.Inc(metrics.ReasonDuplicate)
+		item = rejectedItem(metrics.ReasonDuplicate, duplicateMessage)
+	default:
+		h.countQueueFull(ctx, result.correlationID)
+		item = rejectedItem(metrics.ReasonQueueFull, "Service temporarily unavailable")
+		result.retryAfter = retryAfterSeconds(h.queueFullRetryAfter())
+	}
+	item.ID = result.correlationID
+	return item, result.retryAfter
+}
+
+func rejectedItem(reason, message string) types.BatchItemResult {
+	return types.BatchItemResult{Status: "rejected", Reason: reason, Error: message}
+}
+
+// splitBatch separa os itens do array sem decodificá-los. O máximo de
+// itens é conferido durante a leitura, então um lote grande demais é
+// recusado sem percorrer o resto do corpo.
+func splitBatch(body []byte, maxItems int) ([]json.RawMessage, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, errBatchNotArray
+	}
+
+	var items []json.RawMessage
+	for decoder.More() {
+		if len(items) == maxItems {
+			return nil, errBatchTooLarge
+		}
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, err
+		}
+		items = append(items, raw)
+	}
+
+	// Fechamento do array e nada depois dele
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errBatchNotArray
+	}
+	return items, nil
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/store"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// maxSummaryBuckets é o máximo de intervalos do summary com groupBy: um dia
+// por minuto
+const maxSummaryBuckets = 1440
+
+// summaryGranularities são os valores aceitos no groupBy
+var summaryGranularities = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+}
+
+// getBucketSummary agrega os payments de [from, to] em intervalos de
+// groupBy. Os intervalos são inteiros e alinhados à granularidade em UTC:
+// from recua ao início do seu e to avança ao fim do seu. Intervalos sem
+// payments vêm zerados, para o gráfico não ter buracos.
+func (h *PaymentHandler) getBucketSummary(ctx context.Context, res responder, out codec, query url.Values) {
+	groupBy := query.Get("groupBy")
+	step, ok := summaryGranularities[groupBy]
+	if !ok {
+		res.Error(http.StatusBadRequest, codeInvalidParameter, "Invalid groupBy, must be second, minute or hour")
+		return
+	}
+	from, err := parseTimeParam(query.Get("from"))
+	if err != nil {
+		res.Error(http.StatusBadRequest, codeInvalidParameter, "Invalid from")
+		return
+	}
+	to, err := parseTimeParam(query.Get("to"))
+	if err != nil {
+		res.Error(http.StatusBadRequest, codeInvalidParameter, "Invalid to")
+		return
+	}
+	if from.IsZero() || to.IsZero() {
+		res.Error(http.StatusBadRequest, codeInvalidParameter, "groupBy requires from and to")
+		return
+	}
+	if to.Before(from) {
+		res.Error(http.StatusBadRequest, codeInvalidParameter, "to is before from")
+		return
+	}
+
+	start := from.UTC().Truncate(step)
+	end := to.UTC().Truncate(step).Add(step)
+	n := int64(end.Sub(start) / step)
+	if n > maxSummaryBuckets {
+		res.Error(http.StatusBadRequest, codeInvalidParameter,
+			fmt.Sprintf("Range spans %d %s buckets, at most %d allowed", n, groupBy, maxSummaryBuckets))
+		return
+	}
+
+	buckets, err := h.store.AggregateBuckets(ctx, start, end, step)
+	if err != nil {
+		h.logger.Error("failed to aggregate payment buckets", "error", err, "group_by", groupBy)
+		res.Error(http.StatusServiceUnavailable, codeSummaryUnavailable, "Summary unavailable")
+		return
+	}
+
+	summary := &types.SummaryBuckets{
+		GroupBy: groupBy,
+		From:    start,
+		To:      end,
+		Buckets: make([]types.SummaryBucket, n),
+	}
+	for i := range summary.Buckets {
+		summary.Buckets[i].Start = start.Add(time.Duration(i) * step)
+	}
+	for _, b := range buckets {
+		if i := int64(b.Start.Sub(start) / step); i >= 0 && i < n {
+			fillBucket(&summary.Buckets[i], b.Totals)
+		}
+	}
+
+	writeEncoded(res, out, http.StatusOK, summary)
+}
+
+// fillBucket passa os totais por processador do store para o intervalo
+func fillBucket(bucket *types.SummaryBucket, totals map[string]store.ProcessorTotals) {
+	bucket.DefaultSuccess = totals["default"].TotalRequests
+	bucket.FallbackSuccess = totals["fallback"].TotalRequests
+	bucket.DefaultAmount = totals["default"].TotalAmount
+	bucket.FallbackAmount = totals["fallback"].TotalAmount
+	bucket.TotalPayments = bucket.DefaultSuccess + bucket.FallbackSuccess
+
+	for code, amount := range totals["default"].Currencies {
+		addBucketCurrency(bucket, code, types.CurrencyAmounts{DefaultAmount: amount})
+	}
+	for code, amount := range totals["fallback"].Currencies {
+		addBucketCurrency(bucket, code, types.CurrencyAmounts{FallbackAmount: amount})
+	}
+}
+
+func addBucketCurrency(bucket *types.SummaryBucket, code string, amounts types.CurrencyAmounts) {
+	if bucket.Currencies == nil {
+		bucket.Currencies = make(map[string]types.CurrencyAmounts, 1)
+	}
+	current := bucket.Currencies[code]
+	current.Add(amounts)
+	bucket.Currencies[code] = current
+}
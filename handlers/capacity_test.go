@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+func TestAdminQueueCapacity(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Pool.Workers, cfg.Pool.QueueSize = 1, 10
+	h, mux := newTestHandler(t, cfg, func(h *PaymentHandler) { h.workerPool.Pause() })
+	admin := http.NewServeMux()
+	h.RegisterAdminRoutes(admin)
+
+	// accepted conta os payments aceitos em n tentativas
+	accepted := func(n int) int {
+		count := 0
+		for range n {
+			if serve(mux, "POST", "/payments", validPayment).Code == http.StatusAccepted {
+				count++
+			}
+		}
+		return count
+	}
+	// setCapacity muda a capacidade pelo admin e retorna a resposta
+	setCapacity := func(capacity int) types.QueueCapacity {
+		t.Helper()
+		rec := serve(admin, "POST", "/admin/queue/capacity", `{"capacity":`+strconv.Itoa(capacity)+`}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("capacity %d: status %d (body %s)", capacity, rec.Code, rec.Body)
+		}
+		var got types.QueueCapacity
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	if got := accepted(11); got != 10 {
+		t.Fatalf("accepted %d payments with capacity 10", got)
+	}
+
+	// Aumentada sem reiniciar: os payments novos voltam a entrar
+	if got := setCapacity(20); got != (types.QueueCapacity{Capacity: 20, PreviousCapacity: 10, QueueDepth: 10}) {
+		t.Fatalf("raise to 20 = %+v", got)
+	}
+	if got := accepted(11); got != 10 || h.workerPool.GetQueueSize() != 20 {
+		t.Fatalf("accepted %d more with queue %d; want 10 and a full queue of 20", got, h.workerPool.GetQueueSize())
+	}
+
+	// Reduzida abaixo da profundidade: recusa sem descartar nenhum
+	if got := setCapacity(5); got != (types.QueueCapacity{Capacity: 5, PreviousCapacity: 20, QueueDepth: 20}) {
+		t.Fatalf("shrink to 5 = %+v", got)
+	}
+	if got := accepted(1); got != 0 || h.workerPool.GetQueueSize() != 20 {
+		t.Fatalf("accepted %d with 20 queued and capacity 5, queue %d", got, h.workerPool.GetQueueSize())
+	}
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// codec é um formato de corpo: o Content-Type escolhe o do POST /payments e
+// o Accept, o das respostas do summary e da busca por id. Um formato novo
+// só implementa a interface e entra em codecs.
+type codec interface {
+	// MediaType é o Content-Type das respostas no formato
+	MediaType() string
+	// Matches indica se o Content-Type recebido é deste formato
+	Matches(contentType string) bool
+	// DecodePayment decodifica o corpo do POST /payments no payment, com as
+	// mesmas regras do JSON: campos desconhecidos e amount fracionário são
+	// recusados
+	DecodePayment(data []byte, p *types.PaymentRequest) error
+	// InvalidMessage é a mensagem do 400 de um corpo que o DecodePayment
+	// recusou
+	InvalidMessage(err error) string
+	// Encode serializa v no buffer, com os mesmos nomes de campo do JSON
+	Encode(buf *bytes.Buffer, v any) error
+}
+
+// codecs são os formatos aceitos, em ordem de preferência: com Accept
+// ausente, */* ou empatado, vale o primeiro
+var codecs = []codec{jsonCodec{}, msgpackCodec{}}
+
+// codecMediaTypes lista os Content-Types aceitos, para a mensagem do 415
+var codecMediaTypes = func() string {
+	names := make([]string, len(codecs))
+	for i, c := range codecs {
+		names[i] = c.MediaType()
+	}
+	return strings.Join(names, " or ")
+}()
+
+// requestCodec escolhe o formato do corpo do POST /payments pelo
+// Content-Type; sem Content-Type o corpo é JSON, fora do modo estrito
+func (h *PaymentHandler) requestCodec(contentType string) (codec, bool) {
+	contentType = strings.TrimSpace(contentType)
+	if contentType == "" {
+		return codecs[0], !h.strictContentType
+	}
+	for _, c := range codecs {
+		if c.Matches(contentType) {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// responseCodec escolhe o formato da resposta pelo Accept: o formato
+// suportado com o maior q, ou JSON se nenhum for pedido. Um Accept só com
+// formatos não suportados também recebe JSON, em vez de 406.
+func responseCodec(accept string) codec {
+	best, bestQ := codecs[0], -1.0
+	for accept != "" {
+		var entry string
+		entry, accept, _ = strings.Cut(accept, ",")
+		mediaType, params, _ := strings.Cut(entry, ";")
+		mediaType = strings.TrimSpace(mediaType)
+
+		q := acceptQuality(params)
+		if q <= 0 || q <= bestQ {
+			continue
+		}
+		if mediaType == "*/*" || strings.EqualFold(mediaType, "application/*") {
+			best, bestQ = codecs[0], q
+			continue
+		}
+		for _, c := range codecs {
+			if strings.EqualFold(mediaType, c.MediaType()) {
+				best, bestQ = c, q
+				break
+			}
+		}
+	}
+	return best
+}
+
+// acceptQuality lê o q dos parâmetros de uma entrada do Accept; sem q vale
+// 1 e um q ilegível, 0
+func acceptQuality(params string) float64 {
+	for params != "" {
+		var param string
+		param, params, _ = strings.Cut(params, ";")
+		key, value, _ := strings.Cut(param, "=")
+		if strings.EqualFold(strings.TrimSpace(key), "q") {
+			q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				return 0
+			}
+			return q
+		}
+	}
+	return 1
+}
+
+// writeEncoded serializa v no formato negociado. Vary vai em toda resposta,
+// para caches não servirem um formato a quem pediu outro.
+func writeEncoded(res responder, c codec, status int, v any) {
+	res.AddHeader("Vary", "Accept")
+
+	buf := responsePool.Get().(*bytes.Buffer)
+	buf.Reset()
+
+	if err := c.Encode(buf, v); err != nil {
+		res.Error(http.StatusInternalServerError, codeInternal, "Internal server error")
+	} else {
+		res.Body(status, c.MediaType(), buf.Bytes())
+	}
+
+	responsePool.Put(buf)
+}
+
+// jsonCodec é o formato padrão, com o decoder escrito à mão do types
+type jsonCodec struct{}
+
+func (jsonCodec) MediaType() string { return "application/json" }
+
+func (jsonCodec) Matches(contentType string) bool { return isJSONContentType(contentType) }
+
+func (jsonCodec) DecodePayment(data []byte, p *types.PaymentRequest) error {
+	return types.DecodePayment(data, p)
+}
+
+func (jsonCodec) InvalidMessage(err error) string { return invalidJSONMessage(err) }
+
+// Encode gera o mesmo corpo do json.Encoder, com quebra de linha no fim
+func (jsonCodec) Encode(buf *bytes.Buffer, v any) error {
+	return json.NewEncoder(buf).Encode(v)
+}
+
+// msgpackCodec é o MessagePack, para produtores em que o custo do JSON pesa.
+// Os campos usam as tags json, então os nomes e os omitempty são os mesmos
+// do JSON; instantes vão na extensão de timestamp.
+type msgpackCodec struct{}
+
+var errTrailingMsgpack = errors.New("trailing data after the payment")
+
+func (msgpackCodec) MediaType() string { return "application/msgpack" }
+
+// Matches aceita application/msgpack e o antigo application/x-msgpack, sem
+// diferenciar maiúsculas e ignorando parâmetros
+func (msgpackCodec) Matches(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(mediaType)
+	return strings.EqualFold(mediaType, "application/msgpack") || strings.EqualFold(mediaType, "application/x-msgpack")
+}
+
+func (msgpackCodec) DecodePayment(data []byte, p *types.PaymentRequest) error {
+	r := bytes.NewReader(data)
+	dec := msgpack.GetDecoder()
+	defer msgpack.PutDecoder(dec)
+
+	// O Reset limpa as opções, que voltam a cada uso do decoder do pool
+	dec.Reset(r)
+	dec.SetCustomStructTag("json")
+	dec.DisallowUnknownFields(true)
+	if err := dec.Decode(p); err != nil {
+		return err
+	}
+	if r.Len() != 0 {
+		return errTrailingMsgpack
+	}
+	return nil
+}
+
+func (msgpackCodec) InvalidMessage(error) string { return "Invalid MessagePack" }
+
+// msgpackRoundTrip codifica v e decodifica o resultado em out, com as tags
+// json; serve para um EncodeMsgpack reaproveitar os campos de um tipo
+func msgpackRoundTrip(v, out any) error {
+	var buf bytes.Buffer
+	if err := (msgpackCodec{}).Encode(&buf, v); err != nil {
+		return err
+	}
+	dec := msgpack.GetDecoder()
+	defer msgpack.PutDecoder(dec)
+
+	dec.Reset(&buf)
+	dec.SetCustomStructTag("json")
+	return dec.Decode(out)
+}
+
+func (msgpackCodec) Encode(buf *bytes.Buffer, v any) error {
+	enc := msgpack.GetEncoder()
+	defer msgpack.PutEncoder(enc)
+
+	enc.Reset(buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	return enc.Encode(v)
+}
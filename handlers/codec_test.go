@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/yurimachados/rinha-backend-go/store"
+)
+
+// TestMsgpackMatchesJSON envia o mesmo payment em JSON e em MessagePack, cada
+// um a um serviço, e confere que os dois gravam o mesmo registro e chegam ao
+// mesmo summary
+func TestMsgpackMatchesJSON(t *testing.T) {
+	const id = "4a7901b8-7d26-4d9d-aa19-4dc1c7cf60b3"
+	jsonBody := `{"correlationId":"` + id + `","amount":1990,"type":"credit","description":"café com leite","metadata":{"order":"42"}}`
+	msgpackBody, err := msgpack.Marshal(map[string]any{
+		"correlationId": id,
+		"amount":        1990,
+		"type":          "credit",
+		"description":   "café com leite",
+		"metadata":      map[string]string{"order": "42"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// submit envia o corpo no formato e espera o payment processado
+	submit := func(body, contentType string) (store.Payment, map[string]any) {
+		t.Helper()
+		h, mux := newTestHandler(t, testConfig(t))
+		if rec := serve(mux, "POST", "/payments", body, "Content-Type", contentType); rec.Code != http.StatusAccepted {
+			t.Fatalf("%s: status %d, want 202 (body %s)", contentType, rec.Code, rec.Body)
+		}
+
+		var record store.Payment
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			payment, ok, err := h.store.Get(context.Background(), id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok {
+				record = payment
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: payment not stored", contentType)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		var summary map[string]any
+		rec := serve(mux, "GET", "/payments-summary", "")
+		if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+			t.Fatalf("%s: summary %s: %v", contentType, rec.Body, err)
+		}
+		delete(summary, "since") // início de cada serviço
+		return record, summary
+	}
+
+	fromJSON, jsonSummary := submit(jsonBody, "application/json")
+	fromMsgpack, msgpackSummary := submit(string(msgpackBody), "application/msgpack")
+
+	// Os instantes são do aceite e do processamento em cada serviço
+	for _, record := range []*store.Payment{&fromJSON, &fromMsgpack} {
+		if record.RequestedAt.IsZero() || record.ProcessedAt.IsZero() {
+			t.Errorf("record %+v without requestedAt or processedAt", *record)
+		}
+		record.RequestedAt, record.ProcessedAt = time.Time{}, time.Time{}
+	}
+	if !reflect.DeepEqual(fromJSON, fromMsgpack) {
+		t.Errorf("stored records differ:\n json    %+v\n msgpack %+v", fromJSON, fromMsgpack)
+	}
+	if fromJSON.Amount != 1990 || fromJSON.Type != "credit" || fromJSON.Metadata["order"] != "42" {
+		t.Errorf("stored record %+v does not match the payment sent", fromJSON)
+	}
+	if !reflect.DeepEqual(jsonSummary, msgpackSummary) {
+		t.Errorf("summaries differ:\n json    %v\n msgpack %v", jsonSummary, msgpackSummary)
+	}
+}
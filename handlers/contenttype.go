@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+)
+
+// acceptsContentType confere o Content-Type do lote, que só aceita JSON,
+// antes de o corpo ser lido
+func (h *PaymentHandler) acceptsContentType(contentType string) bool {
+	contentType = strings.TrimSpace(contentType)
+	if contentType == "" {
+		return !h.strictContentType
+	}
+	return isJSONContentType(contentType)
+}
+
+// isJSONContentType aceita application/json, sem diferenciar maiúsculas, com
+// no máximo o parâmetro charset=utf-8. Feito à mão porque o
+// mime.ParseMediaType aloca um map por requisição.
+func isJSONContentType(contentType string) bool {
+	mediaType, params, _ := strings.Cut(contentType, ";")
+	if !strings.EqualFold(strings.TrimSpace(mediaType), "application/json") {
+		return false
+	}
+
+	params = strings.TrimSpace(params)
+	if params == "" {
+		return true
+	}
+	key, value, ok := strings.Cut(params, "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(key), "charset") {
+		return false
+	}
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+	}
+	return strings.EqualFold(value, "utf-8")
+}
+
+// rejectUnsupportedMediaType recusa o corpo que não é declarado em um dos
+// formatos aceitos pela rota (mediaTypes, para a mensagem)
+func (h *PaymentHandler) rejectUnsupportedMediaType(res responder, mediaTypes string) {
+	metrics.PaymentsRejected.Inc(metrics.ReasonUnsupportedMediaType)
+	res.Error(http.StatusUnsupportedMediaType, metrics.ReasonUnsupportedMediaType, "Content-Type must be "+mediaTypes)
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+)
+
+func TestIsJSONContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{"application/json", true},
+		{"APPLICATION/JSON", true},
+		{"Application/Json", true},
+		{"application/json;charset=utf-8", true},
+		{"application/json; charset=UTF-8", true},
+		{`application/json; charset="utf-8"`, true},
+		{"  application/json  ;  charset = utf-8 ", true},
+		{"application/json; charset=iso-8859-1", false},
+		{"application/json; boundary=x", false},
+		{"application/json; charset=utf-8; q=1", false},
+		{"application/jsonp", false},
+		{"text/json", false},
+		{"text/plain", false},
+		{"application/x-www-form-urlencoded", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isJSONContentType(tt.contentType); got != tt.want {
+			t.Errorf("isJSONContentType(%q) = %t, want %t", tt.contentType, got, tt.want)
+		}
+	}
+}
+
+// unreadBody falha o teste se o corpo for lido: o Content-Type é recusado
+// antes da leitura
+type unreadBody struct {
+	t *testing.T
+	*strings.Reader
+}
+
+func (b unreadBody) Read(p []byte) (int, error) {
+	b.t.Error("body read before the Content-Type check")
+	return b.Reader.Read(p)
+}
+
+func TestPostPaymentsContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		strict      bool
+		contentType string // "-" não envia o header
+		status      int
+	}{
+		{"json", false, "application/json", http.StatusAccepted},
+		{"uppercase media type", false, "APPLICATION/JSON", http.StatusAccepted},
+		{"charset parameter", false, "application/json; charset=utf-8", http.StatusAccepted},
+		{"uppercase charset", false, "application/json;charset=UTF-8", http.StatusAccepted},
+		{"other charset", false, "application/json; charset=latin1", http.StatusUnsupportedMediaType},
+		{"form", false, "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"text", true, "text/plain", http.StatusUnsupportedMediaType},
+		{"missing, lenient", false, "-", http.StatusAccepted},
+		{"missing, strict", true, "-", http.StatusUnsupportedMediaType},
+		{"blank, strict", true, "  ", http.StatusUnsupportedMediaType},
+		{"json, strict", true, "application/json", http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			if tt.strict {
+				cfg.Ingest.ContentTypeMode = "strict"
+			}
+			_, mux := newTestHandler(t, cfg)
+
+			body := strings.NewReader(validPayment)
+			req := httptest.NewRequest("POST", "/payments", body)
+			if tt.status == http.StatusUnsupportedMediaType {
+				req = httptest.NewRequest("POST", "/payments", unreadBody{t, body})
+			}
+			if tt.contentType != "-" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			before := metrics.PaymentsRejected.Values()[metrics.ReasonUnsupportedMediaType]
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status != http.StatusUnsupportedMediaType {
+				return
+			}
+			if code := errorCode(t, rec.Body.Bytes()); code != metrics.ReasonUnsupportedMediaType {
+				t.Errorf("code = %q, want %q", code, metrics.ReasonUnsupportedMediaType)
+			}
+			if got := metrics.PaymentsRejected.Values()[metrics.ReasonUnsupportedMediaType] - before; got != 1 {
+				t.Errorf("unsupported_media_type rejections = %d, want 1", got)
+			}
+		})
+	}
+}
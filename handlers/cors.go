@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+
+	"github.com/yurimachados/rinha-backend-go/config"
+	"github.com/yurimachados/rinha-backend-go/logging"
+)
+
+// cors guarda a configuração já normalizada para as respostas
+type cors struct {
+	origins     map[string]struct{}
+	anyOrigin   bool
+	credentials bool
+	routes      map[string]bool // rota → já registrada
+	headers     string
+	maxAge      string
+}
+
+// EnableCORS liga o CORS nas rotas da configuração; deve ser chamado antes
+// do RegisterRoutes. Origens fora da lista não recebem headers CORS, e o
+// navegador bloqueia a resposta sem que o servidor devolva erro.
+func (h *PaymentHandler) EnableCORS(cfg config.CORS) {
+	c := &cors{
+		origins:     make(map[string]struct{}),
+		credentials: cfg.AllowCredentials,
+		routes:      make(map[string]bool),
+		maxAge:      strconv.Itoa(int(cfg.MaxAge.Seconds())),
+	}
+	for _, origin := range cfg.Origins {
+		switch origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin {
+		case "":
+		case "*":
+			c.anyOrigin = true
+		default:
+			c.origins[origin] = struct{}{}
+		}
+	}
+	for _, route := range cfg.Routes {
+		if route = strings.TrimSpace(route); route != "" {
+			c.routes[route] = false
+		}
+	}
+	var headers []string
+	for _, header := range cfg.Headers {
+		if header = strings.TrimSpace(header); header != "" {
+			headers = append(headers, http.CanonicalHeaderKey(header))
+		}
+	}
+	c.headers = strings.Join(headers, ", ")
+
+	if c.anyOrigin && c.credentials {
+		slog.Warn("CORS credentials are never allowed for the * origin, only for listed origins")
+	}
+	h.cors = c
+}
+
+// withCORS envolve o handler de uma rota com CORS ligado; nas demais
+// retorna o próprio handler
+func (h *PaymentHandler) withCORS(path string, next http.HandlerFunc) http.HandlerFunc {
+	if h.cors == nil {
+		return next
+	}
+	if _, ok := h.cors.routes[path]; !ok {
+		return next
+	}
+	h.cors.routes[path] = true
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.cors.setHeaders(r.Header.Get("Origin"), w.Header().Add)
+		next(w, r)
+	}
+}
+
+// fastCORS aplica o CORS às rotas atendidas direto no fasthttp
+func (h *PaymentHandler) fastCORS(ctx *fasthttp.RequestCtx, path string) {
+	if h.cors == nil {
+		return
+	}
+	if _, ok := h.cors.routes[path]; !ok {
+		return
+	}
+	h.cors.setHeaders(string(ctx.Request.Header.Peek("Origin")),
+		func(key, value string) { ctx.Response.Header.Add(key, value) })
+}
+
+// registerPreflight registra o OPTIONS de cada rota com CORS ligado.
+// Rotas da configuração que não existem são apenas logadas.
+func (h *PaymentHandler) registerPreflight(mux *http.ServeMux) {
+	if h.cors == nil {
+		return
+	}
+	for route, registered := range h.cors.routes {
+		if !registered {
+			slog.Warn("CORS route not found, ignoring", "route", route)
+			continue
+		}
+		mux.HandleFunc("OPTIONS "+route, h.preflight(mux))
+	}
+}
+
+// preflight responde 204 ao OPTIONS com os métodos da rota. Os headers
+// CORS só saem para uma origem liberada pedindo um método da rota.
+func (h *PaymentHandler) preflight(mux *http.ServeMux) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		methods := slices.DeleteFunc(allowedMethods(mux, r), func(method string) bool {
+			return method == http.MethodOptions
+		})
+		w.Header().Set("Allow", strings.Join(append(methods, http.MethodOptions), ", "))
+		h.cors.setPreflightHeaders(r.Header.Get("Origin"), r.Header.Get("Access-Control-Request-Method"), methods, w.Header())
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// allowOrigin retorna o Access-Control-Allow-Origin para a origem e se a
+// resposta pode liberar credenciais. Uma origem listada é ecoada; "*" só
+// libera requisições sem credenciais, como exige a especificação.
+func (c *cors) allowOrigin(origin string) (value string, credentials bool) {
+	if origin == "" {
+		return "", false
+	}
+	if _, ok := c.origins[origin]; ok {
+		return origin, c.credentials
+	}
+	if c.anyOrigin {
+		return "*", false
+	}
+	return "", false
+}
+
+// setHeaders aplica os headers CORS de uma requisição comum (não preflight)
+func (c *cors) setHeaders(origin string, add func(key, value string)) {
+	add("Vary", "Origin")
+	value, credentials := c.allowOrigin(origin)
+	if value == "" {
+		return
+	}
+	add("Access-Control-Allow-Origin", value)
+	if credentials {
+		add("Access-Control-Allow-Credentials", "true")
+	}
+	add("Access-Control-Expose-Headers", logging.RequestIDHeader)
+}
+
+// setPreflightHeaders aplica os headers da resposta ao preflight; o
+// Max-Age deixa o navegador reaproveitá-la sem repetir o OPTIONS
+func (c *cors) setPreflightHeaders(origin, requestMethod string, methods []string, header http.Header) {
+	header.Add("Vary", "Origin")
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+
+	value, credentials := c.allowOrigin(origin)
+	if value == "" || !slices.Contains(methods, requestMethod) {
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", value)
+	if credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if c.headers != "" {
+		header.Set("Access-Control-Allow-Headers", c.headers)
+	}
+	header.Set("Access-Control-Max-Age", c.maxAge)
+}
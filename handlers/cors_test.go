@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/yurimachados/rinha-backend-go/config"
+)
+
+const dashboardOrigin = "https://dash.example.com"
+
+// enableCORS liga o CORS com as rotas e o Max-Age padrão da configuração
+func enableCORS(credentials bool, origins ...string) func(*PaymentHandler) {
+	return func(h *PaymentHandler) {
+		cfg := config.Default().CORS
+		cfg.Origins, cfg.AllowCredentials = origins, credentials
+		h.EnableCORS(cfg)
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	_, mux := newTestHandler(t, testConfig(t), enableCORS(false, dashboardOrigin))
+
+	rec := serve(mux, "OPTIONS", "/payments-summary", "",
+		"Origin", dashboardOrigin, "Access-Control-Request-Method", "GET")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("preflight status = %d, want 204", rec.Code)
+	}
+	want := map[string]string{
+		"Access-Control-Allow-Origin":  dashboardOrigin,
+		"Access-Control-Allow-Methods": "GET, HEAD",
+		"Access-Control-Max-Age":       "600", // 10 minutos, o padrão
+	}
+	for key, value := range want {
+		if got := rec.Header().Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("Access-Control-Allow-Credentials = %q with credentials off", got)
+	}
+
+	// Origem fora da lista ou método fora da rota: 204 sem headers CORS, e o
+	// navegador bloqueia a chamada
+	for _, tt := range []struct{ origin, method string }{
+		{"https://evil.example.com", "GET"},
+		{dashboardOrigin, "DELETE"},
+	} {
+		rec := serve(mux, "OPTIONS", "/payments-summary", "",
+			"Origin", tt.origin, "Access-Control-Request-Method", tt.method)
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("preflight %s from %s status = %d, want 204", tt.method, tt.origin, rec.Code)
+		}
+		for _, key := range []string{"Access-Control-Allow-Origin", "Access-Control-Max-Age"} {
+			if got := rec.Header().Get(key); got != "" {
+				t.Errorf("preflight %s from %s has %s %q", tt.method, tt.origin, key, got)
+			}
+		}
+	}
+}
+
+func TestCORSRequestHeaders(t *testing.T) {
+	_, mux := newTestHandler(t, testConfig(t), enableCORS(false, dashboardOrigin))
+
+	rec := serve(mux, "GET", "/payments-summary", "", "Origin", dashboardOrigin)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != dashboardOrigin {
+		t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, dashboardOrigin)
+	}
+	if got := rec.Header().Get("Vary"); got != "Origin" {
+		t.Errorf("Vary = %q, want Origin", got)
+	}
+
+	// Origem fora da lista recebe a resposta normal, sem headers CORS
+	rec = serve(mux, "GET", "/payments-summary", "", "Origin", "https://evil.example.com")
+	if rec.Code != http.StatusOK || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("disallowed origin got status %d and Access-Control-Allow-Origin %q, want 200 without it",
+			rec.Code, rec.Header().Get("Access-Control-Allow-Origin"))
+	}
+
+	// Rotas fora do CORS_ROUTES não recebem headers nem preflight
+	rec = serve(mux, "POST", "/payments", validPayment, "Origin", dashboardOrigin)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("POST /payments has Access-Control-Allow-Origin %q, the route is not in CORS_ROUTES", got)
+	}
+	rec = serve(mux, "OPTIONS", "/payments", "", "Origin", dashboardOrigin, "Access-Control-Request-Method", "POST")
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("OPTIONS /payments status = %d, want 405", rec.Code)
+	}
+}
+
+func TestCORSCredentials(t *testing.T) {
+	tests := []struct {
+		name            string
+		origins         []string
+		wantOrigin      string
+		wantCredentials string
+	}{
+		{"any origin never allows credentials", []string{"*"}, "*", ""},
+		{"listed origin allows credentials", []string{dashboardOrigin}, dashboardOrigin, "true"},
+		{"listed origin wins over any", []string{"*", dashboardOrigin}, dashboardOrigin, "true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, mux := newTestHandler(t, testConfig(t), enableCORS(true, tt.origins...))
+
+			responses := map[string]http.Header{
+				"request": serve(mux, "GET", "/payments-summary", "", "Origin", dashboardOrigin).Header(),
+				"preflight": serve(mux, "OPTIONS", "/payments-summary", "",
+					"Origin", dashboardOrigin, "Access-Control-Request-Method", "GET").Header(),
+			}
+			for kind, header := range responses {
+				if got := header.Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+					t.Errorf("%s Access-Control-Allow-Origin = %q, want %q", kind, got, tt.wantOrigin)
+				}
+				if got := header.Get("Access-Control-Allow-Credentials"); got != tt.wantCredentials {
+					t.Errorf("%s Access-Control-Allow-Credentials = %q, want %q", kind, got, tt.wantCredentials)
+				}
+			}
+		})
+	}
+}
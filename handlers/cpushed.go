@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/config"
+	"github.com/yurimachados/rinha-backend-go/limits"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// cpuShedder recusa parte dos POST /payments quando o processo chega perto
+// do limite de CPU, antes de decodificar o corpo: com a CPU no teto a
+// latência de tudo explode, inclusive a do summary. O uso é o tempo de CPU
+// do processo (getrusage) sobre o tempo de relógio e as CPUs disponíveis,
+// amostrado a cada interval pela própria requisição, sem goroutine. Acima
+// do threshold a probabilidade de recusa cresce com o excesso, de 0 no
+// threshold a 100% com a CPU cheia, limitada a maxReject.
+type cpuShedder struct {
+	threshold float64 // em %
+	maxReject float64 // em fração
+	interval  time.Duration
+	cpus      float64
+
+	sampleMu   sync.Mutex
+	sampledAt  atomic.Int64  // unix nanos da última amostra
+	sampledCPU atomic.Int64  // tempo de CPU do processo na última amostra
+	usage      atomic.Uint64 // % da capacidade na última janela, em math.Float64bits
+	reject     atomic.Uint64 // probabilidade de recusa atual, em math.Float64bits
+
+	shed atomic.Int64
+}
+
+// EnableCPUShedding liga a recusa por uso de CPU no POST /payments. Sem
+// como medir o tempo de CPU do processo na plataforma, fica desligada.
+func (h *PaymentHandler) EnableCPUShedding(cfg config.CPUShed) {
+	if cfg.ThresholdPercent <= 0 || cfg.ThresholdPercent >= 100 || cfg.MaxRejectPercent <= 0 || cfg.MaxRejectPercent > 100 || cfg.Interval <= 0 {
+		slog.Warn("invalid CPU shedding settings, CPU shedding disabled",
+			"threshold_percent", cfg.ThresholdPercent,
+			"max_reject_percent", cfg.MaxRejectPercent,
+			"interval_ms", cfg.Interval.Milliseconds())
+		return
+	}
+	cpuTime, err := limits.ProcessCPUTime()
+	if err != nil {
+		slog.Warn("cannot measure process CPU time, CPU shedding disabled", "error", err)
+		return
+	}
+
+	s := &cpuShedder{
+		threshold: float64(cfg.ThresholdPercent),
+		maxReject: float64(cfg.MaxRejectPercent) / 100,
+		interval:  cfg.Interval,
+		cpus:      limits.CPUs(),
+	}
+	s.sampledAt.Store(time.Now().UnixNano())
+	s.sampledCPU.Store(int64(cpuTime))
+	h.cpuShed = s
+
+	slog.Info("CPU shedding enabled",
+		"threshold_percent", cfg.ThresholdPercent,
+		"max_reject_percent", cfg.MaxRejectPercent,
+		"cpus", s.cpus)
+
+	metrics.RegisterGauge("rinha_cpu_usage_percent", "Uso de CPU do processo na última amostra, em % das CPUs disponíveis.", "", func() float64 {
+		return s.load(&s.usage)
+	})
+	metrics.RegisterGauge("rinha_cpu_shed_ratio", "Fração dos POST /payments recusada agora pelo uso de CPU.", "", func() float64 {
+		return s.load(&s.reject)
+	})
+}
+
+// admit decide se o payment entra; recusa com a probabilidade atual
+func (s *cpuShedder) admit() bool {
+	s.sample()
+	p := s.load(&s.reject)
+	if p <= 0 || rand.Float64() >= p {
+		return true
+	}
+	s.shed.Add(1)
+	return false
+}
+
+// sample mede o uso quando a janela venceu. Só uma requisição faz a
+// amostra; as demais seguem sem esperar o lock.
+func (s *cpuShedder) sample() {
+	now := time.Now().UnixNano()
+	last := s.sampledAt.Load()
+	if now-last < int64(s.interval) || !s.sampleMu.TryLock() {
+		return
+	}
+	defer s.sampleMu.Unlock()
+
+	if last != s.sampledAt.Load() {
+		return // outra requisição já amostrou
+	}
+	cpuTime, err := limits.ProcessCPUTime()
+	if err != nil {
+		return
+	}
+
+	elapsed := float64(now - last)
+	usage := float64(int64(cpuTime)-s.sampledCPU.Load()) / (elapsed * s.cpus) * 100
+	s.sampledCPU.Store(int64(cpuTime))
+	s.sampledAt.Store(now)
+
+	reject := 0.0
+	if usage > s.threshold {
+		reject = min((usage-s.threshold)/(100-s.threshold), s.maxReject)
+	}
+	s.usage.Store(math.Float64bits(usage))
+	s.reject.Store(math.Float64bits(reject))
+}
+
+func (s *cpuShedder) load(v *atomic.Uint64) float64 {
+	return math.Float64frombits(v.Load())
+}
+
+// stats retorna a configuração, o uso e a fração recusada na última
+// amostra e o total de recusas
+func (s *cpuShedder) stats() *types.CPUShedStats {
+	return &types.CPUShedStats{
+		ThresholdPercent: s.threshold,
+		MaxRejectPercent: s.maxReject * 100,
+		CPUs:             s.cpus,
+		UsagePercent:     math.Round(s.load(&s.usage)*10) / 10,
+		ShedPercent:      math.Round(s.load(&s.reject)*1000) / 10,
+		Shed:             s.shed.Load(),
+	}
+}
+
+// cpuShedding aplica a recusa por CPU ao POST /payments e, na recusa,
+// responde 503 com Retry-After
+func (h *PaymentHandler) cpuShedding(res responder) bool {
+	if h.cpuShed == nil || h.cpuShed.admit() {
+		return false
+	}
+	metrics.PaymentsRejected.Inc(metrics.ReasonCPUShed)
+	res.SetHeader("Retry-After", "1")
+	res.Error(http.StatusServiceUnavailable, metrics.ReasonCPUShed, "Server CPU saturated, retry later")
+	return true
+}
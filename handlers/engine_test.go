@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+)
+
+// engine serve o mux como um dos servidores do HTTP_ENGINE e devolve o
+// client e a URL base para as requisições
+type engine struct {
+	name  string
+	start func(t *testing.T, h *PaymentHandler, mux *http.ServeMux) (*http.Client, string)
+}
+
+// engines monta os dois servidores como o newHTTPEngine, sem o access log
+// e o limite de requisições simultâneas
+var engines = []engine{
+	{"nethttp", func(t *testing.T, h *PaymentHandler, mux *http.ServeMux) (*http.Client, string) {
+		server := httptest.NewServer(RequestID(Recover(mux)))
+		t.Cleanup(server.Close)
+		return server.Client(), server.URL
+	}},
+	{"fasthttp", func(t *testing.T, h *PaymentHandler, mux *http.ServeMux) (*http.Client, string) {
+		listener := fasthttputil.NewInmemoryListener()
+		server := &fasthttp.Server{
+			Handler:               h.FastHTTPHandler(RequestID(Recover(mux))),
+			MaxRequestBodySize:    int(h.MaxBodyBytes()),
+			ErrorHandler:          h.FastHTTPErrorHandler,
+			NoDefaultServerHeader: true,
+		}
+		go server.Serve(listener)
+		t.Cleanup(func() { server.Shutdown() })
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return listener.Dial()
+			},
+		}}
+		return client, "http://fasthttp.test"
+	}},
+}
+
+func TestEnginesShareHandlerSuite(t *testing.T) {
+	tests := []struct {
+		name         string
+		method, path string
+		contentType  string
+		body         string
+		header       []string
+		status       int
+		code         string // código do envelope de erro, se não for 2xx
+		allow        string
+	}{
+		{name: "accepted payment", method: "POST", path: "/payments", contentType: "application/json", body: validPayment, status: http.StatusAccepted},
+		{name: "payment with charset", method: "POST", path: "/payments", contentType: "application/json; charset=utf-8", body: validPayment, status: http.StatusAccepted},
+		{name: "invalid json", method: "POST", path: "/payments", contentType: "application/json", body: `{"amount":`, status: http.StatusBadRequest, code: metrics.ReasonInvalidJSON},
+		{name: "validation failure", method: "POST", path: "/payments", contentType: "application/json", body: `{"amount":-5,"type":"credit"}`, status: http.StatusBadRequest, code: metrics.ReasonValidation},
+		{name: "unsupported media type", method: "POST", path: "/payments", contentType: "text/plain", body: validPayment, status: http.StatusUnsupportedMediaType, code: metrics.ReasonUnsupportedMediaType},
+		{name: "body too large", method: "POST", path: "/payments", contentType: "application/json", body: paddedPayment(8 << 10), status: http.StatusRequestEntityTooLarge, code: metrics.ReasonBodyTooLarge},
+		{name: "batch", method: "POST", path: "/payments/batch", contentType: "application/json", body: batchBody(3), status: http.StatusMultiStatus},
+		{name: "empty batch", method: "POST", path: "/payments/batch", contentType: "application/json", body: "[]", status: http.StatusBadRequest, code: codeEmptyBatch},
+		{name: "summary", method: "GET", path: "/payments-summary", status: http.StatusOK},
+		{name: "summary with bad range", method: "GET", path: "/payments-summary?from=yesterday", status: http.StatusBadRequest, code: codeInvalidParameter},
+		{name: "health through the mux", method: "GET", path: "/health", status: http.StatusOK},
+		{name: "method not allowed", method: "PUT", path: "/payments", status: http.StatusMethodNotAllowed, code: codeMethodNotAllowed, allow: "GET, HEAD, POST"},
+		{name: "unknown route", method: "GET", path: "/nope", status: http.StatusNotFound, code: codeNotFound},
+	}
+
+	for _, eng := range engines {
+		t.Run(eng.name, func(t *testing.T) {
+			h, mux := newTestHandler(t, testConfig(t))
+			client, base := eng.start(t, h, mux)
+
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					req, _ := http.NewRequest(tt.method, base+tt.path, strings.NewReader(tt.body))
+					if tt.contentType != "" {
+						req.Header.Set("Content-Type", tt.contentType)
+					}
+					req.Header.Set(logging.RequestIDHeader, "req-"+eng.name)
+					resp, err := client.Do(req)
+					if err != nil {
+						t.Fatalf("%s %s: %v", tt.method, tt.path, err)
+					}
+					body, _ := io.ReadAll(resp.Body)
+					resp.Body.Close()
+
+					if resp.StatusCode != tt.status {
+						t.Fatalf("status = %d, want %d (body %s)", resp.StatusCode, tt.status, body)
+					}
+					if got := resp.Header.Values(logging.RequestIDHeader); len(got) != 1 || got[0] != "req-"+eng.name {
+						t.Errorf("%s = %q, want the request's id echoed once", logging.RequestIDHeader, got)
+					}
+					if got := resp.Header.Get("Allow"); got != tt.allow {
+						t.Errorf("Allow = %q, want %q", got, tt.allow)
+					}
+					if tt.code != "" {
+						if code := errorCode(t, body); code != tt.code {
+							t.Errorf("code = %q, want %q", code, tt.code)
+						}
+					} else if !json.Valid(body) && tt.path != "/health" {
+						t.Errorf("body %s is not JSON", body)
+					}
+				})
+			}
+		})
+	}
+}
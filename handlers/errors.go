@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// Códigos de erro da API. São estáveis: o cliente decide pelo código e não
+// pela mensagem. As recusas de payments usam os mesmos motivos do
+// rinha_payments_rejected_total (metrics.Reason*).
+const (
+	codeBadRequest           = "bad_request"
+	codeNotFound             = "not_found"
+	codeMethodNotAllowed     = "method_not_allowed"
+	codeInternal             = "internal_error"
+	codeEmptyBatch           = "empty_batch"
+	codeBatchTooLarge        = "batch_too_large"
+	codeProcessingFailed     = "processing_failed"
+	codeInvalidParameter     = "invalid_parameter"
+	codeSummaryUnavailable   = "summary_unavailable"
+	codePaymentNotFound      = "payment_not_found"
+	codeUnknownProcessor     = "unknown_processor"
+	codeInvalidState         = "invalid_state"
+	codeInvalidCapacity      = "invalid_capacity"
+	codeQueueNotResizable    = "queue_not_resizable"
+	codeChaosDisabled        = "chaos_disabled"
+	codeInvalidChaosRule     = "invalid_chaos_rule"
+	codeInvalidExchangeLog   = "invalid_exchange_log"
+	codeInvalidWeight        = "invalid_weight"
+	codeWeightsDisabled      = "weights_disabled"
+	codeInvalidShadow        = "invalid_shadow"
+	codeTooManySubscribers   = "too_many_subscribers"
+	codeStreamingUnsupported = "streaming_unsupported"
+	codeAmountTooLarge       = "amount_too_large"
+)
+
+// validationCode é o código de erro de um payment recusado na validação:
+// amount acima do máximo tem código próprio, o resto é validation_failed
+func validationCode(err error) string {
+	var tooLarge *types.AmountTooLargeError
+	if errors.As(err, &tooLarge) {
+		return codeAmountTooLarge
+	}
+	return metrics.ReasonValidation
+}
+
+// invalidJSONMessage descreve um corpo recusado pelo decoder; erros de um
+// campo (amount com expoente, fora do int64, em string) dizem qual
+func invalidJSONMessage(err error) string {
+	var fieldErr *types.FieldError
+	if errors.As(err, &fieldErr) {
+		return "Invalid JSON: " + fieldErr.Error()
+	}
+	return "Invalid JSON"
+}
+
+// writeError responde com o envelope de erro da API no net/http
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	httpResponder{w}.Error(status, code, message)
+}
+
+// appendError acrescenta o envelope {"error":{"code":...,"message":...}},
+// o mesmo que o encoding/json geraria para um types.ErrorResponse, sem
+// passar por reflexão: a fila cheia responde erros no caminho quente
+func appendError(dst []byte, code, message string) []byte {
+	return appendErrorRetry(dst, code, message, 0)
+}
+
+// appendErrorRetry é o appendError com o retryAfterMs do ErrorDetail,
+// omitido quando zero
+func appendErrorRetry(dst []byte, code, message string, retryAfterMs int64) []byte {
+	dst = append(dst, `{"error":{"code":`...)
+	dst = types.AppendJSONString(dst, code)
+	dst = append(dst, `,"message":`...)
+	dst = types.AppendJSONString(dst, message)
+	if retryAfterMs > 0 {
+		dst = append(dst, `,"retryAfterMs":`...)
+		dst = strconv.AppendInt(dst, retryAfterMs, 10)
+	}
+	return append(dst, "}}\n"...)
+}
+
+// routeMethods são os métodos testados para montar o Allow do 405
+var routeMethods = []string{
+	http.MethodDelete, http.MethodGet, http.MethodHead, http.MethodOptions,
+	http.MethodPatch, http.MethodPost, http.MethodPut,
+}
+
+// allowedMethods consulta o mux com cada método para o caminho da
+// requisição e retorna os que têm rota, sem contar o catch-all
+func allowedMethods(mux *http.ServeMux, r *http.Request) []string {
+	var allowed []string
+	probe := *r
+	for _, method := range routeMethods {
+		probe.Method = method
+		if _, pattern := mux.Handler(&probe); pattern != "" && pattern != "/" {
+			allowed = append(allowed, method)
+		}
+	}
+	return allowed
+}
+
+// routeNotFound é o catch-all do mux: caminhos desconhecidos recebem 404 e
+// caminhos conhecidos com outro método recebem 405 com Allow, os dois no
+// envelope de erro. Registrado em "/", ele casa com qualquer requisição que
+// nenhuma outra rota atende, então o 405 é montado aqui consultando o mux
+// com cada método. O 405 nas rotas de ingest conta como recusa na entrada,
+// como os demais motivos do POST /payments.
+func routeNotFound(mux *http.ServeMux) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		allowed := allowedMethods(mux, r)
+		if len(allowed) == 0 {
+			writeError(w, http.StatusNotFound, codeNotFound, "no route for "+r.URL.Path)
+			return
+		}
+		if ingestPath(r.URL.Path) {
+			metrics.PaymentsRejected.Inc(metrics.ReasonMethodNotAllowed)
+		}
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed,
+			"method "+r.Method+" not allowed for "+r.URL.Path)
+	}
+}
+
+// ingestPath indica os caminhos que recebem payments
+func ingestPath(path string) bool {
+	return path == "/payments" || path == "/payments/batch"
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/yurimachados/rinha-backend-go/config"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/queue"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// strictErrorBody decodifica o envelope de erro recusando campos fora do
+// types.ErrorResponse, para o teste pegar um envelope montado à mão que
+// divergiu do tipo
+func strictErrorBody(t *testing.T, body []byte) types.ErrorDetail {
+	t.Helper()
+	var resp types.ErrorResponse
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&resp); err != nil {
+		t.Fatalf("body %s does not match types.ErrorResponse: %v", body, err)
+	}
+	errorCode(t, body)
+	return resp.Error
+}
+
+func TestErrorPathsUseTheEnvelope(t *testing.T) {
+	paused := func(h *PaymentHandler) { h.workerPool.Pause() }
+
+	tests := []struct {
+		name         string
+		modify       func(*config.Config)
+		setup        func(*PaymentHandler)
+		admin        bool // rota do listener de admin
+		method       string
+		target, body string
+		header       []string
+		repeat       int // requisições; só a última é conferida
+		wantStatus   int
+		wantCode     string
+	}{
+		// Rotas
+		{name: "unknown path", method: "GET", target: "/nope", wantStatus: 404, wantCode: codeNotFound},
+		{name: "wrong method", method: "DELETE", target: "/payments-summary", wantStatus: 405, wantCode: codeMethodNotAllowed},
+		{name: "admin unknown path", admin: true, method: "POST", target: "/admin/nope", wantStatus: 404, wantCode: codeNotFound},
+
+		// POST /payments
+		{name: "invalid json", method: "POST", target: "/payments", body: `{"amount":`, wantStatus: 400, wantCode: metrics.ReasonInvalidJSON},
+		{name: "validation", method: "POST", target: "/payments", body: `{"amount":-5,"type":"credit"}`, wantStatus: 400, wantCode: metrics.ReasonValidation},
+		{name: "amount too large", method: "POST", target: "/payments", body: `{"amount":1000000001,"type":"credit"}`, wantStatus: 400, wantCode: codeAmountTooLarge},
+		{name: "body too large", method: "POST", target: "/payments", body: paddedPayment(8 << 10), wantStatus: 413, wantCode: metrics.ReasonBodyTooLarge},
+		{name: "unsupported media type", method: "POST", target: "/payments", body: validPayment, header: []string{"Content-Type", "text/plain"}, wantStatus: 415, wantCode: metrics.ReasonUnsupportedMediaType},
+		{name: "queue full", method: "POST", target: "/payments", body: validPayment, setup: paused, repeat: 3, wantStatus: 503, wantCode: metrics.ReasonQueueFull},
+		{name: "backpressure", method: "POST", target: "/payments", body: validPayment, setup: func(h *PaymentHandler) {
+			paused(h)
+			h.EnableAdmissionControl(50, 10, 100)
+		}, repeat: 2, wantStatus: 429, wantCode: metrics.ReasonBackpressure},
+		{name: "rate limited", method: "POST", target: "/payments", body: validPayment, setup: withRateLimit(1), repeat: 2, wantStatus: 429, wantCode: metrics.ReasonRateLimited},
+		{name: "duplicate payment", method: "POST", target: "/payments", body: duplicatePayment, setup: paused, repeat: 2, wantStatus: 409, wantCode: metrics.ReasonDuplicate},
+
+		// POST /payments/batch
+		{name: "empty batch", method: "POST", target: "/payments/batch", body: `[]`, wantStatus: 400, wantCode: codeEmptyBatch},
+		{name: "batch too large", method: "POST", target: "/payments/batch", body: batchBody(3), modify: func(c *config.Config) { c.Ingest.MaxBatchItems = 2 }, wantStatus: 413, wantCode: codeBatchTooLarge},
+		{name: "batch not an array", method: "POST", target: "/payments/batch", body: validPayment, wantStatus: 400, wantCode: metrics.ReasonInvalidJSON},
+
+		// Leituras
+		{name: "payment not found", method: "GET", target: "/payments/4a7901b8-7d26-4d9d-aa19-4dc1c7cf60b3", wantStatus: 404, wantCode: codePaymentNotFound},
+		{name: "invalid limit", method: "GET", target: "/payments?limit=0", wantStatus: 400, wantCode: codeInvalidParameter},
+		{name: "invalid cursor", method: "GET", target: "/payments?cursor=bm90LWEtY3Vyc29y", wantStatus: 400, wantCode: codeInvalidParameter},
+		{name: "invalid summary from", method: "GET", target: "/payments-summary?from=yesterday", wantStatus: 400, wantCode: codeInvalidParameter},
+		{name: "invalid groupBy", method: "GET", target: "/payments-summary?groupBy=day", wantStatus: 400, wantCode: codeInvalidParameter},
+		{name: "invalid tolerance", method: "GET", target: "/admin/selfcheck?tolerance=-1", wantStatus: 400, wantCode: codeInvalidParameter},
+
+		// Admin
+		{name: "admin invalid json", admin: true, method: "POST", target: "/admin/processors/default/state", body: `{`, wantStatus: 400, wantCode: metrics.ReasonInvalidJSON},
+		{name: "unknown processor", admin: true, method: "POST", target: "/admin/processors/backup/state", body: `{"state":"healthy"}`, wantStatus: 404, wantCode: codeUnknownProcessor},
+		{name: "invalid state", admin: true, method: "POST", target: "/admin/processors/default/state", body: `{"state":"sleepy"}`, wantStatus: 400, wantCode: codeInvalidState},
+		{name: "invalid capacity", admin: true, method: "POST", target: "/admin/queue/capacity", body: `{"capacity":0}`, wantStatus: 400, wantCode: codeInvalidCapacity},
+		{name: "queue not resizable", admin: true, method: "POST", target: "/admin/queue/capacity", body: `{"capacity":10}`,
+			modify: func(c *config.Config) { c.Pool.PriorityThreshold = 1000 }, wantStatus: 409, wantCode: codeQueueNotResizable},
+		{name: "chaos disabled", admin: true, method: "POST", target: "/admin/chaos", body: `{"default":{"error_percent":20}}`, wantStatus: 409, wantCode: codeChaosDisabled},
+		{name: "invalid exchange log", admin: true, method: "POST", target: "/admin/exchange-log", body: `{"every":-1}`, wantStatus: 400, wantCode: codeInvalidExchangeLog},
+		{name: "invalid shadow", admin: true, method: "POST", target: "/admin/shadow", body: `{"percent":101}`, wantStatus: 400, wantCode: codeInvalidShadow},
+		{name: "invalid weight", admin: true, method: "POST", target: "/admin/weights", body: `{"default":-1}`, wantStatus: 400, wantCode: codeInvalidWeight},
+		{name: "unknown weighted processor", admin: true, method: "POST", target: "/admin/weights", body: `{"backup":10}`, wantStatus: 404, wantCode: codeUnknownProcessor},
+		{name: "weights disabled", admin: true, method: "POST", target: "/admin/weights", body: `{"default":10}`,
+			modify: func(c *config.Config) { c.Processors.RoutingStrategy = queue.RoutingSticky }, wantStatus: 409, wantCode: codeWeightsDisabled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Pool.Workers, cfg.Pool.QueueSize = 1, 2
+			cfg.Ingest.MaxBodyBytes = 256
+			if tt.modify != nil {
+				tt.modify(&cfg)
+			}
+			var setup []func(*PaymentHandler)
+			if tt.setup != nil {
+				setup = append(setup, tt.setup)
+			}
+			h, mux := newTestHandler(t, cfg, setup...)
+			if tt.admin {
+				mux = http.NewServeMux()
+				h.RegisterAdminRoutes(mux)
+			}
+
+			rec := serve(mux, tt.method, tt.target, tt.body, tt.header...)
+			for range max(tt.repeat, 1) - 1 {
+				rec = serve(mux, tt.method, tt.target, tt.body, tt.header...)
+			}
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+			detail := strictErrorBody(t, rec.Body.Bytes())
+			if detail.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q (message %q)", detail.Code, tt.wantCode, detail.Message)
+			}
+			// Só a fila cheia diz em quanto tempo tentar de novo
+			if wantRetry := tt.wantCode == metrics.ReasonQueueFull; (detail.RetryAfterMs > 0) != wantRetry {
+				t.Errorf("retryAfterMs = %d, want it only on queue_full", detail.RetryAfterMs)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/valyala/fasthttp"
+
+	"github.com/yurimachados/rinha-backend-go/queue"
+)
+
+// eventHeartbeat é o intervalo do evento heartbeat, que também revela
+// conexões mortas quando não há payments
+const eventHeartbeat = 15 * time.Second
+
+// GetPaymentEvents abre um stream SSE com um evento por payment finalizado
+// pelos workers e um heartbeat periódico (adaptador net/http)
+func (h *PaymentHandler) GetPaymentEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, codeStreamingUnsupported, "Streaming unsupported")
+		return
+	}
+
+	sub, ok := h.workerPool.Events().Subscribe()
+	if !ok {
+		writeError(w, http.StatusServiceUnavailable, codeTooManySubscribers, "Too many event subscribers")
+		return
+	}
+	defer h.workerPool.Events().Unsubscribe(sub)
+
+	// O WriteTimeout do servidor encerraria o stream; ele vale só até aqui
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	setEventStreamHeaders(w.Header().Set)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	streamEvents(r.Context().Done(), w, func() error {
+		flusher.Flush()
+		return nil
+	}, sub)
+}
+
+// fastGetPaymentEvents é o adaptador fasthttp do GET /payments/events. O
+// stream roda depois que o handler retorna, então a saída do cliente só é
+// percebida quando uma escrita falha, alguns heartbeats depois; até lá o
+// assinante continua contado.
+func (h *PaymentHandler) fastGetPaymentEvents(ctx *fasthttp.RequestCtx) {
+	res := fastResponder{ctx}
+	sub, ok := h.workerPool.Events().Subscribe()
+	if !ok {
+		res.Error(http.StatusServiceUnavailable, codeTooManySubscribers, "Too many event subscribers")
+		return
+	}
+
+	setEventStreamHeaders(func(key, value string) { ctx.Response.Header.Set(key, value) })
+	conn := ctx.Conn()
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer h.workerPool.Events().Unsubscribe(sub)
+
+		// O servidor aplica o WriteTimeout à resposta inteira
+		conn.SetWriteDeadline(time.Time{})
+		if w.Flush() != nil {
+			return
+		}
+		streamEvents(nil, w, w.Flush, sub)
+	})
+}
+
+func setEventStreamHeaders(set func(key, value string)) {
+	set("Content-Type", "text/event-stream")
+	set("Cache-Control", "no-cache")
+	set("X-Accel-Buffering", "no") // proxies não devem segurar o stream
+}
+
+// streamEvents escreve os eventos do assinante até o cliente sair (done ou
+// erro de escrita) ou o hub ser encerrado no desligamento do servidor
+func streamEvents(done <-chan struct{}, w io.Writer, flush func() error, sub *queue.Subscription) {
+	ticker := time.NewTicker(eventHeartbeat)
+	defer ticker.Stop()
+
+	buf := make([]byte, 0, 512)
+	for {
+		buf = buf[:0]
+		select {
+		case <-done:
+			return
+
+		case event, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			buf = appendEvent(buf, "payment", event)
+
+			// Eventos já disponíveis vão na mesma escrita
+		drain:
+			for len(buf) < 16<<10 {
+				select {
+				case event, ok := <-sub.C:
+					if !ok {
+						break drain
+					}
+					buf = appendEvent(buf, "payment", event)
+				default:
+					break drain
+				}
+			}
+
+		case now := <-ticker.C:
+			buf = append(buf, "event: heartbeat\ndata: {\"time\":"...)
+			buf = strconv.AppendQuote(buf, now.UTC().Format(time.RFC3339))
+			buf = append(buf, ",\"dropped\":"...)
+			buf = strconv.AppendInt(buf, sub.Dropped(), 10)
+			buf = append(buf, "}\n\n"...)
+		}
+
+		if _, err := w.Write(buf); err != nil {
+			return
+		}
+		if err := flush(); err != nil {
+			return
+		}
+	}
+}
+
+// appendEvent acrescenta um evento SSE com o valor em JSON
+func appendEvent(buf []byte, name string, v any) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return buf
+	}
+	buf = append(buf, "event: "...)
+	buf = append(buf, name...)
+	buf = append(buf, "\ndata: "...)
+	buf = append(buf, data...)
+	return append(buf, "\n\n"...)
+}
+
+// CloseEventStreams encerra os streams de eventos abertos; deve ser chamado
+// antes do desligamento do servidor, que espera as requisições em andamento
+func (h *PaymentHandler) CloseEventStreams() {
+	h.workerPool.Events().Close()
+}
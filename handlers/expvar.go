@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+)
+
+// publishOnce protege o expvar.Publish, que entra em pânico com um nome
+// repetido. As funções publicadas leem o handler de expvarHandler, o
+// último a chamar o EnableExpvar, e não o primeiro.
+var (
+	publishOnce   sync.Once
+	expvarHandler atomic.Pointer[PaymentHandler]
+)
+
+// EnableExpvar publica os contadores no expvar e serve /debug/vars no
+// listener de admin; deve ser chamado antes do RegisterAdminRoutes. Os valores
+// são calculados na leitura a partir dos mesmos contadores atômicos do
+// summary e do /metrics:
+//
+//	payments    summary local (como o /internal/summary) e entrada do POST /payments
+//	queue       pool de workers e fila (como detail.pool)
+//	processors  saúde e circuit breaker de cada processador (como o /admin/processors)
+//
+// O /debug/vars também traz cmdline e memstats, publicados pelo próprio
+// pacote expvar, por isso fica desligado por padrão.
+func (h *PaymentHandler) EnableExpvar() {
+	h.expvar = true
+	expvarHandler.Store(h)
+	publishOnce.Do(func() {
+		expvar.Publish("payments", expvar.Func(func() any {
+			h := expvarHandler.Load()
+			return map[string]any{
+				"summary": h.processor.LocalSummary(),
+				"ingress": h.windowIngress(),
+			}
+		}))
+		expvar.Publish("queue", expvar.Func(func() any {
+			return expvarHandler.Load().workerPool.Stats()
+		}))
+		expvar.Publish("processors", expvar.Func(func() any {
+			return expvarHandler.Load().processor.ProcessorStates()
+		}))
+	})
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+func TestExpvarServedOnlyOnAdminMux(t *testing.T) {
+	h, public := newTestHandler(t, testConfig(t), (*PaymentHandler).EnableExpvar)
+	admin := http.NewServeMux()
+	h.RegisterAdminRoutes(admin)
+
+	if rec := serve(public, "GET", "/debug/vars", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("public /debug/vars status = %d, want 404", rec.Code)
+	}
+
+	rec := serve(admin, "GET", "/debug/vars", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("admin /debug/vars status = %d, want 200", rec.Code)
+	}
+	var vars map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	for _, key := range []string{"payments", "queue", "processors", "memstats"} {
+		if _, ok := vars[key]; !ok {
+			t.Errorf("/debug/vars has no %q", key)
+		}
+	}
+	var payments struct {
+		Summary json.RawMessage `json:"summary"`
+		Ingress json.RawMessage `json:"ingress"`
+	}
+	if err := json.Unmarshal(vars["payments"], &payments); err != nil || payments.Summary == nil || payments.Ingress == nil {
+		t.Errorf("payments = %s, want summary and ingress", vars["payments"])
+	}
+}
+
+// debugVars lê o /debug/vars do mux de admin
+func debugVars(t *testing.T, admin http.Handler) (summary types.PaymentSummary, queue types.PoolStats) {
+	t.Helper()
+	rec := serve(admin, "GET", "/debug/vars", "")
+	var vars struct {
+		Payments struct {
+			Summary types.PaymentSummary `json:"summary"`
+		} `json:"payments"`
+		Queue types.PoolStats `json:"queue"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	return vars.Payments.Summary, vars.Queue
+}
+
+func TestExpvarFollowsLatestHandler(t *testing.T) {
+	// Um handler anterior no mesmo processo, como em um restart
+	first, _ := newTestHandler(t, testConfig(t), (*PaymentHandler).EnableExpvar)
+	firstAdmin := http.NewServeMux()
+	first.RegisterAdminRoutes(firstAdmin)
+
+	cfg := testConfig(t)
+	cfg.Pool.QueueSize = 64
+	h, mux := newTestHandler(t, cfg, (*PaymentHandler).EnableExpvar)
+	admin := http.NewServeMux()
+	h.RegisterAdminRoutes(admin)
+
+	submitPayments(t, mux, 3)
+	for deadline := time.Now().Add(2 * time.Second); h.processor.LocalSummary().DefaultSuccess < 3; {
+		if time.Now().After(deadline) {
+			t.Fatal("the payments were never processed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	summary, queue := debugVars(t, admin)
+	if summary.TotalPayments != 3 || summary.DefaultSuccess != 3 || summary.DefaultAmount != 3*100 {
+		t.Errorf("payments.summary = %+v, want the 3 payments of the latest handler", summary)
+	}
+	if queue.QueueSize != 64 || queue.QueueDepth != 0 {
+		t.Errorf("queue = size %d, depth %d; want the latest handler's 64 and 0", queue.QueueSize, queue.QueueDepth)
+	}
+
+	// Com os workers pausados os próximos ficam na fila
+	h.workerPool.Pause()
+	submitPayments(t, mux, 2)
+	if _, queue := debugVars(t, admin); queue.QueueDepth != 2 {
+		t.Errorf("queue depth = %d, want the 2 paused payments", queue.QueueDepth)
+	}
+
+	// O mesmo expvar servido por qualquer mux mostra o handler mais recente
+	if summary, _ := debugVars(t, firstAdmin); summary.TotalPayments != 3 {
+		t.Errorf("first handler's /debug/vars shows %d payments, want the latest handler's 3", summary.TotalPayments)
+	}
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/tracing"
+)
+
+// FastHTTPHandler atende POST /payments, o lote, os eventos e GET /payments-summary direto no
+// fasthttp, com o mesmo núcleo do net/http. As demais rotas (health,
+// métricas, summary interno, admin, busca por id) e os métodos não
+// atendidos são repassados ao handler net/http.
+// Pânicos são recuperados como no Recover e o id da requisição é tratado
+// como no RequestID.
+func (h *PaymentHandler) FastHTTPHandler(fallback http.Handler) fasthttp.RequestHandler {
+	fallbackHandler := fasthttpadaptor.NewFastHTTPHandler(fallback)
+
+	return func(ctx *fasthttp.RequestCtx) {
+		reqCtx := fastRequestID(ctx)
+		defer recoverFastHTTP(ctx, reqCtx)
+
+		// Método e caminho como nos padrões do RegisterRoutes; o resto,
+		// inclusive o 405 com Allow, fica com o mux
+		switch path := string(ctx.Path()); {
+		case path == "/payments" && ctx.IsPost():
+			h.fastCORS(ctx, path)
+			h.fastPostPayments(ctx, reqCtx)
+		case path == "/payments/batch" && ctx.IsPost():
+			h.fastCORS(ctx, path)
+			h.fastPostPaymentsBatch(ctx, reqCtx)
+		case path == "/payments-summary" && ctx.IsGet():
+			h.fastCORS(ctx, path)
+			h.fastGetPaymentsSummary(ctx, reqCtx)
+		case path == "/payments/events" && ctx.IsGet():
+			h.fastCORS(ctx, path)
+			h.fastGetPaymentEvents(ctx)
+		default:
+			// O RequestID do net/http devolve o mesmo id; sem apagar aqui o
+			// adaptador repetiria o header
+			ctx.Response.Header.Del(logging.RequestIDHeader)
+			fallbackHandler(ctx)
+		}
+	}
+}
+
+// FastHTTPErrorHandler responde os erros de leitura da requisição no
+// fasthttp. Corpos acima do MaxRequestBodySize recebem o mesmo 413 do
+// net/http; os demais erros, 400 no envelope de erro da API.
+func (h *PaymentHandler) FastHTTPErrorHandler(ctx *fasthttp.RequestCtx, err error) {
+	if errors.Is(err, fasthttp.ErrBodyTooLarge) {
+		limit := h.maxBodyBytes
+		if string(ctx.Path()) == "/payments/batch" {
+			limit = h.maxBatchBytes
+		}
+		ctx.SetConnectionClose()
+		h.rejectTooLarge(fastResponder{ctx}, limit)
+		return
+	}
+	fastResponder{ctx}.Error(http.StatusBadRequest, codeBadRequest, "Error when parsing request")
+}
+
+// fastPostPayments é o adaptador fasthttp do POST /payments. O RequestCtx
+// não pode ser usado depois que o handler retorna, então o núcleo recebe
+// reqCtx, derivado de um context.Background com o id da requisição (o
+// inline só usa o contexto de forma síncrona).
+func (h *PaymentHandler) fastPostPayments(ctx *fasthttp.RequestCtx, reqCtx context.Context) {
+	res := fastResponder{ctx}
+	// Os headers só são copiados com o rate limit ligado
+	if h.rateLimit != nil && h.limited(res, ctx.RemoteAddr().String(),
+		string(ctx.Request.Header.Peek("X-Real-IP")), string(ctx.Request.Header.Peek("X-Forwarded-For"))) {
+		return
+	}
+	if h.cpuShedding(res) {
+		return
+	}
+
+	if tracing.Enabled() {
+		var span trace.Span
+		reqCtx, span = startAcceptSpan(reqCtx, "POST /payments", traceHeader(ctx))
+		defer span.End()
+	}
+
+	// O fasthttp já leu o corpo, mas ele não chega a ser decodificado
+	in, ok := h.requestCodec(string(ctx.Request.Header.ContentType()))
+	if !ok {
+		h.rejectUnsupportedMediaType(res, codecMediaTypes)
+		return
+	}
+
+	// O servidor recusa corpos acima do limite sem lê-los por inteiro
+	// (MaxRequestBodySize); a checagem aqui cobre servidores sem o limite
+	body := ctx.PostBody()
+	if int64(len(body)) > h.maxBodyBytes {
+		ctx.SetConnectionClose()
+		h.rejectTooLarge(res, h.maxBodyBytes)
+		return
+	}
+
+	h.ingest(reqCtx, in, body, res, wantsSync(string(ctx.QueryArgs().Peek("sync")), string(ctx.Request.Header.Peek("X-Sync"))))
+}
+
+// fastGetPaymentsSummary é o adaptador fasthttp do GET /payments-summary
+func (h *PaymentHandler) fastGetPaymentsSummary(ctx *fasthttp.RequestCtx, reqCtx context.Context) {
+	res := h.compressible(fastResponder{ctx}, string(ctx.Request.Header.Peek("Accept-Encoding")))
+
+	query := url.Values{}
+	ctx.QueryArgs().VisitAll(func(key, value []byte) {
+		query.Add(string(key), string(value))
+	})
+	h.summary(reqCtx, query, res, responseCodec(string(ctx.Request.Header.Peek("Accept"))))
+}
+
+// fastPostPaymentsBatch é o adaptador fasthttp do POST /payments/batch
+func (h *PaymentHandler) fastPostPaymentsBatch(ctx *fasthttp.RequestCtx, reqCtx context.Context) {
+	res := fastResponder{ctx}
+	if tracing.Enabled() {
+		var span trace.Span
+		reqCtx, span = startAcceptSpan(reqCtx, "POST /payments/batch", traceHeader(ctx))
+		defer span.End()
+	}
+
+	if !h.acceptsContentType(string(ctx.Request.Header.ContentType())) {
+		h.rejectUnsupportedMediaType(res, "application/json")
+		return
+	}
+
+	body := ctx.PostBody()
+	if int64(len(body)) > h.maxBatchBytes {
+		ctx.SetConnectionClose()
+		h.rejectTooLarge(res, h.maxBatchBytes)
+		return
+	}
+
+	// Os headers só são copiados com o rate limit ligado
+	client := ""
+	if h.rateLimit != nil {
+		client = h.rateLimitClient(ctx.RemoteAddr().String(),
+			string(ctx.Request.Header.Peek("X-Real-IP")), string(ctx.Request.Header.Peek("X-Forwarded-For")))
+	}
+	h.ingestBatch(reqCtx, body, res, client)
+}
+
+// MaxBodyBytes retorna o maior limite de corpo entre o POST /payments e o
+// lote, usado como MaxRequestBodySize do servidor; cada rota confere o seu
+func (h *PaymentHandler) MaxBodyBytes() int64 {
+	return max(h.maxBodyBytes, h.maxBatchBytes)
+}
+
+// traceHeader copia os headers de trace context para a propagação do otel
+func traceHeader(ctx *fasthttp.RequestCtx) http.Header {
+	header := http.Header{}
+	if v := ctx.Request.Header.Peek("traceparent"); len(v) > 0 {
+		header.Set("traceparent", string(v))
+	}
+	if v := ctx.Request.Header.Peek("tracestate"); len(v) > 0 {
+		header.Set("tracestate", string(v))
+	}
+	return header
+}
+
+// fastResponder adapta um fasthttp.RequestCtx
+type fastResponder struct {
+	ctx *fasthttp.RequestCtx
+}
+
+// JSON copia o corpo para a resposta do fasthttp
+func (r fastResponder) JSON(status int, body []byte) {
+	r.ctx.SetStatusCode(status)
+	r.ctx.SetContentType("application/json")
+	r.ctx.SetBody(body)
+}
+
+// Body copia o corpo para a resposta do fasthttp com o Content-Type do
+// formato
+func (r fastResponder) Body(status int, contentType string, body []byte) {
+	r.ctx.SetStatusCode(status)
+	r.ctx.SetContentType(contentType)
+	r.ctx.SetBody(body)
+}
+
+// Error escreve o envelope de erro como no net/http
+func (r fastResponder) Error(status int, code, message string) {
+	writeErrorJSON(r, status, code, message)
+}
+
+// SetHeader define o header na resposta do fasthttp
+func (r fastResponder) SetHeader(key, value string) {
+	r.ctx.Response.Header.Set(key, value)
+}
+
+// AddHeader acrescenta o valor ao header na resposta do fasthttp
+func (r fastResponder) AddHeader(key, value string) {
+	r.ctx.Response.Header.Add(key, value)
+}
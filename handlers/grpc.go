@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/yurimachados/rinha-backend-go/grpcapi"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/tracing"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// grpcPayments atende o serviço Payments do grpcapi com o mesmo caminho do
+// POST /payments: o payment recebido é validado e enfileirado pelo enqueue,
+// então contadores, tipos e dedup se comportam como no HTTP. O rate limit
+// por IP cobra um token por payment, inclusive de cada mensagem do stream.
+type grpcPayments struct {
+	grpcapi.UnimplementedPaymentsServer
+	h *PaymentHandler
+}
+
+// NewGRPCServer cria o servidor gRPC com o serviço Payments registrado. As
+// mensagens recebidas têm o mesmo limite do corpo do POST /payments e
+// pânicos nos handlers são recuperados como no Recover.
+func (h *PaymentHandler) NewGRPCServer() *grpc.Server {
+	server := grpc.NewServer(
+		grpc.MaxRecvMsgSize(int(h.maxBodyBytes)),
+		grpc.ChainUnaryInterceptor(recoverUnary),
+		grpc.ChainStreamInterceptor(recoverStream),
+	)
+	grpcapi.RegisterPaymentsServer(server, &grpcPayments{h: h})
+	return server
+}
+
+// SubmitPayment é o adaptador gRPC do POST /payments, sem o modo síncrono.
+// Com a fila cheia o payment ainda pode ser processado inline, como no HTTP.
+func (s *grpcPayments) SubmitPayment(ctx context.Context, req *grpcapi.PaymentRequest) (*grpcapi.SubmitPaymentResponse, error) {
+	if tracing.Enabled() {
+		var span trace.Span
+		ctx, span = startAcceptSpan(ctx, "grpc SubmitPayment", incomingHeader(ctx))
+		defer span.End()
+	}
+
+	if wait, limited := s.rateLimited(ctx); limited {
+		metrics.PaymentsRejected.Inc(metrics.ReasonRateLimited)
+		return nil, exhausted(rateLimitedMessage, wait)
+	}
+
+	payment := types.AcquirePayment()
+	copyGRPCPayment(req, payment)
+
+	result := s.h.enqueue(ctx, payment)
+	if result.queued {
+		return &grpcapi.SubmitPaymentResponse{Id: result.correlationID, Status: "accepted"}, nil
+	}
+	defer types.ReleasePayment(payment)
+
+	switch result.reason {
+	case metrics.ReasonValidation:
+		metrics.PaymentsRejected.Inc(metrics.ReasonValidation)
+		return nil, status.Error(codes.InvalidArgument, result.err.Error())
+
+	case metrics.ReasonBackpressure:
+		metrics.PaymentsRejected.Inc(metrics.ReasonBackpressure)
+		return nil, exhausted("Queue under pressure, retry later", time.Duration(result.retryAfter)*time.Second)
+
+	case metrics.ReasonDuplicate:
+		metrics.PaymentsRejected.Inc(metrics.ReasonDuplicate)
+		return nil, status.Error(codes.AlreadyExists, duplicateMessage)
+
+	default:
+		if inline, ok := s.h.processInline(ctx, payment); ok {
+			if !inline.Success {
+				return nil, status.Error(codes.Unavailable, "Payment processing failed")
+			}
+			return &grpcapi.SubmitPaymentResponse{
+				Id:          payment.CorrelationID,
+				Status:      "processed",
+				ProcessedBy: inline.ProcessorID,
+			}, nil
+		}
+		s.h.countQueueFull(ctx, result.correlationID)
+		return nil, exhausted("Service temporarily unavailable", s.h.queueFullRetryAfter())
+	}
+}
+
+// SubmitPayments enfileira os payments do stream um a um, como os itens do
+// POST /payments/batch: recusas por validação só entram no resultado e o
+// stream segue. A primeira recusa por rate limit, backpressure ou fila
+// cheia encerra o RPC com RESOURCE_EXHAUSTED, sem ler o resto do stream; o resultado até
+// ali, com o payment recusado, vai nos detalhes do status para o produtor
+// saber de onde reenviar.
+func (s *grpcPayments) SubmitPayments(stream grpc.ClientStreamingServer[grpcapi.PaymentRequest, grpcapi.SubmitPaymentsResponse]) error {
+	ctx := stream.Context()
+	if tracing.Enabled() {
+		var span trace.Span
+		ctx, span = startAcceptSpan(ctx, "grpc SubmitPayments", incomingHeader(ctx))
+		defer span.End()
+	}
+
+	response := &grpcapi.SubmitPaymentsResponse{}
+	for index := int32(0); ; index++ {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(response)
+		}
+		if err != nil {
+			return err
+		}
+
+		if wait, limited := s.rateLimited(ctx); limited {
+			metrics.PaymentsRejected.Inc(metrics.ReasonRateLimited)
+			rejection := &grpcapi.RejectedPayment{Index: index, Id: req.GetCorrelationId(), Reason: metrics.ReasonRateLimited, Error: rateLimitedMessage}
+			response.Rejected++
+			response.Rejections = append(response.Rejections, rejection)
+			message := fmt.Sprintf("%s; %d payments accepted, resend from index %d", rejection.Error, response.Accepted, index)
+			return exhausted(message, wait, response)
+		}
+
+		payment := types.AcquirePayment()
+		copyGRPCPayment(req, payment)
+
+		result := s.h.enqueue(ctx, payment)
+		if result.queued {
+			response.Accepted++
+			continue
+		}
+		types.ReleasePayment(payment)
+
+		rejection := &grpcapi.RejectedPayment{Index: index, Id: result.correlationID, Reason: result.reason}
+		response.Rejected++
+		response.Rejections = append(response.Rejections, rejection)
+
+		var wait time.Duration
+		switch result.reason {
+		case metrics.ReasonValidation:
+			metrics.PaymentsRejected.Inc(metrics.ReasonValidation)
+			rejection.Error = result.err.Error()
+			continue
+		case metrics.ReasonDuplicate:
+			metrics.PaymentsRejected.Inc(metrics.ReasonDuplicate)
+			rejection.Error = duplicateMessage
+			continue
+		case metrics.ReasonBackpressure:
+			metrics.PaymentsRejected.Inc(metrics.ReasonBackpressure)
+			rejection.Error = "Queue under pressure, retry later"
+			wait = time.Duration(result.retryAfter) * time.Second
+		default:
+			s.h.countQueueFull(ctx, result.correlationID)
+			rejection.Error = "Service temporarily unavailable"
+			wait = s.h.queueFullRetryAfter()
+		}
+		message := fmt.Sprintf("%s; %d payments accepted, resend from index %d", rejection.Error, response.Accepted, index)
+		return exhausted(message, wait, response)
+	}
+}
+
+// rateLimited cobra um token do rate limit pelo payment do peer, com o
+// X-Real-IP e o X-Forwarded-For vindos nos metadados. Sem token, retorna
+// true e a espera até o próximo.
+func (s *grpcPayments) rateLimited(ctx context.Context) (time.Duration, bool) {
+	if s.h.rateLimit == nil {
+		return 0, false
+	}
+	remoteAddr := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	client := s.h.rateLimit.clientIP(remoteAddr, firstValue(md.Get("x-real-ip")), strings.Join(md.Get("x-forwarded-for"), ","))
+	granted, wait := s.h.rateLimit.take(client, 1, time.Now())
+	return wait, granted == 0
+}
+
+// firstValue retorna o primeiro valor do metadado, ou vazio
+func firstValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// copyGRPCPayment preenche o payment do pool com a mensagem recebida, como
+// o DecodePayment faz com o JSON
+func copyGRPCPayment(req *grpcapi.PaymentRequest, payment *types.PaymentRequest) {
+	payment.CorrelationID = req.GetCorrelationId()
+	payment.Amount = int(req.GetAmount())
+	payment.Currency = req.GetCurrency()
+	payment.Description = req.GetDescription()
+	payment.Type = req.GetType()
+	payment.Metadata = req.GetMetadata()
+	payment.CallbackURL = req.GetCallbackUrl()
+}
+
+// exhausted é a recusa por backpressure ou fila cheia: RESOURCE_EXHAUSTED
+// com a espera sugerida em um RetryInfo, o equivalente ao Retry-After
+func exhausted(message string, wait time.Duration, details ...protoadapt.MessageV1) error {
+	st := status.New(codes.ResourceExhausted, message)
+	details = append([]protoadapt.MessageV1{&errdetails.RetryInfo{RetryDelay: durationpb.New(wait)}}, details...)
+	detailed, err := st.WithDetails(details...)
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// incomingHeader copia os metadados da chamada para um http.Header, que é o
+// que o tracing.Extract lê (traceparent)
+func incomingHeader(ctx context.Context) http.Header {
+	md, _ := metadata.FromIncomingContext(ctx)
+	header := make(http.Header, len(md))
+	for key, values := range md {
+		header[http.CanonicalHeaderKey(key)] = values
+	}
+	return header
+}
+
+// recoverUnary faz o mesmo que o Recover nas chamadas unárias: conta e loga
+// o pânico e responde INTERNAL, mantendo o servidor de pé
+func recoverUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			logGRPCPanic(ctx, v, info.FullMethod)
+			err = status.Error(codes.Internal, "internal server error")
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// recoverStream é o recoverUnary das chamadas com stream
+func recoverStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			logGRPCPanic(ss.Context(), v, info.FullMethod)
+			err = status.Error(codes.Internal, "internal server error")
+		}
+	}()
+	return handler(srv, ss)
+}
+
+// logGRPCPanic conta e loga o pânico de um handler gRPC com a pilha
+func logGRPCPanic(ctx context.Context, v any, method string) {
+	remoteAddr := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+	metrics.Panics.Inc(metrics.PanicGRPC)
+	slog.ErrorContext(ctx, "grpc handler panic recovered",
+		"method", method,
+		"remote_addr", remoteAddr,
+		"panic", fmt.Sprint(v),
+		"stack", string(debug.Stack()))
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"sync"
+)
+
+// gzipWriterPool reaproveita os compressores, que alocam centenas de KB
+// cada; BestSpeed porque o summary é consultado a cada segundo
+var gzipWriterPool = sync.Pool{
+	New: func() any {
+		zw, _ := gzip.NewWriterLevel(nil, gzip.BestSpeed)
+		return zw
+	},
+}
+
+// EnableGzip comprime com gzip as respostas JSON do summary e dos endpoints
+// de admin a partir de minBytes, quando o cliente aceita (Accept-Encoding).
+// O POST /payments nunca é comprimido.
+func (h *PaymentHandler) EnableGzip(minBytes int) {
+	h.gzipMinBytes = max(minBytes, 1)
+}
+
+// compressible envolve o responder de um endpoint que pode responder
+// comprimido; com o gzip desligado retorna o próprio responder
+func (h *PaymentHandler) compressible(res responder, acceptEncoding string) responder {
+	if h.gzipMinBytes == 0 {
+		return res
+	}
+	return gzipResponder{responder: res, minBytes: h.gzipMinBytes, accepts: acceptsGzip(acceptEncoding)}
+}
+
+// gzipResponder comprime os corpos JSON a partir de minBytes. Vary vai em
+// toda resposta, comprimida ou não, para caches não servirem gzip a quem
+// não pediu. Erros passam sem compressão.
+type gzipResponder struct {
+	responder
+	minBytes int
+	accepts  bool
+}
+
+// JSON comprime o corpo em um buffer do pool quando ele passa do limite
+func (r gzipResponder) JSON(status int, body []byte) {
+	r.compress(status, body, r.responder.JSON)
+}
+
+// Body comprime como o JSON, mantendo o Content-Type do formato
+func (r gzipResponder) Body(status int, contentType string, body []byte) {
+	r.compress(status, body, func(status int, body []byte) {
+		r.responder.Body(status, contentType, body)
+	})
+}
+
+// compress escreve o corpo com write, comprimido se passar do limite
+func (r gzipResponder) compress(status int, body []byte, write func(status int, body []byte)) {
+	r.responder.AddHeader("Vary", "Accept-Encoding")
+	if !r.accepts || len(body) < r.minBytes {
+		write(status, body)
+		return
+	}
+
+	buf := responsePool.Get().(*bytes.Buffer)
+	buf.Reset()
+	zw := gzipWriterPool.Get().(*gzip.Writer)
+	zw.Reset(buf)
+
+	zw.Write(body)
+	zw.Close()
+	r.responder.SetHeader("Content-Encoding", "gzip")
+	write(status, buf.Bytes())
+
+	gzipWriterPool.Put(zw)
+	responsePool.Put(buf)
+}
+
+// acceptsGzip indica se o Accept-Encoding aceita gzip: uma entrada gzip
+// decide; sem ela vale a entrada "*". q=0 recusa. Não há outras
+// codificações, então as preferências entre elas não importam.
+func acceptsGzip(header string) bool {
+	wildcard := false
+	for header != "" {
+		var part string
+		part, header, _ = strings.Cut(header, ",")
+		coding, params, _ := strings.Cut(part, ";")
+		switch coding = strings.TrimSpace(coding); {
+		case strings.EqualFold(coding, "gzip"):
+			return !isZeroQuality(params)
+		case coding == "*":
+			wildcard = !isZeroQuality(params)
+		}
+	}
+	return wildcard
+}
+
+// isZeroQuality indica se os parâmetros de uma codificação trazem q=0
+func isZeroQuality(params string) bool {
+	key, value, ok := strings.Cut(params, "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(key), "q") {
+		return false
+	}
+	value = strings.TrimRight(strings.TrimSpace(value), "0")
+	return value == "" || value == "0."
+}
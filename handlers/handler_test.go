@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/config"
+	"github.com/yurimachados/rinha-backend-go/store"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// validPayment é um corpo aceito pelo POST /payments
+const validPayment = `{"amount":100,"type":"credit"}`
+
+// duplicatePayment é um payment com correlationId fixo: o segundo envio
+// enquanto o primeiro está na fila é recusado
+const duplicatePayment = `{"correlationId":"4a7901b8-7d26-4d9d-aa19-4dc1c7cf60b3","amount":100,"type":"credit"}`
+
+// newFakeProcessor sobe um processador que aceita todo payment com 200
+func newFakeProcessor(t testing.TB) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message":"payment processed successfully"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// testConfig é a configuração padrão apontando os dois processadores para
+// servidores de teste, sem snapshot do summary em disco
+func testConfig(t testing.TB) config.Config {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Processors.DefaultURL = newFakeProcessor(t).URL + "/payments"
+	cfg.Processors.FallbackURL = newFakeProcessor(t).URL + "/payments"
+	cfg.Processors.Snapshot = false
+	return cfg
+}
+
+// newTestHandler cria o handler com as rotas registradas; os workers param
+// no fim do teste
+func newTestHandler(t testing.TB, cfg config.Config, setup ...func(*PaymentHandler)) (*PaymentHandler, *http.ServeMux) {
+	t.Helper()
+	h := NewPaymentHandler(cfg, store.NewMemoryStore(store.MemoryOptions{
+		Capacity:        store.DefaultCapacity,
+		BucketRetention: store.DefaultBucketRetention,
+	}))
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		h.Stop(ctx)
+	})
+	for _, fn := range setup {
+		fn(h)
+	}
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	return h, mux
+}
+
+// serve executa a requisição no handler e retorna a resposta gravada
+func serve(handler http.Handler, method, target, body string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// errorCode decodifica o envelope de erro da API e retorna o código,
+// falhando o teste se o corpo não for um envelope
+func errorCode(t *testing.T, body []byte) string {
+	t.Helper()
+	var resp types.ErrorResponse
+	if err := json.Unmarshal(body, &resp); err != nil || resp.Error.Code == "" || resp.Error.Message == "" {
+		t.Fatalf("body %s is not an error envelope", body)
+	}
+	return resp.Error.Code
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+)
+
+// codeOverloaded é o erro das requisições recusadas pelo InFlightLimiter
+const codeOverloaded = "overloaded"
+
+// InFlightLimiter limita as requisições em andamento com um semáforo. Com
+// o limite atingido a requisição é recusada com 503 antes de qualquer
+// trabalho (inclusive ler o corpo, no net/http), ou espera até wait por uma
+// vaga. Health check, métricas e o stream de eventos, que fica aberto e tem
+// o próprio limite, não passam pelo semáforo.
+type InFlightLimiter struct {
+	slots    chan struct{}
+	wait     time.Duration
+	inFlight atomic.Int64
+}
+
+// NewInFlightLimiter cria o limitador com maxInFlight vagas e registra o
+// gauge rinha_http_in_flight; wait zero recusa sem esperar
+func NewInFlightLimiter(maxInFlight int, wait time.Duration) *InFlightLimiter {
+	l := &InFlightLimiter{
+		slots: make(chan struct{}, maxInFlight),
+		wait:  max(wait, 0),
+	}
+	metrics.RegisterGauge("rinha_http_in_flight", "Requisições em andamento sob o limite de simultâneas.", "", func() float64 {
+		return float64(l.inFlight.Load())
+	})
+	return l
+}
+
+// Wrap envolve um handler net/http; com o limitador nil retorna o próprio
+// handler
+func (l *InFlightLimiter) Wrap(next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if exemptFromInFlight(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !l.acquire(r.Context().Done()) {
+			l.reject(httpResponder{w})
+			return
+		}
+		defer l.release()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WrapFastHTTP envolve o handler do fasthttp; com o limitador nil retorna o
+// próprio handler. O fasthttp já leu o corpo quando o handler roda, então
+// aqui o limite poupa o decode e o trabalho seguinte.
+func (l *InFlightLimiter) WrapFastHTTP(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	if l == nil {
+		return next
+	}
+
+	return func(ctx *fasthttp.RequestCtx) {
+		if exemptFromInFlight(string(ctx.Path())) {
+			next(ctx)
+			return
+		}
+		if !l.acquire(ctx.Done()) {
+			l.reject(fastResponder{ctx})
+			return
+		}
+		defer l.release()
+
+		next(ctx)
+	}
+}
+
+// exemptFromInFlight indica as rotas que não ocupam vaga
+func exemptFromInFlight(path string) bool {
+	switch path {
+	case "/health", "/livez", "/readyz", "/metrics", "/payments/events":
+		return true
+	}
+	return false
+}
+
+// acquire reserva uma vaga, esperando até wait se configurado; done
+// interrompe a espera (cliente desistiu, no net/http, ou servidor parando,
+// no fasthttp)
+func (l *InFlightLimiter) acquire(done <-chan struct{}) bool {
+	select {
+	case l.slots <- struct{}{}:
+		l.inFlight.Add(1)
+		return true
+	default:
+	}
+	if l.wait == 0 {
+		return false
+	}
+
+	timer := time.NewTimer(l.wait)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		l.inFlight.Add(1)
+		return true
+	case <-timer.C:
+		return false
+	case <-done:
+		return false
+	}
+}
+
+func (l *InFlightLimiter) release() {
+	l.inFlight.Add(-1)
+	<-l.slots
+}
+
+// reject recusa a requisição com 503 e Retry-After
+func (l *InFlightLimiter) reject(res responder) {
+	metrics.HTTPShed.Inc()
+	res.SetHeader("Retry-After", "1")
+	res.Error(http.StatusServiceUnavailable, codeOverloaded, "Server overloaded, retry later")
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// inlineTimeout limita o processamento síncrono: uma tentativa no default e
+// outra no fallback cabem no prazo, mas a requisição não fica presa além disso
+const inlineTimeout = 600 * time.Millisecond
+
+// EnableInlineFallback faz o POST /payments processar o payment na própria
+// requisição quando a fila está cheia, em vez de responder 503. No máximo
+// maxConcurrent payments são processados assim ao mesmo tempo.
+func (h *PaymentHandler) EnableInlineFallback(maxConcurrent int) {
+	if maxConcurrent <= 0 {
+		return
+	}
+	h.inlineSlots = make(chan struct{}, maxConcurrent)
+}
+
+// processInline tenta processar o payment de forma síncrona. handled é
+// false quando o modo está desligado, não há vaga no semáforo ou o
+// processamento está pausado, e então cabe ao chamador recusar o payment.
+func (h *PaymentHandler) processInline(ctx context.Context, payment *types.PaymentRequest) (result *types.ProcessorResult, handled bool) {
+	if h.inlineSlots == nil || h.workerPool.Paused() {
+		return nil, false
+	}
+
+	select {
+	case h.inlineSlots <- struct{}{}:
+		defer func() { <-h.inlineSlots }()
+	default:
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, inlineTimeout)
+	defer cancel()
+
+	// Mesmo roteamento e contabilização do caminho pela fila
+	result = h.processNow(ctx, payment)
+	metrics.PaymentsInline.Inc()
+	h.paymentTypes.count(payment.Type)
+
+	if !result.Success {
+		if ok, n := logging.DefaultSampler().Allow("inline_failed:" + result.Reason); ok {
+			h.logger.ErrorContext(ctx, "inline payment processing failed",
+				logging.KeyCorrelationID, payment.CorrelationID,
+				logging.KeyReason, result.Reason,
+				logging.KeyOccurrences, n)
+		}
+	}
+	return result, true
+}
+
+// processNow processa o payment na requisição, inline ou sync, registrando
+// os estados que o worker registraria
+func (h *PaymentHandler) processNow(ctx context.Context, payment *types.PaymentRequest) *types.ProcessorResult {
+	lifecycle := h.workerPool.Lifecycle()
+	lifecycle.Processing(payment.CorrelationID)
+
+	result := h.processor.ProcessPayment(ctx, payment)
+	if result.Success {
+		lifecycle.Succeeded(payment.CorrelationID, result.ProcessorID)
+	} else {
+		lifecycle.Failed(payment.CorrelationID, result.Reason)
+	}
+	return result
+}
+
+// writeInlineResult responde ao payment processado de forma síncrona
+func (h *PaymentHandler) writeInlineResult(res responder, payment *types.PaymentRequest, result *types.ProcessorResult) {
+	if !result.Success {
+		res.Error(http.StatusBadGateway, codeProcessingFailed, "Payment processing failed")
+		return
+	}
+
+	writeJSON(res, http.StatusOK, types.PaymentResponse{
+		ID:          payment.CorrelationID,
+		Status:      "processed",
+		ProcessedBy: result.ProcessorID,
+	})
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/store"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// Tamanho da página do GET /payments: listLimit sem ?limit e no máximo
+// maxListLimit, mesmo pedindo mais
+const (
+	listLimit    = 100
+	maxListLimit = 1000
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// paymentList é a resposta do GET /payments. nextCursor some na última
+// página.
+type paymentList struct {
+	Payments   []listedPayment `json:"payments"`
+	NextCursor string          `json:"nextCursor,omitempty"`
+}
+
+// listedPayment é um registro do store. O store só guarda os payments
+// processados com sucesso, então o status é sempre succeeded.
+type listedPayment struct {
+	store.Payment
+	Status string `json:"status"`
+}
+
+// encodeCursor torna a posição opaca para o cliente: requestedAt em
+// UnixNano e correlationId, em base64 para URL
+func encodeCursor(c store.Cursor) string {
+	raw := strconv.FormatInt(c.RequestedAt.UnixNano(), 10) + ":" + c.CorrelationID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(value string) (store.Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return store.Cursor{}, errInvalidCursor
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if !ok || err != nil || id == "" {
+		return store.Cursor{}, errInvalidCursor
+	}
+	return store.Cursor{RequestedAt: time.Unix(0, n).UTC(), CorrelationID: id}, nil
+}
+
+// GetPayments lista os payments do store do mais recente ao mais antigo
+// por requestedAt, em páginas de ?limit; o nextCursor de uma página vai no
+// ?cursor da seguinte. Store vazio responde uma lista vazia.
+func (h *PaymentHandler) GetPayments(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := listLimit
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, codeInvalidParameter, "Invalid limit")
+			return
+		}
+		limit = min(n, maxListLimit)
+	}
+	var after store.Cursor
+	if raw := query.Get("cursor"); raw != "" {
+		cursor, err := decodeCursor(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidParameter, "Invalid cursor")
+			return
+		}
+		after = cursor
+	}
+
+	// Um a mais que a página diz se há uma próxima
+	payments, err := h.store.List(r.Context(), after, limit+1)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "failed to list payments", "error", err)
+		writeError(w, http.StatusInternalServerError, codeInternal, "Internal server error")
+		return
+	}
+
+	list := paymentList{Payments: make([]listedPayment, 0, min(len(payments), limit))}
+	for i, p := range payments {
+		if i == limit {
+			list.NextCursor = encodeCursor(store.CursorOf(payments[limit-1]))
+			break
+		}
+		list.Payments = append(list.Payments, listedPayment{Payment: withoutRawReceipt(p), Status: types.StatusSucceeded})
+	}
+
+	res := h.compressible(httpResponder{w}, r.Header.Get("Accept-Encoding"))
+	writeJSON(res, http.StatusOK, list)
+}
@@ -1,14 +1,27 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
-	"fmt"
+	"errors"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/yurimachados/rinha-backend-go/cluster"
+	"github.com/yurimachados/rinha-backend-go/config"
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/metrics"
 	"github.com/yurimachados/rinha-backend-go/queue"
+	"github.com/yurimachados/rinha-backend-go/store"
+	"github.com/yurimachados/rinha-backend-go/tracing"
 	"github.com/yurimachados/rinha-backend-go/types"
 )
 
@@ -16,91 +29,545 @@ import (
 type PaymentHandler struct {
 	processor      *queue.PaymentProcessor
 	workerPool     *queue.WorkerPool
+	store          store.Store
+	shared         *store.SharedSummary
+	node           *cluster.Node // coordenação entre instâncias (opcional)
+	peers          []string      // rotas internas de summary das instâncias irmãs
+	peerClient     *http.Client
+	inlineSlots    chan struct{} // vagas do processamento síncrono (opcional)
+	syncSlots      chan struct{} // vagas do ?sync=true (opcional)
+	syncTimeout    time.Duration
+	admission      *admission  // recusa antecipada com a fila quase cheia (opcional)
+	cpuShed        *cpuShedder // recusa com a CPU perto do limite (opcional)
+	ready          *readiness  // prontidão do /readyz
+	reportPath     string      // SHUTDOWN_REPORT_FILE (opcional)
+	reportOnce     sync.Once
+	maxBodyBytes   int64
+	maxBatchItems  int
+	maxBatchBytes  int64 // limite do corpo do POST /payments/batch
+	logger         *slog.Logger
 	requestCounter int64
+	paymentTypes   *paymentTypes // lista de PAYMENT_TYPES e contadores por type
+
+	strictContentType bool         // recusa o ingest sem Content-Type
+	gzipMinBytes      int          // respostas comprimidas a partir deste tamanho; 0 desliga
+	cors              *cors        // headers CORS por rota (opcional)
+	rateLimit         *rateLimiter // token bucket por IP no POST /payments (opcional)
+	routeLatency      *RouteLatency
+	expvar            bool // serve /debug/vars
+
+	ingressBase atomic.Pointer[types.IngressStats] // contadores de entrada no último reset; nil sem reset
 }
 
-// NewPaymentHandler cria um novo handler otimizado
-func NewPaymentHandler(defaultURL, fallbackURL string) *PaymentHandler {
-	processor := queue.NewPaymentProcessor(defaultURL, fallbackURL)
-	workerPool := queue.NewWorkerPool(processor, 20000) // fila de 20k para alta carga
+// errCallbacksDisabled recusa callbackUrl quando os callbacks estão desligados
+var errCallbacksDisabled = errors.New("callbackUrl is not enabled on this server")
+
+// duplicateMessage acompanha o 409 duplicate_payment
+const duplicateMessage = "Payment already queued, processing or processed"
+
+// NewPaymentHandler cria um novo handler otimizado a partir da configuração
+// já validada. Com RedisURL preenchida os contadores do summary são
+// compartilhados entre instâncias via Redis e, se QueueBackend for "redis",
+// a fila também passa a ser durável no Redis.
+func NewPaymentHandler(cfg config.Config, paymentStore store.Store) *PaymentHandler {
+	redisURL := cfg.RedisURL
+	processor := queue.NewPaymentProcessor(cfg.Processors, paymentStore)
+	backend := newQueueBackend(redisURL, cfg.QueueBackend, cfg.Pool)
+	workerPool := queue.NewWorkerPool(processor, backend, cfg.Pool)
 
 	handler := &PaymentHandler{
-		processor:  processor,
-		workerPool: workerPool,
+		processor:    processor,
+		workerPool:   workerPool,
+		store:        paymentStore,
+		logger:       slog.Default(),
+		maxBodyBytes: cfg.Ingest.MaxBodyBytes,
+		paymentTypes: newPaymentTypes(cfg.PaymentTypes),
+
+		maxBatchItems:     cfg.Ingest.MaxBatchItems,
+		maxBatchBytes:     cfg.Ingest.MaxBatchBodyBytes,
+		strictContentType: cfg.Ingest.ContentTypeMode == "strict",
+		routeLatency:      NewRouteLatency(),
+		ready:             newReadiness(cfg.Server),
+		reportPath:        cfg.Server.ShutdownReportFile,
+	}
+
+	if redisURL != "" {
+		shared, err := store.NewSharedSummary(redisURL)
+		if err != nil {
+			slog.Warn("invalid REDIS_URL, using local counters", "error", err)
+		} else {
+			processor.UseSharedSummary(shared)
+			handler.shared = shared
+		}
+
+		// Liderança expira em dois intervalos sem renovação
+		node, err := cluster.NewNode(redisURL, 2*queue.ServiceHealthInterval)
+		if err == nil {
+			handler.node = node
+		}
 	}
 
+	processor.RegisterMetrics()
+	workerPool.RegisterMetrics()
+
+	// Summary restaurado do snapshot antes do primeiro payment
+	processor.StartSnapshots()
+
 	// Iniciar pool de workers
 	workerPool.Start()
 
 	return handler
 }
 
-// PostPayments endpoint otimizado para receber payments
+// RouteLatency retorna o medidor de duração por rota, que o servidor HTTP
+// coloca em volta dos handlers
+func (h *PaymentHandler) RouteLatency() *RouteLatency {
+	return h.routeLatency
+}
+
+// UseProcessorBulk liga o envio em lote aos processadores que têm endpoint
+// de lote; deve ser chamado antes de o servidor aceitar requisições
+func (h *PaymentHandler) UseProcessorBulk(cfg queue.BulkConfig) {
+	h.processor.UseBulk(cfg)
+}
+
+// EnableCallbacks passa a aceitar callbackUrl nos payments e a avisá-lo ao
+// fim do processamento; deve ser chamado antes de o servidor aceitar
+// requisições
+func (h *PaymentHandler) EnableCallbacks(cfg queue.CallbackConfig) {
+	h.workerPool.UseCallbacks(cfg)
+}
+
+// EnableFailureJournal passa a gravar em arquivo os payments abandonados
+// pelos workers; deve ser chamado antes de o servidor aceitar requisições
+func (h *PaymentHandler) EnableFailureJournal(cfg queue.JournalConfig) error {
+	sink, err := queue.OpenFileJournal(cfg.Path, cfg.MaxBytes, cfg.Retain)
+	if err != nil {
+		return err
+	}
+	h.workerPool.UseFailureJournal(sink, cfg)
+	return nil
+}
+
+// newQueueBackend escolhe a fila: ring buffer em memória por padrão, com duas
+// classes de prioridade se configurada, ou Redis
+func newQueueBackend(redisURL, queueBackend string, poolConfig queue.PoolConfig) queue.Backend {
+	queueSize := poolConfig.QueueSize
+
+	if queueBackend == "redis" {
+		if redisURL == "" {
+			slog.Warn("QUEUE_BACKEND=redis requires REDIS_URL, using in-memory queue")
+		} else {
+			backend, err := queue.NewRedisBackend(redisURL, queueSize)
+			if err == nil {
+				slog.Info("durable redis queue enabled")
+				if poolConfig.PriorityThreshold > 0 {
+					slog.Warn("priority queue requires the in-memory queue, ignoring PRIORITY_AMOUNT_THRESHOLD")
+				}
+				return backend
+			}
+			slog.Warn("failed to start redis queue, using in-memory queue", "error", err)
+		}
+	}
+
+	if poolConfig.PriorityThreshold > 0 {
+		slog.Info("priority queue enabled",
+			"threshold", poolConfig.PriorityThreshold,
+			"max_wait_ms", poolConfig.PriorityMaxWait.Milliseconds())
+		return queue.NewPriorityBackend(queueSize, poolConfig.PriorityThreshold, poolConfig.PriorityMaxWait)
+	}
+	return queue.NewRingBackend(queueSize)
+}
+
+// PostPayments endpoint otimizado para receber payments (adaptador net/http)
 func (h *PaymentHandler) PostPayments(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	res := httpResponder{w}
+	if h.limited(res, r.RemoteAddr, r.Header.Get("X-Real-IP"), r.Header.Get("X-Forwarded-For")) {
+		return
+	}
+	if h.cpuShedding(res) {
 		return
 	}
 
-	// Parse JSON eficiente
-	var payment types.PaymentRequest
-	decoder := json.NewDecoder(r.Body)
-	decoder.DisallowUnknownFields() // performance
+	// Span do aceite, continuando o traceparent recebido (apenas com tracing ativo)
+	ctx := r.Context()
+	if tracing.Enabled() {
+		var span trace.Span
+		ctx, span = startAcceptSpan(ctx, "POST /payments", r.Header)
+		defer span.End()
+	}
 
-	if err := decoder.Decode(&payment); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	in, ok := h.requestCodec(r.Header.Get("Content-Type"))
+	if !ok {
+		h.rejectUnsupportedMediaType(res, codecMediaTypes)
 		return
 	}
 
-	// Validação rápida
-	if err := payment.Validate(); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	// Limitar o corpo antes de decodificar; o Content-Length declarado não é
+	// confiável, o limite vale para os bytes efetivamente lidos
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBodyBytes)
+
+	// Ler o corpo em um buffer do pool
+	body := bodyPool.Get().(*bytes.Buffer)
+	body.Reset()
+	defer bodyPool.Put(body)
+
+	if _, err := body.ReadFrom(r.Body); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			// O MaxBytesReader já marca a conexão para fechar após a resposta
+			h.rejectTooLarge(res, tooLarge.Limit)
+			return
+		}
+		h.rejectInvalidJSON(res)
 		return
 	}
 
-	// Enfileirar de forma não-bloqueante usando WorkerPool
-	if h.workerPool.Submit(&payment) {
+	h.ingest(ctx, in, body.Bytes(), res, wantsSync(r.URL.Query().Get("sync"), r.Header.Get("X-Sync")))
+}
+
+// startAcceptSpan abre o span do aceite continuando o traceparent recebido
+func startAcceptSpan(ctx context.Context, name string, header http.Header) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(tracing.Extract(ctx, header), name,
+		trace.WithSpanKind(trace.SpanKindServer))
+}
+
+// ingest é o núcleo do POST /payments, independente do servidor HTTP:
+// decodifica com o formato do Content-Type, valida, enfileira e responde.
+// Com sync o payment é processado na requisição se houver vaga.
+func (h *PaymentHandler) ingest(ctx context.Context, in codec, body []byte, res responder, sync bool) {
+	// O payment vem do pool. Depois de enfileirado ele pertence à fila, que o
+	// devolve ao pool ao fim do processamento; nos demais caminhos volta aqui.
+	payment := types.AcquirePayment()
+	queued := false
+	defer func() {
+		if !queued {
+			types.ReleasePayment(payment)
+		}
+	}()
+
+	// Decodificar com o codec do formato; daqui em diante o caminho é o
+	// mesmo para todos
+	if err := in.DecodePayment(body, payment); err != nil {
+		h.rejectInvalidPayment(res, in, err)
+		return
+	}
+
+	if sync {
+		if h.ingestSync(ctx, payment, res) {
+			return
+		}
+		res.SetHeader(processingModeHeader, "async")
+	}
+
+	result := h.enqueue(ctx, payment)
+	queued = result.queued
+
+	switch result.reason {
+	case "":
 		// Sucesso - responder imediatamente
-		requestID := atomic.AddInt64(&h.requestCounter, 1)
+		writeAccepted(res, result.correlationID)
+
+	case metrics.ReasonValidation:
+		metrics.PaymentsRejected.Inc(metrics.ReasonValidation)
+		res.Error(http.StatusBadRequest, validationCode(result.err), result.err.Error())
+
+	case metrics.ReasonBackpressure:
+		h.rejectBackpressure(res, result.retryAfter)
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusAccepted)
+	case metrics.ReasonDuplicate:
+		metrics.PaymentsRejected.Inc(metrics.ReasonDuplicate)
+		res.Error(http.StatusConflict, metrics.ReasonDuplicate, duplicateMessage)
 
-		response := map[string]interface{}{
-			"id":      fmt.Sprintf("req_%d_%d", time.Now().Unix(), requestID),
-			"status":  "accepted",
-			"message": "Payment queued for processing",
+	default:
+		// Fila cheia - processar na requisição, se habilitado
+		if inline, ok := h.processInline(ctx, payment); ok {
+			h.writeInlineResult(res, payment, inline)
+			return
 		}
 
-		json.NewEncoder(w).Encode(response)
+		// Sem vaga para processar inline - rejeitar
+		h.countQueueFull(ctx, result.correlationID)
+		h.rejectQueueFull(res, h.queueFullRetryAfter())
+	}
+}
+
+// enqueueResult é o desfecho do enqueue de um payment
+type enqueueResult struct {
+	correlationID string // copiado: enfileirado, o payment pode voltar ao pool
+	queued        bool
+	reason        string // motivo da recusa (metrics.Reason*); vazio se enfileirado
+	err           error  // erro de validação
+	retryAfter    int    // segundos, na recusa por backpressure
+}
 
+// enqueue valida, identifica e enfileira um payment já decodificado; é o
+// caminho comum ao POST /payments e ao lote. Só o aceite é contabilizado
+// aqui, a recusa fica com o chamador, que decide como responder. Com queued
+// o payment pertence à fila e não deve mais ser acessado.
+func (h *PaymentHandler) enqueue(ctx context.Context, payment *types.PaymentRequest) enqueueResult {
+	if err := h.prepare(payment); err != nil {
+		return enqueueResult{reason: metrics.ReasonValidation, err: err}
+	}
+
+	// Copiado antes do Submit: enfileirado, o payment pode ser processado e
+	// devolvido ao pool antes da resposta ser escrita
+	result := enqueueResult{correlationID: payment.CorrelationID}
+
+	// Backpressure: com a fila acima do high watermark parte dos payments
+	// é recusada com 429 antes de chegar ao 503 da fila cheia
+	if h.admission != nil {
+		if retryAfter, ok := h.admission.admit(h.workerPool.GetQueueSize(), h.workerPool.GetQueueCapacity()); !ok {
+			result.reason = metrics.ReasonBackpressure
+			result.retryAfter = retryAfter
+			return result
+		}
+	}
+
+	// Enfileirar de forma não-bloqueante usando WorkerPool
+	paymentType := payment.Type
+	var err error
+	if tracing.Enabled() {
+		err = h.workerPool.SubmitTraced(ctx, payment)
+		trace.SpanFromContext(ctx).AddEvent("queue decision",
+			trace.WithAttributes(attribute.Bool("payment.queued", err == nil)))
 	} else {
-		// Fila cheia - rejeitar
-		http.Error(w, "Service temporarily unavailable", http.StatusServiceUnavailable)
+		err = h.workerPool.Submit(ctx, payment)
 	}
+
+	// Um correlationId ainda na fila, em processamento ou já processado não
+	// entra de novo; as demais recusas são a da fila cheia
+	var transition *queue.TransitionError
+	switch {
+	case errors.As(err, &transition):
+		result.reason = metrics.ReasonDuplicate
+		return result
+	case err != nil:
+		result.reason = metrics.ReasonQueueFull
+		return result
+	}
+	result.queued = true
+
+	metrics.PaymentsAccepted.Inc()
+	h.paymentTypes.count(paymentType)
+	return result
+}
+
+// prepare normaliza, valida e identifica o payment (correlationId e
+// requestedAt); é o início comum da fila e do processamento síncrono
+func (h *PaymentHandler) prepare(payment *types.PaymentRequest) error {
+	// Validação rápida, sobre o description já limpo
+	payment.Normalize()
+	if err := payment.Validate(); err != nil {
+		return err
+	}
+	if err := h.paymentTypes.normalize(payment); err != nil {
+		return err
+	}
+	payment.Currency = types.NormalizeCurrency(payment.Currency)
+	if payment.CallbackURL != "" && !h.workerPool.CallbacksEnabled() {
+		return errCallbacksDisabled
+	}
+
+	requestID := atomic.AddInt64(&h.requestCounter, 1)
+	if payment.CorrelationID == "" {
+		payment.CorrelationID = newCorrelationID(time.Now(), requestID)
+	}
+	payment.RequestedAt = h.processor.RequestedAt()
+	return nil
+}
+
+// countQueueFull contabiliza e loga (amostrado) a recusa por fila cheia
+func (h *PaymentHandler) countQueueFull(ctx context.Context, correlationID string) {
+	metrics.PaymentsRejected.Inc(metrics.ReasonQueueFull)
+	if ok, n := logging.DefaultSampler().Allow("queue_full"); ok {
+		h.logger.WarnContext(ctx, "queue full, payment rejected",
+			logging.KeyCorrelationID, correlationID,
+			logging.KeyQueueDepth, h.workerPool.GetQueueSize(),
+			logging.KeyOccurrences, n)
+	}
+}
+
+// rejectInvalidJSON recusa corpos ilegíveis ou que não são um payment
+func (h *PaymentHandler) rejectInvalidJSON(res responder) {
+	metrics.PaymentsRejected.Inc(metrics.ReasonInvalidJSON)
+	res.Error(http.StatusBadRequest, metrics.ReasonInvalidJSON, "Invalid JSON")
 }
 
-// GetPaymentsSummary endpoint para estatísticas
+// rejectInvalidPayment recusa um payment que o decoder não aceitou,
+// dizendo o campo quando o erro é de um campo. O código é invalid_json em
+// qualquer formato, por ser estável para os clientes.
+func (h *PaymentHandler) rejectInvalidPayment(res responder, in codec, err error) {
+	metrics.PaymentsRejected.Inc(metrics.ReasonInvalidJSON)
+	res.Error(http.StatusBadRequest, metrics.ReasonInvalidJSON, in.InvalidMessage(err))
+}
+
+// rejectTooLarge recusa corpos acima do limite com 413 em JSON
+func (h *PaymentHandler) rejectTooLarge(res responder, limit int64) {
+	metrics.PaymentsRejected.Inc(metrics.ReasonBodyTooLarge)
+	res.Error(http.StatusRequestEntityTooLarge, metrics.ReasonBodyTooLarge,
+		"request body exceeds "+strconv.FormatInt(limit, 10)+" bytes")
+}
+
+// GetPaymentsSummary endpoint para estatísticas (adaptador net/http)
 func (h *PaymentHandler) GetPaymentsSummary(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	h.summary(r.Context(), r.URL.Query(), h.compressible(httpResponder{w}, r.Header.Get("Accept-Encoding")),
+		responseCodec(r.Header.Get("Accept")))
+}
+
+// summary é o núcleo do GET /payments-summary, independente do servidor
+// HTTP; out é o formato negociado pelo Accept
+func (h *PaymentHandler) summary(ctx context.Context, query url.Values, res responder, out codec) {
+	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+
+	// Com groupBy, o summary vem por intervalo, também do store
+	if query.Has("groupBy") {
+		h.getBucketSummary(ctx, res, out, query)
+		return
+	}
+
+	// Com from/to o summary é calculado a partir do store
+	if query.Has("from") || query.Has("to") {
+		h.getRangeSummary(ctx, res, out, query.Get("from"), query.Get("to"))
+		return
+	}
+
+	var summary *types.PaymentSummary
+	if len(h.peers) > 0 {
+		summary = h.mergedSummary(ctx)
+	} else {
+		summary = h.processor.GetSummary(ctx)
+	}
+
+	// Estatísticas detalhadas são sempre da instância que respondeu
+	if query.Get("detailed") == "true" {
+		summary.Detail = &types.SummaryDetail{
+			Latency:   h.processor.LatencyStats(),
+			Pool:      h.workerPool.Stats(),
+			Ingress:   h.windowIngress(),
+			QueueWait: h.workerPool.QueueWaitStats(),
+			Events:    h.workerPool.Events().Stats(),
+			Panics:    metrics.Panics.Values(),
+			Routes:    h.routeLatency.stats(),
+			Amounts:   h.processor.AmountStats(),
+			DNS:       h.processor.DNSStats(),
+			Routing:   h.processor.RoutingStats(),
+		}
+		if h.rateLimit != nil {
+			summary.Detail.RateLimit = h.rateLimit.stats()
+		}
+		if h.cpuShed != nil {
+			summary.Detail.CPUShed = h.cpuShed.stats()
+		}
+	}
+
+	writeEncoded(res, out, http.StatusOK, summary)
+}
+
+// ingressStats lê os contadores de entrada do POST /payments
+func ingressStats() types.IngressStats {
+	return types.IngressStats{
+		Accepted: metrics.PaymentsAccepted.Value(),
+		Inline:   metrics.PaymentsInline.Value(),
+		Sync:     metrics.PaymentsSync.Value(),
+		Rejected: metrics.PaymentsRejected.Values(),
+		ByType:   metrics.PaymentsByType.Values(),
+	}
+}
+
+// getRangeSummary agrega os payments com requestedAt em [from, to]. O store
+// registra apenas sucessos, então total_errors não se aplica ao intervalo.
+func (h *PaymentHandler) getRangeSummary(ctx context.Context, res responder, out codec, fromParam, toParam string) {
+	from, err := parseTimeParam(fromParam)
+	if err != nil {
+		res.Error(http.StatusBadRequest, codeInvalidParameter, "Invalid from")
+		return
+	}
+	to, err := parseTimeParam(toParam)
+	if err != nil {
+		res.Error(http.StatusBadRequest, codeInvalidParameter, "Invalid to")
 		return
 	}
 
-	summary := h.processor.GetSummary()
+	totals, err := h.store.Aggregate(ctx, from, to)
+	if err != nil {
+		h.logger.Error("failed to aggregate payments", "error", err)
+		res.Error(http.StatusServiceUnavailable, codeSummaryUnavailable, "Summary unavailable")
+		return
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(summary)
+	summary := &types.PaymentSummary{
+		DefaultSuccess:  totals["default"].TotalRequests,
+		FallbackSuccess: totals["fallback"].TotalRequests,
+		DefaultAmount:   totals["default"].TotalAmount,
+		FallbackAmount:  totals["fallback"].TotalAmount,
+	}
+	summary.TotalPayments = summary.DefaultSuccess + summary.FallbackSuccess
+	for code, amount := range totals["default"].Currencies {
+		summary.AddCurrencies(map[string]types.CurrencyAmounts{code: {DefaultAmount: amount}})
+	}
+	for code, amount := range totals["fallback"].Currencies {
+		summary.AddCurrencies(map[string]types.CurrencyAmounts{code: {FallbackAmount: amount}})
+	}
+
+	writeEncoded(res, out, http.StatusOK, summary)
+}
+
+// parseTimeParam converte um parâmetro RFC 3339, vazio significa sem limite
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
 }
 
-// StartHealthChecker inicia verificação de saúde dos processadores
+// StartHealthChecker inicia verificação de saúde dos processadores, o
+// ajuste do timeout adaptativo e a nova resolução dos hosts no cache de DNS
 func (h *PaymentHandler) StartHealthChecker() {
 	ctx := context.Background()
 	go h.processor.HealthChecker(ctx)
+	go h.processor.ServiceHealthChecker(ctx, h.node)
+	go h.processor.TimeoutTuner(ctx)
+	go h.processor.DNSRefresher(ctx)
+}
+
+// WarmupProcessors abre as conexões com os processadores antes de o
+// servidor aceitar tráfego; WARMUP_CONNECTIONS=0 pula
+func (h *PaymentHandler) WarmupProcessors(ctx context.Context) {
+	h.processor.Warmup(ctx)
 }
 
-// Stop para o handler graciosamente
-func (h *PaymentHandler) Stop() {
-	h.workerPool.Stop()
+// Role retorna o papel da instância no health check dos processadores
+func (h *PaymentHandler) Role() string {
+	if h.node == nil {
+		return cluster.RoleStandalone
+	}
+	return h.node.Role()
+}
+
+// Stop para o handler graciosamente, esperando os workers até o fim de
+// ctx. Se o prazo vence antes, desiste deles e fecha os stores mesmo
+// assim, para o que já foi gravado não se perder; o que os workers ainda
+// em andamento gravarem depois disso se perde com o processo.
+func (h *PaymentHandler) Stop(ctx context.Context) {
+	stopped := make(chan struct{})
+	go func() {
+		h.workerPool.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		h.logger.Warn("gave up waiting for workers to stop")
+	}
+	h.processor.StopSnapshots()
+
+	if h.shared != nil {
+		h.shared.Close()
+	}
+	if h.node != nil {
+		h.node.Close()
+	}
+	h.store.Close()
 }
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// paddedPayment é o validPayment com espaços à esquerda até size bytes
+func paddedPayment(size int) string {
+	return strings.Repeat(" ", size-len(validPayment)) + validPayment
+}
+
+// onlyReader esconde o tamanho do corpo, para o client enviar em chunks
+// sem Content-Length
+type onlyReader struct{ io.Reader }
+
+func TestPostPaymentsBodyLimit(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Ingest.MaxBodyBytes = 256
+	_, mux := newTestHandler(t, cfg)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name      string
+		body      io.Reader
+		status    int
+		closeConn bool // o servidor fecha a conexão depois do 413
+	}{
+		{"at the limit", strings.NewReader(paddedPayment(256)), http.StatusAccepted, false},
+		{"one byte over", strings.NewReader(paddedPayment(257)), http.StatusRequestEntityTooLarge, true},
+		{"far over", strings.NewReader(paddedPayment(1 << 20)), http.StatusRequestEntityTooLarge, true},
+		{"chunked without content-length", onlyReader{strings.NewReader(paddedPayment(4096))}, http.StatusRequestEntityTooLarge, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := metrics.PaymentsRejected.Values()[metrics.ReasonBodyTooLarge]
+			req, _ := http.NewRequest("POST", server.URL+"/payments", tt.body)
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("POST: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d (body %s)", resp.StatusCode, tt.status, body)
+			}
+			if resp.Close != tt.closeConn {
+				t.Errorf("Connection: close = %t, want %t", resp.Close, tt.closeConn)
+			}
+			if tt.status != http.StatusRequestEntityTooLarge {
+				return
+			}
+			if code := errorCode(t, body); code != metrics.ReasonBodyTooLarge {
+				t.Errorf("code = %q, want %q", code, metrics.ReasonBodyTooLarge)
+			}
+			if got := metrics.PaymentsRejected.Values()[metrics.ReasonBodyTooLarge] - before; got != 1 {
+				t.Errorf("body_too_large rejections = %d, want 1", got)
+			}
+		})
+	}
+
+	// A conexão seguinte é nova e atendida normalmente
+	resp, err := http.Post(server.URL+"/payments", "application/json", strings.NewReader(validPayment))
+	if err != nil {
+		t.Fatalf("POST after the 413s: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("status after the 413s = %d, want 202", resp.StatusCode)
+	}
+}
+
+func TestPostPaymentsIgnoresDeclaredLength(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Ingest.MaxBodyBytes = 256
+	_, mux := newTestHandler(t, cfg)
+
+	tests := []struct {
+		name     string
+		declared int64
+		body     string
+		status   int
+		code     string
+	}{
+		// O limite vale para os bytes lidos, não para o que o cliente declarou
+		{"declares less than it sends", int64(len(validPayment)), paddedPayment(1024), http.StatusRequestEntityTooLarge, metrics.ReasonBodyTooLarge},
+		{"declares more than the limit", 1 << 20, validPayment, http.StatusAccepted, ""},
+		{"unknown length", -1, paddedPayment(257), http.StatusRequestEntityTooLarge, metrics.ReasonBodyTooLarge},
+		// Um corpo cortado é JSON inválido, não corpo grande demais
+		{"truncated body", 1 << 10, validPayment[:10], http.StatusBadRequest, metrics.ReasonInvalidJSON},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/payments", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.ContentLength = tt.declared
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.status, rec.Body)
+			}
+			if tt.code != "" {
+				if code := errorCode(t, rec.Body.Bytes()); code != tt.code {
+					t.Errorf("code = %q, want %q", code, tt.code)
+				}
+			}
+		})
+	}
+}
+
+// detailedRejections lê os contadores de recusa do summary detalhado
+func detailedRejections(t *testing.T, mux http.Handler) map[string]int64 {
+	t.Helper()
+	rec := serve(mux, "GET", "/payments-summary?detailed=true", "")
+	var summary types.PaymentSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil || summary.Detail == nil {
+		t.Fatalf("detailed summary %s: %v", rec.Body, err)
+	}
+	return summary.Detail.Ingress.Rejected
+}
+
+func TestEachRejectionCountsOnlyItsReason(t *testing.T) {
+	// Com o pool pausado, a fila de 2 posições enche nos dois primeiros payments
+	paused := func(h *PaymentHandler) { h.workerPool.Pause() }
+
+	tests := []struct {
+		reason       string
+		setup        func(*PaymentHandler)
+		method, body string
+		contentType  string
+		repeat       int // requisições; só a última é recusada
+	}{
+		{reason: metrics.ReasonInvalidJSON, method: "POST", body: `{"amount":`},
+		{reason: metrics.ReasonValidation, method: "POST", body: `{"amount":-5,"type":"credit"}`},
+		{reason: metrics.ReasonBodyTooLarge, method: "POST", body: paddedPayment(8 << 10)},
+		{reason: metrics.ReasonUnsupportedMediaType, method: "POST", body: validPayment, contentType: "text/plain"},
+		{reason: metrics.ReasonMethodNotAllowed, method: "PUT", body: validPayment},
+		{reason: metrics.ReasonQueueFull, method: "POST", body: validPayment, setup: paused, repeat: 3},
+		{reason: metrics.ReasonBackpressure, method: "POST", body: validPayment, setup: func(h *PaymentHandler) {
+			paused(h)
+			h.EnableAdmissionControl(50, 10, 100) // recusa tudo a partir de 1 na fila
+		}, repeat: 2},
+		{reason: metrics.ReasonRateLimited, method: "POST", body: validPayment, setup: withRateLimit(1), repeat: 2},
+		{reason: metrics.ReasonDuplicate, method: "POST", body: duplicatePayment, setup: paused, repeat: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.reason, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Pool.Workers, cfg.Pool.QueueSize = 1, 2
+			cfg.Ingest.MaxBodyBytes = 256
+			var setup []func(*PaymentHandler)
+			if tt.setup != nil {
+				setup = append(setup, tt.setup)
+			}
+			_, mux := newTestHandler(t, cfg, setup...)
+
+			contentType := tt.contentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			before := metrics.PaymentsRejected.Values()
+			beforeDetail := detailedRejections(t, mux)
+			for range max(tt.repeat, 1) {
+				serve(mux, tt.method, "/payments", tt.body, "Content-Type", contentType)
+			}
+
+			after := metrics.PaymentsRejected.Values()
+			afterDetail := detailedRejections(t, mux)
+			for reason := range after {
+				want := int64(0)
+				if reason == tt.reason {
+					want = 1
+				}
+				if got := after[reason] - before[reason]; got != want {
+					t.Errorf("%s counter moved by %d, want %d", reason, got, want)
+				}
+				if got := afterDetail[reason] - beforeDetail[reason]; got != want {
+					t.Errorf("detail.ingress.rejected[%s] moved by %d, want %d", reason, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPostPaymentsAmountBoundaries(t *testing.T) {
+	_, mux := newTestHandler(t, testConfig(t))
+
+	tests := []struct {
+		amount      string
+		wantStatus  int
+		wantCode    string
+		wantMessage string // trecho esperado na mensagem
+	}{
+		{"0", http.StatusBadRequest, metrics.ReasonValidation, "amount must be positive"},
+		{"1", http.StatusAccepted, "", ""},
+		{"1000000000", http.StatusAccepted, "", ""}, // types.DefaultMaxAmount
+		{"1000000001", http.StatusBadRequest, codeAmountTooLarge, "exceeds the maximum of 1000000000"},
+		{"9223372036854775807", http.StatusBadRequest, codeAmountTooLarge, "exceeds the maximum"},
+		{"9223372036854775808", http.StatusBadRequest, metrics.ReasonInvalidJSON, `"amount" is out of range`},
+		{"9e18", http.StatusBadRequest, metrics.ReasonInvalidJSON, `"amount" must be an integer number of cents`},
+		{`"100"`, http.StatusBadRequest, metrics.ReasonInvalidJSON, `"amount" must be a number`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.amount, func(t *testing.T) {
+			rec := serve(mux, "POST", "/payments", `{"amount":`+tt.amount+`,"type":"credit"}`)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantCode == "" {
+				return
+			}
+			var resp types.ErrorResponse
+			json.Unmarshal(rec.Body.Bytes(), &resp)
+			if errorCode(t, rec.Body.Bytes()) != tt.wantCode || !strings.Contains(resp.Error.Message, tt.wantMessage) {
+				t.Errorf("error = %+v, want code %s mentioning %s", resp.Error, tt.wantCode, tt.wantMessage)
+			}
+		})
+	}
+}
+
+// discardWriter é um ResponseWriter que só guarda o status, para o
+// benchmark medir o handler sem o custo do httptest.ResponseRecorder
+type discardWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardWriter) WriteHeader(status int)      { w.status = status }
+
+// BenchmarkPostPayments mede o caminho do 202: parse, validação,
+// enfileiramento e o writeAccepted. Os workers ficam pausados e a fila
+// comporta todas as iterações, para o processamento não entrar na conta.
+func BenchmarkPostPayments(b *testing.B) {
+	cfg := testConfig(b)
+	cfg.Pool.QueueSize = b.N + 1
+	h, _ := newTestHandler(b, cfg, func(h *PaymentHandler) { h.workerPool.Pause() })
+
+	body := strings.NewReader(validPayment)
+	rc := io.NopCloser(body)
+	req := httptest.NewRequest("POST", "/payments", nil)
+	req.Header.Set("Content-Type", "application/json")
+	w := &discardWriter{header: make(http.Header)}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		// O handler troca o Body pelo MaxBytesReader a cada chamada
+		body.Reset(validPayment)
+		req.Body = rc
+		clear(w.header)
+		h.PostPayments(w, req)
+		if w.status != http.StatusAccepted {
+			b.Fatalf("status %d, want 202", w.status)
+		}
+	}
+}
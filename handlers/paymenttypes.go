@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// paymentTypes confere o campo type contra a lista de PAYMENT_TYPES,
+// montada uma vez no boot. Sem lista qualquer type não vazio é aceito como
+// veio, como antes da lista existir.
+type paymentTypes struct {
+	allowed map[string]struct{}
+	names   string // para a mensagem de erro
+}
+
+// newPaymentTypes monta o validador e os contadores por type; os nomes já
+// vêm em minúsculas do config
+func newPaymentTypes(names []string) *paymentTypes {
+	metrics.UsePaymentTypes(names)
+	if len(names) == 0 {
+		return &paymentTypes{}
+	}
+
+	allowed := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		allowed[name] = struct{}{}
+	}
+	return &paymentTypes{allowed: allowed, names: strings.Join(names, ", ")}
+}
+
+// normalize passa o type para minúsculas e o recusa se estiver fora da
+// lista
+func (t *paymentTypes) normalize(payment *types.PaymentRequest) error {
+	if t.allowed == nil {
+		return nil
+	}
+	normalized := strings.ToLower(payment.Type)
+	if _, ok := t.allowed[normalized]; !ok {
+		return fmt.Errorf("type %q is not allowed, expected one of: %s", payment.Type, t.names)
+	}
+	payment.Type = normalized
+	return nil
+}
+
+// count contabiliza um payment aceito (fila, inline ou sync) no contador do
+// seu type
+func (t *paymentTypes) count(paymentType string) {
+	if t.allowed == nil {
+		paymentType = metrics.PaymentTypeOther
+	}
+	metrics.PaymentsByType.Inc(paymentType)
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// peerTimeout limita a espera por cada instância irmã
+const peerTimeout = 200 * time.Millisecond
+
+// internalSummaryPath é a rota interna consultada entre instâncias. Nunca
+// consultar o /payments-summary público do peer, que faria fan-out de novo.
+const internalSummaryPath = "/internal/summary"
+
+// UsePeers configura as instâncias irmãs cujo summary é somado ao local
+func (h *PaymentHandler) UsePeers(peerURLs []string) {
+	h.peers = h.peers[:0]
+	for _, peer := range peerURLs {
+		if peer = strings.TrimRight(strings.TrimSpace(peer), "/"); peer != "" {
+			h.peers = append(h.peers, peer+internalSummaryPath)
+		}
+	}
+	h.peerClient = &http.Client{Timeout: peerTimeout}
+}
+
+// GetInternalSummary endpoint interno com os contadores apenas desta instância
+func (h *PaymentHandler) GetInternalSummary(w http.ResponseWriter, r *http.Request) {
+	lifetime := h.processor.LifetimeSummary()
+	internal := types.InternalSummary{
+		Snapshot: lifetime.DefaultSuccess + lifetime.FallbackSuccess + lifetime.TotalErrors + lifetime.TotalExpired,
+		Summary:  *h.processor.LocalSummary(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(internal)
+}
+
+// mergedSummary soma o summary local com o das instâncias irmãs. Peers que
+// não respondem a tempo são ignorados e o resultado é marcado como parcial.
+func (h *PaymentHandler) mergedSummary(ctx context.Context) *types.PaymentSummary {
+	merged := h.processor.LocalSummary()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, peer := range h.peers {
+		wg.Add(1)
+		go func(peerURL string) {
+			defer wg.Done()
+
+			internal, err := h.fetchPeerSummary(ctx, peerURL)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				merged.Partial = true
+				return
+			}
+			merged.Add(internal.Summary)
+			// A janela somada é a que todas cobrem: a do reset mais recente
+			if since := internal.Summary.Since; since != nil && merged.Since != nil && since.After(*merged.Since) {
+				merged.Since = since
+			}
+		}(peer)
+	}
+
+	wg.Wait()
+	return merged
+}
+
+// fetchPeerSummary consulta a rota interna de uma instância irmã
+func (h *PaymentHandler) fetchPeerSummary(ctx context.Context, peerURL string) (*types.InternalSummary, error) {
+	ctx, cancel := context.WithTimeout(ctx, peerTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", peerURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := h.peerClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer %s: HTTP %d", peerURL, resp.StatusCode)
+	}
+
+	var internal types.InternalSummary
+	if err := json.NewDecoder(resp.Body).Decode(&internal); err != nil {
+		return nil, err
+	}
+	return &internal, nil
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+)
+
+// Limites da espera sugerida na recusa por fila cheia e a espera sem taxa
+// de drenagem medida
+const (
+	minQueueFullRetryAfter     = 100 * time.Millisecond
+	maxQueueFullRetryAfter     = 10 * time.Second
+	unknownQueueFullRetryAfter = time.Second
+)
+
+// queueFullHeadroomPercent é a folga, em percentual da capacidade, que a
+// espera sugerida dá para a fila abrir antes de o cliente voltar: com vaga
+// para um payment só, os clientes recusados voltariam todos para disputá-la
+const queueFullHeadroomPercent = 10
+
+// queueFullRetryAfter estima em quanto tempo a fila abre
+// queueFullHeadroomPercent% de vagas, pelo backlog atual e pela taxa de
+// drenagem medida nos workers. Sem nada drenado nos últimos segundos a
+// taxa é desconhecida (a fila pode ter enchido numa rajada logo após o
+// boot ou os workers podem estar pausados) e a espera é de 1s.
+func (h *PaymentHandler) queueFullRetryAfter() time.Duration {
+	rate := h.workerPool.DrainRate()
+	if rate <= 0 {
+		return unknownQueueFullRetryAfter
+	}
+
+	capacity := h.workerPool.GetQueueCapacity()
+	excess := h.workerPool.GetQueueSize() - capacity*(100-queueFullHeadroomPercent)/100
+	wait := time.Duration(float64(excess) / rate * float64(time.Second))
+	return min(max(wait, minQueueFullRetryAfter), maxQueueFullRetryAfter)
+}
+
+// retryAfterSeconds arredonda a espera para cima em segundos inteiros, o
+// formato do header Retry-After
+func retryAfterSeconds(wait time.Duration) int {
+	return max(1, int(math.Ceil(wait.Seconds())))
+}
+
+// rejectQueueFull recusa o payment com 503, o Retry-After em segundos e a
+// espera em milissegundos no retryAfterMs do envelope de erro
+func (h *PaymentHandler) rejectQueueFull(res responder, wait time.Duration) {
+	res.SetHeader("Retry-After", strconv.Itoa(retryAfterSeconds(wait)))
+
+	buf := responsePool.Get().(*bytes.Buffer)
+	buf.Reset()
+
+	buf.Write(appendErrorRetry(buf.AvailableBuffer(), metrics.ReasonQueueFull, "Service temporarily unavailable", wait.Milliseconds()))
+	res.JSON(http.StatusServiceUnavailable, buf.Bytes())
+
+	responsePool.Put(buf)
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+)
+
+func TestRetryAfterSeconds(t *testing.T) {
+	tests := []struct {
+		wait time.Duration
+		want int
+	}{
+		{0, 1},
+		{minQueueFullRetryAfter, 1},
+		{time.Second, 1},
+		{time.Second + time.Millisecond, 2},
+		{1840 * time.Millisecond, 2},
+		{maxQueueFullRetryAfter, 10},
+	}
+	for _, tt := range tests {
+		if got := retryAfterSeconds(tt.wait); got != tt.want {
+			t.Errorf("retryAfterSeconds(%s) = %d, want %d", tt.wait, got, tt.want)
+		}
+	}
+}
+
+func TestQueueFullWithoutDrainRate(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Pool.Workers, cfg.Pool.QueueSize = 1, 2
+	_, mux := newTestHandler(t, cfg, func(h *PaymentHandler) { h.workerPool.Pause() })
+
+	// Com os workers pausados nada drenou: a espera é a de taxa desconhecida
+	var rec *httptest.ResponseRecorder
+	for range 3 {
+		rec = serve(mux, "POST", "/payments", validPayment)
+	}
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503 (body %s)", rec.Code, rec.Body)
+	}
+	detail := strictErrorBody(t, rec.Body.Bytes())
+	if detail.Code != metrics.ReasonQueueFull || detail.RetryAfterMs != unknownQueueFullRetryAfter.Milliseconds() {
+		t.Errorf("error = %+v, want queue_full with retryAfterMs %d", detail, unknownQueueFullRetryAfter.Milliseconds())
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+}
+
+// drainRun são as respostas de um grupo de clientes contra a fila cheia
+type drainRun struct {
+	accepted, rejected int
+	waits              []time.Duration // retryAfterMs sugeridos
+}
+
+// slowDrain põe clients clientes enviando payments por duration contra uma
+// fila de 20 vagas drenada por um worker a 20ms por payment, depois de a
+// taxa de drenagem aparecer. Recusado, o cliente espera o retryAfterMs da
+// resposta se honor, senão 5ms.
+func slowDrain(t *testing.T, clients int, duration time.Duration, honor bool) drainRun {
+	t.Helper()
+	processor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			time.Sleep(20 * time.Millisecond)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message":"payment processed successfully"}`))
+	}))
+	t.Cleanup(processor.Close)
+
+	cfg := testConfig(t)
+	cfg.Processors.DefaultURL = processor.URL + "/payments"
+	cfg.Pool.Workers, cfg.Pool.QueueSize = 1, 20
+	cfg.Pool.BatchSize, cfg.Pool.BatchParallelism = 1, 1
+	cfg.Pool.Autoscale = false
+	h, mux := newTestHandler(t, cfg)
+
+	// Mantém a fila ocupada até a primeira taxa de drenagem: a medição
+	// compara as esperas calculadas, não a de taxa desconhecida
+	for warmup := time.Now().Add(3 * time.Second); h.workerPool.DrainRate() == 0; {
+		if time.Now().After(warmup) {
+			t.Fatal("no drain rate after 3s of a busy queue")
+		}
+		serve(mux, "POST", "/payments", validPayment)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var mu sync.Mutex
+	var run drainRun
+	var wg sync.WaitGroup
+	deadline := time.Now().Add(duration)
+	for range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				rec := serve(mux, "POST", "/payments", validPayment)
+				if rec.Code == http.StatusAccepted {
+					mu.Lock()
+					run.accepted++
+					mu.Unlock()
+					continue
+				}
+				if rec.Code != http.StatusServiceUnavailable {
+					t.Errorf("status = %d, want 202 or 503 (body %s)", rec.Code, rec.Body)
+					return
+				}
+
+				detail := strictErrorBody(t, rec.Body.Bytes())
+				wait := time.Duration(detail.RetryAfterMs) * time.Millisecond
+				if header := rec.Header().Get("Retry-After"); header != strconv.Itoa(retryAfterSeconds(wait)) {
+					t.Errorf("Retry-After = %q with retryAfterMs %d", header, detail.RetryAfterMs)
+				}
+				mu.Lock()
+				run.rejected++
+				run.waits = append(run.waits, wait)
+				mu.Unlock()
+
+				if !honor {
+					wait = 5 * time.Millisecond
+				}
+				time.Sleep(min(wait, time.Until(deadline)))
+			}
+		}()
+	}
+	wg.Wait()
+	return run
+}
+
+func TestQueueFullRetryAfterUnderSlowDrain(t *testing.T) {
+	if testing.Short() {
+		t.Skip("simulates a slow drain for a few seconds")
+	}
+	const clients, duration = 20, 2 * time.Second
+
+	eager := slowDrain(t, clients, duration, false)
+	honoring := slowDrain(t, clients, duration, true)
+	t.Logf("eager: %d accepted, %d rejected; honoring Retry-After: %d accepted, %d rejected",
+		eager.accepted, eager.rejected, honoring.accepted, honoring.rejected)
+
+	for _, wait := range append(eager.waits, honoring.waits...) {
+		if wait < minQueueFullRetryAfter || wait > maxQueueFullRetryAfter {
+			t.Fatalf("retryAfterMs = %s, want it within %s..%s", wait, minQueueFullRetryAfter, maxQueueFullRetryAfter)
+		}
+	}
+	if eager.accepted == 0 || honoring.accepted == 0 {
+		t.Fatalf("nothing accepted: eager %d, honoring %d", eager.accepted, honoring.accepted)
+	}
+	// Quem respeita a espera é recusado bem menos vezes por payment aceito
+	eagerRatio := float64(eager.rejected) / float64(eager.accepted)
+	honoringRatio := float64(honoring.rejected) / float64(honoring.accepted)
+	if honoringRatio*4 > eagerRatio {
+		t.Errorf("rejections per accepted payment: %.2f honoring Retry-After vs %.2f eager, want at least 4x fewer",
+			honoringRatio, eagerRatio)
+	}
+	// sem abrir mão da vazão da fila
+	if honoring.accepted*2 < eager.accepted {
+		t.Errorf("honoring Retry-After accepted %d payments, eager clients %d", honoring.accepted, eager.accepted)
+	}
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"cmp"
+	"container/list"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/config"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// topThrottledClients é quantos IPs aparecem em rate_limit.top_throttled
+const topThrottledClients = 10
+
+// rateLimitedMessage é a mensagem das recusas pelo rate limit
+const rateLimitedMessage = "Rate limit exceeded for client, retry later"
+
+// rateLimiter é um token bucket por IP. Os buckets ficam em uma LRU de
+// tamanho fixo, então uma varredura de IPs aleatórios só descarta os IPs
+// menos recentes em vez de crescer a memória; um IP descartado volta com o
+// bucket cheio.
+type rateLimiter struct {
+	rate       float64
+	burst      float64
+	maxClients int
+	trustProxy bool
+
+	mu      sync.Mutex
+	buckets map[string]*list.Element
+	lru     *list.List // mais recente na frente
+
+	throttled atomic.Int64
+}
+
+// bucket é o estado de um IP
+type bucket struct {
+	ip        string
+	tokens    float64
+	updated   time.Time
+	throttled int64
+}
+
+// EnableRateLimit liga o rate limit por IP, com um token por payment: no
+// POST /payments é aplicado antes de ler o corpo e acima da taxa a
+// resposta é 429 com Retry-After; no lote e no gRPC, veja ingestBatch e
+// grpcPayments.
+func (h *PaymentHandler) EnableRateLimit(cfg config.RateLimit) {
+	if cfg.Rate <= 0 || cfg.Burst <= 0 || cfg.MaxClients <= 0 {
+		slog.Warn("invalid rate limit settings, rate limit disabled",
+			"rate", cfg.Rate,
+			"burst", cfg.Burst,
+			"max_clients", cfg.MaxClients)
+		return
+	}
+
+	h.rateLimit = &rateLimiter{
+		rate:       cfg.Rate,
+		burst:      float64(cfg.Burst),
+		maxClients: cfg.MaxClients,
+		trustProxy: cfg.TrustProxy,
+		buckets:    make(map[string]*list.Element, cfg.MaxClients),
+		lru:        list.New(),
+	}
+}
+
+// take retira até n tokens do bucket do IP, um por payment, e retorna
+// quantos payments couberam. Faltando token, retorna também em quanto
+// tempo o próximo estará disponível.
+func (l *rateLimiter) take(ip string, n int, now time.Time) (int, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var b *bucket
+	if elem, ok := l.buckets[ip]; ok {
+		l.lru.MoveToFront(elem)
+		b = elem.Value.(*bucket)
+		b.tokens = min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+		b.updated = now
+	} else {
+		if l.lru.Len() >= l.maxClients {
+			oldest := l.lru.Back()
+			l.lru.Remove(oldest)
+			delete(l.buckets, oldest.Value.(*bucket).ip)
+		}
+		b = &bucket{ip: ip, tokens: l.burst, updated: now}
+		l.buckets[ip] = l.lru.PushFront(b)
+	}
+
+	granted := min(n, int(b.tokens))
+	b.tokens -= float64(granted)
+	if granted == n {
+		return granted, 0
+	}
+	b.throttled += int64(n - granted)
+	l.throttled.Add(int64(n - granted))
+	return granted, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// clientIP escolhe o IP do bucket. Atrás de um proxy confiável vale o
+// X-Real-IP ou a última entrada do X-Forwarded-For (a que o proxy
+// acrescentou; as anteriores vêm do cliente e podem ser forjadas).
+func (l *rateLimiter) clientIP(remoteAddr, realIP, forwardedFor string) string {
+	if l.trustProxy {
+		if realIP = strings.TrimSpace(realIP); realIP != "" {
+			return realIP
+		}
+		last := strings.TrimSpace(forwardedFor[strings.LastIndex(forwardedFor, ",")+1:])
+		if last != "" {
+			return last
+		}
+	}
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
+
+// limited aplica o rate limit ao payment do IP e, acima da taxa, responde
+// 429 com Retry-After
+func (h *PaymentHandler) limited(res responder, remoteAddr, realIP, forwardedFor string) bool {
+	if h.rateLimit == nil {
+		return false
+	}
+
+	granted, wait := h.rateLimit.take(h.rateLimit.clientIP(remoteAddr, realIP, forwardedFor), 1, time.Now())
+	if granted == 1 {
+		return false
+	}
+	rejectRateLimited(res, wait)
+	return true
+}
+
+// rateLimitClient retorna o IP cobrado pelo rate limit, ou vazio com ele
+// desligado
+func (h *PaymentHandler) rateLimitClient(remoteAddr, realIP, forwardedFor string) string {
+	if h.rateLimit == nil {
+		return ""
+	}
+	return h.rateLimit.clientIP(remoteAddr, realIP, forwardedFor)
+}
+
+// rejectRateLimited recusa a requisição com 429 e o Retry-After até o
+// próximo token
+func rejectRateLimited(res responder, wait time.Duration) {
+	metrics.PaymentsRejected.Inc(metrics.ReasonRateLimited)
+	res.SetHeader("Retry-After", strconv.Itoa(retryAfterSeconds(wait)))
+	res.Error(http.StatusTooManyRequests, metrics.ReasonRateLimited, rateLimitedMessage)
+}
+
+// stats retorna a configuração, os IPs em memória e os que mais foram
+// recusados
+func (l *rateLimiter) stats() *types.RateLimitStats {
+	l.mu.Lock()
+	stats := &types.RateLimitStats{
+		RatePerSecond: l.rate,
+		Burst:         int(l.burst),
+		Clients:       l.lru.Len(),
+		MaxClients:    l.maxClients,
+		Throttled:     l.throttled.Load(),
+	}
+	top := []types.ClientThrottle{}
+	for elem := l.lru.Front(); elem != nil; elem = elem.Next() {
+		if b := elem.Value.(*bucket); b.throttled > 0 {
+			top = append(top, types.ClientThrottle{IP: b.ip, Throttled: b.throttled})
+		}
+	}
+	l.mu.Unlock()
+
+	slices.SortFunc(top, func(a, b types.ClientThrottle) int {
+		return cmp.Compare(b.Throttled, a.Throttled)
+	})
+	stats.TopThrottled = top[:min(len(top), topThrottledClients)]
+	return stats
+}
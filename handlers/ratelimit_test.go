@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/yurimachados/rinha-backend-go/config"
+	"github.com/yurimachados/rinha-backend-go/grpcapi"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// withRateLimit liga o rate limit com uma taxa baixa, para o bucket não
+// encher de novo durante o teste
+func withRateLimit(burst int) func(*PaymentHandler) {
+	return func(h *PaymentHandler) {
+		h.EnableRateLimit(config.RateLimit{Enabled: true, Rate: 0.01, Burst: burst, MaxClients: 10})
+	}
+}
+
+func TestRateLimiterTakePartial(t *testing.T) {
+	l := &rateLimiter{rate: 1, burst: 3, maxClients: 10}
+	l.buckets, l.lru = make(map[string]*list.Element), list.New()
+	now := time.Now()
+
+	if granted, wait := l.take("10.0.0.1", 2, now); granted != 2 || wait != 0 {
+		t.Fatalf("take(2) = %d, %s; want 2, 0", granted, wait)
+	}
+	granted, wait := l.take("10.0.0.1", 5, now)
+	if granted != 1 || wait != time.Second {
+		t.Fatalf("take(5) with 1 token left = %d, %s; want 1, 1s", granted, wait)
+	}
+	if got := l.stats().Throttled; got != 4 {
+		t.Errorf("throttled = %d, want the 4 payments without a token", got)
+	}
+	// Outro IP tem o próprio bucket
+	if granted, _ := l.take("10.0.0.2", 3, now); granted != 3 {
+		t.Errorf("take on a new IP = %d, want 3", granted)
+	}
+}
+
+func batchBody(n int) string {
+	items := make([]string, n)
+	for i := range items {
+		items[i] = validPayment
+	}
+	return "[" + strings.Join(items, ",") + "]"
+}
+
+func TestBatchChargesOneTokenPerItem(t *testing.T) {
+	_, mux := newTestHandler(t, testConfig(t), withRateLimit(5))
+
+	before := metrics.PaymentsRejected.Values()[metrics.ReasonRateLimited]
+	rec := serve(mux, "POST", "/payments/batch", batchBody(3))
+	if rec.Code != http.StatusMultiStatus {
+		t.Fatalf("first batch status = %d, want 207 (body %s)", rec.Code, rec.Body)
+	}
+
+	// Restam 2 tokens para 4 itens: 2 aceitos, 2 recusados com Retry-After
+	rec = serve(mux, "POST", "/payments/batch", batchBody(4))
+	var resp types.BatchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	if resp.Accepted != 2 || resp.Rejected != 2 {
+		t.Fatalf("accepted %d, rejected %d; want 2 and 2", resp.Accepted, resp.Rejected)
+	}
+	for _, item := range resp.Results[2:] {
+		if item.Reason != metrics.ReasonRateLimited {
+			t.Errorf("item %d reason = %q, want rate_limited", item.Index, item.Reason)
+		}
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("partially limited batch has no Retry-After")
+	}
+
+	// Sem token nenhum o lote inteiro recebe 429
+	rec = serve(mux, "POST", "/payments/batch", batchBody(2))
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("status = %d, Retry-After %q; want 429 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if got := metrics.PaymentsRejected.Values()[metrics.ReasonRateLimited] - before; got != 3 {
+		t.Errorf("rate_limited rejections = %d, want 3 (2 items and 1 whole batch)", got)
+	}
+
+	// A mesma cota vale para o POST /payments
+	if rec := serve(mux, "POST", "/payments", validPayment); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("POST /payments status = %d after the batches used the tokens, want 429", rec.Code)
+	}
+}
+
+func TestGRPCChargesRateLimit(t *testing.T) {
+	h, _ := newTestHandler(t, testConfig(t), withRateLimit(1))
+	server := &grpcPayments{h: h}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 9), Port: 4321}})
+
+	if _, err := server.SubmitPayment(ctx, &grpcapi.PaymentRequest{Amount: 100, Type: "credit"}); err != nil {
+		t.Fatalf("first payment: %v", err)
+	}
+	_, err := server.SubmitPayment(ctx, &grpcapi.PaymentRequest{Amount: 100, Type: "credit"})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("second payment error = %v, want RESOURCE_EXHAUSTED", err)
+	}
+
+	// Outro peer tem o próprio bucket
+	other := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 10), Port: 4321}})
+	if _, err := server.SubmitPayment(other, &grpcapi.PaymentRequest{Amount: 100, Type: "credit"}); err != nil {
+		t.Fatalf("payment from another peer: %v", err)
+	}
+}
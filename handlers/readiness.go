@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/config"
+)
+
+// Motivos de um /readyz em 503, também o corpo da resposta
+const (
+	notReadyShuttingDown = "shutting_down"
+	notReadyQueue        = "queue_saturated"
+	notReadyProcessors   = "processors_unhealthy"
+)
+
+// readinessPolicy são os limites da prontidão: a fila a partir de
+// queuePercent% da capacidade e os dois processadores fora do roteamento
+// por unhealthyGrace
+type readinessPolicy struct {
+	queuePercent   int
+	unhealthyGrace time.Duration
+}
+
+// readinessInput é o estado da instância no momento da consulta
+type readinessInput struct {
+	depth, capacity int
+	shuttingDown    bool
+	processorsDown  bool          // nenhum processador saudável
+	downFor         time.Duration // desde quando, entre as consultas do /readyz
+}
+
+// evaluate retorna o motivo de a instância não estar pronta, ou "" se
+// estiver. O desligamento vale antes dos demais: a instância não volta a
+// receber tráfego mesmo com a fila vazia.
+func (p readinessPolicy) evaluate(in readinessInput) string {
+	switch {
+	case in.shuttingDown:
+		return notReadyShuttingDown
+	case in.capacity > 0 && in.depth*100 >= in.capacity*p.queuePercent:
+		return notReadyQueue
+	case in.processorsDown && in.downFor >= p.unhealthyGrace:
+		return notReadyProcessors
+	}
+	return ""
+}
+
+// readiness é a prontidão da instância para o balanceador. Não há
+// goroutine própria: o estado é reavaliado a cada consulta do /readyz e
+// volta a 200 sozinho quando as condições passam.
+type readiness struct {
+	policy       readinessPolicy
+	shuttingDown atomic.Bool
+	downSince    atomic.Int64 // UnixNano da primeira consulta sem processador saudável; 0 com algum
+
+	mu     sync.Mutex
+	reason string // resultado da última consulta, para logar só as transições
+}
+
+func newReadiness(cfg config.Server) *readiness {
+	return &readiness{policy: readinessPolicy{
+		queuePercent:   cfg.ReadyQueuePercent,
+		unhealthyGrace: cfg.ReadyUnhealthyGrace,
+	}}
+}
+
+// downFor retorna há quanto tempo nenhum processador está saudável,
+// contado da primeira consulta que viu os dois fora
+func (r *readiness) downFor(now time.Time, anyHealthy bool) time.Duration {
+	if anyHealthy {
+		r.downSince.Store(0)
+		return 0
+	}
+	r.downSince.CompareAndSwap(0, now.UnixNano())
+	return now.Sub(time.Unix(0, r.downSince.Load()))
+}
+
+// checkReadiness avalia a prontidão agora e loga a mudança, se houver
+func (h *PaymentHandler) checkReadiness() string {
+	r := h.ready
+	anyHealthy := h.processor.AnyHealthy()
+	in := readinessInput{
+		depth:          h.workerPool.GetQueueSize(),
+		capacity:       h.workerPool.GetQueueCapacity(),
+		shuttingDown:   r.shuttingDown.Load(),
+		processorsDown: !anyHealthy,
+		downFor:        r.downFor(time.Now(), anyHealthy),
+	}
+	reason := r.policy.evaluate(in)
+
+	r.mu.Lock()
+	previous := r.reason
+	r.reason = reason
+	r.mu.Unlock()
+
+	switch {
+	case reason == previous:
+	case reason == "":
+		h.logger.Info("instance ready", "previous_reason", previous)
+	default:
+		h.logger.Warn("instance not ready",
+			"reason", reason,
+			"queue_depth", in.depth,
+			"queue_size", in.capacity,
+			"processors_down_ms", in.downFor.Milliseconds())
+	}
+	return reason
+}
+
+// BeginShutdown passa o /readyz a 503, para o balanceador tirar a
+// instância antes de os listeners fecharem, e marca o início da drenagem
+// no relatório do desligamento
+func (h *PaymentHandler) BeginShutdown() {
+	h.ready.shuttingDown.Store(true)
+	h.workerPool.BeginDrain()
+}
+
+// GetLivez responde 200 enquanto o processo atende requisições
+func (h *PaymentHandler) GetLivez(w http.ResponseWriter, r *http.Request) {
+	w.Header()["Content-Type"] = contentTypeText
+	w.WriteHeader(http.StatusOK)
+	w.Write(healthOK)
+}
+
+// GetReadyz responde 200 se a instância deve receber tráfego e 503 com o
+// motivo caso contrário: desligamento em curso, fila saturada ou nenhum
+// processador saudável além do prazo de tolerância
+func (h *PaymentHandler) GetReadyz(w http.ResponseWriter, r *http.Request) {
+	w.Header()["Content-Type"] = contentTypeText
+	reason := h.checkReadiness()
+	if reason == "" {
+		w.WriteHeader(http.StatusOK)
+		w.Write(healthOK)
+		return
+	}
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write([]byte(reason))
+}
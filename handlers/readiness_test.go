@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestReadinessEvaluate(t *testing.T) {
+	policy := readinessPolicy{queuePercent: 90, unhealthyGrace: 10 * time.Second}
+	tests := []struct {
+		name string
+		in   readinessInput
+		want string
+	}{
+		{"idle", readinessInput{depth: 0, capacity: 100}, ""},
+		{"queue just below the threshold", readinessInput{depth: 89, capacity: 100}, ""},
+		{"queue at the threshold", readinessInput{depth: 90, capacity: 100}, notReadyQueue},
+		{"queue full", readinessInput{depth: 100, capacity: 100}, notReadyQueue},
+		{"9 of 11 is below 90%", readinessInput{depth: 9, capacity: 11}, ""},
+		{"unknown capacity", readinessInput{depth: 5, capacity: 0}, ""},
+		{"shutting down with an empty queue", readinessInput{capacity: 100, shuttingDown: true}, notReadyShuttingDown},
+		{"shutting down wins over a full queue", readinessInput{depth: 100, capacity: 100, shuttingDown: true}, notReadyShuttingDown},
+		{"processors down within the grace", readinessInput{capacity: 100, processorsDown: true, downFor: 9 * time.Second}, ""},
+		{"processors down for the grace", readinessInput{capacity: 100, processorsDown: true, downFor: 10 * time.Second}, notReadyProcessors},
+		{"processors back after a long outage", readinessInput{capacity: 100, downFor: time.Minute}, ""},
+		{"full queue wins over processors down", readinessInput{depth: 95, capacity: 100, processorsDown: true, downFor: time.Minute}, notReadyQueue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.evaluate(tt.in); got != tt.want {
+				t.Errorf("evaluate(%+v) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadinessDownFor(t *testing.T) {
+	var r readiness
+	start := time.Now()
+	if got := r.downFor(start, true); got != 0 {
+		t.Fatalf("downFor with a healthy processor = %s, want 0", got)
+	}
+	// Contado da primeira consulta que viu os dois fora
+	r.downFor(start, false)
+	if got := r.downFor(start.Add(4*time.Second), false); got != 4*time.Second {
+		t.Fatalf("downFor = %s, want 4s since the first probe", got)
+	}
+	// Um processador que volta zera a contagem
+	r.downFor(start.Add(5*time.Second), true)
+	if got := r.downFor(start.Add(6*time.Second), false); got != 0 {
+		t.Fatalf("downFor after a recovery = %s, want a fresh count", got)
+	}
+}
+
+func TestReadyzFlips(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Pool.Workers, cfg.Pool.QueueSize = 1, 10
+	cfg.Pool.BatchSize, cfg.Pool.BatchParallelism = 1, 1
+	cfg.Server.ReadyQueuePercent = 50
+	h, mux := newTestHandler(t, cfg, func(h *PaymentHandler) { h.workerPool.Pause() })
+
+	probe := func(want int, reason string) {
+		t.Helper()
+		rec := serve(mux, "GET", "/readyz", "")
+		if rec.Code != want {
+			t.Fatalf("/readyz = %d %q, want %d", rec.Code, rec.Body, want)
+		}
+		if want != http.StatusOK && rec.Body.String() != reason {
+			t.Errorf("/readyz body = %q, want %q", rec.Body, reason)
+		}
+		if rec := serve(mux, "GET", "/livez", ""); rec.Code != http.StatusOK {
+			t.Errorf("/livez = %d while the process runs", rec.Code)
+		}
+	}
+	probe(http.StatusOK, "")
+
+	// Metade da fila ocupada com os workers pausados
+	for range 5 {
+		if rec := serve(mux, "POST", "/payments", validPayment); rec.Code != http.StatusAccepted {
+			t.Fatalf("POST /payments = %d, want 202", rec.Code)
+		}
+	}
+	probe(http.StatusServiceUnavailable, notReadyQueue)
+
+	// A fila drena e a instância volta sozinha
+	h.workerPool.Resume()
+	deadline := time.Now().Add(2 * time.Second)
+	for h.workerPool.GetQueueSize() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue still holds %d payments", h.workerPool.GetQueueSize())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	probe(http.StatusOK, "")
+	h.ready.mu.Lock()
+	if got := h.ready.reason; got != "" {
+		t.Errorf("last reason = %q after the recovery, want empty", got)
+	}
+	h.ready.mu.Unlock()
+
+	// O desligamento tira a instância de vez
+	h.BeginShutdown()
+	probe(http.StatusServiceUnavailable, notReadyShuttingDown)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	h.Stop(ctx)
+	probe(http.StatusServiceUnavailable, notReadyShuttingDown)
+}
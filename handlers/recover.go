@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/valyala/fasthttp"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+)
+
+// panicBody é a resposta de uma requisição cujo handler entrou em pânico
+var panicBody = appendError(nil, codeInternal, "internal server error")
+
+// Recover envolve o handler recuperando pânicos: loga a pilha com o método,
+// o caminho e o cliente, conta em rinha_panics_total e responde 500 em
+// JSON, mantendo o servidor de pé. Se a resposta já tinha começado, a
+// conexão só é encerrada. http.ErrAbortHandler segue adiante, como o
+// net/http espera.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &recoverWriter{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if err, ok := v.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(v)
+			}
+
+			logPanic(r.Context(), v, r.Method, r.URL.Path, r.RemoteAddr)
+			if rw.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(panicBody)
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// recoverFastHTTP, adiado no handler fasthttp, faz o mesmo que o Recover:
+// sem ele um pânico derruba o processo, porque o fasthttp não recupera
+func recoverFastHTTP(ctx *fasthttp.RequestCtx, reqCtx context.Context) {
+	v := recover()
+	if v == nil {
+		return
+	}
+
+	logPanic(reqCtx, v, string(ctx.Method()), string(ctx.Path()), ctx.RemoteAddr().String())
+	ctx.Response.Reset()
+	ctx.Response.Header.Set(logging.RequestIDHeader, logging.RequestID(reqCtx))
+	ctx.SetStatusCode(http.StatusInternalServerError)
+	ctx.SetContentType("application/json")
+	ctx.SetBody(panicBody)
+}
+
+// logPanic conta e loga o pânico de um handler com a pilha
+func logPanic(ctx context.Context, v any, method, path, remoteAddr string) {
+	metrics.Panics.Inc(metrics.PanicHTTP)
+	slog.ErrorContext(ctx, "http handler panic recovered",
+		"method", method,
+		"path", path,
+		"remote_addr", remoteAddr,
+		"panic", fmt.Sprint(v),
+		"stack", string(debug.Stack()))
+}
+
+// recoverWriter registra se a resposta já começou, para o Recover saber se
+// ainda pode responder 500
+type recoverWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *recoverWriter) WriteHeader(status int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recoverWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush mantém o streaming do /payments/events
+func (w *recoverWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wroteHeader = true
+		f.Flush()
+	}
+}
+
+// Unwrap expõe o ResponseWriter original ao http.ResponseController
+func (w *recoverWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
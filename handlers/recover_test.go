@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+)
+
+func TestRecoverKeepsServing(t *testing.T) {
+	for _, eng := range engines {
+		t.Run(eng.name, func(t *testing.T) {
+			h, mux := newTestHandler(t, testConfig(t))
+			mux.HandleFunc("GET /boom", func(w http.ResponseWriter, r *http.Request) {
+				var payment *struct{ Amount int }
+				_ = payment.Amount // nil deref, como um bug em um handler
+			})
+			client, base := eng.start(t, h, mux)
+
+			before := metrics.Panics.Values()[metrics.PanicHTTP]
+			for range 3 {
+				resp, err := client.Get(base + "/boom")
+				if err != nil {
+					t.Fatalf("GET /boom: %v", err)
+				}
+				body, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusInternalServerError {
+					t.Fatalf("status = %d, want 500", resp.StatusCode)
+				}
+				if code := errorCode(t, body); code != codeInternal {
+					t.Errorf("code = %q, want %q", code, codeInternal)
+				}
+			}
+			if got := metrics.Panics.Values()[metrics.PanicHTTP] - before; got != 3 {
+				t.Errorf("http panics = %d, want 3", got)
+			}
+
+			// O servidor segue atendendo as demais rotas
+			resp, err := client.Post(base+"/payments", "application/json", strings.NewReader(validPayment))
+			if err != nil {
+				t.Fatalf("POST /payments after the panics: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusAccepted {
+				t.Fatalf("POST /payments after the panics = %d, want 202", resp.StatusCode)
+			}
+		})
+	}
+}
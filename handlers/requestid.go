@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/valyala/fasthttp"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+)
+
+// RequestID aceita o X-Request-Id recebido (ou gera um ULID quando ausente
+// ou inválido), devolve-o na resposta e o anexa ao contexto da requisição,
+// de onde vai para os logs, para a fila e para a chamada ao processador
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(logging.RequestIDHeader)
+		if !logging.ValidRequestID(id) {
+			id = logging.NewRequestID()
+		}
+		w.Header().Set(logging.RequestIDHeader, id)
+
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// fastRequestID faz o mesmo que o RequestID no fasthttp e retorna o
+// contexto para o núcleo dos handlers. Um id gerado também é gravado na
+// requisição, para as rotas repassadas ao net/http reaproveitarem o mesmo.
+func fastRequestID(ctx *fasthttp.RequestCtx) context.Context {
+	id := string(ctx.Request.Header.Peek(logging.RequestIDHeader))
+	if !logging.ValidRequestID(id) {
+		id = logging.NewRequestID()
+		ctx.Request.Header.Set(logging.RequestIDHeader, id)
+	}
+	ctx.Response.Header.Set(logging.RequestIDHeader, id)
+
+	return logging.WithRequestID(context.Background(), id)
+}
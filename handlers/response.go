@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// responder é o mínimo que o núcleo dos handlers usa para responder. É
+// implementado sobre o net/http e sobre o fasthttp, mantendo parse,
+// validação e enfileiramento independentes do servidor HTTP.
+type responder interface {
+	// JSON escreve um corpo JSON já serializado
+	JSON(status int, body []byte)
+	// Body escreve um corpo já serializado em outro formato (codec)
+	Body(status int, contentType string, body []byte)
+	// Error escreve o envelope de erro da API com o código estável e a
+	// mensagem
+	Error(status int, code, message string)
+	// SetHeader define um header da resposta; vale se chamado antes de
+	// JSON ou Error
+	SetHeader(key, value string)
+	// AddHeader acrescenta um valor ao header, mantendo os anteriores
+	AddHeader(key, value string)
+}
+
+// httpResponder adapta um http.ResponseWriter
+type httpResponder struct {
+	w http.ResponseWriter
+}
+
+// JSON escreve o corpo em um único Write
+func (r httpResponder) JSON(status int, body []byte) {
+	r.w.Header()["Content-Type"] = contentTypeJSON
+	r.w.WriteHeader(status)
+	r.w.Write(body)
+}
+
+// Body escreve o corpo com o Content-Type do formato em um único Write
+func (r httpResponder) Body(status int, contentType string, body []byte) {
+	r.w.Header()["Content-Type"] = []string{contentType}
+	r.w.WriteHeader(status)
+	r.w.Write(body)
+}
+
+// Error escreve o envelope de erro em um único Write
+func (r httpResponder) Error(status int, code, message string) {
+	writeErrorJSON(r, status, code, message)
+}
+
+// SetHeader define o header no ResponseWriter
+func (r httpResponder) SetHeader(key, value string) {
+	r.w.Header().Set(key, value)
+}
+
+// AddHeader acrescenta o valor ao header no ResponseWriter
+func (r httpResponder) AddHeader(key, value string) {
+	r.w.Header().Add(key, value)
+}
+
+// contentTypeJSON é compartilhado entre as respostas para evitar alocar o
+// slice do header a cada requisição; nunca deve ser modificado
+var contentTypeJSON = []string{"application/json"}
+
+// Partes fixas da resposta de aceite; apenas o id varia. Mesmo corpo que o
+// antigo map codificado com encoding/json, exceto pela ordem das chaves.
+const (
+	acceptedPrefix = `{"id":`
+	acceptedSuffix = `,"status":"accepted","message":"Payment queued for processing"}` + "\n"
+)
+
+// responsePool reaproveita os buffers das respostas do caminho quente
+var responsePool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// bodyPool reaproveita os buffers de leitura do corpo do POST /payments
+var bodyPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// writeAccepted escreve o 202 do payment enfileirado em um único Write
+func writeAccepted(res responder, correlationID string) {
+	buf := responsePool.Get().(*bytes.Buffer)
+	buf.Reset()
+
+	buf.WriteString(acceptedPrefix)
+	buf.Write(types.AppendJSONString(buf.AvailableBuffer(), correlationID))
+	buf.WriteString(acceptedSuffix)
+
+	res.JSON(http.StatusAccepted, buf.Bytes())
+
+	responsePool.Put(buf)
+}
+
+// writeErrorJSON monta o envelope de erro em um buffer do pool e o escreve
+// com res.JSON
+func writeErrorJSON(res responder, status int, code, message string) {
+	buf := responsePool.Get().(*bytes.Buffer)
+	buf.Reset()
+
+	buf.Write(appendError(buf.AvailableBuffer(), code, message))
+	res.JSON(status, buf.Bytes())
+
+	responsePool.Put(buf)
+}
+
+// writeJSON serializa v como o json.Encoder (com quebra de linha no fim)
+func writeJSON(res responder, status int, v any) {
+	buf := responsePool.Get().(*bytes.Buffer)
+	buf.Reset()
+
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		res.Error(http.StatusInternalServerError, codeInternal, "Internal server error")
+	} else {
+		res.JSON(status, buf.Bytes())
+	}
+
+	responsePool.Put(buf)
+}
+
+// newCorrelationID gera o id no formato req_<unix>_<n> com uma única alocação
+func newCorrelationID(now time.Time, n int64) string {
+	var b [40]byte
+	id := append(b[:0], "req_"...)
+	id = strconv.AppendInt(id, now.Unix(), 10)
+	id = append(id, '_')
+	id = strconv.AppendInt(id, n, 10)
+	return string(id)
+}
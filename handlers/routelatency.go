@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// Janela dos percentis por rota: 12 intervalos de 15s, cerca de 3 minutos
+const (
+	routeLatencySlot  = 15 * time.Second
+	routeLatencySlots = 12
+)
+
+// routeLatencyBounds vai de 10µs a ~13s com buckets 25% maiores a cada
+// passo; interpolando dentro do bucket o erro do percentil fica bem abaixo
+// disso
+var routeLatencyBounds = metrics.ExponentialBounds(0.00001, 1.25, 64)
+
+// trackedRoutes são as rotas medidas, na chave "MÉTODO caminho" usada no
+// JSON; as demais passam direto
+var trackedRoutes = []string{"POST /payments", "POST /payments/batch", "GET /payments-summary"}
+
+// RouteLatency mede a duração das requisições das rotas quentes dentro
+// deste processo, sem a fila do nginx, em percentis de uma janela
+// deslizante, e conta as requisições em andamento por rota. O caminho da
+// requisição faz só comparações de strings e operações atômicas; o lock do
+// WindowHistogram só é tomado na troca de intervalo.
+type RouteLatency struct {
+	routes []*routeStats // na ordem de trackedRoutes
+}
+
+type routeStats struct {
+	name     string
+	window   *metrics.WindowHistogram
+	inFlight atomic.Int64
+}
+
+// NewRouteLatency cria os medidores e registra o gauge
+// rinha_http_route_in_flight de cada rota
+func NewRouteLatency() *RouteLatency {
+	l := &RouteLatency{routes: make([]*routeStats, len(trackedRoutes))}
+	for i, name := range trackedRoutes {
+		route := &routeStats{
+			name:   name,
+			window: metrics.NewWindowHistogram(routeLatencyBounds, routeLatencySlot, routeLatencySlots),
+		}
+		l.routes[i] = route
+		metrics.RegisterGauge("rinha_http_route_in_flight", "Requisições em andamento por rota.", `route="`+name+`"`, func() float64 {
+			return float64(route.inFlight.Load())
+		})
+	}
+	return l
+}
+
+// route retorna o medidor da rota ou nil se ela não é medida
+func (l *RouteLatency) route(method, path string) *routeStats {
+	switch {
+	case path == "/payments" && method == http.MethodPost:
+		return l.routes[0]
+	case path == "/payments/batch" && method == http.MethodPost:
+		return l.routes[1]
+	case path == "/payments-summary" && method == http.MethodGet:
+		return l.routes[2]
+	}
+	return nil
+}
+
+// fastRoute é o route do fasthttp, sem copiar método e caminho
+func (l *RouteLatency) fastRoute(ctx *fasthttp.RequestCtx) *routeStats {
+	switch path := string(ctx.Path()); {
+	case path == "/payments" && ctx.IsPost():
+		return l.routes[0]
+	case path == "/payments/batch" && ctx.IsPost():
+		return l.routes[1]
+	case path == "/payments-summary" && ctx.IsGet():
+		return l.routes[2]
+	}
+	return nil
+}
+
+// Wrap envolve um handler net/http; com o RouteLatency nil retorna o
+// próprio handler
+func (l *RouteLatency) Wrap(next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := l.route(r.Method, r.URL.Path)
+		if route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		defer route.end(route.begin())
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WrapFastHTTP envolve o handler do fasthttp; com o RouteLatency nil
+// retorna o próprio handler
+func (l *RouteLatency) WrapFastHTTP(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	if l == nil {
+		return next
+	}
+
+	return func(ctx *fasthttp.RequestCtx) {
+		route := l.fastRoute(ctx)
+		if route == nil {
+			next(ctx)
+			return
+		}
+		defer route.end(route.begin())
+
+		next(ctx)
+	}
+}
+
+// begin conta a requisição em andamento e retorna o início, para o end
+func (r *routeStats) begin() time.Time {
+	r.inFlight.Add(1)
+	return time.Now()
+}
+
+// end registra a duração da requisição
+func (r *routeStats) end(start time.Time) {
+	r.window.Observe(time.Since(start))
+	r.inFlight.Add(-1)
+}
+
+// stats resume cada rota medida
+func (l *RouteLatency) stats() map[string]types.RouteLatency {
+	stats := make(map[string]types.RouteLatency, len(l.routes))
+	for _, route := range l.routes {
+		snap := route.window.Snapshot()
+		stats[route.name] = types.RouteLatency{
+			Count:         snap.Count,
+			InFlight:      route.inFlight.Load(),
+			P50Ms:         durationMs(snap.Quantile(0.50)),
+			P90Ms:         durationMs(snap.Quantile(0.90)),
+			P99Ms:         durationMs(snap.Quantile(0.99)),
+			MaxMs:         durationMs(snap.Max),
+			WindowSeconds: int(route.window.Window().Seconds()),
+		}
+	}
+	return stats
+}
+
+// durationMs converte para milissegundos com precisão de microssegundo
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// exactQuantile é o percentil q das amostras pelo método do posto mais
+// próximo, a referência para o estimado pelo histograma
+func exactQuantile(sorted []time.Duration, q float64) time.Duration {
+	i := int(math.Ceil(q*float64(len(sorted)))) - 1
+	return sorted[max(i, 0)]
+}
+
+func TestRouteLatencyPercentiles(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	tests := []struct {
+		name   string
+		sample func() time.Duration
+	}{
+		{"uniform 1ms to 1s", func() time.Duration {
+			return time.Millisecond + time.Duration(rng.Int63n(int64(time.Second)))
+		}},
+		{"exponential around 5ms", func() time.Duration {
+			return time.Duration(rng.ExpFloat64() * float64(5*time.Millisecond))
+		}},
+		{"log-normal with a long tail", func() time.Duration {
+			return time.Duration(math.Exp(rng.NormFloat64()) * float64(2*time.Millisecond))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandler(t, testConfig(t))
+			route := h.routeLatency.route(http.MethodPost, "/payments")
+
+			samples := make([]time.Duration, 20000)
+			for i := range samples {
+				samples[i] = max(tt.sample(), 20*time.Microsecond) // nada abaixo do 1º bucket
+				route.window.Observe(samples[i])
+			}
+			slices.Sort(samples)
+
+			got := h.routeLatency.stats()["POST /payments"]
+			if got.Count != int64(len(samples)) {
+				t.Fatalf("count = %d, want %d", got.Count, len(samples))
+			}
+			// Os buckets crescem 25% a cada passo; interpolando, o erro
+			// fica bem abaixo de um bucket
+			for _, p := range []struct {
+				q   float64
+				got float64
+			}{{0.50, got.P50Ms}, {0.90, got.P90Ms}, {0.99, got.P99Ms}} {
+				want := durationMs(exactQuantile(samples, p.q))
+				if math.Abs(p.got-want) > 0.10*want {
+					t.Errorf("p%.0f = %.3fms, want %.3fms ±10%%", p.q*100, p.got, want)
+				}
+			}
+			if want := durationMs(samples[len(samples)-1]); got.MaxMs != want {
+				t.Errorf("max = %.3fms, want %.3fms", got.MaxMs, want)
+			}
+		})
+	}
+}
+
+func TestRouteLatencyMiddleware(t *testing.T) {
+	h, mux := newTestHandler(t, testConfig(t))
+
+	// Um handler preso mostra a requisição em andamento na rota
+	release := make(chan struct{})
+	blocked := h.RouteLatency().Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	done := make(chan struct{})
+	go func() {
+		serve(blocked, "POST", "/payments", validPayment)
+		close(done)
+	}()
+	waitInFlight := func(want int64) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for h.routeLatency.stats()["POST /payments"].InFlight != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("in flight = %d, want %d", h.routeLatency.stats()["POST /payments"].InFlight, want)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	waitInFlight(1)
+	close(release)
+	<-done
+	waitInFlight(0)
+
+	// Pelas rotas de verdade: as medidas contam, as demais passam direto
+	wrapped := h.RouteLatency().Wrap(mux)
+	serve(wrapped, "POST", "/payments", validPayment)
+	serve(wrapped, "GET", "/payments-summary", "")
+	serve(wrapped, "GET", "/health", "")
+
+	rec := serve(mux, "GET", "/payments-summary?detailed=true", "")
+	var summary types.PaymentSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil || summary.Detail == nil {
+		t.Fatalf("detailed summary %s: %v", rec.Body, err)
+	}
+	want := map[string]int64{"POST /payments": 2, "POST /payments/batch": 0, "GET /payments-summary": 1}
+	if len(summary.Detail.Routes) != len(want) {
+		t.Errorf("routes = %v, want only %v", summary.Detail.Routes, want)
+	}
+	for name, count := range want {
+		route := summary.Detail.Routes[name]
+		if route.Count != count || route.InFlight != 0 {
+			t.Errorf("%s: count %d, in flight %d; want %d and 0", name, route.Count, route.InFlight, count)
+		}
+		if route.WindowSeconds != int((routeLatencySlot * routeLatencySlots).Seconds()) {
+			t.Errorf("%s: window = %ds, want %s", name, route.WindowSeconds, routeLatencySlot*routeLatencySlots)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"expvar"
+	"log/slog"
+	"net/http"
+
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/yurimachados/rinha-backend-go/cluster"
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/store"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// RegisterRoutes registra as rotas da API no mux com os padrões de método e
+// caminho do Go 1.22. Um método não registrado para o caminho recebe 405 com
+// o header Allow, montado pelo catch-all, então os handlers não conferem o
+// método. Com o CORS ligado, as rotas da configuração ganham os headers e
+// o OPTIONS do preflight.
+func (h *PaymentHandler) RegisterRoutes(mux *http.ServeMux) {
+	handle := func(method, path string, handler http.HandlerFunc) {
+		mux.HandleFunc(method+" "+path, h.withCORS(path, handler))
+	}
+
+	// Health check simples; com ?detail=true, o estado dos processadores
+	handle("GET", "/health", h.GetHealth)
+
+	// Liveness e readiness separados, para o balanceador tirar a instância
+	// com a fila saturada sem o orquestrador reiniciá-la
+	handle("GET", "/livez", h.GetLivez)
+	handle("GET", "/readyz", h.GetReadyz)
+
+	// Endpoint principal para payments
+	handle("POST", "/payments", h.PostPayments)
+	handle("POST", "/payments/batch", h.PostPaymentsBatch)
+	handle("GET", "/payments/{id}", h.GetPayment)
+
+	// Payments do store em páginas, do mais recente ao mais antigo
+	handle("GET", "/payments", h.GetPayments)
+
+	// Stream SSE dos payments finalizados, para acompanhar em tempo real
+	handle("GET", "/payments/events", h.GetPaymentEvents)
+
+	// Endpoint para estatísticas
+	handle("GET", "/payments-summary", h.GetPaymentsSummary)
+
+	// Métricas no formato do Prometheus
+	handle("GET", "/metrics", metrics.Handler)
+
+	// Summary local consultado pelas instâncias irmãs
+	handle("GET", internalSummaryPath, h.GetInternalSummary)
+
+	// Contadores por worker, para diagnosticar queda de vazão
+	handle("GET", "/admin/workers", h.GetAdminWorkers)
+
+	// Estado dos processadores
+	handle("GET", "/admin/processors", h.GetAdminProcessors)
+
+	// Conta dos payments aceitos contra desfechos, fila e em voo
+	handle("GET", "/admin/selfcheck", h.GetAdminSelfCheck)
+
+	// Leitura das regras de chaos, do log de chamadas, dos pesos e do shadow;
+	// as mudanças ficam em RegisterAdminRoutes
+	handle("GET", "/admin/chaos", h.GetAdminChaos)
+	handle("GET", "/admin/exchange-log", h.GetAdminExchangeLog)
+	handle("GET", "/admin/weights", h.GetAdminWeights)
+	handle("GET", "/admin/shadow", h.GetAdminShadow)
+
+	// Preflight das rotas com CORS ligado
+	h.registerPreflight(mux)
+
+	// Demais requisições: 404 ou 405 no mesmo envelope de erro da API
+	mux.HandleFunc("/", routeNotFound(mux))
+}
+
+// RegisterAdminRoutes registra as rotas de admin que mudam o estado da
+// instância (override dos processadores, pausa, capacidade, chaos, pesos...)
+// no mux do listener de admin (ADMIN_ADDR), nunca no público: quem alcança
+// a porta da API não consegue pausar os workers nem injetar falhas. As
+// leituras correspondentes seguem no mux público; o /debug/vars, que expõe
+// a linha de comando e o memstats, fica só aqui.
+func (h *PaymentHandler) RegisterAdminRoutes(mux *http.ServeMux) {
+	// Override manual do estado dos processadores, para simulações de incidente
+	mux.HandleFunc("POST /admin/processors/{name}/state", h.PostAdminProcessorState)
+
+	// Nova janela do summary sem restart, devolvendo os contadores da anterior
+	mux.HandleFunc("POST /admin/stats/reset", h.PostAdminStatsReset)
+
+	// Pausa o processamento mantendo o aceite, para deploys dos processadores
+	mux.HandleFunc("POST /admin/pause", h.PostAdminPause)
+	mux.HandleFunc("POST /admin/resume", h.PostAdminResume)
+
+	// Capacidade da fila sem restart, para acompanhar o aquecimento e o pico
+	mux.HandleFunc("POST /admin/queue/capacity", h.PostAdminQueueCapacity)
+
+	// Falhas injetadas nas chamadas aos processadores, com CHAOS
+	mux.HandleFunc("POST /admin/chaos", h.PostAdminChaos)
+
+	// Log das chamadas aos processadores, com amostragem temporária no incidente
+	mux.HandleFunc("POST /admin/exchange-log", h.PostAdminExchangeLog)
+
+	// Pesos do sorteio do primeiro processador, para migrar tráfego aos poucos
+	mux.HandleFunc("POST /admin/weights", h.PostAdminWeights)
+
+	// Cópia de parte dos payments ao fallback, para avaliá-lo sem afetar o resultado
+	mux.HandleFunc("POST /admin/shadow", h.PostAdminShadow)
+
+	// Contadores no formato do expvar, se ligado; junto com cmdline e memstats
+	if h.expvar {
+		mux.Handle("GET /debug/vars", expvar.Handler())
+	}
+
+	// Demais requisições: 404 ou 405 no mesmo envelope de erro da API
+	mux.HandleFunc("/", routeNotFound(mux))
+}
+
+// GetHealth responde ok com o papel da instância no health check dos
+// processadores. Sem query string é o caminho do orquestrador, sem ler
+// nada além do papel; com ?detail=true responde o HealthDetail.
+func (h *PaymentHandler) GetHealth(w http.ResponseWriter, r *http.Request) {
+	if r.URL.RawQuery != "" && r.URL.Query().Get("detail") == "true" {
+		h.getHealthDetail(w)
+		return
+	}
+
+	header := w.Header()
+	header["Content-Type"] = contentTypeText
+	header["X-Instance-Role"] = roleHeaders[h.Role()]
+	w.WriteHeader(http.StatusOK)
+	w.Write(healthOK)
+}
+
+// Valores fixos do GET /health, compartilhados entre as respostas como o
+// contentTypeJSON para o caminho do orquestrador não alocar; nunca devem
+// ser modificados
+var (
+	contentTypeText = []string{"text/plain"}
+	healthOK        = []byte("ok")
+	roleHeaders     = map[string][]string{
+		cluster.RoleStandalone: {cluster.RoleStandalone},
+		cluster.RoleLeader:     {cluster.RoleLeader},
+		cluster.RoleFollower:   {cluster.RoleFollower},
+	}
+)
+
+// getHealthDetail responde a saúde de cada processador, lida dos mesmos
+// campos que o roteamento usa, e a ocupação da fila
+func (h *PaymentHandler) getHealthDetail(w http.ResponseWriter) {
+	w.Header().Set("X-Instance-Role", h.Role())
+	writeJSON(httpResponder{w}, http.StatusOK, types.HealthDetail{
+		Status:     "ok",
+		Role:       h.Role(),
+		QueueDepth: h.workerPool.GetQueueSize(),
+		QueueSize:  h.workerPool.GetQueueCapacity(),
+		Workers:    h.workerPool.Workers(),
+		Processors: h.processor.ProcessorHealth(),
+	})
+}
+
+// paymentRecord é a resposta do GET /payments/{id}: o registro do store,
+// se o payment foi processado com sucesso, e o estado acompanhado por esta
+// instância, se ela o conhece
+type paymentRecord struct {
+	CorrelationID string `json:"correlationId"`
+	*store.Payment
+	Lifecycle *types.PaymentStatus `json:"lifecycle,omitempty"`
+}
+
+// EncodeMsgpack monta o mesmo mapa do JSON. O msgpack só achata um ponteiro
+// embutido sem campos sombreados, e o correlationId do registro sombreia o
+// do payment, então o payment vira um mapa antes.
+func (r paymentRecord) EncodeMsgpack(enc *msgpack.Encoder) error {
+	record := map[string]any{}
+	if r.Payment != nil {
+		if err := msgpackRoundTrip(r.Payment, &record); err != nil {
+			return err
+		}
+	}
+	record["correlationId"] = r.CorrelationID
+	if r.Lifecycle != nil {
+		record["lifecycle"] = r.Lifecycle
+	}
+	return enc.Encode(record)
+}
+
+// withoutRawReceipt tira do comprovante o corpo cru da resposta do
+// processador, que só sai com ?debug=true. O comprovante é copiado: o
+// store em memória devolve o mesmo ponteiro a todas as leituras.
+func withoutRawReceipt(p store.Payment) store.Payment {
+	if p.Receipt == nil || p.Receipt.Raw == "" {
+		return p
+	}
+	receipt := *p.Receipt
+	receipt.Raw = ""
+	if receipt.ID == "" && receipt.At == nil {
+		p.Receipt = nil
+	} else {
+		p.Receipt = &receipt
+	}
+	return p
+}
+
+// GetPayment busca um payment pelo correlationId no store e no
+// acompanhamento de estado; payments que nenhum dos dois conhece recebem
+// 404. Com ?debug=true o comprovante traz o corpo cru da resposta.
+func (h *PaymentHandler) GetPayment(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	payment, stored, err := h.store.Get(r.Context(), id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get payment",
+			logging.KeyCorrelationID, id,
+			"error", err)
+		writeError(w, http.StatusInternalServerError, codeInternal, "Internal server error")
+		return
+	}
+	status, tracked := h.workerPool.Lifecycle().Get(id)
+	if !stored && !tracked {
+		writeError(w, http.StatusNotFound, codePaymentNotFound, "Payment not found")
+		return
+	}
+
+	record := paymentRecord{CorrelationID: id}
+	if stored {
+		if r.URL.Query().Get("debug") != "true" {
+			payment = withoutRawReceipt(payment)
+		}
+		record.Payment = &payment
+	}
+	if tracked {
+		record.Lifecycle = &status
+	}
+
+	writeEncoded(httpResponder{w}, responseCodec(r.Header.Get("Accept")), http.StatusOK, record)
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+func TestRouteResolution(t *testing.T) {
+	_, mux := newTestHandler(t, testConfig(t))
+
+	tests := []struct {
+		method, path string
+		status       int
+		allow        string // Allow esperado no 405
+	}{
+		{"GET", "/health", http.StatusOK, ""},
+		{"GET", "/payments-summary", http.StatusOK, ""},
+		{"GET", "/payments/unknown-id", http.StatusNotFound, ""},
+		{"GET", "/admin/processors", http.StatusOK, ""},
+		{"GET", "/no-such-route", http.StatusNotFound, ""},
+		{"PUT", "/payments", http.StatusMethodNotAllowed, "GET, HEAD, POST"},
+		{"DELETE", "/payments/batch", http.StatusMethodNotAllowed, "GET, HEAD, POST"},
+		{"POST", "/payments-summary", http.StatusMethodNotAllowed, "GET, HEAD"},
+		// As rotas de admin que mudam estado ficam fora do mux público
+		{"POST", "/admin/processors/default/state", http.StatusNotFound, ""},
+		{"POST", "/admin/pause", http.StatusNotFound, ""},
+		{"POST", "/admin/chaos", http.StatusMethodNotAllowed, "GET, HEAD"},
+		// O pprof só existe no listener do PPROF_ADDR
+		{"GET", "/debug/pprof/heap", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			body := ""
+			if tt.method == "POST" {
+				body = `{"state":"down"}`
+			}
+			rec := serve(mux, tt.method, tt.path, body)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.status, rec.Body)
+			}
+			if got := rec.Header().Get("Allow"); got != tt.allow {
+				t.Errorf("Allow = %q, want %q", got, tt.allow)
+			}
+			if rec.Code >= 400 {
+				var resp types.ErrorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Error.Code == "" {
+					t.Errorf("body %s is not an error envelope", rec.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestAdminRoutesOnAdminMux(t *testing.T) {
+	h, _ := newTestHandler(t, testConfig(t))
+	admin := http.NewServeMux()
+	h.RegisterAdminRoutes(admin)
+
+	tests := []struct {
+		method, path, body string
+		status             int
+	}{
+		{"POST", "/admin/processors/default/state", `{"state":"unhealthy"}`, http.StatusOK},
+		{"POST", "/admin/processors/unknown/state", `{"state":"unhealthy"}`, http.StatusNotFound},
+		{"POST", "/admin/pause", "", http.StatusOK},
+		{"POST", "/admin/resume", "", http.StatusOK},
+		{"GET", "/admin/pause", "", http.StatusMethodNotAllowed},
+		// A API pública não é servida no listener de admin
+		{"POST", "/payments", validPayment, http.StatusNotFound},
+		{"GET", "/payments-summary", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			if rec := serve(admin, tt.method, tt.path, tt.body); rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
+
+func TestMethodNotAllowedCountsIngestOnly(t *testing.T) {
+	_, mux := newTestHandler(t, testConfig(t))
+
+	before := metrics.PaymentsRejected.Values()[metrics.ReasonMethodNotAllowed]
+	serve(mux, "PUT", "/payments", "")
+	serve(mux, "PATCH", "/payments/batch", "")
+	serve(mux, "POST", "/payments-summary", "")
+	if got := metrics.PaymentsRejected.Values()[metrics.ReasonMethodNotAllowed] - before; got != 2 {
+		t.Fatalf("method_not_allowed rejections = %d, want 2", got)
+	}
+}
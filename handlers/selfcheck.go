@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// Folga padrão da conta do self-check e leituras feitas antes de concluir
+// que ela não fecha. Um payment em trânsito entre duas leituras (recém
+// aceito, ou contado no desfecho antes de sair dos em voo) desloca a conta
+// por um instante; uma nova leitura logo depois já não o vê.
+const (
+	selfCheckTolerance = 10
+	selfCheckSamples   = 3
+)
+
+// selfCheckStoreTimeout limita a agregação do store, que no Postgres é uma
+// consulta
+const selfCheckStoreTimeout = 500 * time.Millisecond
+
+// selfCheckDelta retorna accepted menos os demais termos da conta
+func selfCheckDelta(c types.SelfCheck) int64 {
+	return c.Accepted - (c.DefaultSuccess + c.FallbackSuccess + c.TotalErrors + c.TotalExpired + c.Queued + c.InFlight)
+}
+
+// sampleSelfCheck lê os termos da conta do fim do caminho para o começo:
+// desfechos, em voo, fila e, por último, os aceitos. Um payment que anda
+// durante a leitura tende a ser visto numa etapa já lida, não em duas, e
+// os que chegam durante ela entram só nos aceitos; o desvio de uma leitura
+// é quase sempre de alguns payments a mais em accepted. A exceção é o
+// payment já contado no desfecho e ainda não retirado dos em voo, que pode
+// aparecer nos dois por um instante.
+func (h *PaymentHandler) sampleSelfCheck() types.SelfCheck {
+	summary := h.processor.LifetimeSummary()
+	c := types.SelfCheck{
+		DefaultSuccess:  summary.DefaultSuccess,
+		FallbackSuccess: summary.FallbackSuccess,
+		TotalErrors:     summary.TotalErrors,
+		TotalExpired:    summary.TotalExpired,
+	}
+	c.InFlight = h.workerPool.InFlight()
+	c.Queued = int64(h.workerPool.GetQueueSize())
+	c.Enqueued = h.workerPool.Enqueued()
+	c.Inline = metrics.PaymentsInline.Value()
+	c.Sync = metrics.PaymentsSync.Value()
+	c.Accepted = c.Enqueued + c.Inline + c.Sync
+	c.Delta = selfCheckDelta(c)
+	return c
+}
+
+// selfCheck lê a conta até ela fechar dentro de tolerance, no máximo
+// selfCheckSamples vezes, e fica com a leitura de menor desvio
+func (h *PaymentHandler) selfCheck(tolerance int64) types.SelfCheck {
+	var best types.SelfCheck
+	samples := 0
+	for samples < selfCheckSamples {
+		c := h.sampleSelfCheck()
+		samples++
+		if samples == 1 || abs(c.Delta) < abs(best.Delta) {
+			best = c
+		}
+		if abs(best.Delta) <= tolerance {
+			break
+		}
+	}
+	best.Samples = samples
+	best.Tolerance = tolerance
+	best.Consistent = abs(best.Delta) <= tolerance
+	best.Exact = !h.workerPool.SharedQueue()
+	return best
+}
+
+// storeCheck compara os registros do store com os sucessos contados. O
+// store em memória guarda só os mais recentes e o Postgres grava em lote
+// (e é compartilhado entre instâncias), então a diferença é informativa e
+// fica fora da conta.
+func (h *PaymentHandler) storeCheck(ctx context.Context, c types.SelfCheck) *types.SelfCheckStore {
+	ctx, cancel := context.WithTimeout(ctx, selfCheckStoreTimeout)
+	defer cancel()
+
+	totals, err := h.store.Aggregate(ctx, time.Time{}, time.Now().Add(time.Hour))
+	if err != nil {
+		h.logger.Warn("self-check could not read the store", "error", err)
+		return nil
+	}
+	stored := &types.SelfCheckStore{
+		Default:  totals["default"].TotalRequests,
+		Fallback: totals["fallback"].TotalRequests,
+	}
+	stored.Lag = c.DefaultSuccess + c.FallbackSuccess - stored.Default - stored.Fallback
+	return stored
+}
+
+// GetAdminSelfCheck confere se cada payment aceito por esta instância está
+// em exatamente um lugar: nos sucessos, nos erros, nos vencidos, na fila ou
+// em voo. ?tolerance=N troca a folga padrão. Fora da folga loga um aviso
+// com os termos; com a fila no Redis a conta só fecha somando as
+// instâncias, então o aviso não é logado.
+func (h *PaymentHandler) GetAdminSelfCheck(w http.ResponseWriter, r *http.Request) {
+	tolerance := int64(selfCheckTolerance)
+	if raw := r.URL.Query().Get("tolerance"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, codeInvalidParameter, "Invalid tolerance")
+			return
+		}
+		tolerance = n
+	}
+
+	check := h.selfCheck(tolerance)
+	check.Store = h.storeCheck(r.Context(), check)
+
+	if !check.Consistent && check.Exact {
+		h.logger.Warn("self-check found inconsistent counters",
+			"delta", check.Delta,
+			"tolerance", check.Tolerance,
+			"accepted", check.Accepted,
+			"default_success", check.DefaultSuccess,
+			"fallback_success", check.FallbackSuccess,
+			"total_errors", check.TotalErrors,
+			"total_expired", check.TotalExpired,
+			"queued", check.Queued,
+			"in_flight", check.InFlight)
+	}
+
+	res := h.compressible(httpResponder{w}, r.Header.Get("Accept-Encoding"))
+	writeJSON(res, http.StatusOK, check)
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
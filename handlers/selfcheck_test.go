@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+func TestSelfCheckDelta(t *testing.T) {
+	balanced := types.SelfCheck{
+		Accepted:        100,
+		DefaultSuccess:  60,
+		FallbackSuccess: 20,
+		TotalErrors:     5,
+		TotalExpired:    3,
+		Queued:          10,
+		InFlight:        2,
+	}
+	tests := []struct {
+		name   string
+		modify func(*types.SelfCheck)
+		want   int64
+	}{
+		{"balanced", func(*types.SelfCheck) {}, 0},
+		{"success counted twice", func(c *types.SelfCheck) { c.DefaultSuccess++ }, -1},
+		{"in flight and finished at once", func(c *types.SelfCheck) { c.InFlight++ }, -1},
+		{"payment lost between queue and outcome", func(c *types.SelfCheck) { c.Queued-- }, 1},
+		{"accepted during the read", func(c *types.SelfCheck) { c.Accepted += 3 }, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := balanced
+			tt.modify(&c)
+			if got := selfCheckDelta(c); got != tt.want {
+				t.Errorf("delta = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// getSelfCheck consulta o GET /admin/selfcheck
+func getSelfCheck(t *testing.T, mux http.Handler, target string) types.SelfCheck {
+	t.Helper()
+	rec := serve(mux, "GET", target, "")
+	if rec.Code != http.StatusOK {
+		t.Errorf("%s = %d (body %s)", target, rec.Code, rec.Body)
+		return types.SelfCheck{}
+	}
+	var check types.SelfCheck
+	if err := json.Unmarshal(rec.Body.Bytes(), &check); err != nil {
+		t.Errorf("%s: %v", target, err)
+	}
+	return check
+}
+
+func TestSelfCheckUnderLoad(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Pool.Workers = 4
+	h, mux := newTestHandler(t, cfg, func(h *PaymentHandler) { h.EnableSyncMode(4, 5*time.Second) })
+
+	// Inline e sync são métricas do processo, já contadas por outros
+	// testes: a conta desta instância parte do desvio que elas deixaram
+	base := getSelfCheck(t, mux, "/admin/selfcheck?tolerance=0")
+	if base.Accepted != base.Inline+base.Sync || base.Delta != base.Inline+base.Sync || !base.Exact {
+		t.Fatalf("fresh instance: %+v, want nothing but the process-wide inline and sync counts", base)
+	}
+
+	const clients, perClient = 8, 50
+	var wg sync.WaitGroup
+	for c := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perClient {
+				target := "/payments"
+				if c == 0 && i%5 == 0 {
+					target += "?sync=true"
+				}
+				if rec := serve(mux, "POST", target, validPayment); rec.Code >= 300 {
+					t.Errorf("POST %s = %d (body %s)", target, rec.Code, rec.Body)
+					return
+				}
+			}
+		}()
+	}
+
+	// Consultas durante a carga: o trânsito entre as leituras fica na folga
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	polls := 0
+	for running := true; running; polls++ {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		check := getSelfCheck(t, mux, "/admin/selfcheck")
+		if drift := check.Delta - base.Delta; abs(drift) > selfCheckTolerance || check.Samples > selfCheckSamples {
+			t.Fatalf("poll %d drifted by %d in %d samples: %+v", polls, drift, check.Samples, check)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Drenada a fila, a conta fecha exata
+	deadline := time.Now().Add(5 * time.Second)
+	for h.workerPool.GetQueueSize() > 0 || h.workerPool.InFlight() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("queue never drained")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	check := getSelfCheck(t, mux, "/admin/selfcheck?tolerance=0")
+	if check.Delta != base.Delta {
+		t.Fatalf("drained: delta %d, want %d: %+v", check.Delta, base.Delta, check)
+	}
+	if got := check.Accepted - base.Accepted; got != clients*perClient {
+		t.Errorf("accepted %d, want the %d submitted", got, clients*perClient)
+	}
+	if check.Sync-base.Sync != perClient/5 {
+		t.Errorf("sync = %d, want %d", check.Sync-base.Sync, perClient/5)
+	}
+	successes := check.DefaultSuccess + check.FallbackSuccess
+	if check.Store == nil || check.Store.Default+check.Store.Fallback != successes || check.Store.Lag != 0 {
+		t.Errorf("store = %+v, want every one of the %d successes recorded", check.Store, successes)
+	}
+	t.Logf("%d polls during the load", polls)
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/queue"
+)
+
+// ReportShutdown loga o relatório do desligamento em um único registro e,
+// com SHUTDOWN_REPORT_FILE, o grava em arquivo para o post-mortem. forced
+// indica que o processo vai sair sem esperar o fim do Stop (segundo
+// sinal). Só a primeira chamada vale: o segundo sinal pode chegar depois
+// de o desligamento normal já ter relatado.
+func (h *PaymentHandler) ReportShutdown(forced bool) {
+	h.reportOnce.Do(func() {
+		report := h.workerPool.ShutdownReport()
+		report.Forced = forced
+		report.Ingress = ingressStats()
+		report.Panics = metrics.Panics.Values()
+
+		// Payments sem desfecho merecem atenção; uma drenagem limpa, não
+		level := slog.LevelInfo
+		if forced || report.Queue.InFlight != 0 || report.Queue.Unaccounted != 0 || report.Queue.QueuedAction == queue.QueuedDropped {
+			level = slog.LevelWarn
+		}
+		h.logger.Log(context.Background(), level, "shutdown report", "report", report)
+
+		if h.reportPath == "" {
+			return
+		}
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err == nil {
+			err = os.WriteFile(h.reportPath, append(data, '\n'), 0o644)
+		}
+		if err != nil {
+			h.logger.Error("failed to write shutdown report", "path", h.reportPath, "error", err)
+		}
+	})
+}
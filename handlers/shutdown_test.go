@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/config"
+	"github.com/yurimachados/rinha-backend-go/queue"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// slowShutdownConfig aponta o processador padrão para um servidor que leva
+// delay por payment, com workers que pegam um payment por vez e o
+// relatório do desligamento gravado em arquivo
+func slowShutdownConfig(t *testing.T, workers int, delay time.Duration) config.Config {
+	t.Helper()
+	processor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			time.Sleep(delay)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message":"payment processed successfully"}`))
+	}))
+	t.Cleanup(processor.Close)
+
+	cfg := testConfig(t)
+	cfg.Processors.DefaultURL = processor.URL + "/payments"
+	cfg.Pool.Workers, cfg.Pool.QueueSize = workers, 100
+	cfg.Pool.BatchSize, cfg.Pool.BatchParallelism = 1, 1
+	cfg.Pool.Autoscale = false
+	cfg.Server.ShutdownReportFile = filepath.Join(t.TempDir(), "shutdown-report.json")
+	return cfg
+}
+
+// submitPayments aceita n payments pelo POST /payments
+func submitPayments(t *testing.T, mux http.Handler, n int) {
+	t.Helper()
+	for i := range n {
+		if rec := serve(mux, "POST", "/payments", validPayment); rec.Code != http.StatusAccepted {
+			t.Fatalf("payment %d: status %d, want 202 (body %s)", i, rec.Code, rec.Body)
+		}
+	}
+}
+
+// shutdownReport lê o relatório gravado no SHUTDOWN_REPORT_FILE
+func shutdownReport(t *testing.T, cfg config.Config) types.ShutdownReport {
+	t.Helper()
+	data, err := os.ReadFile(cfg.Server.ShutdownReportFile)
+	if err != nil {
+		t.Fatalf("no shutdown report file: %v", err)
+	}
+	var report types.ShutdownReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("shutdown report %s: %v", data, err)
+	}
+	return report
+}
+
+// assertReconciles confere que cada payment aceito tem um destino no
+// relatório, sem sobra nem falta
+func assertReconciles(t *testing.T, report types.ShutdownReport, submitted int64) {
+	t.Helper()
+	q := report.Queue
+	if q.Enqueued != submitted {
+		t.Errorf("enqueued = %d, want the %d submitted", q.Enqueued, submitted)
+	}
+	if total := q.Finished + int64(q.Queued) + q.InFlight; total != submitted || q.Unaccounted != 0 {
+		t.Errorf("finished %d + queued %d + in flight %d = %d (unaccounted %d), want %d",
+			q.Finished, q.Queued, q.InFlight, total, q.Unaccounted, submitted)
+	}
+	if w := report.Workers; w.Processed+w.Failed+w.Expired != q.Finished {
+		t.Errorf("worker totals %+v do not add up to finished %d", w, q.Finished)
+	}
+	if d := report.Drain; d.Processed+d.Failed+d.Expired > q.Finished {
+		t.Errorf("drained %+v, more than the %d finished", d, q.Finished)
+	}
+	if (q.Queued == 0) != (q.QueuedAction == "") {
+		t.Errorf("%d queued with action %q", q.Queued, q.QueuedAction)
+	}
+}
+
+func TestShutdownReportReconciles(t *testing.T) {
+	tests := []struct {
+		name       string
+		spill      bool
+		wantAction string
+	}{
+		{"queue dropped", false, queue.QueuedDropped},
+		{"queue spilled", true, queue.QueuedSpilled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := slowShutdownConfig(t, 2, 30*time.Millisecond)
+			if tt.spill {
+				cfg.Pool.SpillPath = filepath.Join(t.TempDir(), "queue-spill.jsonl")
+			}
+			h, mux := newTestHandler(t, cfg)
+
+			const submitted = 40
+			submitPayments(t, mux, submitted)
+			finished := func() int64 {
+				pool := h.workerPool
+				return pool.Enqueued() - int64(pool.GetQueueSize()) - pool.InFlight()
+			}
+			waitFinished := func(n int64) {
+				t.Helper()
+				deadline := time.Now().Add(2 * time.Second)
+				for finished() < n {
+					if time.Now().After(deadline) {
+						t.Fatalf("%d payments finished, want %d", finished(), n)
+					}
+					time.Sleep(time.Millisecond)
+				}
+			}
+
+			// Parte processada antes do sinal e parte durante a drenagem
+			waitFinished(2)
+			h.BeginShutdown()
+			waitFinished(finished() + 2)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			h.Stop(ctx)
+			h.ReportShutdown(false)
+
+			report := shutdownReport(t, cfg)
+			assertReconciles(t, report, submitted)
+			if report.Forced || !report.WorkersStopped {
+				t.Errorf("forced %v, workers stopped %v; want a clean stop", report.Forced, report.WorkersStopped)
+			}
+			if report.Queue.InFlight != 0 {
+				t.Errorf("%d in flight after the workers stopped", report.Queue.InFlight)
+			}
+			if report.Drain.Processed == 0 || report.Drain.Processed == report.Queue.Finished {
+				t.Errorf("drained %d of %d finished, want some before and some after the signal",
+					report.Drain.Processed, report.Queue.Finished)
+			}
+			if report.Queue.Queued == 0 || report.Queue.QueuedAction != tt.wantAction {
+				t.Fatalf("%d queued, action %q; want the slow processor to leave some %s",
+					report.Queue.Queued, report.Queue.QueuedAction, tt.wantAction)
+			}
+			if tt.spill {
+				data, err := os.ReadFile(cfg.Pool.SpillPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if lines := bytes.Count(data, []byte("\n")); lines != report.Queue.Queued {
+					t.Errorf("spill file has %d payments, report says %d", lines, report.Queue.Queued)
+				}
+			}
+		})
+	}
+}
+
+func TestForcedShutdownReport(t *testing.T) {
+	cfg := slowShutdownConfig(t, 1, 300*time.Millisecond)
+	h, mux := newTestHandler(t, cfg)
+
+	const submitted = 10
+	submitPayments(t, mux, submitted)
+	// O worker preso no primeiro payment
+	for deadline := time.Now().Add(time.Second); h.workerPool.InFlight() == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("the worker never took a payment")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Segundo sinal: o processo desiste de esperar e relata assim mesmo
+	h.BeginShutdown()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	h.Stop(ctx)
+	h.ReportShutdown(true)
+	h.ReportShutdown(false) // o desligamento normal chega depois e não relata de novo
+
+	report := shutdownReport(t, cfg)
+	assertReconciles(t, report, submitted)
+	if !report.Forced || report.WorkersStopped {
+		t.Errorf("forced %v, workers stopped %v; want a forced report before the workers stopped", report.Forced, report.WorkersStopped)
+	}
+	if report.Queue.InFlight != 1 || report.Queue.Finished != 0 {
+		t.Errorf("%d in flight and %d finished at the deadline, want the 1 payment at the processor",
+			report.Queue.InFlight, report.Queue.Finished)
+	}
+	if report.Queue.Queued != submitted-1 {
+		t.Errorf("queued = %d, want the %d the worker never took", report.Queue.Queued, submitted-1)
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// windowIngress são os contadores de entrada desde o último reset. Como os
+// do processor, os contadores do /metrics nunca voltam a zero: o reset só
+// guarda a base a descontar.
+func (h *PaymentHandler) windowIngress() types.IngressStats {
+	base := h.ingressBase.Load()
+	current := ingressStats()
+	if base == nil {
+		return current
+	}
+	return ingressDelta(current, *base)
+}
+
+// ingressDelta retorna os contadores de current menos os de base
+func ingressDelta(current, base types.IngressStats) types.IngressStats {
+	delta := types.IngressStats{
+		Accepted: current.Accepted - base.Accepted,
+		Inline:   current.Inline - base.Inline,
+		Sync:     current.Sync - base.Sync,
+		Rejected: make(map[string]int64, len(current.Rejected)),
+		ByType:   make(map[string]int64, len(current.ByType)),
+	}
+	for reason, n := range current.Rejected {
+		delta.Rejected[reason] = n - base.Rejected[reason]
+	}
+	for paymentType, n := range current.ByType {
+		delta.ByType[paymentType] = n - base.ByType[paymentType]
+	}
+	return delta
+}
+
+// PostAdminStatsReset começa uma nova janela para o summary e os contadores
+// de entrada desta instância, sem reiniciar o processo, e responde com os
+// valores da janela encerrada. O /metrics e o self-check seguem contando
+// desde o boot, e o summary compartilhado no Redis não é zerado.
+func (h *PaymentHandler) PostAdminStatsReset(w http.ResponseWriter, r *http.Request) {
+	reset := h.processor.ResetStats()
+
+	base := ingressStats()
+	reset.Ingress = base
+	if previous := h.ingressBase.Swap(&base); previous != nil {
+		reset.Ingress = ingressDelta(base, *previous)
+	}
+
+	h.logger.Info("stats reset",
+		"since", reset.Summary.Since,
+		"total_payments", reset.Summary.TotalPayments,
+		"carried_over", reset.CarriedOver)
+
+	writeJSON(httpResponder{w}, http.StatusOK, reset)
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// syncWriteMargin é a folga deixada do WriteTimeout do servidor para a
+// resposta síncrona ainda ser escrita depois do processamento
+const syncWriteMargin = 250 * time.Millisecond
+
+// processingModeHeader informa, nos pedidos síncronos, se o payment foi
+// processado na requisição (sync) ou enfileirado por falta de vaga (async)
+const processingModeHeader = "X-Processing-Mode"
+
+// EnableSyncMode libera o POST /payments?sync=true (ou com X-Sync: true),
+// que processa o payment na requisição e responde com o resultado final. No
+// máximo maxConcurrent pedidos são atendidos assim ao mesmo tempo; os
+// demais seguem pela fila. writeTimeout é o do servidor HTTP; maxConcurrent
+// zero mantém o modo desligado e o pedido é ignorado.
+func (h *PaymentHandler) EnableSyncMode(maxConcurrent int, writeTimeout time.Duration) {
+	if maxConcurrent == 0 {
+		return
+	}
+	if maxConcurrent < 0 || writeTimeout <= syncWriteMargin {
+		slog.Warn("invalid sync mode settings, sync mode disabled",
+			"max_concurrent", maxConcurrent,
+			"write_timeout_ms", writeTimeout.Milliseconds())
+		return
+	}
+	h.syncSlots = make(chan struct{}, maxConcurrent)
+	h.syncTimeout = writeTimeout - syncWriteMargin
+}
+
+// wantsSync indica se o cliente pediu o processamento síncrono
+func wantsSync(query, header string) bool {
+	return query == "true" || header == "true"
+}
+
+// ingestSync processa o payment na requisição e responde 200 com o
+// processador ou 502 com a classe da falha. handled é false quando o modo
+// está desligado, sem vaga ou com o processamento pausado, e então o
+// payment segue pela fila.
+func (h *PaymentHandler) ingestSync(ctx context.Context, payment *types.PaymentRequest, res responder) (handled bool) {
+	if h.syncSlots == nil || h.workerPool.Paused() {
+		return false
+	}
+
+	select {
+	case h.syncSlots <- struct{}{}:
+		defer func() { <-h.syncSlots }()
+	default:
+		return false
+	}
+
+	if err := h.prepare(payment); err != nil {
+		metrics.PaymentsRejected.Inc(metrics.ReasonValidation)
+		res.Error(http.StatusBadRequest, validationCode(err), err.Error())
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.syncTimeout)
+	defer cancel()
+
+	// Mesmo roteamento e contabilização do caminho pela fila
+	result := h.processNow(ctx, payment)
+	metrics.PaymentsSync.Inc()
+	h.paymentTypes.count(payment.Type)
+	res.SetHeader(processingModeHeader, "sync")
+
+	if !result.Success {
+		if ok, n := logging.DefaultSampler().Allow("sync_failed:" + result.Reason); ok {
+			h.logger.ErrorContext(ctx, "sync payment processing failed",
+				logging.KeyCorrelationID, payment.CorrelationID,
+				logging.KeyReason, result.Reason,
+				logging.KeyOccurrences, n)
+		}
+		writeJSON(res, http.StatusBadGateway, types.PaymentResponse{
+			ID:          payment.CorrelationID,
+			Status:      "failed",
+			ProcessedBy: result.ProcessorID,
+			Reason:      result.Reason,
+			Error:       &types.ErrorDetail{Code: codeProcessingFailed, Message: "Payment processing failed"},
+		})
+		return true
+	}
+
+	writeJSON(res, http.StatusOK, types.PaymentResponse{
+		ID:          payment.CorrelationID,
+		Status:      "processed",
+		ProcessedBy: result.ProcessorID,
+	})
+	return true
+}
@@ -0,0 +1,143 @@
+package limits
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cgroupRoot é onde o cgroup do container é montado
+const cgroupRoot = "/sys/fs/cgroup"
+
+// v1Unlimited: no cgroup v1 "sem limite" aparece como um valor próximo de
+// MaxInt64 arredondado para a página; qualquer coisa acima disso é ilimitado
+const v1Unlimited = 1 << 62
+
+// Cgroup traz os limites lidos do cgroup. Zero significa sem limite.
+type Cgroup struct {
+	Version     int     // 1 ou 2; 0 se nenhum cgroup foi encontrado
+	CPUQuota    float64 // em CPUs (ex: 1.5)
+	MemoryLimit int64   // em bytes
+}
+
+// ReadCgroup lê os limites de CPU e memória sob root, tentando o cgroup v2
+// (arquivo unificado cpu.max) e depois o v1 (controladores separados)
+func ReadCgroup(root string) (Cgroup, error) {
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		return readCgroupV2(root)
+	}
+	if _, err := os.Stat(filepath.Join(root, "cpu")); err == nil {
+		return readCgroupV1(root)
+	}
+	if _, err := os.Stat(filepath.Join(root, "memory")); err == nil {
+		return readCgroupV1(root)
+	}
+	return Cgroup{}, nil
+}
+
+// readCgroupV2 lê cpu.max ("<quota> <período>" ou "max <período>") e
+// memory.max ("<bytes>" ou "max")
+func readCgroupV2(root string) (Cgroup, error) {
+	cg := Cgroup{Version: 2}
+
+	if line, err := readFirstLine(filepath.Join(root, "cpu.max")); err == nil {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || len(fields) > 2 {
+			return cg, errors.New("cgroup v2: malformed cpu.max")
+		}
+		if fields[0] != "max" {
+			quota, err := strconv.ParseFloat(fields[0], 64)
+			if err != nil {
+				return cg, err
+			}
+			period := 100000.0 // padrão do kernel quando omitido
+			if len(fields) == 2 {
+				if period, err = strconv.ParseFloat(fields[1], 64); err != nil {
+					return cg, err
+				}
+			}
+			if quota > 0 && period > 0 {
+				cg.CPUQuota = quota / period
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return cg, err
+	}
+
+	if line, err := readFirstLine(filepath.Join(root, "memory.max")); err == nil {
+		if line != "max" {
+			limit, err := strconv.ParseInt(line, 10, 64)
+			if err != nil {
+				return cg, err
+			}
+			cg.MemoryLimit = limit
+		}
+	} else if !os.IsNotExist(err) {
+		return cg, err
+	}
+
+	return cg, nil
+}
+
+// readCgroupV1 lê cpu.cfs_quota_us/cpu.cfs_period_us (quota -1 é ilimitado)
+// e memory.limit_in_bytes
+func readCgroupV1(root string) (Cgroup, error) {
+	cg := Cgroup{Version: 1}
+
+	for _, dir := range []string{"cpu", "cpu,cpuacct"} {
+		quota, err := readInt(filepath.Join(root, dir, "cpu.cfs_quota_us"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return cg, err
+		}
+		period, err := readInt(filepath.Join(root, dir, "cpu.cfs_period_us"))
+		if err != nil {
+			return cg, err
+		}
+		if quota > 0 && period > 0 {
+			cg.CPUQuota = float64(quota) / float64(period)
+		}
+		break
+	}
+
+	limit, err := readInt(filepath.Join(root, "memory", "memory.limit_in_bytes"))
+	if err == nil {
+		if limit > 0 && limit < v1Unlimited {
+			cg.MemoryLimit = limit
+		}
+	} else if !os.IsNotExist(err) {
+		return cg, err
+	}
+
+	return cg, nil
+}
+
+func readInt(path string) (int64, error) {
+	line, err := readFirstLine(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(line, 10, 64)
+}
+
+func readFirstLine(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", errors.New("empty file: " + path)
+	}
+	return strings.TrimSpace(scanner.Text()), nil
+}
@@ -0,0 +1,71 @@
+package limits
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestReadCgroup(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    Cgroup
+		wantErr bool
+	}{
+		{"v2-limited", Cgroup{Version: 2, CPUQuota: 1.5, MemoryLimit: 367001600}, false},
+		{"v2-unlimited", Cgroup{Version: 2}, false},
+		{"v2-default-period", Cgroup{Version: 2, CPUQuota: 0.5}, false},
+		{"v2-malformed", Cgroup{Version: 2}, true},
+		{"v2-bad-memory", Cgroup{Version: 2}, true},
+		{"v1-limited", Cgroup{Version: 1, CPUQuota: 1.5, MemoryLimit: 367001600}, false},
+		{"v1-unlimited", Cgroup{Version: 1}, false},
+		{"v1-cpuacct", Cgroup{Version: 1, CPUQuota: 2, MemoryLimit: 536870912}, false},
+		{"v1-memory-only", Cgroup{Version: 1, MemoryLimit: 268435456}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			got, err := ReadCgroup(filepath.Join("testdata", tt.fixture))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadCgroup() error = %v, want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ReadCgroup() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadCgroupWithoutCgroup(t *testing.T) {
+	got, err := ReadCgroup(t.TempDir())
+	if err != nil || got != (Cgroup{}) {
+		t.Fatalf("ReadCgroup() = %+v, %v; want no limits and no error", got, err)
+	}
+}
+
+func TestEffectiveSettings(t *testing.T) {
+	procs := []struct {
+		quota float64
+		want  int
+	}{{0.5, 1}, {1, 1}, {1.5, 1}, {2, 2}, {3.9, 3}}
+	for _, tt := range procs {
+		if got := quotaToProcs(tt.quota); got != tt.want {
+			t.Errorf("quotaToProcs(%v) = %d, want %d", tt.quota, got, tt.want)
+		}
+	}
+
+	memory := []struct {
+		limit    int64
+		headroom int
+		want     int64
+	}{
+		{1000, 10, 900},
+		{1000, 0, 1000},
+		{1000, 99, 10},
+		{1000, 100, 900}, // fora do intervalo volta aos 10%
+		{1000, -1, 900},
+	}
+	for _, tt := range memory {
+		if got := memoryLimit(tt.limit, tt.headroom); got != tt.want {
+			t.Errorf("memoryLimit(%d, %d) = %d, want %d", tt.limit, tt.headroom, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package limits
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// ProcessCPUTime não é suportado nesta plataforma
+func ProcessCPUTime() (time.Duration, error) {
+	return 0, fmt.Errorf("process CPU time is not supported on %s", runtime.GOOS)
+}
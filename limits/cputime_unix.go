@@ -0,0 +1,18 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package limits
+
+import (
+	"syscall"
+	"time"
+)
+
+// ProcessCPUTime retorna o tempo de CPU consumido pelo processo desde o
+// start, em modo usuário e kernel, pelo getrusage
+func ProcessCPUTime() (time.Duration, error) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0, err
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano()), nil
+}
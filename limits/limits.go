@@ -0,0 +1,86 @@
+// Package limits ajusta o runtime aos limites do container: GOMAXPROCS a
+// partir da quota de CPU do cgroup e GOMEMLIMIT a partir do limite de
+// memória menos uma folga. Variáveis de ambiente do runtime têm precedência.
+package limits
+
+import (
+	"log/slog"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+)
+
+// Settings são os valores efetivos aplicados ao runtime
+type Settings struct {
+	GOMAXPROCS int
+	GOMEMLIMIT int64 // math.MaxInt64 quando não há limite
+}
+
+// Apply detecta os limites do cgroup e configura o runtime. headroomPercent
+// é a fração do limite de memória deixada fora do GOMEMLIMIT para pilhas,
+// buffers do kernel e memória fora do heap.
+func Apply(headroomPercent int) Settings {
+	cg, err := ReadCgroup(cgroupRoot)
+	if err != nil {
+		slog.Warn("failed to read cgroup limits", "error", err)
+	}
+
+	// GOMAXPROCS definido no ambiente já foi aplicado pelo runtime
+	if os.Getenv("GOMAXPROCS") == "" && cg.CPUQuota > 0 {
+		runtime.GOMAXPROCS(quotaToProcs(cg.CPUQuota))
+	}
+
+	// Idem para GOMEMLIMIT
+	if os.Getenv("GOMEMLIMIT") == "" && cg.MemoryLimit > 0 {
+		debug.SetMemoryLimit(memoryLimit(cg.MemoryLimit, headroomPercent))
+	}
+
+	settings := Settings{
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		GOMEMLIMIT: debug.SetMemoryLimit(-1),
+	}
+
+	attrs := []any{
+		"cgroup_version", cg.Version,
+		"cpu_quota", cg.CPUQuota,
+		"memory_limit_bytes", cg.MemoryLimit,
+		"gomaxprocs", settings.GOMAXPROCS,
+		"gomaxprocs_from_env", os.Getenv("GOMAXPROCS") != "",
+		"gomemlimit_from_env", os.Getenv("GOMEMLIMIT") != "",
+	}
+	if settings.GOMEMLIMIT != math.MaxInt64 {
+		attrs = append(attrs, "gomemlimit_bytes", settings.GOMEMLIMIT)
+	}
+	slog.Info("runtime limits", attrs...)
+
+	return settings
+}
+
+// quotaToProcs arredonda a quota para baixo, com mínimo de 1: com 1.5 CPU
+// dois Ps disputariam a quota e seriam estrangulados pelo CFS
+func quotaToProcs(quota float64) int {
+	procs := int(math.Floor(quota))
+	if procs < 1 {
+		procs = 1
+	}
+	return procs
+}
+
+// memoryLimit desconta a folga do limite do container
+func memoryLimit(limit int64, headroomPercent int) int64 {
+	if headroomPercent < 0 || headroomPercent >= 100 {
+		headroomPercent = 10
+	}
+	return limit - limit*int64(headroomPercent)/100
+}
+
+// CPUs retorna quantas CPUs o processo pode usar: a quota do cgroup ou, sem
+// quota, os núcleos da máquina, e nunca mais que o GOMAXPROCS
+func CPUs() float64 {
+	cpus := float64(runtime.NumCPU())
+	if cg, err := ReadCgroup(cgroupRoot); err == nil && cg.CPUQuota > 0 {
+		cpus = cg.CPUQuota
+	}
+	return min(cpus, float64(runtime.GOMAXPROCS(0)))
+}
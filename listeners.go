@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+
+	"github.com/yurimachados/rinha-backend-go/config"
+)
+
+// openListeners abre os listeners do servidor: TCP em cfg.Addr (a menos
+// que LISTEN_TCP=false) e, com LISTEN_SOCKET definida, um Unix socket para
+// o nginx no mesmo namespace de rede
+func openListeners(cfg config.Server) ([]net.Listener, error) {
+	var listeners []net.Listener
+
+	if cfg.ListenTCP {
+		tcp, err := listenTCP(cfg.Addr, cfg.ReusePort)
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, tcp)
+	}
+
+	if cfg.Socket != "" {
+		unix, err := listenUnix(cfg.Socket, cfg.SocketMode)
+		if err != nil {
+			closeListeners(listeners)
+			return nil, err
+		}
+		listeners = append(listeners, unix)
+	}
+
+	if len(listeners) == 0 {
+		return nil, fmt.Errorf("no listener configured: LISTEN_TCP=false requires LISTEN_SOCKET")
+	}
+	return listeners, nil
+}
+
+// listenTCP abre o listener TCP, opcionalmente com SO_REUSEPORT para que
+// mais de um processo sirva a mesma porta.
+//
+// Com REUSE_PORT cada processo drena de forma independente no shutdown: ao
+// fechar o listener o kernel deixa de entregar conexões novas a ele e as
+// distribui entre os processos restantes, enquanto as conexões já aceitas
+// terminam normalmente pelo server.Shutdown. Conexões que estavam na fila de
+// accept do socket fechado (ainda não aceitas) são resetadas pelo kernel no
+// Linux, então os processos devem ser parados um de cada vez.
+func listenTCP(addr string, reusePort bool) (net.Listener, error) {
+	var lc net.ListenConfig
+	if reusePort {
+		control, err := reusePortControl()
+		if err != nil {
+			return nil, err
+		}
+		lc.Control = control
+	}
+	return lc.Listen(context.Background(), "tcp", addr)
+}
+
+// listenUnix cria o socket removendo um arquivo antigo deixado por uma
+// execução que não encerrou direito. O listener remove o arquivo no Close.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("LISTEN_SOCKET %s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+		slog.Warn("removed stale unix socket", "path", path)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// O nginx roda com outro usuário e precisa de permissão de escrita
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+func closeListeners(listeners []net.Listener) {
+	for _, l := range listeners {
+		l.Close()
+	}
+}
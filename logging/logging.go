@@ -0,0 +1,94 @@
+// Package logging configura o slog do serviço e oferece amostragem para
+// erros repetitivos, evitando que a queda de um processador gere gigabytes
+// de log sob carga.
+package logging
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Campos padronizados dos logs estruturados
+const (
+	KeyCorrelationID = "correlationId"
+	KeyProcessor     = "processor"
+	KeyLatencyMs     = "latency_ms"
+	KeyStatus        = "status"
+	KeyQueueDepth    = "queue_depth"
+	KeyReason        = "reason"
+	KeyOccurrences   = "occurrences"
+)
+
+// defaultSampler é compartilhado pelos componentes; as chaves os distinguem
+var defaultSampler atomic.Pointer[Sampler]
+
+func init() {
+	defaultSampler.Store(NewSampler(100))
+}
+
+// Setup cria o logger JSON, instala-o como slog.Default e configura a
+// amostragem de erros repetitivos. Componentes capturam slog.Default() na
+// construção, então testes podem injetar um writer próprio chamando Setup
+// antes de construí-los.
+func Setup(w io.Writer, level string, sampleEvery int64) *slog.Logger {
+	logger := New(w, level)
+	slog.SetDefault(logger)
+	defaultSampler.Store(NewSampler(sampleEvery))
+	return logger
+}
+
+// DefaultSampler retorna o sampler configurado no Setup
+func DefaultSampler() *Sampler {
+	return defaultSampler.Load()
+}
+
+// New cria um logger JSON no nível informado (debug, info, warn ou error).
+// Registros logados com um contexto que carrega o id da requisição ganham
+// o campo request_id.
+func New(w io.Writer, level string) *slog.Logger {
+	return slog.New(contextHandler{slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level: ParseLevel(level),
+	})})
+}
+
+// ParseLevel converte o LOG_LEVEL; valores desconhecidos viram info
+func ParseLevel(level string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// Sampler libera apenas a 1ª e depois cada N-ésima ocorrência de uma chave
+type Sampler struct {
+	every  int64
+	counts sync.Map // chave -> *int64
+}
+
+// NewSampler cria um sampler que loga a cada every ocorrências
+func NewSampler(every int64) *Sampler {
+	if every <= 0 {
+		every = 1
+	}
+	return &Sampler{every: every}
+}
+
+// Allow informa se a ocorrência deve ser logada e quantas já houve.
+// As chaves devem vir de um conjunto fixo (ex: "timeout:default").
+func (s *Sampler) Allow(key string) (bool, int64) {
+	counter, ok := s.counts.Load(key)
+	if !ok {
+		counter, _ = s.counts.LoadOrStore(key, new(int64))
+	}
+	n := atomic.AddInt64(counter.(*int64), 1)
+	return n == 1 || n%s.every == 0, n
+}
@@ -0,0 +1,101 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+)
+
+// RequestIDHeader é o header que carrega o id da requisição na entrada, na
+// resposta e nas chamadas aos processadores
+const RequestIDHeader = "X-Request-Id"
+
+// KeyRequestID é o campo do id da requisição nos logs
+const KeyRequestID = "request_id"
+
+// maxRequestIDLen limita o id aceito do cliente; acima disso um novo é gerado
+const maxRequestIDLen = 128
+
+// crockford é o alfabeto base32 do ULID, sem I, L, O e U
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+type requestIDKey struct{}
+
+// NewRequestID gera um id no formato ULID: 26 caracteres, 48 bits de
+// milissegundos seguidos de 80 bits aleatórios. A fonte é o gerador do
+// runtime (math/rand/v2), sem lock entre goroutines, e os 80 bits tornam
+// colisões no mesmo milissegundo improváveis.
+func NewRequestID() string {
+	var id [26]byte
+
+	ms := uint64(time.Now().UnixMilli())
+	for i := 9; i >= 0; i-- {
+		id[i] = crockford[ms&31]
+		ms >>= 5
+	}
+
+	// 80 bits aleatórios: 8 caracteres (40 bits) de cada sorteio
+	hi, lo := rand.Uint64(), rand.Uint64()
+	for i := 17; i >= 10; i-- {
+		id[i] = crockford[hi&31]
+		hi >>= 5
+	}
+	for i := 25; i >= 18; i-- {
+		id[i] = crockford[lo&31]
+		lo >>= 5
+	}
+	return string(id[:])
+}
+
+// ValidRequestID indica se o id recebido do cliente pode ser repassado:
+// não vazio, até 128 caracteres ASCII visíveis
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// WithRequestID anexa o id ao contexto; vazio, retorna o próprio contexto
+func WithRequestID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID retorna o id da requisição anexado ao contexto, ou vazio
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// contextHandler acrescenta o request_id do contexto a cada registro, então
+// basta logar com as variantes *Context (InfoContext, WarnContext...)
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String(KeyRequestID, id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
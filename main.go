@@ -2,88 +2,345 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"google.golang.org/grpc"
+
+	"github.com/yurimachados/rinha-backend-go/config"
 	"github.com/yurimachados/rinha-backend-go/handlers"
+	"github.com/yurimachados/rinha-backend-go/limits"
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/store"
+	"github.com/yurimachados/rinha-backend-go/tracing"
+	"github.com/yurimachados/rinha-backend-go/types"
 )
 
 func main() {
-	// URLs dos processadores (podem vir de variáveis de ambiente)
-	defaultURL := getEnv("DEFAULT_PROCESSOR_URL", "http://processor-default:8080/process")
-	fallbackURL := getEnv("FALLBACK_PROCESSOR_URL", "http://processor-fallback:8080/process")
-	
+	os.Exit(runMain(os.Args[1:], os.Getenv))
+}
+
+// runMain sobe a instância com os argumentos (sem o nome do programa) e o
+// ambiente lido de env, e retorna o código de saída: 0 no -h, no -version e
+// depois do desligamento, 2 para flags inválidas e 1 para configuração
+// inválida ou falha no boot
+func runMain(args []string, env func(string) string) int {
+	// Flags da linha de comando, com precedência sobre o ambiente; -h e
+	// -version encerram aqui
+	flags, err := parseFlags(args, os.Stderr, env)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		return 2
+	}
+	if flags.version {
+		fmt.Println(versionString())
+		return 0
+	}
+
+	// Configuração central: arquivo opcional (-config ou CONFIG_FILE) com o
+	// ambiente e as flags por cima
+	cfg := loadConfig(flags, env)
+
+	// Logs estruturados em JSON; deve vir antes de construir os componentes
+	logging.Setup(os.Stdout, flags.logLevel, int64(cfg.LogSampleEvery))
+
+	// Um valor inválido encerra o boot listando todos
+	cfg.WarnUnknownKeys()
+	if err := cfg.Validate(); err != nil {
+		slog.Error("invalid configuration", "error", err)
+		return 1
+	}
+	// Avisos de valores incomuns e workers iniciais dentro dos limites do autoscaling
+	cfg.Pool = cfg.Pool.Normalize()
+	slog.Info("configuration loaded", "config", cfg.String())
+
+	// GOMAXPROCS e GOMEMLIMIT a partir dos limites do container
+	limits.Apply(cfg.MemoryHeadroomPercent)
+
+	// Tracing opcional, ativo apenas com OTEL_EXPORTER_OTLP_ENDPOINT
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.ServiceName)
+	if err != nil {
+		slog.Error("failed to set up tracing", "error", err)
+		return 1
+	}
+
+	// Codec JSON escrito à mão do payment; FAST_JSON=false volta ao encoding/json
+	types.SetFastJSON(cfg.FastJSON)
+	types.SetMaxAmount(cfg.MaxAmount)
+	types.SetDescriptionNewlines(cfg.KeepNewlines)
+	types.SetCurrencies(cfg.DefaultCurrency, cfg.ExtraCurrencies)
+	defaultURL, fallbackURL := cfg.Processors.DefaultURL, cfg.Processors.FallbackURL
+
+	// Labels por type das métricas dos processadores, antes de existir
+	// qualquer worker
+	routed := make([]string, 0, len(cfg.Processors.RoutingRules))
+	for _, rule := range cfg.Processors.RoutingRules {
+		routed = append(routed, rule.Type)
+	}
+	metrics.UseRoutedTypes(routed)
+
 	// Criar handler otimizado
-	paymentHandler := handlers.NewPaymentHandler(defaultURL, fallbackURL)
-	
+	paymentHandler := handlers.NewPaymentHandler(cfg, newPaymentStore(cfg))
+
+	// Envio em lote aos processadores com endpoint de lote
+	if cfg.ProcessorBulk {
+		paymentHandler.UseProcessorBulk(cfg.Bulk)
+	}
+
+	// Callback ao callbackUrl do payment quando o worker termina
+	if cfg.Callbacks {
+		paymentHandler.EnableCallbacks(cfg.Callback)
+	}
+
+	// Journal em disco dos payments abandonados pelos workers
+	if cfg.Journal.Path != "" {
+		if err := paymentHandler.EnableFailureJournal(cfg.Journal); err != nil {
+			slog.Error("failed to open failure journal", "path", cfg.Journal.Path, "error", err)
+			return 1
+		}
+	}
+
+	// Summary agregado a partir das instâncias irmãs (alternativa ao Redis)
+	if len(cfg.PeerURLs) > 0 {
+		paymentHandler.UsePeers(cfg.PeerURLs)
+	}
+
+	// CORS para dashboards no navegador; sem origens fica desligado
+	if len(cfg.CORS.Origins) > 0 {
+		paymentHandler.EnableCORS(cfg.CORS)
+	}
+
+	// Summary e admin comprimidos com gzip; false desliga para benchmarks
+	if cfg.Server.GzipResponses {
+		paymentHandler.EnableGzip(cfg.Server.GzipMinBytes)
+	}
+
+	// Com a fila cheia, processar na requisição em vez de responder 503
+	if cfg.Ingest.InlineFallback {
+		paymentHandler.EnableInlineFallback(cfg.Ingest.InlineMaxConcurrent)
+	}
+
+	// POST /payments?sync=true processa na requisição e responde o resultado
+	paymentHandler.EnableSyncMode(cfg.Ingest.SyncMaxConcurrent, cfg.Server.WriteTimeout)
+
+	// Rate limit por IP do cliente, opt-in: atrás do nginx todos os payments
+	// vêm do mesmo IP
+	if cfg.RateLimit.Enabled {
+		paymentHandler.EnableRateLimit(cfg.RateLimit)
+	}
+
+	// Recusar parte dos payments com 429 antes de a fila encher
+	if cfg.Admission.Enabled {
+		paymentHandler.EnableAdmissionControl(cfg.Admission.HighWatermark, cfg.Admission.LowWatermark, cfg.Admission.RejectPercent)
+	}
+
+	// Recusar parte dos payments com 503 com a CPU perto do limite
+	if cfg.CPUShed.Enabled {
+		paymentHandler.EnableCPUShedding(cfg.CPUShed)
+	}
+
+	// Contadores em /debug/vars no listener de admin; o expvar também expõe a
+	// linha de comando e o memstats
+	if cfg.Expvar {
+		paymentHandler.EnableExpvar()
+	}
+
+	// Métricas por push ao agente DogStatsD; sem endereço nada é enviado
+	var statsd *metrics.StatsD
+	if cfg.StatsD.Addr != "" {
+		statsd, err = metrics.StartStatsD(cfg.StatsD)
+		if err != nil {
+			slog.Error("invalid STATSD_ADDR", "addr", cfg.StatsD.Addr, "error", err)
+			return 1
+		}
+	}
+
+	// Conexões com os processadores abertas antes do primeiro payment
+	paymentHandler.WarmupProcessors(context.Background())
+
 	// Iniciar health checker
 	paymentHandler.StartHealthChecker()
-	
+
 	// Configurar rotas otimizadas
 	mux := http.NewServeMux()
-	
-	// Health check simples
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/plain")
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprint(w, "ok")
-	})
-	
-	// Endpoint principal para payments
-	mux.HandleFunc("/payments", paymentHandler.PostPayments)
-	
-	// Endpoint para estatísticas
-	mux.HandleFunc("/payments-summary", paymentHandler.GetPaymentsSummary)
-	
-	// Servidor HTTP otimizado
-	server := &http.Server{
-		Addr:         ":8080",
-		Handler:      mux,
-		ReadTimeout:  2 * time.Second,  // timeout agressivo
-		WriteTimeout: 2 * time.Second,
-		IdleTimeout:  10 * time.Second,
-	}
-	
+	paymentHandler.RegisterRoutes(mux)
+
+	// Servidor HTTP otimizado: net/http ou fasthttp (HTTP_ENGINE=fasthttp)
+	server := newHTTPEngine(cfg.Server, mux, paymentHandler, newAccessLog(cfg.Server), newInFlightLimiter(cfg.Server))
+
 	// Graceful shutdown
 	// Capturar sinais do sistema
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	
-	// Iniciar servidor em goroutine
-	go func() {
-		log.Printf("🚀 Rinha Backend Server rodando na porta 8080")
-		log.Printf("📊 Default Processor: %s", defaultURL)
-		log.Printf("🔄 Fallback Processor: %s", fallbackURL)
-		
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Erro ao iniciar servidor: %v", err)
+
+	// TCP e/ou Unix socket, todos servidos pelo mesmo servidor
+	listeners, err := openListeners(cfg.Server)
+	if err != nil {
+		slog.Error("failed to listen", "error", err)
+		return 1
+	}
+
+	// Profiling em um listener só dele, fora da porta pública
+	var pprofServer *http.Server
+	if cfg.Pprof.Enabled {
+		pprofServer, err = startPprof(cfg.Pprof)
+		if err != nil {
+			slog.Error("failed to start pprof", "error", err)
+			return 1
 		}
-	}()
-	
+	}
+
+	// Rotas de admin que mudam estado em um listener próprio, apenas com ADMIN_ADDR
+	var adminServer *http.Server
+	if cfg.Server.AdminAddr != "" {
+		adminServer, err = startAdmin(cfg.Server, paymentHandler)
+		if err != nil {
+			slog.Error("failed to start admin server", "error", err)
+			return 1
+		}
+	}
+
+	// gRPC em um listener próprio, apenas com GRPC_ADDR
+	var grpcServer *grpc.Server
+	if cfg.Server.GRPCAddr != "" {
+		grpcServer, err = startGRPC(cfg.Server, paymentHandler)
+		if err != nil {
+			slog.Error("failed to start grpc server", "error", err)
+			return 1
+		}
+	}
+
+	// Iniciar servidor em goroutine, uma por listener
+	for _, listener := range listeners {
+		go func(listener net.Listener) {
+			slog.Info("server listening",
+				"engine", cfg.Server.Engine,
+				"network", listener.Addr().Network(),
+				"addr", listener.Addr().String(),
+				"default_processor", defaultURL,
+				"fallback_processor", fallbackURL)
+
+			if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+				slog.Error("server failed", "error", err)
+				os.Exit(1)
+			}
+		}(listener)
+	}
+
 	// Aguardar sinal de shutdown
 	<-sigChan
-	log.Println("🛑 Iniciando graceful shutdown...")
-	
+	slog.Info("graceful shutdown started")
+
+	// Um segundo sinal desiste de esperar, mas o relatório ainda sai
+	go func() {
+		<-sigChan
+		slog.Warn("second signal received, forcing shutdown")
+		paymentHandler.ReportShutdown(true)
+		os.Exit(1)
+	}()
+
+	// /readyz em 503 e, se configurado, tempo para o balanceador perceber
+	// antes de os listeners fecharem
+	paymentHandler.BeginShutdown()
+	if delay := cfg.Server.ShutdownReadyDelay; delay > 0 {
+		slog.Info("waiting for load balancer to drain", "delay_ms", delay.Milliseconds())
+		time.Sleep(delay)
+	}
+
 	// Timeout para shutdown
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer shutdownCancel()
-	
+
+	// Streams de eventos não terminam sozinhos; encerrá-los antes do Shutdown
+	paymentHandler.CloseEventStreams()
+
+	// O gRPC para junto com o HTTP, sob o mesmo prazo
+	grpcStopped := make(chan error, 1)
+	if grpcServer != nil {
+		go func() { grpcStopped <- stopGRPC(shutdownCtx, grpcServer) }()
+	}
+
+	// Shutdown fecha todos os listeners; o do Unix socket remove o arquivo
 	if err := server.Shutdown(shutdownCtx); err != nil {
-		log.Printf("Erro durante shutdown: %v", err)
+		slog.Error("shutdown failed", "error", err)
 	} else {
-		log.Println("✅ Servidor finalizado graciosamente")
+		slog.Info("server stopped gracefully")
 	}
+	if grpcServer != nil {
+		if err := <-grpcStopped; err != nil {
+			slog.Error("grpc shutdown failed", "error", err)
+		} else {
+			slog.Info("grpc server stopped gracefully")
+		}
+	}
+	if adminServer != nil {
+		adminServer.Close()
+	}
+	if pprofServer != nil {
+		pprofServer.Close()
+	}
+
+	// Parar workers, com um prazo próprio depois do das requisições, e
+	// enviar contadores pendentes
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer stopCancel()
+	paymentHandler.Stop(stopCtx)
+	statsd.Stop()
+
+	// O que aconteceu com cada payment aceito, depois da drenagem
+	paymentHandler.ReportShutdown(false)
+
+	// Enviar spans pendentes
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Warn("failed to flush traces", "error", err)
+	}
+	return 0
+}
+
+// newAccessLog amostra o access log por ACCESS_LOG_SAMPLE_EVERY: 1 loga
+// todas as requisições, N loga 1 a cada N respostas de sucesso (erros
+// sempre) e 0 desliga
+func newAccessLog(server config.Server) *handlers.AccessLog {
+	if server.AccessLogSampleEvery == 0 {
+		return nil
+	}
+	return handlers.NewAccessLog(slog.Default(), int64(server.AccessLogSampleEvery))
 }
 
-// getEnv retorna variável de ambiente ou valor padrão
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// newInFlightLimiter limita as requisições simultâneas a MAX_IN_FLIGHT (0
+// desliga), com IN_FLIGHT_WAIT_MS de espera por uma vaga antes do 503
+func newInFlightLimiter(server config.Server) *handlers.InFlightLimiter {
+	if server.MaxInFlight == 0 {
+		return nil
 	}
-	return defaultValue
+	slog.Info("in-flight limit configured", "max_in_flight", server.MaxInFlight, "wait_ms", server.InFlightWait.Milliseconds())
+	return handlers.NewInFlightLimiter(server.MaxInFlight, server.InFlightWait)
+}
+
+// newPaymentStore usa Postgres quando DATABASE_URL está definida e o store
+// em memória caso contrário
+func newPaymentStore(cfg config.Config) store.Store {
+	if cfg.DatabaseURL == "" {
+		return store.NewMemoryStore(cfg.MemoryStore)
+	}
+
+	pgStore, err := store.NewPostgresStore(cfg.DatabaseURL, cfg.Postgres)
+	if err != nil {
+		slog.Warn("invalid DATABASE_URL, using in-memory store", "error", err)
+		return store.NewMemoryStore(cfg.MemoryStore)
+	}
+
+	slog.Info("postgres persistence enabled")
+	return pgStore
 }
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// envMap é um ambiente de teste para o runMain, sem ler o do processo
+func envMap(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "http_addr: 127.0.0.1:8080\nworker_count: 2\nqueue_size: 100\ndefault_processor_url: http://file:8080/payments\nfallback_processor_url: http://file:8081/payments\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	env := envMap(map[string]string{
+		"CONFIG_FILE":           path,
+		"WORKER_COUNT":          "3",
+		"QUEUE_SIZE":            "200",
+		"DEFAULT_PROCESSOR_URL": "http://env:8080/payments",
+	})
+
+	flags, err := parseFlags([]string{"-workers", "300", "-default-url", "http://flag:8080/payments", "-port", "9000"}, io.Discard, env)
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	cfg := loadConfig(flags, env)
+
+	tests := []struct {
+		name      string
+		got, want any
+	}{
+		{"flag over env and file", cfg.Pool.Workers, 300},
+		{"env over file", cfg.Pool.QueueSize, 200},
+		{"file over default", cfg.Processors.FallbackURL, "http://file:8081/payments"},
+		{"flag URL over env", cfg.Processors.DefaultURL, "http://flag:8080/payments"},
+		{"-port keeps the host of the file", cfg.Server.Addr, "127.0.0.1:9000"},
+		// Os padrões derivados seguem as flags, não o ambiente
+		{"MAX_IN_FLIGHT from -workers", cfg.Server.MaxInFlight, 300 * 64},
+		{"bulk URL from -default-url", cfg.Bulk.DefaultURL, "http://flag:8080/payments/batch"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestRunMainExitCodes(t *testing.T) {
+	// -h imprime a ajuda com todas as variáveis em stderr
+	stderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	t.Cleanup(func() { os.Stderr.Close(); os.Stderr = stderr })
+
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want int
+	}{
+		{"help", []string{"-h"}, nil, 0},
+		{"version", []string{"-version"}, nil, 0},
+		{"unknown flag", []string{"-threads", "4"}, nil, 2},
+		{"port out of range", []string{"-port", "70000"}, nil, 2},
+		{"positional argument", []string{"serve"}, nil, 2},
+		{"non-numeric workers", []string{"-workers", "many"}, nil, 2},
+		{"unreadable env value", nil, map[string]string{"MAX_BODY_BYTES": "4k"}, 1},
+		{"negative workers flag", []string{"-workers", "-1"}, nil, 1},
+		{"more workers than queue", []string{"-workers", "500", "-queue-size", "100"}, nil, 1},
+		{"port shared with pprof", []string{"-port", "6060"}, map[string]string{"ENABLE_PPROF": "true", "PPROF_ADDR": ":6060"}, 1},
+		{"expvar without admin listener", nil, map[string]string{"EXPVAR": "true"}, 1},
+		{"no listener", nil, map[string]string{"LISTEN_TCP": "false"}, 1},
+		{"missing config file", []string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}, nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runMain(tt.args, envMap(tt.env)); got != tt.want {
+				t.Fatalf("runMain(%q) = %d, want %d", tt.args, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,549 @@
+// Package metrics mantém os contadores de instrumentação do serviço e os
+// expõe no formato texto do Prometheus em /metrics.
+//
+// Métricas exportadas (nomes e labels estáveis; labels só assumem valores
+// de conjuntos fixos, nunca correlationId ou outros valores livres):
+//
+//	rinha_payments_accepted_total                        payments aceitos no POST /payments
+//	rinha_payments_rejected_total{reason}                payments recusados na entrada
+//	rinha_payments_by_type_total{type}                   payments aceitos (fila, inline ou sync) por type de PAYMENT_TYPES
+//	rinha_payments_inline_total                          payments processados na requisição com a fila cheia
+//	rinha_payments_sync_total                            payments processados na requisição a pedido (?sync=true)
+//	rinha_payments_dequeued_total                        payments retirados da fila pelos workers
+//	rinha_payments_failed_total                          payments que falharam em todos os processadores
+//	rinha_payments_expired_total                         payments descartados na fila por idade
+//	rinha_payments_retry_exhausted_total{budget}         payments reagendados que esgotaram o orçamento de tentativas (attempts/elapsed); também em failed
+//	rinha_worker_batches_total                           lotes processados pelos workers
+//	rinha_worker_scale_events_total{direction}           ajustes do autoscaling do pool (up/down)
+//	rinha_processor_requests_total{processor,outcome}    chamadas aos processadores (success/failure)
+//	rinha_callbacks_total{outcome}                       callbacks ao callbackUrl (delivered/failed/blocked/dropped)
+//	rinha_shadow_requests_total{outcome}                 cópias ao fallback do modo shadow (success, classe de erro ou dropped sem vaga)
+//	rinha_panics_total{source}                           pânicos recuperados (http/worker/grpc)
+//	rinha_failure_journal_total{outcome}                 linhas do journal de falhas (written/dropped/error)
+//	rinha_queue_spill_total{outcome}                     payments do arquivo de spill da fila (spilled/restored/skipped/dropped)
+//	rinha_summary_snapshots_total{outcome}               snapshots do summary em disco (written/failed/restored/skipped)
+//	rinha_statsd_dropped_total                           linhas do StatsD descartadas com a fila de envio cheia
+//	rinha_events_dropped_total                           eventos do /payments/events descartados por assinantes lentos
+//	rinha_http_shed_total                                requisições recusadas com 503 pelo limite de requisições simultâneas
+//	rinha_status_transitions_invalid_total               mudanças de estado de payment recusadas (ex: succeeded de volta a queued)
+//	rinha_processor_errors_total{processor,class}        falhas por classe de erro (auth = 401/403, credenciais erradas)
+//	rinha_processor_receipts_total{processor,outcome}    comprovantes das respostas 2xx de payment (captured/missing/invalid)
+//	rinha_processor_duplicates_total{processor}          respostas de "já processado" (PROCESSOR_DUPLICATE_STATUSES) contadas como sucesso
+//	rinha_processor_throttled_total{processor}           chamadas puladas sem token no rate limit do processador
+//	rinha_processor_payments_by_type_total{processor,type} payments aceitos pelo processador por type de ROUTING_RULES (os demais em "other")
+//	rinha_processor_weighted_picks_total{processor}      payments enviados primeiro ao processador pelo sorteio dos pesos (com *_PROCESSOR_WEIGHT)
+//	rinha_processor_sticky_picks_total{processor}        payments enviados primeiro ao processador pelo hash do correlationId (ROUTING_STRATEGY=sticky)
+//	rinha_processor_retries_total{processor,outcome}     novas tentativas após falhas de conexão (attempted/failover/succeeded/skipped)
+//	rinha_processor_chaos_injected_total{processor,fault} falhas injetadas com CHAOS; também contadas nos errors
+//	rinha_processor_connections_total{processor,conn}    conexões entregues às chamadas (new/reused; com PROCESSOR_CONN_METRICS)
+//	rinha_processor_request_duration_seconds{processor}  histograma de latência das chamadas
+//	rinha_processor_dial_duration_seconds{processor}     histograma do connect das conexões novas
+//	rinha_processor_first_byte_seconds{processor}        histograma do fim do envio ao primeiro byte da resposta
+//	rinha_queue_wait_seconds                             histograma do tempo na fila até o worker retirar
+//	rinha_shadow_request_duration_seconds                histograma de latência das cópias do modo shadow
+//	rinha_queue_depth                                    itens aguardando na fila
+//	rinha_queue_in_flight                                payments retirados da fila e ainda sem desfecho
+//	rinha_queue_capacity                                 capacidade da fila
+//	rinha_workers                                        workers ativos no pool
+//	rinha_shadow_in_flight                               cópias do modo shadow em andamento (até SHADOW_MAX_IN_FLIGHT)
+//	rinha_payments_in_status{status}                     payments desta instância em queued/processing
+//	rinha_event_subscribers                              streams abertos no /payments/events
+//	rinha_http_in_flight                                 requisições em andamento sob o limite de simultâneas
+//	rinha_http_route_in_flight{route}                    requisições em andamento nas rotas medidas (ex: "POST /payments")
+//	rinha_processing_paused                              1 com o processamento pausado pelo admin
+//	rinha_admission_shedding                             1 se o controle de admissão está recusando payments
+//	rinha_cpu_usage_percent                              uso de CPU do processo na última amostra (com CPU_SHED)
+//	rinha_cpu_shed_ratio                                 fração dos POST /payments recusada agora pelo uso de CPU
+//	rinha_processor_healthy{processor}                   1 se o processador recebe tráfego
+//	rinha_processor_breaker_open{processor}              1 se o circuit breaker abriu pela taxa de falhas
+//	rinha_processor_timeout_seconds{processor}           prazo atual das chamadas de payment
+//	rinha_processor_clock_skew_seconds{processor}        desvio estimado do relógio do processador pelo header Date
+//	rinha_processor_h2c{processor}                       1 com as chamadas em h2c, 0 depois da queda para HTTP/1.1 (com *_PROCESSOR_H2C)
+//	rinha_processor_replica_healthy{processor,replica}   1 com a réplica no rodízio, 0 ejetada (com *_PROCESSOR_REPLICA_URLS)
+//	rinha_processor_weight{processor}                    peso atual do processador no sorteio (0 em todos sem sorteio; POST /admin/weights)
+//	rinha_processor_rate_limit{processor}                taxa efetiva do rate limit por processador (com PROCESSOR_RATE_LIMIT_RPS)
+//	rinha_processor_connections_open{processor}          conexões abertas com o processador (com PROCESSOR_CONN_METRICS)
+//	rinha_processor_connections_active{processor}        conexões em uso por uma chamada
+//	rinha_processor_connections_idle{processor}          estimativa das ociosas no pool (abertas - em uso)
+package metrics
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Motivos de recusa na entrada
+const (
+	ReasonInvalidJSON  = "invalid_json"
+	ReasonValidation   = "validation_failed"
+	ReasonQueueFull    = "queue_full"
+	ReasonBodyTooLarge = "body_too_large"
+	ReasonBackpressure = "backpressure" // 429 do controle de admissão, antes da fila encher
+
+	ReasonMethodNotAllowed = "method_not_allowed" // 405 do mux nas rotas de ingest
+
+	ReasonUnsupportedMediaType = "unsupported_media_type" // Content-Type diferente de application/json
+	ReasonRateLimited          = "rate_limited"           // 429 do rate limit por IP do cliente
+	ReasonCPUShed              = "cpu_shed"               // 503 com a CPU do processo acima de CPU_SHED_THRESHOLD_PERCENT
+	ReasonDuplicate            = "duplicate_payment"      // 409: correlationId já na fila, em processamento ou processado
+)
+
+// PaymentTypeOther é o label dos payments sem PAYMENT_TYPES configurada
+const PaymentTypeOther = "other"
+
+var rejectReasons = []string{ReasonInvalidJSON, ReasonValidation, ReasonQueueFull, ReasonBodyTooLarge, ReasonBackpressure, ReasonMethodNotAllowed, ReasonUnsupportedMediaType, ReasonRateLimited, ReasonCPUShed, ReasonDuplicate}
+
+// Classes de erro nas chamadas aos processadores
+const (
+	ClassTimeout    = "timeout"
+	ClassConnection = "connection"
+	ClassHTTP4xx    = "http_4xx"
+	ClassAuth       = "auth" // 401/403: token ou headers do processador errados
+	ClassHTTP429    = "http_429"
+	ClassHTTP5xx    = "http_5xx"
+	ClassReceipt    = "receipt"   // 2xx sem comprovante legível, com PROCESSOR_RECEIPT_STRICT
+	ClassDuplicate  = "duplicate" // "já processado" de um payment que o store já tinha
+	ClassOther      = "other"
+)
+
+var errorClasses = []string{ClassTimeout, ClassConnection, ClassHTTP4xx, ClassAuth, ClassHTTP429, ClassHTTP5xx, ClassReceipt, ClassDuplicate, ClassOther}
+
+// Desfechos da leitura do comprovante nas respostas 2xx de payment
+const (
+	ReceiptCaptured = "captured" // com o identificador do processador
+	ReceiptMissing  = "missing"  // corpo vazio ou JSON sem identificador
+	ReceiptInvalid  = "invalid"  // não é um objeto JSON, passou do limite ou a leitura falhou
+)
+
+var receiptOutcomes = []string{ReceiptCaptured, ReceiptMissing, ReceiptInvalid}
+
+// Direções dos ajustes do autoscaling
+const (
+	ScaleUp   = "up"
+	ScaleDown = "down"
+)
+
+var scaleDirections = []string{ScaleUp, ScaleDown}
+
+// Desfechos dos callbacks de fim de processamento
+const (
+	CallbackDelivered = "delivered"
+	CallbackFailed    = "failed"  // esgotou as tentativas
+	CallbackBlocked   = "blocked" // destino em rede privada
+	CallbackDropped   = "dropped" // fila de callbacks cheia ou desligamento
+)
+
+var callbackOutcomes = []string{CallbackDelivered, CallbackFailed, CallbackBlocked, CallbackDropped}
+
+// Desfechos das cópias do modo shadow além das classes de erro
+const (
+	ShadowSuccess = "success" // resposta 2xx
+	ShadowDropped = "dropped" // sem vaga em SHADOW_MAX_IN_FLIGHT, não enviada
+)
+
+var shadowOutcomes = append([]string{ShadowSuccess, ShadowDropped}, errorClasses...)
+
+// Origens dos pânicos recuperados
+const (
+	PanicHTTP   = "http"   // handler de uma requisição
+	PanicWorker = "worker" // worker da fila ou processamento de um payment
+	PanicGRPC   = "grpc"   // handler de uma chamada gRPC
+)
+
+var panicSources = []string{PanicHTTP, PanicWorker, PanicGRPC}
+
+// Desfechos dos payments no arquivo de spill da fila em memória
+const (
+	SpillWritten  = "spilled"  // gravado no desligamento
+	SpillRestored = "restored" // devolvido à fila no boot
+	SpillSkipped  = "skipped"  // registro corrompido ou truncado
+	SpillDropped  = "dropped"  // fila cheia na recarga
+)
+
+var spillOutcomes = []string{SpillWritten, SpillRestored, SpillSkipped, SpillDropped}
+
+// Desfechos dos snapshots do summary em disco
+const (
+	SnapshotWritten  = "written"
+	SnapshotFailed   = "failed"   // falha de escrita no disco
+	SnapshotRestored = "restored" // summary restaurado no boot
+	SnapshotSkipped  = "skipped"  // arquivo corrompido ou inválido no boot
+)
+
+var snapshotOutcomes = []string{SnapshotWritten, SnapshotFailed, SnapshotRestored, SnapshotSkipped}
+
+// Desfechos das linhas do journal de falhas
+const (
+	JournalWritten = "written"
+	JournalDropped = "dropped" // fila do journal cheia
+	JournalError   = "error"   // falha de escrita no disco
+)
+
+var journalOutcomes = []string{JournalWritten, JournalDropped, JournalError}
+
+// Limites do orçamento de tentativas de um payment
+const (
+	BudgetAttempts = "attempts" // RETRY_MAX_ATTEMPTS
+	BudgetElapsed  = "elapsed"  // RETRY_MAX_ELAPSED_MS
+)
+
+var budgetLimits = []string{BudgetAttempts, BudgetElapsed}
+
+// Desfechos das novas tentativas imediatas após falhas de conexão
+const (
+	RetryAttempted = "attempted" // nova tentativa feita na mesma réplica
+	RetryFailover  = "failover"  // nova tentativa feita em outra réplica do processador
+	RetrySucceeded = "succeeded" // nova tentativa que obteve resposta HTTP
+	RetrySkipped   = "skipped"   // falha depois do envio do corpo, sem nova tentativa
+)
+
+var retryOutcomes = []string{RetryAttempted, RetryFailover, RetrySucceeded, RetrySkipped}
+
+// Conexões usadas nas chamadas aos processadores
+const (
+	ConnNew    = "new"    // discada para a chamada
+	ConnReused = "reused" // ociosa do pool
+)
+
+var connKinds = []string{ConnNew, ConnReused}
+
+// Falhas injetadas nas chamadas aos processadores com CHAOS; cada uma
+// também conta na classe de erro em que cai (reset em connection,
+// blackhole em timeout)
+const (
+	ChaosLatency   = "latency"
+	ChaosHTTP5xx   = "http_5xx"
+	ChaosHTTP429   = "http_429"
+	ChaosReset     = "reset"
+	ChaosBlackhole = "blackhole"
+)
+
+var chaosFaults = []string{ChaosLatency, ChaosHTTP5xx, ChaosHTTP429, ChaosReset, ChaosBlackhole}
+
+// processorNames são os únicos valores do label processor
+var processorNames = []string{"default", "fallback"}
+
+// latencyBuckets são os limites do histograma de latência, em segundos
+var latencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+// dialBuckets começam abaixo dos de latência: na rede do compose o
+// handshake TCP leva dezenas de microssegundos
+var dialBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+// queueWaitBuckets vão além dos de latência: sob backlog um payment pode
+// esperar segundos na fila
+var queueWaitBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Counter é um contador monotônico atômico
+type Counter struct {
+	value int64
+}
+
+// Inc incrementa o contador
+func (c *Counter) Inc() {
+	atomic.AddInt64(&c.value, 1)
+}
+
+// Add soma n ao contador
+func (c *Counter) Add(n int64) {
+	atomic.AddInt64(&c.value, n)
+}
+
+// Value retorna o valor atual
+func (c *Counter) Value() int64 {
+	return atomic.LoadInt64(&c.value)
+}
+
+// CounterVec é um conjunto de contadores indexado por um label de valores fixos
+type CounterVec struct {
+	values   []string
+	counters []Counter
+}
+
+func newCounterVec(values []string) *CounterVec {
+	return &CounterVec{
+		values:   values,
+		counters: make([]Counter, len(values)),
+	}
+}
+
+// Inc incrementa o contador do valor informado; valores desconhecidos são
+// ignorados para manter a cardinalidade limitada
+func (v *CounterVec) Inc(value string) {
+	for i, known := range v.values {
+		if known == value {
+			v.counters[i].Inc()
+			return
+		}
+	}
+}
+
+// Add soma n ao contador do valor informado, com a mesma regra do Inc
+func (v *CounterVec) Add(value string, n int64) {
+	for i, known := range v.values {
+		if known == value {
+			v.counters[i].Add(n)
+			return
+		}
+	}
+}
+
+// Values retorna o valor atual de cada contador, indexado pelo label
+func (v *CounterVec) Values() map[string]int64 {
+	values := make(map[string]int64, len(v.values))
+	for i, known := range v.values {
+		values[known] = v.counters[i].Value()
+	}
+	return values
+}
+
+// Histogram acumula observações de duração em buckets fixos. Todas as
+// atualizações são atômicas, sem lock no caminho das chamadas.
+type Histogram struct {
+	bounds  []float64
+	counts  []int64 // não cumulativo; acumulado na exposição
+	sumUs   int64   // soma em microssegundos
+	maxUs   int64   // maior observação, usada no bucket +Inf
+	count   int64
+	watcher atomic.Pointer[func(time.Duration)] // exporters que recebem cada observação
+}
+
+// NewHistogram cria um histograma com os limites de bounds, em segundos. Só
+// os histogramas do Collect aparecem no /metrics; os demais são internos.
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{
+		bounds: bounds,
+		counts: make([]int64, len(bounds)+1), // último bucket é +Inf
+	}
+}
+
+// Observe registra uma duração
+func (h *Histogram) Observe(d time.Duration) {
+	seconds := d.Seconds()
+	i := 0
+	for i < len(h.bounds) && seconds > h.bounds[i] {
+		i++
+	}
+	us := d.Microseconds()
+	atomic.AddInt64(&h.counts[i], 1)
+	atomic.AddInt64(&h.sumUs, us)
+	atomic.AddInt64(&h.count, 1)
+	for {
+		max := atomic.LoadInt64(&h.maxUs)
+		if us <= max || atomic.CompareAndSwapInt64(&h.maxUs, max, us) {
+			break
+		}
+	}
+	if watch := h.watcher.Load(); watch != nil {
+		(*watch)(d)
+	}
+}
+
+// watch passa cada observação a fn, além dos buckets; fn não pode bloquear
+func (h *Histogram) watch(fn func(time.Duration)) {
+	h.watcher.Store(&fn)
+}
+
+// HistogramSnapshot é uma cópia dos buckets para cálculo de percentis
+type HistogramSnapshot struct {
+	Bounds []float64 // limites superiores em segundos; o último bucket é +Inf
+	Counts []int64   // contagem de cada bucket, não cumulativa
+	Count  int64
+	Max    time.Duration
+}
+
+// Snapshot copia os buckets. As leituras são atômicas mas não simultâneas,
+// então a cópia pode incluir parcialmente observações concorrentes.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	snap := HistogramSnapshot{
+		Bounds: h.bounds,
+		Counts: make([]int64, len(h.counts)),
+		Max:    time.Duration(atomic.LoadInt64(&h.maxUs)) * time.Microsecond,
+	}
+	for i := range h.counts {
+		snap.Counts[i] = atomic.LoadInt64(&h.counts[i])
+		snap.Count += snap.Counts[i]
+	}
+	return snap
+}
+
+// Sub retorna as observações feitas desde prev, para percentis de uma
+// janela. Max continua sendo o de todo o histórico.
+func (s HistogramSnapshot) Sub(prev HistogramSnapshot) HistogramSnapshot {
+	delta := HistogramSnapshot{
+		Bounds: s.Bounds,
+		Counts: make([]int64, len(s.Counts)),
+		Max:    s.Max,
+	}
+	for i := range s.Counts {
+		if i < len(prev.Counts) {
+			delta.Counts[i] = s.Counts[i] - prev.Counts[i]
+		} else {
+			delta.Counts[i] = s.Counts[i]
+		}
+		delta.Count += delta.Counts[i]
+	}
+	return delta
+}
+
+// Quantile estima o percentil q (0 a 1) interpolando linearmente dentro do
+// bucket. A maior observação limita o bucket que a contém e o +Inf.
+func (s HistogramSnapshot) Quantile(q float64) time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+
+	rank := q * float64(s.Count)
+	max := s.Max.Seconds()
+	var cumulative int64
+	lower := 0.0
+	for i, count := range s.Counts {
+		upper := max
+		if i < len(s.Bounds) && s.Bounds[i] < max {
+			upper = s.Bounds[i]
+		}
+		if count > 0 && float64(cumulative+count) >= rank {
+			if upper < lower {
+				upper = lower
+			}
+			fraction := (rank - float64(cumulative)) / float64(count)
+			return time.Duration((lower + (upper-lower)*fraction) * float64(time.Second))
+		}
+		cumulative += count
+		lower = upper
+	}
+	return s.Max
+}
+
+// ProcessorMetrics agrupa as métricas de um processador
+type ProcessorMetrics struct {
+	Success    Counter
+	Failure    Counter
+	Throttled  Counter // chamadas puladas sem token no rate limit do processador
+	Duplicates Counter // respostas de "já processado" contadas como sucesso
+	Weighted   Counter // payments enviados primeiro ao processador pelo sorteio dos pesos
+	Sticky     Counter // payments enviados primeiro ao processador pelo hash do correlationId
+	Errors     *CounterVec
+	Retries    *CounterVec // novas tentativas por desfecho
+	Receipts   *CounterVec // comprovantes das respostas 2xx por desfecho
+	Chaos      *CounterVec // falhas injetadas com CHAOS, por falha
+	Types      *CounterVec // payments aceitos por type, ver UseRoutedTypes
+	Latency    *Histogram
+
+	// Pool de conexões de saída (com PROCESSOR_CONN_METRICS)
+	Conns     *CounterVec // conexões entregues às chamadas, novas ou reaproveitadas
+	Dial      *Histogram  // duração do connect das conexões novas
+	FirstByte *Histogram  // do fim do envio ao primeiro byte da resposta
+}
+
+var (
+	PaymentsAccepted Counter
+	PaymentsRejected = newCounterVec(rejectReasons)
+	PaymentsInline   Counter
+	PaymentsSync     Counter
+	PaymentsDequeued Counter
+	PaymentsFailed   Counter
+	PaymentsExpired  Counter
+	WorkerBatches    Counter
+	EventsDropped    Counter
+	HTTPShed         Counter
+
+	InvalidTransitions Counter
+	StatsDDropped      Counter
+
+	QueueWait     = NewHistogram(queueWaitBuckets)
+	ShadowLatency = NewHistogram(latencyBuckets)
+
+	PaymentsByType = newCounterVec([]string{PaymentTypeOther}) // ver UsePaymentTypes
+
+	WorkerScaleEvents = newCounterVec(scaleDirections)
+	Callbacks         = newCounterVec(callbackOutcomes)
+	Shadow            = newCounterVec(shadowOutcomes)
+	Panics            = newCounterVec(panicSources)
+	QueueSpill        = newCounterVec(spillOutcomes)
+	SummarySnapshots  = newCounterVec(snapshotOutcomes)
+	FailureJournal    = newCounterVec(journalOutcomes)
+	RetryExhausted    = newCounterVec(budgetLimits)
+
+	processors = map[string]*ProcessorMetrics{}
+	discard    = newProcessorMetrics() // destino de nomes desconhecidos
+)
+
+func init() {
+	for _, name := range processorNames {
+		processors[name] = newProcessorMetrics()
+	}
+}
+
+func newProcessorMetrics() *ProcessorMetrics {
+	return &ProcessorMetrics{
+		Errors:    newCounterVec(errorClasses),
+		Retries:   newCounterVec(retryOutcomes),
+		Receipts:  newCounterVec(receiptOutcomes),
+		Chaos:     newCounterVec(chaosFaults),
+		Types:     newCounterVec([]string{PaymentTypeOther}),
+		Latency:   NewHistogram(latencyBuckets),
+		Conns:     newCounterVec(connKinds),
+		Dial:      NewHistogram(dialBuckets),
+		FirstByte: NewHistogram(latencyBuckets),
+	}
+}
+
+// UsePaymentTypes define os labels do rinha_payments_by_type_total a partir
+// da lista de types aceitos; deve ser chamado antes de o servidor aceitar
+// requisições. Sem lista os payments são contados em "other".
+func UsePaymentTypes(names []string) {
+	if len(names) > 0 {
+		PaymentsByType = newCounterVec(names)
+	}
+}
+
+// UseRoutedTypes define os labels do
+// rinha_processor_payments_by_type_total a partir dos types com regra de
+// roteamento, mais "other" para os demais; deve ser chamado uma vez no
+// boot, antes de qualquer processador ser construído, porque os workers
+// leem os contadores sem lock
+func UseRoutedTypes(names []string) {
+	labels := append([]string(nil), names...)
+	if !slices.Contains(labels, PaymentTypeOther) {
+		labels = append(labels, PaymentTypeOther)
+	}
+	for _, m := range processors {
+		m.Types = newCounterVec(labels)
+	}
+}
+
+// Processor retorna as métricas de um processador
+func Processor(name string) *ProcessorMetrics {
+	if m, ok := processors[name]; ok {
+		return m
+	}
+	return discard
+}
+
+// gauge é uma série calculada no momento da coleta
+type gauge struct {
+	name   string
+	help   string
+	labels []Label
+	fn     func() float64
+}
+
+var (
+	gaugesMu sync.Mutex
+	gauges   []gauge
+)
+
+// RegisterGauge registra uma série calculada na coleta, como a profundidade
+// da fila. labels segue o formato do Prometheus (ex: `processor="default"`).
+func RegisterGauge(name, help, labels string, fn func() float64) {
+	gaugesMu.Lock()
+	defer gaugesMu.Unlock()
+	gauges = append(gauges, gauge{name: name, help: help, labels: parseLabels(labels), fn: fn})
+}
+
+func atomicLoad(v *int64) int64 {
+	return atomic.LoadInt64(v)
+}
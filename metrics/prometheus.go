@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Handler expõe as métricas no formato texto do Prometheus
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+
+	Collect(textSink{bw})
+}
+
+// textSink escreve as séries no formato texto do Prometheus
+type textSink struct {
+	w *bufio.Writer
+}
+
+func (t textSink) Describe(name, help, kind string) {
+	fmt.Fprintf(t.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (t textSink) Counter(name string, labels []Label, value int64) {
+	fmt.Fprintf(t.w, "%s%s %d\n", name, formatLabels(labels, ""), value)
+}
+
+func (t textSink) Gauge(name string, labels []Label, value float64) {
+	fmt.Fprintf(t.w, "%s%s %s\n", name, formatLabels(labels, ""), formatFloat(value))
+}
+
+// Histogram escreve os buckets cumulativos, a soma e a contagem
+func (t textSink) Histogram(name string, labels []Label, h *Histogram) {
+	var cumulative int64
+	for i, bound := range h.bounds {
+		cumulative += atomicLoad(&h.counts[i])
+		fmt.Fprintf(t.w, "%s_bucket%s %d\n", name, formatLabels(labels, formatFloat(bound)), cumulative)
+	}
+	cumulative += atomicLoad(&h.counts[len(h.bounds)])
+	fmt.Fprintf(t.w, "%s_bucket%s %d\n", name, formatLabels(labels, "+Inf"), cumulative)
+	fmt.Fprintf(t.w, "%s_sum%s %s\n", name, formatLabels(labels, ""), formatFloat(float64(atomicLoad(&h.sumUs))/1e6))
+	fmt.Fprintf(t.w, "%s_count%s %d\n", name, formatLabels(labels, ""), cumulative)
+}
+
+// formatLabels monta o {a="x",b="y"} da série; le, se preenchido, entra por
+// último, como nos buckets de histograma
+func formatLabels(labels []Label, le string) string {
+	if len(labels) == 0 && le == "" {
+		return ""
+	}
+
+	b := []byte{'{'}
+	for i, l := range labels {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, l.Name...)
+		b = append(b, '=')
+		b = strconv.AppendQuote(b, l.Value)
+	}
+	if le != "" {
+		if len(labels) > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, "le="...)
+		b = strconv.AppendQuote(b, le)
+	}
+	return string(append(b, '}'))
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,190 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Label é um label de uma série
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sink recebe as séries percorridas pelo Collect. Describe anuncia cada
+// família (nome, ajuda e tipo: counter, gauge ou histogram) antes das suas
+// séries. O texto do Prometheus e o exporter StatsD são Sinks: uma métrica
+// nova entra só no Collect e aparece em todos.
+type Sink interface {
+	Describe(name, help, kind string)
+	Counter(name string, labels []Label, value int64)
+	Gauge(name string, labels []Label, value float64)
+	Histogram(name string, labels []Label, h *Histogram)
+}
+
+// Collect percorre todas as métricas, na ordem da documentação do pacote
+func Collect(s Sink) {
+	collectCounter(s, "rinha_payments_accepted_total", "Payments aceitos no POST /payments.", &PaymentsAccepted)
+	collectCounterVec(s, "rinha_payments_rejected_total", "Payments recusados na entrada por motivo.", "reason", PaymentsRejected)
+	collectCounterVec(s, "rinha_payments_by_type_total", "Payments aceitos (fila, inline ou sync) por type.", "type", PaymentsByType)
+	collectCounter(s, "rinha_payments_inline_total", "Payments processados na requisição com a fila cheia.", &PaymentsInline)
+	collectCounter(s, "rinha_payments_sync_total", "Payments processados na requisição a pedido do cliente.", &PaymentsSync)
+	collectCounter(s, "rinha_payments_dequeued_total", "Payments retirados da fila pelos workers.", &PaymentsDequeued)
+	collectCounter(s, "rinha_payments_failed_total", "Payments que falharam em todos os processadores.", &PaymentsFailed)
+	collectCounter(s, "rinha_payments_expired_total", "Payments descartados na fila por idade.", &PaymentsExpired)
+	collectCounterVec(s, "rinha_payments_retry_exhausted_total", "Payments que esgotaram o orçamento de tentativas por limite.", "budget", RetryExhausted)
+	collectCounter(s, "rinha_worker_batches_total", "Lotes processados pelos workers.", &WorkerBatches)
+	collectCounterVec(s, "rinha_worker_scale_events_total", "Ajustes do autoscaling do pool por direção.", "direction", WorkerScaleEvents)
+	collectCounter(s, "rinha_events_dropped_total", "Eventos do stream descartados por assinantes lentos.", &EventsDropped)
+	collectCounter(s, "rinha_http_shed_total", "Requisições recusadas pelo limite de requisições simultâneas.", &HTTPShed)
+	collectCounter(s, "rinha_status_transitions_invalid_total", "Mudanças de estado de payment recusadas.", &InvalidTransitions)
+	collectCounterVec(s, "rinha_panics_total", "Pânicos recuperados por origem.", "source", Panics)
+	collectCounterVec(s, "rinha_callbacks_total", "Callbacks de fim de processamento por desfecho.", "outcome", Callbacks)
+	collectCounterVec(s, "rinha_shadow_requests_total", "Cópias de payments ao fallback do modo shadow por desfecho.", "outcome", Shadow)
+	collectCounterVec(s, "rinha_failure_journal_total", "Linhas do journal de payments abandonados por desfecho.", "outcome", FailureJournal)
+	collectCounterVec(s, "rinha_queue_spill_total", "Payments do arquivo de spill da fila por desfecho.", "outcome", QueueSpill)
+	collectCounterVec(s, "rinha_summary_snapshots_total", "Snapshots do summary em disco por desfecho.", "outcome", SummarySnapshots)
+	collectCounter(s, "rinha_statsd_dropped_total", "Linhas do StatsD descartadas com a fila de envio cheia.", &StatsDDropped)
+
+	s.Describe("rinha_processor_requests_total", "Chamadas aos processadores por resultado.", "counter")
+	for _, name := range processorNames {
+		m := processors[name]
+		s.Counter("rinha_processor_requests_total", []Label{{"processor", name}, {"outcome", "success"}}, m.Success.Value())
+		s.Counter("rinha_processor_requests_total", []Label{{"processor", name}, {"outcome", "failure"}}, m.Failure.Value())
+	}
+
+	s.Describe("rinha_processor_errors_total", "Falhas nas chamadas aos processadores por classe.", "counter")
+	for _, name := range processorNames {
+		errs := processors[name].Errors
+		for i, class := range errs.values {
+			s.Counter("rinha_processor_errors_total", []Label{{"processor", name}, {"class", class}}, errs.counters[i].Value())
+		}
+	}
+
+	s.Describe("rinha_processor_retries_total", "Novas tentativas imediatas após falhas de conexão por desfecho.", "counter")
+	for _, name := range processorNames {
+		retries := processors[name].Retries
+		for i, outcome := range retries.values {
+			s.Counter("rinha_processor_retries_total", []Label{{"processor", name}, {"outcome", outcome}}, retries.counters[i].Value())
+		}
+	}
+
+	s.Describe("rinha_processor_chaos_injected_total", "Falhas injetadas nas chamadas aos processadores com CHAOS, por falha.", "counter")
+	for _, name := range processorNames {
+		chaos := processors[name].Chaos
+		for i, fault := range chaos.values {
+			s.Counter("rinha_processor_chaos_injected_total", []Label{{"processor", name}, {"fault", fault}}, chaos.counters[i].Value())
+		}
+	}
+
+	s.Describe("rinha_processor_receipts_total", "Comprovantes das respostas 2xx de payment por desfecho.", "counter")
+	for _, name := range processorNames {
+		receipts := processors[name].Receipts
+		for i, outcome := range receipts.values {
+			s.Counter("rinha_processor_receipts_total", []Label{{"processor", name}, {"outcome", outcome}}, receipts.counters[i].Value())
+		}
+	}
+
+	s.Describe("rinha_processor_duplicates_total", "Respostas de já processado dos processadores contadas como sucesso.", "counter")
+	for _, name := range processorNames {
+		s.Counter("rinha_processor_duplicates_total", []Label{{"processor", name}}, processors[name].Duplicates.Value())
+	}
+
+	s.Describe("rinha_processor_throttled_total", "Chamadas aos processadores puladas sem token no rate limit.", "counter")
+	for _, name := range processorNames {
+		s.Counter("rinha_processor_throttled_total", []Label{{"processor", name}}, processors[name].Throttled.Value())
+	}
+
+	s.Describe("rinha_processor_weighted_picks_total", "Payments enviados primeiro a cada processador pelo sorteio dos pesos.", "counter")
+	for _, name := range processorNames {
+		s.Counter("rinha_processor_weighted_picks_total", []Label{{"processor", name}}, processors[name].Weighted.Value())
+	}
+
+	s.Describe("rinha_processor_sticky_picks_total", "Payments enviados primeiro a cada processador pelo hash do correlationId.", "counter")
+	for _, name := range processorNames {
+		s.Counter("rinha_processor_sticky_picks_total", []Label{{"processor", name}}, processors[name].Sticky.Value())
+	}
+
+	s.Describe("rinha_processor_payments_by_type_total", "Payments aceitos pelos processadores por type.", "counter")
+	for _, name := range processorNames {
+		byType := processors[name].Types
+		for i, paymentType := range byType.values {
+			s.Counter("rinha_processor_payments_by_type_total", []Label{{"processor", name}, {"type", paymentType}}, byType.counters[i].Value())
+		}
+	}
+
+	s.Describe("rinha_processor_connections_total", "Conexões entregues às chamadas aos processadores, novas ou reaproveitadas do pool.", "counter")
+	for _, name := range processorNames {
+		conns := processors[name].Conns
+		for i, kind := range conns.values {
+			s.Counter("rinha_processor_connections_total", []Label{{"processor", name}, {"conn", kind}}, conns.counters[i].Value())
+		}
+	}
+
+	s.Describe("rinha_processor_request_duration_seconds", "Latência das chamadas aos processadores.", "histogram")
+	for _, name := range processorNames {
+		s.Histogram("rinha_processor_request_duration_seconds", []Label{{"processor", name}}, processors[name].Latency)
+	}
+
+	s.Describe("rinha_processor_dial_duration_seconds", "Duração do connect das conexões novas com os processadores.", "histogram")
+	for _, name := range processorNames {
+		s.Histogram("rinha_processor_dial_duration_seconds", []Label{{"processor", name}}, processors[name].Dial)
+	}
+
+	s.Describe("rinha_processor_first_byte_seconds", "Tempo do fim do envio ao primeiro byte da resposta dos processadores.", "histogram")
+	for _, name := range processorNames {
+		s.Histogram("rinha_processor_first_byte_seconds", []Label{{"processor", name}}, processors[name].FirstByte)
+	}
+
+	s.Describe("rinha_queue_wait_seconds", "Tempo dos payments na fila até um worker retirá-los.", "histogram")
+	s.Histogram("rinha_queue_wait_seconds", nil, QueueWait)
+
+	s.Describe("rinha_shadow_request_duration_seconds", "Latência das cópias de payments ao fallback do modo shadow.", "histogram")
+	s.Histogram("rinha_shadow_request_duration_seconds", nil, ShadowLatency)
+
+	gaugesMu.Lock()
+	registered := append([]gauge(nil), gauges...)
+	gaugesMu.Unlock()
+
+	lastName := ""
+	for _, g := range registered {
+		if g.name != lastName {
+			s.Describe(g.name, g.help, "gauge")
+			lastName = g.name
+		}
+		s.Gauge(g.name, g.labels, g.fn())
+	}
+}
+
+func collectCounter(s Sink, name, help string, c *Counter) {
+	s.Describe(name, help, "counter")
+	s.Counter(name, nil, c.Value())
+}
+
+func collectCounterVec(s Sink, name, help, label string, v *CounterVec) {
+	s.Describe(name, help, "counter")
+	for i, value := range v.values {
+		s.Counter(name, []Label{{label, value}}, v.counters[i].Value())
+	}
+}
+
+// parseLabels lê os labels no formato do Prometheus (`a="x",b="y"`) usado
+// pelo RegisterGauge; um trecho malformado encerra a leitura
+func parseLabels(s string) []Label {
+	var labels []Label
+	for s != "" {
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			break
+		}
+		name := s[:eq]
+		quoted, err := strconv.QuotedPrefix(s[eq+1:])
+		if err != nil {
+			break
+		}
+		value, _ := strconv.Unquote(quoted)
+		labels = append(labels, Label{Name: name, Value: value})
+		s = strings.TrimPrefix(s[eq+1+len(quoted):], ",")
+	}
+	return labels
+}
@@ -0,0 +1,234 @@
+package metrics
+
+import (
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxDatagram é o maior datagrama enviado ao agente: cabe em um pacote com
+// MTU de 1500 bytes, o limite recomendado pelo DogStatsD
+const maxDatagram = 1432
+
+// StatsDConfig configura o exporter DogStatsD
+type StatsDConfig struct {
+	Addr          string        // host:porta UDP do agente
+	Tags          []string      // tags globais, como "env:prod"
+	FlushInterval time.Duration // intervalo de envio de counters e gauges
+	QueueSize     int           // timings aguardando envio; com a fila cheia são descartados
+}
+
+// DefaultStatsDConfig retorna envio a cada 10s e fila de 4096 timings
+func DefaultStatsDConfig() StatsDConfig {
+	return StatsDConfig{
+		FlushInterval: 10 * time.Second,
+		QueueSize:     4096,
+	}
+}
+
+// pushNow pede ao exporter um envio antes do próximo intervalo
+var pushNow = make(chan struct{}, 1)
+
+// PushNow antecipa o envio das métricas, para eventos importantes como a
+// abertura do circuit breaker chegarem ao agente na hora. Não bloqueia e
+// não faz nada sem exporter.
+func PushNow() {
+	select {
+	case pushNow <- struct{}{}:
+	default:
+	}
+}
+
+// StatsD envia as métricas do Collect ao agente DogStatsD por UDP: counters
+// como a diferença desde o último envio, gauges com o valor atual e cada
+// observação dos histogramas como timing, em ms. Os labels viram tags.
+// Tudo é enviado por uma goroutine, agrupado em datagramas de até
+// maxDatagram; quem instrumenta só entrega o timing a uma fila, sem
+// bloquear.
+type StatsD struct {
+	conn     net.Conn
+	tags     []string
+	interval time.Duration
+	timings  chan string
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+
+	// Só a goroutine do exporter usa os campos abaixo
+	buf  []byte
+	sent map[string]int64 // último valor enviado de cada counter
+}
+
+// StartStatsD conecta ao agente e começa a enviar; o UDP não confirma a
+// conexão, então só um endereço inválido retorna erro
+func StartStatsD(cfg StatsDConfig) (*StatsD, error) {
+	def := DefaultStatsDConfig()
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = def.FlushInterval
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = def.QueueSize
+	}
+
+	conn, err := net.Dial("udp", cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &StatsD{
+		conn:     conn,
+		tags:     cfg.Tags,
+		interval: cfg.FlushInterval,
+		timings:  make(chan string, cfg.QueueSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		buf:      make([]byte, 0, maxDatagram),
+		sent:     make(map[string]int64),
+	}
+	Collect(watchSink{s})
+	go s.run()
+	return s, nil
+}
+
+// Stop faz o último envio e fecha a conexão; com o exporter nil não faz nada
+func (s *StatsD) Stop() {
+	if s == nil {
+		return
+	}
+	s.stopOnce.Do(func() { close(s.stop) })
+	<-s.done
+}
+
+func (s *StatsD) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case line := <-s.timings:
+			s.append(line)
+		case <-ticker.C:
+			s.push()
+		case <-pushNow:
+			s.push()
+		case <-s.stop:
+			for n := len(s.timings); n > 0; n-- {
+				s.append(<-s.timings)
+			}
+			s.push()
+			s.conn.Close()
+			return
+		}
+	}
+}
+
+// push coleta counters e gauges e envia tudo o que estiver no buffer
+func (s *StatsD) push() {
+	Collect(s)
+	s.flush()
+}
+
+// append acrescenta uma linha ao datagrama, enviando o atual se ela não
+// couber
+func (s *StatsD) append(line string) {
+	if len(s.buf) > 0 && len(s.buf)+1+len(line) > maxDatagram {
+		s.flush()
+	}
+	if len(s.buf) > 0 {
+		s.buf = append(s.buf, '\n')
+	}
+	s.buf = append(s.buf, line...)
+}
+
+// flush envia o datagrama. Um erro (agente fora do ar) perde só este
+// datagrama; o UDP não espera o agente.
+func (s *StatsD) flush() {
+	if len(s.buf) == 0 {
+		return
+	}
+	if _, err := s.conn.Write(s.buf); err != nil {
+		slog.Debug("statsd write failed", "error", err)
+	}
+	s.buf = s.buf[:0]
+}
+
+// Describe não tem equivalente no StatsD
+func (s *StatsD) Describe(name, help, kind string) {}
+
+// Counter envia o quanto o counter cresceu desde o último envio
+func (s *StatsD) Counter(name string, labels []Label, value int64) {
+	tags := s.tagString(labels)
+	key := name + tags
+	delta := value - s.sent[key]
+	s.sent[key] = value
+	if delta == 0 {
+		return
+	}
+	s.append(statsdName(name) + ":" + strconv.FormatInt(delta, 10) + "|c" + tags)
+}
+
+// Gauge envia o valor atual
+func (s *StatsD) Gauge(name string, labels []Label, value float64) {
+	s.append(statsdName(name) + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|g" + s.tagString(labels))
+}
+
+// Histogram não envia nada na coleta: as observações chegam uma a uma pelo
+// watchSink
+func (s *StatsD) Histogram(name string, labels []Label, h *Histogram) {}
+
+// timing entrega a observação à fila de envio, descartando-a se estiver cheia
+func (s *StatsD) timing(line string) {
+	select {
+	case s.timings <- line:
+	default:
+		StatsDDropped.Inc()
+	}
+}
+
+// tagString monta o "|#tag:valor,..." das tags globais e dos labels
+func (s *StatsD) tagString(labels []Label) string {
+	if len(s.tags) == 0 && len(labels) == 0 {
+		return ""
+	}
+
+	tags := make([]string, 0, len(s.tags)+len(labels))
+	tags = append(tags, s.tags...)
+	for _, l := range labels {
+		tags = append(tags, l.Name+":"+l.Value)
+	}
+	return "|#" + strings.Join(tags, ",")
+}
+
+// statsdName troca o prefixo rinha_ por rinha. e tira os sufixos _total e
+// _seconds do Prometheus: rinha_payments_accepted_total vira
+// rinha.payments_accepted
+func statsdName(name string) string {
+	name = strings.TrimSuffix(strings.TrimSuffix(name, "_total"), "_seconds")
+	if rest, ok := strings.CutPrefix(name, "rinha_"); ok {
+		return "rinha." + rest
+	}
+	return name
+}
+
+// watchSink liga o exporter a cada histograma do Collect, para as
+// observações saírem como timings
+type watchSink struct {
+	s *StatsD
+}
+
+func (w watchSink) Describe(name, help, kind string)                 {}
+func (w watchSink) Counter(name string, labels []Label, value int64) {}
+func (w watchSink) Gauge(name string, labels []Label, value float64) {}
+
+func (w watchSink) Histogram(name string, labels []Label, h *Histogram) {
+	prefix := statsdName(name) + ":"
+	suffix := "|ms" + w.s.tagString(labels)
+	h.watch(func(d time.Duration) {
+		w.s.timing(prefix + strconv.FormatFloat(float64(d.Microseconds())/1000, 'f', -1, 64) + suffix)
+	})
+}
@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ExponentialBounds retorna count limites de bucket em segundos, começando
+// em start e multiplicando por factor a cada bucket
+func ExponentialBounds(start, factor float64, count int) []float64 {
+	bounds := make([]float64, count)
+	for i := range bounds {
+		bounds[i] = start * math.Pow(factor, float64(i))
+	}
+	return bounds
+}
+
+// WindowHistogram é um histograma de janela deslizante: um ring buffer de
+// histogramas, cada um cobrindo width de tempo. A observação é atômica, sem
+// lock; só a primeira observação de um intervalo novo toma o lock para
+// zerar o slot reaproveitado. A janela efetiva fica entre (slots-1)*width e
+// slots*width, já que o slot atual está incompleto.
+type WindowHistogram struct {
+	bounds []float64
+	width  int64 // em nanossegundos
+	slots  []windowSlot
+	mu     sync.Mutex // só na troca de intervalo de um slot
+}
+
+type windowSlot struct {
+	epoch  atomic.Int64 // intervalo (tempo / width) que o slot guarda
+	counts []atomic.Int64
+	maxUs  atomic.Int64
+}
+
+// NewWindowHistogram cria o histograma com os limites de bounds (em
+// segundos) e uma janela de slots intervalos de width
+func NewWindowHistogram(bounds []float64, width time.Duration, slots int) *WindowHistogram {
+	h := &WindowHistogram{
+		bounds: bounds,
+		width:  int64(width),
+		slots:  make([]windowSlot, slots),
+	}
+	for i := range h.slots {
+		h.slots[i].epoch.Store(-1)
+		h.slots[i].counts = make([]atomic.Int64, len(bounds)+1) // último bucket é +Inf
+	}
+	return h
+}
+
+// Window retorna a duração coberta pelo ring buffer
+func (h *WindowHistogram) Window() time.Duration {
+	return time.Duration(h.width * int64(len(h.slots)))
+}
+
+// Observe registra uma duração no intervalo atual
+func (h *WindowHistogram) Observe(d time.Duration) {
+	epoch := time.Now().UnixNano() / h.width
+	slot := &h.slots[epoch%int64(len(h.slots))]
+	if slot.epoch.Load() != epoch {
+		h.rotate(slot, epoch)
+	}
+
+	i := sort.SearchFloat64s(h.bounds, d.Seconds())
+	slot.counts[i].Add(1)
+	us := d.Microseconds()
+	for {
+		max := slot.maxUs.Load()
+		if us <= max || slot.maxUs.CompareAndSwap(max, us) {
+			break
+		}
+	}
+}
+
+// rotate zera o slot para o intervalo epoch. O epoch só é gravado depois de
+// zerar, então quem o vê atualizado conta no slot já limpo.
+func (h *WindowHistogram) rotate(slot *windowSlot, epoch int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if slot.epoch.Load() >= epoch {
+		return
+	}
+	for i := range slot.counts {
+		slot.counts[i].Store(0)
+	}
+	slot.maxUs.Store(0)
+	slot.epoch.Store(epoch)
+}
+
+// Snapshot soma os slots ainda dentro da janela. Como no Histogram, as
+// leituras são atômicas mas não simultâneas.
+func (h *WindowHistogram) Snapshot() HistogramSnapshot {
+	epoch := time.Now().UnixNano() / h.width
+	snap := HistogramSnapshot{
+		Bounds: h.bounds,
+		Counts: make([]int64, len(h.bounds)+1),
+	}
+
+	var maxUs int64
+	for i := range h.slots {
+		slot := &h.slots[i]
+		if e := slot.epoch.Load(); e < 0 || e <= epoch-int64(len(h.slots)) {
+			continue
+		}
+		for j := range slot.counts {
+			n := slot.counts[j].Load()
+			snap.Counts[j] += n
+			snap.Count += n
+		}
+		maxUs = max(maxUs, slot.maxUs.Load())
+	}
+	snap.Max = time.Duration(maxUs) * time.Microsecond
+	return snap
+}
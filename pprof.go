@@ -0,0 +1,49 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+
+	"github.com/yurimachados/rinha-backend-go/config"
+)
+
+// startPprof serve os handlers do net/http/pprof (profile, heap, goroutine,
+// trace, block, mutex...) em um listener próprio, nunca no mux público: o
+// mux é montado aqui e o import do pacote só registra as rotas no
+// http.DefaultServeMux, que nenhum servidor atende. Um endereço que cairia
+// na mesma porta TCP do servidor público já foi recusado pelo
+// config.Validate.
+func startPprof(cfg config.Pprof) (*http.Server, error) {
+	listener, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	runtime.SetBlockProfileRate(cfg.BlockRate)
+	runtime.SetMutexProfileFraction(cfg.MutexFraction)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index) // heap, goroutine, block, mutex, allocs...
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	// Sem WriteTimeout: profile e trace respondem só depois de ?seconds=.
+	// Addr guarda o endereço efetivo, com a porta escolhida para ":0".
+	server := &http.Server{Addr: listener.Addr().String(), Handler: mux}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			slog.Error("pprof server failed", "error", err)
+		}
+	}()
+
+	slog.Warn("pprof enabled",
+		"addr", listener.Addr().String(),
+		"block_profile_rate", cfg.BlockRate,
+		"mutex_profile_fraction", cfg.MutexFraction)
+	return server, nil
+}
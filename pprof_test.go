@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"runtime"
+	"testing"
+
+	"github.com/yurimachados/rinha-backend-go/config"
+)
+
+func TestPprofServesHeapProfile(t *testing.T) {
+	defer runtime.SetMutexProfileFraction(runtime.SetMutexProfileFraction(-1))
+	defer runtime.SetBlockProfileRate(0)
+
+	server, err := startPprof(config.Pprof{Enabled: true, Addr: "127.0.0.1:0", BlockRate: 1, MutexFraction: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	if got := runtime.SetMutexProfileFraction(-1); got != 5 {
+		t.Errorf("mutex profile fraction = %d, want PPROF_MUTEX_FRACTION 5", got)
+	}
+
+	resp, err := http.Get("http://" + server.Addr + "/debug/pprof/heap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /debug/pprof/heap status = %d, body %s", resp.StatusCode, body)
+	}
+	// O profile é um protobuf com gzip
+	if !bytes.HasPrefix(body, []byte{0x1f, 0x8b}) {
+		t.Errorf("heap profile is not gzip (%d bytes, Content-Type %q)", len(body), resp.Header.Get("Content-Type"))
+	}
+
+	for _, path := range []string{"/debug/pprof/goroutine?debug=1", "/debug/pprof/block", "/debug/pprof/mutex", "/debug/pprof/cmdline"} {
+		resp, err := http.Get("http://" + server.Addr + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s status = %d, want 200", path, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package queue
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// amountHistogram conta os valores dos payments processados com sucesso por
+// um processador em buckets de limites fixos, em centavos. Cada observação
+// só faz operações atômicas, sem lock no caminho dos workers.
+type amountHistogram struct {
+	bounds []int64
+	counts []int64 // não cumulativo; o último bucket é +Inf
+	count  int64
+	sum    int64
+	min    int64 // math.MaxInt64 sem observações
+	max    int64
+}
+
+func newAmountHistogram(bounds []int64) *amountHistogram {
+	return &amountHistogram{
+		bounds: bounds,
+		counts: make([]int64, len(bounds)+1),
+		min:    math.MaxInt64,
+	}
+}
+
+func (h *amountHistogram) observe(amount int64) {
+	i, _ := slices.BinarySearch(h.bounds, amount) // primeiro limite >= amount
+	atomic.AddInt64(&h.counts[i], 1)
+	atomic.AddInt64(&h.count, 1)
+	types.AddAmountAtomic(&h.sum, amount)
+	for {
+		min := atomic.LoadInt64(&h.min)
+		if amount >= min || atomic.CompareAndSwapInt64(&h.min, min, amount) {
+			break
+		}
+	}
+	for {
+		max := atomic.LoadInt64(&h.max)
+		if amount <= max || atomic.CompareAndSwapInt64(&h.max, max, amount) {
+			break
+		}
+	}
+}
+
+// stats copia o histograma. As leituras são atômicas mas não simultâneas,
+// então a cópia pode incluir parcialmente observações concorrentes.
+func (h *amountHistogram) stats() types.AmountStats {
+	stats := types.AmountStats{
+		Count:   atomic.LoadInt64(&h.count),
+		Max:     atomic.LoadInt64(&h.max),
+		Buckets: make([]types.AmountBucket, len(h.counts)),
+	}
+	if min := atomic.LoadInt64(&h.min); min != math.MaxInt64 {
+		stats.Min = min
+	}
+	if stats.Count > 0 {
+		stats.Mean = float64(atomic.LoadInt64(&h.sum)) / float64(stats.Count)
+	}
+	for i := range h.counts {
+		le := "+Inf"
+		if i < len(h.bounds) {
+			le = strconv.FormatInt(h.bounds[i], 10)
+		}
+		stats.Buckets[i] = types.AmountBucket{Le: le, Count: atomic.LoadInt64(&h.counts[i])}
+	}
+	return stats
+}
+
+// processorAmounts são os histogramas de valores dos dois processadores,
+// trocados juntos no reset das estatísticas
+type processorAmounts struct {
+	defaultHist  *amountHistogram
+	fallbackHist *amountHistogram
+}
+
+func newProcessorAmounts(bounds []int64) *processorAmounts {
+	return &processorAmounts{
+		defaultHist:  newAmountHistogram(bounds),
+		fallbackHist: newAmountHistogram(bounds),
+	}
+}
+
+func (a *processorAmounts) stats() map[string]types.AmountStats {
+	return map[string]types.AmountStats{
+		"default":  a.defaultHist.stats(),
+		"fallback": a.fallbackHist.stats(),
+	}
+}
+
+// observeAmount registra o valor de um payment processado com sucesso. Só
+// os da moeda padrão entram: valores de moedas diferentes não se misturam
+// numa mesma distribuição.
+func (p *PaymentProcessor) observeAmount(processorID string, amount int64) {
+	a := p.amounts.Load()
+	if processorID == "default" {
+		a.defaultHist.observe(amount)
+	} else {
+		a.fallbackHist.observe(amount)
+	}
+}
+
+// AmountStats resume a distribuição dos valores processados com sucesso por
+// processador desde o boot ou o último reset
+func (p *PaymentProcessor) AmountStats() map[string]types.AmountStats {
+	return p.amounts.Load().stats()
+}
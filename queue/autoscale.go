@@ -0,0 +1,119 @@
+package queue
+
+import (
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+)
+
+// supervise amostra a fila a cada ScaleInterval e ajusta o pool: cresce
+// quando a profundidade fica acima do high watermark por ScaleUpAfter
+// amostras seguidas e encolhe quando fica abaixo do low watermark por
+// ScaleDownAfter amostras. A taxa de enfileiramento vai para logs e stats.
+// Com o processamento pausado o pool não é ajustado.
+func (wp *WorkerPool) supervise() {
+	defer wp.wg.Done()
+
+	cfg := wp.config
+	ticker := time.NewTicker(cfg.ScaleInterval)
+	defer ticker.Stop()
+
+	var above, below int
+	lastAccepted := metrics.PaymentsAccepted.Value()
+
+	for {
+		select {
+		case <-wp.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		depth := wp.backend.Len()
+		accepted := metrics.PaymentsAccepted.Value()
+		rate := int64(float64(accepted-lastAccepted) / cfg.ScaleInterval.Seconds())
+		lastAccepted = accepted
+		wp.enqueueRate.Store(rate)
+
+		// Pausado, o backlog cresce de propósito; crescer o pool só faria a
+		// retomada chegar mais forte ao processador
+		if wp.Paused() {
+			above, below = 0, 0
+			continue
+		}
+
+		switch {
+		case depth >= cfg.ScaleHighWatermark:
+			above++
+			below = 0
+		case depth <= cfg.ScaleLowWatermark:
+			below++
+			above = 0
+		default:
+			above, below = 0, 0
+		}
+
+		if above >= cfg.ScaleUpAfter {
+			wp.scaleUp(depth, rate)
+			above = 0
+		}
+		if below >= cfg.ScaleDownAfter {
+			wp.scaleDown(depth, rate)
+			below = 0
+		}
+	}
+}
+
+// scaleStep é o passo de cada ajuste: um quarto do pool, no mínimo um worker
+func scaleStep(current int) int {
+	return max(current/4, 1)
+}
+
+// scaleUp inicia novos workers, até MaxWorkers
+func (wp *WorkerPool) scaleUp(depth int, rate int64) {
+	current := int(wp.workers.Load())
+	target := min(current+scaleStep(current), wp.config.MaxWorkers)
+	if target <= current {
+		return
+	}
+
+	for i := current; i < target; i++ {
+		wp.startWorker()
+	}
+
+	wp.scaleUps.Add(1)
+	metrics.WorkerScaleEvents.Inc(metrics.ScaleUp)
+	wp.logger.Info("worker pool scaled up",
+		"from", current,
+		"to", target,
+		logging.KeyQueueDepth, depth,
+		"enqueue_rate", rate)
+}
+
+// scaleDown pede a workers ociosos que terminem, até MinWorkers. O envio
+// não bloqueia: um worker no meio de um lote não recebe o pedido, então o
+// pool pode encolher menos que o passo e tenta de novo na próxima rodada.
+func (wp *WorkerPool) scaleDown(depth int, rate int64) {
+	current := int(wp.workers.Load())
+	want := min(scaleStep(current), current-wp.config.MinWorkers)
+
+	stopped := 0
+	for i := 0; i < want; i++ {
+		select {
+		case wp.stop <- struct{}{}:
+			stopped++
+		default:
+		}
+	}
+	if stopped == 0 {
+		return
+	}
+
+	wp.scaleDowns.Add(1)
+	metrics.WorkerScaleEvents.Inc(metrics.ScaleDown)
+	wp.logger.Info("worker pool scaled down",
+		"from", current,
+		"to", current-stopped,
+		logging.KeyQueueDepth, depth,
+		"enqueue_rate", rate)
+}
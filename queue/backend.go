@@ -0,0 +1,62 @@
+package queue
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// Job representa um payment entregue pela fila a um worker
+type Job struct {
+	Payment     *types.PaymentRequest
+	ackID       string            // identificador do item no backend (vazio no backend em memória)
+	spanContext trace.SpanContext // span do aceite, vinculado ao span do worker
+	requestID   string            // id da requisição que aceitou o payment
+	enqueuedAt  time.Time         // usado para descartar jobs vencidos (QueueTTL)
+
+	// Orçamento de tentativas, só na memória desta instância: um job
+	// reentregue pelo Redis recomeça a conta
+	firstAttemptAt time.Time
+	attempts       int                    // passagens pelo processamento
+	calls          int                    // chamadas aos processadores, somando as passagens
+	history        []types.PaymentAttempt // passagens reagendadas, as retryHistory mais recentes
+	exhausted      string                 // limite esgotado (metrics.Budget*), no job rebaixado
+
+	landed *atomic.Bool // saiu dos em voo; compartilhado entre as cópias do job
+}
+
+// context retorna o contexto do processamento do job, com o id da
+// requisição de origem para os logs e a chamada ao processador
+func (j Job) context() context.Context {
+	return logging.WithRequestID(context.Background(), j.requestID)
+}
+
+// Backend define a fila que alimenta o WorkerPool
+type Backend interface {
+	// Push enfileira sem bloquear, retornando false se a fila estiver cheia.
+	// Ao retornar true o backend assume o payment, que volta ao pool depois
+	// do processamento; o chamador não deve mais acessá-lo.
+	Push(job Job) bool
+	// Deliveries entrega os jobs aos workers; é fechado pelo Close
+	Deliveries() <-chan Job
+	// Ack confirma que o job foi processado e não deve ser reentregue
+	Ack(job Job)
+	// Len retorna a quantidade de itens aguardando processamento
+	Len() int
+	// Cap retorna a capacidade máxima da fila
+	Cap() int
+	// Close encerra a fila
+	Close()
+}
+
+// resizable é implementado pelas filas cuja capacidade muda em execução
+// (POST /admin/queue/capacity). Reduzida, a capacidade só recusa os
+// próximos Push: os jobs que já estão na fila não são descartados.
+type resizable interface {
+	SetCap(capacity int)
+}
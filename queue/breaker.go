@@ -0,0 +1,243 @@
+package queue
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// failureBreaker é o circuit breaker de um processador por taxa de falhas:
+// conta os sucessos e as falhas das chamadas em uma janela deslizante de
+// buckets de 1s e abre quando, com pelo menos minRequests chamadas na
+// janela, as falhas chegam a failurePercent% delas. Poucas falhas em
+// muito tráfego não abrem o breaker, e um processador que falha em boa
+// parte das chamadas abre mesmo com sucessos no meio. Aberto, o
+// processador sai do roteamento por openFor e só então um health check (ou
+// uma chamada bem-sucedida) pode reabilitá-lo, o que zera a janela.
+//
+// openFor cresce por openMultiplier a cada nova abertura, até openMax: um
+// processador fora do ar por um minuto não alterna entre receber tráfego e
+// abrir de novo a cada segundo. Depois de openReset fechado a próxima
+// abertura volta a openBase.
+type failureBreaker struct {
+	buckets        []breakerBucket
+	failurePercent int64
+	minRequests    int64
+
+	openBase       time.Duration
+	openMultiplier int64
+	openMax        time.Duration
+	openReset      time.Duration
+
+	open  atomic.Bool
+	trips atomic.Int64
+
+	mu       sync.Mutex    // na troca de segundo de um bucket, na abertura e no fechamento
+	openFor  time.Duration // duração da abertura atual ou da última
+	probeAt  atomic.Int64  // Unix ns a partir do qual o breaker aberto pode fechar
+	closedAt time.Time
+	reopens  int64 // aberturas seguidas sem openReset fechado entre elas
+}
+
+// breakerBucket são as chamadas de um segundo
+type breakerBucket struct {
+	second    atomic.Int64 // segundo Unix das contagens
+	successes atomic.Int64
+	failures  atomic.Int64
+}
+
+func newFailureBreaker(cfg ProcessorConfig) *failureBreaker {
+	return &failureBreaker{
+		buckets:        make([]breakerBucket, max(int(cfg.BreakerWindow/time.Second), 1)),
+		failurePercent: int64(cfg.BreakerFailurePercent),
+		minRequests:    int64(cfg.BreakerMinRequests),
+		openBase:       cfg.BreakerOpenBase,
+		openMultiplier: int64(cfg.BreakerOpenMultiplier),
+		openMax:        cfg.BreakerOpenMax,
+		openReset:      cfg.BreakerOpenReset,
+	}
+}
+
+// bucket retorna o bucket do segundo now, zerando-o se ainda guarda um
+// segundo anterior; nil se now já saiu da janela (chamada lenta que
+// terminou depois de o bucket ser reaproveitado)
+func (b *failureBreaker) bucket(now int64) *breakerBucket {
+	bk := &b.buckets[now%int64(len(b.buckets))]
+	if second := bk.second.Load(); second == now {
+		return bk
+	} else if second > now {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch second := bk.second.Load(); {
+	case second > now:
+		return nil
+	case second < now:
+		// Zera antes de publicar o segundo: quem vê o segundo novo conta
+		// a partir do zero
+		bk.successes.Store(0)
+		bk.failures.Store(0)
+		bk.second.Store(now)
+	}
+	return bk
+}
+
+// record conta uma chamada e retorna true se ela abriu o breaker
+func (b *failureBreaker) record(failed bool) bool {
+	now := time.Now().Unix()
+	if bk := b.bucket(now); bk != nil {
+		if failed {
+			bk.failures.Add(1)
+		} else {
+			bk.successes.Add(1)
+		}
+	}
+
+	// Só uma falha pode abrir o breaker
+	if !failed || b.open.Load() {
+		return false
+	}
+	requests, failures := b.counts(now)
+	if requests < b.minRequests || failures*100 < b.failurePercent*requests {
+		return false
+	}
+	return b.trip()
+}
+
+// trip abre o breaker, se ainda não abriu, com a próxima duração do
+// backoff
+func (b *failureBreaker) trip() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.open.Load() {
+		return false
+	}
+
+	now := time.Now()
+	if b.backoffReset(now) {
+		b.reopens = 0
+	}
+	b.openFor = b.nextOpenFor(now)
+	b.reopens++
+	b.probeAt.Store(now.Add(b.openFor).UnixNano())
+	b.open.Store(true)
+	b.trips.Add(1)
+	return true
+}
+
+// backoffReset indica se a próxima abertura volta à base: é a primeira ou
+// o breaker ficou openReset fechado; chamado com o lock
+func (b *failureBreaker) backoffReset(now time.Time) bool {
+	return b.openFor == 0 || now.Sub(b.closedAt) >= b.openReset
+}
+
+// nextOpenFor retorna a duração da próxima abertura: a base depois do
+// reset, senão a anterior multiplicada até o teto; chamado com o lock
+func (b *failureBreaker) nextOpenFor(now time.Time) time.Duration {
+	if b.backoffReset(now) {
+		return b.openBase
+	}
+	return min(b.openFor*time.Duration(b.openMultiplier), b.openMax)
+}
+
+// counts soma as chamadas e as falhas dos buckets dentro da janela
+func (b *failureBreaker) counts(now int64) (requests, failures int64) {
+	oldest := now - int64(len(b.buckets))
+	for i := range b.buckets {
+		bk := &b.buckets[i]
+		if second := bk.second.Load(); second <= oldest || second > now {
+			continue
+		}
+		f := bk.failures.Load()
+		requests += bk.successes.Load() + f
+		failures += f
+	}
+	return requests, failures
+}
+
+// probeDue indica se o breaker aberto já cumpriu openFor e pode fechar
+func (b *failureBreaker) probeDue(now time.Time) bool {
+	return now.UnixNano() >= b.probeAt.Load()
+}
+
+// close fecha o breaker, se ele já cumpriu openFor, e zera a janela, para
+// as falhas que o abriram não o abrirem de novo na primeira falha
+// seguinte. closed indica se o processador pode voltar ao roteamento (o
+// breaker já estava fechado ou acabou de fechar) e wasOpen, se ele estava
+// aberto.
+func (b *failureBreaker) close() (closed, wasOpen bool) {
+	if !b.open.Load() {
+		return true, false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if !b.open.Load() {
+		return true, false
+	}
+	if !b.probeDue(now) {
+		return false, true
+	}
+
+	b.open.Store(false)
+	b.closedAt = now
+	for i := range b.buckets {
+		bk := &b.buckets[i]
+		bk.second.Store(0)
+		bk.successes.Store(0)
+		bk.failures.Store(0)
+	}
+	return true, true
+}
+
+// postpone adia o próximo fechamento possível por mais openFor, sem
+// aumentar a duração: um health check que falhou não é uma nova abertura
+func (b *failureBreaker) postpone() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.open.Load() {
+		b.probeAt.Store(time.Now().Add(b.openFor).UnixNano())
+	}
+}
+
+// stats retorna as contagens da janela e o backoff agora
+func (b *failureBreaker) stats() types.ProcessorBreaker {
+	now := time.Now()
+	requests, failures := b.counts(now.Unix())
+	var percent int
+	if requests > 0 {
+		percent = int(failures * 100 / requests)
+	}
+
+	b.mu.Lock()
+	openFor, reopens := b.openFor, b.reopens
+	var nextProbe *time.Time
+	if b.open.Load() {
+		at := time.Unix(0, b.probeAt.Load())
+		nextProbe = &at
+	} else {
+		if b.backoffReset(now) {
+			reopens = 0
+		}
+		openFor = b.nextOpenFor(now)
+	}
+	b.mu.Unlock()
+
+	return types.ProcessorBreaker{
+		WindowSeconds:  len(b.buckets),
+		Requests:       requests,
+		Failures:       failures,
+		FailurePercent: percent,
+		ThresholdPct:   int(b.failurePercent),
+		MinRequests:    b.minRequests,
+		Trips:          b.trips.Load(),
+		OpenMs:         openFor.Milliseconds(),
+		Reopens:        reopens,
+		NextProbeAt:    nextProbe,
+	}
+}
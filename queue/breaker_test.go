@@ -0,0 +1,228 @@
+package queue
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// percent distribui p% de falhas uniformemente pela sequência: em
+// qualquer prefixo, as falhas nunca passam de p% das chamadas
+func percent(p int) func(i int) bool {
+	return func(i int) bool { return (i+1)*p/100 > i*p/100 }
+}
+
+// testBreaker é o breaker padrão (janela de 10s, mínimo de 20 chamadas)
+// com o limiar de falhas dado
+func testBreaker(failurePercent int) *failureBreaker {
+	cfg := DefaultProcessorConfig()
+	cfg.BreakerFailurePercent = failurePercent
+	return newFailureBreaker(cfg)
+}
+
+// ageBreaker empurra as contagens da janela para o passado, como se
+// tivessem passado seconds segundos sem chamadas, movendo cada uma para o
+// bucket do seu novo segundo
+func ageBreaker(b *failureBreaker, seconds int64) {
+	type counts struct{ second, successes, failures int64 }
+	var aged []counts
+	for i := range b.buckets {
+		bk := &b.buckets[i]
+		if second := bk.second.Load(); second != 0 {
+			aged = append(aged, counts{second - seconds, bk.successes.Load(), bk.failures.Load()})
+		}
+		bk.second.Store(0)
+		bk.successes.Store(0)
+		bk.failures.Store(0)
+	}
+	for _, c := range aged {
+		bk := &b.buckets[c.second%int64(len(b.buckets))]
+		bk.second.Store(c.second)
+		bk.successes.Store(c.successes)
+		bk.failures.Store(c.failures)
+	}
+}
+
+func TestBreakerMixedStreams(t *testing.T) {
+	tests := []struct {
+		name           string
+		calls          int
+		failed         func(i int) bool
+		thresholdPct   int
+		wantTripAtCall int // 0: não abre
+	}{
+		{"no failures in heavy traffic", 3000, percent(0), 50, 0},
+		{"3 failures in a row in 3000 calls", 3000, func(i int) bool { return i >= 1500 && i < 1503 }, 50, 0},
+		{"1% failing", 3000, percent(1), 50, 0},
+		{"40% failing under a 50% threshold", 1000, percent(40), 50, 0},
+		{"49% failing under a 50% threshold", 1000, percent(49), 50, 0},
+		{"40% failing over a 30% threshold", 1000, percent(40), 30, 20},
+		{"exactly at the threshold", 1000, percent(50), 50, 20},
+		{"60% failing", 1000, percent(60), 50, 20},
+		{"every call failing", 1000, percent(100), 50, 20},
+		{"every call failing below the minimum sample", 19, percent(100), 50, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := testBreaker(tt.thresholdPct)
+			var failures int64
+			for i := range tt.calls {
+				failed := tt.failed(i)
+				if failed {
+					failures++
+				}
+				if b.record(failed) {
+					if tt.wantTripAtCall == 0 {
+						t.Fatalf("breaker opened at call %d with %d failures", i+1, failures)
+					} else if i+1 != tt.wantTripAtCall {
+						t.Fatalf("breaker opened at call %d, want %d", i+1, tt.wantTripAtCall)
+					}
+					break
+				}
+			}
+
+			if open := b.open.Load(); open != (tt.wantTripAtCall != 0) {
+				t.Fatalf("breaker open = %v after the stream, want %v", open, !open)
+			}
+			if tt.wantTripAtCall == 0 {
+				assertBreakerCounts(t, b, int64(tt.calls), failures)
+			} else if got := b.trips.Load(); got != 1 {
+				t.Errorf("trips = %d, want 1", got)
+			}
+		})
+	}
+}
+
+// assertBreakerCounts confere as contagens da janela nas estatísticas
+func assertBreakerCounts(t *testing.T, b *failureBreaker, requests, failures int64) {
+	t.Helper()
+	stats := b.stats()
+	if stats.Requests != requests || stats.Failures != failures || stats.Trips != 0 {
+		t.Errorf("stats = %+v, want %d requests, %d failures and no trips", stats, requests, failures)
+	}
+	if want := int(failures * 100 / requests); stats.FailurePercent != want {
+		t.Errorf("failure percent = %d, want %d", stats.FailurePercent, want)
+	}
+}
+
+func TestBreakerConcurrentStreams(t *testing.T) {
+	run := func(b *failureBreaker, failPercent int) (tripped int) {
+		failed := percent(failPercent)
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range 500 {
+					if b.record(failed(i)) {
+						mu.Lock()
+						tripped++
+						mu.Unlock()
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		return tripped
+	}
+
+	// Cada goroutine nunca passa de 40% em nenhum prefixo, então a soma
+	// também não: o breaker não abre em nenhuma intercalação
+	b := testBreaker(50)
+	if got := run(b, 40); got != 0 || b.open.Load() {
+		t.Fatalf("40%% failing across 8 workers opened the breaker %d times", got)
+	}
+	assertBreakerCounts(t, b, 8*500, 8*200)
+
+	// Com 60%, abre uma vez só, por mais workers que vejam o limiar
+	b = testBreaker(50)
+	if got := run(b, 60); got != 1 || b.trips.Load() != 1 {
+		t.Fatalf("60%% failing across 8 workers: record reported %d trips, counted %d; want 1", got, b.trips.Load())
+	}
+}
+
+func TestBreakerWindowSlides(t *testing.T) {
+	b := testBreaker(50)
+	for i := range 19 {
+		if b.record(true) {
+			t.Fatalf("breaker opened at call %d, below the minimum sample", i+1)
+		}
+	}
+
+	// As falhas saem da janela: 2 chamadas novas não chegam ao mínimo
+	ageBreaker(b, int64(len(b.buckets)))
+	b.record(false)
+	if b.record(true) {
+		t.Fatal("failures older than the window opened the breaker")
+	}
+	if stats := b.stats(); stats.Requests != 2 || stats.Failures != 1 {
+		t.Fatalf("stats = %+v, want only the 2 calls inside the window", stats)
+	}
+
+	// Dentro da janela, as chamadas de segundos anteriores ainda contam: só
+	// com elas as 18 novas chegam às 20 do mínimo
+	ageBreaker(b, 1)
+	for range 9 {
+		b.record(false)
+	}
+	for i := range 9 {
+		if tripped := b.record(true); tripped != (i == 8) {
+			t.Fatalf("failure %d: tripped = %v, want a trip only at the 20th call", i+1, tripped)
+		}
+	}
+	if stats := b.stats(); stats.Requests != 20 || stats.Failures != 10 {
+		t.Errorf("opened with %+v, want 20 requests and 10 failures", stats)
+	}
+}
+
+func TestBreakerBackoff(t *testing.T) {
+	b := testBreaker(50)
+	trip := func() {
+		t.Helper()
+		for i := range 20 {
+			if b.record(true) {
+				return
+			} else if b.open.Load() {
+				t.Fatalf("breaker already open at call %d", i+1)
+			}
+		}
+		t.Fatal("20 failures did not open the breaker")
+	}
+	reopen := func() {
+		t.Helper()
+		if closed, wasOpen := b.close(); closed || !wasOpen {
+			t.Fatalf("close() = %v, %v before openFor, want false, true", closed, wasOpen)
+		}
+		b.probeAt.Store(0)
+		if closed, wasOpen := b.close(); !closed || !wasOpen {
+			t.Fatalf("close() = %v, %v after openFor, want true, true", closed, wasOpen)
+		}
+		if stats := b.stats(); stats.Requests != 0 {
+			t.Fatalf("closing left %d requests in the window", stats.Requests)
+		}
+	}
+
+	// 1s, dobrando a cada reabertura até o teto de 30s
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 30 * time.Second, 30 * time.Second} {
+		trip()
+		if got := time.Duration(b.stats().OpenMs) * time.Millisecond; got != want {
+			t.Fatalf("open for %s after %d trips, want %s", got, b.trips.Load(), want)
+		}
+		// Um health check que falhou adia o fechamento sem aumentar a duração
+		b.postpone()
+		if got := b.openFor; got != want {
+			t.Fatalf("postpone changed openFor to %s, want %s", got, want)
+		}
+		reopen()
+	}
+
+	// Depois de openReset fechado, a próxima abertura volta à base
+	b.mu.Lock()
+	b.closedAt = b.closedAt.Add(-b.openReset)
+	b.mu.Unlock()
+	trip()
+	if stats := b.stats(); stats.OpenMs != time.Second.Milliseconds() || stats.Reopens != 1 {
+		t.Fatalf("after a quiet period: %+v, want 1s and the first reopen", stats)
+	}
+}
@@ -0,0 +1,107 @@
+package queue
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// reasonBudgetExhausted é a falha de um payment rebaixado ao journal por
+// esgotar o orçamento de tentativas
+const reasonBudgetExhausted = "retry_budget_exhausted"
+
+// retryHistory são as passagens reagendadas guardadas no job para o
+// journal; as mais antigas saem primeiro
+const retryHistory = 10
+
+// retryBudget é o teto de tentativas de um payment: maxAttempts passagens
+// pelo processamento ou maxElapsed desde a primeira, o que vier antes. As
+// passagens contam igual, qualquer que seja o processador chamado.
+type retryBudget struct {
+	maxAttempts int           // 0 desliga
+	maxElapsed  time.Duration // 0 desliga
+}
+
+func newRetryBudget(cfg PoolConfig) retryBudget {
+	return retryBudget{maxAttempts: cfg.RetryMaxAttempts, maxElapsed: cfg.RetryMaxElapsed}
+}
+
+// exhausted retorna o limite que o job esgotou, ou "" se ele ainda pode
+// ser reagendado
+func (b retryBudget) exhausted(j *Job, now time.Time) string {
+	switch {
+	case b.maxAttempts > 0 && j.attempts >= b.maxAttempts:
+		return metrics.BudgetAttempts
+	case b.maxElapsed > 0 && now.Sub(j.firstAttemptAt) >= b.maxElapsed:
+		return metrics.BudgetElapsed
+	}
+	return ""
+}
+
+// recordAttempt conta uma passagem do job pelo processamento, iniciada em
+// start
+func (j *Job) recordAttempt(start time.Time, result *types.ProcessorResult) {
+	if j.attempts == 0 {
+		j.firstAttemptAt = start
+	}
+	j.attempts++
+	j.calls += result.Attempts
+}
+
+// recordRetry guarda no histórico uma passagem que vai ser reagendada.
+// Só elas: um payment resolvido na primeira passagem não aloca nada.
+func (j *Job) recordRetry(start time.Time, result *types.ProcessorResult) {
+	if len(j.history) == retryHistory {
+		j.history = append(j.history[:0], j.history[1:]...)
+	}
+	j.history = append(j.history, types.PaymentAttempt{
+		At:        start.UTC(),
+		Processor: result.ProcessorID,
+		Reason:    result.Reason,
+		Calls:     result.Attempts,
+	})
+}
+
+// attempt é a passagem de um job pelo processamento, a partir do lote do
+// worker ou de um reagendamento. Toda origem de nova tentativa passa por
+// aqui, e só aqui o orçamento é conferido: um job reagendável que já o
+// esgotou é rebaixado ao journal em vez de voltar à espera.
+func (wp *WorkerPool) attempt(stats *workerStats, j Job) {
+	start := time.Now()
+	result := wp.processJob(j.context(), j)
+	j.recordAttempt(start, result)
+	if result.Reason != reasonThrottled && result.Reason != reasonRouteUnavailable {
+		wp.complete(stats, j, result)
+		return
+	}
+
+	j.recordRetry(start, result)
+	if budget := wp.budget.exhausted(&j, time.Now()); budget != "" {
+		wp.demote(stats, j, budget)
+		return
+	}
+	if result.Reason == reasonRouteUnavailable {
+		wp.retryRoute(stats, j)
+		return
+	}
+	wp.retryThrottled(stats, j)
+}
+
+// demote encerra como falha um job que esgotou o orçamento. As passagens
+// reagendadas não foram contabilizadas, então ele entra agora em
+// total_payments e total_errors.
+func (wp *WorkerPool) demote(stats *workerStats, j Job, budget string) {
+	metrics.RetryExhausted.Inc(budget)
+	wp.processor.recordAttempt()
+	wp.processor.recordFailure()
+	j.exhausted = budget
+	wp.complete(stats, j, &types.ProcessorResult{
+		ProcessorID: "none",
+		Reason:      reasonBudgetExhausted,
+		Error: fmt.Errorf("retry budget exhausted (%s) after %d attempts in %s",
+			budget, j.attempts, time.Since(j.firstAttemptAt).Round(time.Millisecond)),
+		Attempts: j.calls,
+	})
+}
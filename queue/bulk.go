@@ -0,0 +1,251 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/tracing"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// BulkConfig configura o envio em lote aos processadores. Uma URL vazia
+// mantém o envio individual para aquele processador.
+type BulkConfig struct {
+	DefaultURL  string
+	FallbackURL string
+	MaxItems    int // payments por chamada
+}
+
+// bulkEndpoint é o endpoint de lote de um processador. Um 404/405 marca o
+// endpoint como ausente e o envio volta a ser individual até o restart.
+type bulkEndpoint struct {
+	url         string
+	unsupported atomic.Bool
+}
+
+// UseBulk liga o envio em lote para os processadores com URL de lote
+func (p *PaymentProcessor) UseBulk(cfg BulkConfig) {
+	if cfg.MaxItems <= 1 {
+		return
+	}
+	if cfg.DefaultURL != "" {
+		p.defaultBulk = &bulkEndpoint{url: cfg.DefaultURL}
+	}
+	if cfg.FallbackURL != "" {
+		p.fallbackBulk = &bulkEndpoint{url: cfg.FallbackURL}
+	}
+	p.bulkSize = cfg.MaxItems
+}
+
+// BulkSize retorna quantos payments vão em cada chamada em lote; 0 quando
+// o envio em lote está desligado
+func (p *PaymentProcessor) BulkSize() int {
+	return p.bulkSize
+}
+
+// bulkTarget escolhe o processador do lote com a mesma prioridade do envio
+// individual: o default se saudável, senão o fallback, ou, com pesos, o
+// sorteado entre os saudáveis, com weighted. Retorna nil quando o
+// processador escolhido não tem endpoint de lote utilizável.
+func (p *PaymentProcessor) bulkTarget() (processorID string, endpoint *bulkEndpoint, status *ProcessorStatus, weighted bool) {
+	routes := p.routes.global
+	if i := p.routes.draw(); i >= 0 {
+		routes, weighted = p.routes.orders[i], true
+	}
+	for _, route := range routes {
+		if !route.status.Healthy() {
+			continue
+		}
+		endpoint = p.defaultBulk
+		if route.processorID == "fallback" {
+			endpoint = p.fallbackBulk
+		}
+		if endpoint == nil || endpoint.unsupported.Load() {
+			return "", nil, nil, false
+		}
+		return route.processorID, endpoint, route.status, weighted
+	}
+	return "", nil, nil, false
+}
+
+// ProcessBulk envia os payments em uma única chamada ao endpoint de lote do
+// processador retornado. handled[i] indica que o payment i foi aceito e já
+// contabilizado; os demais (falha no item, resposta sem o item ou falha da
+// chamada inteira) devem seguir pelo ProcessPayment, com as tentativas e o
+// fallback de sempre.
+func (p *PaymentProcessor) ProcessBulk(ctx context.Context, payments []*types.PaymentRequest) (processorID string, handled []bool) {
+	handled = make([]bool, len(payments))
+
+	processorID, endpoint, status, weighted := p.bulkTarget()
+	if endpoint == nil {
+		return "", handled
+	}
+	// Com ROUTING_RULES, os payments de um type que não iriam primeiro a
+	// esse processador ficam fora do lote e seguem pelo envio individual,
+	// na ordem da regra; com sticky, também os que o hash manda a outro
+	batch := payments
+	if len(p.routes.rules) > 0 || p.routes.sticky {
+		batch = make([]*types.PaymentRequest, 0, len(payments))
+		for _, payment := range payments {
+			routes, pinned := p.routes.lookup(payment.Type)
+			hashed := !pinned && p.routes.sticky
+			if hashed {
+				routes, pinned = p.routes.orders[p.routes.stick(payment.CorrelationID)], true
+			}
+			if pinned && preferred(routes) != processorID {
+				continue
+			}
+			batch = append(batch, payment)
+			if hashed {
+				metrics.Processor(routes[0].processorID).Sticky.Inc()
+			}
+		}
+		if len(batch) == 0 {
+			return "", handled
+		}
+	}
+	if weighted {
+		metrics.Processor(processorID).Weighted.Add(int64(len(batch)))
+	}
+
+	if tracing.Enabled() {
+		var span trace.Span
+		ctx, span = tracing.Tracer().Start(ctx, "POST "+processorID+" bulk",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("payment.processor", processorID),
+				attribute.Int("payment.bulk_size", len(batch)),
+			))
+		defer span.End()
+		defer func() {
+			accepted := countTrue(handled)
+			span.SetAttributes(attribute.Int("payment.bulk_accepted", accepted))
+			if accepted < len(batch) {
+				span.SetStatus(codes.Error, "bulk partially failed")
+			}
+		}()
+	}
+
+	results, ok := p.sendBulk(ctx, processorID, endpoint, batch)
+	if !ok {
+		return processorID, handled
+	}
+
+	// Os itens são casados pelo correlationId, não pela posição
+	statusByID := make(map[string]int, len(results))
+	for _, r := range results {
+		statusByID[r.CorrelationID] = r.Status
+	}
+
+	m := metrics.Processor(processorID)
+	for i, payment := range payments {
+		code := statusByID[payment.CorrelationID]
+		if code < 200 || code >= 300 {
+			continue
+		}
+		handled[i] = true
+
+		p.recordAttempt()
+		m.Success.Inc()
+		p.recordSuccess(processorID, payment)
+		p.savePayment(processorID, payment, nil)
+	}
+
+	if countTrue(handled) > 0 {
+		p.callSucceeded(status)
+	}
+	return processorID, handled
+}
+
+// sendBulk faz a chamada ao endpoint de lote e decodifica os resultados
+func (p *PaymentProcessor) sendBulk(ctx context.Context, processorID string, endpoint *bulkEndpoint, payments []*types.PaymentRequest) ([]types.BulkItemResult, bool) {
+	body, err := newBulkPayloadBody(payments)
+	if err != nil {
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 1000*time.Millisecond)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint.url, body)
+	if err != nil {
+		body.Close()
+		return nil, false
+	}
+	req.ContentLength = int64(body.Len())
+	req.Header.Set("Content-Type", "application/json")
+	p.setAuthHeaders(req, processorID)
+	if tracing.Enabled() {
+		tracing.Inject(ctx, req.Header)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		p.logBulkFailure(processorID, classifyTransportError(err), 0, len(payments))
+		return nil, false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed {
+		if endpoint.unsupported.CompareAndSwap(false, true) {
+			p.logger.Warn("processor has no bulk endpoint, sending payments individually",
+				logging.KeyProcessor, processorID,
+				logging.KeyStatus, resp.StatusCode,
+				"url", endpoint.url)
+		}
+		return nil, false
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		if reason := classifyStatus(resp.StatusCode); reason == metrics.ClassAuth {
+			p.logAuthFailure(processorID, "bulk", resp.StatusCode)
+		} else {
+			p.logBulkFailure(processorID, reason, resp.StatusCode, len(payments))
+		}
+		return nil, false
+	}
+
+	var results []types.BulkItemResult
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		p.logBulkFailure(processorID, metrics.ClassOther, resp.StatusCode, len(payments))
+		return nil, false
+	}
+	return results, true
+}
+
+// logBulkFailure loga (amostrado) a falha de uma chamada em lote; os
+// payments seguem pelo envio individual, que contabiliza as falhas
+func (p *PaymentProcessor) logBulkFailure(processorID, reason string, statusCode, size int) {
+	ok, n := p.sampler.Allow("bulk_" + reason + ":" + processorID)
+	if !ok {
+		return
+	}
+	attrs := []any{
+		logging.KeyProcessor, processorID,
+		logging.KeyReason, reason,
+		"bulk_size", size,
+		logging.KeyOccurrences, n,
+	}
+	if statusCode != 0 {
+		attrs = append(attrs, logging.KeyStatus, statusCode)
+	}
+	p.logger.Warn("processor bulk call failed, retrying individually", attrs...)
+}
+
+func countTrue(values []bool) int {
+	n := 0
+	for _, v := range values {
+		if v {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,291 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// Espera antes da segunda tentativa de um callback; dobra a cada falha
+const callbackBackoff = 200 * time.Millisecond
+
+// callbackDrainTimeout é quanto o Stop espera os callbacks pendentes antes
+// de cancelar os envios
+const callbackDrainTimeout = 2 * time.Second
+
+// errCallbackBlocked indica destino em rede privada com AllowPrivate desligado
+var errCallbackBlocked = errors.New("callback destination is a private address")
+
+// CallbackConfig configura os callbacks de fim de processamento
+type CallbackConfig struct {
+	Workers      int           // envios simultâneos
+	QueueSize    int           // callbacks aguardando envio; com a fila cheia o callback é descartado
+	Timeout      time.Duration // por tentativa
+	MaxAttempts  int
+	AllowPrivate bool // permite loopback, redes privadas e link-local como destino
+}
+
+// DefaultCallbackConfig retorna 4 envios simultâneos, fila de 1000, 2s por
+// tentativa e até 3 tentativas, bloqueando destinos privados
+func DefaultCallbackConfig() CallbackConfig {
+	return CallbackConfig{
+		Workers:     4,
+		QueueSize:   1000,
+		Timeout:     2 * time.Second,
+		MaxAttempts: 3,
+	}
+}
+
+// callbackJob é um callback aguardando envio; guarda só cópias, porque o
+// payment volta ao pool assim que o worker termina
+type callbackJob struct {
+	url       string
+	requestID string
+	body      types.PaymentCallback
+}
+
+// callbackSender envia os callbacks em um pool próprio e limitado, para um
+// destino lento não segurar os workers de payments
+type callbackSender struct {
+	cfg     CallbackConfig
+	jobs    chan callbackJob
+	client  *http.Client
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	logger  *slog.Logger
+	sampler *logging.Sampler
+}
+
+func newCallbackSender(cfg CallbackConfig) *callbackSender {
+	def := DefaultCallbackConfig()
+	if cfg.Workers <= 0 {
+		cfg.Workers = def.Workers
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = def.QueueSize
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = def.Timeout
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = def.MaxAttempts
+	}
+
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivate {
+		// Checado no IP já resolvido, então um DNS apontando para a rede
+		// interna também é barrado
+		dialer.Control = blockPrivate
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &callbackSender{
+		cfg:  cfg,
+		jobs: make(chan callbackJob, cfg.QueueSize),
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				MaxIdleConnsPerHost: 2,
+				IdleConnTimeout:     30 * time.Second,
+			},
+			// Redirects não são seguidos; um 3xx conta como falha
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		ctx:     ctx,
+		cancel:  cancel,
+		logger:  slog.Default(),
+		sampler: logging.DefaultSampler(),
+	}
+
+	for i := 0; i < cfg.Workers; i++ {
+		s.wg.Add(1)
+		go s.run()
+	}
+	return s
+}
+
+// blockPrivate recusa conexões a loopback, redes privadas e link-local
+func blockPrivate(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return errCallbackBlocked
+	}
+	return nil
+}
+
+// enqueue agenda o callback sem bloquear o worker
+func (s *callbackSender) enqueue(job callbackJob) {
+	select {
+	case s.jobs <- job:
+	default:
+		metrics.Callbacks.Inc(metrics.CallbackDropped)
+		if ok, n := s.sampler.Allow("callback_dropped"); ok {
+			s.logger.Warn("callback queue full, callback dropped",
+				logging.KeyCorrelationID, job.body.CorrelationID,
+				logging.KeyRequestID, job.requestID,
+				logging.KeyOccurrences, n)
+		}
+	}
+}
+
+func (s *callbackSender) run() {
+	defer s.wg.Done()
+
+	for job := range s.jobs {
+		if s.ctx.Err() != nil {
+			metrics.Callbacks.Inc(metrics.CallbackDropped)
+			continue
+		}
+		s.deliver(job)
+	}
+}
+
+// deliver envia o callback com até MaxAttempts tentativas e backoff
+// exponencial; destinos bloqueados não são retentados
+func (s *callbackSender) deliver(job callbackJob) {
+	body, err := json.Marshal(job.body)
+	if err != nil {
+		return
+	}
+
+	backoff := callbackBackoff
+	for attempt := 1; ; attempt++ {
+		err := s.post(job, body)
+		if err == nil {
+			metrics.Callbacks.Inc(metrics.CallbackDelivered)
+			return
+		}
+
+		if errors.Is(err, errCallbackBlocked) {
+			metrics.Callbacks.Inc(metrics.CallbackBlocked)
+			s.logFailure(job, metrics.CallbackBlocked, attempt, err)
+			return
+		}
+		if attempt >= s.cfg.MaxAttempts {
+			metrics.Callbacks.Inc(metrics.CallbackFailed)
+			s.logFailure(job, metrics.CallbackFailed, attempt, err)
+			return
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-s.ctx.Done():
+			metrics.Callbacks.Inc(metrics.CallbackFailed)
+			s.logFailure(job, metrics.CallbackFailed, attempt, err)
+			return
+		}
+	}
+}
+
+// post faz uma tentativa; respostas fora de 2xx são erro
+func (s *callbackSender) post(job callbackJob, body []byte) error {
+	ctx, cancel := context.WithTimeout(s.ctx, s.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if job.requestID != "" {
+		req.Header.Set(logging.RequestIDHeader, job.requestID)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("callback returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// logFailure loga (amostrado) um callback abandonado
+func (s *callbackSender) logFailure(job callbackJob, outcome string, attempts int, err error) {
+	ok, n := s.sampler.Allow("callback_" + outcome)
+	if !ok {
+		return
+	}
+	s.logger.Warn("payment callback not delivered",
+		logging.KeyCorrelationID, job.body.CorrelationID,
+		logging.KeyRequestID, job.requestID,
+		logging.KeyReason, outcome,
+		"attempts", attempts,
+		"error", err,
+		logging.KeyOccurrences, n)
+}
+
+// stop espera os callbacks pendentes por até callbackDrainTimeout e então
+// cancela os envios restantes
+func (s *callbackSender) stop() {
+	close(s.jobs)
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(callbackDrainTimeout):
+		s.cancel()
+		<-done
+	}
+	s.cancel()
+}
+
+// UseCallbacks liga os callbacks para payments com callbackUrl; deve ser
+// chamado antes de o servidor aceitar requisições
+func (wp *WorkerPool) UseCallbacks(cfg CallbackConfig) {
+	wp.callbacks = newCallbackSender(cfg)
+}
+
+// CallbacksEnabled indica se payments com callbackUrl são aceitos
+func (wp *WorkerPool) CallbacksEnabled() bool {
+	return wp.callbacks != nil
+}
+
+// notify agenda o callback do job, se houver; deve ser chamado antes do
+// finish, que devolve o payment ao pool
+func (wp *WorkerPool) notify(j Job, status, processorID string) {
+	if wp.callbacks == nil || j.Payment.CallbackURL == "" {
+		return
+	}
+	wp.callbacks.enqueue(callbackJob{
+		url:       j.Payment.CallbackURL,
+		requestID: j.requestID,
+		body: types.PaymentCallback{
+			CorrelationID: j.Payment.CorrelationID,
+			Status:        status,
+			Processor:     processorID,
+			ProcessedAt:   time.Now().UTC(),
+		},
+	})
+}
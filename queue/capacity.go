@@ -0,0 +1,39 @@
+package queue
+
+import (
+	"errors"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// Erros do SetQueueCapacity
+var (
+	ErrQueueNotResizable = errors.New("queue backend has a fixed capacity")
+	ErrInvalidCapacity   = errors.New("capacity must be a positive integer")
+)
+
+// SetQueueCapacity muda a capacidade da fila sem restart. Aumentada, vale
+// na hora; reduzida abaixo da profundidade atual, os payments novos são
+// recusados como com a fila cheia até ela drenar, sem descartar nenhum já
+// enfileirado. Os watermarks da admissão e da readiness são percentuais da
+// capacidade e acompanham a mudança.
+func (wp *WorkerPool) SetQueueCapacity(capacity int) (types.QueueCapacity, error) {
+	r, ok := wp.backend.(resizable)
+	if !ok {
+		return types.QueueCapacity{}, ErrQueueNotResizable
+	}
+	if capacity <= 0 {
+		return types.QueueCapacity{}, ErrInvalidCapacity
+	}
+
+	previous := wp.backend.Cap()
+	r.SetCap(capacity)
+	wp.room.notify()
+	depth := wp.backend.Len()
+	wp.logger.Info("queue capacity changed",
+		"capacity", capacity,
+		"previous", previous,
+		logging.KeyQueueDepth, depth)
+	return types.QueueCapacity{Capacity: capacity, PreviousCapacity: previous, QueueDepth: depth}, nil
+}
@@ -0,0 +1,16 @@
+package queue
+
+import "errors"
+
+// A injeção de falhas nas chamadas aos processadores (CHAOS) fica em
+// chaos_on.go, compilado só com -tags chaos; sem a tag, chaos_off.go deixa
+// o client exatamente como sem ela. As falhas injetadas voltam ao código
+// como as reais, um erro do Transport ou uma resposta HTTP, e passam pela
+// mesma classificação, pelo mesmo circuit breaker e pelas mesmas novas
+// tentativas.
+
+// Erros do SetChaos
+var (
+	ErrChaosDisabled    = errors.New("chaos injection is disabled; build with -tags chaos and set CHAOS=true")
+	ErrInvalidChaosRule = errors.New("invalid chaos rule")
+)
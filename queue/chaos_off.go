@@ -0,0 +1,36 @@
+//go:build !chaos
+
+package queue
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// chaosLayer não existe sem a tag chaos
+type chaosLayer struct{}
+
+// newChaosLayer retorna nil: sem a tag chaos, CHAOS=true só gera um aviso
+func newChaosLayer(enabled bool, urls, processors []string) *chaosLayer {
+	if enabled {
+		slog.Warn("CHAOS=true requires a build with -tags chaos, chaos injection disabled")
+	}
+	return nil
+}
+
+// wrap retorna o próprio RoundTripper, sem camada nenhuma
+func (c *chaosLayer) wrap(next http.RoundTripper) http.RoundTripper {
+	return next
+}
+
+// SetChaos não está disponível sem a tag chaos
+func (p *PaymentProcessor) SetChaos(map[string]types.ChaosRule) (types.ChaosStats, error) {
+	return types.ChaosStats{}, ErrChaosDisabled
+}
+
+// ChaosStats retorna a injeção desligada
+func (p *PaymentProcessor) ChaosStats() types.ChaosStats {
+	return types.ChaosStats{}
+}
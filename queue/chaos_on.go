@@ -0,0 +1,296 @@
+//go:build chaos
+
+package queue
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// Distribuições da latência injetada
+const (
+	chaosFixed       = "fixed"
+	chaosUniform     = "uniform"
+	chaosExponential = "exponential"
+)
+
+// chaosLayer é o RoundTripper mais externo do client dos processadores com
+// CHAOS=true. Cada chamada sorteia, pela regra do processador do endereço,
+// uma latência antes de seguir e, no máximo, uma falha no lugar da
+// chamada: blackhole (sem resposta até o prazo da chamada, que termina em
+// timeout), reset (o erro de conexão resetada, antes de o corpo ser
+// enviado) ou uma resposta 429/5xx sem corpo. Nenhuma falha chega ao
+// processador. Sem regra, a chamada segue direto.
+type chaosLayer struct {
+	next    http.RoundTripper
+	targets map[string]*chaosTarget // "host:porta" das URLs de cada processador
+	byName  map[string]*chaosTarget
+	logger  *slog.Logger
+}
+
+// chaosTarget é a regra atual de um processador
+type chaosTarget struct {
+	processorID string
+	rule        atomic.Pointer[chaosRule] // nil sem falhas
+	metrics     *metrics.ProcessorMetrics
+}
+
+// chaosRule é a types.ChaosRule com as probabilidades em fração; as das
+// falhas são acumuladas, para um sorteio só escolher entre elas
+type chaosRule struct {
+	types.ChaosRule
+	latency   float64
+	blackhole float64
+	reset     float64
+	fail      float64
+	status    int
+}
+
+// chaosResetError é a conexão resetada injetada; o errors.Is a reconhece
+// como ECONNRESET, igual à de verdade
+type chaosResetError struct{}
+
+func (chaosResetError) Error() string { return "connection reset by peer (injected by chaos)" }
+
+func (chaosResetError) Unwrap() error { return syscall.ECONNRESET }
+
+// newChaosLayer cria a camada com as URLs de cada processador, sem nenhuma
+// regra; nil sem CHAOS. Com os dois processadores no mesmo endereço, vale
+// o primeiro.
+func newChaosLayer(enabled bool, urls, processors []string) *chaosLayer {
+	if !enabled {
+		return nil
+	}
+	c := &chaosLayer{
+		targets: make(map[string]*chaosTarget, len(urls)),
+		byName:  make(map[string]*chaosTarget, 2),
+		logger:  slog.Default(),
+	}
+	for i, rawURL := range urls {
+		target := c.byName[processors[i]]
+		if target == nil {
+			target = &chaosTarget{processorID: processors[i], metrics: metrics.Processor(processors[i])}
+			c.byName[processors[i]] = target
+		}
+		if addr, ok := dialAddr(rawURL); ok && c.targets[addr] == nil {
+			c.targets[addr] = target
+		}
+	}
+	c.logger.Warn("chaos injection enabled, set rules with POST /admin/chaos")
+	return c
+}
+
+// wrap põe a camada por fora de next; sem CHAOS retorna next
+func (c *chaosLayer) wrap(next http.RoundTripper) http.RoundTripper {
+	if c == nil {
+		return next
+	}
+	c.next = next
+	return c
+}
+
+// RoundTrip aplica a regra do processador do endereço. Como todo
+// RoundTripper, fecha o corpo da chamada também nas falhas.
+func (c *chaosLayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	target := c.targets[requestAddr(req)]
+	if target == nil {
+		return c.next.RoundTrip(req)
+	}
+	rule := target.rule.Load()
+	if rule == nil {
+		return c.next.RoundTrip(req)
+	}
+
+	ctx := req.Context()
+	if rule.latency > 0 && rand.Float64() < rule.latency {
+		target.metrics.Chaos.Inc(metrics.ChaosLatency)
+		if !sleepContext(ctx, rule.delay()) {
+			closeRequestBody(req)
+			return nil, ctx.Err()
+		}
+	}
+
+	switch draw := rand.Float64(); {
+	case draw < rule.blackhole:
+		target.metrics.Chaos.Inc(metrics.ChaosBlackhole)
+		closeRequestBody(req)
+		<-ctx.Done()
+		return nil, ctx.Err()
+
+	case draw < rule.reset:
+		target.metrics.Chaos.Inc(metrics.ChaosReset)
+		closeRequestBody(req)
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: chaosResetError{}}
+
+	case draw < rule.fail:
+		fault := metrics.ChaosHTTP5xx
+		if rule.status == http.StatusTooManyRequests {
+			fault = metrics.ChaosHTTP429
+		}
+		target.metrics.Chaos.Inc(fault)
+		closeRequestBody(req)
+		return &http.Response{
+			Status:     fmt.Sprintf("%d %s", rule.status, http.StatusText(rule.status)),
+			StatusCode: rule.status,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     http.Header{"X-Chaos-Fault": {fault}},
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	}
+	return c.next.RoundTrip(req)
+}
+
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+// delay sorteia a latência pela distribuição da regra
+func (r *chaosRule) delay() time.Duration {
+	base := time.Duration(r.LatencyMs) * time.Millisecond
+	ceiling := time.Duration(r.LatencyMaxMs) * time.Millisecond
+	switch r.LatencyDistribution {
+	case chaosUniform:
+		if ceiling > base {
+			return base + rand.N(ceiling-base)
+		}
+		return base
+	case chaosExponential:
+		d := time.Duration(rand.ExpFloat64() * float64(base))
+		if ceiling > 0 {
+			d = min(d, ceiling)
+		}
+		return d
+	}
+	return base
+}
+
+// newChaosRule valida a regra e a converte; nil para uma regra sem falhas
+func newChaosRule(rule types.ChaosRule) (*chaosRule, error) {
+	percents := []struct {
+		name  string
+		value float64
+	}{
+		{"latency_percent", rule.LatencyPercent},
+		{"error_percent", rule.ErrorPercent},
+		{"reset_percent", rule.ResetPercent},
+		{"blackhole_percent", rule.BlackholePercent},
+	}
+	for _, percent := range percents {
+		if percent.value < 0 || percent.value > 100 {
+			return nil, fmt.Errorf("%w: %s must be between 0 and 100, got %g", ErrInvalidChaosRule, percent.name, percent.value)
+		}
+	}
+	if sum := rule.ErrorPercent + rule.ResetPercent + rule.BlackholePercent; sum > 100 {
+		return nil, fmt.Errorf("%w: error_percent, reset_percent and blackhole_percent add up to %g, over 100", ErrInvalidChaosRule, sum)
+	}
+	if rule.LatencyMs < 0 || rule.LatencyMaxMs < 0 {
+		return nil, fmt.Errorf("%w: latency_ms and latency_max_ms must not be negative", ErrInvalidChaosRule)
+	}
+	if rule.LatencyPercent > 0 && rule.LatencyMs == 0 && rule.LatencyMaxMs == 0 {
+		return nil, fmt.Errorf("%w: latency_percent needs latency_ms", ErrInvalidChaosRule)
+	}
+	switch rule.LatencyDistribution {
+	case "", chaosFixed, chaosExponential:
+	case chaosUniform:
+		if rule.LatencyMaxMs < rule.LatencyMs {
+			return nil, fmt.Errorf("%w: uniform latency needs latency_max_ms >= latency_ms", ErrInvalidChaosRule)
+		}
+	default:
+		return nil, fmt.Errorf("%w: latency_distribution must be %q, %q or %q, got %q",
+			ErrInvalidChaosRule, chaosFixed, chaosUniform, chaosExponential, rule.LatencyDistribution)
+	}
+	status := rule.ErrorStatus
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	if status != http.StatusTooManyRequests && (status < 500 || status > 599) {
+		return nil, fmt.Errorf("%w: error_status must be 429 or 5xx, got %d", ErrInvalidChaosRule, rule.ErrorStatus)
+	}
+
+	if rule.LatencyPercent == 0 && rule.ErrorPercent == 0 && rule.ResetPercent == 0 && rule.BlackholePercent == 0 {
+		return nil, nil
+	}
+	r := &chaosRule{
+		ChaosRule: rule,
+		latency:   rule.LatencyPercent / 100,
+		blackhole: rule.BlackholePercent / 100,
+		status:    status,
+	}
+	r.reset = r.blackhole + rule.ResetPercent/100
+	r.fail = r.reset + rule.ErrorPercent/100
+	return r, nil
+}
+
+// SetChaos troca as regras dos processadores em rules, sem restart; os
+// demais mantêm as suas e uma regra vazia para a injeção no processador.
+// Nada muda se alguma regra for inválida.
+func (p *PaymentProcessor) SetChaos(rules map[string]types.ChaosRule) (types.ChaosStats, error) {
+	c := p.chaos
+	if c == nil {
+		return types.ChaosStats{}, ErrChaosDisabled
+	}
+
+	parsed := make(map[*chaosTarget]*chaosRule, len(rules))
+	for name, rule := range rules {
+		target := c.byName[name]
+		if target == nil {
+			return types.ChaosStats{}, fmt.Errorf("%w: %s", ErrUnknownProcessor, name)
+		}
+		r, err := newChaosRule(rule)
+		if err != nil {
+			return types.ChaosStats{}, err
+		}
+		parsed[target] = r
+	}
+
+	for target, r := range parsed {
+		target.rule.Store(r)
+		if r == nil {
+			c.logger.Warn("chaos rule cleared", logging.KeyProcessor, target.processorID)
+			continue
+		}
+		c.logger.Warn("chaos rule set",
+			logging.KeyProcessor, target.processorID,
+			"latency_percent", r.LatencyPercent,
+			"latency_ms", r.LatencyMs,
+			"latency_max_ms", r.LatencyMaxMs,
+			"latency_distribution", r.LatencyDistribution,
+			"error_percent", r.ErrorPercent,
+			"error_status", r.status,
+			"reset_percent", r.ResetPercent,
+			"blackhole_percent", r.BlackholePercent)
+	}
+	return p.ChaosStats(), nil
+}
+
+// ChaosStats retorna a regra de cada processador e as falhas já injetadas
+func (p *PaymentProcessor) ChaosStats() types.ChaosStats {
+	c := p.chaos
+	if c == nil {
+		return types.ChaosStats{}
+	}
+	stats := types.ChaosStats{Enabled: true, Processors: make(map[string]types.ChaosProcessor, len(c.byName))}
+	for name, target := range c.byName {
+		var rule types.ChaosRule
+		if r := target.rule.Load(); r != nil {
+			rule = r.ChaosRule
+		}
+		stats.Processors[name] = types.ChaosProcessor{Rule: rule, Injected: target.metrics.Chaos.Values()}
+	}
+	return stats
+}
@@ -0,0 +1,53 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+)
+
+// classifyTransportError classifica falhas antes de obter resposta HTTP
+func classifyTransportError(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return metrics.ClassTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return metrics.ClassTimeout
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return metrics.ClassConnection
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return metrics.ClassConnection
+	}
+	// O Transport não exporta o erro da conexão ociosa fechada pelo
+	// processador quando ia reaproveitá-la
+	if strings.Contains(err.Error(), "server closed idle connection") {
+		return metrics.ClassConnection
+	}
+	return metrics.ClassOther
+}
+
+// classifyStatus classifica respostas HTTP de erro
+func classifyStatus(code int) string {
+	switch {
+	case code == 429:
+		return metrics.ClassHTTP429
+	case code == 401 || code == 403:
+		return metrics.ClassAuth
+	case code >= 500:
+		return metrics.ClassHTTP5xx
+	case code >= 400:
+		return metrics.ClassHTTP4xx
+	default:
+		return metrics.ClassOther
+	}
+}
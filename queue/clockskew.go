@@ -0,0 +1,176 @@
+package queue
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// Estimativa do desvio de relógio pelo header Date. O Date tem resolução
+// de segundo, então cada amostra erra até ±500ms: a média móvel dá peso
+// clockSkewWeight a cada uma e só vale para o aviso e a correção depois de
+// clockSkewMinSamples. Um Date a mais de clockSkewMax do relógio local não
+// é desvio, é header quebrado (ano zero, fuso errado), e fica de fora.
+const (
+	clockSkewWeight     = 0.05
+	clockSkewMinSamples = 20
+	clockSkewMax        = time.Hour
+)
+
+// clockSkew é o desvio estimado do relógio de um processador em relação
+// ao local
+type clockSkew struct {
+	warnAt time.Duration // 0 desliga o aviso
+
+	mu      sync.Mutex
+	skew    float64 // ns, média móvel das amostras
+	samples int64
+	warning bool // o último aviso ainda vale
+
+	estimate atomic.Int64 // skew publicado, lido sem lock ao carimbar o requestedAt
+	ready    atomic.Bool
+	missing  atomic.Int64
+	ignored  atomic.Int64
+}
+
+func newClockSkew(cfg ProcessorConfig) *clockSkew {
+	return &clockSkew{warnAt: cfg.ClockSkewWarn}
+}
+
+// skewChange é a mudança do aviso causada por uma amostra
+type skewChange int
+
+const (
+	skewUnchanged skewChange = iota
+	skewAboveWarn
+	skewBackInRange
+)
+
+// observe registra o Date de uma resposta recebida entre start e end. O
+// Date é truncado no segundo, então o relógio do processador estava, em
+// média, meio segundo adiante dele no meio da chamada.
+func (c *clockSkew) observe(date string, start, end time.Time) skewChange {
+	if date == "" {
+		c.missing.Add(1)
+		return skewUnchanged
+	}
+	at, err := http.ParseTime(date)
+	if err != nil {
+		c.ignored.Add(1)
+		return skewUnchanged
+	}
+	mid := start.Add(end.Sub(start) / 2)
+	sample := at.Add(500 * time.Millisecond).Sub(mid)
+	if sample > clockSkewMax || sample < -clockSkewMax {
+		c.ignored.Add(1)
+		return skewUnchanged
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.samples == 0 {
+		c.skew = float64(sample)
+	} else {
+		c.skew += clockSkewWeight * (float64(sample) - c.skew)
+	}
+	c.samples++
+	c.estimate.Store(int64(c.skew))
+	if c.samples < clockSkewMinSamples {
+		return skewUnchanged
+	}
+	c.ready.Store(true)
+	return c.checkWarn(time.Duration(c.skew))
+}
+
+// checkWarn liga o aviso acima de warnAt e só o desliga abaixo da metade,
+// para a estimativa perto do limite não alternar a cada amostra; chamado
+// com o lock
+func (c *clockSkew) checkWarn(skew time.Duration) skewChange {
+	if c.warnAt <= 0 {
+		return skewUnchanged
+	}
+	skew = max(skew, -skew)
+	switch {
+	case !c.warning && skew >= c.warnAt:
+		c.warning = true
+		return skewAboveWarn
+	case c.warning && skew < c.warnAt/2:
+		c.warning = false
+		return skewBackInRange
+	}
+	return skewUnchanged
+}
+
+// get retorna o desvio estimado e se já há amostras suficientes
+func (c *clockSkew) get() (time.Duration, bool) {
+	return time.Duration(c.estimate.Load()), c.ready.Load()
+}
+
+func (c *clockSkew) stats(applied bool) types.ProcessorClockSkew {
+	c.mu.Lock()
+	samples, warning := c.samples, c.warning
+	c.mu.Unlock()
+
+	skew, ready := c.get()
+	return types.ProcessorClockSkew{
+		SkewMs:  skew.Milliseconds(),
+		Ready:   ready,
+		Samples: samples,
+		Missing: c.missing.Load(),
+		Ignored: c.ignored.Load(),
+		Warning: warning,
+		Applied: applied,
+	}
+}
+
+// observeClockSkew estima o desvio de relógio pela resposta de payment e
+// loga quando ele passa do limite ou volta
+func (p *PaymentProcessor) observeClockSkew(processorID string, status *ProcessorStatus, resp *http.Response, start, end time.Time) {
+	skew := status.skew
+	switch skew.observe(resp.Header.Get("Date"), start, end) {
+	case skewAboveWarn:
+		estimate, _ := skew.get()
+		p.logger.Warn("processor clock skew above threshold",
+			logging.KeyProcessor, processorID,
+			"skew_ms", estimate.Milliseconds(),
+			"threshold_ms", skew.warnAt.Milliseconds(),
+			"correction", p.skewCorrection)
+	case skewBackInRange:
+		estimate, _ := skew.get()
+		p.logger.Info("processor clock skew back within threshold",
+			logging.KeyProcessor, processorID,
+			"skew_ms", estimate.Milliseconds())
+	}
+}
+
+// skewSource é o processador cujo desvio corrige o requestedAt: o default,
+// que recebe a maior parte dos payments, ou o fallback enquanto o default
+// não tem amostras suficientes; nil sem a correção ou sem estimativa
+func (p *PaymentProcessor) skewSource() *ProcessorStatus {
+	if !p.skewCorrection {
+		return nil
+	}
+	for _, status := range []*ProcessorStatus{p.defaultStatus, p.fallbackStatus} {
+		if _, ready := status.skew.get(); ready {
+			return status
+		}
+	}
+	return nil
+}
+
+// RequestedAt é o instante para carimbar o requestedAt de um payment: o
+// relógio local, somado ao desvio estimado do processador com
+// CLOCK_SKEW_CORRECTION, para o requestedAt ficar no relógio de quem
+// audita os payments
+func (p *PaymentProcessor) RequestedAt() time.Time {
+	now := time.Now().UTC()
+	if status := p.skewSource(); status != nil {
+		skew, _ := status.skew.get()
+		return now.Add(skew)
+	}
+	return now
+}
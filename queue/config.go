@@ -0,0 +1,368 @@
+package queue
+
+import (
+	"log/slog"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+// ProcessorConfig define os processadores de pagamento e como chamá-los
+type ProcessorConfig struct {
+	DefaultURL          string
+	FallbackURL         string
+	Timeout             time.Duration // prazo de cada chamada ao processador
+	HealthCheckInterval time.Duration // intervalo do ping aos processadores marcados como indisponíveis
+
+	// URLs de outras réplicas de cada processador, além de DefaultURL e
+	// FallbackURL: as chamadas de payment vão à réplica com menos chamadas
+	// em andamento, e uma réplica que falha seguidamente sai do rodízio sem
+	// tirar o processador do roteamento
+	DefaultReplicaURLs  []string
+	FallbackReplicaURLs []string
+
+	// Com AdaptiveTimeout o prazo de cada processador é recalculado a partir
+	// do p99 das respostas recentes (TimeoutP99Percent% dele), entre
+	// TimeoutMin e TimeoutMax; Timeout é o prazo até o primeiro ajuste
+	AdaptiveTimeout   bool
+	TimeoutMin        time.Duration
+	TimeoutMax        time.Duration
+	TimeoutP99Percent int
+
+	// Token bucket de chamadas de payment a cada processador, um por
+	// processador: RateLimit chamadas por segundo (0 desliga) com rajadas de
+	// RateBurst. Com RateAuto a taxa cai pela metade a cada 429 e volta aos
+	// poucos com sucessos seguidos.
+	RateLimit int
+	RateBurst int
+	RateAuto  bool
+
+	// Circuit breaker: abre quando, com pelo menos BreakerMinRequests
+	// chamadas nos últimos BreakerWindow (em segundos inteiros), as falhas
+	// chegam a BreakerFailurePercent% delas
+	BreakerWindow         time.Duration
+	BreakerFailurePercent int
+	BreakerMinRequests    int
+
+	// Tempo aberto do circuit breaker antes de o processador poder voltar:
+	// BreakerOpenBase na primeira abertura, multiplicado por
+	// BreakerOpenMultiplier a cada nova abertura até BreakerOpenMax. Depois
+	// de BreakerOpenReset fechado, a próxima abertura volta à base.
+	BreakerOpenBase       time.Duration
+	BreakerOpenMultiplier int
+	BreakerOpenMax        time.Duration
+	BreakerOpenReset      time.Duration
+
+	// Em falhas de conexão (reset, EOF, recusa) a chamada é repetida no
+	// mesmo processador até Retries vezes, depois de RetryDelay com jitter,
+	// dentro do prazo da chamada. Sem RetryAfterSend a nova tentativa só
+	// acontece se o corpo não chegou a ser enviado, já que o processador pode
+	// ter recebido e processado o payment.
+	Retries        int
+	RetryDelay     time.Duration
+	RetryAfterSend bool
+
+	// Com ConnMetrics as chamadas de payment registram, por httptrace e no
+	// dialer, conexões novas e reaproveitadas, duração do connect, tempo até
+	// o primeiro byte e conexões abertas/em uso; desligado, o client fica
+	// sem instrumentação nenhuma
+	ConnMetrics bool
+
+	// Com DefaultH2C/FallbackH2C as chamadas ao processador (payments,
+	// lote no mesmo endereço, health) vão em HTTP/2 sem TLS, multiplexadas
+	// em poucas conexões. Um processador que não fala h2c cai sozinho para
+	// HTTP/1.1, e o h2c é tentado de novo a cada minuto.
+	DefaultH2C  bool
+	FallbackH2C bool
+
+	// Com DNSCacheTTL (0 desliga) os hosts dos processadores são resolvidos
+	// no boot e de novo a cada DNSCacheTTL, e as conexões discam os IPs
+	// guardados; uma resolução que falha mantém os anteriores
+	DNSCacheTTL time.Duration
+
+	// Com Chaos, num build com -tags chaos, as chamadas aos processadores
+	// passam pela camada de injeção de falhas, com as regras do
+	// POST /admin/chaos; sem a tag a camada nem é compilada
+	Chaos bool
+
+	// As chamadas aos processadores são logadas inteiras (URL, headers sem
+	// credenciais, corpos até ExchangeLogMaxBytes e status), uma a cada
+	// ExchangeLogEvery (0 nenhuma) e as que falham até
+	// ExchangeLogErrorsPerSec por segundo (0 nenhuma); a amostragem sobe
+	// temporariamente pelo POST /admin/exchange-log
+	ExchangeLogEvery        int
+	ExchangeLogErrorsPerSec int
+	ExchangeLogMaxBytes     int
+
+	// No boot, antes de o servidor aceitar tráfego, WarmupConnections
+	// conexões são abertas com cada processador (0 desliga), esperando no
+	// máximo WarmupTimeout
+	WarmupConnections int
+	WarmupTimeout     time.Duration
+
+	// O header Date das respostas de payment estima o desvio do relógio de
+	// cada processador em relação ao local; acima de ClockSkewWarn (0
+	// desliga) sai um aviso no log. Com ClockSkewCorrection o requestedAt
+	// dos payments é carimbado já somando o desvio estimado.
+	ClockSkewWarn       time.Duration
+	ClockSkewCorrection bool
+
+	// Com Snapshot os contadores do summary são gravados em SnapshotPath a
+	// cada SnapshotInterval e no desligamento, e restaurados no boot, para
+	// um restart do container não zerar o summary
+	Snapshot         bool
+	SnapshotPath     string
+	SnapshotInterval time.Duration
+
+	// Das respostas 2xx de payment são lidos até ReceiptMaxBytes (0 não lê)
+	// para extrair o comprovante do processador, guardado no store. Sem
+	// comprovante legível o payment segue aceito, a não ser com
+	// ReceiptStrict, que o trata como falha.
+	ReceiptMaxBytes int
+	ReceiptStrict   bool
+
+	// O correlationId vai nos headers de idempotência de cada processador,
+	// para ele reconhecer as novas tentativas do mesmo payment. As respostas
+	// com DuplicateStatuses ("já processado") contam como sucesso. O 422 fica
+	// de fora por padrão: é a recusa de validação dos processadores.
+	DefaultIdempotencyHeaders  []string
+	FallbackIdempotencyHeaders []string
+	DuplicateStatuses          []int64
+
+	// Os payments de um type com regra em RoutingRules só vão aos
+	// processadores dela, na ordem da regra; sem nenhum deles saudável o
+	// payment é reagendado em vez de ir a outro. Os demais types vão ao
+	// default e depois ao fallback.
+	RoutingRules []RoutingRule
+
+	// Com algum peso acima de zero, o primeiro processador dos types sem
+	// regra é sorteado entre os saudáveis na proporção dos pesos, em vez de
+	// ser sempre o default; o outro segue como fallback após uma falha. Os
+	// pesos mudam em execução pelo POST /admin/weights.
+	DefaultWeight  int
+	FallbackWeight int
+
+	// RoutingStrategy escolhe o primeiro processador dos types sem regra:
+	// RoutingPriority (o default, ou o sorteado pelos pesos) ou
+	// RoutingSticky, o do hash do correlationId, para as novas tentativas
+	// de um payment caírem no mesmo processador e na idempotência dele
+	RoutingStrategy string
+
+	// Com ShadowPercent acima de zero, essa % dos payments aceitos pelo
+	// default é copiada ao fallback em segundo plano, com ShadowHeader, até
+	// ShadowMaxInFlight cópias em andamento; o desfecho das cópias não conta
+	// no summary nem na saúde do fallback. Muda em execução pelo POST
+	// /admin/shadow.
+	ShadowPercent     int
+	ShadowMaxInFlight int
+	ShadowHeader      string
+
+	// Limites superiores, em centavos e em ordem crescente, dos buckets do
+	// histograma de valores processados no summary detalhado; acima do
+	// último fica o +Inf
+	AmountBuckets []int64
+
+	// Credenciais enviadas em toda chamada ao processador, inclusive health
+	// e service-health. Os valores são segredos e nunca vão para o log.
+	DefaultToken    string
+	FallbackToken   string
+	TokenHeader     string      // header do token; em Authorization vai como "Bearer <token>"
+	DefaultHeaders  http.Header // headers extras de cada processador
+	FallbackHeaders http.Header
+}
+
+// DefaultProcessorConfig retorna os processadores do docker-compose da
+// Rinha, timeout agressivo de 300ms (o adaptativo, desligado, fica entre
+// 100ms e 1s com 150% do p99), sem rate limit (rajadas de 10 quando ligado),
+// circuit breaker com 50% de falhas em pelo menos 20 chamadas nos últimos
+// 10s e aberto por 1s, 2s, 4s... até 30s, uma nova tentativa em falhas de
+// conexão antes do envio do corpo (~5ms depois), HTTP/1.1 com os dois
+// processadores (h2c desligado), hosts resolvidos de novo a cada 30s,
+// métricas do pool de conexões, ping a cada 10s, 10 conexões aquecidas por
+// processador no boot (até 500ms), aviso com o relógio de um processador
+// 1s fora do local (sem corrigir o requestedAt), token (se houver) no X-Rinha-Token, snapshot
+// do summary desligado (summary-snapshot.json a cada 5s quando ligado),
+// comprovantes lidos até 4KiB sem o modo estrito, correlationId no
+// X-Idempotency-Key dos dois processadores com 409 e 422 como "já
+// processado" e buckets de valores de 1,00 a 10.000,00 na moeda padrão
+func DefaultProcessorConfig() ProcessorConfig {
+	return ProcessorConfig{
+		DefaultURL:          "http://processor-default:8080/process",
+		FallbackURL:         "http://processor-fallback:8080/process",
+		Timeout:             300 * time.Millisecond,
+		HealthCheckInterval: 10 * time.Second,
+		TokenHeader:         "X-Rinha-Token",
+
+		TimeoutMin:        100 * time.Millisecond,
+		TimeoutMax:        time.Second,
+		TimeoutP99Percent: 150,
+
+		RateBurst: 10,
+
+		BreakerWindow:         10 * time.Second,
+		BreakerFailurePercent: 50,
+		BreakerMinRequests:    20,
+		BreakerOpenBase:       time.Second,
+		BreakerOpenMultiplier: 2,
+		BreakerOpenMax:        30 * time.Second,
+		BreakerOpenReset:      time.Minute,
+
+		ConnMetrics: true,
+		DNSCacheTTL: 30 * time.Second,
+
+		WarmupConnections: maxIdleConnsPerHost,
+		WarmupTimeout:     500 * time.Millisecond,
+
+		ClockSkewWarn: time.Second,
+
+		SnapshotPath:     "summary-snapshot.json",
+		SnapshotInterval: 5 * time.Second,
+
+		ReceiptMaxBytes: 4 << 10,
+
+		ExchangeLogMaxBytes: 1 << 10,
+
+		DefaultIdempotencyHeaders:  []string{"X-Idempotency-Key"},
+		FallbackIdempotencyHeaders: []string{"X-Idempotency-Key"},
+		DuplicateStatuses:          []int64{http.StatusConflict},
+
+		RoutingStrategy: RoutingPriority,
+
+		ShadowMaxInFlight: 4,
+		ShadowHeader:      "X-Shadow-Request",
+
+		AmountBuckets: []int64{100, 1000, 5000, 10000, 50000, 100000, 500000, 1000000},
+
+		Retries:    1,
+		RetryDelay: 5 * time.Millisecond,
+	}
+}
+
+// processorHeaders junta os headers extras e o token de um processador;
+// nil quando não há nenhum
+func processorHeaders(extra http.Header, tokenHeader, token string) http.Header {
+	if len(extra) == 0 && token == "" {
+		return nil
+	}
+	headers := extra.Clone()
+	if headers == nil {
+		headers = make(http.Header)
+	}
+	if token != "" {
+		if http.CanonicalHeaderKey(tokenHeader) == "Authorization" {
+			token = "Bearer " + token
+		}
+		headers.Set(tokenHeader, token)
+	}
+	return headers
+}
+
+// PoolConfig dimensiona a fila e o pool de workers
+type PoolConfig struct {
+	Workers    int           // goroutines consumindo a fila
+	QueueSize  int           // capacidade da fila
+	BatchSize  int           // máximo de payments drenados por lote
+	BatchFlush time.Duration // espera máxima para completar um lote; 0 processa na hora
+	QueueTTL   time.Duration // idade máxima de um payment na fila; 0 desliga
+
+	// Orçamento de novas tentativas de cada payment: RetryMaxAttempts
+	// passagens pelo processamento ou RetryMaxElapsed desde a primeira, o
+	// que vier antes (0 desliga cada limite). Esgotado, o payment falha e
+	// vai para o journal com o histórico, em vez de ser reagendado.
+	RetryMaxAttempts int
+	RetryMaxElapsed  time.Duration
+
+	BatchParallelism int // payments de um lote enviados ao mesmo tempo, até BatchSize
+
+	// Arquivo onde a fila em memória é gravada no desligamento e de onde é
+	// recarregada no boot; vazio desliga
+	SpillPath string
+
+	QueueWaitWarn time.Duration // p95 do tempo na fila que gera aviso no log; 0 desliga
+
+	// Prioridade (fila em memória): amount a partir de PriorityThreshold
+	// centavos sai primeiro; PriorityMaxWait limita a espera da baixa
+	PriorityThreshold int // 0 desliga
+	PriorityMaxWait   time.Duration
+
+	ResumeRamp time.Duration // tempo para todos os workers voltarem após uma pausa; 0 volta de uma vez
+
+	// Autoscaling: Workers passa a ser apenas o tamanho inicial do pool
+	Autoscale          bool
+	MinWorkers         int
+	MaxWorkers         int
+	ScaleHighWatermark int           // profundidade da fila que conta como backlog
+	ScaleLowWatermark  int           // profundidade que conta como fila ociosa
+	ScaleInterval      time.Duration // intervalo entre amostras da fila
+	ScaleUpAfter       int           // amostras seguidas acima do high watermark para crescer
+	ScaleDownAfter     int           // amostras seguidas abaixo do low watermark para encolher
+}
+
+// Limites acima dos quais a configuração é aceita, mas provavelmente é engano
+const (
+	maxSaneWorkers    = 1000
+	maxSaneQueueSize  = 1_000_000
+	maxSaneBatchSize  = 1000
+	maxSaneBatchFlush = time.Second
+)
+
+// DefaultPoolConfig retorna a configuração padrão: 4 workers por CPU (I/O
+// intensivo) limitados a 100, fila de 20k e lotes de até 10 sem espera,
+// enviados 5 por vez, com até 100 tentativas ou 10s por payment. O
+// autoscaling vem desligado.
+func DefaultPoolConfig() PoolConfig {
+	workers := runtime.NumCPU() * 4
+	if workers > 100 {
+		workers = 100 // limite máximo
+	}
+
+	return PoolConfig{
+		Workers:    workers,
+		QueueSize:  20000, // fila de 20k para alta carga
+		BatchSize:  10,
+		BatchFlush: 0,
+
+		BatchParallelism: 5,
+
+		RetryMaxAttempts: 100,
+		RetryMaxElapsed:  10 * time.Second,
+
+		PriorityMaxWait: time.Second,
+		ResumeRamp:      2 * time.Second,
+
+		MinWorkers:         runtime.NumCPU(),
+		MaxWorkers:         200,
+		ScaleHighWatermark: 1000,
+		ScaleLowWatermark:  10,
+		ScaleInterval:      250 * time.Millisecond,
+		ScaleUpAfter:       2,
+		ScaleDownAfter:     20,
+	}
+}
+
+// Normalize avisa sobre valores válidos, mas absurdos, que ainda assim são
+// mantidos, e com o autoscaling traz o tamanho inicial do pool para dentro
+// de [MinWorkers, MaxWorkers]. A validação em si é do config.Validate, que
+// recusa o boot antes deste ponto; aqui nenhum valor é trocado pelo padrão.
+func (c PoolConfig) Normalize() PoolConfig {
+	if c.Workers > maxSaneWorkers {
+		slog.Warn("unusually high worker count", "value", c.Workers)
+	}
+	if c.QueueSize > maxSaneQueueSize {
+		slog.Warn("unusually large queue size", "value", c.QueueSize)
+	}
+	if c.BatchSize > maxSaneBatchSize {
+		slog.Warn("unusually large batch size", "value", c.BatchSize)
+	}
+	if c.BatchFlush > maxSaneBatchFlush {
+		slog.Warn("unusually long batch flush interval", "value", c.BatchFlush)
+	}
+
+	if c.Autoscale {
+		if c.MaxWorkers > maxSaneWorkers {
+			slog.Warn("unusually high max workers", "value", c.MaxWorkers)
+		}
+		c.Workers = min(max(c.Workers, c.MinWorkers), c.MaxWorkers)
+	}
+	return c
+}
@@ -0,0 +1,211 @@
+package queue
+
+import (
+	"context"
+	"net"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// Janela da taxa de conexões novas e dos percentis do connect: 6
+// intervalos de 10s, cerca de 1 minuto
+const (
+	connWindowSlot  = 10 * time.Second
+	connWindowSlots = 6
+)
+
+// connStats são as conexões de saída com um processador. O nil não mede
+// nada, então quem chama não precisa saber se PROCESSOR_CONN_METRICS está
+// ligado.
+type connStats struct {
+	metrics *metrics.ProcessorMetrics
+	dials   *metrics.WindowHistogram // connects recentes, para a taxa e os percentis
+
+	open   atomic.Int64 // discadas e ainda não fechadas
+	active atomic.Int64 // entregues a uma chamada de payment em andamento
+}
+
+func newConnStats(processorID string) *connStats {
+	return &connStats{
+		metrics: metrics.Processor(processorID),
+		dials:   metrics.NewWindowHistogram(metrics.ExponentialBounds(0.00005, 1.25, 48), connWindowSlot, connWindowSlots),
+	}
+}
+
+// connDialer é o DialContext do Transport com PROCESSOR_CONN_METRICS: mede
+// o connect e acompanha o fechamento de cada conexão com os processadores.
+// Só a discagem passa por aqui; ler e escrever na conexão não custa nada a
+// mais.
+type connDialer struct {
+	dial   dialFunc
+	byAddr map[string]*connStats // "host:porta" de cada processador
+}
+
+// newConnDialer liga o endereço de cada URL ao connStats do processador;
+// com os dois no mesmo endereço, as conexões contam no primeiro. O
+// connect medido é o de dial, com a resolução do host dentro dele.
+func newConnDialer(dial dialFunc, urls []string, stats []*connStats) *connDialer {
+	d := &connDialer{dial: dial, byAddr: make(map[string]*connStats, len(urls))}
+	for i, rawURL := range urls {
+		addr, ok := dialAddr(rawURL)
+		if _, taken := d.byAddr[addr]; ok && !taken {
+			d.byAddr[addr] = stats[i]
+		}
+	}
+	return d
+}
+
+// dialAddr é o endereço que o Transport disca para a URL, com a porta
+// padrão do scheme
+func dialAddr(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "", false
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port), true
+}
+
+func (d *connDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	start := time.Now()
+	conn, err := d.dial(ctx, network, addr)
+	stats := d.byAddr[addr]
+	if err != nil || stats == nil {
+		return conn, err
+	}
+
+	elapsed := time.Since(start)
+	stats.metrics.Dial.Observe(elapsed)
+	stats.dials.Observe(elapsed)
+	stats.open.Add(1)
+	return &trackedConn{Conn: conn, stats: stats}, nil
+}
+
+// trackedConn desconta a conexão das abertas no primeiro Close
+type trackedConn struct {
+	net.Conn
+	stats  *connStats
+	closed atomic.Bool
+}
+
+func (c *trackedConn) Close() error {
+	if c.closed.CompareAndSwap(false, true) {
+		c.stats.open.Add(-1)
+	}
+	return c.Conn.Close()
+}
+
+// requestTrace são os hooks do httptrace de uma chamada de payment. Os
+// hooks são method values ligados uma vez, quando o pool cria o
+// requestTrace; por chamada sobra só o contexto do WithClientTrace.
+type requestTrace struct {
+	stats *connStats
+	trace httptrace.ClientTrace
+	wrote atomic.Int64 // UnixNano do fim do envio
+	held  atomic.Bool  // recebeu uma conexão, contada em active
+}
+
+var requestTraces = sync.Pool{
+	New: func() any {
+		r := &requestTrace{}
+		r.trace.GotConn = r.gotConn
+		r.trace.WroteRequest = r.wroteRequest
+		r.trace.GotFirstResponseByte = r.gotFirstResponseByte
+		return r
+	},
+}
+
+// trace prende os hooks de conexão a ctx. Um ctx que já traz um
+// ClientTrace fica sem: o WithClientTrace encadearia os hooks dele nos do
+// requestTrace, que voltaria ao pool com eles.
+func (s *connStats) trace(ctx context.Context) (context.Context, *requestTrace) {
+	if s == nil || httptrace.ContextClientTrace(ctx) != nil {
+		return ctx, nil
+	}
+	r := requestTraces.Get().(*requestTrace)
+	r.stats = s
+	return httptrace.WithClientTrace(ctx, &r.trace), r
+}
+
+func (r *requestTrace) gotConn(info httptrace.GotConnInfo) {
+	if info.Reused {
+		r.stats.metrics.Conns.Inc(metrics.ConnReused)
+	} else {
+		r.stats.metrics.Conns.Inc(metrics.ConnNew)
+	}
+	// Uma nova tentativa após falha de conexão recebe outra conexão, mas a
+	// anterior já caiu: continua uma só em uso
+	if r.held.CompareAndSwap(false, true) {
+		r.stats.active.Add(1)
+	}
+}
+
+func (r *requestTrace) wroteRequest(info httptrace.WroteRequestInfo) {
+	if info.Err == nil {
+		r.wrote.Store(time.Now().UnixNano())
+	}
+}
+
+func (r *requestTrace) gotFirstResponseByte() {
+	if wrote := r.wrote.Load(); wrote != 0 {
+		r.stats.metrics.FirstByte.Observe(time.Duration(time.Now().UnixNano() - wrote))
+	}
+}
+
+// finish termina a chamada, depois de o corpo da resposta ser fechado.
+// Com recycle o requestTrace volta ao pool; numa chamada que falhou o
+// Transport ainda pode chamar um hook atrasado, então ele fica para o GC.
+func (r *requestTrace) finish(recycle bool) {
+	if r == nil {
+		return
+	}
+	if r.held.Swap(false) {
+		r.stats.active.Add(-1)
+	}
+	if recycle {
+		r.stats = nil
+		r.wrote.Store(0)
+		requestTraces.Put(r)
+	}
+}
+
+// stats retorna o pool de conexões agora; nil com PROCESSOR_CONN_METRICS
+// desligado
+func (s *connStats) stats() *types.ProcessorConnections {
+	if s == nil {
+		return nil
+	}
+
+	conns := s.metrics.Conns.Values()
+	created, reused := conns[metrics.ConnNew], conns[metrics.ConnReused]
+	var reusePercent float64
+	if total := created + reused; total > 0 {
+		reusePercent = float64(reused) * 100 / float64(total)
+	}
+
+	open, active := s.open.Load(), s.active.Load()
+	recent := s.dials.Snapshot()
+	return &types.ProcessorConnections{
+		New:          created,
+		Reused:       reused,
+		ReusePercent: reusePercent,
+		NewPerSecond: float64(recent.Count) / s.dials.Window().Seconds(),
+		DialP50Ms:    durationMs(recent.Quantile(0.50)),
+		DialP99Ms:    durationMs(recent.Quantile(0.99)),
+		Open:         open,
+		Active:       active,
+		Idle:         max(open-active, 0),
+	}
+}
@@ -0,0 +1,286 @@
+package queue
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// dnsLookupTimeout limita cada resolução; a de uma chamada também fica no
+// prazo dela
+const dnsLookupTimeout = 2 * time.Second
+
+// dialFunc é a assinatura do DialContext do Transport
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// dnsCache guarda os IPs dos hosts dos processadores, para uma falha do
+// DNS (o do Docker engasga sob carga) não virar falha de conexão e tirar o
+// processador do roteamento. Os hosts são resolvidos no boot e de novo a
+// cada ttl, fora do caminho das chamadas; uma resolução que falha mantém
+// os IPs anteriores. As conexões discam os IPs guardados, em rodízio entre
+// os registros do host.
+type dnsCache struct {
+	ttl    time.Duration
+	dial   dialFunc
+	lookup func(ctx context.Context, host string) ([]netip.Addr, error)
+	hosts  map[string]*dnsEntry // só os hosts das URLs dos processadores
+	logger *slog.Logger
+}
+
+// dnsEntry são os IPs de um host
+type dnsEntry struct {
+	host       string
+	processors []string
+
+	mu          sync.Mutex // serializa as resoluções do host
+	addrs       atomic.Pointer[[]netip.Addr]
+	resolvedAt  atomic.Int64 // UnixNano da última resolução bem-sucedida
+	attemptedAt atomic.Int64 // UnixNano da última tentativa
+	next        atomic.Uint32
+	lookups     atomic.Int64
+	failures    atomic.Int64
+	forced      atomic.Int64 // resoluções forçadas por falha no connect
+	lastErr     atomic.Pointer[string]
+}
+
+// newDNSCache cria o cache dos hosts das URLs, discando com dial; nil com
+// ttl 0 ou sem nenhum host a resolver (URLs com IP)
+func newDNSCache(ttl time.Duration, dial dialFunc, urls []string, processors []string) *dnsCache {
+	if ttl <= 0 {
+		return nil
+	}
+	c := &dnsCache{
+		ttl:    ttl,
+		dial:   dial,
+		lookup: lookupHost,
+		hosts:  make(map[string]*dnsEntry, len(urls)),
+		logger: slog.Default(),
+	}
+	for i, rawURL := range urls {
+		u, err := url.Parse(rawURL)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+		host := u.Hostname()
+		if _, err := netip.ParseAddr(host); err == nil {
+			continue
+		}
+		entry := c.hosts[host]
+		if entry == nil {
+			entry = &dnsEntry{host: host}
+			c.hosts[host] = entry
+		}
+		entry.processors = append(entry.processors, processors[i])
+	}
+	if len(c.hosts) == 0 {
+		return nil
+	}
+	return c
+}
+
+// lookupHost resolve o host pelo resolver padrão, com IPv4 mapeados em
+// IPv6 desfeitos
+func lookupHost(ctx context.Context, host string) ([]netip.Addr, error) {
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	for i, addr := range addrs {
+		addrs[i] = addr.Unmap()
+	}
+	return addrs, err
+}
+
+// DialContext disca os IPs guardados do host, a partir do próximo do
+// rodízio. Se todos falham, o host é resolvido de novo antes de a falha
+// contar para o processador: o container pode ter voltado com outro IP.
+// Hosts fora do cache, e os ainda sem nenhuma resolução, seguem a
+// resolução normal do dialer.
+func (c *dnsCache) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	entry := c.hosts[host]
+	if err != nil || entry == nil {
+		return c.dial(ctx, network, addr)
+	}
+
+	start := time.Now().UnixNano()
+	addrs := entry.get()
+	if len(addrs) == 0 {
+		c.refresh(ctx, entry, 0)
+		if addrs = entry.get(); len(addrs) == 0 {
+			return c.dial(ctx, network, addr)
+		}
+	}
+
+	conn, err := c.dialAddrs(ctx, network, entry, addrs, port)
+	if err == nil || ctx.Err() != nil {
+		return conn, err
+	}
+
+	entry.forced.Add(1)
+	if !c.refresh(ctx, entry, start) {
+		return nil, err
+	}
+	fresh := entry.get()
+	if slices.Equal(fresh, addrs) {
+		return nil, err
+	}
+	return c.dialAddrs(ctx, network, entry, fresh, port)
+}
+
+// dialAddrs tenta os IPs a partir do próximo do rodízio, até um conectar
+// ou o prazo acabar; o erro é o do primeiro
+func (c *dnsCache) dialAddrs(ctx context.Context, network string, entry *dnsEntry, addrs []netip.Addr, port string) (net.Conn, error) {
+	first := int(entry.next.Add(1)-1) % len(addrs)
+	var firstErr error
+	for i := range addrs {
+		ip := addrs[(first+i)%len(addrs)]
+		conn, err := c.dial(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, firstErr
+}
+
+// refresh resolve o host de novo; false se a resolução falhou, com os IPs
+// anteriores mantidos. Com since, uma resolução feita por outra chamada
+// depois desse instante vale por esta.
+func (c *dnsCache) refresh(ctx context.Context, entry *dnsEntry, since int64) bool {
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if since != 0 && entry.attemptedAt.Load() > since {
+		return entry.lastErr.Load() == nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, dnsLookupTimeout)
+	defer cancel()
+
+	entry.attemptedAt.Store(time.Now().UnixNano())
+	entry.lookups.Add(1)
+	addrs, err := c.lookup(ctx, entry.host)
+	if err == nil && len(addrs) == 0 {
+		err = &net.DNSError{Err: "no addresses", Name: entry.host, IsNotFound: true}
+	}
+	if err != nil {
+		entry.failures.Add(1)
+		message := err.Error()
+		entry.lastErr.Store(&message)
+		c.logger.Warn("processor host resolution failed, keeping cached addresses",
+			"host", entry.host,
+			"cached", len(entry.get()),
+			"error", message)
+		return false
+	}
+
+	previous := entry.get()
+	entry.addrs.Store(&addrs)
+	entry.resolvedAt.Store(time.Now().UnixNano())
+	entry.lastErr.Store(nil)
+	if !slices.Equal(previous, addrs) {
+		c.logger.Info("processor host resolved",
+			"host", entry.host,
+			"addresses", addrStrings(addrs),
+			"previous", addrStrings(previous))
+	}
+	return true
+}
+
+// refreshAll resolve todos os hosts, em paralelo
+func (c *dnsCache) refreshAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, entry := range c.hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.refresh(ctx, entry, 0)
+		}()
+	}
+	wg.Wait()
+}
+
+func (e *dnsEntry) get() []netip.Addr {
+	if addrs := e.addrs.Load(); addrs != nil {
+		return *addrs
+	}
+	return nil
+}
+
+func addrStrings(addrs []netip.Addr) []string {
+	out := make([]string, len(addrs))
+	for i, addr := range addrs {
+		out[i] = addr.String()
+	}
+	return out
+}
+
+// stats retorna o conteúdo do cache, em ordem de host; nil desligado
+func (c *dnsCache) stats() []types.DNSHostStats {
+	if c == nil {
+		return nil
+	}
+	stats := make([]types.DNSHostStats, 0, len(c.hosts))
+	for _, entry := range c.hosts {
+		s := types.DNSHostStats{
+			Host:            entry.host,
+			Processors:      entry.processors,
+			Addresses:       addrStrings(entry.get()),
+			Lookups:         entry.lookups.Load(),
+			Failures:        entry.failures.Load(),
+			ForcedRefreshes: entry.forced.Load(),
+		}
+		if at := entry.resolvedAt.Load(); at != 0 {
+			resolved := time.Unix(0, at).UTC()
+			s.ResolvedAt = &resolved
+		}
+		if at := entry.attemptedAt.Load(); at != 0 {
+			attempted := time.Unix(0, at).UTC()
+			s.AttemptedAt = &attempted
+		}
+		if lastErr := entry.lastErr.Load(); lastErr != nil {
+			s.LastError = *lastErr
+		}
+		stats = append(stats, s)
+	}
+	slices.SortFunc(stats, func(a, b types.DNSHostStats) int {
+		return strings.Compare(a.Host, b.Host)
+	})
+	return stats
+}
+
+// DNSRefresher resolve os hosts dos processadores de novo a cada
+// DNS_CACHE_TTL_MS; sem o cache retorna na hora
+func (p *PaymentProcessor) DNSRefresher(ctx context.Context) {
+	if p.dns == nil {
+		return
+	}
+	ticker := time.NewTicker(p.dns.ttl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.dns.refreshAll(ctx)
+		}
+	}
+}
+
+// DNSStats retorna o cache de DNS dos processadores para o summary
+// detalhado; nil sem DNS_CACHE_TTL_MS
+func (p *PaymentProcessor) DNSStats() []types.DNSHostStats {
+	return p.dns.stats()
+}
@@ -0,0 +1,60 @@
+package queue
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// drainWindow são os segundos completos, antes do atual, que entram na
+// taxa de drenagem
+const drainWindow = 5
+
+// drainMeter conta os jobs que saíram da fila (processados, falhos ou
+// vencidos) em buckets de 1s, para estimar quantos payments por segundo o
+// pool drena. O segundo em curso fica de fora: incompleto, ele puxaria a
+// taxa para baixo.
+type drainMeter struct {
+	buckets [drainWindow + 1]drainBucket
+	mu      sync.Mutex // só na troca de segundo de um bucket
+}
+
+type drainBucket struct {
+	second atomic.Int64 // segundo Unix da contagem
+	count  atomic.Int64
+}
+
+// add conta um job finalizado no segundo now
+func (m *drainMeter) add(now int64) {
+	bk := &m.buckets[now%int64(len(m.buckets))]
+	if bk.second.Load() != now {
+		m.mu.Lock()
+		if bk.second.Load() < now {
+			bk.count.Store(0)
+			bk.second.Store(now)
+		}
+		m.mu.Unlock()
+	}
+	if bk.second.Load() == now {
+		bk.count.Add(1)
+	}
+}
+
+// rate retorna os jobs por segundo nos drainWindow segundos completos
+// antes de now
+func (m *drainMeter) rate(now int64) float64 {
+	var total int64
+	for i := range m.buckets {
+		bk := &m.buckets[i]
+		if second := bk.second.Load(); second < now && second >= now-drainWindow {
+			total += bk.count.Load()
+		}
+	}
+	return float64(total) / drainWindow
+}
+
+// DrainRate retorna quantos payments por segundo os workers finalizaram
+// nos últimos segundos; zero com a fila parada
+func (wp *WorkerPool) DrainRate() float64 {
+	return wp.drain.rate(time.Now().Unix())
+}
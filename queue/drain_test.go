@@ -0,0 +1,61 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDrainMeterRate(t *testing.T) {
+	var m drainMeter
+	const now = 1_000_000
+
+	// 10 jobs em cada um dos 7 segundos até now, inclusive
+	for second := int64(now - 6); second <= now; second++ {
+		for range 10 {
+			m.add(second)
+		}
+	}
+	// Só os 5 segundos completos antes de now: nem o em curso nem o 6º
+	if got := m.rate(now); got != 10 {
+		t.Fatalf("rate = %v, want 10 jobs per second", got)
+	}
+
+	// Sem jobs por um segundo, a média da janela cai
+	if got := m.rate(now + 2); got != 8 {
+		t.Fatalf("rate one idle second later = %v, want 8", got)
+	}
+	// O bucket reaproveitado recomeça do zero
+	m.add(now + 2)
+	if got := m.rate(now + 3); got != 6.2 {
+		t.Fatalf("rate after reusing a bucket = %v, want 6.2", got)
+	}
+	if got := m.rate(now + drainWindow + 4); got != 0 {
+		t.Fatalf("rate after the window went idle = %v, want 0", got)
+	}
+}
+
+func TestDrainRateCountsFinishedJobs(t *testing.T) {
+	processor := newFakeProcessor(t)
+	processor.delay.Store(int64(10 * time.Millisecond))
+	cfg := testPoolConfig(1)
+	cfg.BatchSize, cfg.BatchParallelism = 1, 1
+	pool := newTestPool(t, testProcessorConfig(processor, newFakeProcessor(t)), cfg)
+
+	for i := range 300 {
+		if pool.Submit(context.Background(), newTestPayment(i)) != nil {
+			t.Fatalf("Submit refused payment %d", i)
+		}
+	}
+	// O primeiro segundo completo entra na taxa no segundo seguinte
+	waitFor(t, 3*time.Second, "a drain rate", func() bool { return pool.DrainRate() > 0 })
+
+	// 1 worker a 10ms por payment drena no máximo 100/s; a janela de 5s
+	// ainda tem segundos vazios, então a taxa fica abaixo disso
+	if rate := pool.DrainRate(); rate > 100.0/drainWindow*2 {
+		t.Errorf("drain rate = %v with 1 worker at 10ms per payment", rate)
+	}
+	if got := pool.Stats().DrainRate; got <= 0 {
+		t.Errorf("pool stats drain_rate = %v, want the measured rate", got)
+	}
+}
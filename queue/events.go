@@ -0,0 +1,144 @@
+package queue
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// eventBuffer é o buffer de cada assinante; um assinante que fica para trás
+// perde os eventos que não couberem
+const eventBuffer = 256
+
+// MaxEventSubscribers limita os streams abertos ao mesmo tempo
+const MaxEventSubscribers = 64
+
+// EventHub distribui os desfechos dos payments aos assinantes do stream de
+// eventos. Publicar nunca bloqueia: sem assinantes o custo é uma leitura
+// atômica e um assinante lento perde eventos em vez de segurar o worker.
+type EventHub struct {
+	mu          sync.RWMutex
+	subs        map[*Subscription]struct{}
+	closed      bool
+	subscribers atomic.Int32
+	dropped     atomic.Int64
+}
+
+// Subscription é um assinante do hub. C é fechado quando o assinante sai
+// ou o hub é encerrado.
+type Subscription struct {
+	C       <-chan types.PaymentEvent
+	ch      chan types.PaymentEvent
+	dropped atomic.Int64
+}
+
+// NewEventHub cria um hub sem assinantes
+func NewEventHub() *EventHub {
+	return &EventHub{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscribe registra um assinante; retorna false com o hub encerrado ou no
+// limite de MaxEventSubscribers
+func (h *EventHub) Subscribe() (*Subscription, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed || len(h.subs) >= MaxEventSubscribers {
+		return nil, false
+	}
+
+	ch := make(chan types.PaymentEvent, eventBuffer)
+	sub := &Subscription{C: ch, ch: ch}
+	h.subs[sub] = struct{}{}
+	h.subscribers.Store(int32(len(h.subs)))
+	return sub, true
+}
+
+// Unsubscribe remove o assinante e fecha o seu channel
+func (h *EventHub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subs[sub]; !ok {
+		return // já removido pelo Close
+	}
+	delete(h.subs, sub)
+	close(sub.ch)
+	h.subscribers.Store(int32(len(h.subs)))
+}
+
+// Publish entrega o evento a cada assinante sem bloquear
+func (h *EventHub) Publish(event types.PaymentEvent) {
+	if h.subscribers.Load() == 0 {
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for sub := range h.subs {
+		select {
+		case sub.ch <- event:
+		default:
+			sub.dropped.Add(1)
+			h.dropped.Add(1)
+			metrics.EventsDropped.Inc()
+		}
+	}
+}
+
+// Close encerra o hub e fecha o channel de todos os assinantes, o que
+// termina os streams abertos
+func (h *EventHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+	h.closed = true
+	for sub := range h.subs {
+		delete(h.subs, sub)
+		close(sub.ch)
+	}
+	h.subscribers.Store(0)
+}
+
+// Stats retorna os assinantes atuais e os eventos já descartados
+func (h *EventHub) Stats() types.EventStats {
+	return types.EventStats{
+		Subscribers: int(h.subscribers.Load()),
+		Dropped:     h.dropped.Load(),
+	}
+}
+
+// Dropped retorna os eventos que este assinante perdeu por estar lento
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// publishJob publica o desfecho de um job, montando o evento só quando há
+// assinantes
+func (h *EventHub) publishJob(j Job, outcome, processorID string) {
+	if h.subscribers.Load() == 0 {
+		return
+	}
+
+	event := types.PaymentEvent{
+		CorrelationID: j.Payment.CorrelationID,
+		Processor:     processorID,
+		Outcome:       outcome,
+	}
+	if !j.enqueuedAt.IsZero() {
+		event.LatencyMs = durationMs(time.Since(j.enqueuedAt))
+	}
+	h.Publish(event)
+}
+
+// Events retorna o hub com os desfechos dos payments processados pelo pool
+func (wp *WorkerPool) Events() *EventHub {
+	return wp.events
+}
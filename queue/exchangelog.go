@@ -0,0 +1,350 @@
+package queue
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// Limites da amostragem temporária do POST /admin/exchange-log
+const (
+	exchangeBoostDefault = 5 * time.Minute
+	exchangeBoostMax     = time.Hour
+)
+
+// Motivo de uma troca ter sido logada
+const (
+	exchangeSampled = "sampled"
+	exchangeFailed  = "failed"
+)
+
+// redactedValue substitui os valores dos headers com credenciais
+const redactedValue = "[REDACTED]"
+
+// ErrInvalidExchangeLog é a amostragem inválida no POST /admin/exchange-log
+var ErrInvalidExchangeLog = errors.New("invalid exchange log setting")
+
+// exchangeLog é o RoundTripper mais externo do client dos processadores:
+// loga a chamada inteira (URL, headers com as credenciais ocultas, corpo,
+// status e o começo do corpo da resposta) em um registro só. Uma a cada
+// every chamadas é logada, decidido por um contador atômico, e toda chamada
+// que falha (resposta fora de 2xx ou erro de conexão) também, até
+// errorsPerSec por segundo. Dos corpos vão até maxBytes: o da chamada é
+// lido antes do envio; o da resposta, enquanto o chamador o lê, e o que ele
+// não leu é lido até maxBytes no Close, que é quando o registro sai.
+// Desligado, custa a leitura de dois atômicos por chamada.
+type exchangeLog struct {
+	next       http.RoundTripper
+	processors map[string]string // "host:porta" -> processador
+	sensitive  map[string]bool   // headers de credencial configurados, na forma canônica
+	maxBytes   int
+	logger     *slog.Logger
+
+	bootEvery    int64
+	every        atomic.Int64
+	until        atomic.Int64 // UnixNano do fim da amostragem do POST; 0 sem ela
+	errorsPerSec int64
+	counter      atomic.Uint64
+
+	errWindow  atomic.Int64 // segundo unix da janela do limite de falhas
+	errCount   atomic.Int64
+	sampled    atomic.Int64
+	failed     atomic.Int64
+	suppressed atomic.Int64
+}
+
+// newExchangeLog cria a camada com a configuração do boot. auth são os
+// headers de token e extras dos processadores, que nunca aparecem no log.
+func newExchangeLog(cfg ProcessorConfig, urls, processors []string, auth ...http.Header) *exchangeLog {
+	l := &exchangeLog{
+		processors:   make(map[string]string, len(urls)),
+		sensitive:    make(map[string]bool),
+		maxBytes:     cfg.ExchangeLogMaxBytes,
+		logger:       slog.Default(),
+		bootEvery:    int64(cfg.ExchangeLogEvery),
+		errorsPerSec: int64(cfg.ExchangeLogErrorsPerSec),
+	}
+	l.every.Store(l.bootEvery)
+	for i, rawURL := range urls {
+		if addr, ok := dialAddr(rawURL); ok {
+			if _, taken := l.processors[addr]; !taken {
+				l.processors[addr] = processors[i]
+			}
+		}
+	}
+	for _, headers := range auth {
+		for key := range headers {
+			l.sensitive[http.CanonicalHeaderKey(key)] = true
+		}
+	}
+	if l.bootEvery > 0 || l.errorsPerSec > 0 {
+		l.logger.Info("processor exchange logging enabled",
+			"every", l.bootEvery,
+			"errors_per_sec", l.errorsPerSec,
+			"max_body_bytes", l.maxBytes)
+	}
+	return l
+}
+
+// wrap põe a camada por fora de next
+func (l *exchangeLog) wrap(next http.RoundTripper) http.RoundTripper {
+	l.next = next
+	return l
+}
+
+// exchange é uma chamada que pode ser logada
+type exchange struct {
+	req           *http.Request
+	body          []byte // começo do corpo, até maxBytes
+	bodyTruncated bool
+	trigger       string
+	elapsed       time.Duration
+}
+
+// RoundTrip decide a amostragem antes da chamada e, com a amostragem ou o
+// log de falhas ligado, guarda o começo do corpo antes de enviá-lo, para o
+// log trazer o que seria enviado mesmo que a conexão caia antes. Uma
+// resposta logada tem o corpo trocado pelo que guarda o começo dele e loga
+// no Close.
+func (l *exchangeLog) RoundTrip(req *http.Request) (*http.Response, error) {
+	every := l.currentEvery()
+	if every == 0 && l.errorsPerSec == 0 {
+		return l.next.RoundTrip(req)
+	}
+	ex := &exchange{req: req}
+	if every > 0 && l.counter.Add(1)%uint64(every) == 0 {
+		ex.trigger = exchangeSampled
+	}
+	if ex.trigger == "" && l.errorsPerSec == 0 {
+		return l.next.RoundTrip(req)
+	}
+
+	outbound := req
+	if req.Body != nil && req.Body != http.NoBody {
+		prefix, err := io.ReadAll(io.LimitReader(req.Body, int64(l.maxBytes)+1))
+		if err != nil {
+			req.Body.Close()
+			return nil, err
+		}
+		ex.body, ex.bodyTruncated = prefix[:min(len(prefix), l.maxBytes)], len(prefix) > l.maxBytes
+		copied := *req
+		copied.Body = prefixedBody{Reader: io.MultiReader(bytes.NewReader(prefix), req.Body), Closer: req.Body}
+		outbound = &copied
+	}
+
+	start := time.Now()
+	resp, err := l.next.RoundTrip(outbound)
+	ex.elapsed = time.Since(start)
+	if err != nil {
+		if l.admit(ex) {
+			l.log(ex, 0, nil, err)
+		}
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 || ex.trigger != "" {
+		if l.admit(ex) {
+			capture := &responseCapture{ReadCloser: resp.Body, max: l.maxBytes}
+			capture.done = func() { l.log(ex, resp.StatusCode, capture, nil) }
+			resp.Body = capture
+		}
+	}
+	return resp, nil
+}
+
+// prefixedBody é o corpo da chamada com o começo já lido de volta na frente
+type prefixedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// currentEvery retorna a amostragem atual, voltando à do boot quando a do
+// POST vence
+func (l *exchangeLog) currentEvery() int64 {
+	if until := l.until.Load(); until != 0 && time.Now().UnixNano() >= until && l.until.CompareAndSwap(until, 0) {
+		l.every.Store(l.bootEvery)
+		l.logger.Info("processor exchange sampling back to boot setting", "every", l.bootEvery)
+	}
+	return l.every.Load()
+}
+
+// admit conta a troca que vai ao log; uma falha fora da amostragem passa
+// pelo limite por segundo
+func (l *exchangeLog) admit(ex *exchange) bool {
+	if ex.trigger == exchangeSampled {
+		l.sampled.Add(1)
+		return true
+	}
+	ex.trigger = exchangeFailed
+	if l.errorsPerSec == 0 {
+		return false
+	}
+	now := time.Now().Unix()
+	if window := l.errWindow.Load(); window != now && l.errWindow.CompareAndSwap(window, now) {
+		l.errCount.Store(0)
+	}
+	if l.errCount.Add(1) > l.errorsPerSec {
+		l.suppressed.Add(1)
+		return false
+	}
+	l.failed.Add(1)
+	return true
+}
+
+// log escreve a troca em um registro; status 0 é a chamada sem resposta
+func (l *exchangeLog) log(ex *exchange, status int, response *responseCapture, err error) {
+	req := ex.req
+	attrs := []any{
+		"trigger", ex.trigger,
+		"method", req.Method,
+		"url", req.URL.Redacted(),
+		"request_headers", l.redact(req.Header),
+		logging.KeyLatencyMs, ex.elapsed.Milliseconds(),
+	}
+	if processor := l.processors[requestAddr(req)]; processor != "" {
+		attrs = append(attrs, logging.KeyProcessor, processor)
+	}
+	if ex.body != nil {
+		attrs = append(attrs, "request_body", strings.ToValidUTF8(string(ex.body), ""))
+		if ex.bodyTruncated {
+			attrs = append(attrs, "request_body_truncated", true)
+		}
+	}
+	if status != 0 {
+		attrs = append(attrs, logging.KeyStatus, status, "response_body", strings.ToValidUTF8(string(response.buf), ""))
+		if response.truncated {
+			attrs = append(attrs, "response_body_truncated", true)
+		}
+	}
+	if err != nil {
+		attrs = append(attrs, "error", err.Error())
+	}
+	l.logger.InfoContext(req.Context(), "processor exchange", attrs...)
+}
+
+// redact junta os valores de cada header, trocando os de credencial
+func (l *exchangeLog) redact(header http.Header) map[string]string {
+	redacted := make(map[string]string, len(header))
+	for key, values := range header {
+		value := strings.Join(values, ", ")
+		if l.sensitive[key] || sensitiveHeader(key) {
+			value = redactedValue
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
+
+// sensitiveHeader reconhece pelo nome os headers que costumam levar
+// credenciais, além dos configurados
+func sensitiveHeader(key string) bool {
+	key = strings.ToLower(key)
+	switch key {
+	case "authorization", "proxy-authorization", "cookie":
+		return true
+	}
+	for _, word := range []string{"token", "secret", "password", "api-key", "apikey"} {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetExchangeLog passa a logar 1 a cada every chamadas por duration (0 usa
+// 5 minutos), voltando depois à amostragem do boot; every 0 volta a ela já
+func (p *PaymentProcessor) SetExchangeLog(every int64, duration time.Duration) (types.ExchangeLogStats, error) {
+	l := p.exchanges
+	if every < 0 {
+		return types.ExchangeLogStats{}, fmt.Errorf("%w: every must not be negative, got %d", ErrInvalidExchangeLog, every)
+	}
+	if duration < 0 || duration > exchangeBoostMax {
+		return types.ExchangeLogStats{}, fmt.Errorf("%w: duration_ms must be between 0 and %d, got %d",
+			ErrInvalidExchangeLog, exchangeBoostMax.Milliseconds(), duration.Milliseconds())
+	}
+
+	if every == 0 {
+		l.until.Store(0)
+		l.every.Store(l.bootEvery)
+		l.logger.Info("processor exchange sampling back to boot setting", "every", l.bootEvery)
+		return p.ExchangeLogStats(), nil
+	}
+	if duration == 0 {
+		duration = exchangeBoostDefault
+	}
+	l.every.Store(every)
+	l.until.Store(time.Now().Add(duration).UnixNano())
+	l.logger.Warn("processor exchange sampling raised",
+		"every", every,
+		"duration_ms", duration.Milliseconds(),
+		"boot_every", l.bootEvery)
+	return p.ExchangeLogStats(), nil
+}
+
+// ExchangeLogStats retorna a amostragem atual e as trocas já logadas
+func (p *PaymentProcessor) ExchangeLogStats() types.ExchangeLogStats {
+	l := p.exchanges
+	stats := types.ExchangeLogStats{
+		Every:        l.currentEvery(),
+		BootEvery:    l.bootEvery,
+		ErrorsPerSec: l.errorsPerSec,
+		MaxBodyBytes: l.maxBytes,
+		Sampled:      l.sampled.Load(),
+		Failed:       l.failed.Load(),
+		Suppressed:   l.suppressed.Load(),
+	}
+	if until := l.until.Load(); until != 0 {
+		at := time.Unix(0, until).UTC()
+		stats.Until = &at
+	}
+	return stats
+}
+
+// responseCapture é o corpo de uma resposta logada: guarda os primeiros max
+// bytes que o chamador lê e, no Close, lê o que ele deixou, até max, e
+// escreve o registro
+type responseCapture struct {
+	io.ReadCloser
+	max       int
+	buf       []byte
+	truncated bool
+	eof       bool
+	once      sync.Once
+	done      func()
+}
+
+func (c *responseCapture) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.keep(p[:n])
+	c.eof = c.eof || err == io.EOF
+	return n, err
+}
+
+// keep guarda o que couber em max
+func (c *responseCapture) keep(data []byte) {
+	if room := c.max - len(c.buf); len(data) > room {
+		c.truncated = true
+		data = data[:max(room, 0)]
+	}
+	c.buf = append(c.buf, data...)
+}
+
+func (c *responseCapture) Close() error {
+	c.once.Do(func() {
+		if !c.eof && !c.truncated {
+			data, _ := io.ReadAll(io.LimitReader(c.ReadCloser, int64(c.max-len(c.buf))+1))
+			c.keep(data)
+		}
+		c.done()
+	})
+	return c.ReadCloser.Close()
+}
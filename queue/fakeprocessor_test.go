@@ -0,0 +1,124 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/store"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// fakeProcessor é um processador de pagamentos de teste: responde status
+// (200 por padrão) depois de delay e conta as chamadas, inclusive o pico de
+// chamadas simultâneas
+type fakeProcessor struct {
+	server *httptest.Server
+	delay  atomic.Int64 // time.Duration
+	status atomic.Int32
+
+	calls  atomic.Int64
+	active atomic.Int64
+	peak   atomic.Int64
+	seen   chan string // correlationIds recebidos, se não for nil
+
+	// onPayment recebe cada payment decodificado, se não for nil; deve ser
+	// definido antes de o pool começar
+	onPayment func(types.PaymentRequest)
+}
+
+func newFakeProcessor(t testing.TB) *fakeProcessor {
+	t.Helper()
+	fp := &fakeProcessor{}
+	fp.status.Store(http.StatusOK)
+	fp.server = httptest.NewServer(http.HandlerFunc(fp.serve))
+	t.Cleanup(fp.server.Close)
+	return fp
+}
+
+func (fp *fakeProcessor) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"failing":false,"minResponseTime":0}`))
+		return
+	}
+	active := fp.active.Add(1)
+	defer fp.active.Add(-1)
+	for peak := fp.peak.Load(); active > peak && !fp.peak.CompareAndSwap(peak, active); peak = fp.peak.Load() {
+	}
+	fp.calls.Add(1)
+
+	var payment types.PaymentRequest
+	body, _ := io.ReadAll(r.Body)
+	types.DecodePayment(body, &payment)
+	if fp.seen != nil {
+		fp.seen <- payment.CorrelationID
+	}
+	if fp.onPayment != nil {
+		fp.onPayment(payment)
+	}
+
+	if delay := time.Duration(fp.delay.Load()); delay > 0 {
+		time.Sleep(delay)
+	}
+	w.WriteHeader(int(fp.status.Load()))
+	w.Write([]byte(`{"message":"ok"}`))
+}
+
+// testProcessorConfig aponta os dois processadores para os servidores de
+// teste, sem snapshot do summary em disco
+func testProcessorConfig(defaultProcessor, fallbackProcessor *fakeProcessor) ProcessorConfig {
+	cfg := DefaultProcessorConfig()
+	cfg.DefaultURL = defaultProcessor.server.URL + "/payments"
+	cfg.FallbackURL = fallbackProcessor.server.URL + "/payments"
+	cfg.Snapshot = false
+	cfg.WarmupConnections = 0
+	return cfg
+}
+
+// newTestPool cria o processador e o pool com a fila em memória e inicia os
+// workers; o pool para no fim do teste
+func newTestPool(t testing.TB, processorConfig ProcessorConfig, poolConfig PoolConfig) *WorkerPool {
+	t.Helper()
+	processor := NewPaymentProcessor(processorConfig, store.NewMemoryStore(store.MemoryOptions{}))
+	pool := NewWorkerPool(processor, NewRingBackend(poolConfig.QueueSize), poolConfig)
+	pool.Start()
+	t.Cleanup(pool.Stop)
+	return pool
+}
+
+// testPoolConfig é o pool padrão com workers e fila pequenos
+func testPoolConfig(workers int) PoolConfig {
+	cfg := DefaultPoolConfig()
+	cfg.Workers = workers
+	cfg.QueueSize = 1000
+	return cfg
+}
+
+// newTestPayment cria um payment de 1 real com correlationId único
+func newTestPayment(i int) *types.PaymentRequest {
+	return &types.PaymentRequest{
+		CorrelationID: fmt.Sprintf("00000000-0000-4000-8000-%012d", i),
+		Amount:        100,
+		RequestedAt:   time.Now().UTC(),
+	}
+}
+
+// waitFor espera cond ficar verdadeira, falhando o teste depois de timeout
+func waitFor(t testing.TB, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for !cond() {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("timed out after %s waiting for %s", timeout, what)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
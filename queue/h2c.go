@@ -0,0 +1,238 @@
+package queue
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// Protocolos das chamadas aos processadores
+const (
+	protocolHTTP1 = "http/1.1"
+	protocolH2C   = "h2c"
+)
+
+// h2cRetryInterval é quanto um processador que caiu para HTTP/1.1 fica
+// nele antes de o h2c ser tentado de novo, para um proxy que passou a
+// falar h2c depois do boot não ficar em HTTP/1.1 até o restart
+const h2cRetryInterval = time.Minute
+
+// h2cRoute é o HTTP/2 sem TLS (h2c, com prior knowledge) de um processador.
+// O h2c é tentado até a primeira resposta; se a conexão cair antes dela,
+// o processador não fala h2c e as chamadas passam para o Transport
+// HTTP/1.1 por h2cRetryInterval. Depois da primeira resposta, falhas são
+// falhas de conexão comuns, com as mesmas novas tentativas e o mesmo
+// circuit breaker do HTTP/1.1.
+type h2cRoute struct {
+	processorID string
+	transport   *http2.Transport
+	logger      *slog.Logger
+
+	confirmed  atomic.Bool  // já recebeu uma resposta em h2c
+	fellBackAt atomic.Int64 // UnixNano da queda para HTTP/1.1; 0 em h2c
+	fallbacks  atomic.Int64
+	lastErr    atomic.Pointer[string] // falha do h2c da última queda
+}
+
+// newH2CRoute cria o http2.Transport do processador: AllowHTTP e um
+// DialTLSContext que disca TCP puro, com o mesmo dial do Transport
+// HTTP/1.1 (medido com PROCESSOR_CONN_METRICS). As chamadas multiplexam em
+// poucas conexões; uma nova só abre quando uma enche de streams.
+func newH2CRoute(processorID string, dial dialFunc) *h2cRoute {
+	return &h2cRoute{
+		processorID: processorID,
+		logger:      slog.Default(),
+		transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dial(ctx, network, addr)
+			},
+			IdleConnTimeout: 90 * time.Second,
+			// Com as chamadas multiplexadas, uma conexão morta derruba todas:
+			// um ping depois de 15s sem leitura a descarta antes disso
+			ReadIdleTimeout: 15 * time.Second,
+		},
+	}
+}
+
+// useH2C indica se a próxima chamada vai em h2c; depois de
+// h2cRetryInterval em HTTP/1.1, a primeira chamada volta a tentar o h2c
+func (r *h2cRoute) useH2C(now time.Time) bool {
+	at := r.fellBackAt.Load()
+	if at == 0 {
+		return true
+	}
+	if now.UnixNano()-at < int64(h2cRetryInterval) || !r.fellBackAt.CompareAndSwap(at, 0) {
+		return false
+	}
+	r.logger.Info("retrying h2c with processor", logging.KeyProcessor, r.processorID)
+	return true
+}
+
+// fallBack passa o processador para HTTP/1.1 por h2cRetryInterval
+func (r *h2cRoute) fallBack(err error) {
+	if !r.fellBackAt.CompareAndSwap(0, time.Now().UnixNano()) {
+		return
+	}
+	message := err.Error()
+	r.lastErr.Store(&message)
+	r.fallbacks.Add(1)
+	r.logger.Warn("processor does not speak h2c, falling back to HTTP/1.1",
+		logging.KeyProcessor, r.processorID,
+		"error", message,
+		"retry_in_ms", h2cRetryInterval.Milliseconds())
+}
+
+// h2cRejected indica se a falha de uma chamada em h2c ainda sem resposta
+// pode ser o processador recusando o protocolo. Um servidor só HTTP/1.1
+// responde ao preface do HTTP/2 com um 400 e fecha a conexão, o que chega
+// como EOF ou reset; recusa no connect e timeout não dizem nada do
+// protocolo.
+func h2cRejected(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return false
+	}
+	return classifyTransportError(err) != metrics.ClassTimeout
+}
+
+// stats retorna o protocolo das chamadas ao processador; nil sem h2c é
+// sempre HTTP/1.1
+func (r *h2cRoute) stats() types.ProcessorProtocol {
+	if r == nil {
+		return types.ProcessorProtocol{Configured: protocolHTTP1, Current: protocolHTTP1}
+	}
+	stats := types.ProcessorProtocol{
+		Configured: protocolH2C,
+		Current:    protocolH2C,
+		Confirmed:  r.confirmed.Load(),
+		Fallbacks:  r.fallbacks.Load(),
+	}
+	if at := r.fellBackAt.Load(); at != 0 {
+		stats.Current = protocolHTTP1
+		retryAt := time.Unix(0, at).Add(h2cRetryInterval).UTC()
+		stats.RetryAt = &retryAt
+	}
+	if lastErr := r.lastErr.Load(); lastErr != nil {
+		stats.LastError = *lastErr
+	}
+	return stats
+}
+
+// protocolTransport é o RoundTripper do client dos processadores: as
+// chamadas aos endereços com h2c vão pelo h2cRoute e as demais pelo
+// Transport HTTP/1.1. O http.Client e o contexto de cada chamada são os
+// mesmos nos dois protocolos, então prazos, novas tentativas e circuit
+// breaker não mudam com eles.
+type protocolTransport struct {
+	http1  *http.Transport
+	routes map[string]*h2cRoute // "host:porta" dos processadores com h2c
+}
+
+// newProtocolTransport liga o endereço de cada URL com h2c à rota do
+// processador; com os dois processadores no mesmo endereço, vale o
+// primeiro. Sem nenhuma rota, retorna o próprio Transport HTTP/1.1.
+func newProtocolTransport(http1 *http.Transport, urls []string, routes []*h2cRoute) http.RoundTripper {
+	t := &protocolTransport{http1: http1, routes: make(map[string]*h2cRoute, len(urls))}
+	for i, rawURL := range urls {
+		addr, ok := dialAddr(rawURL)
+		if _, taken := t.routes[addr]; ok && !taken && routes[i] != nil {
+			t.routes[addr] = routes[i]
+		}
+	}
+	if len(t.routes) == 0 {
+		return http1
+	}
+	return t
+}
+
+// RoundTrip manda a chamada em h2c quando o endereço tem rota e ela não
+// caiu para HTTP/1.1. Se o h2c falha antes da primeira resposta, a
+// chamada é refeita em HTTP/1.1, dentro do mesmo prazo, e a rota cai para
+// HTTP/1.1 se esta responder; o servidor recusou o preface, então não
+// recebeu a chamada. Um corpo que não pode ser relido (os de lote) não é
+// refeito: a falha segue como a de qualquer conexão, e a rota cai para
+// HTTP/1.1 sem a confirmação.
+func (t *protocolTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	route := t.routes[requestAddr(req)]
+	if route == nil || !route.useH2C(time.Now()) {
+		return t.http1.RoundTrip(req)
+	}
+
+	resp, err := route.transport.RoundTrip(req)
+	if err == nil {
+		route.confirmed.Store(true)
+		return resp, nil
+	}
+	if route.confirmed.Load() || req.Context().Err() != nil || !h2cRejected(err) {
+		return nil, err
+	}
+
+	retry, ok := rewindRequest(req)
+	if !ok {
+		route.fallBack(err)
+		return nil, err
+	}
+	resp, http1Err := t.http1.RoundTrip(retry)
+	if http1Err != nil {
+		return nil, http1Err
+	}
+	route.fallBack(err)
+	return resp, nil
+}
+
+// probing indica se a chamada vai testar o h2c: a rota ainda não teve
+// resposta nem caiu para HTTP/1.1
+func (t *protocolTransport) probing(req *http.Request) bool {
+	route := t.routes[requestAddr(req)]
+	return route != nil && !route.confirmed.Load() && route.fellBackAt.Load() == 0
+}
+
+// CloseIdleConnections fecha as conexões ociosas dos dois protocolos
+func (t *protocolTransport) CloseIdleConnections() {
+	t.http1.CloseIdleConnections()
+	for _, route := range t.routes {
+		route.transport.CloseIdleConnections()
+	}
+}
+
+// requestAddr é o endereço que o Transport disca para a chamada
+func requestAddr(req *http.Request) string {
+	port := req.URL.Port()
+	if port == "" {
+		port = "80"
+		if req.URL.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(req.URL.Hostname(), port)
+}
+
+// rewindRequest copia a chamada com o corpo do início, para refazê-la em
+// outro Transport; false se o corpo não pode ser relido
+func rewindRequest(req *http.Request) (*http.Request, bool) {
+	retry := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return retry, true
+	}
+	if req.GetBody == nil {
+		return nil, false
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, false
+	}
+	retry.Body = body
+	return retry, true
+}
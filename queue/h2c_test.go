@@ -0,0 +1,73 @@
+package queue
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/yurimachados/rinha-backend-go/store"
+)
+
+// newProtoProcessor sobe o fakeProcessor guardando a versão do HTTP da
+// última chamada de payment; com h2c, o servidor fala HTTP/2 sem TLS
+func newProtoProcessor(t *testing.T, withH2C bool, proto *atomic.Int32) *fakeProcessor {
+	t.Helper()
+	fp := &fakeProcessor{}
+	fp.status.Store(http.StatusOK)
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			proto.Store(int32(r.ProtoMajor))
+		}
+		fp.serve(w, r)
+	})
+	if withH2C {
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	}
+	fp.server = httptest.NewServer(handler)
+	t.Cleanup(fp.server.Close)
+	return fp
+}
+
+func TestH2CProcessorCalls(t *testing.T) {
+	tests := []struct {
+		name          string
+		serverH2C     bool
+		wantProto     int32
+		wantCurrent   string
+		wantFallbacks int64
+	}{
+		{name: "h2c server", serverH2C: true, wantProto: 2, wantCurrent: protocolH2C},
+		{name: "HTTP/1.1 only server", wantProto: 1, wantCurrent: protocolHTTP1, wantFallbacks: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var proto atomic.Int32
+			cfg := testProcessorConfig(newProtoProcessor(t, tt.serverH2C, &proto), newFakeProcessor(t))
+			cfg.DefaultH2C = true
+			processor := NewPaymentProcessor(cfg, store.NewMemoryStore(store.MemoryOptions{}))
+
+			for i := range 3 {
+				result := processor.ProcessPayment(context.Background(), newTestPayment(i))
+				if !result.Success || result.ProcessorID != "default" {
+					t.Fatalf("payment %d: result %+v, want a success on the default", i, result)
+				}
+				if got := proto.Load(); got != tt.wantProto {
+					t.Fatalf("payment %d arrived over HTTP/%d, want HTTP/%d", i, got, tt.wantProto)
+				}
+			}
+
+			got := processor.ProcessorStates()[0].Protocol
+			if got.Configured != protocolH2C || got.Current != tt.wantCurrent || got.Fallbacks != tt.wantFallbacks {
+				t.Errorf("protocol = %+v, want current %s after %d fallbacks", got, tt.wantCurrent, tt.wantFallbacks)
+			}
+			if got.Confirmed != tt.serverH2C {
+				t.Errorf("confirmed = %v with an h2c server %v", got.Confirmed, tt.serverH2C)
+			}
+		})
+	}
+}
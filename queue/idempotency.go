@@ -0,0 +1,83 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+var errAlreadyStored = errors.New("payment already processed and recorded; resubmitted by the client")
+
+// canonicalHeaders normaliza os nomes uma vez, para cada chamada atribuir
+// direto no mapa de headers
+func canonicalHeaders(names []string) []string {
+	canonical := make([]string, len(names))
+	for i, name := range names {
+		canonical[i] = http.CanonicalHeaderKey(name)
+	}
+	return canonical
+}
+
+// setIdempotencyHeaders envia o correlationId nos headers de idempotência
+// do processador, para ele reconhecer uma nova tentativa do mesmo payment
+func (p *PaymentProcessor) setIdempotencyHeaders(req *http.Request, processorID string, payment *types.PaymentRequest) {
+	names := p.defaultIdempotency
+	if processorID == "fallback" {
+		names = p.fallbackIdempotency
+	}
+	for _, name := range names {
+		req.Header[name] = []string{payment.CorrelationID}
+	}
+}
+
+// isDuplicate indica se o status é a resposta de "já processado" do
+// processador (PROCESSOR_DUPLICATE_STATUSES)
+func (p *PaymentProcessor) isDuplicate(statusCode int) bool {
+	return slices.Contains(p.duplicateStatuses, int64(statusCode))
+}
+
+// duplicateResult trata a resposta de "já processado". Com o correlationId
+// nos headers de idempotência, ela vem de uma tentativa nossa que chegou ao
+// processador sem a resposta voltar (timeout, conexão caída) e conta como
+// sucesso. Se o store já tem o payment, o sucesso já foi contado: é um
+// reenvio do cliente, que falha com ClassDuplicate sem ir ao fallback.
+func (p *PaymentProcessor) duplicateResult(ctx context.Context, processorID string, payment *types.PaymentRequest, status *ProcessorStatus, statusCode int, elapsed time.Duration, m *metrics.ProcessorMetrics) *types.ProcessorResult {
+	// O processador respondeu e conhece o payment: a saúde melhora
+	status.limiter.succeeded()
+	p.callSucceeded(status)
+
+	if _, stored, err := p.paymentStore.Get(ctx, payment.CorrelationID); err == nil && stored {
+		m.Failure.Inc()
+		m.Errors.Inc(metrics.ClassDuplicate)
+		p.logFailure(ctx, payment, processorID, metrics.ClassDuplicate, statusCode, elapsed, errAlreadyStored)
+		return &types.ProcessorResult{
+			Success:     false,
+			ProcessorID: processorID,
+			Error:       errAlreadyStored,
+			Reason:      metrics.ClassDuplicate,
+			StatusCode:  statusCode,
+		}
+	}
+
+	m.Success.Inc()
+	m.Duplicates.Inc()
+	if ok, n := p.sampler.Allow("duplicate_accepted:" + processorID); ok {
+		p.logger.InfoContext(ctx, "processor already had the payment, counting it as processed",
+			logging.KeyCorrelationID, payment.CorrelationID,
+			logging.KeyProcessor, processorID,
+			logging.KeyStatus, statusCode,
+			logging.KeyOccurrences, n)
+	}
+	p.savePayment(processorID, payment, nil)
+	return &types.ProcessorResult{
+		Success:     true,
+		ProcessorID: processorID,
+		StatusCode:  statusCode,
+	}
+}
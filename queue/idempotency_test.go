@@ -0,0 +1,152 @@
+package queue
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/store"
+)
+
+func TestDuplicateStatusClassification(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int64 // nil: o padrão
+		status     int
+		stored     bool // o cliente reenvia um payment já gravado
+		wantOK     bool
+		wantReason string
+	}{
+		{name: "409 already processed", status: http.StatusConflict, wantOK: true},
+		{name: "422 is a validation rejection", status: http.StatusUnprocessableEntity, wantReason: metrics.ClassHTTP4xx},
+		{name: "422 configured as duplicate", statuses: []int64{409, 422}, status: http.StatusUnprocessableEntity, wantOK: true},
+		{name: "409 for a payment already stored", status: http.StatusConflict, stored: true, wantReason: metrics.ClassDuplicate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defaultProcessor, fallbackProcessor := newFakeProcessor(t), newFakeProcessor(t)
+			cfg := testProcessorConfig(defaultProcessor, fallbackProcessor)
+			if tt.statuses != nil {
+				cfg.DuplicateStatuses = tt.statuses
+			}
+			paymentStore := store.NewMemoryStore(store.MemoryOptions{})
+			processor := NewPaymentProcessor(cfg, paymentStore)
+			payment := newTestPayment(1)
+			if tt.stored {
+				if result := processor.ProcessPayment(context.Background(), payment); !result.Success {
+					t.Fatalf("first submission failed: %+v", result)
+				}
+			}
+			defaultProcessor.status.Store(int32(tt.status))
+			fallbackProcessor.status.Store(int32(tt.status))
+			before := processor.LocalSummary()
+			duplicates := metrics.Processor("default").Duplicates.Value()
+
+			result := processor.ProcessPayment(context.Background(), payment)
+			if result.Success != tt.wantOK || result.Reason != tt.wantReason {
+				t.Fatalf("result = success %v, reason %q; want %v, %q", result.Success, result.Reason, tt.wantOK, tt.wantReason)
+			}
+			after := processor.LocalSummary()
+			if got := after.DefaultSuccess - before.DefaultSuccess; (got == 1) != tt.wantOK {
+				t.Errorf("summary counted %d default successes", got)
+			}
+			if got := metrics.Processor("default").Duplicates.Value() - duplicates; (got == 1) != tt.wantOK {
+				t.Errorf("duplicates counter moved by %d", got)
+			}
+			if _, stored, _ := paymentStore.Get(context.Background(), payment.CorrelationID); stored != (tt.wantOK || tt.stored) {
+				t.Errorf("stored = %v after a %d", stored, tt.status)
+			}
+			// Rejeitado por validação, o fallback é tentado; já processado, não
+			wantFallback := int64(0)
+			if !tt.wantOK && !tt.stored {
+				wantFallback = 1
+			}
+			if got := fallbackProcessor.calls.Load(); got != wantFallback {
+				t.Errorf("fallback got %d calls, want %d", got, wantFallback)
+			}
+		})
+	}
+}
+
+// headerServer é um processador que guarda o header de idempotência de
+// cada chamada de payment e responde com respond
+type headerServer struct {
+	mu      sync.Mutex
+	header  string
+	values  []string
+	server  *httptest.Server
+	respond func(w http.ResponseWriter, call int)
+}
+
+func newHeaderServer(t *testing.T, header string, respond func(w http.ResponseWriter, call int)) *headerServer {
+	t.Helper()
+	s := &headerServer{header: header, respond: respond}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Write([]byte(`{"failing":false,"minResponseTime":0}`))
+			return
+		}
+		s.mu.Lock()
+		s.values = append(s.values, r.Header.Get(s.header))
+		call := len(s.values)
+		s.mu.Unlock()
+		s.respond(w, call)
+	}))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+func (s *headerServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.values...)
+}
+
+func TestIdempotencyHeaderOnRetriesAndFallback(t *testing.T) {
+	// O default derruba a conexão na 1ª chamada e responde 500 na nova
+	// tentativa; o fallback aceita, com outro nome de header
+	defaultServer := newHeaderServer(t, "X-Idempotency-Key", func(w http.ResponseWriter, call int) {
+		if call == 1 {
+			conn, _, err := http.NewResponseController(w).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	fallbackServer := newHeaderServer(t, "X-Correlation-Id", func(w http.ResponseWriter, _ int) {
+		w.Write([]byte(`{"message":"ok"}`))
+	})
+
+	cfg := DefaultProcessorConfig()
+	cfg.DefaultURL = defaultServer.server.URL + "/payments"
+	cfg.FallbackURL = fallbackServer.server.URL + "/payments"
+	cfg.Snapshot = false
+	cfg.WarmupConnections = 0
+	cfg.Retries, cfg.RetryDelay, cfg.RetryAfterSend = 1, 0, true
+	cfg.FallbackIdempotencyHeaders = []string{"X-Correlation-Id"}
+	processor := NewPaymentProcessor(cfg, store.NewMemoryStore(store.MemoryOptions{}))
+
+	payment := newTestPayment(7)
+	result := processor.ProcessPayment(context.Background(), payment)
+	if !result.Success || result.ProcessorID != "fallback" {
+		t.Fatalf("result = %+v, want a success on the fallback", result)
+	}
+
+	defaultCalls := defaultServer.received()
+	if len(defaultCalls) < 2 {
+		t.Fatalf("default got %d calls, want the first one and its retry", len(defaultCalls))
+	}
+	for i, got := range defaultCalls {
+		if got != payment.CorrelationID {
+			t.Errorf("default call %d: X-Idempotency-Key = %q, want %q", i+1, got, payment.CorrelationID)
+		}
+	}
+	if got := fallbackServer.received(); len(got) != 1 || got[0] != payment.CorrelationID {
+		t.Errorf("fallback X-Correlation-Id = %q, want one call with %q", got, payment.CorrelationID)
+	}
+}
@@ -0,0 +1,84 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/store"
+)
+
+func TestInFlightGaugesUnderSlowProcessor(t *testing.T) {
+	processor := newFakeProcessor(t)
+	processor.delay.Store(int64(100 * time.Millisecond))
+
+	const workers, payments = 4, 20
+	cfg := testPoolConfig(workers)
+	cfg.BatchSize, cfg.BatchParallelism = 1, 1
+	pool := newTestPool(t, testProcessorConfig(processor, newFakeProcessor(t)), cfg)
+
+	for i := range payments {
+		if pool.Submit(context.Background(), newTestPayment(i)) != nil {
+			t.Fatalf("Submit refused payment %d", i)
+		}
+	}
+
+	// Sobe: cada worker preso em um payment, o resto na fila
+	waitFor(t, time.Second, "every worker to take a payment", func() bool {
+		return pool.InFlight() == workers
+	})
+	if stats := pool.Stats(); stats.InFlight != workers || stats.QueueDepth != payments-workers {
+		t.Fatalf("stats: in flight %d, queue depth %d; want %d and %d", stats.InFlight, stats.QueueDepth, workers, payments-workers)
+	}
+
+	// Desce: a fila só encolhe e os em voo nunca passam dos workers
+	lastQueued := payments - workers
+	for pool.GetQueueSize() > 0 || pool.InFlight() > 0 {
+		if inFlight := pool.InFlight(); inFlight > workers || inFlight < 0 {
+			t.Fatalf("in flight = %d with %d workers", inFlight, workers)
+		}
+		queued := pool.GetQueueSize()
+		if queued > lastQueued {
+			t.Fatalf("queue depth went from %d up to %d with no new payments", lastQueued, queued)
+		}
+		lastQueued = queued
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := processor.calls.Load(); got != payments {
+		t.Errorf("processor got %d calls, want %d", got, payments)
+	}
+	if stats := pool.Stats(); stats.InFlight != 0 || stats.QueueDepth != 0 {
+		t.Errorf("stats after the drain: in flight %d, queue depth %d; want 0", stats.InFlight, stats.QueueDepth)
+	}
+}
+
+func TestInFlightSettlesAfterPanic(t *testing.T) {
+	fp := newFakeProcessor(t)
+	poison := newTestPayment(0)
+	processor := NewPaymentProcessor(testProcessorConfig(fp, newFakeProcessor(t)), store.NewMemoryStore(store.MemoryOptions{}))
+	processor.client.Transport = panicTransport{next: processor.client.Transport, poison: poison.CorrelationID}
+	cfg := testPoolConfig(2)
+	pool := NewWorkerPool(processor, NewRingBackend(cfg.QueueSize), cfg)
+	pool.Start()
+	t.Cleanup(pool.Stop)
+
+	pool.Submit(context.Background(), poison)
+	for i := 1; i <= 10; i++ {
+		pool.Submit(context.Background(), newTestPayment(i))
+	}
+	waitFor(t, 5*time.Second, "the payments after the panic", func() bool { return fp.calls.Load() == 10 })
+	waitFor(t, time.Second, "the in-flight gauge to settle", func() bool { return pool.InFlight() == 0 })
+}
+
+func TestLandCountsOnce(t *testing.T) {
+	var wp WorkerPool
+	var j Job
+	wp.takeOff(&j)
+	copied := j // o lote e o finish trabalham em cópias do job
+
+	wp.land(j)
+	wp.land(copied) // o landOnPanic depois do finish
+	if got := wp.inFlight.Load(); got != 0 {
+		t.Fatalf("in flight = %d after landing the same job twice, want 0", got)
+	}
+}
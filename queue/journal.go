@@ -0,0 +1,312 @@
+package queue
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// JournalConfig configura o journal de payments abandonados
+type JournalConfig struct {
+	Path          string
+	MaxBytes      int64         // tamanho a partir do qual o arquivo é rotacionado
+	Retain        int           // arquivos rotacionados mantidos (path.1 é o mais novo)
+	FlushInterval time.Duration // intervalo de flush do buffer para o disco
+	QueueSize     int           // linhas aguardando escrita; com a fila cheia a linha é descartada
+}
+
+// DefaultJournalConfig retorna arquivos de 10 MiB, 5 rotacionados, flush a
+// cada segundo e fila de 1024 linhas
+func DefaultJournalConfig() JournalConfig {
+	return JournalConfig{
+		MaxBytes:      10 << 20,
+		Retain:        5,
+		FlushInterval: time.Second,
+		QueueSize:     1024,
+	}
+}
+
+// JournalSink recebe as linhas do journal, já terminadas em \n. Só a
+// goroutine do journal chama seus métodos.
+type JournalSink interface {
+	Write(line []byte) error
+	Flush() error
+	Close() error
+}
+
+// failureJournal grava os payments abandonados em uma goroutine própria,
+// para o disco nunca segurar os workers
+type failureJournal struct {
+	sink     JournalSink
+	entries  chan types.FailedPayment
+	interval time.Duration
+	done     chan struct{}
+	stopOnce sync.Once
+	logger   *slog.Logger
+	sampler  *logging.Sampler
+}
+
+func newFailureJournal(sink JournalSink, cfg JournalConfig) *failureJournal {
+	def := DefaultJournalConfig()
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = def.FlushInterval
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = def.QueueSize
+	}
+
+	j := &failureJournal{
+		sink:     sink,
+		entries:  make(chan types.FailedPayment, cfg.QueueSize),
+		interval: cfg.FlushInterval,
+		done:     make(chan struct{}),
+		logger:   slog.Default(),
+		sampler:  logging.DefaultSampler(),
+	}
+	go j.run()
+	return j
+}
+
+// record agenda a linha sem bloquear; com a fila cheia ela é descartada
+func (j *failureJournal) record(entry types.FailedPayment) {
+	select {
+	case j.entries <- entry:
+	default:
+		metrics.FailureJournal.Inc(metrics.JournalDropped)
+		if ok, n := j.sampler.Allow("journal_dropped"); ok {
+			j.logger.Warn("failure journal queue full, entry dropped",
+				logging.KeyCorrelationID, entry.CorrelationID,
+				logging.KeyOccurrences, n)
+		}
+	}
+}
+
+func (j *failureJournal) run() {
+	defer close(j.done)
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case entry, ok := <-j.entries:
+			if !ok {
+				j.flush()
+				if err := j.sink.Close(); err != nil {
+					j.logger.Error("failed to close failure journal", "error", err)
+				}
+				return
+			}
+			j.write(entry)
+		case <-ticker.C:
+			j.flush()
+		}
+	}
+}
+
+func (j *failureJournal) write(entry types.FailedPayment) {
+	line, err := json.Marshal(entry)
+	if err == nil {
+		err = j.sink.Write(append(line, '\n'))
+	}
+	if err != nil {
+		j.fail("failure journal write failed, entry dropped", err)
+		return
+	}
+	metrics.FailureJournal.Inc(metrics.JournalWritten)
+}
+
+func (j *failureJournal) flush() {
+	if err := j.sink.Flush(); err != nil {
+		j.fail("failure journal flush failed", err)
+	}
+}
+
+func (j *failureJournal) fail(msg string, err error) {
+	metrics.FailureJournal.Inc(metrics.JournalError)
+	if ok, n := j.sampler.Allow("journal_error"); ok {
+		j.logger.Error(msg, "error", err, logging.KeyOccurrences, n)
+	}
+}
+
+// stop grava o que estiver na fila, faz o flush final e fecha o sink
+func (j *failureJournal) stop() {
+	j.stopOnce.Do(func() { close(j.entries) })
+	<-j.done
+}
+
+// FileJournal é o JournalSink em disco: escrita bufferizada em modo append,
+// com rotação por tamanho. Um erro de escrita descarta o buffer e o arquivo
+// é reaberto na próxima linha.
+type FileJournal struct {
+	path     string
+	maxBytes int64
+	retain   int
+	file     *os.File
+	w        *bufio.Writer
+	size     int64
+}
+
+// OpenFileJournal abre (ou cria) o arquivo do journal
+func OpenFileJournal(path string, maxBytes int64, retain int) (*FileJournal, error) {
+	j := &FileJournal{path: path, maxBytes: maxBytes, retain: retain}
+	if err := j.open(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *FileJournal) open() error {
+	f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	j.file, j.w, j.size = f, bufio.NewWriterSize(f, 64<<10), info.Size()
+	return nil
+}
+
+// Write acrescenta a linha, rotacionando antes se ela passar de maxBytes
+func (j *FileJournal) Write(line []byte) error {
+	if j.file == nil {
+		if err := j.open(); err != nil {
+			return err
+		}
+	}
+	if j.maxBytes > 0 && j.size > 0 && j.size+int64(len(line)) > j.maxBytes {
+		if err := j.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := j.w.Write(line)
+	j.size += int64(n)
+	if err != nil {
+		j.discard()
+	}
+	return err
+}
+
+// Flush envia o buffer ao disco
+func (j *FileJournal) Flush() error {
+	if j.file == nil {
+		return nil
+	}
+	if err := j.w.Flush(); err != nil {
+		j.discard()
+		return err
+	}
+	return nil
+}
+
+// Close faz o flush e fecha o arquivo
+func (j *FileJournal) Close() error {
+	if j.file == nil {
+		return nil
+	}
+	err := j.w.Flush()
+	if cerr := j.file.Close(); err == nil {
+		err = cerr
+	}
+	j.file, j.w = nil, nil
+	return err
+}
+
+// discard fecha o arquivo depois de um erro; o bufio.Writer guarda o erro
+// para sempre, então o buffer é perdido e o arquivo reaberto depois
+func (j *FileJournal) discard() {
+	j.file.Close()
+	j.file, j.w = nil, nil
+}
+
+// rotate fecha o arquivo atual e o renomeia para path.1, deslocando os
+// anteriores e apagando o que passar de retain
+func (j *FileJournal) rotate() error {
+	if err := j.Close(); err != nil {
+		return err
+	}
+
+	if err := removeIfExists(fmt.Sprintf("%s.%d", j.path, j.retain)); err != nil {
+		return err
+	}
+	for i := j.retain - 1; i >= 1; i-- {
+		if err := renameIfExists(fmt.Sprintf("%s.%d", j.path, i), fmt.Sprintf("%s.%d", j.path, i+1)); err != nil {
+			return err
+		}
+	}
+	if j.retain > 0 {
+		if err := os.Rename(j.path, j.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(j.path); err != nil {
+		return err
+	}
+	return j.open()
+}
+
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func renameIfExists(from, to string) error {
+	if err := os.Rename(from, to); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// UseFailureJournal passa a gravar em sink os payments abandonados pelos
+// workers; deve ser chamado antes de o servidor aceitar requisições
+func (wp *WorkerPool) UseFailureJournal(sink JournalSink, cfg JournalConfig) {
+	wp.journal = newFailureJournal(sink, cfg)
+}
+
+// journalFailure registra no journal um job que falhou (result) ou venceu
+// na fila (result nil); deve ser chamado antes do finish, que devolve o
+// payment ao pool
+func (wp *WorkerPool) journalFailure(j Job, outcome string, result *types.ProcessorResult) {
+	if wp.journal == nil {
+		return
+	}
+
+	entry := types.FailedPayment{
+		CorrelationID: j.Payment.CorrelationID,
+		Outcome:       outcome,
+		RequestID:     j.requestID,
+		EnqueuedAt:    j.enqueuedAt,
+		FailedAt:      time.Now().UTC(),
+		Budget:        j.exhausted,
+		History:       j.history,
+	}
+	if result != nil {
+		entry.Reason = result.Reason
+		entry.Attempts = result.Attempts
+		if result.Error != nil {
+			entry.Error = result.Error.Error()
+		}
+	}
+	payment, err := j.Payment.ToJSON()
+	if err != nil {
+		wp.journal.fail("failed to encode payment for the failure journal", err)
+		return
+	}
+	entry.Payment = payment
+	wp.journal.record(entry)
+}
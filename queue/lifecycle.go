@@ -0,0 +1,256 @@
+package queue
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/store"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// lifecycleCapacity é o número de payments acompanhados; atingido o
+// limite, o mais antigo é descartado, como no store em memória
+const lifecycleCapacity = store.DefaultCapacity
+
+// transitions lista os estados seguintes permitidos a partir de cada
+// estado. "" é o payment ainda desconhecido, que entra na fila ou, inline e
+// sync, direto em processing. failed e expired recomeçam o ciclo quando o
+// cliente reenvia o payment; succeeded é final.
+var transitions = map[string][]string{
+	"":                     {types.StatusQueued, types.StatusProcessing},
+	types.StatusQueued:     {types.StatusProcessing, types.StatusExpired},
+	types.StatusProcessing: {types.StatusSucceeded, types.StatusFailed},
+	types.StatusFailed:     {types.StatusQueued, types.StatusProcessing},
+	types.StatusExpired:    {types.StatusQueued, types.StatusProcessing},
+}
+
+// TransitionError recusa uma mudança de estado fora de transitions
+type TransitionError struct {
+	CorrelationID string
+	From          string
+	To            string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("payment %s cannot go from %s to %s", e.CorrelationID, e.From, e.To)
+}
+
+// Lifecycle acompanha o estado de cada payment desta instância. Com Redis
+// a fila é compartilhada: um payment enfileirado aqui e retirado por outra
+// instância continua queued neste Lifecycle e processing/final no da outra.
+type Lifecycle struct {
+	mu         sync.Mutex
+	entries    map[string]*lifecycleEntry
+	order      []string // ring buffer de correlationIds
+	next       int
+	queued     int
+	processing int
+	logger     *slog.Logger
+	sampler    *logging.Sampler
+}
+
+type lifecycleEntry struct {
+	status types.PaymentStatus
+	pos    int // posição no ring buffer, para o descarte não apagar um id reinserido
+}
+
+// NewLifecycle cria um acompanhamento vazio
+func NewLifecycle() *Lifecycle {
+	return &Lifecycle{
+		entries: make(map[string]*lifecycleEntry),
+		order:   make([]string, lifecycleCapacity),
+		logger:  slog.Default(),
+		sampler: logging.DefaultSampler(),
+	}
+}
+
+// Queued registra a entrada do payment na fila
+func (l *Lifecycle) Queued(id string) error {
+	return l.transition(id, types.StatusQueued, func(s *types.PaymentStatus, now time.Time) {
+		s.QueuedAt = &now
+	})
+}
+
+// Processing registra o payment assumido por um worker ou pelo
+// processamento inline/sync
+func (l *Lifecycle) Processing(id string) error {
+	return l.transition(id, types.StatusProcessing, func(s *types.PaymentStatus, now time.Time) {
+		s.ProcessingAt = &now
+	})
+}
+
+// Succeeded registra o payment aceito pelo processador
+func (l *Lifecycle) Succeeded(id, processor string) error {
+	return l.transition(id, types.StatusSucceeded, func(s *types.PaymentStatus, now time.Time) {
+		s.Processor = processor
+		s.FinishedAt = &now
+	})
+}
+
+// Failed registra o payment que falhou, com a classe da falha
+func (l *Lifecycle) Failed(id, reason string) error {
+	return l.transition(id, types.StatusFailed, func(s *types.PaymentStatus, now time.Time) {
+		s.Reason = reason
+		s.FinishedAt = &now
+	})
+}
+
+// Expired registra o payment descartado na fila por idade
+func (l *Lifecycle) Expired(id string) error {
+	return l.transition(id, types.StatusExpired, func(s *types.PaymentStatus, now time.Time) {
+		s.FinishedAt = &now
+	})
+}
+
+// enqueue registra a entrada do payment na fila, como o Queued, e retorna
+// como desfazê-la se o backend recusar o payment: um payment novo sai do
+// acompanhamento e um que recomeçava o ciclo volta ao estado anterior
+func (l *Lifecycle) enqueue(id string) (undo func(), err error) {
+	var queuedAt *time.Time
+	previous, err := l.change(id, types.StatusQueued, func(s *types.PaymentStatus, now time.Time) {
+		s.QueuedAt = &now
+		queuedAt = s.QueuedAt
+	})
+	if err != nil {
+		return nil, err
+	}
+	return func() { l.restore(id, previous, queuedAt) }, nil
+}
+
+// restore desfaz o enqueue cujo horário de entrada é queuedAt; se o
+// payment já mudou de estado desde então, nada é tocado
+func (l *Lifecycle) restore(id string, previous *types.PaymentStatus, queuedAt *time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.entries[id]
+	if !ok || entry.status.Status != types.StatusQueued || entry.status.QueuedAt != queuedAt {
+		return
+	}
+	l.count(types.StatusQueued, -1)
+	if previous == nil {
+		delete(l.entries, id)
+		return
+	}
+	l.count(previous.Status, 1)
+	entry.status = *previous
+}
+
+// transition aplica a mudança de estado se ela for permitida. Uma mudança
+// recusada deixa o estado como estava, é contada e logada, e o erro volta
+// ao chamador. Um payment desconhecido só pode começar o ciclo: os estados
+// finais de um payment já descartado do ring buffer são ignorados.
+func (l *Lifecycle) transition(id, to string, apply func(*types.PaymentStatus, time.Time)) error {
+	_, err := l.change(id, to, apply)
+	return err
+}
+
+// change é o transition, retornando também o estado anterior; nil se o
+// payment era desconhecido
+func (l *Lifecycle) change(id, to string, apply func(*types.PaymentStatus, time.Time)) (*types.PaymentStatus, error) {
+	previous, err := l.apply(id, to, apply)
+	if err != nil {
+		metrics.InvalidTransitions.Inc()
+		if ok, n := l.sampler.Allow("invalid_transition:" + to); ok {
+			l.logger.Error("invalid payment status transition",
+				logging.KeyCorrelationID, id,
+				"from", err.From,
+				"to", err.To,
+				logging.KeyOccurrences, n)
+		}
+		return nil, err
+	}
+	return previous, nil
+}
+
+func (l *Lifecycle) apply(id, to string, apply func(*types.PaymentStatus, time.Time)) (*types.PaymentStatus, *TransitionError) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.entries[id]
+	from := ""
+	if ok {
+		from = entry.status.Status
+	}
+	if !allowedTransition(from, to) {
+		if !ok {
+			return nil, nil
+		}
+		return nil, &TransitionError{CorrelationID: id, From: from, To: to}
+	}
+
+	var previous *types.PaymentStatus
+	if ok {
+		status := entry.status
+		previous = &status
+	} else {
+		entry = l.insert(id)
+	}
+	// queued, ou processing sem passar pela fila, começa um novo ciclo
+	if to == types.StatusQueued || (to == types.StatusProcessing && from != types.StatusQueued) {
+		entry.status = types.PaymentStatus{}
+	}
+	l.count(from, -1)
+	l.count(to, 1)
+	entry.status.Status = to
+	apply(&entry.status, time.Now().UTC())
+	return previous, nil
+}
+
+// insert ocupa a próxima posição do ring buffer, descartando o payment
+// mais antigo quando ele está cheio
+func (l *Lifecycle) insert(id string) *lifecycleEntry {
+	if old := l.order[l.next]; old != "" {
+		if e, ok := l.entries[old]; ok && e.pos == l.next {
+			l.count(e.status.Status, -1)
+			delete(l.entries, old)
+		}
+	}
+
+	entry := &lifecycleEntry{pos: l.next}
+	l.entries[id] = entry
+	l.order[l.next] = id
+	l.next = (l.next + 1) % len(l.order)
+	return entry
+}
+
+func (l *Lifecycle) count(status string, delta int) {
+	switch status {
+	case types.StatusQueued:
+		l.queued += delta
+	case types.StatusProcessing:
+		l.processing += delta
+	}
+}
+
+// Get retorna o estado atual do payment
+func (l *Lifecycle) Get(id string) (types.PaymentStatus, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.entries[id]
+	if !ok {
+		return types.PaymentStatus{}, false
+	}
+	return entry.status, true
+}
+
+// Unfinished retorna quantos payments estão na fila e em processamento
+func (l *Lifecycle) Unfinished() (queued, processing int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.queued, l.processing
+}
+
+func allowedTransition(from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
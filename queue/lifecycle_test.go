@@ -0,0 +1,189 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// moveTo leva o payment id até status pelo caminho permitido
+func moveTo(t *testing.T, l *Lifecycle, id, status string) {
+	t.Helper()
+	steps := map[string][]func() error{
+		"":                     nil,
+		types.StatusQueued:     {func() error { return l.Queued(id) }},
+		types.StatusProcessing: {func() error { return l.Queued(id) }, func() error { return l.Processing(id) }},
+		types.StatusSucceeded:  {func() error { return l.Queued(id) }, func() error { return l.Processing(id) }, func() error { return l.Succeeded(id, "default") }},
+		types.StatusFailed:     {func() error { return l.Queued(id) }, func() error { return l.Processing(id) }, func() error { return l.Failed(id, metrics.ClassTimeout) }},
+		types.StatusExpired:    {func() error { return l.Queued(id) }, func() error { return l.Expired(id) }},
+	}
+	for _, step := range steps[status] {
+		if err := step(); err != nil {
+			t.Fatalf("moving %s to %s: %v", id, status, err)
+		}
+	}
+}
+
+func TestLifecycleTransitions(t *testing.T) {
+	statuses := []string{"", types.StatusQueued, types.StatusProcessing, types.StatusSucceeded, types.StatusFailed, types.StatusExpired}
+	for _, from := range statuses {
+		for _, to := range statuses[1:] {
+			name := from
+			if name == "" {
+				name = "unknown"
+			}
+			t.Run(name+"->"+to, func(t *testing.T) {
+				l := NewLifecycle()
+				moveTo(t, l, "p", from)
+				before, _ := l.Get("p")
+				invalid := metrics.InvalidTransitions.Value()
+
+				var err error
+				switch to {
+				case types.StatusQueued:
+					err = l.Queued("p")
+				case types.StatusProcessing:
+					err = l.Processing("p")
+				case types.StatusSucceeded:
+					err = l.Succeeded("p", "fallback")
+				case types.StatusFailed:
+					err = l.Failed("p", metrics.ClassHTTP5xx)
+				case types.StatusExpired:
+					err = l.Expired("p")
+				}
+
+				got, tracked := l.Get("p")
+				switch {
+				case allowedTransition(from, to):
+					if err != nil || got.Status != to {
+						t.Fatalf("allowed transition: err %v, status %q", err, got.Status)
+					}
+				case from == "":
+					// Um desfecho de um payment já descartado é ignorado
+					if err != nil || tracked {
+						t.Fatalf("unknown payment: err %v, tracked %v", err, tracked)
+					}
+				default:
+					var transition *TransitionError
+					if !errors.As(err, &transition) || transition.From != from || transition.To != to || transition.CorrelationID != "p" {
+						t.Fatalf("err = %v, want a TransitionError from %s to %s", err, from, to)
+					}
+					if got.Status != before.Status || got.Reason != before.Reason || got.Processor != before.Processor {
+						t.Errorf("status changed from %+v to %+v on a refused transition", before, got)
+					}
+					if metrics.InvalidTransitions.Value() != invalid+1 {
+						t.Errorf("refused transition not counted")
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestLifecycleCountsUnfinished(t *testing.T) {
+	l := NewLifecycle()
+	moveTo(t, l, "a", types.StatusQueued)
+	moveTo(t, l, "b", types.StatusProcessing)
+	moveTo(t, l, "c", types.StatusSucceeded)
+	if queued, processing := l.Unfinished(); queued != 1 || processing != 1 {
+		t.Fatalf("unfinished = %d queued, %d processing; want 1 and 1", queued, processing)
+	}
+
+	// Recusadas, as transições não mexem nas contagens
+	l.Queued("b")
+	l.Processing("c")
+	if queued, processing := l.Unfinished(); queued != 1 || processing != 1 {
+		t.Fatalf("after refused transitions: %d queued, %d processing; want 1 and 1", queued, processing)
+	}
+}
+
+func TestLifecycleEnqueueUndo(t *testing.T) {
+	l := NewLifecycle()
+
+	// Payment novo: o undo o tira do acompanhamento
+	undo, err := l.enqueue("new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	undo()
+	if _, tracked := l.Get("new"); tracked {
+		t.Error("new payment still tracked after the undo")
+	}
+
+	// Reenvio de um failed: o undo devolve o failed, com a classe da falha
+	moveTo(t, l, "retry", types.StatusFailed)
+	failed, _ := l.Get("retry")
+	undo, err = l.enqueue("retry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	undo()
+	if got, _ := l.Get("retry"); got.Status != types.StatusFailed || got.Reason != failed.Reason || got.FinishedAt != failed.FinishedAt {
+		t.Errorf("after the undo: %+v, want the failed status back %+v", got, failed)
+	}
+
+	// Depois de um worker assumir o payment, o undo não toca nele
+	undo, _ = l.enqueue("taken")
+	l.Processing("taken")
+	undo()
+	if got, _ := l.Get("taken"); got.Status != types.StatusProcessing {
+		t.Errorf("status = %q after a late undo, want processing", got.Status)
+	}
+	if queued, processing := l.Unfinished(); queued != 0 || processing != 1 {
+		t.Errorf("unfinished = %d queued, %d processing; want 0 and 1", queued, processing)
+	}
+}
+
+func TestSubmitRefusesTrackedPayment(t *testing.T) {
+	processor := newFakeProcessor(t)
+	processor.delay.Store(int64(200 * time.Millisecond))
+	cfg := testPoolConfig(1)
+	cfg.QueueSize = 1
+	cfg.BatchSize, cfg.BatchParallelism = 1, 1
+	pool := newTestPool(t, testProcessorConfig(processor, newFakeProcessor(t)), cfg)
+
+	// Os ids são copiados: processado, o payment volta ao pool
+	processing := newTestPayment(1).CorrelationID
+	if err := pool.Submit(context.Background(), newTestPayment(1)); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, time.Second, "the worker to take the payment", func() bool { return pool.InFlight() == 1 })
+
+	// Reenviado em processamento: recusado sem entrar na fila nem mexer no estado
+	var transition *TransitionError
+	if err := pool.Submit(context.Background(), newTestPayment(1)); !errors.As(err, &transition) {
+		t.Fatalf("resubmitting a processing payment = %v, want a TransitionError", err)
+	}
+	if got, _ := pool.Lifecycle().Get(processing); got.Status != types.StatusProcessing {
+		t.Errorf("status = %q, want processing", got.Status)
+	}
+
+	// Fila cheia: o reenvio de um failed volta a failed, o processing fica
+	queued := newTestPayment(2).CorrelationID
+	if err := pool.Submit(context.Background(), newTestPayment(2)); err != nil {
+		t.Fatal(err)
+	}
+	moveTo(t, pool.Lifecycle(), "failed-before", types.StatusFailed)
+	if err := pool.Submit(context.Background(), &types.PaymentRequest{CorrelationID: "failed-before", Amount: 100}); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("submit with the queue full = %v, want ErrQueueFull", err)
+	}
+	if got, _ := pool.Lifecycle().Get("failed-before"); got.Status != types.StatusFailed {
+		t.Errorf("status = %q after the queue refused the resubmission, want failed", got.Status)
+	}
+	if queued, processing := pool.Lifecycle().Unfinished(); queued != 1 || processing != 1 {
+		t.Errorf("unfinished = %d queued, %d processing; want 1 and 1", queued, processing)
+	}
+
+	waitFor(t, 2*time.Second, "both payments to finish", func() bool {
+		first, _ := pool.Lifecycle().Get(processing)
+		second, _ := pool.Lifecycle().Get(queued)
+		return first.Status == types.StatusSucceeded && second.Status == types.StatusSucceeded
+	})
+	if got := processor.calls.Load(); got != 2 {
+		t.Errorf("processor got %d calls, want each payment once", got)
+	}
+}
@@ -0,0 +1,163 @@
+package queue
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// Estados manuais de um processador; OverrideAuto devolve o controle ao
+// circuit breaker e aos health checks
+const (
+	OverrideAuto int64 = iota
+	OverrideHealthy
+	OverrideUnhealthy
+)
+
+var overrideNames = map[int64]string{
+	OverrideAuto:      "auto",
+	OverrideHealthy:   "healthy",
+	OverrideUnhealthy: "unhealthy",
+}
+
+// Erros do SetOverride
+var (
+	ErrUnknownProcessor = errors.New("unknown processor")
+	ErrInvalidState     = errors.New(`state must be "healthy", "unhealthy" or "auto"`)
+)
+
+// Healthy indica se o processador recebe tráfego: o estado manual, se
+// houver, vale antes do calculado pelo circuit breaker e pelos health checks
+func (s *ProcessorStatus) Healthy() bool {
+	switch atomic.LoadInt64(&s.Override) {
+	case OverrideHealthy:
+		return true
+	case OverrideUnhealthy:
+		return false
+	}
+	return atomic.LoadInt64(&s.IsHealthy) == 1
+}
+
+// AnyHealthy indica se algum processador recebe tráfego
+func (p *PaymentProcessor) AnyHealthy() bool {
+	return p.defaultStatus.Healthy() || p.fallbackStatus.Healthy()
+}
+
+// BreakerOpen indica se o circuit breaker abriu pela taxa de falhas na
+// janela
+func (s *ProcessorStatus) BreakerOpen() bool {
+	return s.breaker.open.Load()
+}
+
+// status retorna o status do processador pelo nome
+func (p *PaymentProcessor) status(name string) (*ProcessorStatus, bool) {
+	switch name {
+	case "default":
+		return p.defaultStatus, true
+	case "fallback":
+		return p.fallbackStatus, true
+	}
+	return nil, false
+}
+
+// SetOverride fixa o estado do processador ("healthy" ou "unhealthy") ou o
+// devolve ao cálculo automático ("auto"). O estado automático continua
+// sendo atualizado por baixo, então "auto" volta já com o estado recente.
+// Vale só para esta instância e até o restart.
+func (p *PaymentProcessor) SetOverride(name, state string) (types.ProcessorState, error) {
+	status, ok := p.status(name)
+	if !ok {
+		return types.ProcessorState{}, ErrUnknownProcessor
+	}
+
+	override, ok := parseOverride(state)
+	if !ok {
+		return types.ProcessorState{}, ErrInvalidState
+	}
+
+	previous := atomic.SwapInt64(&status.Override, override)
+	p.logger.Warn("processor state override changed",
+		logging.KeyProcessor, name,
+		"from", overrideNames[previous],
+		"to", state)
+
+	return p.processorState(name, status), nil
+}
+
+func parseOverride(state string) (int64, bool) {
+	switch state {
+	case "auto":
+		return OverrideAuto, true
+	case "healthy":
+		return OverrideHealthy, true
+	case "unhealthy":
+		return OverrideUnhealthy, true
+	}
+	return 0, false
+}
+
+// ProcessorStates retorna o estado efetivo de cada processador e se ele
+// foi fixado manualmente
+func (p *PaymentProcessor) ProcessorStates() []types.ProcessorState {
+	return []types.ProcessorState{
+		p.processorState("default", p.defaultStatus),
+		p.processorState("fallback", p.fallbackStatus),
+	}
+}
+
+func (p *PaymentProcessor) processorState(name string, status *ProcessorStatus) types.ProcessorState {
+	override := atomic.LoadInt64(&status.Override)
+	return types.ProcessorState{
+		Name:           name,
+		Healthy:        status.Healthy(),
+		Manual:         override != OverrideAuto,
+		Override:       overrideNames[override],
+		AutoHealthy:    atomic.LoadInt64(&status.IsHealthy) == 1,
+		BreakerOpen:    status.BreakerOpen(),
+		Breaker:        status.breaker.stats(),
+		ResponseTimeMs: atomic.LoadInt64(&status.ResponseTimeMs),
+		TimeoutMs:      status.timeout.get().Milliseconds(),
+		RateLimit:      status.limiter.stats(),
+		Connections:    status.conns.stats(),
+		ClockSkew:      status.skew.stats(p.skewSource() == status),
+		Protocol:       status.protocol.stats(),
+		Replicas:       status.replicas.stats(),
+		Retries:        metrics.Processor(name).Retries.Values(),
+	}
+}
+
+// ProcessorHealth retorna a saúde de cada processador para o
+// GET /health?detail=true, lida dos mesmos campos que o roteamento e o
+// HealthChecker usam
+func (p *PaymentProcessor) ProcessorHealth() []types.ProcessorHealth {
+	return []types.ProcessorHealth{
+		p.processorHealth("default", p.defaultStatus),
+		p.processorHealth("fallback", p.fallbackStatus),
+	}
+}
+
+func (p *PaymentProcessor) processorHealth(name string, status *ProcessorStatus) types.ProcessorHealth {
+	health := types.ProcessorHealth{
+		Name:      name,
+		Healthy:   status.Healthy(),
+		Breaker:   "closed",
+		LatencyMs: atomic.LoadInt64(&status.ResponseTimeMs),
+	}
+	if status.BreakerOpen() {
+		health.Breaker = "open"
+	}
+	_, health.FailureCount = status.breaker.counts(time.Now().Unix())
+	if checked := atomic.LoadInt64(&status.LastCheckTime); checked != 0 {
+		at := time.Unix(checked, 0).UTC()
+		health.LastCheckAt = &at
+	}
+	if next, ok := p.nextProbe(status); ok {
+		next = next.UTC()
+		health.NextProbeAt = &next
+	}
+	return health
+}
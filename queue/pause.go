@@ -0,0 +1,155 @@
+package queue
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// pauseGate segura os workers enquanto o processamento está pausado. Os
+// channels são trocados a cada mudança: pausing é fechado ao pausar, para
+// acordar os workers parados na fila, e resumed ao retomar.
+type pauseGate struct {
+	mu          sync.Mutex
+	paused      atomic.Bool
+	since       time.Time
+	totalPaused time.Duration
+	pausing     chan struct{}
+	resumed     chan struct{}
+	resumedAt   time.Time
+	slots       int64 // workers já liberados desde a última retomada
+}
+
+func newPauseGate() *pauseGate {
+	return &pauseGate{pausing: make(chan struct{})}
+}
+
+// state retorna, sob o lock, se está pausado e os channels da fase atual
+func (g *pauseGate) state() (paused bool, pausing, resumed <-chan struct{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused.Load(), g.pausing, g.resumed
+}
+
+// nextSlot reserva a próxima posição na rampa da retomada atual
+func (g *pauseGate) nextSlot() (slot int64, resumedAt time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	slot = g.slots
+	g.slots++
+	return slot, g.resumedAt
+}
+
+// Pause faz os workers pararem de retirar payments da fila; os lotes em
+// andamento terminam. A fila continua aceitando até a capacidade e o health
+// check dos processadores segue rodando. Retorna false se já estava pausado.
+func (wp *WorkerPool) Pause() bool {
+	g := wp.pause
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.paused.Load() {
+		return false
+	}
+	g.paused.Store(true)
+	g.since = time.Now()
+	g.resumed = make(chan struct{})
+	close(g.pausing)
+
+	wp.logger.Warn("payment processing paused",
+		logging.KeyQueueDepth, wp.backend.Len())
+	return true
+}
+
+// Resume libera os workers aos poucos ao longo de ResumeRamp, para o
+// backlog acumulado não chegar de uma vez ao processador. Retorna false se
+// não estava pausado.
+func (wp *WorkerPool) Resume() bool {
+	g := wp.pause
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.paused.Load() {
+		return false
+	}
+	pausedFor := time.Since(g.since)
+	g.totalPaused += pausedFor
+	g.paused.Store(false)
+	g.resumedAt = time.Now()
+	g.slots = 0
+	g.pausing = make(chan struct{})
+	close(g.resumed)
+
+	wp.logger.Info("payment processing resumed",
+		"paused_ms", pausedFor.Milliseconds(),
+		logging.KeyQueueDepth, wp.backend.Len(),
+		"ramp_ms", wp.config.ResumeRamp.Milliseconds())
+	return true
+}
+
+// Paused indica se o processamento está pausado
+func (wp *WorkerPool) Paused() bool {
+	return wp.pause.paused.Load()
+}
+
+// PauseStats retorna o estado da pausa, o tempo pausado e o backlog atual
+func (wp *WorkerPool) PauseStats() types.PauseStats {
+	g := wp.pause
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	stats := types.PauseStats{
+		Paused:  g.paused.Load(),
+		Backlog: wp.backend.Len(),
+	}
+	total := g.totalPaused
+	if stats.Paused {
+		since := g.since.UTC()
+		current := time.Since(g.since)
+		stats.PausedSince = &since
+		stats.PausedMs = current.Milliseconds()
+		total += current
+	}
+	stats.TotalPausedMs = total.Milliseconds()
+	return stats
+}
+
+// awaitResume bloqueia o worker até a retomada e então espera a sua vez na
+// rampa. Retorna false quando o worker deve terminar: pool parando ou
+// pedido de parada do autoscaling.
+func (wp *WorkerPool) awaitResume(resumed <-chan struct{}) bool {
+	select {
+	case <-wp.ctx.Done():
+		return false
+	case <-wp.stop:
+		return false
+	case <-resumed:
+	}
+
+	// Cada worker liberado entra um passo depois do anterior, então o pool
+	// inteiro volta em ResumeRamp
+	ramp := wp.config.ResumeRamp
+	workers := int64(wp.workers.Load())
+	if ramp <= 0 || workers <= 1 {
+		return true
+	}
+	slot, resumedAt := wp.pause.nextSlot()
+	delay := time.Duration(slot)*(ramp/time.Duration(workers)) - time.Since(resumedAt)
+	if delay <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-wp.ctx.Done():
+		return false
+	case <-wp.stop:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,79 @@
+package queue
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// payloadPool reaproveita os corpos das chamadas aos processadores
+var payloadPool = sync.Pool{
+	New: func() any { return new(payloadBody) },
+}
+
+// payloadBody é o corpo JSON de uma chamada ao processador. O Transport
+// fecha o corpo quando termina de enviá-lo, inclusive em erros e às vezes
+// depois do Do retornar; só então o buffer volta ao pool.
+type payloadBody struct {
+	reader bytes.Reader
+	buf    bytes.Buffer
+	closed atomic.Bool
+}
+
+// newPayloadBody serializa o payment em um corpo do pool
+func newPayloadBody(payment *types.PaymentRequest) (*payloadBody, error) {
+	body := payloadPool.Get().(*payloadBody)
+	body.buf.Reset()
+	body.closed.Store(false)
+
+	data, err := payment.AppendProcessorJSON(body.buf.AvailableBuffer())
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	body.buf.Write(data)
+	body.reader.Reset(body.buf.Bytes())
+	return body, nil
+}
+
+// newBulkPayloadBody serializa os payments como um array JSON
+func newBulkPayloadBody(payments []*types.PaymentRequest) (*payloadBody, error) {
+	body := payloadPool.Get().(*payloadBody)
+	body.buf.Reset()
+	body.closed.Store(false)
+
+	data := append(body.buf.AvailableBuffer(), '[')
+	for i, payment := range payments {
+		if i > 0 {
+			data = append(data, ',')
+		}
+		var err error
+		if data, err = payment.AppendProcessorJSON(data); err != nil {
+			body.Close()
+			return nil, err
+		}
+	}
+	body.buf.Write(append(data, ']'))
+	body.reader.Reset(body.buf.Bytes())
+	return body, nil
+}
+
+// Read lê o JSON serializado
+func (b *payloadBody) Read(p []byte) (int, error) {
+	return b.reader.Read(p)
+}
+
+// Len retorna quantos bytes ainda não foram lidos
+func (b *payloadBody) Len() int {
+	return b.reader.Len()
+}
+
+// Close devolve o corpo ao pool; chamadas repetidas são ignoradas
+func (b *payloadBody) Close() error {
+	if b.closed.CompareAndSwap(false, true) {
+		payloadPool.Put(b)
+	}
+	return nil
+}
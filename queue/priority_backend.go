@@ -0,0 +1,189 @@
+package queue
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxHighStreak limita quantos jobs de alta prioridade seguidos passam na
+// frente de um de baixa que está esperando
+const maxHighStreak = 8
+
+// PriorityBackend é a fila em memória com duas classes: payments com amount
+// a partir de threshold (em centavos) saem antes dos demais. Para a baixa
+// prioridade não ficar parada sob backlog, um job de baixa sai quando
+// espera há mais de maxWait ou depois de maxHighStreak jobs de alta seguidos.
+type PriorityBackend struct {
+	high      chan Job
+	low       chan Job
+	out       chan Job
+	threshold int
+	maxWait   time.Duration
+	capacity  int
+	length    atomic.Int64 // jobs aceitos ainda não entregues, nas duas classes
+	room      atomic.Pointer[roomSignal]
+	done      chan struct{}
+	closeOnce sync.Once
+	held      []Job // jobs retirados pelo dispatcher e não entregues até o Close
+}
+
+// NewPriorityBackend cria a fila com prioridade; capacity vale para as duas
+// classes somadas
+func NewPriorityBackend(capacity, threshold int, maxWait time.Duration) *PriorityBackend {
+	b := &PriorityBackend{
+		high:      make(chan Job, capacity),
+		low:       make(chan Job, capacity),
+		out:       make(chan Job),
+		threshold: threshold,
+		maxWait:   maxWait,
+		capacity:  capacity,
+		done:      make(chan struct{}),
+	}
+	go b.dispatch()
+	return b
+}
+
+// Push enfileira na classe do payment sem bloquear
+func (b *PriorityBackend) Push(job Job) bool {
+	if b.length.Add(1) > int64(b.capacity) {
+		b.length.Add(-1)
+		return false // fila cheia
+	}
+
+	queue := b.low
+	if job.Payment.Amount >= b.threshold {
+		queue = b.high
+	}
+
+	select {
+	case queue <- job:
+		return true
+	default:
+		b.length.Add(-1)
+		return false
+	}
+}
+
+// dispatch entrega os jobs aos workers pelo channel sem buffer, então a
+// escolha da classe acontece no momento em que um worker está livre
+func (b *PriorityBackend) dispatch() {
+	defer close(b.out)
+
+	var high, low *Job
+	streak := 0
+
+	for {
+		if high == nil {
+			high = tryReceive(b.high)
+		}
+		if low == nil {
+			low = tryReceive(b.low)
+		}
+
+		// Fila vazia: bloquear até chegar algo
+		if high == nil && low == nil {
+			select {
+			case job := <-b.high:
+				high = &job
+			case job := <-b.low:
+				low = &job
+			case <-b.done:
+				b.hold(high, low)
+				return
+			}
+			continue
+		}
+
+		takeLow := low != nil &&
+			(high == nil || streak >= maxHighStreak || time.Since(low.enqueuedAt) >= b.maxWait)
+		job := high
+		if takeLow {
+			job = low
+		}
+
+		select {
+		case b.out <- *job:
+			// A vaga só abre aqui, depois de o worker já ter recebido o job
+			b.length.Add(-1)
+			if room := b.room.Load(); room != nil {
+				room.notify()
+			}
+			if takeLow {
+				low, streak = nil, 0
+			} else {
+				high = nil
+				if low != nil {
+					streak++ // só conta enquanto há um job de baixa esperando
+				}
+			}
+		case <-b.done:
+			b.hold(high, low)
+			return
+		}
+	}
+}
+
+// notifyRoom registra o aviso de vaga do pool
+func (b *PriorityBackend) notifyRoom(room *roomSignal) {
+	b.room.Store(room)
+}
+
+// hold guarda os jobs que o dispatcher tinha em mãos ao parar, para o Drain
+func (b *PriorityBackend) hold(jobs ...*Job) {
+	for _, job := range jobs {
+		if job != nil {
+			b.held = append(b.held, *job)
+		}
+	}
+}
+
+// tryReceive recebe de ch sem bloquear
+func tryReceive(ch chan Job) *Job {
+	select {
+	case job := <-ch:
+		return &job
+	default:
+		return nil
+	}
+}
+
+// Deliveries retorna o channel alimentado pelo dispatcher
+func (b *PriorityBackend) Deliveries() <-chan Job {
+	return b.out
+}
+
+// Ack não faz nada: itens em memória não são reentregues
+func (b *PriorityBackend) Ack(job Job) {}
+
+// Len retorna os jobs aguardando nas duas classes
+func (b *PriorityBackend) Len() int {
+	return int(b.length.Load())
+}
+
+// Cap retorna a capacidade somada das duas classes
+func (b *PriorityBackend) Cap() int {
+	return b.capacity
+}
+
+// Close para o dispatcher, que fecha o channel de entrega
+func (b *PriorityBackend) Close() {
+	b.closeOnce.Do(func() { close(b.done) })
+}
+
+// Drain retorna os jobs que ficaram na fila; só depois do Close e com os
+// workers parados. O fechamento do channel de entrega garante que o
+// dispatcher já guardou os que tinha em mãos.
+func (b *PriorityBackend) Drain() []Job {
+	var jobs []Job
+	for job := range b.out {
+		jobs = append(jobs, job)
+	}
+	jobs = append(jobs, b.held...)
+	for _, queue := range []chan Job{b.high, b.low} {
+		for job := tryReceive(queue); job != nil; job = tryReceive(queue) {
+			jobs = append(jobs, *job)
+		}
+	}
+	return jobs
+}
@@ -0,0 +1,131 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+// threshold de teste: amount a partir de 1000 centavos é de alta prioridade
+const testPriorityThreshold = 1000
+
+// priorityJob cria um job de alta ou baixa prioridade; o correlationId
+// identifica a ordem de entrada
+func priorityJob(i int, high bool) Job {
+	payment := newTestPayment(i)
+	if high {
+		payment.Amount = testPriorityThreshold
+	}
+	return Job{Payment: payment, enqueuedAt: time.Now()}
+}
+
+// deliveries retira n jobs e retorna seus correlationIds na ordem de saída
+func deliveries(t *testing.T, b *PriorityBackend, n int) []string {
+	t.Helper()
+	ids := make([]string, n)
+	for i := range ids {
+		select {
+		case job := <-b.Deliveries():
+			ids[i] = job.Payment.CorrelationID
+		case <-time.After(time.Second):
+			t.Fatalf("only %d of %d jobs delivered", i, n)
+		}
+	}
+	return ids
+}
+
+// position retorna o índice do payment i nos ids entregues
+func position(ids []string, i int) int {
+	id := newTestPayment(i).CorrelationID
+	for pos, got := range ids {
+		if got == id {
+			return pos
+		}
+	}
+	return -1
+}
+
+func TestPriorityBackendOrdersMixedLoad(t *testing.T) {
+	b := NewPriorityBackend(100, testPriorityThreshold, time.Hour)
+	t.Cleanup(b.Close)
+
+	// Pares, alta; ímpares, baixa, intercalados na entrada
+	for i := range 10 {
+		if !b.Push(priorityJob(i, i%2 == 0)) {
+			t.Fatalf("Push refused job %d", i)
+		}
+	}
+	if got := b.Len(); got != 10 {
+		t.Errorf("Len() = %d, want 10 across both classes", got)
+	}
+
+	ids := deliveries(t, b, 10)
+	for want, i := range []int{0, 2, 4, 6, 8, 1, 3, 5, 7, 9} {
+		if got := position(ids, i); got != want {
+			t.Fatalf("payment %d delivered at %d, want %d (order %v)", i, got, want, ids)
+		}
+	}
+	// O dispatcher desconta a entrega logo depois de o worker receber
+	waitFor(t, time.Second, "Len() to reach 0", func() bool { return b.Len() == 0 })
+}
+
+func TestPriorityBackendStreakLetsLowThrough(t *testing.T) {
+	b := NewPriorityBackend(100, testPriorityThreshold, time.Hour)
+	t.Cleanup(b.Close)
+
+	b.Push(priorityJob(0, false))
+	for i := 1; i <= 3*maxHighStreak; i++ {
+		b.Push(priorityJob(i, true))
+	}
+
+	// O job de baixa espera no máximo maxHighStreak de alta seguidos (mais
+	// um que o dispatcher já tenha em mãos)
+	ids := deliveries(t, b, 3*maxHighStreak+1)
+	if pos := position(ids, 0); pos < 0 || pos > maxHighStreak+1 {
+		t.Fatalf("low priority job delivered at %d behind a backlog of high ones, want at most %d", pos, maxHighStreak+1)
+	}
+}
+
+func TestPriorityBackendAgingLetsLowThrough(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		maxWait time.Duration
+		want    int // posição do job de baixa
+	}{
+		{"without aging", time.Hour, 3},
+		{"aged past max wait", 20 * time.Millisecond, 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewPriorityBackend(100, testPriorityThreshold, tt.maxWait)
+			t.Cleanup(b.Close)
+
+			for i := range 3 {
+				b.Push(priorityJob(i, true))
+			}
+			b.Push(priorityJob(3, false))
+			time.Sleep(40 * time.Millisecond)
+
+			// O primeiro de alta já estava com o dispatcher; depois dele o
+			// de baixa vencido passa na frente dos outros dois
+			if pos := position(deliveries(t, b, 4), 3); pos != tt.want {
+				t.Fatalf("low priority job delivered at %d, want %d", pos, tt.want)
+			}
+		})
+	}
+}
+
+func TestPriorityBackendCapacitySpansClasses(t *testing.T) {
+	b := NewPriorityBackend(4, testPriorityThreshold, time.Hour)
+	t.Cleanup(b.Close)
+
+	for i := range 4 {
+		if !b.Push(priorityJob(i, i < 2)) {
+			t.Fatalf("Push refused job %d below capacity", i)
+		}
+	}
+	if b.Push(priorityJob(4, true)) || b.Push(priorityJob(5, false)) {
+		t.Fatal("Push accepted a job beyond the capacity of both classes together")
+	}
+	if got := b.Len(); got != 4 {
+		t.Errorf("Len() = %d, want 4", got)
+	}
+}
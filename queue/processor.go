@@ -1,268 +1,1055 @@
 package queue
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/store"
+	"github.com/yurimachados/rinha-backend-go/tracing"
 	"github.com/yurimachados/rinha-backend-go/types"
 )
 
 // ProcessorStatus representa o status de um processador
 type ProcessorStatus struct {
-	IsHealthy      int64 // usar atomic para thread-safety
-	FailureCount   int64
-	LastCheckTime  int64
-	ResponseTimeMs int64
+	IsHealthy       int64 // usar atomic para thread-safety
+	LastCheckTime   int64
+	ResponseTimeMs  int64
+	MinResponseTime int64 // informado pelo service-health
+	Override        int64 // estado manual (OverrideAuto, OverrideHealthy, OverrideUnhealthy)
+
+	breaker   *failureBreaker
+	lastProbe atomic.Int64      // Unix ns do último ping do HealthChecker
+	timeout   *processorTimeout // prazo das chamadas de payment
+	limiter   *processorLimiter // rate limit das chamadas de payment; nil desligado
+	conns     *connStats        // pool de conexões; nil sem PROCESSOR_CONN_METRICS
+	protocol  *h2cRoute         // h2c das chamadas; nil em HTTP/1.1
+	replicas  *replicaSet       // URLs do processador
+	skew      *clockSkew        // desvio do relógio pelo header Date
 }
 
 // PaymentProcessor gerencia o processamento de payments
 type PaymentProcessor struct {
-	defaultURL   string
-	fallbackURL  string
-	client       *http.Client
+	client         *http.Client
+	healthInterval time.Duration
+	defaultAuth    http.Header // token e headers extras de cada processador (opcional)
+	fallbackAuth   http.Header
 	defaultStatus  *ProcessorStatus
 	fallbackStatus *ProcessorStatus
-	
+	paymentStore   store.Store
+	shared         *store.SharedSummary // opcional, contadores via Redis
+	defaultBulk    *bulkEndpoint        // opcional, endpoint de lote
+	fallbackBulk   *bulkEndpoint
+	bulkSize       int
+	timeoutPolicy  *timeoutPolicy // nil com o prazo fixo
+	dns            *dnsCache      // nil sem DNS_CACHE_TTL_MS
+	chaos          *chaosLayer    // nil sem CHAOS (e sempre sem -tags chaos)
+	exchanges      *exchangeLog
+	protocol       *protocolTransport // nil sem h2c; fica por dentro das outras camadas do client
+	routes         *router            // ordem de tentativa por type (ROUTING_RULES)
+	shadow         *shadowMirror      // cópias ao fallback dos aceitos pelo default (SHADOW_PERCENT)
+	warmupConns    int
+	warmupTimeout  time.Duration
+	retry          retryPolicy
+	receipts       receiptPolicy
+	skewCorrection bool // soma o desvio de relógio estimado ao requestedAt
+	logger         *slog.Logger
+	sampler        *logging.Sampler
+
+	// Headers que levam o correlationId e status de "já processado"
+	defaultIdempotency  []string
+	fallbackIdempotency []string
+	duplicateStatuses   []int64
+
 	// Estatísticas atômicas
 	totalPayments   int64
 	defaultSuccess  int64
 	fallbackSuccess int64
 	totalErrors     int64
+	totalExpired    int64
+	defaultAmount   int64 // somas na moeda padrão
+	fallbackAmount  int64
+	expiredAmount   int64
+
+	currencyMu sync.Mutex
+	currencies map[string]types.CurrencyAmounts // somas nas demais moedas
+
+	resetMu   sync.Mutex                  // serializa os resets e a restauração do snapshot
+	window    atomic.Pointer[statsWindow] // início da janela do summary
+	snapshots *snapshotter                // nil sem SUMMARY_SNAPSHOT
+
+	amountBounds []int64
+	amounts      atomic.Pointer[processorAmounts] // trocado por um vazio no reset
 }
 
 // NewPaymentProcessor cria um novo processador otimizado
-func NewPaymentProcessor(defaultURL, fallbackURL string) *PaymentProcessor {
-	return &PaymentProcessor{
-		defaultURL:   defaultURL,
-		fallbackURL:  fallbackURL,
+func NewPaymentProcessor(cfg ProcessorConfig, paymentStore store.Store) *PaymentProcessor {
+	now := time.Now()
+	policy := newTimeoutPolicy(cfg)
+	clientTimeout := cfg.Timeout
+	if policy != nil {
+		// O prazo de cada chamada vem do contexto; o client só limita ao teto
+		clientTimeout = policy.max
+	}
+
+	transport := &http.Transport{
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: maxIdleConnsPerHost,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	defaultReplicas := newReplicaSet("default", append([]string{cfg.DefaultURL}, cfg.DefaultReplicaURLs...))
+	fallbackReplicas := newReplicaSet("fallback", append([]string{cfg.FallbackURL}, cfg.FallbackReplicaURLs...))
+
+	// As URLs de todas as réplicas, com o processador de cada uma, para os
+	// componentes do dial e o h2c
+	var urls, processors []string
+	for _, set := range []*replicaSet{defaultReplicas, fallbackReplicas} {
+		for _, url := range set.urls() {
+			urls = append(urls, url)
+			processors = append(processors, set.processorID)
+		}
+	}
+
+	// O dial das conexões com os processadores: o do net.Dialer, pelos IPs
+	// do cache de DNS com DNS_CACHE_TTL_MS e medido com
+	// PROCESSOR_CONN_METRICS
+	var dial dialFunc = (&net.Dialer{}).DialContext
+	dns := newDNSCache(cfg.DNSCacheTTL, dial, urls, processors)
+	if dns != nil {
+		dial = dns.DialContext
+	}
+	var defaultConns, fallbackConns *connStats
+	if cfg.ConnMetrics {
+		defaultConns, fallbackConns = newConnStats("default"), newConnStats("fallback")
+		dial = newConnDialer(dial, urls, byProcessor(processors, defaultConns, fallbackConns)).DialContext
+	}
+	transport.DialContext = dial
+
+	// Com h2c em algum processador, o client passa pelo protocolTransport,
+	// que disca com o mesmo dial
+	var roundTripper http.RoundTripper = transport
+	var protocol *protocolTransport
+	var defaultH2C, fallbackH2C *h2cRoute
+	if cfg.DefaultH2C || cfg.FallbackH2C {
+		if cfg.DefaultH2C {
+			defaultH2C = newH2CRoute("default", dial)
+		}
+		if cfg.FallbackH2C {
+			fallbackH2C = newH2CRoute("fallback", dial)
+		}
+		roundTripper = newProtocolTransport(transport, urls, byProcessor(processors, defaultH2C, fallbackH2C))
+		protocol, _ = roundTripper.(*protocolTransport)
+	}
+
+	// Com CHAOS, a injeção de falhas vem por fora do transporte, para as
+	// falhas injetadas passarem pelo mesmo caminho das reais, e o log das
+	// chamadas por fora dela, para registrar também as injetadas
+	chaos := newChaosLayer(cfg.Chaos, urls, processors)
+	roundTripper = chaos.wrap(roundTripper)
+	defaultAuth := processorHeaders(cfg.DefaultHeaders, cfg.TokenHeader, cfg.DefaultToken)
+	fallbackAuth := processorHeaders(cfg.FallbackHeaders, cfg.TokenHeader, cfg.FallbackToken)
+	exchanges := newExchangeLog(cfg, urls, processors, defaultAuth, fallbackAuth)
+	roundTripper = exchanges.wrap(roundTripper)
+
+	p := &PaymentProcessor{
+		healthInterval: cfg.HealthCheckInterval,
+		defaultAuth:    defaultAuth,
+		fallbackAuth:   fallbackAuth,
 		client: &http.Client{
-			Timeout: 300 * time.Millisecond, // timeout agressivo
-			Transport: &http.Transport{
-				MaxIdleConns:        100,
-				MaxIdleConnsPerHost: 10,
-				IdleConnTimeout:     90 * time.Second,
-			},
+			Timeout:   clientTimeout,
+			Transport: roundTripper,
 		},
+		protocol: protocol,
 		defaultStatus: &ProcessorStatus{
 			IsHealthy: 1, // inicializar como saudável
+			breaker:   newFailureBreaker(cfg),
+			timeout:   newProcessorTimeout(cfg.Timeout),
+			limiter:   newProcessorLimiter(cfg, "default"),
+			conns:     defaultConns,
+			protocol:  defaultH2C,
+			replicas:  defaultReplicas,
+			skew:      newClockSkew(cfg),
 		},
 		fallbackStatus: &ProcessorStatus{
 			IsHealthy: 1,
+			breaker:   newFailureBreaker(cfg),
+			timeout:   newProcessorTimeout(cfg.Timeout),
+			limiter:   newProcessorLimiter(cfg, "fallback"),
+			conns:     fallbackConns,
+			protocol:  fallbackH2C,
+			replicas:  fallbackReplicas,
+			skew:      newClockSkew(cfg),
 		},
+		timeoutPolicy:  policy,
+		dns:            dns,
+		chaos:          chaos,
+		exchanges:      exchanges,
+		warmupConns:    cfg.WarmupConnections,
+		warmupTimeout:  cfg.WarmupTimeout,
+		retry:          newRetryPolicy(cfg),
+		receipts:       newReceiptPolicy(cfg),
+		skewCorrection: cfg.ClockSkewCorrection,
+		paymentStore:   paymentStore,
+		logger:         slog.Default(),
+		sampler:        logging.DefaultSampler(),
+		snapshots:      newSnapshotter(cfg),
+		amountBounds:   cfg.AmountBuckets,
+
+		defaultIdempotency:  canonicalHeaders(cfg.DefaultIdempotencyHeaders),
+		fallbackIdempotency: canonicalHeaders(cfg.FallbackIdempotencyHeaders),
+		duplicateStatuses:   cfg.DuplicateStatuses,
 	}
+	p.routes = newRouter(cfg.RoutingRules, cfg.RoutingStrategy, []int64{int64(cfg.DefaultWeight), int64(cfg.FallbackWeight)},
+		map[string]*ProcessorStatus{"default": p.defaultStatus, "fallback": p.fallbackStatus})
+	p.shadow = newShadowMirror(cfg, p.fallbackStatus)
+	p.defaultStatus.lastProbe.Store(now.UnixNano())
+	p.fallbackStatus.lastProbe.Store(now.UnixNano())
+	p.window.Store(&statsWindow{since: now.UTC()})
+	p.amounts.Store(newProcessorAmounts(cfg.AmountBuckets))
+	return p
 }
 
-// ProcessPayment processa um payment com fallback automático
-func (p *PaymentProcessor) ProcessPayment(payment *types.PaymentRequest) *types.ProcessorResult {
-	atomic.AddInt64(&p.totalPayments, 1)
-	
-	log.Printf("🔄 Processando payment amount=%d type=%s", payment.Amount, payment.Type)
-	
-	// Tentar processador padrão primeiro se estiver saudável
-	defaultHealthy := atomic.LoadInt64(&p.defaultStatus.IsHealthy) == 1
-	log.Printf("📊 Default processor healthy: %v", defaultHealthy)
-	
-	if defaultHealthy {
-		result := p.sendToProcessor(p.defaultURL, "default", payment, p.defaultStatus)
-		if result.Success {
-			atomic.AddInt64(&p.defaultSuccess, 1)
-			log.Printf("✅ Default processor SUCCESS")
-			return result
+// byProcessor alinha às URLs o valor do processador de cada uma
+func byProcessor[T any](processors []string, defaultValue, fallbackValue T) []T {
+	values := make([]T, len(processors))
+	for i, id := range processors {
+		values[i] = defaultValue
+		if id == "fallback" {
+			values[i] = fallbackValue
+		}
+	}
+	return values
+}
+
+// UseSharedSummary passa a espelhar os contadores no summary compartilhado
+func (p *PaymentProcessor) UseSharedSummary(shared *store.SharedSummary) {
+	p.shared = shared
+}
+
+// ProcessPayment processa um payment com fallback automático, na ordem de
+// tentativa do type do payment (ROUTING_RULES) ou, sem regra, no default e
+// depois no fallback, começando pelo sorteado quando há pesos ou, com
+// ROUTING_STRATEGY=sticky, pelo do hash do correlationId. Um processador
+// sem token no rate limit é pulado como um indisponível; sem token em
+// nenhum, o payment falha com reasonThrottled, e com regra e nenhum
+// processador dela saudável, com reasonRouteUnavailable.
+func (p *PaymentProcessor) ProcessPayment(ctx context.Context, payment *types.PaymentRequest) *types.ProcessorResult {
+	return p.processPayment(ctx, payment, false)
+}
+
+// processPayment é o ProcessPayment; com retryThrottled, um payment sem
+// token em nenhum processador, ou sem processador permitido saudável,
+// retorna reasonThrottled (ou reasonRouteUnavailable) sem ser
+// contabilizado, para quem chamou tentá-lo de novo
+func (p *PaymentProcessor) processPayment(ctx context.Context, payment *types.PaymentRequest, retryThrottled bool) *types.ProcessorResult {
+	p.logger.DebugContext(ctx, "processing payment",
+		logging.KeyCorrelationID, payment.CorrelationID,
+		"amount", payment.Amount,
+		"type", payment.Type)
+
+	// Classe e erro da última falha, "unavailable" se nenhum processador
+	// estava saudável
+	reason := "unavailable"
+	lastErr := fmt.Errorf("all processors unavailable")
+	attempts := 0
+	throttled := false
+
+	// Cada processador na ordem, se estiver saudável e com token; com pesos
+	// ou sticky, a falha no primeiro segue para o outro como sempre. Um
+	// payment que um deles já tinha processado não vai ao próximo, que o
+	// processaria de novo.
+	routes, ruled := p.routes.order(payment)
+	for _, route := range routes {
+		if reason == metrics.ClassDuplicate {
+			break
+		}
+		if !route.status.Healthy() {
+			continue
 		}
-		log.Printf("❌ Default processor FAILED: %v", result.Error)
-	}
-	
-	// Fallback para processador secundário
-	fallbackHealthy := atomic.LoadInt64(&p.fallbackStatus.IsHealthy) == 1
-	log.Printf("📊 Fallback processor healthy: %v", fallbackHealthy)
-	
-	if fallbackHealthy {
-		result := p.sendToProcessor(p.fallbackURL, "fallback", payment, p.fallbackStatus)
+		if !route.status.limiter.allow() {
+			throttled = true
+			continue
+		}
+		if attempts == 0 {
+			p.recordAttempt()
+		}
+		attempts++
+		result := p.callProcessor(ctx, route.processorID, attempts, payment, route.status)
 		if result.Success {
-			atomic.AddInt64(&p.fallbackSuccess, 1)
-			log.Printf("✅ Fallback processor SUCCESS")
+			p.recordSuccess(route.processorID, payment)
+			result.Attempts = attempts
 			return result
 		}
-		log.Printf("❌ Fallback processor FAILED: %v", result.Error)
+		reason, lastErr = result.Reason, result.Error
 	}
-	
-	// Ambos falharam
-	atomic.AddInt64(&p.totalErrors, 1)
-	log.Printf("💥 BOTH processors FAILED - payment rejected")
+
+	if attempts == 0 {
+		switch {
+		case throttled:
+			reason, lastErr = reasonThrottled, errThrottled
+		case ruled:
+			reason, lastErr = reasonRouteUnavailable, errRouteUnavailable
+		}
+		if retryThrottled && (throttled || ruled) {
+			return &types.ProcessorResult{
+				Success:     false,
+				ProcessorID: "none",
+				Error:       lastErr,
+				Reason:      reason,
+			}
+		}
+		p.recordAttempt()
+	}
+
+	// Todos falharam
+	p.recordFailure()
 	return &types.ProcessorResult{
 		Success:     false,
 		ProcessorID: "none",
-		Error:       fmt.Errorf("all processors unavailable"),
+		Error:       lastErr,
+		Reason:      reason,
+		Attempts:    attempts,
 	}
 }
 
-// sendToProcessor envia para um processador específico
-func (p *PaymentProcessor) sendToProcessor(url, processorID string, payment *types.PaymentRequest, status *ProcessorStatus) *types.ProcessorResult {
-	start := time.Now()
-	
-	payloadBytes, err := payment.ToJSON()
-	if err != nil {
-		p.markUnhealthy(status)
-		return &types.ProcessorResult{
-			Success:     false,
-			ProcessorID: processorID,
-			Error:       err,
+// recordAttempt conta o payment em total_payments; todo payment contado
+// termina em sucesso, erro ou expirado
+func (p *PaymentProcessor) recordAttempt() {
+	atomic.AddInt64(&p.totalPayments, 1)
+	if p.shared != nil {
+		p.shared.IncTotal()
+	}
+}
+
+// recordFailure contabiliza um payment que falhou em todos os processadores
+func (p *PaymentProcessor) recordFailure() {
+	atomic.AddInt64(&p.totalErrors, 1)
+	metrics.PaymentsFailed.Inc()
+	if p.shared != nil {
+		p.shared.IncError()
+	}
+}
+
+// recordSuccess contabiliza um payment aceito pelo processador no summary
+func (p *PaymentProcessor) recordSuccess(processorID string, payment *types.PaymentRequest) {
+	amount := int64(payment.Amount)
+	other := isOtherCurrency(payment.Currency)
+	if processorID == "default" {
+		atomic.AddInt64(&p.defaultSuccess, 1)
+		p.mirror(payment)
+		if other {
+			p.addCurrencyAmounts(payment.Currency, types.CurrencyAmounts{DefaultAmount: amount})
+		} else {
+			types.AddAmountAtomic(&p.defaultAmount, amount)
+		}
+	} else {
+		atomic.AddInt64(&p.fallbackSuccess, 1)
+		if other {
+			p.addCurrencyAmounts(payment.Currency, types.CurrencyAmounts{FallbackAmount: amount})
+		} else {
+			types.AddAmountAtomic(&p.fallbackAmount, amount)
 		}
 	}
-	
-	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	if !other {
+		p.observeAmount(processorID, amount)
+	}
+	metrics.Processor(processorID).Types.Inc(p.routes.label(payment.Type))
+	if p.shared != nil {
+		p.shared.IncSuccess(processorID, payment.Currency, amount)
+	}
+}
+
+// isOtherCurrency indica se o payment soma fora dos totais na moeda padrão;
+// vazio é a moeda padrão (payments enfileirados antes do campo existir)
+func isOtherCurrency(currency string) bool {
+	return currency != "" && currency != types.DefaultCurrency()
+}
+
+// addCurrencyAmounts soma valores de uma moeda que não a padrão
+func (p *PaymentProcessor) addCurrencyAmounts(currency string, amounts types.CurrencyAmounts) {
+	p.currencyMu.Lock()
+	defer p.currencyMu.Unlock()
+
+	if p.currencies == nil {
+		p.currencies = make(map[string]types.CurrencyAmounts)
+	}
+	current := p.currencies[currency]
+	current.Add(amounts)
+	p.currencies[currency] = current
+}
+
+// savePayment registra no store o payment aceito pelo processador, com o
+// comprovante devolvido por ele, se houver
+func (p *PaymentProcessor) savePayment(processorID string, payment *types.PaymentRequest, receipt *store.Receipt) {
+	p.paymentStore.Save(store.Payment{
+		CorrelationID: payment.CorrelationID,
+		Amount:        int64(payment.Amount),
+		Currency:      payment.Currency,
+		Type:          payment.Type,
+		Processor:     processorID,
+		RequestedAt:   payment.RequestedAt,
+		ProcessedAt:   time.Now().UTC(),
+		Metadata:      payment.Metadata, // o pool não reaproveita o mapa
+		Receipt:       receipt,
+	})
+}
+
+// RecordExpired contabiliza um payment descartado na fila por idade. Ele
+// entra em total_payments para que o total continue igual à soma de
+// sucessos, erros e expirados.
+func (p *PaymentProcessor) RecordExpired(ctx context.Context, payment *types.PaymentRequest) {
+	atomic.AddInt64(&p.totalPayments, 1)
+	atomic.AddInt64(&p.totalExpired, 1)
+	if isOtherCurrency(payment.Currency) {
+		p.addCurrencyAmounts(payment.Currency, types.CurrencyAmounts{ExpiredAmount: int64(payment.Amount)})
+	} else {
+		types.AddAmountAtomic(&p.expiredAmount, int64(payment.Amount))
+	}
+	metrics.PaymentsExpired.Inc()
+	if p.shared != nil {
+		p.shared.IncTotal()
+		p.shared.IncExpired(payment.Currency, int64(payment.Amount))
+	}
+
+	if ok, n := p.sampler.Allow("payment_expired"); ok {
+		p.logger.WarnContext(ctx, "payment expired in queue",
+			logging.KeyCorrelationID, payment.CorrelationID,
+			"requested_at", payment.RequestedAt,
+			logging.KeyOccurrences, n)
+	}
+}
+
+// callProcessor envolve o sendToProcessor em um span de cliente quando o
+// tracing está ativo; attempt é a posição da tentativa para o payment
+func (p *PaymentProcessor) callProcessor(ctx context.Context, processorID string, attempt int, payment *types.PaymentRequest, status *ProcessorStatus) *types.ProcessorResult {
+	if !tracing.Enabled() {
+		return p.sendToProcessor(ctx, processorID, payment, status)
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "POST "+processorID,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("payment.processor", processorID),
+			attribute.Int("payment.attempt", attempt),
+		))
+	defer span.End()
+
+	result := p.sendToProcessor(ctx, processorID, payment, status)
+	if result.StatusCode != 0 {
+		span.SetAttributes(attribute.Int("http.response.status_code", result.StatusCode))
+	}
+	if !result.Success {
+		span.SetStatus(codes.Error, result.Reason)
+	}
+	return result
+}
+
+// sendToProcessor envia para um processador específico, por uma das
+// réplicas dele. O prazo é o da chamada toda: a passagem para outra réplica
+// após uma falha de conexão acontece dentro dele.
+func (p *PaymentProcessor) sendToProcessor(ctx context.Context, processorID string, payment *types.PaymentRequest, status *ProcessorStatus) *types.ProcessorResult {
+	start := time.Now()
+
+	timeout := status.timeout.get()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
-	
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payloadBytes))
+	ctx, trace := status.conns.trace(ctx)
+
+	target := status.replicas.acquire(nil)
+	defer func() { target.release() }() // a réplica final, depois de uma passagem
+
+	req, err := p.newPaymentRequest(ctx, target.url, processorID, payment)
 	if err != nil {
-		p.markUnhealthy(status)
+		trace.finish(true)
+		p.callFailed(status)
+		p.logFailure(ctx, payment, processorID, metrics.ClassOther, 0, time.Since(start), err)
 		return &types.ProcessorResult{
 			Success:     false,
 			ProcessorID: processorID,
 			Error:       err,
+			Reason:      metrics.ClassOther,
 		}
 	}
-	
-	req.Header.Set("Content-Type", "application/json")
-	
-	resp, err := p.client.Do(req)
+
+	m := metrics.Processor(processorID)
+
+	var resp *http.Response
+	resp, target, err = p.doPayment(ctx, req, target, processorID, payment, status.replicas, m)
 	if err != nil {
-		p.markUnhealthy(status)
+		status.replicas.failed(target, err)
+		trace.finish(false)
+		elapsed := time.Since(start)
+		reason := classifyTransportError(err)
+		if reason == metrics.ClassTimeout && elapsed < timeout {
+			// Timeout conta no teto, para o p99 refletir a espera real
+			m.Latency.Observe(timeout)
+		} else {
+			m.Latency.Observe(elapsed)
+		}
+		status.timeout.observe(elapsed, reason == metrics.ClassTimeout)
+		m.Failure.Inc()
+		m.Errors.Inc(reason)
+		p.callFailed(status)
+		p.logFailure(ctx, payment, processorID, reason, 0, elapsed, err)
 		return &types.ProcessorResult{
 			Success:     false,
 			ProcessorID: processorID,
 			Error:       err,
+			Reason:      reason,
 		}
 	}
+	defer trace.finish(true) // depois do Close, com a conexão de volta ao pool
 	defer resp.Body.Close()
-	
-	responseTime := time.Since(start).Milliseconds()
-	atomic.StoreInt64(&status.ResponseTimeMs, responseTime)
-	
+
+	end := time.Now()
+	elapsed := end.Sub(start)
+	m.Latency.Observe(elapsed)
+	status.timeout.observe(elapsed, false)
+	atomic.StoreInt64(&status.ResponseTimeMs, elapsed.Milliseconds())
+	p.observeClockSkew(processorID, status, resp, start, end)
+	// As mesmas respostas que contam contra o processador contam contra a réplica
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		status.replicas.failed(target, fmt.Errorf("HTTP %d", resp.StatusCode))
+	} else {
+		status.replicas.succeeded(target)
+	}
+
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		p.markHealthy(status)
+		// O processador respondeu: a saúde não depende do comprovante
+		status.limiter.succeeded()
+		p.callSucceeded(status)
+		receipt, err := p.readReceipt(ctx, processorID, payment, resp.Body, m)
+		if err != nil {
+			m.Failure.Inc()
+			m.Errors.Inc(metrics.ClassReceipt)
+			p.logFailure(ctx, payment, processorID, metrics.ClassReceipt, resp.StatusCode, elapsed, err)
+			return &types.ProcessorResult{
+				Success:     false,
+				ProcessorID: processorID,
+				Error:       err,
+				Reason:      metrics.ClassReceipt,
+				StatusCode:  resp.StatusCode,
+			}
+		}
+		m.Success.Inc()
+		p.savePayment(processorID, payment, receipt)
 		return &types.ProcessorResult{
 			Success:     true,
 			ProcessorID: processorID,
+			StatusCode:  resp.StatusCode,
 		}
 	}
-	
+
+	if p.isDuplicate(resp.StatusCode) {
+		return p.duplicateResult(ctx, processorID, payment, status, resp.StatusCode, elapsed, m)
+	}
+
+	reason := classifyStatus(resp.StatusCode)
+	m.Failure.Inc()
+	m.Errors.Inc(reason)
+	if reason == metrics.ClassAuth {
+		// Erro de configuração, não instabilidade: não afeta a saúde
+		p.logAuthFailure(processorID, "payment", resp.StatusCode)
+	} else {
+		p.logFailure(ctx, payment, processorID, reason, resp.StatusCode, elapsed, nil)
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		status.limiter.rejected()
+	}
+
 	// Status de erro ou timeout
 	if resp.StatusCode == 429 || resp.StatusCode >= 500 {
-		p.markUnhealthy(status)
+		p.callFailed(status)
 	}
-	
+
 	return &types.ProcessorResult{
 		Success:     false,
 		ProcessorID: processorID,
 		Error:       fmt.Errorf("HTTP %d", resp.StatusCode),
+		Reason:      reason,
+		StatusCode:  resp.StatusCode,
 	}
 }
 
-// markHealthy marca processador como saudável
+// newPaymentRequest monta a chamada de payment, com corpo, autenticação,
+// request id e contexto de tracing
+func (p *PaymentProcessor) newPaymentRequest(ctx context.Context, url, processorID string, payment *types.PaymentRequest) (*http.Request, error) {
+	body, err := newPayloadBody(payment)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+
+	req.ContentLength = int64(body.Len())
+	req.Header.Set("Content-Type", "application/json")
+	p.setAuthHeaders(req, processorID)
+	p.setIdempotencyHeaders(req, processorID, payment)
+
+	// Enquanto o h2c do processador não teve resposta, o corpo precisa
+	// poder ser refeito para a chamada voltar em HTTP/1.1
+	if p.protocol != nil && p.protocol.probing(req) {
+		req.GetBody = func() (io.ReadCloser, error) {
+			body, err := newPayloadBody(payment)
+			if err != nil {
+				return nil, err
+			}
+			return body, nil
+		}
+	}
+	if id := logging.RequestID(ctx); id != "" {
+		req.Header.Set(logging.RequestIDHeader, id)
+	}
+	if tracing.Enabled() {
+		tracing.Inject(ctx, req.Header)
+	}
+	return req, nil
+}
+
+// logFailure loga falhas de chamada com amostragem por processador e classe
+func (p *PaymentProcessor) logFailure(ctx context.Context, payment *types.PaymentRequest, processorID, reason string, statusCode int, elapsed time.Duration, err error) {
+	ok, n := p.sampler.Allow(reason + ":" + processorID)
+	if !ok {
+		return
+	}
+
+	attrs := []any{
+		logging.KeyCorrelationID, payment.CorrelationID,
+		logging.KeyProcessor, processorID,
+		logging.KeyReason, reason,
+		logging.KeyLatencyMs, elapsed.Milliseconds(),
+		logging.KeyOccurrences, n,
+	}
+	if statusCode != 0 {
+		attrs = append(attrs, logging.KeyStatus, statusCode)
+	}
+	if err != nil {
+		attrs = append(attrs, "error", err.Error())
+	}
+	p.logger.WarnContext(ctx, "processor call failed", attrs...)
+}
+
+// markHealthy marca processador como saudável: um health check, o
+// service-health ou uma chamada o reabilitou, fechando o circuit breaker.
+// Com o breaker ainda no tempo aberto o processador continua fora.
 func (p *PaymentProcessor) markHealthy(status *ProcessorStatus) {
+	closed, wasOpen := status.breaker.close()
+	if !closed {
+		return
+	}
 	atomic.StoreInt64(&status.IsHealthy, 1)
-	atomic.StoreInt64(&status.FailureCount, 0)
+	if wasOpen {
+		metrics.PushNow() // circuit breaker fechou
+	}
 	atomic.StoreInt64(&status.LastCheckTime, time.Now().Unix())
 }
 
-// markUnhealthy marca processador como não saudável
-func (p *PaymentProcessor) markUnhealthy(status *ProcessorStatus) {
-	failures := atomic.AddInt64(&status.FailureCount, 1)
-	if failures >= 3 { // circuit breaker após 3 falhas
+// callSucceeded conta uma chamada bem-sucedida na janela do circuit
+// breaker; o processador respondeu, então também volta a ser saudável
+func (p *PaymentProcessor) callSucceeded(status *ProcessorStatus) {
+	status.breaker.record(false)
+	p.markHealthy(status)
+}
+
+// callFailed conta uma falha na janela do circuit breaker e tira o
+// processador do roteamento se ela abriu o breaker
+func (p *PaymentProcessor) callFailed(status *ProcessorStatus) {
+	if status.breaker.record(true) {
 		atomic.StoreInt64(&status.IsHealthy, 0)
+		metrics.PushNow() // circuit breaker abriu
 	}
 	atomic.StoreInt64(&status.LastCheckTime, time.Now().Unix())
 }
 
-// GetSummary retorna estatísticas de processamento
-func (p *PaymentProcessor) GetSummary() *types.PaymentSummary {
-	return &types.PaymentSummary{
-		TotalPayments:   atomic.LoadInt64(&p.totalPayments),
+// GetSummary retorna estatísticas de processamento. Com summary
+// compartilhado retorna os totais de todas as instâncias, caindo para os
+// contadores locais se o Redis estiver indisponível.
+func (p *PaymentProcessor) GetSummary(ctx context.Context) *types.PaymentSummary {
+	if p.shared != nil {
+		summary, err := p.shared.Summary(ctx)
+		if err == nil {
+			return summary
+		}
+	}
+	return p.LocalSummary()
+}
+
+// LocalSummary retorna os contadores desta instância desde o último reset,
+// somados aos restaurados do snapshot. A janela é lida antes dos
+// contadores: um reset no meio da leitura faz descontar a base anterior,
+// menor, e nunca deixa um valor negativo.
+func (p *PaymentProcessor) LocalSummary() *types.PaymentSummary {
+	w := p.window.Load()
+	summary := p.LifetimeSummary()
+	summary.Subtract(w.base)
+	summary.Add(w.carried)
+	since := w.since
+	summary.Since = &since
+	return summary
+}
+
+// LifetimeSummary retorna os contadores deste processo desde o boot, sem
+// descontar os resets nem somar o snapshot restaurado. Os desfechos são lidos antes do total: todo payment
+// com desfecho já estava no total, então o total lido nunca é menor que a
+// soma deles.
+func (p *PaymentProcessor) LifetimeSummary() *types.PaymentSummary {
+	summary := &types.PaymentSummary{
 		DefaultSuccess:  atomic.LoadInt64(&p.defaultSuccess),
 		FallbackSuccess: atomic.LoadInt64(&p.fallbackSuccess),
 		TotalErrors:     atomic.LoadInt64(&p.totalErrors),
+		TotalExpired:    atomic.LoadInt64(&p.totalExpired),
+		DefaultAmount:   atomic.LoadInt64(&p.defaultAmount),
+		FallbackAmount:  atomic.LoadInt64(&p.fallbackAmount),
+		ExpiredAmount:   atomic.LoadInt64(&p.expiredAmount),
+	}
+
+	p.currencyMu.Lock()
+	summary.AddCurrencies(p.currencies)
+	p.currencyMu.Unlock()
+
+	summary.TotalPayments = atomic.LoadInt64(&p.totalPayments)
+	return summary
+}
+
+// LatencyStats resume os histogramas de latência dos processadores
+func (p *PaymentProcessor) LatencyStats() map[string]types.LatencyStats {
+	stats := make(map[string]types.LatencyStats, 2)
+	for _, name := range []string{"default", "fallback"} {
+		s := histogramStats(metrics.Processor(name).Latency.Snapshot())
+		status, _ := p.status(name)
+		s.TimeoutMs = status.timeout.get().Milliseconds()
+		stats[name] = s
+	}
+	return stats
+}
+
+// histogramStats resume um histograma em percentis e buckets em ms
+func histogramStats(snap metrics.HistogramSnapshot) types.LatencyStats {
+	buckets := make([]types.LatencyBucket, len(snap.Counts))
+	for i, count := range snap.Counts {
+		le := "+Inf"
+		if i < len(snap.Bounds) {
+			le = strconv.FormatFloat(snap.Bounds[i]*1000, 'g', -1, 64)
+		}
+		buckets[i] = types.LatencyBucket{Le: le, Count: count}
+	}
+
+	return types.LatencyStats{
+		Count:   snap.Count,
+		P50Ms:   durationMs(snap.Quantile(0.50)),
+		P95Ms:   durationMs(snap.Quantile(0.95)),
+		P99Ms:   durationMs(snap.Quantile(0.99)),
+		MaxMs:   durationMs(snap.Max),
+		Buckets: buckets,
+	}
+}
+
+// durationMs converte para milissegundos com precisão de microssegundo
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// RegisterMetrics registra os gauges de saúde dos processadores no /metrics
+func (p *PaymentProcessor) RegisterMetrics() {
+	statuses := []struct {
+		name   string
+		status *ProcessorStatus
+	}{
+		{"default", p.defaultStatus},
+		{"fallback", p.fallbackStatus},
+	}
+
+	for _, s := range statuses {
+		status := s.status
+		labels := fmt.Sprintf("processor=%q", s.name)
+		metrics.RegisterGauge("rinha_processor_healthy", "1 se o processador recebe tráfego.", labels, func() float64 {
+			if status.Healthy() {
+				return 1
+			}
+			return 0
+		})
+	}
+	for _, s := range statuses {
+		status := s.status
+		labels := fmt.Sprintf("processor=%q", s.name)
+		metrics.RegisterGauge("rinha_processor_breaker_open", "1 se o circuit breaker abriu pela taxa de falhas.", labels, func() float64 {
+			if status.BreakerOpen() {
+				return 1
+			}
+			return 0
+		})
+	}
+	for _, s := range statuses {
+		status := s.status
+		labels := fmt.Sprintf("processor=%q", s.name)
+		metrics.RegisterGauge("rinha_processor_timeout_seconds", "Prazo atual das chamadas de payment ao processador.", labels, func() float64 {
+			return status.timeout.get().Seconds()
+		})
+	}
+	for _, s := range statuses {
+		skew := s.status.skew
+		labels := fmt.Sprintf("processor=%q", s.name)
+		metrics.RegisterGauge("rinha_processor_clock_skew_seconds", "Desvio estimado do relógio do processador em relação ao local, pelo header Date.", labels, func() float64 {
+			estimate, _ := skew.get()
+			return estimate.Seconds()
+		})
+	}
+	for _, s := range statuses {
+		route := s.status.protocol
+		if route == nil {
+			continue
+		}
+		labels := fmt.Sprintf("processor=%q", s.name)
+		metrics.RegisterGauge("rinha_processor_h2c", "1 se as chamadas ao processador vão em h2c, 0 depois da queda para HTTP/1.1.", labels, func() float64 {
+			if route.fellBackAt.Load() == 0 {
+				return 1
+			}
+			return 0
+		})
+	}
+	for _, s := range statuses {
+		replicas := s.status.replicas.replicas
+		if len(replicas) == 1 {
+			continue
+		}
+		for _, r := range replicas {
+			labels := fmt.Sprintf("processor=%q,replica=%q", s.name, r.addr)
+			metrics.RegisterGauge("rinha_processor_replica_healthy", "1 se a réplica do processador está no rodízio, 0 ejetada.", labels, func() float64 {
+				if r.ejected.Load() {
+					return 0
+				}
+				return 1
+			})
+		}
+	}
+	for i, route := range p.routes.global {
+		labels := fmt.Sprintf("processor=%q", route.processorID)
+		metrics.RegisterGauge("rinha_processor_weight", "Peso atual do processador no sorteio do primeiro processador; 0 em todos sem sorteio.", labels, func() float64 {
+			return float64(p.routes.weights.Load().values[i])
+		})
+	}
+	metrics.RegisterGauge("rinha_shadow_in_flight", "Cópias do modo shadow em andamento.", "", func() float64 {
+		return float64(len(p.shadow.slots))
+	})
+	for _, s := range statuses {
+		limiter := s.status.limiter
+		if limiter == nil {
+			continue
+		}
+		labels := fmt.Sprintf("processor=%q", s.name)
+		metrics.RegisterGauge("rinha_processor_rate_limit", "Taxa efetiva do rate limit das chamadas ao processador, por segundo.", labels, func() float64 {
+			return limiter.stats().RatePerSecond
+		})
+	}
+	for _, s := range statuses {
+		conns := s.status.conns
+		if conns == nil {
+			continue
+		}
+		labels := fmt.Sprintf("processor=%q", s.name)
+		metrics.RegisterGauge("rinha_processor_connections_open", "Conexões abertas com o processador.", labels, func() float64 {
+			return float64(conns.open.Load())
+		})
+	}
+	for _, s := range statuses {
+		conns := s.status.conns
+		if conns == nil {
+			continue
+		}
+		labels := fmt.Sprintf("processor=%q", s.name)
+		metrics.RegisterGauge("rinha_processor_connections_active", "Conexões em uso por uma chamada de payment ao processador.", labels, func() float64 {
+			return float64(conns.active.Load())
+		})
+	}
+	for _, s := range statuses {
+		conns := s.status.conns
+		if conns == nil {
+			continue
+		}
+		labels := fmt.Sprintf("processor=%q", s.name)
+		metrics.RegisterGauge("rinha_processor_connections_idle", "Estimativa das conexões ociosas no pool (abertas menos em uso).", labels, func() float64 {
+			return float64(max(conns.open.Load()-conns.active.Load(), 0))
+		})
 	}
 }
 
+// healthProbeTick é a resolução do HealthChecker: o ping de um processador
+// com o circuit breaker aberto sai logo que o tempo aberto termina, não no
+// próximo healthInterval
+const healthProbeTick = 100 * time.Millisecond
+
 // HealthChecker executa verificações periódicas de saúde
 func (p *PaymentProcessor) HealthChecker(ctx context.Context) {
-	ticker := time.NewTicker(10 * time.Second)
+	ticker := time.NewTicker(min(p.healthInterval, healthProbeTick))
 	defer ticker.Stop()
-	
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			p.checkProcessorHealth()
+		case now := <-ticker.C:
+			p.checkProcessorHealth(now)
 		}
 	}
 }
 
-// checkProcessorHealth verifica saúde dos processadores
-func (p *PaymentProcessor) checkProcessorHealth() {
+// checkProcessorHealth faz o ping dos processadores indisponíveis: com o
+// circuit breaker aberto quando o tempo aberto termina, senão a cada
+// healthInterval. As réplicas ejetadas recebem o delas a cada
+// replicaEjectTime, com o processador saudável ou não.
+func (p *PaymentProcessor) checkProcessorHealth(now time.Time) {
 	var wg sync.WaitGroup
-	
-	// Verificar default
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if atomic.LoadInt64(&p.defaultStatus.IsHealthy) == 0 {
-			if p.pingProcessor(p.defaultURL) {
-				p.markHealthy(p.defaultStatus)
-			}
+
+	for _, target := range []struct {
+		name   string
+		status *ProcessorStatus
+	}{
+		{"default", p.defaultStatus},
+		{"fallback", p.fallbackStatus},
+	} {
+		replicas := target.status.replicas
+		for _, r := range replicas.probeDue(now) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if p.pingProcessor(target.name, r.url) {
+					replicas.readmit(r)
+				}
+			}()
 		}
-	}()
-	
-	// Verificar fallback
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if atomic.LoadInt64(&p.fallbackStatus.IsHealthy) == 0 {
-			if p.pingProcessor(p.fallbackURL) {
-				p.markHealthy(p.fallbackStatus)
-			}
+
+		if !p.probeDue(target.status, now) {
+			continue
 		}
-	}()
-	
+		target.status.lastProbe.Store(now.UnixNano())
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if p.pingReplicas(target.name, replicas) {
+				p.markHealthy(target.status)
+			} else {
+				target.status.breaker.postpone()
+			}
+		}()
+	}
+
 	wg.Wait()
 }
 
+// pingReplicas faz o ping de todas as réplicas do processador, em paralelo;
+// true se alguma respondeu. As que responderam voltam ao rodízio.
+func (p *PaymentProcessor) pingReplicas(processorID string, replicas *replicaSet) bool {
+	var answered atomic.Bool
+	var wg sync.WaitGroup
+	for _, r := range replicas.replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if p.pingProcessor(processorID, r.url) {
+				replicas.readmit(r)
+				answered.Store(true)
+			}
+		}()
+	}
+	wg.Wait()
+	return answered.Load()
+}
+
+// probeDue indica se o processador deve receber um ping agora
+func (p *PaymentProcessor) probeDue(status *ProcessorStatus, now time.Time) bool {
+	next, ok := p.nextProbe(status)
+	return ok && !now.Before(next)
+}
+
+// nextProbe retorna quando o HealthChecker faz o próximo ping do
+// processador: com o circuit breaker aberto, ao fim do tempo aberto; senão
+// healthInterval depois do último. Um processador saudável não recebe ping.
+func (p *PaymentProcessor) nextProbe(status *ProcessorStatus) (time.Time, bool) {
+	if atomic.LoadInt64(&status.IsHealthy) == 1 {
+		return time.Time{}, false
+	}
+	if status.breaker.open.Load() {
+		return time.Unix(0, status.breaker.probeAt.Load()), true
+	}
+	return time.Unix(0, status.lastProbe.Load()).Add(p.healthInterval), true
+}
+
 // pingProcessor faz um ping simples no processador
-func (p *PaymentProcessor) pingProcessor(url string) bool {
+func (p *PaymentProcessor) pingProcessor(processorID, url string) bool {
 	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
 	defer cancel()
-	
-	// Para URLs de teste (httpbin), usar o próprio endpoint
-	healthURL := url
-	if strings.Contains(url, "httpbin.org") {
-		// Para httpbin, usar GET no mesmo endpoint POST
-		if strings.Contains(url, "/post") {
-			healthURL = strings.Replace(url, "/post", "/get", 1)
-		}
-	} else {
-		// Para processadores reais, usar /health
-		healthURL = url + "/health"
-	}
-	
-	req, err := http.NewRequestWithContext(ctx, "GET", healthURL, nil)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", healthURL(url), nil)
 	if err != nil {
 		return false
 	}
-	
+	p.setAuthHeaders(req, processorID)
+
 	resp, err := p.client.Do(req)
 	if err != nil {
 		return false
 	}
 	defer resp.Body.Close()
-	
+
+	if classifyStatus(resp.StatusCode) == metrics.ClassAuth {
+		p.logAuthFailure(processorID, "health", resp.StatusCode)
+	}
 	return resp.StatusCode == 200
 }
+
+// healthURL deriva o endpoint do ping a partir da URL do processador
+func healthURL(url string) string {
+	// Para URLs de teste (httpbin), usar o próprio endpoint
+	if strings.Contains(url, "httpbin.org") {
+		// Para httpbin, usar GET no mesmo endpoint POST
+		return strings.Replace(url, "/post", "/get", 1)
+	}
+	// Para processadores reais, usar /health
+	return url + "/health"
+}
+
+// setAuthHeaders aplica o token e os headers extras do processador
+func (p *PaymentProcessor) setAuthHeaders(req *http.Request, processorID string) {
+	headers := p.defaultAuth
+	if processorID == "fallback" {
+		headers = p.fallbackAuth
+	}
+	for key, values := range headers {
+		req.Header[key] = values
+	}
+}
+
+// logAuthFailure loga como erro um 401/403 do processador: token ou
+// headers mal configurados não se resolvem sozinhos, então a chamada não
+// marca o processador como indisponível, mas o log precisa aparecer
+func (p *PaymentProcessor) logAuthFailure(processorID, call string, statusCode int) {
+	ok, n := p.sampler.Allow("auth:" + processorID)
+	if !ok {
+		return
+	}
+	p.logger.Error("processor rejected our credentials, check its token and headers",
+		logging.KeyProcessor, processorID,
+		"call", call,
+		logging.KeyStatus, statusCode,
+		logging.KeyOccurrences, n)
+}
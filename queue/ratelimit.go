@@ -0,0 +1,257 @@
+package queue
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// reasonThrottled é a falha de um payment que não achou token no rate
+// limit de nenhum processador saudável
+const reasonThrottled = "throttled"
+
+var errThrottled = errors.New("processor rate limit exhausted")
+
+// Ajuste automático da taxa (RateAuto): cada 429 corta a taxa efetiva pela
+// metade, no máximo uma vez por rateDecreaseCooldown (as chamadas em voo
+// recebem o mesmo 429 juntas), até rateFloorPercent% da configurada. Depois
+// de rateRecoverAfter sem 429, cada sucesso devolve rateRecoverPercent% da
+// configurada, um passo por rateRecoverAfter.
+const (
+	rateDecreaseCooldown = time.Second
+	rateFloorPercent     = 5
+	rateRecoverAfter     = 2 * time.Second
+	rateRecoverPercent   = 10
+)
+
+// Espera de um payment retirado da fila sem token em nenhum processador
+// antes de tentar de novo. Fora do worker: o lote segue e o worker volta à
+// fila, que fica parada enquanto não houver token ou houver payments
+// aguardando nova tentativa (awaitRateLimit).
+const throttledRetryDelay = 20 * time.Millisecond
+
+// processorLimiter é o token bucket das chamadas de payment a um
+// processador. O nil não limita nada, então quem chama não precisa saber
+// se o rate limit está ligado.
+type processorLimiter struct {
+	limit   float64 // taxa configurada
+	burst   float64
+	auto    bool
+	metrics *metrics.ProcessorMetrics
+
+	mu        sync.Mutex
+	rate      float64 // taxa efetiva
+	tokens    float64
+	updated   time.Time
+	changedAt time.Time // último 429 ou ajuste da taxa
+
+	decreases atomic.Int64
+	increases atomic.Int64
+}
+
+// newProcessorLimiter retorna nil com RateLimit zero
+func newProcessorLimiter(cfg ProcessorConfig, processorID string) *processorLimiter {
+	if cfg.RateLimit <= 0 {
+		return nil
+	}
+	return &processorLimiter{
+		limit:   float64(cfg.RateLimit),
+		burst:   float64(cfg.RateBurst),
+		auto:    cfg.RateAuto,
+		metrics: metrics.Processor(processorID),
+		rate:    float64(cfg.RateLimit),
+		tokens:  float64(cfg.RateBurst),
+		updated: time.Now(),
+	}
+}
+
+// refill credita os tokens acumulados desde a última leitura; chamado com
+// o lock
+func (l *processorLimiter) refill(now time.Time) {
+	if now.After(l.updated) {
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.updated).Seconds()*l.rate)
+		l.updated = now
+	}
+}
+
+// allow retira um token, se houver
+func (l *processorLimiter) allow() bool {
+	if l == nil {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(time.Now())
+	if l.tokens >= 1 {
+		l.tokens--
+		return true
+	}
+	l.metrics.Throttled.Inc()
+	return false
+}
+
+// wait retorna quanto falta para o próximo token, sem retirá-lo; zero se
+// já houver um
+func (l *processorLimiter) wait() time.Duration {
+	if l == nil {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(time.Now())
+	if l.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// rejected registra um 429 do processador: com RateAuto, corta a taxa
+// efetiva e zera os tokens, para a próxima chamada respeitar a nova taxa
+func (l *processorLimiter) rejected() {
+	if l == nil || !l.auto {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.changedAt) >= rateDecreaseCooldown {
+		floor := l.limit * rateFloorPercent / 100
+		if rate := max(l.rate/2, floor); rate < l.rate {
+			l.refill(now)
+			l.rate = rate
+			l.tokens = min(l.tokens, 0)
+			l.decreases.Add(1)
+		}
+	}
+	l.changedAt = now
+}
+
+// succeeded registra uma resposta 2xx: com RateAuto e a taxa reduzida,
+// devolve um passo dela depois de rateRecoverAfter sem 429
+func (l *processorLimiter) succeeded() {
+	if l == nil || !l.auto {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.rate >= l.limit || now.Sub(l.changedAt) < rateRecoverAfter {
+		return
+	}
+	l.refill(now)
+	l.rate = min(l.limit, l.rate+l.limit*rateRecoverPercent/100)
+	l.changedAt = now
+	l.increases.Add(1)
+}
+
+// stats retorna o estado do bucket; nil com o rate limit desligado
+func (l *processorLimiter) stats() *types.ProcessorRateLimit {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	l.refill(time.Now())
+	rate, tokens := l.rate, l.tokens
+	l.mu.Unlock()
+
+	return &types.ProcessorRateLimit{
+		LimitPerSecond: l.limit,
+		RatePerSecond:  rate,
+		Burst:          int(l.burst),
+		Tokens:         max(tokens, 0),
+		Auto:           l.auto,
+		Throttled:      l.metrics.Throttled.Value(),
+		Decreases:      l.decreases.Load(),
+		Increases:      l.increases.Load(),
+	}
+}
+
+// rateLimitWait retorna quanto falta para algum processador saudável ter
+// token; zero se algum já tiver, se o rate limit estiver desligado ou se
+// nenhum estiver saudável (o payment falha como sem rate limit)
+func (p *PaymentProcessor) rateLimitWait() time.Duration {
+	var wait time.Duration
+	for _, status := range []*ProcessorStatus{p.defaultStatus, p.fallbackStatus} {
+		if !status.Healthy() {
+			continue
+		}
+		w := status.limiter.wait()
+		if w == 0 {
+			return 0
+		}
+		if wait == 0 || w < wait {
+			wait = w
+		}
+	}
+	return wait
+}
+
+// awaitRateLimit segura o worker, antes de retirar o próximo lote,
+// enquanto nenhum processador saudável tiver token ou houver jobs
+// aguardando o retryThrottled: os payments esperam na fila, na ordem, em vez
+// de serem retirados só para aguardar fora dela. Retorna false quando o
+// worker deve terminar.
+func (wp *WorkerPool) awaitRateLimit() bool {
+	for {
+		wait := wp.processor.rateLimitWait()
+		if wp.throttled.Load() > 0 {
+			wait = max(wait, throttledRetryDelay)
+		}
+		if wait == 0 {
+			return true
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-wp.ctx.Done():
+			timer.Stop()
+			return false
+		case <-wp.stop:
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+	}
+}
+
+// retryThrottled tenta de novo, depois de throttledRetryDelay, um job que
+// não achou token em nenhum processador, sem segurar o worker nem o lote.
+// O job segue sujeito ao QueueTTL e ao orçamento de tentativas, conferido
+// no attempt; com o pool parando ele falha como reasonThrottled.
+func (wp *WorkerPool) retryThrottled(stats *workerStats, j Job) {
+	wp.wg.Add(1)
+	wp.throttled.Add(1)
+	time.AfterFunc(throttledRetryDelay, func() {
+		defer wp.wg.Done()
+		defer wp.throttled.Add(-1)
+
+		if wp.ctx.Err() != nil {
+			wp.processor.recordAttempt()
+			wp.processor.recordFailure()
+			wp.complete(stats, j, &types.ProcessorResult{
+				ProcessorID: "none",
+				Reason:      reasonThrottled,
+				Error:       errThrottled,
+			})
+			return
+		}
+		if wp.expired(j) {
+			wp.expire(stats, j)
+			return
+		}
+		wp.attempt(stats, j)
+	})
+}
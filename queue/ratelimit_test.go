@@ -0,0 +1,146 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// maxInWindow é o maior número de instantes de times dentro de qualquer
+// janela de window; times está em ordem
+func maxInWindow(times []time.Time, window time.Duration) int {
+	peak, start := 0, 0
+	for end := range times {
+		for times[end].Sub(times[start]) >= window {
+			start++
+		}
+		peak = max(peak, end-start+1)
+	}
+	return peak
+}
+
+func TestProcessorLimiterUnderConcurrency(t *testing.T) {
+	const rate, burst = 200, 10
+	cfg := DefaultProcessorConfig()
+	cfg.RateLimit, cfg.RateBurst = rate, burst
+	limiter := newProcessorLimiter(cfg, "test-limiter")
+
+	// 16 goroutines disputam os tokens sem parar por 300ms
+	var granted atomic.Int64
+	var wg sync.WaitGroup
+	start := time.Now()
+	deadline := start.Add(300 * time.Millisecond)
+	for range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				if limiter.allow() {
+					granted.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	limit := burst + int64(rate*elapsed.Seconds()) + 1
+	if got := granted.Load(); got > limit {
+		t.Fatalf("%d tokens granted in %s, the bucket allows at most %d", got, elapsed, limit)
+	} else if floor := int64(rate * 0.3 * 0.8); got < floor {
+		t.Errorf("%d tokens granted in %s, want close to %d", got, elapsed, limit)
+	}
+}
+
+func TestProcessorRateLimitUnderConcurrentWorkers(t *testing.T) {
+	const rate, burst = 100, 5
+	var mu sync.Mutex
+	calls := make(map[string][]time.Time)
+	record := func(name string) func(types.PaymentRequest) {
+		return func(types.PaymentRequest) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls[name] = append(calls[name], time.Now())
+		}
+	}
+	defaultProcessor, fallbackProcessor := newFakeProcessor(t), newFakeProcessor(t)
+	defaultProcessor.onPayment = record("default")
+	fallbackProcessor.onPayment = record("fallback")
+
+	processorConfig := testProcessorConfig(defaultProcessor, fallbackProcessor)
+	processorConfig.RateLimit, processorConfig.RateBurst = rate, burst
+	cfg := testPoolConfig(8)
+	pool := newTestPool(t, processorConfig, cfg)
+
+	// Bem mais payments do que os dois buckets liberam na janela medida
+	for i := range 400 {
+		if pool.Submit(context.Background(), newTestPayment(i)) != nil {
+			t.Fatalf("Submit refused payment %d", i)
+		}
+	}
+	time.Sleep(600 * time.Millisecond)
+	pool.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	// Em qualquer janela cabem o burst e a taxa da janela, mais a folga de
+	// um token do arredondamento e da latência entre o token e a chamada
+	for _, window := range []time.Duration{100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond} {
+		limit := burst + int(rate*window.Seconds()) + 2
+		for name, times := range calls {
+			if got := maxInWindow(times, window); got > limit {
+				t.Errorf("%s: %d calls within %s, the rate limit allows %d", name, got, window, limit)
+			}
+		}
+	}
+	if len(calls["default"]) < rate/2 {
+		t.Errorf("default got only %d calls in 600ms at %d/s", len(calls["default"]), rate)
+	}
+	if stats := pool.processor.defaultStatus.limiter.stats(); stats.Throttled == 0 {
+		t.Errorf("default limiter never throttled: %+v", stats)
+	}
+}
+
+func TestProcessorLimiterAutoTune(t *testing.T) {
+	cfg := DefaultProcessorConfig()
+	cfg.RateLimit, cfg.RateBurst, cfg.RateAuto = 100, 10, true
+	limiter := newProcessorLimiter(cfg, "test-auto")
+
+	limiter.rejected()
+	if got := limiter.stats(); got.RatePerSecond != 50 || got.Tokens >= 1 || got.Decreases != 1 {
+		t.Fatalf("after a 429: %+v, want rate 50 with no tokens left", got)
+	}
+	// As chamadas em voo recebem o mesmo 429: só um corte por cooldown
+	limiter.rejected()
+	if got := limiter.stats().RatePerSecond; got != 50 {
+		t.Fatalf("second 429 within the cooldown cut the rate to %v", got)
+	}
+
+	// Cortes seguidos param no piso de 5% da taxa configurada
+	for range 10 {
+		limiter.mu.Lock()
+		limiter.changedAt = limiter.changedAt.Add(-rateDecreaseCooldown)
+		limiter.mu.Unlock()
+		limiter.rejected()
+	}
+	if got := limiter.stats().RatePerSecond; got != 5 {
+		t.Fatalf("rate after repeated 429s = %v, want the floor of 5", got)
+	}
+
+	// Sem 429 por rateRecoverAfter, cada sucesso devolve 10% da configurada
+	limiter.succeeded()
+	if got := limiter.stats().RatePerSecond; got != 5 {
+		t.Fatalf("success right after a 429 raised the rate to %v", got)
+	}
+	limiter.mu.Lock()
+	limiter.changedAt = limiter.changedAt.Add(-rateRecoverAfter)
+	limiter.mu.Unlock()
+	limiter.succeeded()
+	if got := limiter.stats(); got.RatePerSecond != 15 || got.Increases != 1 {
+		t.Fatalf("after a quiet period: %+v, want rate 15", got)
+	}
+}
@@ -0,0 +1,142 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/store"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// Campos procurados no corpo da resposta 2xx, nesta ordem; o primeiro
+// presente vale. Cada processador nomeia o identificador de um jeito, e o
+// da Rinha não devolve nenhum.
+var (
+	receiptIDFields   = []string{"id", "paymentId", "transactionId", "receiptId"}
+	receiptTimeFields = []string{"processedAt", "timestamp", "createdAt"}
+)
+
+// receiptRawMax é o quanto do corpo fica no comprovante para a visão de
+// debug; o limite de leitura é o PROCESSOR_RECEIPT_MAX_BYTES
+const receiptRawMax = 256
+
+var (
+	errReceiptTooLarge  = errors.New("response body exceeds PROCESSOR_RECEIPT_MAX_BYTES")
+	errReceiptNotObject = errors.New("response body is not a JSON object")
+	errReceiptMissing   = errors.New("response body has no payment id")
+)
+
+// receiptPolicy diz como ler o comprovante das respostas 2xx de payment:
+// até maxBytes do corpo (0 não lê) e, com strict, um payment sem
+// comprovante legível vira falha
+type receiptPolicy struct {
+	maxBytes int
+	strict   bool
+}
+
+func newReceiptPolicy(cfg ProcessorConfig) receiptPolicy {
+	return receiptPolicy{maxBytes: cfg.ReceiptMaxBytes, strict: cfg.ReceiptStrict}
+}
+
+// read lê o corpo até maxBytes e extrai o comprovante, retornando o
+// desfecho (metrics.Receipt*) e, fora de captured, o motivo. Com corpo, o
+// comprovante volta mesmo sem identificador, para o raw chegar à visão de
+// debug.
+func (r receiptPolicy) read(body io.Reader) (*store.Receipt, string, error) {
+	data, err := io.ReadAll(io.LimitReader(body, int64(r.maxBytes)+1))
+	if err != nil {
+		return rawReceipt(data), metrics.ReceiptInvalid, err
+	}
+	if len(data) > r.maxBytes {
+		return rawReceipt(data[:r.maxBytes]), metrics.ReceiptInvalid, errReceiptTooLarge
+	}
+	return parseReceipt(data)
+}
+
+// parseReceipt extrai identificador e instante de um corpo JSON. Um
+// instante ausente ou fora do RFC 3339 só fica de fora do comprovante.
+func parseReceipt(data []byte) (*store.Receipt, string, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, metrics.ReceiptMissing, errReceiptMissing
+	}
+	receipt := rawReceipt(data)
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil || fields == nil {
+		return receipt, metrics.ReceiptInvalid, errReceiptNotObject
+	}
+	for _, name := range receiptTimeFields {
+		var value string
+		if json.Unmarshal(fields[name], &value) != nil {
+			continue
+		}
+		if at, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			at = at.UTC()
+			receipt.At = &at
+			break
+		}
+	}
+	for _, name := range receiptIDFields {
+		if id := receiptID(fields[name]); id != "" {
+			receipt.ID = id
+			return receipt, metrics.ReceiptCaptured, nil
+		}
+	}
+	return receipt, metrics.ReceiptMissing, errReceiptMissing
+}
+
+// receiptID aceita o identificador como string ou número
+func receiptID(raw json.RawMessage) string {
+	var id string
+	if json.Unmarshal(raw, &id) == nil {
+		return id
+	}
+	var n json.Number
+	if json.Unmarshal(raw, &n) == nil {
+		return n.String()
+	}
+	return ""
+}
+
+// rawReceipt guarda o começo do corpo, sem cortar um caractere ao meio
+func rawReceipt(data []byte) *store.Receipt {
+	if len(data) == 0 {
+		return nil
+	}
+	raw := string(data[:min(len(data), receiptRawMax)])
+	return &store.Receipt{Raw: strings.ToValidUTF8(raw, "")}
+}
+
+// readReceipt lê o comprovante de uma resposta 2xx de payment e conta o
+// desfecho. Um corpo ilegível é logado, amostrado, mas o payment segue
+// aceito; só com PROCESSOR_RECEIPT_STRICT a falta de comprovante retorna
+// erro, para o payment virar falha.
+func (p *PaymentProcessor) readReceipt(ctx context.Context, processorID string, payment *types.PaymentRequest, body io.Reader, m *metrics.ProcessorMetrics) (*store.Receipt, error) {
+	if p.receipts.maxBytes <= 0 {
+		return nil, nil
+	}
+	receipt, outcome, err := p.receipts.read(body)
+	m.Receipts.Inc(outcome)
+	if outcome == metrics.ReceiptInvalid {
+		if ok, n := p.sampler.Allow("receipt_invalid:" + processorID); ok {
+			p.logger.WarnContext(ctx, "unreadable processor receipt",
+				logging.KeyCorrelationID, payment.CorrelationID,
+				logging.KeyProcessor, processorID,
+				"strict", p.receipts.strict,
+				"error", err.Error(),
+				logging.KeyOccurrences, n)
+		}
+	}
+	if err != nil && p.receipts.strict {
+		return nil, err
+	}
+	return receipt, nil
+}
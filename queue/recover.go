@@ -0,0 +1,94 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// reasonPanic é a classe de falha de um payment cujo processamento entrou
+// em pânico
+const reasonPanic = "panic"
+
+// bulkPanicResult é o desfecho dos payments de uma chamada em lote que
+// entrou em pânico
+var bulkPanicResult = &types.ProcessorResult{
+	ProcessorID: "none",
+	Error:       errors.New("bulk call panicked"),
+	Reason:      reasonPanic,
+	Attempts:    1,
+}
+
+// recoverWorker, adiado no topo do worker, troca um worker que entrou em
+// pânico fora do processamento de um payment por um novo. Os jobs do lote
+// que ainda não tinham sido confirmados ficam sem desfecho: com Redis são
+// reentregues, na fila em memória se perdem.
+func (wp *WorkerPool) recoverWorker(id int) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	metrics.Panics.Inc(metrics.PanicWorker)
+	wp.logger.Error("worker panic recovered, restarting worker",
+		"worker_id", id,
+		"panic", fmt.Sprint(r),
+		"stack", string(debug.Stack()))
+
+	// Roda antes do wg.Done deste worker, então o Stop não perde o novo
+	if wp.ctx.Err() == nil {
+		wp.startWorker()
+	}
+}
+
+// recoverJob, adiado no processJob, transforma um pânico no processamento
+// do payment em falha. O payment já foi contado em total_payments pelo
+// ProcessPayment, antes da primeira chamada ao processador; aqui entra
+// como erro.
+func (wp *WorkerPool) recoverJob(ctx context.Context, j Job, result **types.ProcessorResult) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	metrics.Panics.Inc(metrics.PanicWorker)
+	wp.logger.ErrorContext(ctx, "payment processing panic recovered",
+		logging.KeyCorrelationID, j.Payment.CorrelationID,
+		"panic", fmt.Sprint(r),
+		"stack", string(debug.Stack()))
+
+	wp.processor.recordFailure()
+	*result = &types.ProcessorResult{
+		Success:     false,
+		ProcessorID: "none",
+		Error:       fmt.Errorf("panic: %v", r),
+		Reason:      reasonPanic,
+	}
+}
+
+// sendBulk chama o endpoint de lote; um pânico na chamada é recuperado e
+// retornado em panicked, para o chamador marcar o grupo como falho em vez
+// de arriscar um reenvio duplicado
+func (wp *WorkerPool) sendBulk(chunk []Job, payments []*types.PaymentRequest) (processorID string, handled []bool, panicked bool) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		metrics.Panics.Inc(metrics.PanicWorker)
+		wp.logger.Error("bulk payment processing panic recovered",
+			"bulk_size", len(chunk),
+			logging.KeyCorrelationID, chunk[0].Payment.CorrelationID,
+			"panic", fmt.Sprint(r),
+			"stack", string(debug.Stack()))
+		processorID, handled, panicked = "", make([]bool, len(chunk)), true
+	}()
+
+	processorID, handled = wp.processor.ProcessBulk(context.Background(), payments)
+	return processorID, handled, false
+}
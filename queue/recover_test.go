@@ -0,0 +1,66 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/store"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// panicTransport entra em pânico na chamada de payment com o correlationId
+// poison e repassa as demais, como um bug no client dos processadores
+type panicTransport struct {
+	next   http.RoundTripper
+	poison string
+}
+
+func (pt panicTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Body != nil {
+		body, _ := io.ReadAll(r.Body)
+		if bytes.Contains(body, []byte(pt.poison)) {
+			panic("injected panic for " + pt.poison)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	return pt.next.RoundTrip(r)
+}
+
+func TestWorkerSurvivesPaymentPanic(t *testing.T) {
+	fp := newFakeProcessor(t)
+	poison := newTestPayment(0)
+	poisonID := poison.CorrelationID // o payment volta zerado ao pool no fim
+
+	processor := NewPaymentProcessor(testProcessorConfig(fp, newFakeProcessor(t)), store.NewMemoryStore(store.MemoryOptions{}))
+	processor.client.Transport = panicTransport{next: processor.client.Transport, poison: poisonID}
+	cfg := testPoolConfig(1)
+	pool := NewWorkerPool(processor, NewRingBackend(cfg.QueueSize), cfg)
+	pool.Start()
+	t.Cleanup(pool.Stop)
+
+	before := metrics.Panics.Values()[metrics.PanicWorker]
+	pool.Submit(context.Background(), poison)
+	for i := 1; i <= 10; i++ {
+		if pool.Submit(context.Background(), newTestPayment(i)) != nil {
+			t.Fatalf("Submit refused payment %d", i)
+		}
+	}
+
+	// O único worker segue processando os payments depois do pânico
+	waitFor(t, 5*time.Second, "the payments after the panic", func() bool { return fp.calls.Load() == 10 })
+	if got := metrics.Panics.Values()[metrics.PanicWorker] - before; got != 1 {
+		t.Errorf("worker panics = %d, want 1", got)
+	}
+	waitFor(t, time.Second, "the poisoned payment to be marked failed", func() bool {
+		status, ok := pool.Lifecycle().Get(poisonID)
+		return ok && status.Status == types.StatusFailed && status.Reason == reasonPanic
+	})
+	if workers := pool.Workers(); workers != 1 {
+		t.Errorf("%d workers alive after the panic, want 1", workers)
+	}
+}
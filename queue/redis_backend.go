@@ -0,0 +1,348 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/tracing"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+const (
+	redisStreamKey   = "rinha:payments"
+	redisGroup       = "rinha-workers"
+	redisDedupPrefix = "rinha:done:"
+	redisDedupTTL    = 10 * time.Minute
+
+	// visibilityTimeout é o tempo sem ack após o qual um job é reentregue
+	visibilityTimeout = 30 * time.Second
+	redisFetchCount   = 50
+)
+
+// RedisBackend é uma fila durável sobre Redis Streams. Os jobs lidos ficam
+// pendentes no consumer group até o Ack; se a instância morrer, outra
+// instância os reivindica após o visibilityTimeout.
+type RedisBackend struct {
+	client     *redis.Client
+	consumer   string
+	capacity   atomic.Int64
+	length     int64 // XLEN amostrado periodicamente
+	room       atomic.Pointer[roomSignal]
+	deliveries chan Job
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+	closeOnce  sync.Once
+}
+
+// NewRedisBackend conecta no Redis e inicia a leitura da stream
+func NewRedisBackend(redisURL string, capacity int) (*RedisBackend, error) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, err
+	}
+	opts.DialTimeout = 200 * time.Millisecond
+
+	client := redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	// Criar o consumer group (e a stream) se ainda não existir
+	err = client.XGroupCreateMkStream(ctx, redisStreamKey, redisGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		client.Close()
+		return nil, fmt.Errorf("redis queue: %w", err)
+	}
+
+	hostname, _ := os.Hostname()
+	loopCtx, loopCancel := context.WithCancel(context.Background())
+
+	b := &RedisBackend{
+		client:     client,
+		consumer:   fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		deliveries: make(chan Job, redisFetchCount*2),
+		cancel:     loopCancel,
+	}
+	b.capacity.Store(int64(capacity))
+
+	b.wg.Add(3)
+	go b.fetchLoop(loopCtx)
+	go b.reclaimLoop(loopCtx)
+	go b.lengthLoop(loopCtx)
+
+	return b, nil
+}
+
+// Push adiciona o payment na stream, rejeitando se a fila estiver cheia
+func (b *RedisBackend) Push(job Job) bool {
+	if atomic.LoadInt64(&b.length) >= b.capacity.Load() {
+		return false
+	}
+
+	payload, err := job.Payment.ToJSON()
+	if err != nil {
+		return false
+	}
+
+	values := map[string]interface{}{"payload": payload}
+	if traceParent := tracing.FormatTraceParent(job.spanContext); traceParent != "" {
+		values["traceparent"] = traceParent
+	}
+	if job.requestID != "" {
+		values["request_id"] = job.requestID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err = b.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: redisStreamKey,
+		Values: values,
+	}).Err()
+	if err != nil {
+		if ok, n := logging.DefaultSampler().Allow("redis_queue_push"); ok {
+			slog.Error("redis queue push failed", "error", err, logging.KeyOccurrences, n)
+		}
+		return false
+	}
+
+	// O payment já foi serializado na stream; o worker recebe uma cópia
+	// decodificada, então o original volta ao pool
+	types.ReleasePayment(job.Payment)
+
+	atomic.AddInt64(&b.length, 1)
+	return true
+}
+
+// Deliveries retorna os jobs lidos da stream
+func (b *RedisBackend) Deliveries() <-chan Job {
+	return b.deliveries
+}
+
+// Ack remove o job da stream e registra o correlationId para deduplicação
+func (b *RedisBackend) Ack(job Job) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	pipe := b.client.Pipeline()
+	pipe.XAck(ctx, redisStreamKey, redisGroup, job.ackID)
+	pipe.XDel(ctx, redisStreamKey, job.ackID)
+	if job.Payment.CorrelationID != "" {
+		pipe.Set(ctx, redisDedupPrefix+job.Payment.CorrelationID, 1, redisDedupTTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		// Sem ack o job será reentregue e filtrado pela deduplicação
+		slog.WarnContext(job.context(), "redis queue ack failed", "id", job.ackID, logging.KeyCorrelationID, job.Payment.CorrelationID, "error", err)
+	}
+}
+
+// Len retorna o XLEN amostrado da stream
+func (b *RedisBackend) Len() int {
+	return int(atomic.LoadInt64(&b.length))
+}
+
+// Cap retorna a capacidade atual da fila
+func (b *RedisBackend) Cap() int {
+	return int(b.capacity.Load())
+}
+
+// SetCap muda a capacidade da fila nesta instância. Como a do boot, ela é
+// conferida contra o XLEN amostrado, que inclui os jobs das outras
+// instâncias.
+func (b *RedisBackend) SetCap(capacity int) {
+	b.capacity.Store(int64(capacity))
+}
+
+// Close para a leitura e fecha a conexão. Jobs já lidos e não confirmados
+// continuam pendentes no Redis e serão reentregues.
+func (b *RedisBackend) Close() {
+	b.closeOnce.Do(func() {
+		b.cancel()
+		b.wg.Wait()
+		close(b.deliveries)
+		b.client.Close()
+	})
+}
+
+// fetchLoop lê novos jobs da stream via consumer group
+func (b *RedisBackend) fetchLoop(ctx context.Context) {
+	defer b.wg.Done()
+
+	for ctx.Err() == nil {
+		streams, err := b.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    redisGroup,
+			Consumer: b.consumer,
+			Streams:  []string{redisStreamKey, ">"},
+			Count:    redisFetchCount,
+			Block:    time.Second,
+		}).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) || ctx.Err() != nil {
+				continue
+			}
+			slog.Warn("redis queue read failed", "error", err)
+			sleepCtx(ctx, 500*time.Millisecond)
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				if !b.deliver(ctx, msg, false) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// reclaimLoop reivindica jobs pendentes há mais tempo que o visibilityTimeout,
+// como os de um worker ou instância que morreu no meio do processamento
+func (b *RedisBackend) reclaimLoop(ctx context.Context) {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(visibilityTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		start := "0-0"
+		for {
+			msgs, next, err := b.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+				Stream:   redisStreamKey,
+				Group:    redisGroup,
+				Consumer: b.consumer,
+				MinIdle:  visibilityTimeout,
+				Start:    start,
+				Count:    redisFetchCount,
+			}).Result()
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Warn("redis queue reclaim failed", "error", err)
+				}
+				break
+			}
+
+			for _, msg := range msgs {
+				if !b.deliver(ctx, msg, true) {
+					return
+				}
+			}
+
+			if next == "0-0" || len(msgs) == 0 {
+				break
+			}
+			start = next
+		}
+	}
+}
+
+// notifyRoom registra o aviso de vaga do pool
+func (b *RedisBackend) notifyRoom(room *roomSignal) {
+	b.room.Store(room)
+}
+
+// lengthLoop amostra o XLEN para o controle de capacidade e o GetQueueSize
+func (b *RedisBackend) lengthLoop(ctx context.Context) {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := b.client.XLen(ctx, redisStreamKey).Result(); err == nil {
+				atomic.StoreInt64(&b.length, n)
+				// A vaga pode ter aberto pelos workers de outra instância
+				if room := b.room.Load(); room != nil && n < b.capacity.Load() {
+					room.notify()
+				}
+			}
+		}
+	}
+}
+
+// deliver decodifica a mensagem e entrega ao pool. Jobs reentregues já
+// processados (correlationId marcado no ack) são descartados.
+func (b *RedisBackend) deliver(ctx context.Context, msg redis.XMessage, redelivered bool) bool {
+	payload, _ := msg.Values["payload"].(string)
+
+	payment := types.AcquirePayment()
+	if err := types.DecodePayment([]byte(payload), payment); err != nil {
+		types.ReleasePayment(payment)
+		slog.Warn("redis queue dropped invalid payload", "id", msg.ID, "error", err)
+		b.client.XAck(ctx, redisStreamKey, redisGroup, msg.ID)
+		b.client.XDel(ctx, redisStreamKey, msg.ID)
+		return true
+	}
+
+	if redelivered && payment.CorrelationID != "" {
+		done, err := b.client.Exists(ctx, redisDedupPrefix+payment.CorrelationID).Result()
+		if err == nil && done > 0 {
+			types.ReleasePayment(payment)
+			b.client.XAck(ctx, redisStreamKey, redisGroup, msg.ID)
+			b.client.XDel(ctx, redisStreamKey, msg.ID)
+			return true
+		}
+	}
+
+	select {
+	case b.deliveries <- b.newJob(payment, msg):
+		return true
+	case <-ctx.Done():
+		types.ReleasePayment(payment)
+		return false
+	}
+}
+
+// newJob monta o job a partir da mensagem lida da stream
+func (b *RedisBackend) newJob(payment *types.PaymentRequest, msg redis.XMessage) Job {
+	traceParent, _ := msg.Values["traceparent"].(string)
+	requestID, _ := msg.Values["request_id"].(string)
+	return Job{
+		Payment:     payment,
+		ackID:       msg.ID,
+		spanContext: tracing.ParseTraceParent(traceParent),
+		requestID:   requestID,
+		enqueuedAt:  streamIDTime(msg.ID),
+	}
+}
+
+// streamIDTime extrai o momento do XADD do id da mensagem (<ms>-<seq>).
+// Ids ilegíveis resultam no tempo zero, que o TTL não considera vencido.
+func streamIDTime(id string) time.Time {
+	ms, _, _ := strings.Cut(id, "-")
+	n, err := strconv.ParseInt(ms, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(n)
+}
+
+// sleepCtx dorme pelo tempo informado ou até o contexto ser cancelado
+func sleepCtx(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
@@ -0,0 +1,209 @@
+package queue
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// Uma réplica sai do rodízio depois de replicaEjectFailures falhas
+// seguidas e recebe um ping do HealthChecker a cada replicaEjectTime até
+// responder
+const (
+	replicaEjectFailures = 3
+	replicaEjectTime     = time.Second
+)
+
+// replica é uma das URLs de um processador
+type replica struct {
+	url  string
+	addr string // "host:porta", para os logs e o /admin/processors
+
+	inflight  atomic.Int64 // chamadas de payment em andamento
+	failures  atomic.Int64 // falhas seguidas
+	ejected   atomic.Bool
+	probeAt   atomic.Int64 // UnixNano do próximo ping, ejetada
+	requests  atomic.Int64
+	errors    atomic.Int64
+	ejections atomic.Int64
+	lastErr   atomic.Pointer[string]
+}
+
+// replicaSet são as réplicas de um processador lógico. Cada chamada de
+// payment vai à réplica com menos chamadas em andamento, em rodízio entre
+// as empatadas; uma réplica com replicaEjectFailures falhas seguidas sai do
+// rodízio sem afetar a saúde do processador, que só conta o desfecho final
+// de cada chamada. Com uma réplica só, nada disso acontece.
+type replicaSet struct {
+	processorID string
+	replicas    []*replica
+	next        atomic.Uint32
+	logger      *slog.Logger
+}
+
+// newReplicaSet cria as réplicas do processador, na ordem das URLs
+func newReplicaSet(processorID string, urls []string) *replicaSet {
+	s := &replicaSet{
+		processorID: processorID,
+		replicas:    make([]*replica, len(urls)),
+		logger:      slog.Default(),
+	}
+	for i, url := range urls {
+		addr, _ := dialAddr(url)
+		s.replicas[i] = &replica{url: url, addr: addr}
+	}
+	return s
+}
+
+// urls retorna as URLs das réplicas, na ordem da configuração
+func (s *replicaSet) urls() []string {
+	urls := make([]string, len(s.replicas))
+	for i, r := range s.replicas {
+		urls[i] = r.url
+	}
+	return urls
+}
+
+// acquire escolhe a réplica da próxima chamada, fora as de tried, e a conta
+// como em andamento até o release; nil quando não sobra nenhuma. Com todas
+// as restantes ejetadas, uma delas é usada mesmo assim: o circuit breaker
+// do processador é quem decide tirá-lo do roteamento.
+func (s *replicaSet) acquire(tried []*replica) *replica {
+	var best, ejected *replica
+	start := int(s.next.Add(1) - 1)
+	for i := range s.replicas {
+		r := s.replicas[(start+i)%len(s.replicas)]
+		if containsReplica(tried, r) {
+			continue
+		}
+		if r.ejected.Load() {
+			if ejected == nil {
+				ejected = r
+			}
+			continue
+		}
+		if best == nil || r.inflight.Load() < best.inflight.Load() {
+			best = r
+		}
+	}
+	if best == nil {
+		best = ejected
+	}
+	if best != nil {
+		best.inflight.Add(1)
+		best.requests.Add(1)
+	}
+	return best
+}
+
+func containsReplica(replicas []*replica, r *replica) bool {
+	for _, other := range replicas {
+		if other == r {
+			return true
+		}
+	}
+	return false
+}
+
+// release encerra a chamada à réplica
+func (r *replica) release() {
+	r.inflight.Add(-1)
+}
+
+// succeeded zera as falhas seguidas da réplica
+func (s *replicaSet) succeeded(r *replica) {
+	r.failures.Store(0)
+	if r.ejected.Load() {
+		s.readmit(r)
+	}
+}
+
+// failed conta uma falha da réplica e a ejeta na replicaEjectFailures-ésima
+// seguida; com uma réplica só, a falha é só do processador
+func (s *replicaSet) failed(r *replica, err error) {
+	r.errors.Add(1)
+	message := err.Error()
+	r.lastErr.Store(&message)
+	if len(s.replicas) == 1 || r.failures.Add(1) < replicaEjectFailures {
+		return
+	}
+	if !r.ejected.CompareAndSwap(false, true) {
+		return
+	}
+	r.probeAt.Store(time.Now().Add(replicaEjectTime).UnixNano())
+	r.ejections.Add(1)
+	s.logger.Warn("processor replica ejected",
+		logging.KeyProcessor, s.processorID,
+		"replica", r.addr,
+		"failures", r.failures.Load(),
+		"error", message,
+		"probe_in_ms", replicaEjectTime.Milliseconds())
+}
+
+// readmit devolve a réplica ao rodízio
+func (s *replicaSet) readmit(r *replica) {
+	if !r.ejected.CompareAndSwap(true, false) {
+		return
+	}
+	r.failures.Store(0)
+	s.logger.Info("processor replica readmitted",
+		logging.KeyProcessor, s.processorID,
+		"replica", r.addr)
+}
+
+// probeDue retorna as réplicas ejetadas cujo ping venceu, já adiando o
+// próximo por replicaEjectTime
+func (s *replicaSet) probeDue(now time.Time) []*replica {
+	var due []*replica
+	for _, r := range s.replicas {
+		if !r.ejected.Load() {
+			continue
+		}
+		at := r.probeAt.Load()
+		if now.UnixNano() >= at && r.probeAt.CompareAndSwap(at, now.Add(replicaEjectTime).UnixNano()) {
+			due = append(due, r)
+		}
+	}
+	return due
+}
+
+// preferred é a réplica das consultas que valem para o processador todo
+// (service-health): a primeira no rodízio
+func (s *replicaSet) preferred() *replica {
+	for _, r := range s.replicas {
+		if !r.ejected.Load() {
+			return r
+		}
+	}
+	return s.replicas[0]
+}
+
+// stats retorna o estado de cada réplica; nil com uma só
+func (s *replicaSet) stats() []types.ProcessorReplica {
+	if len(s.replicas) == 1 {
+		return nil
+	}
+	stats := make([]types.ProcessorReplica, len(s.replicas))
+	for i, r := range s.replicas {
+		stats[i] = types.ProcessorReplica{
+			Addr:      r.addr,
+			Healthy:   !r.ejected.Load(),
+			InFlight:  r.inflight.Load(),
+			Requests:  r.requests.Load(),
+			Errors:    r.errors.Load(),
+			Failures:  r.failures.Load(),
+			Ejections: r.ejections.Load(),
+		}
+		if r.ejected.Load() {
+			probeAt := time.Unix(0, r.probeAt.Load()).UTC()
+			stats[i].ProbeAt = &probeAt
+		}
+		if lastErr := r.lastErr.Load(); lastErr != nil {
+			stats[i].LastError = *lastErr
+		}
+	}
+	return stats
+}
@@ -0,0 +1,116 @@
+package queue
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// retryPolicy são as novas tentativas após uma falha de conexão
+type retryPolicy struct {
+	max       int           // novas tentativas por chamada; 0 desliga
+	delay     time.Duration // espera média antes de cada uma
+	afterSend bool          // repete mesmo se o corpo já foi enviado
+}
+
+func newRetryPolicy(cfg ProcessorConfig) retryPolicy {
+	return retryPolicy{max: cfg.Retries, delay: cfg.RetryDelay, afterSend: cfg.RetryAfterSend}
+}
+
+// jitter sorteia a espera entre metade e uma vez e meia de delay
+func (r retryPolicy) jitter() time.Duration {
+	if r.delay <= 0 {
+		return 0
+	}
+	return r.delay/2 + rand.N(r.delay)
+}
+
+// doPayment chama target repetindo só falhas de conexão; retorna a última réplica
+func (p *PaymentProcessor) doPayment(ctx context.Context, req *http.Request, target *replica, processorID string, payment *types.PaymentRequest, replicas *replicaSet, m *metrics.ProcessorMetrics) (*http.Response, *replica, error) {
+	tried := []*replica{target}
+	for retry := 0; ; {
+		var sent atomic.Bool // o Transport chama o WroteRequest de outra goroutine
+		canRetry := retry < p.retry.max || len(tried) < len(replicas.replicas)
+		if canRetry && !p.retry.afterSend {
+			req = req.WithContext(httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+				WroteRequest: func(info httptrace.WroteRequestInfo) {
+					if info.Err == nil {
+						sent.Store(true)
+					}
+				},
+			}))
+		}
+
+		resp, err := p.client.Do(req)
+		if (retry > 0 || len(tried) > 1) && err == nil {
+			m.Retries.Inc(metrics.RetrySucceeded)
+		}
+		if err == nil || !canRetry || classifyTransportError(err) != metrics.ClassConnection {
+			return resp, target, err
+		}
+		// Corpo já enviado: o processador pode ter recebido o payment
+		if sent.Load() {
+			m.Retries.Inc(metrics.RetrySkipped)
+			return nil, target, err
+		}
+
+		// Outra réplica, se houver, na hora: a falha foi desta
+		if ctx.Err() != nil {
+			return nil, target, err
+		}
+		if next := replicas.acquire(tried); next != nil {
+			replicas.failed(target, err)
+			target.release()
+			target = next
+			tried = append(tried, next)
+			retryReq, buildErr := p.newPaymentRequest(ctx, target.url, processorID, payment)
+			if buildErr != nil {
+				return nil, target, err
+			}
+			req = retryReq
+			m.Retries.Inc(metrics.RetryFailover)
+			continue
+		}
+		if retry >= p.retry.max {
+			return nil, target, err
+		}
+
+		delay := p.retry.jitter()
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+			return nil, target, err
+		}
+		if !sleepContext(ctx, delay) {
+			return nil, target, err
+		}
+
+		// O corpo anterior já foi fechado pelo Transport
+		next, buildErr := p.newPaymentRequest(ctx, target.url, processorID, payment)
+		if buildErr != nil {
+			return nil, target, err
+		}
+		req = next
+		retry++
+		m.Retries.Inc(metrics.RetryAttempted)
+	}
+}
+
+// sleepContext espera d ou o fim de ctx; false se ctx terminou antes
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,210 @@
+package queue
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// ringMinSize é o tamanho inicial do ring de excedentes; ele cresce
+// conforme a fila passa do channel e volta a diminuir quando ela drena
+const ringMinSize = 1024
+
+// RingBackend é a fila em memória padrão, com capacidade que muda em
+// execução. Um channel não muda de tamanho, então a fila tem duas partes: o
+// channel de entrega, do tamanho da capacidade do boot, e um ring buffer
+// para o que passar dele depois de a capacidade aumentar, que um dispatcher
+// esvazia no channel conforme os workers o drenam. Com o ring vazio e a
+// capacidade cobrindo o channel, o Push é só o envio não-bloqueante no
+// channel, o mesmo custo de uma fila só de channel. Reduzida, a capacidade
+// só recusa os próximos jobs até a fila drenar abaixo dela: nada do que já
+// está na fila é descartado.
+type RingBackend struct {
+	out      chan Job
+	capacity atomic.Int64
+	pending  atomic.Int64 // jobs no ring, inclusive o que o dispatcher tem em mãos
+
+	mu   sync.Mutex // protege o ring; serializa os Push que não cabem no caminho rápido
+	buf  []Job
+	head int
+
+	wake      chan struct{} // avisa o dispatcher de jobs novos no ring
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewRingBackend cria a fila em memória com a capacidade informada
+func NewRingBackend(capacity int) *RingBackend {
+	b := &RingBackend{
+		out:  make(chan Job, capacity),
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	b.capacity.Store(int64(capacity))
+	go b.dispatch()
+	return b
+}
+
+// Push enfileira de forma não-bloqueante. Com o ring vazio e a capacidade
+// pelo menos do tamanho do channel, o próprio channel limita a fila; nos
+// demais casos a conta é feita com o lock, somando o ring e o channel.
+func (b *RingBackend) Push(job Job) bool {
+	if b.pending.Load() == 0 && b.capacity.Load() >= int64(cap(b.out)) {
+		select {
+		case b.out <- job:
+			return true
+		default:
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	pending := b.pending.Load()
+	if pending+int64(len(b.out)) >= b.capacity.Load() {
+		return false // fila cheia
+	}
+	if pending == 0 {
+		select {
+		case b.out <- job:
+			return true
+		default:
+		}
+	}
+	b.pushBack(job)
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// pushBack põe o job no fim do ring, dobrando o ring se ele estiver cheio;
+// com o lock
+func (b *RingBackend) pushBack(job Job) {
+	n := int(b.pending.Load())
+	if n == len(b.buf) {
+		b.resize(max(2*len(b.buf), ringMinSize))
+	}
+	b.buf[(b.head+n)%len(b.buf)] = job
+	b.pending.Add(1)
+}
+
+// popFront retira o job do início do ring e, com o ring quase vazio,
+// devolve metade da memória; com o lock
+func (b *RingBackend) popFront() {
+	b.buf[b.head] = Job{}
+	b.head = (b.head + 1) % len(b.buf)
+	n := int(b.pending.Add(-1))
+
+	if len(b.buf) > ringMinSize && n <= len(b.buf)/4 {
+		b.resize(len(b.buf) / 2)
+	}
+}
+
+// resize copia os jobs do ring para um novo de size posições; com o lock
+func (b *RingBackend) resize(size int) {
+	n := int(b.pending.Load())
+	buf := make([]Job, size)
+	if n > 0 {
+		copied := copy(buf, b.buf[b.head:min(b.head+n, len(b.buf))])
+		copy(buf[copied:], b.buf[:n-copied])
+	}
+	b.buf, b.head = buf, 0
+}
+
+// dispatch passa os jobs do ring para o channel, na ordem. Um job só sai do
+// ring depois de entregue, então o Push só vai direto ao channel com o ring
+// vazio e a ordem de chegada é mantida.
+func (b *RingBackend) dispatch() {
+	defer close(b.out)
+
+	for {
+		b.mu.Lock()
+		for b.pending.Load() > 0 && b.offer(b.buf[b.head]) {
+			b.popFront()
+		}
+		var job Job
+		pending := b.pending.Load() > 0
+		if pending {
+			job = b.buf[b.head]
+		}
+		b.mu.Unlock()
+
+		if !pending {
+			select {
+			case <-b.wake:
+			case <-b.done:
+				return
+			}
+			continue
+		}
+
+		select {
+		case b.out <- job:
+			b.mu.Lock()
+			b.popFront()
+			b.mu.Unlock()
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// offer entrega o job se o channel tem espaço, sem bloquear
+func (b *RingBackend) offer(job Job) bool {
+	select {
+	case b.out <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// Deliveries retorna o channel da fila
+func (b *RingBackend) Deliveries() <-chan Job {
+	return b.out
+}
+
+// Ack não faz nada: itens em memória não são reentregues
+func (b *RingBackend) Ack(job Job) {}
+
+// Len retorna os jobs no channel e no ring
+func (b *RingBackend) Len() int {
+	return len(b.out) + int(b.pending.Load())
+}
+
+// Cap retorna a capacidade atual da fila
+func (b *RingBackend) Cap() int {
+	return int(b.capacity.Load())
+}
+
+// SetCap muda a capacidade da fila. Acima da ocupação atual vale na hora;
+// abaixo dela, o Push recusa até a fila drenar.
+func (b *RingBackend) SetCap(capacity int) {
+	b.capacity.Store(int64(capacity))
+}
+
+// Close para o dispatcher, que fecha o channel. O Push não pode ser chamado
+// depois dele; o WorkerPool garante isso.
+func (b *RingBackend) Close() {
+	b.closeOnce.Do(func() { close(b.done) })
+}
+
+// Drain retorna os jobs que ficaram na fila; só depois do Close e com os
+// workers parados. O fechamento do channel garante que o dispatcher já
+// parou.
+func (b *RingBackend) Drain() []Job {
+	jobs := make([]Job, 0, b.Len())
+	for job := range b.out {
+		jobs = append(jobs, job)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.pending.Load() > 0 {
+		jobs = append(jobs, b.buf[b.head])
+		b.popFront()
+	}
+	return jobs
+}
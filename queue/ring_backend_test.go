@@ -0,0 +1,241 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// ringJob é um job identificado pelo amount, para conferir a ordem
+func ringJob(i int) Job {
+	return Job{Payment: &types.PaymentRequest{Amount: i}}
+}
+
+// pushRange enfileira os jobs de first a last, inclusive, falhando o teste
+// na primeira recusa
+func pushRange(t *testing.T, b *RingBackend, first, last int) {
+	t.Helper()
+	for i := first; i <= last; i++ {
+		if !b.Push(ringJob(i)) {
+			t.Fatalf("Push(%d) refused with %d of %d queued", i, b.Len(), b.Cap())
+		}
+	}
+}
+
+// receive retira n jobs da fila e confere que vêm a partir de first, na
+// ordem
+func receive(t *testing.T, b *RingBackend, first, n int) {
+	t.Helper()
+	for i := first; i < first+n; i++ {
+		select {
+		case j := <-b.Deliveries():
+			if j.Payment.Amount != i {
+				t.Fatalf("received job %d, want %d", j.Payment.Amount, i)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("job %d never delivered", i)
+		}
+	}
+}
+
+func TestRingBackendResize(t *testing.T) {
+	b := NewRingBackend(4)
+	defer b.Close()
+
+	pushRange(t, b, 0, 3)
+	if b.Push(ringJob(4)) {
+		t.Fatal("Push accepted a 5th job with capacity 4")
+	}
+
+	// Aumentada, vale na hora: o excedente vai para o ring
+	b.SetCap(10)
+	pushRange(t, b, 4, 9)
+	if b.Push(ringJob(10)) || b.Len() != 10 {
+		t.Fatalf("len %d after filling capacity 10, want the 11th job refused", b.Len())
+	}
+
+	// Reduzida abaixo da ocupação, só recusa até a fila drenar
+	b.SetCap(3)
+	if b.Push(ringJob(10)) {
+		t.Fatal("Push accepted a job with 10 queued and capacity 3")
+	}
+	receive(t, b, 0, 7)
+	if b.Push(ringJob(10)) {
+		t.Fatalf("Push accepted a job with %d queued and capacity 3", b.Len())
+	}
+	receive(t, b, 7, 1)
+	waitFor(t, time.Second, "the ring to reach the channel", func() bool { return b.Len() == 2 })
+	pushRange(t, b, 10, 10)
+
+	// Nada se perdeu e a ordem de chegada ficou
+	receive(t, b, 8, 3)
+	if b.Len() != 0 {
+		t.Errorf("len = %d after receiving everything", b.Len())
+	}
+}
+
+func TestRingBackendKeepsOrderWhileGrowing(t *testing.T) {
+	b := NewRingBackend(8)
+	defer b.Close()
+	b.SetCap(100_000) // a maior parte passa pelo ring
+
+	const jobs = 50_000
+	go func() {
+		for i := range jobs {
+			if !b.Push(ringJob(i)) {
+				t.Errorf("Push(%d) refused with %d of %d queued", i, b.Len(), b.Cap())
+				return
+			}
+		}
+	}()
+	receive(t, b, 0, jobs)
+}
+
+func TestRingBackendDrainIncludesRing(t *testing.T) {
+	b := NewRingBackend(4)
+	b.SetCap(2000)
+	pushRange(t, b, 0, 1999) // o ring cresce além do tamanho inicial
+
+	b.Close()
+	jobs := b.Drain()
+	if len(jobs) != 2000 {
+		t.Fatalf("drained %d jobs, want 2000", len(jobs))
+	}
+	for i, j := range jobs {
+		if j.Payment.Amount != i {
+			t.Fatalf("drained job %d at position %d", j.Payment.Amount, i)
+		}
+	}
+}
+
+func TestSetQueueCapacity(t *testing.T) {
+	cfg := testPoolConfig(1)
+	cfg.QueueSize = 5
+	processor := newFakeProcessor(t)
+	pool := newTestPool(t, testProcessorConfig(processor, newFakeProcessor(t)), cfg)
+	pool.Pause()
+
+	submit := func(from, to int) int {
+		accepted := 0
+		for i := from; i < to; i++ {
+			if pool.Submit(context.Background(), newTestPayment(i)) == nil {
+				accepted++
+			}
+		}
+		return accepted
+	}
+	if got := submit(0, 6); got != 5 {
+		t.Fatalf("accepted %d payments with capacity 5", got)
+	}
+
+	got, err := pool.SetQueueCapacity(8)
+	if err != nil || got != (types.QueueCapacity{Capacity: 8, PreviousCapacity: 5, QueueDepth: 5}) {
+		t.Fatalf("SetQueueCapacity(8) = %+v, %v", got, err)
+	}
+	if got := submit(6, 10); got != 3 || pool.GetQueueSize() != 8 || pool.GetQueueCapacity() != 8 {
+		t.Fatalf("accepted %d more, queue %d of %d; want 3 and 8 of 8", got, pool.GetQueueSize(), pool.GetQueueCapacity())
+	}
+
+	// Reduzida, recusa sem descartar; todos os 8 são processados
+	if _, err := pool.SetQueueCapacity(2); err != nil {
+		t.Fatal(err)
+	}
+	if got := submit(10, 12); got != 0 || pool.GetQueueSize() != 8 {
+		t.Fatalf("accepted %d with 8 queued and capacity 2, queue %d", got, pool.GetQueueSize())
+	}
+	pool.Resume()
+	waitFor(t, 5*time.Second, "the queued payments", func() bool { return processor.calls.Load() == 8 })
+	waitFor(t, time.Second, "room in the queue", func() bool { return submit(12, 13) == 1 })
+
+	for _, capacity := range []int{0, -1} {
+		if _, err := pool.SetQueueCapacity(capacity); !errors.Is(err, ErrInvalidCapacity) {
+			t.Errorf("SetQueueCapacity(%d) = %v, want ErrInvalidCapacity", capacity, err)
+		}
+	}
+
+	priority := NewWorkerPool(pool.processor, NewPriorityBackend(10, 1000, time.Second), cfg)
+	if _, err := priority.SetQueueCapacity(20); !errors.Is(err, ErrQueueNotResizable) {
+		t.Errorf("SetQueueCapacity on the priority queue = %v, want ErrQueueNotResizable", err)
+	}
+}
+
+// benchmarkQueue mede o caminho quente: producers enfileiram sem bloquear
+// (repetindo na recusa) e 4 consumidores retiram
+func benchmarkQueue(b *testing.B, producers int, push func(Job) bool, deliveries <-chan Job) {
+	var consumers sync.WaitGroup
+	stop := make(chan struct{})
+	var count sync.WaitGroup
+	count.Add(b.N)
+	for range 4 {
+		consumers.Add(1)
+		go func() {
+			defer consumers.Done()
+			for {
+				select {
+				case <-deliveries:
+					count.Done()
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+
+	job := ringJob(1)
+	per := b.N / producers
+	b.ResetTimer()
+	var wg sync.WaitGroup
+	for p := range producers {
+		n := per
+		if p == 0 {
+			n += b.N % producers
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range n {
+				for !push(job) {
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	count.Wait()
+	b.StopTimer()
+	close(stop)
+	consumers.Wait()
+}
+
+func BenchmarkQueuePush(b *testing.B) {
+	const capacity = 10_000
+	for _, producers := range []int{1, 8} {
+		b.Run(fmt.Sprintf("channel/producers=%d", producers), func(b *testing.B) {
+			ch := make(chan Job, capacity)
+			push := func(j Job) bool {
+				select {
+				case ch <- j:
+					return true
+				default:
+					return false
+				}
+			}
+			benchmarkQueue(b, producers, push, ch)
+		})
+		b.Run(fmt.Sprintf("ring/producers=%d", producers), func(b *testing.B) {
+			ring := NewRingBackend(capacity)
+			defer ring.Close()
+			benchmarkQueue(b, producers, ring.Push, ring.Deliveries())
+		})
+		b.Run(fmt.Sprintf("ring-grown/producers=%d", producers), func(b *testing.B) {
+			ring := NewRingBackend(capacity / 10)
+			defer ring.Close()
+			ring.SetCap(capacity)
+			benchmarkQueue(b, producers, ring.Push, ring.Deliveries())
+		})
+	}
+}
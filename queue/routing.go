@@ -0,0 +1,197 @@
+package queue
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// reasonRouteUnavailable é a falha de um payment cujo type tem regra de
+// roteamento e nenhum dos processadores dela está saudável
+const reasonRouteUnavailable = "route_unavailable"
+
+var errRouteUnavailable = errors.New("no processor allowed for the payment type is healthy")
+
+// Espera de um payment sem processador permitido saudável antes de tentar
+// de novo. O estado dos processadores só muda a cada tick do health check,
+// então tentar antes disso não adianta; ao contrário do rate limit, a fila
+// não para: os demais types seguem.
+const routeRetryDelay = healthProbeTick
+
+// RoutingRule restringe os payments de Type aos Processors, tentados na
+// ordem
+type RoutingRule struct {
+	Type       string
+	Processors []string
+}
+
+// route é um processador na ordem de tentativa de um type
+type route struct {
+	processorID string
+	status      *ProcessorStatus
+}
+
+// router guarda a ordem de tentativa de cada type, montada no boot: a dos
+// types com regra e a global (default e depois fallback) para os demais,
+// que com pesos começa pelo processador sorteado e com sticky, pelo do
+// hash do correlationId
+type router struct {
+	global  []route
+	orders  [][]route // orders[i]: a global com o processador i na frente
+	rules   map[string][]route
+	sticky  bool
+	weights atomic.Pointer[routeWeights]
+	held    atomic.Int64
+}
+
+// newRouter monta as rotas das regras e guarda os pesos do boot; os nomes
+// já foram validados pelo config. Os labels por type das métricas são
+// definidos uma vez no boot, ver metrics.UseRoutedTypes.
+func newRouter(rules []RoutingRule, strategy string, weights []int64, statuses map[string]*ProcessorStatus) *router {
+	r := &router{
+		global: []route{{"default", statuses["default"]}, {"fallback", statuses["fallback"]}},
+		rules:  make(map[string][]route, len(rules)),
+		sticky: strategy == RoutingSticky,
+	}
+	for i, first := range r.global {
+		order := []route{first}
+		for j, other := range r.global {
+			if j != i {
+				order = append(order, other)
+			}
+		}
+		r.orders = append(r.orders, order)
+	}
+	r.weights.Store(r.newRouteWeights(weights))
+	for _, rule := range rules {
+		routes := make([]route, 0, len(rule.Processors))
+		for _, processorID := range rule.Processors {
+			routes = append(routes, route{processorID, statuses[processorID]})
+		}
+		r.rules[rule.Type] = routes
+	}
+	return r
+}
+
+// lookup retorna a ordem de tentativa do type e se ela vem de uma regra.
+// Sem PAYMENT_TYPES o type chega como o cliente mandou, por isso a busca é
+// em minúsculas, como as regras.
+func (r *router) lookup(paymentType string) ([]route, bool) {
+	if len(r.rules) > 0 {
+		if routes, ok := r.rules[strings.ToLower(paymentType)]; ok {
+			return routes, true
+		}
+	}
+	return r.global, false
+}
+
+// order retorna a ordem de tentativa do payment: a da regra do type ou,
+// sem regra, a global começando pelo processador do hash do correlationId
+// (sticky) ou pelo sorteado pelos pesos
+func (r *router) order(payment *types.PaymentRequest) ([]route, bool) {
+	if routes, ok := r.lookup(payment.Type); ok {
+		return routes, true
+	}
+	if r.sticky {
+		return r.stuck(payment.CorrelationID), false
+	}
+	return r.weighted(), false
+}
+
+// stuck retorna a ordem global com o processador do correlationId na
+// frente, contando a escolha
+func (r *router) stuck(correlationID string) []route {
+	i := r.stick(correlationID)
+	metrics.Processor(r.global[i].processorID).Sticky.Inc()
+	return r.orders[i]
+}
+
+// index retorna a posição do processador em global; -1 se desconhecido
+func (r *router) index(processorID string) int {
+	for i, route := range r.global {
+		if route.processorID == processorID {
+			return i
+		}
+	}
+	return -1
+}
+
+// label retorna o type do rinha_processor_payments_by_type_total
+func (r *router) label(paymentType string) string {
+	if _, ok := r.lookup(paymentType); ok {
+		return strings.ToLower(paymentType)
+	}
+	return metrics.PaymentTypeOther
+}
+
+// preferred retorna o primeiro processador saudável da ordem; "" sem
+// nenhum
+func preferred(routes []route) string {
+	for _, route := range routes {
+		if route.status.Healthy() {
+			return route.processorID
+		}
+	}
+	return ""
+}
+
+// RoutingStats retorna a estratégia, as regras e os payments aceitos por
+// type em cada processador
+func (p *PaymentProcessor) RoutingStats() types.RoutingStats {
+	stats := types.RoutingStats{
+		Strategy: RoutingPriority,
+		Rules:    make(map[string][]string, len(p.routes.rules)),
+		ByType:   make(map[string]map[string]int64, len(p.routes.global)),
+		Held:     p.routes.held.Load(),
+	}
+	if p.routes.sticky {
+		stats.Strategy = RoutingSticky
+		stats.Sticky = make(map[string]int64, len(p.routes.global))
+		for _, route := range p.routes.global {
+			stats.Sticky[route.processorID] = metrics.Processor(route.processorID).Sticky.Value()
+		}
+	}
+	for paymentType, routes := range p.routes.rules {
+		processors := make([]string, len(routes))
+		for i, route := range routes {
+			processors[i] = route.processorID
+		}
+		stats.Rules[paymentType] = processors
+	}
+	for _, route := range p.routes.global {
+		stats.ByType[route.processorID] = metrics.Processor(route.processorID).Types.Values()
+	}
+	return stats
+}
+
+// retryRoute tenta de novo, depois de routeRetryDelay, um job sem
+// processador permitido saudável para o seu type. Como no retryThrottled,
+// o job segue sujeito ao QueueTTL e ao orçamento de tentativas; com o pool
+// parando ele falha como reasonRouteUnavailable.
+func (wp *WorkerPool) retryRoute(stats *workerStats, j Job) {
+	wp.processor.routes.held.Add(1)
+	wp.wg.Add(1)
+	time.AfterFunc(routeRetryDelay, func() {
+		defer wp.wg.Done()
+
+		if wp.ctx.Err() != nil {
+			wp.processor.recordAttempt()
+			wp.processor.recordFailure()
+			wp.complete(stats, j, &types.ProcessorResult{
+				ProcessorID: "none",
+				Reason:      reasonRouteUnavailable,
+				Error:       errRouteUnavailable,
+			})
+			return
+		}
+		if wp.expired(j) {
+			wp.expire(stats, j)
+			return
+		}
+		wp.attempt(stats, j)
+	})
+}
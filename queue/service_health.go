@@ -0,0 +1,150 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/cluster"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// ServiceHealthInterval respeita o rate limit de 1 chamada a cada 5s do
+// GET /payments/service-health de cada processador
+const ServiceHealthInterval = 5 * time.Second
+
+// ServiceHealthChecker consulta periodicamente o service-health dos
+// processadores. Com node definido apenas o líder consulta e publica o
+// resultado; os seguidores aplicam o estado publicado pelo líder.
+func (p *PaymentProcessor) ServiceHealthChecker(ctx context.Context, node *cluster.Node) {
+	ticker := time.NewTicker(ServiceHealthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if node == nil || node.Elect(ctx) {
+			p.pollServiceHealth(ctx, node)
+		} else {
+			p.readServiceHealth(ctx, node)
+		}
+	}
+}
+
+// pollServiceHealth consulta os dois processadores e publica o resultado.
+// O service-health vale para o processador todo, então vai a uma réplica
+// só, a primeira no rodízio.
+func (p *PaymentProcessor) pollServiceHealth(ctx context.Context, node *cluster.Node) {
+	targets := []struct {
+		name   string
+		url    string
+		status *ProcessorStatus
+	}{
+		{"default", p.defaultStatus.replicas.preferred().url, p.defaultStatus},
+		{"fallback", p.fallbackStatus.replicas.preferred().url, p.fallbackStatus},
+	}
+
+	for _, target := range targets {
+		// Liderança perdida no meio do ciclo: parar de consultar
+		if node != nil && !node.IsLeader() {
+			return
+		}
+
+		health, ok := p.fetchServiceHealth(ctx, target.name, target.url)
+		if !ok {
+			continue
+		}
+		p.applyServiceHealth(target.status, health)
+
+		if node != nil {
+			if err := node.PublishHealth(ctx, target.name, health); err != nil {
+				slog.Warn("failed to publish service health", "processor", target.name, "error", err)
+			}
+		}
+	}
+}
+
+// readServiceHealth aplica o health publicado pelo líder
+func (p *PaymentProcessor) readServiceHealth(ctx context.Context, node *cluster.Node) {
+	targets := map[string]*ProcessorStatus{
+		"default":  p.defaultStatus,
+		"fallback": p.fallbackStatus,
+	}
+
+	for name, status := range targets {
+		health, ok, err := node.ReadHealth(ctx, name)
+		if err != nil {
+			slog.Warn("failed to read leader service health", "processor", name, "error", err)
+			continue
+		}
+		if ok {
+			p.applyServiceHealth(status, health)
+		}
+	}
+}
+
+// fetchServiceHealth faz o GET /payments/service-health no processador
+func (p *PaymentProcessor) fetchServiceHealth(ctx context.Context, processorID, processorURL string) (types.ServiceHealth, bool) {
+	var health types.ServiceHealth
+
+	healthURL, ok := serviceHealthURL(processorURL)
+	if !ok {
+		return health, false
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, "GET", healthURL, nil)
+	if err != nil {
+		return health, false
+	}
+	p.setAuthHeaders(req, processorID)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return health, false
+	}
+	defer resp.Body.Close()
+
+	if classifyStatus(resp.StatusCode) == metrics.ClassAuth {
+		p.logAuthFailure(processorID, "service_health", resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		// 429 indica que o rate limit foi consumido por outra instância
+		return health, false
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return health, false
+	}
+	return health, true
+}
+
+// applyServiceHealth atualiza o status do processador com o service-health
+func (p *PaymentProcessor) applyServiceHealth(status *ProcessorStatus, health types.ServiceHealth) {
+	atomic.StoreInt64(&status.MinResponseTime, health.MinResponseTime)
+	if health.Failing {
+		atomic.StoreInt64(&status.IsHealthy, 0)
+		atomic.StoreInt64(&status.LastCheckTime, time.Now().Unix())
+		return
+	}
+	p.markHealthy(status)
+}
+
+// serviceHealthURL deriva a URL do service-health a partir da URL do processador
+func serviceHealthURL(processorURL string) (string, bool) {
+	u, err := url.Parse(processorURL)
+	if err != nil || u.Host == "" {
+		return "", false
+	}
+	return u.Scheme + "://" + u.Host + "/payments/service-health", true
+}
@@ -0,0 +1,192 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// shadowBodyLimit é o quanto da resposta de uma cópia é lido antes de
+// fechar, para a conexão voltar ao pool
+const shadowBodyLimit = 4 << 10
+
+// ErrInvalidShadow é a configuração inválida no POST /admin/shadow
+var ErrInvalidShadow = errors.New("invalid shadow setting")
+
+// shadowSetting é o estado do modo shadow; trocado inteiro a cada mudança
+type shadowSetting struct {
+	enabled bool
+	percent int
+}
+
+// shadowMirror copia ao fallback uma fração dos payments aceitos pelo
+// default, para comparar o comportamento dele sem que o resultado conte: as
+// cópias saem em goroutines próprias, marcadas pelo header, e o desfecho
+// fica só nos contadores do shadow, fora do summary, do circuit breaker, do
+// rate limit e da saúde das réplicas. No máximo slots cópias ficam em
+// andamento; sem vaga a cópia é descartada na hora, sem esperar, para o
+// shadow nunca segurar os workers nem disputar conexões com o tráfego de
+// verdade além disso.
+type shadowMirror struct {
+	setting atomic.Pointer[shadowSetting]
+	header  string
+	slots   chan struct{}
+	status  *ProcessorStatus
+	logger  *slog.Logger
+}
+
+// newShadowMirror cria o modo shadow, ligado no boot com SHADOW_PERCENT
+func newShadowMirror(cfg ProcessorConfig, status *ProcessorStatus) *shadowMirror {
+	s := &shadowMirror{
+		header: cfg.ShadowHeader,
+		slots:  make(chan struct{}, max(cfg.ShadowMaxInFlight, 1)),
+		status: status,
+		logger: slog.Default(),
+	}
+	s.setting.Store(&shadowSetting{enabled: cfg.ShadowPercent > 0, percent: cfg.ShadowPercent})
+	if cfg.ShadowPercent > 0 {
+		s.logger.Info("shadow traffic to fallback enabled",
+			"percent", cfg.ShadowPercent,
+			"max_in_flight", cap(s.slots),
+			"header", s.header)
+	}
+	return s
+}
+
+// mirror sorteia se o payment aceito pelo default vai também ao fallback e,
+// com vaga, envia a cópia em segundo plano. O payment volta ao pool quando
+// o worker termina, então a cópia leva os próprios valores.
+func (p *PaymentProcessor) mirror(payment *types.PaymentRequest) {
+	s := p.shadow
+	setting := s.setting.Load()
+	if !setting.enabled || rand.IntN(100) >= setting.percent {
+		return
+	}
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		metrics.Shadow.Inc(metrics.ShadowDropped)
+		return
+	}
+
+	copied := *payment
+	copied.Metadata = maps.Clone(payment.Metadata)
+	go func() {
+		defer func() { <-s.slots }()
+		p.sendShadow(&copied)
+	}()
+}
+
+// sendShadow envia a cópia ao fallback, com o prazo das chamadas de
+// verdade, e registra só a latência e o desfecho
+func (p *PaymentProcessor) sendShadow(payment *types.PaymentRequest) {
+	s := p.shadow
+	ctx, cancel := context.WithTimeout(context.Background(), s.status.timeout.get())
+	defer cancel()
+
+	target := s.status.replicas.acquire(nil)
+	defer target.release()
+
+	req, err := p.newPaymentRequest(ctx, target.url, "fallback", payment)
+	if err != nil {
+		metrics.Shadow.Inc(metrics.ClassOther)
+		return
+	}
+	req.Header.Set(s.header, "true")
+
+	start := time.Now()
+	resp, err := p.client.Do(req)
+	elapsed := time.Since(start)
+	metrics.ShadowLatency.Observe(elapsed)
+	if err != nil {
+		reason := classifyTransportError(err)
+		metrics.Shadow.Inc(reason)
+		s.logger.Debug("shadow request failed",
+			logging.KeyCorrelationID, payment.CorrelationID,
+			"class", reason,
+			logging.KeyLatencyMs, elapsed.Milliseconds(),
+			"error", err.Error())
+		return
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, shadowBodyLimit))
+	resp.Body.Close()
+
+	outcome := metrics.ShadowSuccess
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+	case p.isDuplicate(resp.StatusCode):
+		outcome = metrics.ClassDuplicate
+	default:
+		outcome = classifyStatus(resp.StatusCode)
+	}
+	metrics.Shadow.Inc(outcome)
+	if outcome != metrics.ShadowSuccess {
+		s.logger.Debug("shadow request failed",
+			logging.KeyCorrelationID, payment.CorrelationID,
+			"class", outcome,
+			logging.KeyStatus, resp.StatusCode,
+			logging.KeyLatencyMs, elapsed.Milliseconds())
+	}
+}
+
+// SetShadow liga ou desliga o modo shadow e troca o percentual, sem
+// restart; nil mantém o atual. Ligado, o percentual precisa estar entre 1
+// e 100.
+func (p *PaymentProcessor) SetShadow(enabled *bool, percent *int) (types.ShadowStats, error) {
+	s := p.shadow
+	current := s.setting.Load()
+	next := *current
+	if enabled != nil {
+		next.enabled = *enabled
+	}
+	if percent != nil {
+		next.percent = *percent
+	}
+	if next.percent < 0 || next.percent > 100 {
+		return types.ShadowStats{}, fmt.Errorf("%w: percent must be between 0 and 100, got %d", ErrInvalidShadow, next.percent)
+	}
+	if next.enabled && next.percent == 0 {
+		return types.ShadowStats{}, fmt.Errorf("%w: enabling shadow traffic needs a percent above 0", ErrInvalidShadow)
+	}
+
+	s.setting.Store(&next)
+	s.logger.Warn("shadow traffic to fallback changed",
+		"enabled", next.enabled,
+		"percent", next.percent,
+		"previous_enabled", current.enabled,
+		"previous_percent", current.percent)
+	return p.ShadowStats(), nil
+}
+
+// ShadowStats retorna o estado do modo shadow e os desfechos e a latência
+// das cópias desde o boot, com a latência do default para comparar
+func (p *PaymentProcessor) ShadowStats() types.ShadowStats {
+	s := p.shadow
+	setting := s.setting.Load()
+	stats := types.ShadowStats{
+		Enabled:        setting.enabled,
+		Percent:        setting.percent,
+		Header:         s.header,
+		MaxInFlight:    cap(s.slots),
+		InFlight:       len(s.slots),
+		Outcomes:       metrics.Shadow.Values(),
+		Latency:        histogramStats(metrics.ShadowLatency.Snapshot()),
+		DefaultLatency: histogramStats(metrics.Processor("default").Latency.Snapshot()),
+	}
+	for outcome, n := range stats.Outcomes {
+		if outcome != metrics.ShadowDropped {
+			stats.Mirrored += n
+		}
+	}
+	return stats
+}
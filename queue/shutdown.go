@@ -0,0 +1,105 @@
+package queue
+
+import (
+	"sync"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// Destino dos payments que ficaram na fila quando os workers pararam
+const (
+	QueuedSpilled = "spilled" // gravados no SpillPath, voltam no próximo boot
+	QueuedPending = "pending" // continuam no Redis para a próxima instância
+	QueuedDropped = "dropped" // perdidos com a fila em memória
+)
+
+// shutdownAccount guarda a conta do desligamento: os contadores no início,
+// para separar o que os workers finalizaram depois dele, e o que ficou na
+// fila quando pararam
+type shutdownAccount struct {
+	mu        sync.Mutex
+	startedAt time.Time
+	baseline  types.WorkerCounters
+	stopped   bool // o shutdown do pool terminou
+	queued    int
+	action    string
+}
+
+// BeginDrain marca o início do desligamento; os payments finalizados a
+// partir daqui contam como drenados. Chamadas repetidas não fazem nada, e
+// o Stop chama se ninguém chamou antes.
+func (wp *WorkerPool) BeginDrain() {
+	a := &wp.shutdownAcct
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.startedAt.IsZero() {
+		a.startedAt = time.Now()
+		a.baseline = wp.registry.totals()
+	}
+}
+
+// stop registra o que ficou na fila quando os workers pararam
+func (a *shutdownAccount) stop(queued int, action string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.stopped = true
+	a.queued = queued
+	a.action = action
+}
+
+// queuedAction é o destino dos payments que ficaram na fila: no Redis
+// seguem pendentes; a fila em memória vai para o spill ou se perde
+func (wp *WorkerPool) queuedAction(spilled bool) string {
+	if _, ok := wp.backend.(drainer); !ok {
+		return QueuedPending
+	}
+	if spilled {
+		return QueuedSpilled
+	}
+	return QueuedDropped
+}
+
+// ShutdownReport fecha a conta dos payments aceitos na fila. Pode ser
+// chamado com o Stop ainda em andamento (o processo vai sair sem esperar):
+// aí a fila e os payments em voo são os do momento da chamada.
+func (wp *WorkerPool) ShutdownReport() types.ShutdownReport {
+	wp.BeginDrain()
+
+	a := &wp.shutdownAcct
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	totals := wp.registry.totals()
+	queued, action := a.queued, a.action
+	if !a.stopped {
+		queued = wp.backend.Len()
+		action = wp.queuedAction(false)
+	}
+	if queued == 0 {
+		action = ""
+	}
+
+	finished := totals.Processed + totals.Failed + totals.Expired
+	enqueued := wp.enqueued.Load()
+	inFlight := wp.inFlight.Load()
+	return types.ShutdownReport{
+		StartedAt:      a.startedAt,
+		DurationMs:     time.Since(a.startedAt).Milliseconds(),
+		WorkersStopped: a.stopped,
+		Drain: types.ShutdownDrain{
+			Processed: totals.Processed - a.baseline.Processed,
+			Failed:    totals.Failed - a.baseline.Failed,
+			Expired:   totals.Expired - a.baseline.Expired,
+		},
+		Queue: types.ShutdownQueue{
+			Enqueued:     enqueued,
+			Finished:     finished,
+			Queued:       queued,
+			QueuedAction: action,
+			InFlight:     inFlight,
+			Unaccounted:  enqueued - finished - int64(queued) - inFlight,
+		},
+		Workers: totals,
+	}
+}
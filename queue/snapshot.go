@@ -0,0 +1,238 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// snapshotVersion é a versão do formato do arquivo; outra versão é
+// tratada como arquivo inválido
+const snapshotVersion = 1
+
+// summarySnapshot é o arquivo de snapshot. O checksum (CRC-32) cobre os
+// bytes de summary, para um arquivo corrompido no disco ou editado à mão
+// não passar por válido só por ainda ser JSON.
+type summarySnapshot struct {
+	Version   int             `json:"version"`
+	WrittenAt time.Time       `json:"written_at"`
+	Checksum  uint32          `json:"checksum"`
+	Summary   json.RawMessage `json:"summary"`
+}
+
+// snapshotter grava o summary em path a cada interval. O arquivo anterior
+// fica em path + ".1": se o mais recente estiver corrompido, o boot
+// restaura o anterior.
+type snapshotter struct {
+	path     string
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newSnapshotter(cfg ProcessorConfig) *snapshotter {
+	if !cfg.Snapshot {
+		return nil
+	}
+	return &snapshotter{
+		path:     cfg.SnapshotPath,
+		interval: cfg.SnapshotInterval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// StartSnapshots restaura o summary do snapshot válido mais recente e passa
+// a gravá-lo a cada SnapshotInterval; deve ser chamado antes de os workers
+// e o servidor começarem. Sem SUMMARY_SNAPSHOT não faz nada.
+func (p *PaymentProcessor) StartSnapshots() {
+	s := p.snapshots
+	if s == nil {
+		return
+	}
+	p.restoreSnapshot()
+
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.writeSnapshot()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopSnapshots para a gravação periódica e grava um último snapshot; deve
+// ser chamado depois de os workers pararem, para ele já trazer o desfecho
+// dos payments drenados
+func (p *PaymentProcessor) StopSnapshots() {
+	s := p.snapshots
+	if s == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+	p.writeSnapshot()
+}
+
+// writeSnapshot grava o summary da janela atual. Os payments em voo ficam
+// fora do total: se a instância cair, eles voltam pelo spill ou pelo Redis
+// e são contados de novo, ou se perdem; o total restaurado é sempre a soma
+// dos desfechos.
+func (p *PaymentProcessor) writeSnapshot() {
+	summary := p.LocalSummary()
+	summary.TotalPayments = summary.DefaultSuccess + summary.FallbackSuccess + summary.TotalErrors + summary.TotalExpired
+
+	path := p.snapshots.path
+	if err := writeSnapshotFile(path, summary); err != nil {
+		metrics.SummarySnapshots.Inc(metrics.SnapshotFailed)
+		if ok, n := p.sampler.Allow("summary_snapshot_failed"); ok {
+			p.logger.Error("failed to write summary snapshot", "path", path, "error", err, logging.KeyOccurrences, n)
+		}
+		return
+	}
+	metrics.SummarySnapshots.Inc(metrics.SnapshotWritten)
+}
+
+// writeSnapshotFile escreve o snapshot ao lado e o renomeia sobre path,
+// então quem lê nunca vê uma gravação pela metade
+func writeSnapshotFile(path string, summary *types.PaymentSummary) error {
+	raw, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(summarySnapshot{
+		Version:   snapshotVersion,
+		WrittenAt: time.Now().UTC(),
+		Checksum:  crc32.ChecksumIEEE(raw),
+		Summary:   raw,
+	})
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp) // sem efeito depois do rename
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(path, path+".1"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// restoreSnapshot carrega o snapshot mais recente que passar na
+// verificação; os inválidos são pulados com aviso, sem impedir o boot, e
+// sem nenhum válido o summary começa do zero
+func (p *PaymentProcessor) restoreSnapshot() {
+	for _, path := range []string{p.snapshots.path, p.snapshots.path + ".1"} {
+		snapshot, summary, err := readSnapshotFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			metrics.SummarySnapshots.Inc(metrics.SnapshotSkipped)
+			p.logger.Warn("skipping invalid summary snapshot", "path", path, "error", err)
+			continue
+		}
+
+		p.carrySummary(summary)
+		metrics.SummarySnapshots.Inc(metrics.SnapshotRestored)
+		p.logger.Info("summary restored from snapshot",
+			"path", path,
+			"written_at", snapshot.WrittenAt,
+			"since", summary.Since,
+			"total_payments", summary.TotalPayments)
+		return
+	}
+}
+
+// carrySummary soma à janela atual o summary restaurado, que continua a
+// janela da instância anterior: o since passa a ser o dela
+func (p *PaymentProcessor) carrySummary(summary *types.PaymentSummary) {
+	p.resetMu.Lock()
+	defer p.resetMu.Unlock()
+
+	w := *p.window.Load()
+	carried := types.PaymentSummary{}
+	carried.Add(w.carried) // cópia: quem leu a janela anterior ainda pode estar lendo o mapa
+	carried.Add(*summary)
+	w.since = *summary.Since
+	w.carried = carried
+	p.window.Store(&w)
+}
+
+func readSnapshotFile(path string) (summarySnapshot, *types.PaymentSummary, error) {
+	var snapshot summarySnapshot
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return snapshot, nil, err
+	}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return snapshot, nil, err
+	}
+	if snapshot.Version != snapshotVersion {
+		return snapshot, nil, fmt.Errorf("unsupported version %d", snapshot.Version)
+	}
+	if crc32.ChecksumIEEE(snapshot.Summary) != snapshot.Checksum {
+		return snapshot, nil, errors.New("checksum mismatch")
+	}
+
+	var summary types.PaymentSummary
+	if err := json.Unmarshal(snapshot.Summary, &summary); err != nil {
+		return snapshot, nil, err
+	}
+	if err := validSnapshotSummary(&summary); err != nil {
+		return snapshot, nil, err
+	}
+	return snapshot, &summary, nil
+}
+
+// validSnapshotSummary recusa um summary que nenhuma gravação produziria:
+// sem since, com contadores negativos ou com o total diferente da soma dos
+// desfechos
+func validSnapshotSummary(s *types.PaymentSummary) error {
+	if s.Since == nil {
+		return errors.New("missing since")
+	}
+	counts := []int64{s.DefaultSuccess, s.FallbackSuccess, s.TotalErrors, s.TotalExpired, s.DefaultAmount, s.FallbackAmount, s.ExpiredAmount}
+	for _, amounts := range s.Currencies {
+		counts = append(counts, amounts.DefaultAmount, amounts.FallbackAmount, amounts.ExpiredAmount)
+	}
+	for _, n := range counts {
+		if n < 0 {
+			return errors.New("negative counter")
+		}
+	}
+	if s.TotalPayments != s.DefaultSuccess+s.FallbackSuccess+s.TotalErrors+s.TotalExpired {
+		return errors.New("total_payments does not match the outcomes")
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/store"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// snapshotInstance sobe processador e pool com o snapshot do summary em
+// path, restaurado antes de os workers começarem, como no boot
+func snapshotInstance(t *testing.T, path string) (*PaymentProcessor, *WorkerPool) {
+	t.Helper()
+	cfg := testProcessorConfig(newFakeProcessor(t), newFakeProcessor(t))
+	cfg.Snapshot = true
+	cfg.SnapshotPath = path
+	cfg.SnapshotInterval = 10 * time.Millisecond
+	processor := NewPaymentProcessor(cfg, store.NewMemoryStore(store.MemoryOptions{}))
+	processor.StartSnapshots()
+
+	poolConfig := testPoolConfig(2)
+	pool := NewWorkerPool(processor, NewRingBackend(poolConfig.QueueSize), poolConfig)
+	pool.Start()
+	return processor, pool
+}
+
+// processPayments submete n payments a partir de first e espera todos
+// terem desfecho
+func processPayments(t *testing.T, processor *PaymentProcessor, pool *WorkerPool, first, n int) {
+	t.Helper()
+	want := processor.LifetimeSummary().DefaultSuccess + int64(n)
+	for i := range n {
+		if pool.Submit(context.Background(), newTestPayment(first+i)) != nil {
+			t.Fatalf("Submit refused payment %d", first+i)
+		}
+	}
+	waitFor(t, 2*time.Second, "the payments to be processed", func() bool {
+		return processor.LifetimeSummary().DefaultSuccess == want
+	})
+}
+
+// snapshotTotal é o total gravado no snapshot em path, ou -1 se ainda não
+// há um válido
+func snapshotTotal(path string) int64 {
+	_, summary, err := readSnapshotFile(path)
+	if err != nil {
+		return -1
+	}
+	return summary.TotalPayments
+}
+
+func TestSnapshotRestartContinuesTotals(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "summary-snapshot.json")
+
+	// 1ª instância: morre sem desligar, depois de um snapshot periódico
+	processor, pool := snapshotInstance(t, path)
+	processPayments(t, processor, pool, 0, 30)
+	waitFor(t, time.Second, "a periodic snapshot", func() bool { return snapshotTotal(path) == 30 })
+	first := processor.LocalSummary()
+	// A gravação periódica morre junto, sem o snapshot final do StopSnapshots
+	close(processor.snapshots.stop)
+	<-processor.snapshots.done
+	pool.Stop()
+
+	// 2ª instância: continua de onde a primeira parou, não do zero
+	processor, pool = snapshotInstance(t, path)
+	restored := processor.LocalSummary()
+	if restored.TotalPayments != 30 || restored.DefaultSuccess != 30 || restored.DefaultAmount != first.DefaultAmount {
+		t.Fatalf("restored summary = %+v, want the 30 payments of the first instance", restored)
+	}
+	if !restored.Since.Equal(*first.Since) {
+		t.Errorf("since = %s, want the first instance's %s", restored.Since, first.Since)
+	}
+	processPayments(t, processor, pool, 30, 20)
+	if got := processor.LocalSummary(); got.TotalPayments != 50 || got.DefaultAmount != 50*100 {
+		t.Fatalf("after 20 more payments: %d payments, amount %d; want 50 and %d", got.TotalPayments, got.DefaultAmount, 50*100)
+	}
+
+	// Desligamento normal: o snapshot final já traz tudo
+	pool.Stop()
+	processor.StopSnapshots()
+	if got := snapshotTotal(path); got != 50 {
+		t.Fatalf("final snapshot total = %d, want 50", got)
+	}
+	processor, pool = snapshotInstance(t, path)
+	defer processor.StopSnapshots()
+	defer pool.Stop()
+	if got := processor.LocalSummary(); got.TotalPayments != 50 || got.DefaultSuccess != 50 {
+		t.Fatalf("third boot restored %+v, want 50 payments", got)
+	}
+}
+
+func TestSnapshotSkipsInvalidFiles(t *testing.T) {
+	since := time.Date(2025, 7, 9, 12, 0, 0, 0, time.UTC)
+	valid := func(total int64) *types.PaymentSummary {
+		return &types.PaymentSummary{
+			Since:          &since,
+			TotalPayments:  total,
+			DefaultSuccess: total,
+			DefaultAmount:  total * 100,
+		}
+	}
+	// writeValid grava um snapshot íntegro e retorna os bytes
+	writeValid := func(t *testing.T, path string, total int64) []byte {
+		t.Helper()
+		if err := writeSnapshotFile(path, valid(total)); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	tests := []struct {
+		name        string
+		damage      func(data []byte) []byte
+		wantTotal   int64
+		wantSkipped int64
+	}{
+		{"intact", func(data []byte) []byte { return data }, 7, 0},
+		{"truncated", func(data []byte) []byte { return data[:len(data)/2] }, 3, 1},
+		{"flipped digit", func(data []byte) []byte {
+			return bytes.Replace(data, []byte(`"default_success":7`), []byte(`"default_success":8`), 1)
+		}, 3, 1},
+		{"other version", func(data []byte) []byte {
+			return bytes.Replace(data, []byte(`"version":1`), []byte(`"version":2`), 1)
+		}, 3, 1},
+		{"empty", func([]byte) []byte { return nil }, 3, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "summary-snapshot.json")
+			writeValid(t, path, 3) // vira o .1 na próxima gravação
+			data := writeValid(t, path, 7)
+			if err := os.WriteFile(path, tt.damage(data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			before := metrics.SummarySnapshots.Values()
+			processor, pool := snapshotInstance(t, path)
+			defer processor.StopSnapshots()
+			defer pool.Stop()
+			after := metrics.SummarySnapshots.Values()
+
+			if got := processor.LocalSummary(); got.TotalPayments != tt.wantTotal || !got.Since.Equal(since) {
+				t.Errorf("restored %d payments since %s, want %d since %s", got.TotalPayments, got.Since, tt.wantTotal, since)
+			}
+			if got := after[metrics.SnapshotSkipped] - before[metrics.SnapshotSkipped]; got != tt.wantSkipped {
+				t.Errorf("skipped = %d, want %d", got, tt.wantSkipped)
+			}
+			if got := after[metrics.SnapshotRestored] - before[metrics.SnapshotRestored]; got != 1 {
+				t.Errorf("restored = %d, want 1", got)
+			}
+		})
+	}
+
+	t.Run("both invalid", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "summary-snapshot.json")
+		for _, p := range []string{path, path + ".1"} {
+			if err := os.WriteFile(p, []byte(`{"version":1,"summary":{}}`), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		processor, pool := snapshotInstance(t, path)
+		defer processor.StopSnapshots()
+		defer pool.Stop()
+		if got := processor.LocalSummary(); got.TotalPayments != 0 || got.Since.Equal(since) {
+			t.Errorf("restored %+v from invalid snapshots, want a fresh summary", got)
+		}
+	})
+}
@@ -0,0 +1,180 @@
+package queue
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// maxSpillLine limita uma linha do arquivo de spill; um payment válido fica
+// muito abaixo disso, então uma linha maior é lixo e encerra a leitura
+const maxSpillLine = 1 << 20
+
+// drainer é implementado pelas filas em memória, que perdem o conteúdo ao
+// fechar. A fila no Redis é durável e não precisa de spill.
+type drainer interface {
+	Drain() []Job
+}
+
+// spillRecord é uma linha (JSON) do arquivo de spill. enqueuedAt é mantido
+// para o QueueTTL continuar contando a partir do aceite original.
+type spillRecord struct {
+	EnqueuedAt time.Time       `json:"enqueuedAt"`
+	RequestID  string          `json:"requestId,omitempty"`
+	Payment    json.RawMessage `json:"payment"`
+}
+
+// spill grava no SpillPath os payments que ficaram na fila em memória
+// depois que os workers pararam. O arquivo é escrito ao lado e renomeado,
+// então quem o lê nunca vê uma gravação pela metade. Retorna true se os
+// payments foram gravados.
+func (wp *WorkerPool) spill() bool {
+	d, ok := wp.backend.(drainer)
+	if !ok || wp.config.SpillPath == "" {
+		return false
+	}
+	jobs := d.Drain()
+	if len(jobs) == 0 {
+		return false
+	}
+
+	if err := writeSpill(wp.config.SpillPath, jobs); err != nil {
+		wp.logger.Error("failed to spill queued payments, payments lost",
+			"path", wp.config.SpillPath,
+			"payments", len(jobs),
+			"error", err)
+		return false
+	}
+	metrics.QueueSpill.Add(metrics.SpillWritten, int64(len(jobs)))
+	wp.logger.Warn("queued payments spilled to disk",
+		"path", wp.config.SpillPath,
+		"payments", len(jobs))
+	return true
+}
+
+func writeSpill(path string, jobs []Job) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp) // sem efeito depois do rename
+
+	w := bufio.NewWriter(f)
+	for _, j := range jobs {
+		payment, err := j.Payment.ToJSON()
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("encode payment %s: %w", j.Payment.CorrelationID, err)
+		}
+		line, err := json.Marshal(spillRecord{EnqueuedAt: j.enqueuedAt, RequestID: j.requestID, Payment: payment})
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("encode payment %s: %w", j.Payment.CorrelationID, err)
+		}
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// restore devolve à fila os payments do arquivo de spill e o apaga; roda
+// no Start, antes de o servidor aceitar requisições. Registros corrompidos
+// ou truncados são pulados com aviso, sem impedir o boot.
+func (wp *WorkerPool) restore() {
+	path := wp.config.SpillPath
+	if _, ok := wp.backend.(drainer); !ok || path == "" {
+		return
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		wp.logger.Error("failed to open queue spill file", "path", path, "error", err)
+		return
+	}
+
+	var restored, skipped, dropped int
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxSpillLine)
+	for line := 1; scanner.Scan(); line++ {
+		j, err := decodeSpillRecord(scanner.Bytes())
+		if err != nil {
+			skipped++
+			wp.logger.Warn("skipping invalid queue spill record", "path", path, "line", line, "error", err)
+			continue
+		}
+		if wp.push(j) != nil {
+			types.ReleasePayment(j.Payment)
+			dropped++
+			continue
+		}
+		restored++
+	}
+	if err := scanner.Err(); err != nil {
+		skipped++ // a linha que interrompeu a leitura
+		wp.logger.Warn("queue spill file truncated, ignoring the rest", "path", path, "error", err)
+	}
+	f.Close()
+
+	if err := os.Remove(path); err != nil {
+		wp.logger.Error("failed to remove queue spill file", "path", path, "error", err)
+	}
+
+	metrics.QueueSpill.Add(metrics.SpillRestored, int64(restored))
+	metrics.QueueSpill.Add(metrics.SpillSkipped, int64(skipped))
+	metrics.QueueSpill.Add(metrics.SpillDropped, int64(dropped))
+	if dropped > 0 {
+		wp.logger.Error("queue full while restoring spilled payments, payments lost",
+			"path", path,
+			logging.KeyQueueDepth, wp.backend.Len(),
+			"dropped", dropped)
+	}
+	wp.logger.Info("queued payments restored from disk",
+		"path", path,
+		"restored", restored,
+		"skipped", skipped)
+}
+
+func decodeSpillRecord(line []byte) (Job, error) {
+	var record spillRecord
+	if err := json.Unmarshal(line, &record); err != nil {
+		return Job{}, err
+	}
+	if len(record.Payment) == 0 {
+		return Job{}, errors.New("missing payment")
+	}
+
+	payment := types.AcquirePayment()
+	if err := types.DecodePayment(record.Payment, payment); err != nil {
+		types.ReleasePayment(payment)
+		return Job{}, err
+	}
+	return Job{
+		Payment:    payment,
+		requestID:  record.RequestID,
+		enqueuedAt: record.EnqueuedAt,
+	}, nil
+}
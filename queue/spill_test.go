@@ -0,0 +1,234 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/store"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// spillPayment é um payment com todos os campos que o spill precisa manter
+func spillPayment(i int) *types.PaymentRequest {
+	p := newTestPayment(i)
+	p.Amount = 100 + i
+	p.Type = "pix"
+	p.Currency = "USD"
+	p.Description = "pedido é 😀\n#" + p.CorrelationID[len(p.CorrelationID)-3:]
+	p.Metadata = map[string]string{"order": p.CorrelationID}
+	return p
+}
+
+// spillFile para um pool pausado com payments na fila e retorna o arquivo
+// de spill gravado no Stop
+func spillFile(t *testing.T, payments int) (path string, data []byte) {
+	t.Helper()
+	path = filepath.Join(t.TempDir(), "queue-spill.jsonl")
+	cfg := testPoolConfig(1)
+	cfg.SpillPath = path
+	pool := newTestPool(t, testProcessorConfig(newFakeProcessor(t), newFakeProcessor(t)), cfg)
+	pool.Pause()
+	for i := range payments {
+		ctx := logging.WithRequestID(context.Background(), "req-"+newTestPayment(i).CorrelationID)
+		if pool.Submit(ctx, spillPayment(i)) != nil {
+			t.Fatalf("Submit refused payment %d", i)
+		}
+	}
+	pool.Stop()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("no spill file after Stop: %v", err)
+	}
+	return path, data
+}
+
+// restoredJobs recarrega o arquivo em um pool novo, sem iniciar os
+// workers, e retorna o que voltou à fila
+func restoredJobs(t *testing.T, path string) []Job {
+	t.Helper()
+	cfg := testPoolConfig(1)
+	cfg.SpillPath = path
+	processor := NewPaymentProcessor(testProcessorConfig(newFakeProcessor(t), newFakeProcessor(t)), store.NewMemoryStore(store.MemoryOptions{}))
+	backend := NewRingBackend(cfg.QueueSize)
+	pool := NewWorkerPool(processor, backend, cfg)
+	pool.restore()
+
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("spill file still there after the restore: %v", err)
+	}
+	backend.Close()
+	return backend.Drain()
+}
+
+// respill grava os jobs recarregados de novo e retorna os bytes, para
+// comparar com o arquivo original
+func respill(t *testing.T, jobs []Job) []byte {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "respill.jsonl")
+	if err := writeSpill(path, jobs); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// lineEnd é o fim (depois do \n) da n-ésima linha de data
+func lineEnd(t *testing.T, data []byte, n int) int {
+	t.Helper()
+	end := 0
+	for range n {
+		i := bytes.IndexByte(data[end:], '\n')
+		if i < 0 {
+			t.Fatalf("spill file has fewer than %d lines", n)
+		}
+		end += i + 1
+	}
+	return end
+}
+
+func TestSpillRestoresTheQueue(t *testing.T) {
+	path, data := spillFile(t, 10)
+
+	jobs := restoredJobs(t, path)
+	if len(jobs) != 10 {
+		t.Fatalf("restored %d payments, want 10", len(jobs))
+	}
+	if got := respill(t, jobs); !bytes.Equal(got, data) {
+		t.Fatalf("restored queue differs from the spill file\ngot:  %s\nwant: %s", got, data)
+	}
+	for i, j := range jobs {
+		want := spillPayment(i).CorrelationID
+		if j.Payment.CorrelationID != want || j.requestID != "req-"+want {
+			t.Errorf("job %d = %s (request %s), want %s in queue order", i, j.Payment.CorrelationID, j.requestID, want)
+		}
+	}
+}
+
+func TestSpillRestoresTheWellFormedPrefix(t *testing.T) {
+	tests := []struct {
+		name        string
+		damage      func(t *testing.T, data []byte) []byte
+		wantPrefix  int // linhas íntegras recuperadas, na ordem
+		wantSkipped int64
+	}{
+		{"cut in the middle of a record", func(t *testing.T, data []byte) []byte {
+			end := lineEnd(t, data, 6)
+			return data[:end+20] // o 7º registro pela metade, sem \n
+		}, 6, 1},
+		{"cut right after a record", func(t *testing.T, data []byte) []byte {
+			return data[:lineEnd(t, data, 4)]
+		}, 4, 0},
+		{"garbage appended", func(t *testing.T, data []byte) []byte {
+			return append(data[:lineEnd(t, data, 3)], "\x00\x00\xff{\"enq"...)
+		}, 3, 1},
+		{"empty file", func(t *testing.T, data []byte) []byte {
+			return nil
+		}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, data := spillFile(t, 10)
+			if err := os.WriteFile(path, tt.damage(t, data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			before := metrics.QueueSpill.Values()
+			jobs := restoredJobs(t, path)
+			after := metrics.QueueSpill.Values()
+
+			if len(jobs) != tt.wantPrefix {
+				t.Fatalf("restored %d payments, want %d", len(jobs), tt.wantPrefix)
+			}
+			if got, want := respill(t, jobs), data[:lineEnd(t, data, tt.wantPrefix)]; !bytes.Equal(got, want) {
+				t.Fatalf("restored prefix differs from the spill file\ngot:  %s\nwant: %s", got, want)
+			}
+			if got := after[metrics.SpillSkipped] - before[metrics.SpillSkipped]; got != tt.wantSkipped {
+				t.Errorf("skipped records = %d, want %d", got, tt.wantSkipped)
+			}
+			if got := after[metrics.SpillRestored] - before[metrics.SpillRestored]; got != int64(tt.wantPrefix) {
+				t.Errorf("restored counter = %d, want %d", got, tt.wantPrefix)
+			}
+		})
+	}
+}
+
+func TestSpillSkipsCorruptRecords(t *testing.T) {
+	path, data := spillFile(t, 5)
+
+	// Troca o 2º registro por lixo e o 4º por um payment que não decodifica
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	lines[1] = []byte("not json\n")
+	lines[3] = []byte(`{"enqueuedAt":"2025-07-09T12:00:00Z","payment":{"amount":"10"}}` + "\n")
+	if err := os.WriteFile(path, bytes.Join(lines, nil), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	before := metrics.QueueSpill.Values()[metrics.SpillSkipped]
+	jobs := restoredJobs(t, path)
+	if got := metrics.QueueSpill.Values()[metrics.SpillSkipped] - before; got != 2 {
+		t.Errorf("skipped records = %d, want 2", got)
+	}
+	want := append(append(append([]byte{}, lines[0]...), lines[2]...), lines[4]...)
+	if got := respill(t, jobs); !bytes.Equal(got, want) {
+		t.Fatalf("restored records differ from the intact ones\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
+func TestStopMidStreamSpillsTheRest(t *testing.T) {
+	processor := newFakeProcessor(t)
+	processor.delay.Store(int64(5 * time.Millisecond))
+	var mu sync.Mutex
+	processed := make(map[string]bool)
+	processor.onPayment = func(p types.PaymentRequest) {
+		mu.Lock()
+		defer mu.Unlock()
+		processed[p.CorrelationID] = true
+	}
+
+	path := filepath.Join(t.TempDir(), "queue-spill.jsonl")
+	cfg := testPoolConfig(1)
+	cfg.BatchSize, cfg.BatchParallelism = 1, 1
+	cfg.SpillPath = path
+	pool := newTestPool(t, testProcessorConfig(processor, newFakeProcessor(t)), cfg)
+
+	// O pool para com parte dos payments já enviada ao processador
+	const payments = 50
+	for i := range payments {
+		if pool.Submit(context.Background(), newTestPayment(i)) != nil {
+			t.Fatalf("Submit refused payment %d", i)
+		}
+	}
+	waitFor(t, time.Second, "the first payments to reach the processor", func() bool {
+		return processor.calls.Load() >= 3
+	})
+	pool.Stop()
+
+	jobs := restoredJobs(t, path)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(jobs) == 0 || len(processed) == 0 {
+		t.Fatalf("%d processed and %d spilled, want the stop to split them", len(processed), len(jobs))
+	}
+	// Cada payment foi ao processador ou ao arquivo, nunca aos dois
+	for _, j := range jobs {
+		if processed[j.Payment.CorrelationID] {
+			t.Errorf("payment %s was both processed and spilled", j.Payment.CorrelationID)
+		}
+	}
+	if total := len(processed) + len(jobs); total != payments {
+		t.Errorf("%d processed + %d spilled = %d, want all %d", len(processed), len(jobs), total, payments)
+	}
+}
@@ -0,0 +1,51 @@
+package queue
+
+import (
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// statsWindow é o início da janela do summary: o instante e os contadores
+// do último reset, descontados a cada leitura. Os contadores em si nunca
+// voltam a zero, então os workers seguem somando sem lock e um reset no
+// meio de um incremento não deixa estado pela metade.
+type statsWindow struct {
+	since   time.Time
+	base    types.PaymentSummary
+	carried types.PaymentSummary // contado pela instância anterior, restaurado do snapshot
+}
+
+// ResetStats começa uma nova janela do summary e dos histogramas de valores
+// e retorna os da que terminou; os contadores de entrada ficam com o
+// handler. Os payments em voo no reset já estão no
+// total_payments da janela encerrada; a base da nova fica só com os
+// desfechos, para que eles voltem ao total da nova janela junto com o
+// desfecho e a conta total = sucessos + erros + expirados continue fechando.
+func (p *PaymentProcessor) ResetStats() types.StatsReset {
+	p.resetMu.Lock()
+	defer p.resetMu.Unlock()
+
+	previous := p.window.Load()
+	resetAt := time.Now().UTC()
+	current := p.LifetimeSummary()
+
+	base := *current
+	base.Currencies = nil
+	base.AddCurrencies(current.Currencies)
+	base.TotalPayments = current.DefaultSuccess + current.FallbackSuccess + current.TotalErrors + current.TotalExpired
+	p.window.Store(&statsWindow{since: resetAt, base: base})
+	amounts := p.amounts.Swap(newProcessorAmounts(p.amountBounds))
+
+	closed := *current
+	closed.Subtract(previous.base)
+	closed.Add(previous.carried)
+	since := previous.since
+	closed.Since = &since
+	return types.StatsReset{
+		ResetAt:     resetAt,
+		Summary:     closed,
+		Amounts:     amounts.stats(),
+		CarriedOver: current.TotalPayments - base.TotalPayments,
+	}
+}
@@ -0,0 +1,42 @@
+package queue
+
+import "hash/fnv"
+
+// Estratégias de escolha do primeiro processador dos types sem regra
+const (
+	RoutingPriority = "priority" // o default e depois o fallback, ou o sorteado pelos pesos
+	RoutingSticky   = "sticky"   // o do hash do correlationId
+)
+
+// stick retorna a posição em global do processador do correlationId por
+// rendezvous hashing: cada processador recebe uma nota do hash do seu nome
+// com o correlationId e fica o de maior nota. Sem seed por processo, a
+// escolha é a mesma em todas as instâncias e depois de um restart, e com
+// um processador a mais ou a menos só mudam os correlationIds dele.
+func (r *router) stick(correlationID string) int {
+	best, bestScore := 0, uint64(0)
+	for i, route := range r.global {
+		if score := stickyScore(route.processorID, correlationID); i == 0 || score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return best
+}
+
+// stickyScore é o FNV-1a do processador e do correlationId, separados por
+// um zero, com o finalizador do MurmurHash3 espalhando os bits, já que as
+// notas dos processadores só diferem no começo da entrada
+func stickyScore(processorID, correlationID string) uint64 {
+	f := fnv.New64a()
+	f.Write([]byte(processorID))
+	f.Write([]byte{0})
+	f.Write([]byte(correlationID))
+	h := f.Sum64()
+
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
@@ -0,0 +1,127 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/yurimachados/rinha-backend-go/store"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// newStickyRouter é o router global com a estratégia sticky
+func newStickyRouter() *router {
+	statuses := map[string]*ProcessorStatus{"default": {}, "fallback": {}}
+	return newRouter(nil, RoutingSticky, []int64{0, 0}, statuses)
+}
+
+func TestStickyScoreIsStable(t *testing.T) {
+	// Notas da implementação anterior: mudar o hash mudaria o processador de
+	// parte dos correlationIds entre instâncias de versões diferentes
+	tests := []struct {
+		correlationID               string
+		defaultScore, fallbackScore uint64
+	}{
+		{"4a7901b8-7d26-4d9d-aa19-4dc1c7cf60b3", 13581674237326278894, 1452173676992234096},
+		{"00000000-0000-4000-8000-000000000001", 11195251973115898989, 16840968544157012413},
+		{"00000000-0000-4000-8000-000000000002", 2622203520510871656, 10438975137073528144},
+		{"b1c2d3e4-0000-4000-8000-000000000042", 2853496189805375955, 7290918487786214869},
+		{"", 13969569165151222372, 10637452779370139033},
+	}
+	for _, tt := range tests {
+		if got := stickyScore("default", tt.correlationID); got != tt.defaultScore {
+			t.Errorf("stickyScore(default, %q) = %d, want %d", tt.correlationID, got, tt.defaultScore)
+		}
+		if got := stickyScore("fallback", tt.correlationID); got != tt.fallbackScore {
+			t.Errorf("stickyScore(fallback, %q) = %d, want %d", tt.correlationID, got, tt.fallbackScore)
+		}
+	}
+}
+
+func TestStickyDistribution(t *testing.T) {
+	const n = 100_000
+	r := newStickyRouter()
+	rng := rand.New(rand.NewSource(1))
+
+	// Ids sequenciais, que só diferem no fim, e UUIDs aleatórios
+	sources := map[string]func(i int) string{
+		"sequential": func(i int) string { return newTestPayment(i).CorrelationID },
+		"random": func(int) string {
+			return fmt.Sprintf("%08x-%04x-4%03x-8%03x-%012x",
+				rng.Uint32(), rng.Intn(1<<16), rng.Intn(1<<12), rng.Intn(1<<12), rng.Int63n(1<<48))
+		},
+	}
+	for name, id := range sources {
+		t.Run(name, func(t *testing.T) {
+			counts := make([]int, len(r.global))
+			for i := range n {
+				counts[r.stick(id(i))]++
+			}
+			// Com 100k ids, o desvio padrão de uma divisão justa é ~0,16%
+			for i, count := range counts {
+				if share := float64(count) / n; share < 0.49 || share > 0.51 {
+					t.Errorf("%s got %.2f%% of the ids, want about 50%%", r.global[i].processorID, share*100)
+				}
+			}
+		})
+	}
+}
+
+func TestStickyUnderRetry(t *testing.T) {
+	defaultProcessor, fallbackProcessor := newFakeProcessor(t), newFakeProcessor(t)
+
+	// calls guarda, por correlationId, os processadores chamados em ordem
+	var mu sync.Mutex
+	calls := make(map[string][]string)
+	record := func(processorID string) func(types.PaymentRequest) {
+		return func(p types.PaymentRequest) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls[p.CorrelationID] = append(calls[p.CorrelationID], processorID)
+		}
+	}
+	defaultProcessor.onPayment = record("default")
+	fallbackProcessor.onPayment = record("fallback")
+
+	cfg := testProcessorConfig(defaultProcessor, fallbackProcessor)
+	cfg.RoutingStrategy = RoutingSticky
+	cfg.BreakerMinRequests = 1 << 30 // as falhas de propósito não abrem o circuit breaker
+	processor := NewPaymentProcessor(cfg, store.NewMemoryStore(store.MemoryOptions{}))
+
+	const n = 40
+	// Primeira rodada: os dois falham, o payment passa pelo do hash e depois
+	// pelo outro; na nova tentativa, os dois aceitam
+	defaultProcessor.status.Store(http.StatusInternalServerError)
+	fallbackProcessor.status.Store(http.StatusInternalServerError)
+	for i := range n {
+		if result := processor.ProcessPayment(context.Background(), newTestPayment(i)); result.Success {
+			t.Fatalf("payment %d succeeded with both processors failing", i)
+		}
+	}
+	defaultProcessor.status.Store(http.StatusOK)
+	fallbackProcessor.status.Store(http.StatusOK)
+
+	stuck := make(map[string]int)
+	for i := range n {
+		payment := newTestPayment(i)
+		want := processor.routes.global[processor.routes.stick(payment.CorrelationID)].processorID
+		result := processor.ProcessPayment(context.Background(), payment)
+		if !result.Success || result.ProcessorID != want {
+			t.Fatalf("retry of payment %d: result %+v, want a success on %s", i, result, want)
+		}
+		stuck[want]++
+
+		mu.Lock()
+		got := calls[payment.CorrelationID]
+		mu.Unlock()
+		if len(got) != 3 || got[0] != want || got[2] != want || got[1] == want {
+			t.Errorf("payment %d calls = %v, want %s first on both rounds", i, got, want)
+		}
+	}
+	if len(stuck) != 2 {
+		t.Errorf("all %d payments stuck to %v, want both processors used", n, stuck)
+	}
+}
@@ -0,0 +1,94 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// ErrStopped recusa um payment enviado depois do Stop do pool
+var ErrStopped = errors.New("worker pool stopped")
+
+// ErrQueueFull é a recusa do backend; o SubmitWithContext espera por vaga
+var ErrQueueFull = errors.New("queue full")
+
+// SubmitWithContext enfileira o payment esperando por vaga, para quem
+// prefere esperar alguns milissegundos a perder o payment (o caminho HTTP
+// usa o Submit, que recusa na hora). Retorna nil com o payment na fila,
+// ErrStopped se o pool parar antes, ctx.Err() se o contexto terminar antes
+// e, como o Submit, um *TransitionError para um correlationId que não pode
+// voltar à fila; nesses casos o payment continua com o chamador. Uma vaga que abre
+// junto com o fim do contexto pode ir para qualquer um dos lados, mas nunca
+// para os dois: com erro o payment não foi enfileirado.
+func (wp *WorkerPool) SubmitWithContext(ctx context.Context, payment *types.PaymentRequest) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	j := Job{
+		Payment:     payment,
+		spanContext: trace.SpanContextFromContext(ctx),
+		requestID:   logging.RequestID(ctx),
+		enqueuedAt:  time.Now(),
+	}
+
+	// O channel é pego antes do push: uma vaga que abre entre o push recusado
+	// e o select já o encontra fechado
+	for {
+		room := wp.room.wait()
+		err := wp.push(j)
+		if err != ErrQueueFull {
+			return err
+		}
+		select {
+		case <-room:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-wp.closing:
+			return ErrStopped
+		}
+	}
+}
+
+// roomSignal acorda os SubmitWithContext que esperam vaga na fila: o wait
+// retorna um channel que o próximo notify fecha. Sem ninguém esperando, o
+// notify é só um Load, já que ele roda a cada job retirado da fila.
+type roomSignal struct {
+	ch atomic.Pointer[chan struct{}]
+}
+
+// wait retorna o channel fechado no próximo notify
+func (s *roomSignal) wait() <-chan struct{} {
+	for {
+		if ch := s.ch.Load(); ch != nil {
+			return *ch
+		}
+		ch := make(chan struct{})
+		if s.ch.CompareAndSwap(nil, &ch) {
+			return ch
+		}
+	}
+}
+
+// notify avisa que pode haver vaga na fila
+func (s *roomSignal) notify() {
+	if s.ch.Load() == nil {
+		return
+	}
+	if ch := s.ch.Swap(nil); ch != nil {
+		close(*ch)
+	}
+}
+
+// roomNotifier é o backend em que a vaga abre em outro ponto além do
+// recebimento pelo worker, que o takeOff já avisa; o NewWorkerPool entrega
+// a ele o roomSignal do pool
+type roomNotifier interface {
+	notifyRoom(room *roomSignal)
+}
@@ -0,0 +1,209 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/store"
+)
+
+// newFullPool cria um pool pausado com a fila de 1 posição já ocupada:
+// o próximo payment só entra quando a capacidade aumentar
+func newFullPool(t *testing.T) *WorkerPool {
+	t.Helper()
+	cfg := testPoolConfig(1)
+	cfg.QueueSize = 1
+	pool := newTestPool(t, testProcessorConfig(newFakeProcessor(t), newFakeProcessor(t)), cfg)
+	pool.Pause()
+	if pool.Submit(context.Background(), newTestPayment(0)) != nil {
+		t.Fatal("Submit refused the payment that fills the queue")
+	}
+	return pool
+}
+
+// submitAsync roda o SubmitWithContext em outra goroutine
+func submitAsync(ctx context.Context, pool *WorkerPool, i int) <-chan error {
+	done := make(chan error, 1)
+	go func() { done <- pool.SubmitWithContext(ctx, newTestPayment(i)) }()
+	return done
+}
+
+func TestSubmitWithContextWaitsForASlot(t *testing.T) {
+	pool := newFullPool(t)
+
+	done := submitAsync(context.Background(), pool, 1)
+	select {
+	case err := <-done:
+		t.Fatalf("SubmitWithContext returned %v with the queue full", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if _, err := pool.SetQueueCapacity(2); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("SubmitWithContext = %v after a slot opened, want nil", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("SubmitWithContext still blocked after a slot opened")
+	}
+	if got := pool.GetQueueSize(); got != 2 {
+		t.Errorf("queue size = %d, want 2", got)
+	}
+}
+
+func TestSubmitWithContextErrors(t *testing.T) {
+	t.Run("deadline", func(t *testing.T) {
+		pool := newFullPool(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if err := pool.SubmitWithContext(ctx, newTestPayment(1)); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("SubmitWithContext = %v, want context.DeadlineExceeded", err)
+		}
+		if got := pool.GetQueueSize(); got != 1 {
+			t.Errorf("queue size = %d, want only the payment that filled it", got)
+		}
+	})
+
+	t.Run("canceled before the call", func(t *testing.T) {
+		pool := newTestPool(t, testProcessorConfig(newFakeProcessor(t), newFakeProcessor(t)), testPoolConfig(1))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := pool.SubmitWithContext(ctx, newTestPayment(1)); !errors.Is(err, context.Canceled) {
+			t.Fatalf("SubmitWithContext = %v, want context.Canceled even with room in the queue", err)
+		}
+	})
+
+	t.Run("stopped while waiting", func(t *testing.T) {
+		pool := newFullPool(t)
+		done := submitAsync(context.Background(), pool, 1)
+		time.Sleep(5 * time.Millisecond)
+		pool.Stop()
+		if err := <-done; !errors.Is(err, ErrStopped) {
+			t.Fatalf("SubmitWithContext = %v, want ErrStopped", err)
+		}
+		if err := pool.SubmitWithContext(context.Background(), newTestPayment(2)); !errors.Is(err, ErrStopped) {
+			t.Fatalf("SubmitWithContext after Stop = %v, want ErrStopped", err)
+		}
+	})
+}
+
+func TestSubmitWithContextCancelRacesSlot(t *testing.T) {
+	// O cancelamento e a vaga chegam juntos: qualquer lado pode vencer, mas
+	// o erro tem que dizer a verdade sobre o payment estar na fila
+	var enqueued, canceled int
+	for i := range 100 {
+		pool := newFullPool(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		payment := newTestPayment(i + 1)
+		id := payment.CorrelationID
+
+		done := make(chan error, 1)
+		go func() { done <- pool.SubmitWithContext(ctx, payment) }()
+		time.Sleep(time.Millisecond) // esperando a vaga
+
+		var race sync.WaitGroup
+		start := make(chan struct{})
+		race.Add(2)
+		go func() {
+			defer race.Done()
+			<-start
+			cancel()
+		}()
+		go func() {
+			defer race.Done()
+			<-start
+			pool.SetQueueCapacity(2)
+		}()
+		close(start)
+		race.Wait()
+
+		err := <-done
+		_, tracked := pool.Lifecycle().Get(id)
+		switch {
+		case err == nil:
+			enqueued++
+			if pool.GetQueueSize() != 2 || !tracked {
+				t.Fatalf("round %d: nil error but queue size %d, tracked %v", i, pool.GetQueueSize(), tracked)
+			}
+		case errors.Is(err, context.Canceled):
+			canceled++
+			if pool.GetQueueSize() != 1 || tracked {
+				t.Fatalf("round %d: canceled but queue size %d, tracked %v", i, pool.GetQueueSize(), tracked)
+			}
+		default:
+			t.Fatalf("round %d: SubmitWithContext = %v, want nil or context.Canceled", i, err)
+		}
+		pool.Stop()
+	}
+	t.Logf("%d enqueued, %d canceled", enqueued, canceled)
+}
+
+func TestSubmitWithContextWakesOnDequeue(t *testing.T) {
+	backends := map[string]func() Backend{
+		"memory":   func() Backend { return NewRingBackend(1) },
+		"priority": func() Backend { return NewPriorityBackend(1, testPriorityThreshold, time.Hour) },
+	}
+	for name, newBackend := range backends {
+		t.Run(name, func(t *testing.T) {
+			cfg := testPoolConfig(1)
+			cfg.QueueSize = 1
+			cfg.BatchSize, cfg.BatchParallelism = 1, 1
+			processor := NewPaymentProcessor(testProcessorConfig(newFakeProcessor(t), newFakeProcessor(t)), store.NewMemoryStore(store.MemoryOptions{}))
+			pool := NewWorkerPool(processor, newBackend(), cfg)
+			t.Cleanup(pool.Stop)
+			if err := pool.Submit(context.Background(), newTestPayment(0)); err != nil {
+				t.Fatal(err)
+			}
+
+			// Sem workers, nada sai da fila e o SubmitWithContext espera
+			done := submitAsync(context.Background(), pool, 1)
+			select {
+			case err := <-done:
+				t.Fatalf("SubmitWithContext returned %v with the queue full", err)
+			case <-time.After(20 * time.Millisecond):
+			}
+
+			// O worker retirar o primeiro job abre a vaga do segundo
+			pool.Start()
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Fatalf("SubmitWithContext = %v after a dequeue, want nil", err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("SubmitWithContext still blocked after a dequeue")
+			}
+		})
+	}
+}
+
+func TestRoomSignal(t *testing.T) {
+	var room roomSignal
+	room.notify() // sem ninguém esperando, não faz nada
+
+	first := room.wait()
+	if room.wait() != first {
+		t.Fatal("waiters before a notify got different channels")
+	}
+	select {
+	case <-first:
+		t.Fatal("channel closed before a notify")
+	default:
+	}
+
+	room.notify()
+	select {
+	case <-first:
+	default:
+		t.Fatal("notify did not close the channel")
+	}
+	if second := room.wait(); second == first {
+		t.Fatal("wait after a notify returned the closed channel")
+	}
+}
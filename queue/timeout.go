@@ -0,0 +1,133 @@
+package queue
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+)
+
+// Recálculo do timeout adaptativo: a cada timeoutInterval, com pelo menos
+// timeoutMinSamples chamadas desde o último ajuste; com menos a janela
+// continua acumulando
+const (
+	timeoutInterval   = 5 * time.Second
+	timeoutMinSamples = 20
+)
+
+// timeoutBounds vai de 1ms a ~4,4s com buckets 15% maiores a cada passo
+var timeoutBounds = metrics.ExponentialBounds(0.001, 1.15, 60)
+
+// processorTimeout é o prazo das chamadas a um processador. Só as
+// chamadas que tiveram resposta (de qualquer status) entram em responses:
+// um timeout registrado no teto empurraria o p99 para o próprio prazo e o
+// prazo para cima a cada ajuste, até o máximo.
+type processorTimeout struct {
+	current   atomic.Int64 // prazo em ns
+	responses *metrics.Histogram
+	timeouts  atomic.Int64 // chamadas que estouraram o prazo desde o último ajuste
+
+	prev metrics.HistogramSnapshot // só a goroutine do ajuste usa
+}
+
+// timeoutPolicy são os limites do ajuste: o prazo é p99Percent% do p99
+// das respostas, dentro de [min, max]
+type timeoutPolicy struct {
+	min, max   time.Duration
+	p99Percent int
+}
+
+// newTimeoutPolicy retorna nil sem ADAPTIVE_TIMEOUT: o prazo fica fixo em
+// cfg.Timeout
+func newTimeoutPolicy(cfg ProcessorConfig) *timeoutPolicy {
+	if !cfg.AdaptiveTimeout {
+		return nil
+	}
+	return &timeoutPolicy{min: cfg.TimeoutMin, max: cfg.TimeoutMax, p99Percent: cfg.TimeoutP99Percent}
+}
+
+func newProcessorTimeout(initial time.Duration) *processorTimeout {
+	t := &processorTimeout{responses: metrics.NewHistogram(timeoutBounds)}
+	t.current.Store(int64(initial))
+	return t
+}
+
+// get retorna o prazo atual
+func (t *processorTimeout) get() time.Duration {
+	return time.Duration(t.current.Load())
+}
+
+// observe registra a duração de uma chamada; timedOut indica que ela
+// estourou o prazo, sem resposta
+func (t *processorTimeout) observe(elapsed time.Duration, timedOut bool) {
+	if timedOut {
+		t.timeouts.Add(1)
+		return
+	}
+	t.responses.Observe(elapsed)
+}
+
+// tune recalcula o prazo a partir das chamadas desde o último ajuste e
+// retorna o novo valor, o p99 das respostas e quantas chamadas havia na
+// janela. Com mais de 1% de timeouts o p99 das respostas está truncado no
+// prazo atual e subestima a latência real: o prazo não diminui e, se o p99
+// não pedir mais, cresce na mesma proporção (p99Percent%) até o teto. É o
+// caso de um processador saudável um pouco acima do prazo, que sem isso
+// teria todas as chamadas cortadas e nenhuma resposta para medir.
+func (t *processorTimeout) tune(policy *timeoutPolicy) (timeout, p99 time.Duration, samples int64) {
+	snap := t.responses.Snapshot()
+	window := snap.Sub(t.prev)
+	timeouts := t.timeouts.Load()
+	current := t.get()
+
+	samples = window.Count + timeouts
+	if samples < timeoutMinSamples {
+		return current, 0, samples
+	}
+	t.prev = snap
+	t.timeouts.Add(-timeouts)
+
+	p99 = window.Quantile(0.99)
+	target := p99 * time.Duration(policy.p99Percent) / 100
+	if timeouts*100 > samples {
+		target = max(target, current*time.Duration(policy.p99Percent)/100)
+	}
+	target = min(max(target, policy.min), policy.max)
+	t.current.Store(int64(target))
+	return target, p99, samples
+}
+
+// TimeoutTuner recalcula o prazo de cada processador a cada
+// timeoutInterval até ctx ser cancelado; sem ADAPTIVE_TIMEOUT retorna na
+// hora
+func (p *PaymentProcessor) TimeoutTuner(ctx context.Context) {
+	if p.timeoutPolicy == nil {
+		return
+	}
+
+	ticker := time.NewTicker(timeoutInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, name := range []string{"default", "fallback"} {
+			status, _ := p.status(name)
+			before := status.timeout.get()
+			after, p99, samples := status.timeout.tune(p.timeoutPolicy)
+			if after != before {
+				p.logger.Debug("processor timeout adjusted",
+					"processor", name,
+					"from_ms", before.Milliseconds(),
+					"to_ms", after.Milliseconds(),
+					"p99_ms", durationMs(p99),
+					"samples", samples)
+			}
+		}
+	}
+}
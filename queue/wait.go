@@ -0,0 +1,51 @@
+package queue
+
+import (
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// queueWaitWindow é a janela do p95 vigiado por watchQueueWait
+const queueWaitWindow = 10 * time.Second
+
+// QueueWaitStats resume o tempo que os payments passaram na fila desde o boot
+func (wp *WorkerPool) QueueWaitStats() types.LatencyStats {
+	return histogramStats(metrics.QueueWait.Snapshot())
+}
+
+// watchQueueWait avisa no log quando o p95 do tempo na fila, medido em
+// janelas de queueWaitWindow, passa de QueueWaitWarn. Usar a janela em vez
+// do histórico faz o aviso parar assim que o backlog é drenado.
+func (wp *WorkerPool) watchQueueWait() {
+	defer wp.wg.Done()
+
+	ticker := time.NewTicker(queueWaitWindow)
+	defer ticker.Stop()
+
+	prev := metrics.QueueWait.Snapshot()
+	for {
+		select {
+		case <-wp.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		snap := metrics.QueueWait.Snapshot()
+		window := snap.Sub(prev)
+		prev = snap
+
+		if window.Count == 0 {
+			continue
+		}
+		if p95 := window.Quantile(0.95); p95 > wp.config.QueueWaitWarn {
+			wp.logger.Warn("queue wait p95 above threshold",
+				"p95_ms", durationMs(p95),
+				"threshold_ms", wp.config.QueueWaitWarn.Milliseconds(),
+				"samples", window.Count,
+				logging.KeyQueueDepth, wp.backend.Len())
+		}
+	}
+}
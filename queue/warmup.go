@@ -0,0 +1,92 @@
+package queue
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+)
+
+// maxIdleConnsPerHost é quantas conexões ociosas o client mantém por
+// processador; aquecer mais que isso só abriria conexões para fechá-las
+const maxIdleConnsPerHost = 10
+
+// Warmup abre as conexões com os dois processadores (com cada réplica
+// deles) antes de o servidor aceitar tráfego, para os primeiros payments
+// não pagarem o handshake TCP (e TLS). Cada conexão é um GET no endpoint
+// de health, todos ao mesmo tempo para o Transport discar uma conexão por
+// requisição; qualquer resposta, mesmo de erro, deixa a conexão ociosa no
+// pool. Um processador fora do ar atrasa o boot no máximo warmupTimeout, e
+// o resultado não muda o estado de saúde de ninguém. Com o cache de DNS,
+// os hosts são resolvidos antes, mesmo sem aquecimento.
+func (p *PaymentProcessor) Warmup(ctx context.Context) {
+	if p.dns != nil {
+		p.dns.refreshAll(ctx)
+	}
+
+	conns := min(p.warmupConns, maxIdleConnsPerHost)
+	if conns <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.warmupTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, status := range []*ProcessorStatus{p.defaultStatus, p.fallbackStatus} {
+		for _, r := range status.replicas.replicas {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				start := time.Now()
+				succeeded := p.warmupProcessor(ctx, status.replicas.processorID, r.url, conns)
+				p.logger.Info("processor connections warmed up",
+					logging.KeyProcessor, status.replicas.processorID,
+					"replica", r.addr,
+					"succeeded", succeeded,
+					"failed", conns-succeeded,
+					"elapsed_ms", time.Since(start).Milliseconds())
+			}()
+		}
+	}
+	wg.Wait()
+}
+
+// warmupProcessor abre conns conexões com o processador e retorna quantas
+// tiveram resposta
+func (p *PaymentProcessor) warmupProcessor(ctx context.Context, processorID, url string, conns int) int {
+	var succeeded atomic.Int64
+	var wg sync.WaitGroup
+	for range conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if p.warmupConn(ctx, processorID, url) {
+				succeeded.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	return int(succeeded.Load())
+}
+
+func (p *PaymentProcessor) warmupConn(ctx context.Context, processorID, url string) bool {
+	req, err := http.NewRequestWithContext(ctx, "GET", healthURL(url), nil)
+	if err != nil {
+		return false
+	}
+	p.setAuthHeaders(req, processorID)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return false
+	}
+	// Ler o corpo até o fim devolve a conexão ao pool em vez de fechá-la
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	return true
+}
@@ -0,0 +1,144 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// MaxWeight é o maior peso de um processador, para a soma nunca estourar
+const MaxWeight = 1_000_000
+
+// ErrInvalidWeight é o peso inválido no POST /admin/weights
+var ErrInvalidWeight = errors.New("invalid weight")
+
+// ErrWeightsDisabled é o POST /admin/weights com ROUTING_STRATEGY=sticky,
+// em que o primeiro processador vem do hash e não do sorteio
+var ErrWeightsDisabled = errors.New("processor weights only apply to ROUTING_STRATEGY=priority")
+
+// routeWeights são os pesos de cada processador, na ordem de global; são
+// trocados inteiros a cada mudança
+type routeWeights struct {
+	values []int64
+	total  int64 // 0 desliga o sorteio
+	since  time.Time
+	base   []int64 // Weighted de cada processador na mudança, para as picks desde ela
+}
+
+// newRouteWeights guarda os pesos e os contadores no momento da mudança
+func (r *router) newRouteWeights(values []int64) *routeWeights {
+	w := &routeWeights{values: values, since: time.Now().UTC(), base: make([]int64, len(r.global))}
+	for i, route := range r.global {
+		w.total += values[i]
+		w.base[i] = metrics.Processor(route.processorID).Weighted.Value()
+	}
+	return w
+}
+
+// weighted retorna a ordem global com o primeiro processador sorteado
+// pelos pesos, contando a pick, ou a ordem global sem sorteio. As ordens
+// são montadas no boot, então o sorteio não aloca.
+func (r *router) weighted() []route {
+	i := r.draw()
+	if i < 0 {
+		return r.global
+	}
+	metrics.Processor(r.global[i].processorID).Weighted.Inc()
+	return r.orders[i]
+}
+
+// draw sorteia, na proporção dos pesos, um processador entre os saudáveis
+// e retorna a posição dele em global; -1 sem pesos ou sem peso em nenhum
+// saudável. Um processador fora do ar sai do sorteio e os pesos dos demais
+// passam a dividir o todo.
+func (r *router) draw() int {
+	w := r.weights.Load()
+	if w.total == 0 {
+		return -1
+	}
+	var total int64
+	for i, route := range r.global {
+		if w.values[i] > 0 && route.status.Healthy() {
+			total += w.values[i]
+		}
+	}
+	if total == 0 {
+		return -1
+	}
+
+	n := rand.Int64N(total)
+	for i, route := range r.global {
+		if w.values[i] == 0 || !route.status.Healthy() {
+			continue
+		}
+		if n < w.values[i] {
+			return i
+		}
+		n -= w.values[i]
+	}
+	return -1 // um processador saiu do ar durante o sorteio
+}
+
+// SetWeights troca os pesos dos processadores em weights, sem restart; os
+// demais mantêm o seu e todos em zero voltam à ordem fixa. Nada muda se
+// algum peso for inválido.
+func (p *PaymentProcessor) SetWeights(weights map[string]int64) (types.WeightStats, error) {
+	r := p.routes
+	if r.sticky {
+		return types.WeightStats{}, ErrWeightsDisabled
+	}
+	current := r.weights.Load()
+	values := append([]int64(nil), current.values...)
+	for name, weight := range weights {
+		i := r.index(name)
+		if i < 0 {
+			return types.WeightStats{}, fmt.Errorf("%w: %s", ErrUnknownProcessor, name)
+		}
+		if weight < 0 || weight > MaxWeight {
+			return types.WeightStats{}, fmt.Errorf("%w: %s must be between 0 and %d, got %d", ErrInvalidWeight, name, MaxWeight, weight)
+		}
+		values[i] = weight
+	}
+
+	r.weights.Store(r.newRouteWeights(values))
+	p.logger.Warn("processor weights changed",
+		"default_weight", values[0],
+		"fallback_weight", values[1],
+		"previous_default_weight", current.values[0],
+		"previous_fallback_weight", current.values[1])
+	return p.WeightStats(), nil
+}
+
+// WeightStats retorna os pesos e as picks de cada processador desde a
+// última mudança
+func (p *PaymentProcessor) WeightStats() types.WeightStats {
+	r := p.routes
+	w := r.weights.Load()
+	stats := types.WeightStats{
+		Enabled:      w.total > 0,
+		Weights:      make(map[string]int64, len(r.global)),
+		Since:        w.since,
+		Picks:        make(map[string]int64, len(r.global)),
+		PicksPercent: make(map[string]float64, len(r.global)),
+	}
+	var picks int64
+	for i, route := range r.global {
+		stats.Weights[route.processorID] = w.values[i]
+		n := metrics.Processor(route.processorID).Weighted.Value() - w.base[i]
+		stats.Picks[route.processorID] = n
+		picks += n
+	}
+	for name, n := range stats.Picks {
+		percent := 0.0
+		if picks > 0 {
+			percent = math.Round(float64(n)/float64(picks)*1000) / 10
+		}
+		stats.PicksPercent[name] = percent
+	}
+	return stats
+}
@@ -2,136 +2,620 @@ package queue
 
 import (
 	"context"
-	"runtime"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+	"github.com/yurimachados/rinha-backend-go/metrics"
+	"github.com/yurimachados/rinha-backend-go/tracing"
 	"github.com/yurimachados/rinha-backend-go/types"
 )
 
 // WorkerPool gerencia um pool de workers para processamento assíncrono
 type WorkerPool struct {
-	processor    *PaymentProcessor
-	workQueue    chan *types.PaymentRequest
-	workerCount  int
-	ctx          context.Context
-	cancel       context.CancelFunc
-	wg           sync.WaitGroup
+	processor   *PaymentProcessor
+	backend     Backend
+	config      PoolConfig
+	workers     atomic.Int32 // workers vivos
+	nextID      atomic.Int32 // id do próximo worker
+	registry    *workerRegistry
+	callbacks   *callbackSender // opcional, avisos ao callbackUrl
+	journal     *failureJournal // opcional, registro dos payments abandonados
+	events      *EventHub
+	lifecycle   *Lifecycle
+	pause       *pauseGate
+	stop        chan struct{} // pede a um worker ocioso que termine
+	enqueueRate atomic.Int64  // payments aceitos por segundo na última amostra
+	throttled   atomic.Int64  // jobs aguardando o retryThrottled
+	budget      retryBudget   // teto de tentativas de cada job, conferido no attempt
+	drain       drainMeter    // jobs finalizados por segundo
+	enqueued    atomic.Int64  // jobs aceitos pela fila desde o boot
+	inFlight    atomic.Int64  // jobs retirados da fila e ainda sem finish
+	scaleUps    atomic.Int64
+	scaleDowns  atomic.Int64
+	ctx         context.Context
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+	logger      *slog.Logger
+
+	// submitMu exclui os Submit em andamento do fechamento da fila: o Stop
+	// só fecha o backend depois de marcar closed com o lock exclusivo
+	submitMu sync.RWMutex
+	closed   bool
+	closing  chan struct{} // fechado junto com closed, acorda o SubmitWithContext
+	room     roomSignal    // avisa o SubmitWithContext de vaga na fila
+	stopOnce sync.Once
+
+	shutdownAcct shutdownAccount
 }
 
-// NewWorkerPool cria um novo pool de workers otimizado
-func NewWorkerPool(processor *PaymentProcessor, queueSize int) *WorkerPool {
+// NewWorkerPool cria um novo pool de workers otimizado. A capacidade da
+// fila em cfg já deve ter sido aplicada ao backend.
+func NewWorkerPool(processor *PaymentProcessor, backend Backend, cfg PoolConfig) *WorkerPool {
 	ctx, cancel := context.WithCancel(context.Background())
-	
-	// Número de workers baseado no número de CPUs
-	workerCount := runtime.NumCPU() * 4 // 4x o número de CPUs para I/O intensivo
-	if workerCount > 100 {
-		workerCount = 100 // limite máximo
+
+	wp := &WorkerPool{
+		processor: processor,
+		backend:   backend,
+		config:    cfg,
+		budget:    newRetryBudget(cfg),
+		stop:      make(chan struct{}),
+		closing:   make(chan struct{}),
+		registry:  newWorkerRegistry(),
+		events:    NewEventHub(),
+		lifecycle: NewLifecycle(),
+		pause:     newPauseGate(),
+		ctx:       ctx,
+		cancel:    cancel,
+		logger:    slog.Default(),
 	}
-	
-	return &WorkerPool{
-		processor:   processor,
-		workQueue:   make(chan *types.PaymentRequest, queueSize),
-		workerCount: workerCount,
-		ctx:         ctx,
-		cancel:      cancel,
+	if n, ok := backend.(roomNotifier); ok {
+		n.notifyRoom(&wp.room)
 	}
+	return wp
 }
 
-// Start inicia os workers do pool
+// Start inicia os workers do pool e, com autoscaling, o supervisor
 func (wp *WorkerPool) Start() {
-	for i := 0; i < wp.workerCount; i++ {
+	wp.restore()
+
+	for i := 0; i < wp.config.Workers; i++ {
+		wp.startWorker()
+	}
+
+	if wp.config.Autoscale {
 		wp.wg.Add(1)
-		go wp.worker(i)
+		go wp.supervise()
 	}
+
+	if wp.config.QueueWaitWarn > 0 {
+		wp.wg.Add(1)
+		go wp.watchQueueWait()
+	}
+}
+
+// startWorker inicia mais um worker
+func (wp *WorkerPool) startWorker() {
+	wp.wg.Add(1)
+	wp.workers.Add(1)
+	go wp.worker(int(wp.nextID.Add(1)) - 1)
 }
 
-// Stop para os workers do pool graciosamente
+// Stop para os workers do pool graciosamente. Pausado, os workers não
+// voltam a drenar a fila: o que está na fila em memória é descartado e, com
+// Redis, fica pendente para a próxima instância. Depois do Stop o Submit
+// retorna false; chamadas repetidas não fazem nada.
 func (wp *WorkerPool) Stop() {
-	close(wp.workQueue)
+	wp.stopOnce.Do(wp.shutdown)
+}
+
+func (wp *WorkerPool) shutdown() {
+	wp.BeginDrain()
+
+	wp.submitMu.Lock()
+	wp.closed = true
+	close(wp.closing)
+	wp.submitMu.Unlock()
+
+	if wp.Paused() {
+		wp.logger.Warn("stopping paused worker pool, queued payments left unprocessed",
+			logging.KeyQueueDepth, wp.backend.Len())
+	}
+	if queued, processing := wp.lifecycle.Unfinished(); processing > 0 {
+		wp.logger.Warn("stopping worker pool with payments in flight",
+			"queued", queued,
+			"processing", processing)
+	}
+	// Workers parados antes de fechar a fila: o Ack dos jobs em voo ainda
+	// usa o backend, e no Redis o Close fecha o client
 	wp.cancel()
 	wp.wg.Wait()
+	wp.backend.Close()
+	queued := wp.backend.Len()
+	wp.shutdownAcct.stop(queued, wp.queuedAction(wp.spill()))
+
+	// Na fila em memória os queued restantes se perdem, a menos que tenham
+	// ido para o SpillPath; com Redis seguem pendentes para a próxima
+	// instância
+	if queued, processing := wp.lifecycle.Unfinished(); queued+processing > 0 {
+		wp.logger.Warn("worker pool stopped with unfinished payments",
+			"queued", queued,
+			"processing", processing)
+	}
+
+	if wp.callbacks != nil {
+		wp.callbacks.stop()
+	}
+	if wp.journal != nil {
+		wp.journal.stop()
+	}
+}
+
+// Submit envia um payment para processamento, levando o id da requisição
+// em ctx até os logs do worker e a chamada ao processador. Retorna nil com
+// o payment na fila, ErrQueueFull, ErrStopped ou um *TransitionError se o
+// correlationId já está na fila, em processamento ou processado.
+func (wp *WorkerPool) Submit(ctx context.Context, payment *types.PaymentRequest) error {
+	return wp.push(Job{
+		Payment:    payment,
+		requestID:  logging.RequestID(ctx),
+		enqueuedAt: time.Now(),
+	})
 }
 
-// Submit envia um payment para processamento
-func (wp *WorkerPool) Submit(payment *types.PaymentRequest) bool {
-	select {
-	case wp.workQueue <- payment:
-		return true
-	default:
-		return false // fila cheia
+// SubmitTraced envia um payment vinculando-o ao span ativo em ctx, para que
+// o span do worker aponte para o span do aceite; os erros são os do Submit
+func (wp *WorkerPool) SubmitTraced(ctx context.Context, payment *types.PaymentRequest) error {
+	return wp.push(Job{
+		Payment:     payment,
+		spanContext: trace.SpanContextFromContext(ctx),
+		requestID:   logging.RequestID(ctx),
+		enqueuedAt:  time.Now(),
+	})
+}
+
+// push marca o payment como queued antes de enfileirá-lo, já que um worker
+// pode retirá-lo antes de o Push retornar; recusado pela fila, o
+// acompanhamento volta ao que era. Um correlationId que não pode voltar a
+// queued não é enfileirado de novo. Com o pool parado nada é enfileirado.
+func (wp *WorkerPool) push(j Job) error {
+	wp.submitMu.RLock()
+	defer wp.submitMu.RUnlock()
+	if wp.closed {
+		return ErrStopped
+	}
+
+	undo, err := wp.lifecycle.enqueue(j.Payment.CorrelationID)
+	if err != nil {
+		return err
+	}
+	if !wp.backend.Push(j) {
+		undo()
+		return ErrQueueFull
 	}
+	wp.enqueued.Add(1)
+	return nil
 }
 
-// worker processa payments da fila
+// Lifecycle retorna o acompanhamento de estado dos payments desta instância
+func (wp *WorkerPool) Lifecycle() *Lifecycle {
+	return wp.lifecycle
+}
+
+// worker processa payments da fila. Ocioso, fica bloqueado na fila sem
+// busy-waiting; ao receber um job drena o backlog disponível em um lote de
+// até BatchSize. Sem BatchFlush o lote é processado na hora, então um
+// payment sozinho não espera o lote encher. O pedido de parada do
+// autoscaling e a pausa só são atendidos entre lotes, nunca no meio de um
+// payment.
 func (wp *WorkerPool) worker(id int) {
 	defer wp.wg.Done()
-	
-	// Batch processing para eficiência
-	batch := make([]*types.PaymentRequest, 0, 10)
-	ticker := time.NewTicker(50 * time.Millisecond) // flush batch a cada 50ms
-	defer ticker.Stop()
-	
+	defer wp.recoverWorker(id)
+	defer wp.workers.Add(-1)
+
+	stats := wp.registry.register(id)
+	defer wp.registry.retire(stats)
+
+	deliveries := wp.backend.Deliveries()
+	batch := make([]Job, 0, wp.config.BatchSize)
+
 	for {
+		paused, pausing, resumed := wp.pause.state()
+		if paused {
+			if !wp.awaitResume(resumed) {
+				return
+			}
+			continue
+		}
+		if !wp.awaitRateLimit() {
+			return
+		}
+
 		select {
 		case <-wp.ctx.Done():
-			// Processar batch restante antes de sair
-			wp.processBatch(batch)
 			return
-			
-		case payment, ok := <-wp.workQueue:
+
+		case <-wp.stop:
+			wp.logger.Debug("worker stopped by autoscaler", "worker_id", id)
+			return
+
+		case <-pausing:
+			continue
+
+		case job, ok := <-deliveries:
 			if !ok {
-				// Canal fechado, processar batch restante
-				wp.processBatch(batch)
-				return
+				return // canal fechado
+			}
+
+			// Em voo desde a retirada: o lote pode esperar o BatchFlush
+			wp.takeOff(&job)
+			batch = append(batch[:0], job)
+
+			// Drenar o backlog sem bloquear
+		drain:
+			for len(batch) < cap(batch) {
+				select {
+				case job, ok := <-deliveries:
+					if !ok {
+						break drain
+					}
+					wp.takeOff(&job)
+					batch = append(batch, job)
+				default:
+					break drain
+				}
 			}
-			
-			batch = append(batch, payment)
-			
-			// Processar batch quando estiver cheio
-			if len(batch) >= 10 {
-				wp.processBatch(batch)
-				batch = batch[:0] // reset slice
+
+			if wp.config.BatchFlush > 0 && len(batch) < cap(batch) {
+				batch = wp.fillBatch(deliveries, batch)
 			}
-			
-		case <-ticker.C:
-			// Flush batch periodicamente
-			if len(batch) > 0 {
-				wp.processBatch(batch)
-				batch = batch[:0]
+
+			wp.processBatch(stats, batch)
+		}
+	}
+}
+
+// fillBatch espera até BatchFlush por mais jobs para completar o lote
+func (wp *WorkerPool) fillBatch(deliveries <-chan Job, batch []Job) []Job {
+	timer := time.NewTimer(wp.config.BatchFlush)
+	defer timer.Stop()
+
+	for len(batch) < cap(batch) {
+		select {
+		case job, ok := <-deliveries:
+			if !ok {
+				return batch
 			}
+			wp.takeOff(&job)
+			batch = append(batch, job)
+		case <-timer.C:
+			return batch
+		case <-wp.ctx.Done():
+			return batch
 		}
 	}
+	return batch
 }
 
 // processBatch processa um lote de payments de forma paralela
-func (wp *WorkerPool) processBatch(batch []*types.PaymentRequest) {
+func (wp *WorkerPool) processBatch(stats *workerStats, batch []Job) {
 	if len(batch) == 0 {
 		return
 	}
-	
-	// Processar até 5 payments em paralelo por batch
-	semaphore := make(chan struct{}, 5)
+
+	start := time.Now()
+	defer func() { stats.busy.Add(int64(time.Since(start))) }()
+	defer wp.landOnPanic(batch)
+	stats.batches.Add(1)
+
+	metrics.WorkerBatches.Inc()
+	metrics.PaymentsDequeued.Add(int64(len(batch)))
+	wp.logger.Debug("processing batch",
+		"batch_size", len(batch),
+		logging.KeyQueueDepth, wp.backend.Len())
+
+	// Jobs vencidos saem antes de qualquer envio
+	now := time.Now()
+	pending := batch[:0]
+	for _, j := range batch {
+		if !j.enqueuedAt.IsZero() {
+			metrics.QueueWait.Observe(now.Sub(j.enqueuedAt))
+		}
+		if wp.expired(j) {
+			wp.expire(stats, j)
+			continue
+		}
+		wp.lifecycle.Processing(j.Payment.CorrelationID)
+		pending = append(pending, j)
+	}
+
+	// Com endpoint de lote, envia em uma chamada; o que não for aceito
+	// segue pelo envio individual
+	if wp.processor.BulkSize() > 0 && len(pending) > 1 {
+		pending = wp.processBulk(stats, pending)
+	}
+
+	// Processar até BatchParallelism payments do lote em paralelo
+	semaphore := make(chan struct{}, wp.config.BatchParallelism)
 	var batchWg sync.WaitGroup
-	
-	for _, payment := range batch {
+
+	for _, job := range pending {
 		semaphore <- struct{}{}
 		batchWg.Add(1)
-		
-		go func(p *types.PaymentRequest) {
+
+		go func(j Job) {
 			defer func() {
 				<-semaphore
 				batchWg.Done()
 			}()
-			
-			wp.processor.ProcessPayment(p)
-		}(payment)
+
+			wp.attempt(stats, j)
+		}(job)
 	}
-	
+
 	batchWg.Wait()
 }
 
+// complete registra o desfecho do envio do job e o confirma na fila
+func (wp *WorkerPool) complete(stats *workerStats, j Job, result *types.ProcessorResult) {
+	if result.Success {
+		stats.processed.Add(1)
+		wp.report(j, types.OutcomeProcessed, result.ProcessorID, "")
+	} else {
+		wp.report(j, types.OutcomeFailed, "", result.Reason)
+		wp.journalFailure(j, types.OutcomeFailed, result)
+		stats.failed.Add(1)
+		if ok, n := logging.DefaultSampler().Allow("worker_failed:" + result.Reason); ok {
+			wp.logger.ErrorContext(j.context(), "payment processing failed",
+				logging.KeyCorrelationID, j.Payment.CorrelationID,
+				logging.KeyReason, result.Reason,
+				logging.KeyQueueDepth, wp.backend.Len(),
+				logging.KeyOccurrences, n)
+		}
+	}
+	wp.finish(j)
+}
+
+// expire descarta um job vencido (QueueTTL) sem enviá-lo
+func (wp *WorkerPool) expire(stats *workerStats, j Job) {
+	wp.processor.RecordExpired(j.context(), j.Payment)
+	stats.expired.Add(1)
+	wp.report(j, types.OutcomeExpired, "", "")
+	wp.journalFailure(j, types.OutcomeExpired, nil)
+	wp.finish(j)
+}
+
+// processBulk envia os jobs ao endpoint de lote em grupos de BulkSize e
+// retorna, reaproveitando o slice, os que ainda precisam de envio individual
+func (wp *WorkerPool) processBulk(stats *workerStats, jobs []Job) []Job {
+	size := wp.processor.BulkSize()
+	remaining := jobs[:0]
+	payments := make([]*types.PaymentRequest, 0, size)
+
+	for start := 0; start < len(jobs); start += size {
+		chunk := jobs[start:min(start+size, len(jobs))]
+
+		payments = payments[:0]
+		for _, j := range chunk {
+			payments = append(payments, j.Payment)
+		}
+
+		processorID, handled, panicked := wp.sendBulk(chunk, payments)
+		// remaining nunca passa da posição lida, então reaproveitar jobs é seguro
+		for i, j := range chunk {
+			if panicked {
+				wp.processor.recordAttempt()
+				wp.processor.recordFailure()
+				stats.failed.Add(1)
+				wp.report(j, types.OutcomeFailed, "", reasonPanic)
+				wp.journalFailure(j, types.OutcomeFailed, bulkPanicResult)
+				wp.finish(j)
+			} else if handled[i] {
+				stats.processed.Add(1)
+				wp.report(j, types.OutcomeProcessed, processorID, "")
+				wp.finish(j)
+			} else {
+				remaining = append(remaining, j)
+			}
+		}
+	}
+	return remaining
+}
+
+// report registra o estado final do job e publica o desfecho no stream de
+// eventos e no callback; reason é a classe da falha em OutcomeFailed. Deve
+// ser chamado antes do finish, que devolve o payment ao pool.
+func (wp *WorkerPool) report(j Job, outcome, processorID, reason string) {
+	id := j.Payment.CorrelationID
+	switch outcome {
+	case types.OutcomeProcessed:
+		wp.lifecycle.Succeeded(id, processorID)
+	case types.OutcomeFailed:
+		wp.lifecycle.Failed(id, reason)
+	case types.OutcomeExpired:
+		wp.lifecycle.Expired(id)
+	}
+	wp.events.publishJob(j, outcome, processorID)
+	wp.notify(j, outcome, processorID)
+}
+
+// takeOff conta o job retirado da fila como em voo até o finish
+func (wp *WorkerPool) takeOff(j *Job) {
+	j.landed = new(atomic.Bool)
+	wp.inFlight.Add(1)
+	wp.room.notify()
+}
+
+// land tira o job dos em voo uma única vez, seja pelo finish ou pelo
+// landOnPanic
+func (wp *WorkerPool) land(j Job) {
+	if j.landed == nil || j.landed.CompareAndSwap(false, true) {
+		wp.inFlight.Add(-1)
+	}
+}
+
+// landOnPanic, adiado no processBatch, tira dos em voo os jobs que um
+// pânico do worker deixou sem desfecho (ver recoverWorker), para o gauge
+// não contá-los para sempre; o pânico segue até o recoverWorker. Os
+// filtros do lote reaproveitam o array, mas os jobs ainda sem finish
+// continuam nele, e o land ignora os que já saíram.
+func (wp *WorkerPool) landOnPanic(batch []Job) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	for _, j := range batch {
+		wp.land(j)
+	}
+	panic(r)
+}
+
+// finish confirma o job na fila e, fim do ciclo, devolve o payment ao pool
+func (wp *WorkerPool) finish(j Job) {
+	wp.drain.add(time.Now().Unix())
+	wp.land(j)
+	wp.backend.Ack(j)
+	types.ReleasePayment(j.Payment)
+}
+
+// expired indica se o job passou do QueueTTL. A checagem é feita na saída
+// da fila: o cliente já desistiu de um payment tão antigo e enviá-lo ao
+// processador só atrasaria os demais.
+func (wp *WorkerPool) expired(j Job) bool {
+	if wp.config.QueueTTL <= 0 || j.enqueuedAt.IsZero() {
+		return false
+	}
+	return time.Since(j.enqueuedAt) > wp.config.QueueTTL
+}
+
+// processJob processa um job, criando o span do worker quando o tracing
+// está ativo. O span é vinculado (link) ao span do aceite, que já terminou.
+// Sem token no rate limit de nenhum processador o resultado é
+// reasonThrottled, e sem processador permitido saudável para o type,
+// reasonRouteUnavailable, sem contabilizar nada, para o job ser tentado de
+// novo.
+func (wp *WorkerPool) processJob(ctx context.Context, j Job) (result *types.ProcessorResult) {
+	defer wp.recoverJob(ctx, j, &result)
+
+	if !tracing.Enabled() {
+		return wp.processor.processPayment(ctx, j.Payment, true)
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "process payment",
+		trace.WithLinks(trace.Link{SpanContext: j.spanContext}),
+		trace.WithAttributes(attribute.String("payment.correlation_id", j.Payment.CorrelationID)))
+	defer span.End()
+
+	result = wp.processor.processPayment(ctx, j.Payment, true)
+	span.SetAttributes(attribute.String("payment.processor", result.ProcessorID))
+	if !result.Success {
+		span.SetStatus(codes.Error, result.Reason)
+	}
+	return result
+}
+
 // GetQueueSize retorna o tamanho atual da fila
 func (wp *WorkerPool) GetQueueSize() int {
-	return len(wp.workQueue)
+	return wp.backend.Len()
+}
+
+// Enqueued retorna quantos jobs a fila aceitou desde o boot, inclusive os
+// recarregados do spill
+func (wp *WorkerPool) Enqueued() int64 {
+	return wp.enqueued.Load()
+}
+
+// InFlight retorna quantos jobs foram retirados da fila e ainda não
+// terminaram
+func (wp *WorkerPool) InFlight() int64 {
+	return wp.inFlight.Load()
+}
+
+// SharedQueue indica se a fila é compartilhada entre instâncias (Redis):
+// os jobs aceitos aqui podem terminar em outra instância
+func (wp *WorkerPool) SharedQueue() bool {
+	_, local := wp.backend.(drainer)
+	return !local
+}
+
+// Workers retorna quantos workers estão vivos
+func (wp *WorkerPool) Workers() int {
+	return int(wp.workers.Load())
+}
+
+// GetQueueCapacity retorna a capacidade da fila
+func (wp *WorkerPool) GetQueueCapacity() int {
+	return wp.backend.Cap()
+}
+
+// Stats retorna a configuração efetiva do pool e a ocupação da fila
+func (wp *WorkerPool) Stats() types.PoolStats {
+	stats := types.PoolStats{
+		Workers:      wp.Workers(),
+		QueueSize:    wp.GetQueueCapacity(),
+		QueueDepth:   wp.GetQueueSize(),
+		InFlight:     wp.inFlight.Load(),
+		BatchSize:    wp.config.BatchSize,
+		BatchFlushMs: wp.config.BatchFlush.Milliseconds(),
+		QueueTTLMs:   wp.config.QueueTTL.Milliseconds(),
+
+		BatchParallelism: wp.config.BatchParallelism,
+
+		PriorityThreshold: wp.config.PriorityThreshold,
+
+		Throttled: wp.throttled.Load(),
+		DrainRate: wp.DrainRate(),
+
+		Pause: wp.PauseStats(),
+	}
+
+	if wp.config.Autoscale {
+		stats.Autoscale = &types.AutoscaleStats{
+			MinWorkers:  wp.config.MinWorkers,
+			MaxWorkers:  wp.config.MaxWorkers,
+			EnqueueRate: wp.enqueueRate.Load(),
+			ScaleUps:    wp.scaleUps.Load(),
+			ScaleDowns:  wp.scaleDowns.Load(),
+		}
+	}
+	return stats
+}
+
+// RegisterMetrics registra os gauges da fila no /metrics
+func (wp *WorkerPool) RegisterMetrics() {
+	metrics.RegisterGauge("rinha_queue_depth", "Itens aguardando na fila.", "", func() float64 {
+		return float64(wp.GetQueueSize())
+	})
+	metrics.RegisterGauge("rinha_queue_capacity", "Capacidade da fila.", "", func() float64 {
+		return float64(wp.GetQueueCapacity())
+	})
+	metrics.RegisterGauge("rinha_queue_in_flight", "Payments retirados da fila e ainda sem desfecho.", "", func() float64 {
+		return float64(wp.inFlight.Load())
+	})
+	metrics.RegisterGauge("rinha_workers", "Workers ativos no pool.", "", func() float64 {
+		return float64(wp.workers.Load())
+	})
+	metrics.RegisterGauge("rinha_payments_in_status", "Payments desta instância por estado.", `status="queued"`, func() float64 {
+		queued, _ := wp.lifecycle.Unfinished()
+		return float64(queued)
+	})
+	metrics.RegisterGauge("rinha_payments_in_status", "Payments desta instância por estado.", `status="processing"`, func() float64 {
+		_, processing := wp.lifecycle.Unfinished()
+		return float64(processing)
+	})
+	metrics.RegisterGauge("rinha_processing_paused", "1 com o processamento pausado pelo admin.", "", func() float64 {
+		if wp.Paused() {
+			return 1
+		}
+		return 0
+	})
+	metrics.RegisterGauge("rinha_event_subscribers", "Streams abertos no /payments/events.", "", func() float64 {
+		return float64(wp.events.subscribers.Load())
+	})
 }
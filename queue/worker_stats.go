@@ -0,0 +1,105 @@
+package queue
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// workerStats são os contadores de um worker. Só o próprio worker e as
+// goroutines do seu lote escrevem, com atomics; a agregação fica na leitura.
+type workerStats struct {
+	id        int
+	startedAt time.Time
+	processed atomic.Int64
+	failed    atomic.Int64
+	expired   atomic.Int64
+	batches   atomic.Int64
+	busy      atomic.Int64 // nanossegundos processando lotes
+}
+
+// workerRegistry guarda os workers vivos e o acumulado dos que já
+// terminaram, para os totais não voltarem quando o autoscaling encolhe o
+// pool. O lock só é usado quando um worker inicia, termina ou na leitura.
+type workerRegistry struct {
+	mu      sync.Mutex
+	active  map[int]*workerStats
+	retired types.RetiredWorkerStats
+}
+
+func newWorkerRegistry() *workerRegistry {
+	return &workerRegistry{active: make(map[int]*workerStats)}
+}
+
+// register cria os contadores de um worker que está iniciando
+func (r *workerRegistry) register(id int) *workerStats {
+	ws := &workerStats{id: id, startedAt: time.Now()}
+	r.mu.Lock()
+	r.active[id] = ws
+	r.mu.Unlock()
+	return ws
+}
+
+// retire move os contadores de um worker que terminou para o acumulado
+func (r *workerRegistry) retire(ws *workerStats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.active, ws.id)
+	r.retired.Workers++
+	r.retired.WorkerCounters.Add(ws.counters())
+}
+
+// report retorna os contadores por worker, ordenados por id, e o acumulado
+// dos workers encerrados
+func (r *workerRegistry) report() types.WorkersReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := types.WorkersReport{
+		Workers: make([]types.WorkerStats, 0, len(r.active)),
+		Retired: r.retired,
+	}
+	for _, ws := range r.active {
+		report.Workers = append(report.Workers, types.WorkerStats{
+			ID:             ws.id,
+			StartedAt:      ws.startedAt,
+			WorkerCounters: ws.counters(),
+		})
+	}
+	sort.Slice(report.Workers, func(i, j int) bool {
+		return report.Workers[i].ID < report.Workers[j].ID
+	})
+	return report
+}
+
+// totals soma os contadores dos workers vivos e dos encerrados
+func (r *workerRegistry) totals() types.WorkerCounters {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	totals := r.retired.WorkerCounters
+	for _, ws := range r.active {
+		totals.Add(ws.counters())
+	}
+	return totals
+}
+
+func (ws *workerStats) counters() types.WorkerCounters {
+	return types.WorkerCounters{
+		Processed: ws.processed.Load(),
+		Failed:    ws.failed.Load(),
+		Expired:   ws.expired.Load(),
+		Batches:   ws.batches.Load(),
+		BusyMs:    time.Duration(ws.busy.Load()).Milliseconds(),
+	}
+}
+
+// WorkerStats retorna os contadores de cada worker vivo e o acumulado dos
+// que o autoscaling já encerrou
+func (wp *WorkerPool) WorkerStats() types.WorkersReport {
+	return wp.registry.report()
+}
@@ -0,0 +1,313 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/store"
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+func TestPartialBatchFlushesWithinInterval(t *testing.T) {
+	processor := newFakeProcessor(t)
+	processor.seen = make(chan string, 10)
+
+	cfg := testPoolConfig(1)
+	cfg.BatchSize = 10
+	cfg.BatchFlush = 50 * time.Millisecond
+	pool := newTestPool(t, testProcessorConfig(processor, newFakeProcessor(t)), cfg)
+
+	start := time.Now()
+	if pool.Submit(context.Background(), newTestPayment(1)) != nil {
+		t.Fatal("Submit refused the payment")
+	}
+	select {
+	case <-processor.seen:
+	case <-time.After(cfg.BatchFlush + 250*time.Millisecond):
+		t.Fatalf("a batch of 1 out of %d was not flushed within %s", cfg.BatchSize, cfg.BatchFlush)
+	}
+	// O lote incompleto espera o intervalo por mais payments antes de sair
+	if elapsed := time.Since(start); elapsed < cfg.BatchFlush {
+		t.Errorf("batch flushed after %s, before the %s interval", elapsed, cfg.BatchFlush)
+	}
+}
+
+func TestBatchParallelismNeverExceedsCap(t *testing.T) {
+	processor := newFakeProcessor(t)
+	processor.delay.Store(int64(20 * time.Millisecond))
+
+	cfg := testPoolConfig(1)
+	cfg.BatchSize = 10
+	cfg.BatchParallelism = 3
+	cfg.BatchFlush = 20 * time.Millisecond // lotes cheios mesmo com o Submit mais lento que o worker
+	pool := newTestPool(t, testProcessorConfig(processor, newFakeProcessor(t)), cfg)
+
+	const payments = 40
+	for i := range payments {
+		if pool.Submit(context.Background(), newTestPayment(i)) != nil {
+			t.Fatalf("Submit refused payment %d", i)
+		}
+	}
+	waitFor(t, 5*time.Second, "all payments to reach the processor", func() bool {
+		return processor.calls.Load() == payments
+	})
+
+	if peak := processor.peak.Load(); peak > int64(cfg.BatchParallelism) {
+		t.Fatalf("%d concurrent processor calls, cap is %d", peak, cfg.BatchParallelism)
+	} else if peak < int64(cfg.BatchParallelism) {
+		t.Errorf("peak of %d concurrent calls never reached the cap of %d", peak, cfg.BatchParallelism)
+	}
+}
+
+func TestPooledPaymentsSurviveHandoff(t *testing.T) {
+	if testing.Short() {
+		t.Skip("pushes 20000 payments through the processor")
+	}
+	processor := newFakeProcessor(t)
+	var mu sync.Mutex
+	received := make(map[string]int)
+	duplicates := 0
+	processor.onPayment = func(p types.PaymentRequest) {
+		mu.Lock()
+		defer mu.Unlock()
+		if _, ok := received[p.CorrelationID]; ok {
+			duplicates++
+		}
+		received[p.CorrelationID] = p.Amount
+	}
+
+	cfg := testPoolConfig(16)
+	cfg.QueueSize = 1024
+	pool := newTestPool(t, testProcessorConfig(processor, newFakeProcessor(t)), cfg)
+
+	// Os payments vêm do pool como no handler; um payment devolvido enquanto
+	// ainda na fila chegaria ao processador com o id ou o valor de outro
+	const payments = 20000
+	var submitters sync.WaitGroup
+	for g := range 8 {
+		submitters.Add(1)
+		go func() {
+			defer submitters.Done()
+			for i := g; i < payments; i += 8 {
+				payment := types.AcquirePayment()
+				*payment = *newTestPayment(i)
+				payment.Amount = i + 1
+				for pool.Submit(context.Background(), payment) != nil {
+					time.Sleep(time.Millisecond) // fila cheia: tentar de novo
+				}
+			}
+		}()
+	}
+	submitters.Wait()
+	waitFor(t, 60*time.Second, "all payments to reach the processor", func() bool {
+		return processor.calls.Load() >= payments
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if duplicates > 0 || len(received) != payments {
+		t.Fatalf("processor saw %d distinct payments and %d duplicates, want %d and 0", len(received), duplicates, payments)
+	}
+	for i := range payments {
+		id := newTestPayment(i).CorrelationID
+		if amount := received[id]; amount != i+1 {
+			t.Fatalf("payment %s arrived with amount %d, want %d", id, amount, i+1)
+		}
+	}
+}
+
+func TestLonePaymentIsNotHeldForABatch(t *testing.T) {
+	processor := newFakeProcessor(t)
+	processor.seen = make(chan string, 1)
+	pool := newTestPool(t, testProcessorConfig(processor, newFakeProcessor(t)), testPoolConfig(2))
+
+	// O pool está ocioso: o worker bloqueado no channel recebe o payment e o
+	// envia sem esperar o lote encher
+	for i := range 5 {
+		start := time.Now()
+		if pool.Submit(context.Background(), newTestPayment(i)) != nil {
+			t.Fatal("Submit refused the payment")
+		}
+		<-processor.seen
+		if elapsed := time.Since(start); elapsed > 10*time.Millisecond {
+			t.Errorf("payment %d reached the processor after %s, want single-digit milliseconds", i, elapsed)
+		}
+	}
+}
+
+// BenchmarkPoolThroughput mede payments por segundo da fila ao processador
+// local, sem atraso: o custo é o do pool e do client HTTP
+func BenchmarkPoolThroughput(b *testing.B) {
+	for _, batchSize := range []int{1, 10} {
+		b.Run(fmt.Sprintf("batch=%d", batchSize), func(b *testing.B) {
+			processor := newFakeProcessor(b)
+			cfg := testPoolConfig(8)
+			cfg.QueueSize = 4096
+			cfg.BatchSize = batchSize
+			cfg.BatchParallelism = batchSize
+			pool := newTestPool(b, testProcessorConfig(processor, newFakeProcessor(b)), cfg)
+
+			b.ResetTimer()
+			for i := range b.N {
+				for pool.Submit(context.Background(), newTestPayment(i)) != nil {
+					runtime.Gosched()
+				}
+			}
+			for processor.calls.Load() < int64(b.N) {
+				time.Sleep(100 * time.Microsecond)
+			}
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "payments/s")
+		})
+	}
+}
+
+// closeCheckBackend conta os Ack e os que chegaram depois do Close, que no
+// Redis falhariam com o client fechado
+type closeCheckBackend struct {
+	*RingBackend
+	closed   atomic.Bool
+	acks     atomic.Int64
+	lateAcks atomic.Int64
+}
+
+func (b *closeCheckBackend) Ack(job Job) {
+	b.acks.Add(1)
+	if b.closed.Load() {
+		b.lateAcks.Add(1)
+	}
+	b.RingBackend.Ack(job)
+}
+
+func (b *closeCheckBackend) Close() {
+	b.closed.Store(true)
+	b.RingBackend.Close()
+}
+
+func TestStopAcksInFlightBeforeClosingBackend(t *testing.T) {
+	processor := newFakeProcessor(t)
+	processor.delay.Store(int64(50 * time.Millisecond))
+	cfg := testPoolConfig(4)
+	cfg.BatchSize, cfg.BatchParallelism = 1, 1
+	backend := &closeCheckBackend{RingBackend: NewRingBackend(cfg.QueueSize)}
+	paymentProcessor := NewPaymentProcessor(testProcessorConfig(processor, newFakeProcessor(t)), store.NewMemoryStore(store.MemoryOptions{}))
+	pool := NewWorkerPool(paymentProcessor, backend, cfg)
+	pool.Start()
+
+	for i := range 4 {
+		if pool.Submit(context.Background(), newTestPayment(i)) != nil {
+			t.Fatalf("Submit refused payment %d", i)
+		}
+	}
+	waitFor(t, time.Second, "every worker to take a payment", func() bool { return pool.InFlight() == 4 })
+	pool.Stop()
+
+	if got := backend.acks.Load(); got != 4 {
+		t.Errorf("acks = %d, want the 4 payments in flight at the stop", got)
+	}
+	if got := backend.lateAcks.Load(); got != 0 {
+		t.Errorf("%d acks after the backend was closed", got)
+	}
+}
+
+// BenchmarkBackendThroughput compara a fila em memória com a do Redis sob o
+// mesmo pool, para medir o custo da ida ao Redis. O Redis só entra com
+// REDIS_URL, de preferência um banco descartável: a stream é a de produção.
+func BenchmarkBackendThroughput(b *testing.B) {
+	backends := []struct {
+		name string
+		open func(b *testing.B, capacity int) Backend
+	}{
+		{"memory", func(b *testing.B, capacity int) Backend { return NewRingBackend(capacity) }},
+		{"redis", func(b *testing.B, capacity int) Backend {
+			redisURL := os.Getenv("REDIS_URL")
+			if redisURL == "" {
+				b.Skip("REDIS_URL not set")
+			}
+			backend, err := NewRedisBackend(redisURL, capacity)
+			if err != nil {
+				b.Fatal(err)
+			}
+			return backend
+		}},
+	}
+	for _, backend := range backends {
+		b.Run(backend.name, func(b *testing.B) {
+			processor := newFakeProcessor(b)
+			cfg := testPoolConfig(8)
+			cfg.QueueSize = 4096
+			paymentProcessor := NewPaymentProcessor(testProcessorConfig(processor, newFakeProcessor(b)), store.NewMemoryStore(store.MemoryOptions{}))
+			pool := NewWorkerPool(paymentProcessor, backend.open(b, cfg.QueueSize), cfg)
+			pool.Start()
+			b.Cleanup(pool.Stop)
+
+			b.ResetTimer()
+			for i := range b.N {
+				for pool.Submit(context.Background(), newTestPayment(i)) != nil {
+					runtime.Gosched()
+				}
+			}
+			for processor.calls.Load() < int64(b.N) {
+				time.Sleep(100 * time.Microsecond)
+			}
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "payments/s")
+		})
+	}
+}
+
+func TestSubmitDuringStop(t *testing.T) {
+	for round := range 20 {
+		processor := newFakeProcessor(t)
+		cfg := testPoolConfig(4)
+		cfg.QueueSize = 64 // pequena, para parte dos Submit achar a fila cheia
+		pool := newTestPool(t, testProcessorConfig(processor, newFakeProcessor(t)), cfg)
+
+		closed := func() bool {
+			pool.submitMu.RLock()
+			defer pool.submitMu.RUnlock()
+			return pool.closed
+		}
+
+		// 50 goroutines submetem sem parar enquanto o Stop roda; nenhuma pode
+		// entrar em pânico e, com o Stop concluído, todas são recusadas
+		const submitters = 50
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		for g := range submitters {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				for i := 0; ; i++ {
+					if pool.Submit(context.Background(), newTestPayment(round*1_000_000+g*10_000+i)) != nil && closed() {
+						return
+					}
+				}
+			}()
+		}
+		close(start)
+		time.Sleep(time.Millisecond)
+
+		// Stop repetido, inclusive em paralelo, não faz nada
+		var stops sync.WaitGroup
+		for range 3 {
+			stops.Add(1)
+			go func() {
+				defer stops.Done()
+				pool.Stop()
+			}()
+		}
+		stops.Wait()
+		wg.Wait()
+
+		if pool.Submit(context.Background(), newTestPayment(-1)) == nil {
+			t.Fatal("Submit accepted a payment after Stop")
+		}
+		pool.Stop()
+	}
+}
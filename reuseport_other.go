@@ -0,0 +1,14 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+)
+
+// reusePortControl não é suportado nesta plataforma
+func reusePortControl() (func(network, address string, c syscall.RawConn) error, error) {
+	return nil, fmt.Errorf("REUSE_PORT: SO_REUSEPORT is not supported on %s", runtime.GOOS)
+}
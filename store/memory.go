@@ -0,0 +1,325 @@
+package store
+
+import (
+	"container/heap"
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// DefaultCapacity é o número máximo de payments mantidos em memória
+const DefaultCapacity = 200000
+
+// listChunk são os registros que o List lê a cada vez que pega o lock; entre
+// um trecho e outro o Save dos workers não espera
+const listChunk = 4096
+
+// Payment representa um payment processado com sucesso
+type Payment struct {
+	CorrelationID string    `json:"correlationId"`
+	Amount        int64     `json:"amount"`             // em centavos
+	Currency      string    `json:"currency,omitempty"` // vazio em registros anteriores ao campo: moeda padrão
+	Type          string    `json:"type,omitempty"`     // vazio em registros anteriores ao campo
+	Processor     string    `json:"processor"`
+	RequestedAt   time.Time `json:"requestedAt"`
+	ProcessedAt   time.Time `json:"processedAt"`
+
+	Metadata map[string]string `json:"metadata,omitempty"` // enviado pelo cliente no payment
+	Receipt  *Receipt          `json:"receipt,omitempty"`  // devolvido pelo processador; nil sem comprovante
+}
+
+// Receipt é o comprovante que o processador devolveu ao aceitar o payment
+type Receipt struct {
+	ID  string     `json:"id,omitempty"`  // identificador atribuído pelo processador
+	At  *time.Time `json:"at,omitempty"`  // instante informado pelo processador, se houver
+	Raw string     `json:"raw,omitempty"` // corpo da resposta, truncado; só na visão de debug
+}
+
+// ProcessorTotals representa o agregado de um processador
+type ProcessorTotals struct {
+	TotalRequests int64            `json:"totalRequests"`
+	TotalAmount   int64            `json:"totalAmount"`          // na moeda padrão
+	Currencies    map[string]int64 `json:"currencies,omitempty"` // soma nas demais moedas
+}
+
+// add soma um payment ao agregado, separando as moedas
+func (t *ProcessorTotals) add(currency string, amount int64) {
+	if currency == "" || currency == types.DefaultCurrency() {
+		t.TotalAmount = types.AddAmount(t.TotalAmount, amount)
+		return
+	}
+	if t.Currencies == nil {
+		t.Currencies = make(map[string]int64)
+	}
+	t.Currencies[currency] = types.AddAmount(t.Currencies[currency], amount)
+}
+
+// merge soma outro agregado a t
+func (t *ProcessorTotals) merge(other ProcessorTotals) {
+	t.TotalRequests += other.TotalRequests
+	t.TotalAmount = types.AddAmount(t.TotalAmount, other.TotalAmount)
+	for currency, amount := range other.Currencies {
+		t.add(currency, amount)
+	}
+}
+
+// DefaultBucketRetention é quanto tempo de agregados por segundo o store em
+// memória mantém
+const DefaultBucketRetention = time.Hour
+
+// MemoryOptions dimensiona o store em memória
+type MemoryOptions struct {
+	Capacity        int           // payments no ring buffer
+	BucketRetention time.Duration // agregados por segundo mantidos, a partir do requestedAt mais recente; 0 desliga
+}
+
+// MemoryStore guarda os payments processados em um ring buffer limitado.
+// Quando a capacidade é atingida o registro mais antigo é descartado. Ao
+// lado dele fica o agregado de cada segundo de requestedAt, mantido a cada
+// Save por BucketRetention, para os summaries de intervalo não percorrerem
+// os registros (ver memory_buckets.go).
+type MemoryStore struct {
+	mu      sync.RWMutex
+	records []Payment
+	next    int
+	full    bool
+	index   map[string]int // correlationId -> posição no ring buffer
+
+	seconds    map[int64]*secondBucket // segundo unix de requestedAt -> agregado
+	retention  int64                   // segundos de agregado mantidos
+	newest     int64                   // segundo mais recente com agregado
+	horizon    int64                   // primeiro segundo com agregado completo; os anteriores só nos registros
+	unbucketed int                     // registros no ring buffer anteriores ao horizon
+}
+
+// NewMemoryStore cria um store em memória com capacidade fixa
+func NewMemoryStore(opts MemoryOptions) *MemoryStore {
+	if opts.Capacity <= 0 {
+		opts.Capacity = DefaultCapacity
+	}
+	s := &MemoryStore{
+		records:   make([]Payment, opts.Capacity),
+		index:     make(map[string]int, opts.Capacity),
+		seconds:   make(map[int64]*secondBucket),
+		retention: int64(opts.BucketRetention / time.Second),
+		newest:    math.MinInt64,
+		horizon:   math.MinInt64,
+	}
+	if s.retention <= 0 {
+		s.horizon = math.MaxInt64 // sem agregados, tudo vem dos registros
+	}
+	return s
+}
+
+// Save registra um payment processado
+func (s *MemoryStore) Save(p Payment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Reprocessamento do mesmo correlationId atualiza o registro existente
+	if pos, ok := s.index[p.CorrelationID]; ok {
+		s.unbucket(pos, true)
+		s.records[pos] = p
+		s.bucket(pos)
+		return
+	}
+
+	// Ring buffer cheio: descartar o mais antigo, que continua no agregado
+	if s.full {
+		delete(s.index, s.records[s.next].CorrelationID)
+		s.unbucket(s.next, false)
+	}
+
+	s.records[s.next] = p
+	s.index[p.CorrelationID] = s.next
+	s.bucket(s.next)
+
+	s.next++
+	if s.next == len(s.records) {
+		s.next = 0
+		s.full = true
+	}
+}
+
+// Get busca um payment pelo correlationId
+func (s *MemoryStore) Get(ctx context.Context, correlationID string) (Payment, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pos, ok := s.index[correlationID]
+	if !ok {
+		return Payment{}, false, nil
+	}
+	return s.records[pos], true, nil
+}
+
+// Range retorna os payments com requestedAt dentro do intervalo [from, to].
+// Limites zerados são tratados como abertos.
+func (s *MemoryStore) Range(ctx context.Context, from, to time.Time) ([]Payment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]Payment, 0)
+	s.each(func(p *Payment) {
+		if inRange(p.RequestedAt, from, to) {
+			result = append(result, *p)
+		}
+	})
+	return result, nil
+}
+
+// List retorna até limit payments depois de after na listagem. O ring
+// buffer não está em ordem de requestedAt, então cada página percorre todos
+// os registros, guardando os limit mais recentes em um heap; o lock é
+// solto a cada listChunk registros.
+func (s *MemoryStore) List(ctx context.Context, after Cursor, limit int) ([]Payment, error) {
+	if limit <= 0 {
+		return []Payment{}, nil
+	}
+	page := make(listHeap, 0, limit)
+	for start := 0; ; start += listChunk {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		more := s.scan(start, listChunk, func(p *Payment) {
+			switch {
+			case !after.Precedes(*p):
+			case len(page) < limit:
+				heap.Push(&page, *p)
+			case CursorOf(*p).newer(CursorOf(page[0])):
+				page[0] = *p
+				heap.Fix(&page, 0)
+			}
+		})
+		if !more {
+			break
+		}
+	}
+
+	sort.Slice(page, func(i, j int) bool {
+		return CursorOf(page[i]).newer(CursorOf(page[j]))
+	})
+	return page, nil
+}
+
+// scan percorre até n registros a partir de start com o lock de leitura;
+// false se start já passou do fim
+func (s *MemoryStore) scan(start, n int, fn func(p *Payment)) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := s.next
+	if s.full {
+		count = len(s.records)
+	}
+	if start >= count {
+		return false
+	}
+	for i := start; i < min(start+n, count); i++ {
+		fn(&s.records[i])
+	}
+	return true
+}
+
+// listHeap guarda os payments de uma página com o mais antigo no topo,
+// o próximo a sair quando chega um mais recente
+type listHeap []Payment
+
+func (h listHeap) Len() int           { return len(h) }
+func (h listHeap) Less(i, j int) bool { return CursorOf(h[j]).newer(CursorOf(h[i])) }
+func (h listHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *listHeap) Push(x any)        { *h = append(*h, x.(Payment)) }
+func (h *listHeap) Pop() any {
+	old := *h
+	p := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return p
+}
+
+// Aggregate soma quantidade e valor por processador no intervalo [from, to],
+// pelos agregados por segundo; os registros só são filtrados nos segundos
+// das pontas e nos anteriores ao agregado
+func (s *MemoryStore) Aggregate(ctx context.Context, from, to time.Time) (map[string]ProcessorTotals, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	totals := make(map[string]ProcessorTotals, 2)
+	s.sum(from, to, func(_ int64, processor string, t ProcessorTotals) {
+		sum := totals[processor]
+		sum.merge(t)
+		totals[processor] = sum
+	})
+	return totals, nil
+}
+
+// AggregateBuckets soma quantidade e valor por processador em intervalos de
+// step, pelos mesmos agregados por segundo do Aggregate
+func (s *MemoryStore) AggregateBuckets(ctx context.Context, from, to time.Time, step time.Duration) ([]Bucket, error) {
+	start, width := from.Unix(), int64(step/time.Second)
+	if width <= 0 || !to.After(from) {
+		return []Bucket{}, nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	buckets := make(map[int64]map[string]ProcessorTotals)
+	s.sum(from, to.Add(-time.Nanosecond), func(second int64, processor string, t ProcessorTotals) {
+		i := (second - start) / width
+		bucket := buckets[i]
+		if bucket == nil {
+			bucket = make(map[string]ProcessorTotals, 2)
+			buckets[i] = bucket
+		}
+		sum := bucket[processor]
+		sum.merge(t)
+		bucket[processor] = sum
+	})
+
+	result := make([]Bucket, 0, len(buckets))
+	for i, totals := range buckets {
+		result = append(result, Bucket{Start: time.Unix(start+i*width, 0).UTC(), Totals: totals})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Start.Before(result[j].Start)
+	})
+	return result, nil
+}
+
+// Close não faz nada no store em memória
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// Len retorna a quantidade de payments armazenados
+func (s *MemoryStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.index)
+}
+
+// each percorre os registros válidos (chamar com lock adquirido)
+func (s *MemoryStore) each(fn func(p *Payment)) {
+	n := s.next
+	if s.full {
+		n = len(s.records)
+	}
+	for i := 0; i < n; i++ {
+		fn(&s.records[i])
+	}
+}
+
+// inRange verifica se t está em [from, to], ignorando limites zerados
+func inRange(t, from, to time.Time) bool {
+	if !from.IsZero() && t.Before(from) {
+		return false
+	}
+	if !to.IsZero() && t.After(to) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,196 @@
+package store
+
+import (
+	"math"
+	"time"
+)
+
+// secondBucket é o agregado dos payments de um segundo de requestedAt. O
+// agregado inclui os payments já descartados do ring buffer; records só tem
+// os que ainda estão nele, para filtrar os segundos das pontas de um
+// intervalo.
+type secondBucket struct {
+	totals  map[string]ProcessorTotals // por processador
+	records []int32                    // posições no ring buffer
+}
+
+// bucket soma ao agregado do seu segundo o payment na posição pos. Um
+// requestedAt anterior ao horizon fica só nos registros. Um segundo novo
+// além do mais recente descarta os que saíram da retenção. (chamar com lock
+// adquirido)
+func (s *MemoryStore) bucket(pos int) {
+	p := &s.records[pos]
+	second := p.RequestedAt.Unix()
+	if second < s.horizon {
+		s.unbucketed++
+		return
+	}
+
+	b := s.seconds[second]
+	if b == nil {
+		b = &secondBucket{totals: make(map[string]ProcessorTotals, 2)}
+		s.seconds[second] = b
+		if second > s.newest {
+			s.newest = second
+			s.prune(second - s.retention + 1)
+		}
+	}
+	t := b.totals[p.Processor]
+	t.TotalRequests++
+	t.add(p.Currency, p.Amount)
+	b.totals[p.Processor] = t
+	b.records = append(b.records, int32(pos))
+}
+
+// unbucket tira a posição pos do seu segundo; com subtract, tira também o
+// payment do agregado, para a atualização de um registro não contar duas
+// vezes (chamar com lock adquirido)
+func (s *MemoryStore) unbucket(pos int, subtract bool) {
+	p := &s.records[pos]
+	second := p.RequestedAt.Unix()
+	if second < s.horizon {
+		s.unbucketed--
+		return
+	}
+	b := s.seconds[second]
+	if b == nil {
+		return
+	}
+
+	for i, other := range b.records {
+		if other == int32(pos) {
+			last := len(b.records) - 1
+			b.records[i] = b.records[last]
+			b.records = b.records[:last]
+			break
+		}
+	}
+	if !subtract {
+		return
+	}
+
+	t := b.totals[p.Processor]
+	t.TotalRequests--
+	t.add(p.Currency, -p.Amount)
+	if amount, ok := t.Currencies[p.Currency]; ok && amount == 0 {
+		delete(t.Currencies, p.Currency)
+	}
+	if t.TotalRequests > 0 {
+		b.totals[p.Processor] = t
+	} else {
+		delete(b.totals, p.Processor)
+	}
+	if len(b.totals) == 0 {
+		delete(s.seconds, second)
+	}
+}
+
+// prune descarta os agregados anteriores a cutoff, que passa a ser o
+// horizon; os registros deles passam a ser lidos do ring buffer. Os
+// segundos são percorridos um a um, ou o mapa inteiro quando o salto é
+// maior que ele. (chamar com lock adquirido)
+func (s *MemoryStore) prune(cutoff int64) {
+	if cutoff <= s.horizon {
+		return
+	}
+	if uint64(cutoff)-uint64(s.horizon) > uint64(len(s.seconds)) {
+		for second, b := range s.seconds {
+			if second < cutoff {
+				s.unbucketed += len(b.records)
+				delete(s.seconds, second)
+			}
+		}
+	} else {
+		for second := s.horizon; second < cutoff; second++ {
+			if b, ok := s.seconds[second]; ok {
+				s.unbucketed += len(b.records)
+				delete(s.seconds, second)
+			}
+		}
+	}
+	s.horizon = cutoff
+}
+
+// sum passa a add os payments com requestedAt em [from, to], com limites
+// zerados abertos. Dos segundos inteiros a partir do horizon vai o
+// agregado do segundo; dos segundos das pontas, cada registro que ainda
+// está no ring buffer e cai no intervalo; dos anteriores ao horizon, os
+// registros, percorrendo o ring buffer inteiro, se houver algum. (chamar
+// com lock adquirido)
+func (s *MemoryStore) sum(from, to time.Time, add func(second int64, processor string, t ProcessorTotals)) {
+	first, last := int64(math.MinInt64), int64(math.MaxInt64)
+	if !from.IsZero() {
+		first = from.Unix()
+	}
+	if !to.IsZero() {
+		last = to.Unix()
+	}
+	if first > last {
+		return
+	}
+	addRecord := func(p *Payment) {
+		t := ProcessorTotals{TotalRequests: 1}
+		t.add(p.Currency, p.Amount)
+		add(p.RequestedAt.Unix(), p.Processor, t)
+	}
+
+	if first < s.horizon {
+		if s.unbucketed > 0 {
+			end := to
+			if last >= s.horizon && s.retention > 0 {
+				end = time.Unix(s.horizon, 0).Add(-time.Nanosecond)
+			}
+			s.each(func(p *Payment) {
+				if inRange(p.RequestedAt, from, end) {
+					addRecord(p)
+				}
+			})
+		}
+		if last < s.horizon || s.retention <= 0 {
+			return
+		}
+		first = s.horizon
+	} else if from.Nanosecond() != 0 {
+		s.edge(first, from, to, addRecord)
+		first++
+	}
+	if last >= first && !to.IsZero() && to.Nanosecond() != int(time.Second-1) {
+		s.edge(last, from, to, addRecord)
+		last--
+	}
+	if first > last {
+		return
+	}
+
+	addSecond := func(second int64, b *secondBucket) {
+		for processor, t := range b.totals {
+			add(second, processor, t)
+		}
+	}
+	if uint64(last)-uint64(first) < uint64(len(s.seconds)) {
+		for second := first; second <= last; second++ {
+			if b, ok := s.seconds[second]; ok {
+				addSecond(second, b)
+			}
+		}
+		return
+	}
+	for second, b := range s.seconds {
+		if second >= first && second <= last {
+			addSecond(second, b)
+		}
+	}
+}
+
+// edge passa a add os registros do segundo que caem em [from, to]
+func (s *MemoryStore) edge(second int64, from, to time.Time, add func(p *Payment)) {
+	b := s.seconds[second]
+	if b == nil {
+		return
+	}
+	for _, pos := range b.records {
+		if p := &s.records[pos]; inRange(p.RequestedAt, from, to) {
+			add(p)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// benchmarkRecords é o tamanho do store no BenchmarkAggregate
+const benchmarkRecords = 1_000_000
+
+// filledStore cria um store com n payments espalhados pela última hora,
+// alternando processador e moeda, e retorna o intervalo deles
+func filledStore(n int, retention time.Duration) (*MemoryStore, time.Time, time.Time) {
+	s := NewMemoryStore(MemoryOptions{Capacity: n, BucketRetention: retention})
+	start := time.Date(2025, 7, 9, 12, 0, 0, 0, time.UTC)
+	step := time.Hour / time.Duration(n)
+	for i := range n {
+		processor, currency := "default", ""
+		if i%3 == 0 {
+			processor = "fallback"
+		}
+		if i%10 == 0 {
+			currency = "USD"
+		}
+		s.Save(Payment{
+			CorrelationID: fmt.Sprintf("%036d", i),
+			Amount:        int64(100 + i%1000),
+			Currency:      currency,
+			Processor:     processor,
+			RequestedAt:   start.Add(time.Duration(i) * step),
+			ProcessedAt:   start.Add(time.Duration(i) * step),
+		})
+	}
+	return s, start, start.Add(time.Hour)
+}
+
+// BenchmarkAggregate compara o Aggregate com 1M registros percorrendo o ring
+// buffer inteiro (agregados por segundo desligados) e pelos agregados por
+// segundo, nas consultas do summary: o intervalo todo, sem limites, e um
+// intervalo com frações de segundo nas pontas
+func BenchmarkAggregate(b *testing.B) {
+	ctx := context.Background()
+	scan, start, end := filledStore(benchmarkRecords, 0)
+	buckets, _, _ := filledStore(benchmarkRecords, DefaultBucketRetention)
+
+	ranges := []struct {
+		name     string
+		from, to time.Time
+	}{
+		{"unbounded", time.Time{}, time.Time{}},
+		{"full hour", start, end},
+		{"partial seconds", start.Add(10*time.Minute + 250*time.Millisecond), end.Add(-10*time.Minute - 750*time.Millisecond)},
+	}
+	for _, r := range ranges {
+		// Os dois caminhos têm que chegar ao mesmo total antes de serem comparados
+		want, _ := scan.Aggregate(ctx, r.from, r.to)
+		if got, _ := buckets.Aggregate(ctx, r.from, r.to); !reflect.DeepEqual(got, want) {
+			b.Fatalf("%s: bucketed aggregate %v, full scan %v", r.name, got, want)
+		}
+
+		for _, s := range []struct {
+			name  string
+			store *MemoryStore
+		}{{"scan", scan}, {"buckets", buckets}} {
+			b.Run(r.name+"/"+s.name, func(b *testing.B) {
+				b.ReportAllocs()
+				for range b.N {
+					s.store.Aggregate(ctx, r.from, r.to)
+				}
+			})
+		}
+	}
+}
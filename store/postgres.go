@@ -0,0 +1,445 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const createPaymentsTable = `
+CREATE TABLE IF NOT EXISTS payments (
+	correlation_id TEXT PRIMARY KEY,
+	amount_cents   BIGINT NOT NULL,
+	processor      TEXT NOT NULL,
+	requested_at   TIMESTAMPTZ NOT NULL,
+	processed_at   TIMESTAMPTZ NOT NULL
+);
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS currency TEXT;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS metadata JSONB;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS payment_type TEXT;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS receipt JSONB;
+CREATE INDEX IF NOT EXISTS payments_requested_at_idx ON payments (requested_at);`
+
+const insertPayments = `
+INSERT INTO payments (correlation_id, amount_cents, processor, requested_at, processed_at, currency, metadata, payment_type, receipt)
+SELECT id, amount, processor, requested_at, processed_at, currency, NULLIF(metadata, '')::jsonb, NULLIF(payment_type, ''), NULLIF(receipt, '')::jsonb
+FROM unnest($1::text[], $2::bigint[], $3::text[], $4::timestamptz[], $5::timestamptz[], $6::text[], $7::text[], $8::text[], $9::text[])
+	AS t(id, amount, processor, requested_at, processed_at, currency, metadata, payment_type, receipt)
+ON CONFLICT (correlation_id) DO NOTHING`
+
+const selectPayments = `
+SELECT correlation_id, amount_cents, processor, requested_at, processed_at, COALESCE(currency, ''), COALESCE(metadata::text, ''), COALESCE(payment_type, ''), COALESCE(receipt::text, '') FROM payments`
+
+const rangeFilter = `
+WHERE ($1::timestamptz IS NULL OR requested_at >= $1)
+  AND ($2::timestamptz IS NULL OR requested_at <= $2)`
+
+// listFilter é a página seguinte ao cursor, na ordem do índice de
+// requested_at; sem cursor, $1 é NULL e a listagem começa do topo
+const listFilter = `
+WHERE $1::timestamptz IS NULL OR (requested_at, correlation_id) < ($1, $2)
+ORDER BY requested_at DESC, correlation_id DESC
+LIMIT $3`
+
+// bucketQuery agrega [$1, $2) em intervalos de $3 segundos, em ordem
+const bucketQuery = `
+SELECT floor(extract(epoch FROM requested_at - $1::timestamptz) / $3::double precision)::bigint AS bucket,
+       processor, COALESCE(currency, ''), COUNT(*), COALESCE(SUM(amount_cents), 0)
+FROM payments
+WHERE requested_at >= $1 AND requested_at < $2
+GROUP BY bucket, processor, currency
+ORDER BY bucket`
+
+// PostgresOptions configura o pool de conexões e o buffer de escrita
+type PostgresOptions struct {
+	MaxConns        int32
+	MinConns        int32
+	MaxConnLifetime time.Duration
+	MaxConnIdleTime time.Duration
+	BufferSize      int // payments aguardando escrita antes de descartar
+	BatchSize       int // payments por INSERT
+}
+
+// PostgresStore persiste os payments no Postgres. As escritas são
+// bufferizadas (write-behind) e enviadas em lote por uma goroutine, então o
+// serviço continua aceitando payments mesmo com o banco fora do ar no boot.
+type PostgresStore struct {
+	pool      *pgxpool.Pool
+	batchSize int
+	pending   chan Payment
+	flushReq  chan chan error
+	cancel    context.CancelFunc
+	done      chan struct{}
+
+	schemaReady bool      // acessado apenas pela goroutine de escrita
+	retryAt     time.Time // próxima tentativa após falha (goroutine de escrita)
+	dropped     int64     // payments descartados com o buffer cheio
+}
+
+// NewPostgresStore cria o store; a conexão é estabelecida sob demanda
+func NewPostgresStore(databaseURL string, opts PostgresOptions) (*PostgresStore, error) {
+	cfg, err := pgxpool.ParseConfig(databaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxConns > 0 {
+		cfg.MaxConns = opts.MaxConns
+	}
+	if opts.MinConns > 0 {
+		cfg.MinConns = opts.MinConns
+	}
+	if opts.MaxConnLifetime > 0 {
+		cfg.MaxConnLifetime = opts.MaxConnLifetime
+	}
+	if opts.MaxConnIdleTime > 0 {
+		cfg.MaxConnIdleTime = opts.MaxConnIdleTime
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 50000
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &PostgresStore{
+		pool:      pool,
+		batchSize: opts.BatchSize,
+		pending:   make(chan Payment, opts.BufferSize),
+		flushReq:  make(chan chan error),
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	go s.writer(ctx)
+	return s, nil
+}
+
+// Save bufferiza o payment para escrita em lote, sem bloquear o worker
+func (s *PostgresStore) Save(p Payment) {
+	select {
+	case s.pending <- p:
+	default:
+		if n := atomic.AddInt64(&s.dropped, 1); n == 1 || n%1000 == 0 {
+			slog.Warn("postgres buffer full, dropping payments", "dropped", n)
+		}
+	}
+}
+
+// Get busca um payment pelo correlationId
+func (s *PostgresStore) Get(ctx context.Context, correlationID string) (Payment, bool, error) {
+	row := s.pool.QueryRow(ctx, selectPayments+` WHERE correlation_id = $1`, correlationID)
+
+	p, err := scanPayment(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Payment{}, false, nil
+	}
+	if err != nil {
+		return Payment{}, false, err
+	}
+	return p, true, nil
+}
+
+// Range retorna os payments com requestedAt em [from, to]
+func (s *PostgresStore) Range(ctx context.Context, from, to time.Time) ([]Payment, error) {
+	if err := s.Flush(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.pool.Query(ctx, selectPayments+rangeFilter+` ORDER BY requested_at`,
+		nullableTime(from), nullableTime(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]Payment, 0)
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, p)
+	}
+	return result, rows.Err()
+}
+
+// List retorna a página seguinte a after, do mais recente ao mais antigo
+func (s *PostgresStore) List(ctx context.Context, after Cursor, limit int) ([]Payment, error) {
+	if err := s.Flush(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.pool.Query(ctx, selectPayments+listFilter,
+		nullableTime(after.RequestedAt), after.CorrelationID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]Payment, 0, limit)
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, p)
+	}
+	return result, rows.Err()
+}
+
+// scanPayment lê uma linha do selectPayments
+func scanPayment(row pgx.Row) (Payment, error) {
+	var p Payment
+	var metadata, receipt string
+	if err := row.Scan(&p.CorrelationID, &p.Amount, &p.Processor, &p.RequestedAt, &p.ProcessedAt, &p.Currency, &metadata, &p.Type, &receipt); err != nil {
+		return Payment{}, err
+	}
+	if metadata != "" {
+		if err := json.Unmarshal([]byte(metadata), &p.Metadata); err != nil {
+			return Payment{}, err
+		}
+	}
+	if receipt != "" {
+		p.Receipt = new(Receipt)
+		if err := json.Unmarshal([]byte(receipt), p.Receipt); err != nil {
+			return Payment{}, err
+		}
+	}
+	return p, nil
+}
+
+// Aggregate executa o agregado por processador e moeda em uma única query.
+// Linhas sem moeda, gravadas antes da coluna existir, são da moeda padrão.
+func (s *PostgresStore) Aggregate(ctx context.Context, from, to time.Time) (map[string]ProcessorTotals, error) {
+	if err := s.Flush(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.pool.Query(ctx,
+		`SELECT processor, COALESCE(currency, ''), COUNT(*), COALESCE(SUM(amount_cents), 0) FROM payments`+rangeFilter+` GROUP BY processor, currency`,
+		nullableTime(from), nullableTime(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := make(map[string]ProcessorTotals, 2)
+	for rows.Next() {
+		var processor, currency string
+		var count, amount int64
+		if err := rows.Scan(&processor, &currency, &count, &amount); err != nil {
+			return nil, err
+		}
+		t := totals[processor]
+		t.TotalRequests += count
+		t.add(currency, amount)
+		totals[processor] = t
+	}
+	return totals, rows.Err()
+}
+
+// AggregateBuckets agrupa por intervalo, processador e moeda em uma única
+// query, pelo índice de requested_at; o intervalo é o número de steps desde
+// from
+func (s *PostgresStore) AggregateBuckets(ctx context.Context, from, to time.Time, step time.Duration) ([]Bucket, error) {
+	if err := s.Flush(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.pool.Query(ctx, bucketQuery, from, to, step.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]Bucket, 0)
+	for rows.Next() {
+		var i, count, amount int64
+		var processor, currency string
+		if err := rows.Scan(&i, &processor, &currency, &count, &amount); err != nil {
+			return nil, err
+		}
+		start := from.Add(time.Duration(i) * step).UTC()
+		if len(result) == 0 || !result[len(result)-1].Start.Equal(start) {
+			result = append(result, Bucket{Start: start, Totals: make(map[string]ProcessorTotals, 2)})
+		}
+		totals := result[len(result)-1].Totals
+		t := totals[processor]
+		t.TotalRequests += count
+		t.add(currency, amount)
+		totals[processor] = t
+	}
+	return result, rows.Err()
+}
+
+// Flush força a escrita dos payments bufferizados até o momento
+func (s *PostgresStore) Flush(ctx context.Context) error {
+	reply := make(chan error, 1)
+	select {
+	case s.flushReq <- reply:
+	case <-s.done:
+		return errors.New("postgres store closed")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-reply:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close envia os payments pendentes e fecha o pool
+func (s *PostgresStore) Close() error {
+	s.cancel()
+	<-s.done
+	s.pool.Close()
+	return nil
+}
+
+// writer acumula os payments e os grava em lote
+func (s *PostgresStore) writer(ctx context.Context) {
+	defer close(s.done)
+
+	batch := make([]Payment, 0, s.batchSize)
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		// Com o lote cheio e o banco indisponível, parar de consumir o
+		// buffer: o Save passa a descartar em vez de crescer sem limite
+		pending := s.pending
+		if len(batch) >= s.batchSize {
+			pending = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			batch = s.drain(batch)
+			writeCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			if err := s.writeBatch(writeCtx, batch); err != nil {
+				slog.Error("postgres payments lost on shutdown", "count", len(batch)+len(s.pending), "error", err)
+			}
+			cancel()
+			return
+
+		case p := <-pending:
+			batch = append(batch, p)
+			if len(batch) >= s.batchSize && !time.Now().Before(s.retryAt) {
+				batch = s.write(ctx, batch)
+			}
+
+		case <-ticker.C:
+			if !time.Now().Before(s.retryAt) {
+				batch = s.write(ctx, batch)
+			}
+
+		case reply := <-s.flushReq:
+			batch = s.drain(batch)
+			err := s.writeBatch(ctx, batch)
+			if err == nil {
+				batch = batch[:0]
+			}
+			reply <- err
+		}
+	}
+}
+
+// write grava o lote, mantendo-o para nova tentativa em caso de erro
+func (s *PostgresStore) write(ctx context.Context, batch []Payment) []Payment {
+	writeCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	if err := s.writeBatch(writeCtx, batch); err != nil {
+		s.retryAt = time.Now().Add(time.Second)
+		return batch
+	}
+	return batch[:0]
+}
+
+// drain move para o lote tudo que já está no buffer
+func (s *PostgresStore) drain(batch []Payment) []Payment {
+	for {
+		select {
+		case p := <-s.pending:
+			batch = append(batch, p)
+		default:
+			return batch
+		}
+	}
+}
+
+// writeBatch grava o lote com um único INSERT usando unnest
+func (s *PostgresStore) writeBatch(ctx context.Context, batch []Payment) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	if !s.schemaReady {
+		if _, err := s.pool.Exec(ctx, createPaymentsTable); err != nil {
+			slog.Warn("postgres unavailable, keeping payments buffered", "buffered", len(batch), "error", err)
+			return err
+		}
+		s.schemaReady = true
+	}
+
+	ids := make([]string, len(batch))
+	amounts := make([]int64, len(batch))
+	processors := make([]string, len(batch))
+	requestedAt := make([]time.Time, len(batch))
+	processedAt := make([]time.Time, len(batch))
+	currencies := make([]string, len(batch))
+	metadata := make([]string, len(batch))
+	paymentTypes := make([]string, len(batch))
+	receipts := make([]string, len(batch))
+	for i, p := range batch {
+		ids[i] = p.CorrelationID
+		amounts[i] = p.Amount
+		processors[i] = p.Processor
+		requestedAt[i] = p.RequestedAt
+		processedAt[i] = p.ProcessedAt
+		currencies[i] = p.Currency
+		paymentTypes[i] = p.Type
+		if len(p.Metadata) > 0 {
+			encoded, err := json.Marshal(p.Metadata)
+			if err != nil {
+				return err
+			}
+			metadata[i] = string(encoded)
+		}
+		if p.Receipt != nil {
+			encoded, err := json.Marshal(p.Receipt)
+			if err != nil {
+				return err
+			}
+			receipts[i] = string(encoded)
+		}
+	}
+
+	if _, err := s.pool.Exec(ctx, insertPayments, ids, amounts, processors, requestedAt, processedAt, currencies, metadata, paymentTypes, receipts); err != nil {
+		slog.Warn("postgres batch insert failed", "batch_size", len(batch), "error", err)
+		return err
+	}
+	return nil
+}
+
+// nullableTime converte limites zerados em NULL para a query
+func nullableTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
@@ -0,0 +1,309 @@
+package store
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/yurimachados/rinha-backend-go/types"
+)
+
+// sharedSummaryKey é o hash no Redis com os contadores compartilhados
+const sharedSummaryKey = "rinha:summary"
+
+// flushInterval define a frequência de envio dos deltas para o Redis
+const flushInterval = 10 * time.Millisecond
+
+// SharedSummary mantém os contadores do summary no Redis para que várias
+// instâncias atrás do nginx reportem os mesmos totais. O hot path apenas
+// acumula deltas atômicos; uma goroutine envia os deltas em pipeline.
+type SharedSummary struct {
+	client  *redis.Client
+	flushMu sync.Mutex
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	// Deltas pendentes de envio
+	totalPayments   int64
+	defaultSuccess  int64
+	fallbackSuccess int64
+	totalErrors     int64
+	totalExpired    int64
+	defaultAmount   int64
+	fallbackAmount  int64
+	expiredAmount   int64
+
+	// Deltas das somas nas demais moedas, por campo do hash
+	// ("default_amount:USD"); fora do hot path da moeda padrão
+	currencyMu     sync.Mutex
+	currencyDeltas map[string]int64
+
+	degraded int32 // 1 quando o último acesso ao Redis falhou
+}
+
+// NewSharedSummary cria o summary compartilhado a partir de uma REDIS_URL
+func NewSharedSummary(redisURL string) (*SharedSummary, error) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, err
+	}
+	opts.DialTimeout = 200 * time.Millisecond
+	opts.ReadTimeout = 200 * time.Millisecond
+	opts.WriteTimeout = 200 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &SharedSummary{
+		client: redis.NewClient(opts),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go s.flushLoop(ctx)
+	return s, nil
+}
+
+// IncTotal contabiliza um payment recebido para processamento
+func (s *SharedSummary) IncTotal() {
+	atomic.AddInt64(&s.totalPayments, 1)
+}
+
+// IncSuccess contabiliza um payment processado com sucesso
+func (s *SharedSummary) IncSuccess(processor, currency string, amount int64) {
+	other := isOtherCurrency(currency)
+	switch processor {
+	case "default":
+		atomic.AddInt64(&s.defaultSuccess, 1)
+		if other {
+			s.addCurrency("default_amount", currency, amount)
+		} else {
+			types.AddAmountAtomic(&s.defaultAmount, amount)
+		}
+	case "fallback":
+		atomic.AddInt64(&s.fallbackSuccess, 1)
+		if other {
+			s.addCurrency("fallback_amount", currency, amount)
+		} else {
+			types.AddAmountAtomic(&s.fallbackAmount, amount)
+		}
+	}
+}
+
+// IncError contabiliza um payment que falhou em todos os processadores
+func (s *SharedSummary) IncError() {
+	atomic.AddInt64(&s.totalErrors, 1)
+}
+
+// IncExpired contabiliza um payment descartado na fila por idade
+func (s *SharedSummary) IncExpired(currency string, amount int64) {
+	atomic.AddInt64(&s.totalExpired, 1)
+	if isOtherCurrency(currency) {
+		s.addCurrency("expired_amount", currency, amount)
+	} else {
+		types.AddAmountAtomic(&s.expiredAmount, amount)
+	}
+}
+
+// addCurrency acumula o delta de uma soma em moeda que não a padrão
+func (s *SharedSummary) addCurrency(field, currency string, amount int64) {
+	s.currencyMu.Lock()
+	defer s.currencyMu.Unlock()
+
+	if s.currencyDeltas == nil {
+		s.currencyDeltas = make(map[string]int64)
+	}
+	key := field + ":" + currency
+	s.currencyDeltas[key] = types.AddAmount(s.currencyDeltas[key], amount)
+}
+
+// isOtherCurrency indica se o payment soma fora dos totais na moeda padrão
+func isOtherCurrency(currency string) bool {
+	return currency != "" && currency != types.DefaultCurrency()
+}
+
+// Summary envia os deltas pendentes e lê os totais agregados no Redis,
+// garantindo que tudo registrado antes da leitura esteja incluído
+func (s *SharedSummary) Summary(ctx context.Context) (*types.PaymentSummary, error) {
+	if err := s.flush(ctx); err != nil {
+		return nil, err
+	}
+
+	values, err := s.client.HGetAll(ctx, sharedSummaryKey).Result()
+	if err != nil {
+		s.setDegraded(err)
+		return nil, err
+	}
+	s.setDegraded(nil)
+
+	summary := &types.PaymentSummary{
+		TotalPayments:   parseCounter(values["total_payments"]),
+		DefaultSuccess:  parseCounter(values["default_success"]),
+		FallbackSuccess: parseCounter(values["fallback_success"]),
+		TotalErrors:     parseCounter(values["total_errors"]),
+		TotalExpired:    parseCounter(values["total_expired"]),
+		DefaultAmount:   parseCounter(values["default_amount"]),
+		FallbackAmount:  parseCounter(values["fallback_amount"]),
+		ExpiredAmount:   parseCounter(values["expired_amount"]),
+	}
+	for field, value := range values {
+		name, currency, ok := strings.Cut(field, ":")
+		if !ok {
+			continue
+		}
+		var amounts types.CurrencyAmounts
+		switch name {
+		case "default_amount":
+			amounts.DefaultAmount = parseCounter(value)
+		case "fallback_amount":
+			amounts.FallbackAmount = parseCounter(value)
+		case "expired_amount":
+			amounts.ExpiredAmount = parseCounter(value)
+		default:
+			continue
+		}
+		summary.AddCurrencies(map[string]types.CurrencyAmounts{currency: amounts})
+	}
+	return summary, nil
+}
+
+// Close envia os deltas restantes e encerra a conexão com o Redis
+func (s *SharedSummary) Close() error {
+	s.cancel()
+	<-s.done
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.flush(ctx); err != nil {
+		slog.Error("redis summary deltas lost on shutdown", "error", err)
+	}
+	return s.client.Close()
+}
+
+// flushLoop envia os deltas periodicamente
+func (s *SharedSummary) flushLoop(ctx context.Context) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			flushCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+			s.flush(flushCtx)
+			cancel()
+		}
+	}
+}
+
+// flush envia os deltas acumulados em um único pipeline. Em caso de erro os
+// deltas são devolvidos para a próxima tentativa.
+func (s *SharedSummary) flush(ctx context.Context) error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	deltas := map[string]*int64{
+		"total_payments":   &s.totalPayments,
+		"default_success":  &s.defaultSuccess,
+		"fallback_success": &s.fallbackSuccess,
+		"total_errors":     &s.totalErrors,
+		"total_expired":    &s.totalExpired,
+		"default_amount":   &s.defaultAmount,
+		"fallback_amount":  &s.fallbackAmount,
+		"expired_amount":   &s.expiredAmount,
+	}
+
+	taken := make(map[string]int64, len(deltas))
+	for field, counter := range deltas {
+		if v := atomic.SwapInt64(counter, 0); v != 0 {
+			taken[field] = v
+		}
+	}
+	s.currencyMu.Lock()
+	currencyTaken := s.currencyDeltas
+	s.currencyDeltas = nil
+	s.currencyMu.Unlock()
+	for field, v := range currencyTaken {
+		taken[field] = v
+	}
+	if len(taken) == 0 {
+		return nil
+	}
+
+	pipe := s.client.Pipeline()
+	cmds := make(map[string]*redis.IntCmd, len(taken))
+	for field, v := range taken {
+		cmds[field] = pipe.HIncrBy(ctx, sharedSummaryKey, field, v)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		// Cada comando do pipeline tem o próprio resultado: só os deltas que
+		// não foram aplicados voltam para a próxima tentativa
+		var failed error
+		for field, cmd := range cmds {
+			switch cmdErr := cmd.Err(); {
+			case cmdErr == nil:
+			case strings.Contains(cmdErr.Error(), "overflow"):
+				s.saturate(ctx, field, taken[field])
+			default:
+				s.restore(deltas, field, taken[field])
+				failed = cmdErr
+			}
+		}
+		if failed != nil {
+			s.setDegraded(failed)
+			return failed
+		}
+	}
+
+	s.setDegraded(nil)
+	return nil
+}
+
+// restore devolve um delta não enviado para não perder contagens
+func (s *SharedSummary) restore(deltas map[string]*int64, field string, v int64) {
+	if counter, ok := deltas[field]; ok {
+		atomic.AddInt64(counter, v)
+		return
+	}
+	name, currency, _ := strings.Cut(field, ":")
+	s.addCurrency(name, currency, v)
+}
+
+// saturate fixa no limite do int64 um campo que o HINCRBY recusou por
+// estouro, em vez de deixá-lo parado no último valor
+func (s *SharedSummary) saturate(ctx context.Context, field string, delta int64) {
+	limit := int64(math.MaxInt64)
+	if delta < 0 {
+		limit = math.MinInt64
+	}
+	slog.Error("redis summary counter overflow, saturating", "field", field, "delta", delta)
+	if err := s.client.HSet(ctx, sharedSummaryKey, field, limit).Err(); err != nil {
+		s.setDegraded(err)
+	}
+}
+
+// setDegraded loga apenas as transições entre Redis disponível e indisponível
+func (s *SharedSummary) setDegraded(err error) {
+	if err != nil {
+		if atomic.CompareAndSwapInt32(&s.degraded, 0, 1) {
+			slog.Warn("redis unavailable, using local counters", "error", err)
+		}
+		return
+	}
+	if atomic.CompareAndSwapInt32(&s.degraded, 1, 0) {
+		slog.Info("redis available again")
+	}
+}
+
+// parseCounter converte um campo do hash, tratando ausência como zero
+func parseCounter(value string) int64 {
+	n, _ := strconv.ParseInt(value, 10, 64)
+	return n
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// Store define o armazenamento dos payments processados com sucesso
+type Store interface {
+	// Save registra um payment; implementações podem bufferizar a escrita
+	Save(p Payment)
+	// Get busca um payment pelo correlationId
+	Get(ctx context.Context, correlationID string) (Payment, bool, error)
+	// Range retorna os payments com requestedAt em [from, to]
+	Range(ctx context.Context, from, to time.Time) ([]Payment, error)
+	// List retorna até limit payments anteriores a after na ordem do
+	// Cursor, do mais recente ao mais antigo; after zerado começa do topo
+	List(ctx context.Context, after Cursor, limit int) ([]Payment, error)
+	// Aggregate soma quantidade e valor por processador em [from, to]
+	Aggregate(ctx context.Context, from, to time.Time) (map[string]ProcessorTotals, error)
+	// AggregateBuckets soma quantidade e valor por processador em intervalos
+	// de step a partir de from, com requestedAt em [from, to); retorna só os
+	// intervalos com payments, em ordem. from, to e step são em
+	// segundos inteiros.
+	AggregateBuckets(ctx context.Context, from, to time.Time, step time.Duration) ([]Bucket, error)
+	// Close libera os recursos, enviando escritas pendentes
+	Close() error
+}
+
+// Bucket é o agregado de um intervalo do AggregateBuckets
+type Bucket struct {
+	Start  time.Time
+	Totals map[string]ProcessorTotals // por processador
+}
+
+// Cursor é a posição de um payment na listagem: requestedAt e, no empate,
+// correlationId, ambos decrescentes. A posição não depende de quando o
+// payment foi salvo, então as páginas seguintes nunca repetem registros;
+// um payment salvo durante a listagem só aparece se ainda não foi passado.
+type Cursor struct {
+	RequestedAt   time.Time
+	CorrelationID string
+}
+
+// CursorOf retorna a posição de p na listagem
+func CursorOf(p Payment) Cursor {
+	return Cursor{RequestedAt: p.RequestedAt, CorrelationID: p.CorrelationID}
+}
+
+// IsZero indica o início da listagem
+func (c Cursor) IsZero() bool {
+	return c.RequestedAt.IsZero() && c.CorrelationID == ""
+}
+
+// Precedes indica se c vem antes de p na listagem: p é mais antigo
+func (c Cursor) Precedes(p Payment) bool {
+	return c.IsZero() || c.newer(CursorOf(p))
+}
+
+// newer indica se c vem antes de other na listagem
+func (c Cursor) newer(other Cursor) bool {
+	if !c.RequestedAt.Equal(other.RequestedAt) {
+		return c.RequestedAt.After(other.RequestedAt)
+	}
+	return c.CorrelationID > other.CorrelationID
+}
@@ -0,0 +1,98 @@
+// Package tracing configura o OpenTelemetry de forma opcional. Sem
+// OTEL_EXPORTER_OTLP_ENDPOINT nada é instalado e Enabled() retorna false,
+// permitindo que os pontos de instrumentação pulem todo o trabalho.
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/yurimachados/rinha-backend-go"
+
+var (
+	enabled    atomic.Bool
+	propagator = propagation.TraceContext{}
+)
+
+// Setup instala o exporter OTLP se OTEL_EXPORTER_OTLP_ENDPOINT estiver
+// definida. O shutdown retornado envia os spans pendentes.
+func Setup(ctx context.Context, serviceName string) (func(context.Context) error, error) {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	// O exporter lê endpoint, headers e protocolo das variáveis OTEL_*
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+	enabled.Store(true)
+
+	return provider.Shutdown, nil
+}
+
+// Enabled informa se o tracing está ativo
+func Enabled() bool {
+	return enabled.Load()
+}
+
+// Tracer retorna o tracer do serviço
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Extract lê o traceparent de uma requisição recebida
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return propagator.Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// Inject escreve o traceparent em uma requisição de saída
+func Inject(ctx context.Context, header http.Header) {
+	propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// FormatTraceParent serializa um SpanContext no formato W3C traceparent,
+// usado para carregar o contexto por filas externas como o Redis
+func FormatTraceParent(sc trace.SpanContext) string {
+	if !sc.IsValid() {
+		return ""
+	}
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(trace.ContextWithSpanContext(context.Background(), sc), carrier)
+	return carrier.Get("traceparent")
+}
+
+// ParseTraceParent reconstrói o SpanContext de um traceparent W3C
+func ParseTraceParent(traceParent string) trace.SpanContext {
+	if traceParent == "" {
+		return trace.SpanContext{}
+	}
+	carrier := propagation.MapCarrier{"traceparent": traceParent}
+	return trace.SpanContextFromContext(propagator.Extract(context.Background(), carrier))
+}
@@ -0,0 +1,75 @@
+package types
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"sync/atomic"
+
+	"github.com/yurimachados/rinha-backend-go/logging"
+)
+
+// DefaultMaxAmount é o maior amount aceito sem configuração, em centavos
+// (R$ 10 milhões). Com ele as somas do summary levam bilhões de payments
+// para chegar perto do limite do int64.
+const DefaultMaxAmount = 1_000_000_000
+
+// maxAmount é definido uma vez na inicialização, antes de o servidor
+// aceitar requisições
+var maxAmount = DefaultMaxAmount
+
+// SetMaxAmount define o maior amount aceito pelo Validate, em centavos
+func SetMaxAmount(n int) {
+	maxAmount = n
+}
+
+// AmountTooLargeError recusa um amount acima do máximo configurado
+type AmountTooLargeError struct {
+	Amount int
+	Max    int
+}
+
+func (e *AmountTooLargeError) Error() string {
+	return fmt.Sprintf("amount %d exceeds the maximum of %d", e.Amount, e.Max)
+}
+
+// AddAmount soma amount a total; em vez de dar a volta no int64 o resultado
+// satura no limite e o estouro é logado como erro
+func AddAmount(total, amount int64) int64 {
+	sum, ok := addSaturating(total, amount)
+	if !ok {
+		logAmountOverflow(total, amount)
+	}
+	return sum
+}
+
+// AddAmountAtomic é o AddAmount sobre um contador atômico
+func AddAmountAtomic(addr *int64, amount int64) {
+	for {
+		total := atomic.LoadInt64(addr)
+		sum, ok := addSaturating(total, amount)
+		if atomic.CompareAndSwapInt64(addr, total, sum) {
+			if !ok {
+				logAmountOverflow(total, amount)
+			}
+			return
+		}
+	}
+}
+
+func addSaturating(a, b int64) (int64, bool) {
+	switch {
+	case b > 0 && a > math.MaxInt64-b:
+		return math.MaxInt64, false
+	case b < 0 && a < math.MinInt64-b:
+		return math.MinInt64, false
+	}
+	return a + b, true
+}
+
+// logAmountOverflow loga o estouro, amostrado como os demais erros repetidos
+func logAmountOverflow(total, amount int64) {
+	if ok, n := logging.DefaultSampler().Allow("amount_overflow"); ok {
+		slog.Error("amount total overflow, saturating", "total", total, "amount", amount, logging.KeyOccurrences, n)
+	}
+}
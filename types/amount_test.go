@@ -0,0 +1,107 @@
+package types
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestValidateAmountBoundaries(t *testing.T) {
+	defer SetMaxAmount(DefaultMaxAmount)
+	SetMaxAmount(500)
+
+	tests := []struct {
+		amount       int
+		wantErr      bool
+		wantTooLarge bool
+	}{
+		{math.MinInt64, true, false},
+		{-1, true, false},
+		{0, true, false},
+		{1, false, false},
+		{499, false, false},
+		{500, false, false},
+		{501, true, true},
+		{math.MaxInt64, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.amount), func(t *testing.T) {
+			p := PaymentRequest{Amount: tt.amount, Type: "credit"}
+			err := p.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() = %v, want error %v", err, tt.wantErr)
+			}
+			var tooLarge *AmountTooLargeError
+			if errors.As(err, &tooLarge) != tt.wantTooLarge {
+				t.Fatalf("Validate() = %v, want AmountTooLargeError %v", err, tt.wantTooLarge)
+			}
+			if tt.wantTooLarge && (tooLarge.Amount != tt.amount || tooLarge.Max != 500) {
+				t.Errorf("AmountTooLargeError = %+v, want amount %d and max 500", tooLarge, tt.amount)
+			}
+		})
+	}
+}
+
+func TestDecodeAmountBoundaries(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  string
+		want    int
+		wantErr error // dentro do FieldError do amount
+	}{
+		{"max int64", "9223372036854775807", math.MaxInt64, nil},
+		{"min int64", "-9223372036854775808", math.MinInt64, nil},
+		{"one past max int64", "9223372036854775808", 0, errAmountRange},
+		{"one past min int64", "-9223372036854775809", 0, errAmountRange},
+		{"exponent", "1e3", 0, errAmount},
+		{"exponent in range of int64", "9e18", 0, errAmount},
+		{"fraction", "100.5", 0, errAmount},
+		{"integral fraction", "100.0", 0, errAmount},
+		{"string", `"100"`, 0, errAmountString},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte(`{"amount":` + tt.amount + `,"type":"credit"}`)
+			fast, std, fastErr, stdErr := decodeBoth(t, data)
+			for codec, err := range map[string]error{"fast": fastErr, "std": stdErr} {
+				if tt.wantErr == nil {
+					if err != nil {
+						t.Errorf("%s codec: %v", codec, err)
+					}
+					continue
+				}
+				var field *FieldError
+				if !errors.As(err, &field) || field.Field != "amount" || !errors.Is(err, tt.wantErr) {
+					t.Errorf("%s codec error = %v, want %q on amount", codec, err, tt.wantErr)
+				}
+			}
+			if tt.wantErr == nil && (fast.Amount != tt.want || std.Amount != tt.want) {
+				t.Errorf("amount = %d (fast) and %d (std), want %d", fast.Amount, std.Amount, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddAmountSaturates(t *testing.T) {
+	tests := []struct {
+		total, amount, want int64
+	}{
+		{math.MaxInt64 - 1, 1, math.MaxInt64},
+		{math.MaxInt64, 1, math.MaxInt64},
+		{math.MaxInt64 - 10, math.MaxInt64, math.MaxInt64},
+		{math.MinInt64 + 1, -1, math.MinInt64},
+		{math.MinInt64, -1, math.MinInt64},
+		{math.MaxInt64, -1, math.MaxInt64 - 1},
+		{100, 250, 350},
+	}
+	for _, tt := range tests {
+		if got := AddAmount(tt.total, tt.amount); got != tt.want {
+			t.Errorf("AddAmount(%d, %d) = %d, want %d", tt.total, tt.amount, got, tt.want)
+		}
+		total := tt.total
+		if AddAmountAtomic(&total, tt.amount); total != tt.want {
+			t.Errorf("AddAmountAtomic(%d, %d) = %d, want %d", tt.total, tt.amount, total, tt.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BuiltinCurrencies são os códigos ISO 4217 aceitos sem configuração; a
+// lista pode ser estendida com SetCurrencies
+var BuiltinCurrencies = []string{
+	"BRL", "USD", "EUR", "GBP", "JPY", "CHF", "CAD", "AUD", "CNY",
+	"ARS", "BOB", "CLP", "COP", "MXN", "PEN", "PYG", "UYU",
+}
+
+// defaultCurrency e currencies são definidos uma vez na inicialização,
+// antes de o servidor aceitar requisições
+var (
+	defaultCurrency = "BRL"
+	currencies      = currencySet(nil)
+)
+
+// SetCurrencies define a moeda dos payments sem currency e os códigos
+// aceitos além dos embutidos. Os códigos devem vir validados (ver
+// IsCurrencyCode); são normalizados para maiúsculas.
+func SetCurrencies(defaultCode string, extra []string) {
+	defaultCurrency = strings.ToUpper(defaultCode)
+	currencies = currencySet(extra)
+}
+
+// DefaultCurrency retorna a moeda dos payments enviados sem currency. Os
+// valores do summary sem quebra por moeda estão nela.
+func DefaultCurrency() string {
+	return defaultCurrency
+}
+
+// CurrencySupported indica se o código, já em maiúsculas, é aceito
+func CurrencySupported(code string) bool {
+	_, ok := currencies[code]
+	return ok
+}
+
+// IsCurrencyCode indica se code tem o formato de um código ISO 4217: três
+// letras, sem diferenciar maiúsculas
+func IsCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for i := 0; i < len(code); i++ {
+		if c := code[i] | 0x20; c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+// NormalizeCurrency aplica a moeda padrão ao currency vazio e converte o
+// código para maiúsculas
+func NormalizeCurrency(code string) string {
+	if code == "" {
+		return defaultCurrency
+	}
+	return strings.ToUpper(code)
+}
+
+// validateCurrency recusa códigos fora do formato ou da lista aceita,
+// citando o valor recebido
+func validateCurrency(code string) error {
+	if code == "" {
+		return nil
+	}
+	if !IsCurrencyCode(code) {
+		return fmt.Errorf("currency %q is not a 3-letter ISO 4217 code", truncate(code, 16))
+	}
+	if !CurrencySupported(strings.ToUpper(code)) {
+		return fmt.Errorf("currency %q is not supported", code)
+	}
+	return nil
+}
+
+// truncate encurta valores do cliente citados em mensagens de erro
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+func currencySet(extra []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(BuiltinCurrencies)+len(extra))
+	for _, code := range BuiltinCurrencies {
+		set[code] = struct{}{}
+	}
+	for _, code := range extra {
+		set[strings.ToUpper(code)] = struct{}{}
+	}
+	return set
+}
@@ -0,0 +1,68 @@
+package types
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxDescriptionRunes limita o description em caracteres, não em bytes,
+// para texto com acentos não ser recusado antes da hora
+const maxDescriptionRunes = 255
+
+// keepNewlines mantém quebras de linha no description. É definido uma vez
+// na inicialização, antes de o servidor aceitar requisições.
+var keepNewlines = false
+
+// SetDescriptionNewlines escolhe se o Normalize mantém as quebras de linha
+// do description ou as troca por espaço
+func SetDescriptionNewlines(keep bool) {
+	keepNewlines = keep
+}
+
+// Normalize limpa o texto livre do payment antes da validação, que mede o
+// resultado; o description limpo é o que vai ao processador e ao store
+func (p *PaymentRequest) Normalize() {
+	p.Description = SanitizeDescription(p.Description, keepNewlines)
+}
+
+// SanitizeDescription remove bytes que não são UTF-8 válido e caracteres de
+// controle e apara os espaços das pontas. Tab, quebras de linha e os demais
+// espaços Unicode viram espaço, para não colar as palavras; com keepNewline
+// o '\n' é mantido. O resultado é sempre UTF-8 válido.
+func SanitizeDescription(s string, keepNewline bool) string {
+	if isCleanASCII(s) {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		switch {
+		case r == utf8.RuneError && size == 1:
+			// byte inválido: descartado
+		case r == '\n' && keepNewline:
+			b.WriteRune(r)
+		case unicode.IsSpace(r):
+			b.WriteByte(' ')
+		case unicode.IsControl(r):
+			// demais controles (C0, DEL e C1): descartados
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// isCleanASCII indica se s já está limpo: ASCII imprimível sem espaço nas
+// pontas, o caso comum, que não precisa de cópia
+func isCleanASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return s == "" || (s[0] != ' ' && s[len(s)-1] != ' ')
+}
@@ -0,0 +1,61 @@
+package types
+
+import (
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FuzzSanitizeDescription confere as garantias do SanitizeDescription para
+// qualquer entrada: UTF-8 válido, sem controles nem espaço nas pontas, e
+// nunca mais caracteres que a entrada, para a limpeza não levar ao limite
+// da validação um description que cabia nele
+func FuzzSanitizeDescription(f *testing.F) {
+	for _, seed := range []string{
+		"", "pagamento", " café \t com\r\nleite ", "\x00\x1f\x7f\u0085 ",
+		"\xff\xfe", "a\xc3", "�", " fim　",
+		strings.Repeat("é", maxDescriptionRunes), strings.Repeat("\xff", maxDescriptionRunes+1),
+	} {
+		f.Add(seed, false)
+		f.Add(seed, true)
+	}
+
+	f.Fuzz(func(t *testing.T, in string, keepNewline bool) {
+		out := SanitizeDescription(in, keepNewline)
+
+		if !utf8.ValidString(out) {
+			t.Fatalf("SanitizeDescription(%q) = %q, not valid UTF-8", in, out)
+		}
+		if len(out) > len(in) || utf8.RuneCountInString(out) > utf8.RuneCountInString(in) {
+			t.Fatalf("SanitizeDescription(%q) = %q, longer than the input", in, out)
+		}
+		if out != strings.TrimSpace(out) {
+			t.Fatalf("SanitizeDescription(%q) = %q, spaces left at the ends", in, out)
+		}
+		for _, r := range out {
+			if r == '\n' && keepNewline {
+				continue
+			}
+			if unicode.IsControl(r) || (unicode.IsSpace(r) && r != ' ') {
+				t.Fatalf("SanitizeDescription(%q) = %q, kept %U", in, out, r)
+			}
+		}
+		if again := SanitizeDescription(out, keepNewline); again != out {
+			t.Fatalf("SanitizeDescription(%q) = %q, want the clean input back", out, again)
+		}
+
+		// Dentro do limite, o description limpo passa na validação
+		p := PaymentRequest{Amount: 1, Type: "credit", Description: in}
+		SetDescriptionNewlines(keepNewline)
+		p.Normalize()
+		SetDescriptionNewlines(false)
+		err := p.Validate()
+		if fits := utf8.RuneCountInString(in) <= maxDescriptionRunes; fits && err != nil {
+			t.Fatalf("description %q within the limit refused: %v", in, err)
+		}
+		if utf8.RuneCountInString(out) > maxDescriptionRunes && err == nil {
+			t.Fatalf("description %q over the limit accepted", out)
+		}
+	})
+}
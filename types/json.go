@@ -0,0 +1,602 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// fastJSON liga o codec escrito à mão do PaymentRequest. É definido uma vez
+// na inicialização, antes de o servidor aceitar requisições.
+var fastJSON = true
+
+// SetFastJSON escolhe entre o codec escrito à mão e o encoding/json
+func SetFastJSON(enabled bool) {
+	fastJSON = enabled
+}
+
+// Erros do decoder escrito à mão. Os de campo chegam ao chamador dentro de
+// um FieldError, com o nome do campo.
+var (
+	errSyntax       = errors.New("invalid JSON")
+	errTrailingData = errors.New("unexpected data after JSON object")
+
+	errUnknownField = errors.New("is not a known field")
+	errFieldType    = errors.New("has an invalid type")
+	errAmount       = errors.New("must be an integer number of cents, without fraction or exponent")
+	errAmountRange  = errors.New("is out of range")
+	errAmountString = errors.New("must be a number, not a string")
+)
+
+// FieldError é um erro de decodificação em um campo do payment, com
+// mensagem que pode ser devolvida ao cliente
+type FieldError struct {
+	Field string // como enviado pelo cliente
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return "field " + strconv.Quote(truncate(e.Field, 64)) + " " + e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// DecodePayment decodifica um PaymentRequest com a mesma semântica do
+// json.Decoder com DisallowUnknownFields: campos desconhecidos e amount não
+// inteiro são recusados, chaves casam sem diferenciar maiúsculas e null
+// mantém o valor atual do campo. Nos dois codecs os erros de um campo
+// (amount com expoente, grande demais para o tipo ou em string, campo
+// desconhecido) vêm como *FieldError, e qualquer coisa além de espaço depois
+// do objeto é recusada.
+func DecodePayment(data []byte, p *PaymentRequest) error {
+	if !fastJSON {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(p); err != nil {
+			return stdFieldError(err)
+		}
+		// O Decoder para no fim do primeiro valor; o resto precisa ser só espaço
+		if _, err := decoder.Token(); err != io.EOF {
+			return errTrailingData
+		}
+		return nil
+	}
+
+	d := jsonDecoder{data: data}
+	if err := d.decodePayment(p); err != nil {
+		return err
+	}
+	d.skipSpace()
+	if d.pos != len(d.data) {
+		return errTrailingData
+	}
+	return nil
+}
+
+// stdFieldError traduz os erros de campo do encoding/json para os mesmos
+// FieldError do decoder escrito à mão
+func stdFieldError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		if !strings.EqualFold(typeErr.Field, "amount") {
+			return &FieldError{Field: typeErr.Field, Err: errFieldType}
+		}
+		literal, isNumber := strings.CutPrefix(typeErr.Value, "number ")
+		switch {
+		case typeErr.Value == "string":
+			return &FieldError{Field: typeErr.Field, Err: errAmountString}
+		case !isNumber:
+			return &FieldError{Field: typeErr.Field, Err: errFieldType}
+		case strings.ContainsAny(literal, ".eE"):
+			return &FieldError{Field: typeErr.Field, Err: errAmount}
+		default:
+			return &FieldError{Field: typeErr.Field, Err: errAmountRange}
+		}
+	}
+	// O encoding/json não tem tipo para campo desconhecido: json: unknown field "x"
+	if quoted, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		if field, unquoteErr := strconv.Unquote(quoted); unquoteErr == nil {
+			return &FieldError{Field: field, Err: errUnknownField}
+		}
+	}
+	return err
+}
+
+// AppendJSON acrescenta o payment serializado a dst, idêntico ao json.Marshal
+func (p *PaymentRequest) AppendJSON(dst []byte) ([]byte, error) {
+	return p.appendJSON(dst, true)
+}
+
+// AppendProcessorJSON acrescenta o payment como é enviado aos processadores,
+// sem o callbackUrl, que só interessa a este serviço
+func (p *PaymentRequest) AppendProcessorJSON(dst []byte) ([]byte, error) {
+	return p.appendJSON(dst, false)
+}
+
+func (p *PaymentRequest) appendJSON(dst []byte, withCallback bool) ([]byte, error) {
+	if !fastJSON {
+		v := p
+		if !withCallback && p.CallbackURL != "" {
+			stripped := *p
+			stripped.CallbackURL = ""
+			v = &stripped
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return dst, err
+		}
+		return append(dst, data...), nil
+	}
+
+	dst = append(dst, '{')
+	if p.CorrelationID != "" {
+		dst = append(dst, `"correlationId":`...)
+		dst = AppendJSONString(dst, p.CorrelationID)
+		dst = append(dst, ',')
+	}
+	dst = append(dst, `"amount":`...)
+	dst = strconv.AppendInt(dst, int64(p.Amount), 10)
+	if p.Currency != "" {
+		dst = append(dst, `,"currency":`...)
+		dst = AppendJSONString(dst, p.Currency)
+	}
+	if p.Description != "" {
+		dst = append(dst, `,"description":`...)
+		dst = AppendJSONString(dst, p.Description)
+	}
+	dst = append(dst, `,"type":`...)
+	dst = AppendJSONString(dst, p.Type)
+	dst = append(dst, `,"requestedAt":`...)
+	timeJSON, err := p.RequestedAt.MarshalJSON()
+	if err != nil {
+		return dst, err
+	}
+	dst = append(dst, timeJSON...)
+	if len(p.Metadata) > 0 {
+		dst = append(dst, `,"metadata":`...)
+		dst = appendMetadata(dst, p.Metadata)
+	}
+	if withCallback && p.CallbackURL != "" {
+		dst = append(dst, `,"callbackUrl":`...)
+		dst = AppendJSONString(dst, p.CallbackURL)
+	}
+	return append(dst, '}'), nil
+}
+
+// appendMetadata acrescenta o mapa com as chaves ordenadas, como o
+// encoding/json
+func appendMetadata(dst []byte, metadata map[string]string) []byte {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	dst = append(dst, '{')
+	for i, key := range keys {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = AppendJSONString(dst, key)
+		dst = append(dst, ':')
+		dst = AppendJSONString(dst, metadata[key])
+	}
+	return append(dst, '}')
+}
+
+// AppendJSONString acrescenta s como string JSON, com o mesmo escape do
+// encoding/json (incluindo <, > e &)
+func AppendJSONString(dst []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				dst = append(dst, '\\', c)
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hex[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
+
+// jsonDecoder é um leitor mínimo de JSON para o schema fixo do payment
+type jsonDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *jsonDecoder) decodePayment(p *PaymentRequest) error {
+	d.skipSpace()
+	if d.consumeNull() {
+		return nil // null no topo não altera o payment, como no encoding/json
+	}
+	if !d.consume('{') {
+		return errSyntax
+	}
+	d.skipSpace()
+	if d.consume('}') {
+		return nil
+	}
+
+	for {
+		d.skipSpace()
+		key, err := d.readString()
+		if err != nil {
+			return err
+		}
+		d.skipSpace()
+		if !d.consume(':') {
+			return errSyntax
+		}
+		d.skipSpace()
+
+		if err := d.decodeField(p, key); err != nil {
+			if err == errSyntax || err == errTrailingData {
+				return err
+			}
+			return &FieldError{Field: key, Err: err}
+		}
+
+		d.skipSpace()
+		if d.consume(',') {
+			continue
+		}
+		if d.consume('}') {
+			return nil
+		}
+		return errSyntax
+	}
+}
+
+// decodeField lê o valor do campo key; o casamento usa case folding como
+// no encoding/json
+func (d *jsonDecoder) decodeField(p *PaymentRequest, key string) error {
+	switch {
+	case strings.EqualFold(key, "correlationId"):
+		return d.readStringField(&p.CorrelationID)
+	case strings.EqualFold(key, "currency"):
+		return d.readStringField(&p.Currency)
+	case strings.EqualFold(key, "description"):
+		return d.readStringField(&p.Description)
+	case strings.EqualFold(key, "type"):
+		return d.readStringField(&p.Type)
+	case strings.EqualFold(key, "callbackUrl"):
+		return d.readStringField(&p.CallbackURL)
+	case strings.EqualFold(key, "metadata"):
+		return d.readMetadata(&p.Metadata)
+	case strings.EqualFold(key, "amount"):
+		if d.consumeNull() {
+			return nil
+		}
+		return d.readInt(&p.Amount)
+	case strings.EqualFold(key, "requestedAt"):
+		if d.consumeNull() {
+			return nil
+		}
+		start := d.pos
+		if _, err := d.readString(); err != nil {
+			if err == errFieldType {
+				return err
+			}
+			return errSyntax
+		}
+		if err := p.RequestedAt.UnmarshalJSON(d.data[start:d.pos]); err != nil {
+			return errFieldType
+		}
+		return nil
+	default:
+		return errUnknownField
+	}
+}
+
+// readMetadata lê um objeto de strings. Como no encoding/json, null zera o
+// mapa, chaves repetidas ficam com o último valor e null em um valor vira
+// string vazia.
+func (d *jsonDecoder) readMetadata(dst *map[string]string) error {
+	if d.consumeNull() {
+		*dst = nil
+		return nil
+	}
+	if d.pos < len(d.data) && d.data[d.pos] != '{' {
+		if c := d.data[d.pos]; c == '"' || c == '[' || c == 't' || c == 'f' || c == '-' || (c >= '0' && c <= '9') {
+			return errFieldType
+		}
+	}
+	if !d.consume('{') {
+		return errSyntax
+	}
+	if *dst == nil {
+		*dst = make(map[string]string)
+	}
+	d.skipSpace()
+	if d.consume('}') {
+		return nil
+	}
+
+	for {
+		d.skipSpace()
+		key, err := d.readString()
+		if err != nil {
+			return errSyntax
+		}
+		d.skipSpace()
+		if !d.consume(':') {
+			return errSyntax
+		}
+		d.skipSpace()
+
+		var value string
+		if err := d.readStringField(&value); err != nil {
+			return err
+		}
+		(*dst)[key] = value
+
+		d.skipSpace()
+		if d.consume(',') {
+			continue
+		}
+		if d.consume('}') {
+			return nil
+		}
+		return errSyntax
+	}
+}
+
+func (d *jsonDecoder) readStringField(dst *string) error {
+	if d.consumeNull() {
+		return nil
+	}
+	s, err := d.readString()
+	if err != nil {
+		return err
+	}
+	*dst = s
+	return nil
+}
+
+// readInt lê um número JSON inteiro; frações e expoentes são recusados
+// como no encoding/json ao decodificar em int
+func (d *jsonDecoder) readInt(dst *int) error {
+	start := d.pos
+	if d.pos < len(d.data) && d.data[d.pos] == '-' {
+		d.pos++
+	}
+	if d.pos >= len(d.data) {
+		return errSyntax
+	}
+
+	switch c := d.data[d.pos]; {
+	case c == '0':
+		d.pos++
+	case c >= '1' && c <= '9':
+		for d.pos < len(d.data) && d.data[d.pos] >= '0' && d.data[d.pos] <= '9' {
+			d.pos++
+		}
+	case c == '"':
+		return errAmountString
+	case c == '{' || c == '[' || c == 't' || c == 'f':
+		return errFieldType
+	default:
+		return errSyntax
+	}
+
+	if d.pos < len(d.data) {
+		if c := d.data[d.pos]; c == '.' || c == 'e' || c == 'E' {
+			return errAmount
+		}
+	}
+
+	n, err := strconv.ParseInt(string(d.data[start:d.pos]), 10, strconv.IntSize)
+	if err != nil {
+		return errAmountRange
+	}
+	*dst = int(n)
+	return nil
+}
+
+// readString lê uma string JSON, decodificando escapes. UTF-8 inválido vira
+// U+FFFD, como no encoding/json.
+func (d *jsonDecoder) readString() (string, error) {
+	if d.pos >= len(d.data) {
+		return "", errSyntax
+	}
+	if d.data[d.pos] != '"' {
+		if c := d.data[d.pos]; c == '{' || c == '[' || c == 't' || c == 'f' || c == '-' || (c >= '0' && c <= '9') {
+			return "", errFieldType
+		}
+		return "", errSyntax
+	}
+	d.pos++
+
+	// Caminho rápido: sem escapes nem bytes fora do ASCII
+	start := d.pos
+	for d.pos < len(d.data) {
+		c := d.data[d.pos]
+		if c == '"' {
+			s := string(d.data[start:d.pos])
+			d.pos++
+			return s, nil
+		}
+		if c == '\\' || c < 0x20 || c >= utf8.RuneSelf {
+			break
+		}
+		d.pos++
+	}
+
+	buf := append([]byte(nil), d.data[start:d.pos]...)
+	for d.pos < len(d.data) {
+		c := d.data[d.pos]
+		switch {
+		case c == '"':
+			d.pos++
+			return string(buf), nil
+		case c < 0x20:
+			return "", errSyntax
+		case c == '\\':
+			var err error
+			if buf, err = d.readEscape(buf); err != nil {
+				return "", err
+			}
+		case c < utf8.RuneSelf:
+			buf = append(buf, c)
+			d.pos++
+		default:
+			r, size := utf8.DecodeRune(d.data[d.pos:])
+			if r == utf8.RuneError && size == 1 {
+				buf = utf8.AppendRune(buf, utf8.RuneError)
+			} else {
+				buf = append(buf, d.data[d.pos:d.pos+size]...)
+			}
+			d.pos += size
+		}
+	}
+	return "", errSyntax
+}
+
+// readEscape decodifica o escape em d.pos (que aponta para a barra)
+func (d *jsonDecoder) readEscape(buf []byte) ([]byte, error) {
+	if d.pos+1 >= len(d.data) {
+		return buf, errSyntax
+	}
+	c := d.data[d.pos+1]
+	d.pos += 2
+
+	switch c {
+	case '"', '\\', '/':
+		return append(buf, c), nil
+	case 'b':
+		return append(buf, '\b'), nil
+	case 'f':
+		return append(buf, '\f'), nil
+	case 'n':
+		return append(buf, '\n'), nil
+	case 'r':
+		return append(buf, '\r'), nil
+	case 't':
+		return append(buf, '\t'), nil
+	case 'u':
+		r, ok := d.readHex4()
+		if !ok {
+			return buf, errSyntax
+		}
+		if utf16.IsSurrogate(r) {
+			// Par substituto: o segundo escape precisa vir em seguida
+			r2 := utf8.RuneError
+			if d.pos+1 < len(d.data) && d.data[d.pos] == '\\' && d.data[d.pos+1] == 'u' {
+				save := d.pos
+				d.pos += 2
+				low, ok := d.readHex4()
+				if !ok {
+					return buf, errSyntax
+				}
+				if dec := utf16.DecodeRune(r, low); dec != utf8.RuneError {
+					r2 = dec
+				} else {
+					d.pos = save // o segundo escape é lido separadamente
+				}
+			}
+			return utf8.AppendRune(buf, r2), nil
+		}
+		return utf8.AppendRune(buf, r), nil
+	default:
+		return buf, errSyntax
+	}
+}
+
+func (d *jsonDecoder) readHex4() (rune, bool) {
+	if d.pos+4 > len(d.data) {
+		return 0, false
+	}
+	var r rune
+	for _, c := range d.data[d.pos : d.pos+4] {
+		switch {
+		case c >= '0' && c <= '9':
+			c -= '0'
+		case c >= 'a' && c <= 'f':
+			c = c - 'a' + 10
+		case c >= 'A' && c <= 'F':
+			c = c - 'A' + 10
+		default:
+			return 0, false
+		}
+		r = r<<4 | rune(c)
+	}
+	d.pos += 4
+	return r, true
+}
+
+func (d *jsonDecoder) skipSpace() {
+	for d.pos < len(d.data) {
+		switch d.data[d.pos] {
+		case ' ', '\t', '\n', '\r':
+			d.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (d *jsonDecoder) consume(c byte) bool {
+	if d.pos < len(d.data) && d.data[d.pos] == c {
+		d.pos++
+		return true
+	}
+	return false
+}
+
+func (d *jsonDecoder) consumeNull() bool {
+	if bytes.HasPrefix(d.data[d.pos:], []byte("null")) {
+		d.pos += 4
+		return true
+	}
+	return false
+}
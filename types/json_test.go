@@ -0,0 +1,132 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// decodeBoth decodifica data com o codec escrito à mão e com o encoding/json
+func decodeBoth(t *testing.T, data []byte) (fast, std PaymentRequest, fastErr, stdErr error) {
+	t.Helper()
+	defer SetFastJSON(true)
+
+	SetFastJSON(true)
+	fastErr = DecodePayment(data, &fast)
+	SetFastJSON(false)
+	stdErr = DecodePayment(data, &std)
+	return fast, std, fastErr, stdErr
+}
+
+func TestDecodePaymentAgreesWithStdlib(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		ok    bool
+	}{
+		{"minimal", `{"correlationId":"a","amount":1990}`, true},
+		{"all fields", `{"correlationId":"a","amount":1,"currency":"USD","description":"x\ny","type":"pix","requestedAt":"2025-07-09T12:00:00.5Z","metadata":{"k":"v"},"callbackUrl":"http://h/cb"}`, true},
+		{"case folding", `{"CORRELATIONID":"a","Amount":5}`, true},
+		{"null fields", `{"amount":null,"type":null,"metadata":null}`, true},
+		{"escapes", `{"description":"é😀\t\"\\\/"}`, true},
+		{"surrounding space", " \n{\"amount\":1}\t\r\n", true},
+		{"top-level null", `null`, true},
+		{"unknown field", `{"amount":1,"extra":true}`, false},
+		{"decimal amount", `{"amount":19.90}`, false},
+		{"exponent amount", `{"amount":1e3}`, false},
+		{"string amount", `{"amount":"10"}`, false},
+		{"amount overflow", `{"amount":99999999999999999999}`, false},
+		{"trailing object", `{"amount":1}{"amount":2}`, false},
+		{"trailing garbage", `{"amount":1} x`, false},
+		{"trailing comma", `{"amount":1,}`, false},
+		{"truncated", `{"amount":1`, false},
+		{"invalid requestedAt", `{"requestedAt":"yesterday"}`, false},
+		{"array", `[]`, false},
+		{"empty", ``, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fast, std, fastErr, stdErr := decodeBoth(t, []byte(tt.input))
+			if (fastErr == nil) != tt.ok || (stdErr == nil) != tt.ok {
+				t.Fatalf("fast err = %v, std err = %v, want ok = %v", fastErr, stdErr, tt.ok)
+			}
+			if tt.ok && !reflect.DeepEqual(fast, std) {
+				t.Errorf("fast = %+v, std = %+v", fast, std)
+			}
+		})
+	}
+}
+
+func TestDecodePaymentFieldErrors(t *testing.T) {
+	for _, input := range []string{`{"amount":1.5}`, `{"amount":"1"}`, `{"amount":1e40}`, `{"nope":1}`, `{"type":5}`} {
+		_, _, fastErr, stdErr := decodeBoth(t, []byte(input))
+		var fastField, stdField *FieldError
+		if !errors.As(fastErr, &fastField) || !errors.As(stdErr, &stdField) {
+			t.Fatalf("%s: fast err = %v, std err = %v, want *FieldError from both", input, fastErr, stdErr)
+		}
+		if fastField.Field != stdField.Field || !errors.Is(fastErr, stdField.Err) {
+			t.Errorf("%s: fast = %v, std = %v", input, fastErr, stdErr)
+		}
+	}
+}
+
+func TestAppendJSONMatchesMarshal(t *testing.T) {
+	p := PaymentRequest{
+		CorrelationID: "4a7901b8-7d26-4d9d-aa19-4dc1c7cf60b3",
+		Amount:        1990,
+		Currency:      "BRL",
+		Description:   "<café> & \"aspas\"\n ",
+		Type:          "pix",
+		RequestedAt:   time.Date(2025, 7, 9, 12, 0, 0, 123000000, time.UTC),
+		Metadata:      map[string]string{"b": "2", "a": "1"},
+		CallbackURL:   "http://client/cb",
+	}
+	got, err := p.AppendJSON(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := json.Marshal(&p)
+	if !bytes.Equal(got, want) {
+		t.Errorf("AppendJSON = %s\nwant %s", got, want)
+	}
+}
+
+// FuzzDecodePayment confere o codec escrito à mão contra o encoding/json:
+// os dois aceitam e recusam as mesmas entradas, com o mesmo resultado, e o
+// payment aceito volta idêntico depois de serializado pelo AppendJSON
+func FuzzDecodePayment(f *testing.F) {
+	for _, seed := range []string{
+		`{"correlationId":"4a7901b8-7d26-4d9d-aa19-4dc1c7cf60b3","amount":1990}`,
+		`{"amount":1,"type":"pix","currency":"usd","description":"aé\n","metadata":{"k":"v"}}`,
+		`{"requestedAt":"2025-07-09T12:00:00Z","callbackUrl":"http://h"}`,
+		`{"amount":19.90}`, `{"amount":1e2}`, `{"AMOUNT":-5}`, `{"x":1}`,
+		`{"amount":1} {}`, `null`, `{"description":"\ud800"}`, "{\"description\":\"\xff\"}",
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fast, std, fastErr, stdErr := decodeBoth(t, data)
+		if (fastErr == nil) != (stdErr == nil) {
+			t.Fatalf("input %q: fast err = %v, std err = %v", data, fastErr, stdErr)
+		}
+		if fastErr != nil {
+			return
+		}
+		if !reflect.DeepEqual(fast, std) {
+			t.Fatalf("input %q: fast = %#v, std = %#v", data, fast, std)
+		}
+
+		encoded, err := fast.AppendJSON(nil)
+		if err != nil {
+			return // requestedAt fora do intervalo que o time.Time serializa
+		}
+		want, _ := json.Marshal(&fast)
+		if !bytes.Equal(encoded, want) {
+			t.Fatalf("input %q: AppendJSON = %s, json.Marshal = %s", data, encoded, want)
+		}
+	})
+}
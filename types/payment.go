@@ -3,13 +3,57 @@ package types
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+	"unicode/utf8"
 )
 
 // PaymentRequest representa o payload de entrada
 type PaymentRequest struct {
-	Amount      int    `json:"amount"`
-	Description string `json:"description,omitempty"`
-	Type        string `json:"type"`
+	CorrelationID string            `json:"correlationId,omitempty"`
+	Amount        int               `json:"amount"`
+	Currency      string            `json:"currency,omitempty"` // ISO 4217; vazio assume a moeda padrão
+	Description   string            `json:"description,omitempty"`
+	Type          string            `json:"type"`
+	RequestedAt   time.Time         `json:"requestedAt"`           // definido pelo handler no aceite
+	Metadata      map[string]string `json:"metadata,omitempty"`    // pares livres do cliente; vão ao processador e ao store
+	CallbackURL   string            `json:"callbackUrl,omitempty"` // avisado ao fim do processamento; não vai ao processador
+}
+
+// maxCallbackURLLength limita o callbackUrl aceito no payload
+const maxCallbackURLLength = 2048
+
+// Limites do metadata. Chaves usam apenas letras, dígitos, '_', '-' e '.';
+// o tamanho total é medido no JSON enviado ao processador.
+const (
+	maxMetadataKeys        = 10
+	maxMetadataKeyLength   = 40
+	maxMetadataValueLength = 255
+	maxMetadataBytes       = 1024
+)
+
+// paymentPool reaproveita os PaymentRequest entre requisições
+var paymentPool = sync.Pool{
+	New: func() any { return new(PaymentRequest) },
+}
+
+// AcquirePayment obtém um PaymentRequest zerado do pool
+func AcquirePayment() *PaymentRequest {
+	return paymentPool.Get().(*PaymentRequest)
+}
+
+// ReleasePayment devolve o payment ao pool. Deve ser chamado apenas pelo
+// dono atual e nenhuma referência a ele pode ser usada depois.
+func ReleasePayment(p *PaymentRequest) {
+	p.Reset()
+	paymentPool.Put(p)
+}
+
+// Reset zera todos os campos, inclusive os que vierem a ser adicionados
+func (p *PaymentRequest) Reset() {
+	*p = PaymentRequest{}
 }
 
 // PaymentResponse representa a resposta do processamento
@@ -17,6 +61,46 @@ type PaymentResponse struct {
 	ID          string `json:"id"`
 	Status      string `json:"status"`
 	ProcessedBy string `json:"processed_by"`
+	Reason      string `json:"reason,omitempty"` // classe da falha no 502 do modo síncrono
+
+	Error *ErrorDetail `json:"error,omitempty"` // envelope de erro no 502 do modo síncrono
+}
+
+// ErrorResponse é o envelope de toda resposta de erro (não 2xx) da API
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail traz o código estável do erro, para o cliente decidir o que
+// fazer, e uma mensagem legível que pode mudar
+type ErrorDetail struct {
+	Code         string `json:"code"`
+	Message      string `json:"message"`
+	RetryAfterMs int64  `json:"retryAfterMs,omitempty"` // apenas nas recusas por fila cheia
+}
+
+// BatchResponse é a resposta do POST /payments/batch (207): um resultado
+// por item, na ordem do lote
+type BatchResponse struct {
+	Accepted int               `json:"accepted"`
+	Rejected int               `json:"rejected"`
+	Results  []BatchItemResult `json:"results"`
+}
+
+// BatchItemResult é o desfecho de um item do lote
+type BatchItemResult struct {
+	Index  int    `json:"index"`
+	ID     string `json:"id,omitempty"`
+	Status string `json:"status"`           // accepted ou rejected
+	Reason string `json:"reason,omitempty"` // mesmos motivos do rinha_payments_rejected_total
+	Error  string `json:"error,omitempty"`
+}
+
+// BulkItemResult é o resultado de um payment na resposta do endpoint de
+// lote do processador; status segue a semântica HTTP (2xx é sucesso)
+type BulkItemResult struct {
+	CorrelationID string `json:"correlationId"`
+	Status        int    `json:"status"`
 }
 
 // ProcessorResult representa o resultado do processamento
@@ -24,14 +108,649 @@ type ProcessorResult struct {
 	Success     bool   `json:"success"`
 	ProcessorID string `json:"processor_id"`
 	Error       error  `json:"error,omitempty"`
+	Reason      string `json:"reason,omitempty"` // classe da falha (timeout, http_5xx, ...)
+	StatusCode  int    `json:"status_code,omitempty"`
+	Attempts    int    `json:"attempts,omitempty"` // chamadas feitas pelo ProcessPayment
+}
+
+// Desfechos de um payment retirado da fila, informados no callback e no
+// stream de eventos
+const (
+	OutcomeProcessed = "processed"
+	OutcomeFailed    = "failed"
+	OutcomeExpired   = "expired"
+)
+
+// Estados do ciclo de vida de um payment: queued ao entrar na fila,
+// processing quando um worker (ou o processamento inline/sync) o assume e
+// um estado final. expired é o payment descartado na fila por idade.
+const (
+	StatusQueued     = "queued"
+	StatusProcessing = "processing"
+	StatusSucceeded  = "succeeded"
+	StatusFailed     = "failed"
+	StatusExpired    = "expired"
+)
+
+// PaymentStatus é o estado de um payment e o horário de cada transição;
+// os horários de estados pelos quais ele não passou ficam nulos
+type PaymentStatus struct {
+	Status       string     `json:"status"`
+	Processor    string     `json:"processor,omitempty"` // apenas em succeeded
+	Reason       string     `json:"reason,omitempty"`    // classe da falha, apenas em failed
+	QueuedAt     *time.Time `json:"queuedAt,omitempty"`  // nulo nos processados inline/sync
+	ProcessingAt *time.Time `json:"processingAt,omitempty"`
+	FinishedAt   *time.Time `json:"finishedAt,omitempty"`
+}
+
+// PaymentCallback é o corpo enviado ao callbackUrl quando o worker termina
+// o payment
+type PaymentCallback struct {
+	CorrelationID string    `json:"correlationId"`
+	Status        string    `json:"status"`              // processed, failed ou expired
+	Processor     string    `json:"processor,omitempty"` // apenas em processed
+	ProcessedAt   time.Time `json:"processedAt"`
+}
+
+// FailedPayment é a linha do journal de falhas: um payment que os workers
+// abandonaram, por falhar em todos os processadores, esgotar o orçamento de
+// tentativas ou vencer na fila
+type FailedPayment struct {
+	CorrelationID string           `json:"correlationId"`
+	Outcome       string           `json:"outcome"`           // failed ou expired
+	Reason        string           `json:"reason,omitempty"`  // classe da última falha
+	Error         string           `json:"error,omitempty"`   // última falha
+	Attempts      int              `json:"attempts"`          // chamadas aos processadores
+	Budget        string           `json:"budget,omitempty"`  // limite esgotado (attempts ou elapsed), se o orçamento de tentativas acabou
+	History       []PaymentAttempt `json:"history,omitempty"` // passagens reagendadas, as mais recentes
+	RequestID     string           `json:"requestId,omitempty"`
+	EnqueuedAt    time.Time        `json:"enqueuedAt"`
+	FailedAt      time.Time        `json:"failedAt"`
+	Payment       json.RawMessage  `json:"payment"` // como aceito, com metadata e callbackUrl
+}
+
+// PaymentAttempt é uma passagem de um payment pelo processamento que
+// terminou reagendada
+type PaymentAttempt struct {
+	At        time.Time `json:"at"`
+	Processor string    `json:"processor"` // none se nenhum processador foi chamado
+	Reason    string    `json:"reason"`    // classe da falha (ex: throttled)
+	Calls     int       `json:"calls"`     // chamadas aos processadores na passagem
+}
+
+// PaymentEvent é o evento do GET /payments/events para cada payment
+// finalizado pelos workers
+type PaymentEvent struct {
+	CorrelationID string  `json:"correlationId"`
+	Processor     string  `json:"processor,omitempty"` // apenas em processed
+	Outcome       string  `json:"outcome"`             // processed, failed ou expired
+	LatencyMs     float64 `json:"latency_ms"`          // da entrada na fila até o fim
+}
+
+// EventStats mostra os assinantes do stream de eventos
+type EventStats struct {
+	Subscribers int   `json:"subscribers"`
+	Dropped     int64 `json:"dropped"` // eventos descartados por assinantes lentos
 }
 
 // PaymentSummary representa o resumo de payments
 type PaymentSummary struct {
-	TotalPayments    int64 `json:"total_payments"`
-	DefaultSuccess   int64 `json:"default_success"`
-	FallbackSuccess  int64 `json:"fallback_success"`
-	TotalErrors      int64 `json:"total_errors"`
+	TotalPayments   int64 `json:"total_payments"`
+	DefaultSuccess  int64 `json:"default_success"`
+	FallbackSuccess int64 `json:"fallback_success"`
+	TotalErrors     int64 `json:"total_errors"`
+	TotalExpired    int64 `json:"total_expired"`     // descartados na fila por idade (QUEUE_TTL_MS)
+	DefaultAmount   int64 `json:"default_amount"`    // soma em centavos, na moeda padrão
+	FallbackAmount  int64 `json:"fallback_amount"`   // soma em centavos, na moeda padrão
+	ExpiredAmount   int64 `json:"expired_amount"`    // soma em centavos, na moeda padrão
+	Partial         bool  `json:"partial,omitempty"` // alguma instância irmã não respondeu
+
+	// Início da janela dos contadores: o boot ou o último
+	// POST /admin/stats/reset. Ausente no summary compartilhado do Redis,
+	// que não é zerado, e no de intervalo (from/to).
+	Since *time.Time `json:"since,omitempty"`
+
+	// Somas dos payments nas demais moedas, por código ISO 4217; valores de
+	// moedas diferentes nunca são somados entre si
+	Currencies map[string]CurrencyAmounts `json:"currencies,omitempty"`
+
+	Detail *SummaryDetail `json:"detail,omitempty"` // apenas com ?detailed=true
+}
+
+// SummaryBuckets é o summary por intervalo (groupBy): os intervalos de from
+// a to, em ordem, inclusive os sem payments
+type SummaryBuckets struct {
+	GroupBy string          `json:"group_by"`
+	From    time.Time       `json:"from"` // início do primeiro intervalo
+	To      time.Time       `json:"to"`   // fim do último intervalo, exclusivo
+	Buckets []SummaryBucket `json:"buckets"`
+}
+
+// SummaryBucket são os payments com requestedAt em um intervalo do
+// SummaryBuckets
+type SummaryBucket struct {
+	Start           time.Time `json:"start"`
+	TotalPayments   int64     `json:"total_payments"`
+	DefaultSuccess  int64     `json:"default_success"`
+	FallbackSuccess int64     `json:"fallback_success"`
+	DefaultAmount   int64     `json:"default_amount"`  // soma em centavos, na moeda padrão
+	FallbackAmount  int64     `json:"fallback_amount"` // soma em centavos, na moeda padrão
+
+	Currencies map[string]CurrencyAmounts `json:"currencies,omitempty"`
+}
+
+// CurrencyAmounts são as somas do summary em uma moeda que não a padrão
+type CurrencyAmounts struct {
+	DefaultAmount  int64 `json:"default_amount"`  // soma em centavos
+	FallbackAmount int64 `json:"fallback_amount"` // soma em centavos
+	ExpiredAmount  int64 `json:"expired_amount"`  // soma em centavos
+}
+
+// Add soma outros valores a a
+func (a *CurrencyAmounts) Add(o CurrencyAmounts) {
+	a.DefaultAmount = AddAmount(a.DefaultAmount, o.DefaultAmount)
+	a.FallbackAmount = AddAmount(a.FallbackAmount, o.FallbackAmount)
+	a.ExpiredAmount = AddAmount(a.ExpiredAmount, o.ExpiredAmount)
+}
+
+// AddCurrencies soma ao summary as somas por moeda de outro summary
+func (s *PaymentSummary) AddCurrencies(other map[string]CurrencyAmounts) {
+	for code, amounts := range other {
+		if s.Currencies == nil {
+			s.Currencies = make(map[string]CurrencyAmounts, len(other))
+		}
+		current := s.Currencies[code]
+		current.Add(amounts)
+		s.Currencies[code] = current
+	}
+}
+
+// Add soma a s os contadores de other; since, partial e detail ficam como
+// estão
+func (s *PaymentSummary) Add(other PaymentSummary) {
+	s.TotalPayments += other.TotalPayments
+	s.DefaultSuccess += other.DefaultSuccess
+	s.FallbackSuccess += other.FallbackSuccess
+	s.TotalErrors += other.TotalErrors
+	s.TotalExpired += other.TotalExpired
+	s.DefaultAmount = AddAmount(s.DefaultAmount, other.DefaultAmount)
+	s.FallbackAmount = AddAmount(s.FallbackAmount, other.FallbackAmount)
+	s.ExpiredAmount = AddAmount(s.ExpiredAmount, other.ExpiredAmount)
+	s.AddCurrencies(other.Currencies)
+}
+
+// Subtract desconta de s os contadores de base, lidos antes dos de s; as
+// moedas que ficam zeradas saem do mapa
+func (s *PaymentSummary) Subtract(base PaymentSummary) {
+	s.TotalPayments -= base.TotalPayments
+	s.DefaultSuccess -= base.DefaultSuccess
+	s.FallbackSuccess -= base.FallbackSuccess
+	s.TotalErrors -= base.TotalErrors
+	s.TotalExpired -= base.TotalExpired
+	s.DefaultAmount -= base.DefaultAmount
+	s.FallbackAmount -= base.FallbackAmount
+	s.ExpiredAmount -= base.ExpiredAmount
+	for code, amounts := range s.Currencies {
+		b := base.Currencies[code]
+		amounts.DefaultAmount -= b.DefaultAmount
+		amounts.FallbackAmount -= b.FallbackAmount
+		amounts.ExpiredAmount -= b.ExpiredAmount
+		if amounts == (CurrencyAmounts{}) {
+			delete(s.Currencies, code)
+			continue
+		}
+		s.Currencies[code] = amounts
+	}
+	if len(s.Currencies) == 0 {
+		s.Currencies = nil
+	}
+}
+
+// SummaryDetail traz as estatísticas detalhadas desta instância
+type SummaryDetail struct {
+	Latency map[string]LatencyStats `json:"latency"` // por processador
+	Pool    PoolStats               `json:"pool"`
+	Ingress IngressStats            `json:"ingress"`
+
+	QueueWait LatencyStats `json:"queue_wait"` // da entrada na fila até o worker retirar
+	Events    EventStats   `json:"events"`
+
+	Panics map[string]int64 `json:"panics"` // pânicos recuperados, por origem (http/worker)
+
+	RateLimit *RateLimitStats `json:"rate_limit,omitempty"` // apenas com o rate limit ligado
+	CPUShed   *CPUShedStats   `json:"cpu_shed,omitempty"`   // apenas com CPU_SHED
+
+	Routes map[string]RouteLatency `json:"routes"` // por "MÉTODO caminho" das rotas medidas
+
+	Amounts map[string]AmountStats `json:"amounts"` // por processador, desde o boot ou o último reset
+
+	DNS []DNSHostStats `json:"dns,omitempty"` // cache de DNS dos processadores, apenas com DNS_CACHE_TTL_MS
+
+	Routing RoutingStats `json:"routing"`
+}
+
+// RoutingStats mostra a estratégia, as regras de ROUTING_RULES e os
+// payments aceitos por type em cada processador
+type RoutingStats struct {
+	Strategy string                      `json:"strategy"`         // "priority" ou "sticky"
+	Rules    map[string][]string         `json:"rules"`            // type -> processadores, na ordem de tentativa
+	ByType   map[string]map[string]int64 `json:"by_type"`          // processador -> type -> aceitos desde o boot; types sem regra em "other"
+	Held     int64                       `json:"held"`             // passagens reagendadas sem processador permitido saudável
+	Sticky   map[string]int64            `json:"sticky,omitempty"` // processador -> payments enviados primeiro a ele pelo hash, com sticky
+}
+
+// DNSHostStats mostra os IPs guardados de um host de processador
+type DNSHostStats struct {
+	Host            string     `json:"host"`
+	Processors      []string   `json:"processors"`             // processadores com esse host na URL
+	Addresses       []string   `json:"addresses"`              // discados em rodízio
+	ResolvedAt      *time.Time `json:"resolved_at,omitempty"`  // última resolução bem-sucedida
+	AttemptedAt     *time.Time `json:"attempted_at,omitempty"` // última tentativa, com ou sem sucesso
+	Lookups         int64      `json:"lookups"`
+	Failures        int64      `json:"failures"`         // resoluções que falharam e mantiveram os IPs anteriores
+	ForcedRefreshes int64      `json:"forced_refreshes"` // resoluções forçadas por falha no connect
+	LastError       string     `json:"last_error,omitempty"`
+}
+
+// RateLimitStats mostra o rate limit por IP do POST /payments
+type RateLimitStats struct {
+	RatePerSecond float64          `json:"rate_per_second"`
+	Burst         int              `json:"burst"`
+	Clients       int              `json:"clients"`     // IPs com bucket em memória
+	MaxClients    int              `json:"max_clients"` // acima disso o menos recente sai
+	Throttled     int64            `json:"throttled"`   // recusas desde o start, inclusive de IPs já descartados
+	TopThrottled  []ClientThrottle `json:"top_throttled"`
+}
+
+// CPUShedStats mostra a recusa de POST /payments por uso de CPU
+type CPUShedStats struct {
+	ThresholdPercent float64 `json:"threshold_percent"`  // uso a partir do qual payments são recusados
+	MaxRejectPercent float64 `json:"max_reject_percent"` // teto da fração recusada
+	CPUs             float64 `json:"cpus"`               // capacidade usada no cálculo do uso
+	UsagePercent     float64 `json:"usage_percent"`      // uso na última amostra
+	ShedPercent      float64 `json:"shed_percent"`       // fração recusada agora
+	Shed             int64   `json:"shed"`               // recusas desde o start
+}
+
+// ClientThrottle conta as recusas de um IP enquanto o bucket dele está em
+// memória
+type ClientThrottle struct {
+	IP        string `json:"ip"`
+	Throttled int64  `json:"throttled"`
+}
+
+// IngressStats conta o destino dos payments recebidos no POST /payments:
+// accepted + inline + sync + soma de rejected é o total de requisições
+type IngressStats struct {
+	Accepted int64            `json:"accepted"` // enfileirados (202)
+	Inline   int64            `json:"inline"`   // processados na requisição com a fila cheia
+	Sync     int64            `json:"sync"`     // processados na requisição a pedido (?sync=true)
+	Rejected map[string]int64 `json:"rejected"` // por motivo, como no rinha_payments_rejected_total
+	ByType   map[string]int64 `json:"by_type"`  // aceitos por type, como no rinha_payments_by_type_total
+}
+
+// PoolStats traz a configuração efetiva do pool de workers e da fila
+type PoolStats struct {
+	Workers      int   `json:"workers"` // workers vivos no momento
+	QueueSize    int   `json:"queue_size"`
+	QueueDepth   int   `json:"queue_depth"`
+	InFlight     int64 `json:"in_flight"` // retirados da fila e ainda sem desfecho, inclusive os em throttled
+	BatchSize    int   `json:"batch_size"`
+	BatchFlushMs int64 `json:"batch_flush_ms"`
+	QueueTTLMs   int64 `json:"queue_ttl_ms"` // 0 sem TTL
+
+	BatchParallelism int `json:"batch_parallelism"`
+
+	PriorityThreshold int `json:"priority_threshold,omitempty"` // centavos; 0 sem prioridade
+
+	Throttled int64   `json:"throttled"`  // retirados da fila aguardando token no rate limit dos processadores
+	DrainRate float64 `json:"drain_rate"` // payments finalizados por segundo nos últimos 5s
+
+	Autoscale *AutoscaleStats `json:"autoscale,omitempty"` // apenas com autoscaling
+
+	Pause PauseStats `json:"pause"`
+}
+
+// StatsReset é a resposta do POST /admin/stats/reset: os contadores da
+// janela encerrada, para nada se perder com o reset
+type StatsReset struct {
+	ResetAt time.Time      `json:"reset_at"` // início da nova janela
+	Summary PaymentSummary `json:"summary"`  // de since até reset_at
+	Ingress IngressStats   `json:"ingress"`  // idem, do POST /payments
+
+	Amounts map[string]AmountStats `json:"amounts"` // idem, por processador
+
+	// Payments em voo no reset: estão no total_payments do summary acima e
+	// voltam a ser contados no da nova janela, onde terão o desfecho
+	CarriedOver int64 `json:"carried_over"`
+}
+
+// QueueCapacity é a resposta do POST /admin/queue/capacity
+type QueueCapacity struct {
+	Capacity         int `json:"capacity"`
+	PreviousCapacity int `json:"previous_capacity"`
+	QueueDepth       int `json:"queue_depth"` // acima da capacidade, o Push recusa até a fila drenar
+}
+
+// PauseStats traz o estado da pausa do processamento pelo admin
+type PauseStats struct {
+	Paused        bool       `json:"paused"`
+	PausedSince   *time.Time `json:"paused_since,omitempty"`
+	PausedMs      int64      `json:"paused_ms"`       // pausa atual; 0 processando
+	TotalPausedMs int64      `json:"total_paused_ms"` // desde o início, incluindo a atual
+	Backlog       int        `json:"backlog"`         // payments aguardando na fila
+}
+
+// AutoscaleStats traz os limites e a atividade do autoscaling do pool
+type AutoscaleStats struct {
+	MinWorkers  int   `json:"min_workers"`
+	MaxWorkers  int   `json:"max_workers"`
+	EnqueueRate int64 `json:"enqueue_rate"` // payments aceitos por segundo
+	ScaleUps    int64 `json:"scale_ups"`
+	ScaleDowns  int64 `json:"scale_downs"`
+}
+
+// WorkersReport traz os contadores por worker do pool
+type WorkersReport struct {
+	Workers []WorkerStats      `json:"workers"` // workers vivos, por id
+	Retired RetiredWorkerStats `json:"retired"` // encerrados pelo autoscaling
+}
+
+// WorkerStats são os contadores de um worker vivo
+type WorkerStats struct {
+	ID        int       `json:"id"`
+	StartedAt time.Time `json:"started_at"`
+	WorkerCounters
+}
+
+// RetiredWorkerStats acumula os contadores dos workers já encerrados
+type RetiredWorkerStats struct {
+	Workers int `json:"workers"`
+	WorkerCounters
+}
+
+// WorkerCounters são os contadores de processamento de um ou mais workers
+type WorkerCounters struct {
+	Processed int64 `json:"processed"` // aceitos por um processador
+	Failed    int64 `json:"failed"`    // falharam após as tentativas
+	Expired   int64 `json:"expired"`   // descartados pelo QUEUE_TTL_MS
+	Batches   int64 `json:"batches"`
+	BusyMs    int64 `json:"busy_ms"` // tempo processando lotes
+}
+
+// Add soma outros contadores a c
+func (c *WorkerCounters) Add(o WorkerCounters) {
+	c.Processed += o.Processed
+	c.Failed += o.Failed
+	c.Expired += o.Expired
+	c.Batches += o.Batches
+	c.BusyMs += o.BusyMs
+}
+
+// LatencyStats resume o histograma de latência de um processador. Timeouts
+// entram como amostras no teto do timeout.
+type LatencyStats struct {
+	Count   int64           `json:"count"`
+	P50Ms   float64         `json:"p50_ms"`
+	P95Ms   float64         `json:"p95_ms"`
+	P99Ms   float64         `json:"p99_ms"`
+	MaxMs   float64         `json:"max_ms"`
+	Buckets []LatencyBucket `json:"buckets"`
+
+	TimeoutMs int64 `json:"timeout_ms,omitempty"` // prazo atual das chamadas ao processador
+}
+
+// RouteLatency resume a duração das requisições de uma rota dentro do
+// processo, na janela deslizante dos últimos WindowSeconds
+type RouteLatency struct {
+	Count         int64   `json:"count"`     // requisições na janela
+	InFlight      int64   `json:"in_flight"` // em andamento agora
+	P50Ms         float64 `json:"p50_ms"`
+	P90Ms         float64 `json:"p90_ms"`
+	P99Ms         float64 `json:"p99_ms"`
+	MaxMs         float64 `json:"max_ms"`
+	WindowSeconds int     `json:"window_seconds"`
+}
+
+// LatencyBucket é um bucket do histograma, com limite superior em ms
+type LatencyBucket struct {
+	Le    string `json:"le"` // "+Inf" no último bucket
+	Count int64  `json:"count"`
+}
+
+// AmountStats é a distribuição dos valores dos payments processados com
+// sucesso por um processador, só na moeda padrão, em centavos
+type AmountStats struct {
+	Count   int64          `json:"count"`
+	Min     int64          `json:"min"` // 0 sem payments
+	Max     int64          `json:"max"`
+	Mean    float64        `json:"mean"`
+	Buckets []AmountBucket `json:"buckets"`
+}
+
+// AmountBucket é um bucket do AmountStats, não cumulativo
+type AmountBucket struct {
+	Le    string `json:"le"` // limite superior em centavos; "+Inf" no último
+	Count int64  `json:"count"`
+}
+
+// InternalSummary é o summary local exposto às instâncias irmãs
+type InternalSummary struct {
+	Snapshot int64          `json:"snapshot"` // cresce a cada payment finalizado
+	Summary  PaymentSummary `json:"summary"`
+}
+
+// ProcessorState é o estado de roteamento de um processador no
+// GET /admin/processors
+type ProcessorState struct {
+	Name           string `json:"name"`
+	Healthy        bool   `json:"healthy"`      // estado efetivo usado no roteamento
+	Manual         bool   `json:"manual"`       // fixado pelo admin
+	Override       string `json:"override"`     // auto, healthy ou unhealthy
+	AutoHealthy    bool   `json:"auto_healthy"` // calculado pelo circuit breaker e health checks
+	BreakerOpen    bool   `json:"breaker_open"` // a taxa de falhas na janela abriu o circuit breaker
+	ResponseTimeMs int64  `json:"response_time_ms"`
+	TimeoutMs      int64  `json:"timeout_ms"` // prazo atual das chamadas de payment
+
+	Breaker     ProcessorBreaker      `json:"breaker"`
+	RateLimit   *ProcessorRateLimit   `json:"rate_limit,omitempty"`  // apenas com PROCESSOR_RATE_LIMIT_RPS
+	Connections *ProcessorConnections `json:"connections,omitempty"` // apenas com PROCESSOR_CONN_METRICS
+	ClockSkew   ProcessorClockSkew    `json:"clock_skew"`
+	Protocol    ProcessorProtocol     `json:"protocol"`
+	Replicas    []ProcessorReplica    `json:"replicas,omitempty"` // apenas com mais de uma URL no processador
+
+	Retries map[string]int64 `json:"retries"` // novas tentativas após falhas de conexão (attempted/failover/succeeded/skipped)
+}
+
+// ChaosRule são as falhas injetadas nas chamadas a um processador com
+// CHAOS=true; os percentuais são probabilidades por chamada. Latência
+// soma-se às demais; erro, reset e blackhole se excluem, então a soma dos
+// três não passa de 100.
+type ChaosRule struct {
+	LatencyPercent      float64 `json:"latency_percent"`
+	LatencyMs           int64   `json:"latency_ms"`                     // fixa, mínima (uniform) ou média (exponential)
+	LatencyMaxMs        int64   `json:"latency_max_ms,omitempty"`       // teto da uniform e da exponential
+	LatencyDistribution string  `json:"latency_distribution,omitempty"` // fixed (padrão), uniform ou exponential
+	ErrorPercent        float64 `json:"error_percent"`
+	ErrorStatus         int     `json:"error_status,omitempty"` // 429 ou 5xx; 500 se omitido
+	ResetPercent        float64 `json:"reset_percent"`
+	BlackholePercent    float64 `json:"blackhole_percent"` // a chamada fica sem resposta até o prazo
+}
+
+// ChaosProcessor é a regra de um processador e as falhas já injetadas
+type ChaosProcessor struct {
+	Rule     ChaosRule        `json:"rule"`
+	Injected map[string]int64 `json:"injected"` // por falha, como no rinha_processor_chaos_injected_total
+}
+
+// ChaosStats é a resposta do GET e do POST /admin/chaos
+type ChaosStats struct {
+	Enabled    bool                      `json:"enabled"` // build com -tags chaos e CHAOS=true
+	Processors map[string]ChaosProcessor `json:"processors,omitempty"`
+}
+
+// ExchangeLogRequest é o corpo do POST /admin/exchange-log
+type ExchangeLogRequest struct {
+	Every      int64 `json:"every"`       // 1 a cada every chamadas; 0 volta à amostragem do boot
+	DurationMs int64 `json:"duration_ms"` // por quanto tempo; 0 são 5 minutos
+}
+
+// ExchangeLogStats é a resposta do GET e do POST /admin/exchange-log
+type ExchangeLogStats struct {
+	Every        int64      `json:"every"`           // amostragem atual; 0 sem amostragem
+	BootEvery    int64      `json:"boot_every"`      // PROCESSOR_EXCHANGE_LOG_EVERY
+	Until        *time.Time `json:"until,omitempty"` // quando every volta a boot_every
+	ErrorsPerSec int64      `json:"errors_per_sec"`  // chamadas com falha logadas por segundo; 0 nenhuma
+	MaxBodyBytes int        `json:"max_body_bytes"`
+	Sampled      int64      `json:"sampled"`    // chamadas logadas pela amostragem
+	Failed       int64      `json:"failed"`     // chamadas com falha logadas fora da amostragem
+	Suppressed   int64      `json:"suppressed"` // chamadas com falha fora do limite por segundo
+}
+
+// WeightStats é a resposta do GET e do POST /admin/weights
+type WeightStats struct {
+	Enabled bool             `json:"enabled"` // algum peso acima de zero
+	Weights map[string]int64 `json:"weights"` // por processador
+	Since   time.Time        `json:"since"`   // última mudança dos pesos, ou o boot
+	Picks   map[string]int64 `json:"picks"`   // payments enviados primeiro a cada processador pelo sorteio, desde since
+
+	// Fração das picks de cada processador, em %, para comparar com os
+	// pesos; os payments aceitos por processador seguem em default_success
+	// e fallback_success, que somam também as idas ao fallback após falhas
+	PicksPercent map[string]float64 `json:"picks_percent"`
+}
+
+// ShadowRequest é o corpo do POST /admin/shadow; campos ausentes mantêm o
+// valor atual
+type ShadowRequest struct {
+	Enabled *bool `json:"enabled"`
+	Percent *int  `json:"percent"` // % dos payments aceitos pelo default copiados ao fallback
+}
+
+// ShadowStats é a resposta do GET e do POST /admin/shadow
+type ShadowStats struct {
+	Enabled     bool             `json:"enabled"`
+	Percent     int              `json:"percent"`
+	Header      string           `json:"header"` // header que marca as cópias
+	MaxInFlight int              `json:"max_in_flight"`
+	InFlight    int              `json:"in_flight"`
+	Mirrored    int64            `json:"mirrored"` // cópias enviadas desde o boot
+	Outcomes    map[string]int64 `json:"outcomes"` // success, classe de erro ou dropped (sem vaga, não enviadas)
+	Latency     LatencyStats     `json:"latency"`
+
+	// Latência das chamadas de verdade ao default, para comparar
+	DefaultLatency LatencyStats `json:"default_latency"`
+}
+
+// HealthDetail é a resposta do GET /health?detail=true
+type HealthDetail struct {
+	Status     string            `json:"status"` // sempre ok: o processo respondeu
+	Role       string            `json:"role"`   // papel no health check dos processadores
+	QueueDepth int               `json:"queue_depth"`
+	QueueSize  int               `json:"queue_size"`
+	Workers    int               `json:"workers"`
+	Processors []ProcessorHealth `json:"processors"`
+}
+
+// ProcessorHealth é a saúde de um processador no GET /health?detail=true,
+// lida dos mesmos campos que o roteamento usa
+type ProcessorHealth struct {
+	Name         string     `json:"name"`
+	Healthy      bool       `json:"healthy"`       // estado efetivo usado no roteamento
+	Breaker      string     `json:"breaker"`       // open ou closed
+	FailureCount int64      `json:"failure_count"` // falhas na janela do circuit breaker
+	LastCheckAt  *time.Time `json:"last_check_at,omitempty"`
+	LatencyMs    int64      `json:"latency_ms"`              // última chamada de payment com resposta
+	NextProbeAt  *time.Time `json:"next_probe_at,omitempty"` // próximo ping; ausente com o processador saudável
+}
+
+// ProcessorBreaker mostra a janela do circuit breaker de um processador
+type ProcessorBreaker struct {
+	WindowSeconds  int   `json:"window_seconds"`
+	Requests       int64 `json:"requests"` // chamadas na janela
+	Failures       int64 `json:"failures"` // falhas na janela
+	FailurePercent int   `json:"failure_percent"`
+	ThresholdPct   int   `json:"threshold_percent"` // taxa de falhas que abre o breaker
+	MinRequests    int64 `json:"min_requests"`      // chamadas na janela antes de avaliar a taxa
+	Trips          int64 `json:"trips"`             // vezes que o breaker abriu
+
+	// Backoff da abertura: aberto, a duração atual e quando o processador
+	// pode voltar; fechado, a duração que a próxima abertura teria
+	OpenMs      int64      `json:"open_ms"`
+	Reopens     int64      `json:"reopens"` // aberturas seguidas que fizeram a duração crescer
+	NextProbeAt *time.Time `json:"next_probe_at,omitempty"`
+}
+
+// ProcessorConnections mostra o pool de conexões de saída com um
+// processador. Open conta as conexões discadas e ainda não fechadas,
+// inclusive as de health check; Active, só as em uso por uma chamada de
+// payment, então Idle é uma estimativa.
+type ProcessorConnections struct {
+	New          int64   `json:"new"`    // chamadas que precisaram discar
+	Reused       int64   `json:"reused"` // chamadas atendidas por uma conexão ociosa
+	ReusePercent float64 `json:"reuse_percent"`
+	NewPerSecond float64 `json:"new_per_second"` // conexões discadas por segundo no último minuto
+	DialP50Ms    float64 `json:"dial_p50_ms"`    // connect no último minuto
+	DialP99Ms    float64 `json:"dial_p99_ms"`
+	Open         int64   `json:"open"`
+	Active       int64   `json:"active"`
+	Idle         int64   `json:"idle"`
+}
+
+// ProcessorProtocol mostra o protocolo das chamadas a um processador. Com
+// h2c, Current volta a http/1.1 enquanto o processador não aceita o h2c,
+// até RetryAt.
+type ProcessorProtocol struct {
+	Configured string     `json:"configured"`           // h2c ou http/1.1
+	Current    string     `json:"current"`              // protocolo das próximas chamadas
+	Confirmed  bool       `json:"confirmed"`            // o h2c já teve resposta; depois disso não cai mais para HTTP/1.1
+	Fallbacks  int64      `json:"fallbacks"`            // quedas do h2c para HTTP/1.1
+	LastError  string     `json:"last_error,omitempty"` // falha do h2c na última queda
+	RetryAt    *time.Time `json:"retry_at,omitempty"`   // nova tentativa com h2c
+}
+
+// ProcessorReplica é uma das URLs de um processador com réplicas. Uma
+// réplica ejetada fica fora do rodízio até responder ao ping de ProbeAt.
+type ProcessorReplica struct {
+	Addr      string     `json:"addr"`                 // host:porta da URL
+	Healthy   bool       `json:"healthy"`              // no rodízio
+	InFlight  int64      `json:"in_flight"`            // chamadas de payment em andamento
+	Requests  int64      `json:"requests"`             // chamadas de payment recebidas
+	Errors    int64      `json:"errors"`               // chamadas que falharam nela
+	Failures  int64      `json:"failures"`             // falhas seguidas
+	Ejections int64      `json:"ejections"`            // vezes que saiu do rodízio
+	LastError string     `json:"last_error,omitempty"` // falha mais recente
+	ProbeAt   *time.Time `json:"probe_at,omitempty"`   // próximo ping, ejetada
+}
+
+// ProcessorRateLimit mostra o token bucket das chamadas a um processador
+type ProcessorRateLimit struct {
+	LimitPerSecond float64 `json:"limit_per_second"` // configurada
+	RatePerSecond  float64 `json:"rate_per_second"`  // efetiva, menor que a configurada depois de 429s com o ajuste automático
+	Burst          int     `json:"burst"`
+	Tokens         float64 `json:"tokens"`    // chamadas disponíveis agora
+	Auto           bool    `json:"auto"`      // ajuste automático por 429
+	Throttled      int64   `json:"throttled"` // chamadas puladas sem token
+	Decreases      int64   `json:"decreases"` // reduções da taxa por 429
+	Increases      int64   `json:"increases"` // recuperações da taxa por sucessos
+}
+
+// ProcessorClockSkew é o desvio estimado do relógio de um processador,
+// pelo header Date das respostas de payment
+type ProcessorClockSkew struct {
+	SkewMs  int64 `json:"skew_ms"` // relógio do processador menos o local; positivo se ele está adiantado
+	Ready   bool  `json:"ready"`   // amostras suficientes para o aviso e a correção
+	Samples int64 `json:"samples"`
+	Missing int64 `json:"missing"` // respostas sem Date
+	Ignored int64 `json:"ignored"` // Date ilegível ou fora de qualquer desvio plausível
+	Warning bool  `json:"warning"` // acima de CLOCK_SKEW_WARN_MS
+	Applied bool  `json:"applied"` // somado ao requestedAt (CLOCK_SKEW_CORRECTION)
+}
+
+// ServiceHealth representa a resposta do GET /payments/service-health
+type ServiceHealth struct {
+	Failing         bool  `json:"failing"`
+	MinResponseTime int64 `json:"minResponseTime"`
 }
 
 // Validate valida o payload de payment
@@ -39,16 +758,137 @@ func (p *PaymentRequest) Validate() error {
 	if p.Amount <= 0 {
 		return errors.New("amount must be positive")
 	}
+	if p.Amount > maxAmount {
+		return &AmountTooLargeError{Amount: p.Amount, Max: maxAmount}
+	}
 	if p.Type == "" {
 		return errors.New("type is required")
 	}
-	if len(p.Description) > 255 {
-		return errors.New("description too long")
+	if err := validateCurrency(p.Currency); err != nil {
+		return err
+	}
+	if len(p.CorrelationID) > 64 {
+		return errors.New("correlationId too long")
+	}
+	if n := utf8.RuneCountInString(p.Description); n > maxDescriptionRunes {
+		return fmt.Errorf("description has %d characters, the maximum is %d", n, maxDescriptionRunes)
+	}
+	if err := validateMetadata(p.Metadata); err != nil {
+		return err
+	}
+	if p.CallbackURL != "" {
+		if len(p.CallbackURL) > maxCallbackURLLength {
+			return errors.New("callbackUrl too long")
+		}
+		u, err := url.Parse(p.CallbackURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("callbackUrl must be an absolute http or https URL")
+		}
 	}
 	return nil
 }
 
+// validateMetadata aplica os limites do metadata, citando a chave recusada
+func validateMetadata(metadata map[string]string) error {
+	if len(metadata) == 0 {
+		return nil
+	}
+	if len(metadata) > maxMetadataKeys {
+		return fmt.Errorf("metadata has %d keys, the maximum is %d", len(metadata), maxMetadataKeys)
+	}
+	for key, value := range metadata {
+		if key == "" || len(key) > maxMetadataKeyLength || !validMetadataKey(key) {
+			return fmt.Errorf("metadata key %q must be 1 to %d letters, digits, '_', '-' or '.'",
+				truncate(key, maxMetadataKeyLength), maxMetadataKeyLength)
+		}
+		if len(value) > maxMetadataValueLength {
+			return fmt.Errorf("metadata value for %q exceeds %d bytes", key, maxMetadataValueLength)
+		}
+	}
+	if size := len(appendMetadata(nil, metadata)); size > maxMetadataBytes {
+		return fmt.Errorf("metadata encodes to %d bytes, the maximum is %d", size, maxMetadataBytes)
+	}
+	return nil
+}
+
+func validMetadataKey(key string) bool {
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
 // ToJSON converte para JSON de forma eficiente
 func (p *PaymentRequest) ToJSON() ([]byte, error) {
-	return json.Marshal(p)
+	return p.AppendJSON(nil)
+}
+
+// ShutdownReport é o relatório do desligamento: o que aconteceu com cada
+// payment aceito na fila e os contadores finais da instância
+type ShutdownReport struct {
+	StartedAt      time.Time `json:"started_at"`
+	DurationMs     int64     `json:"duration_ms"`
+	Forced         bool      `json:"forced"`          // segundo sinal: saiu sem esperar o fim
+	WorkersStopped bool      `json:"workers_stopped"` // os workers pararam antes do prazo
+
+	Drain ShutdownDrain `json:"drain"`
+	Queue ShutdownQueue `json:"queue"`
+
+	Ingress IngressStats     `json:"ingress"`
+	Workers WorkerCounters   `json:"workers"` // totais desde o boot
+	Panics  map[string]int64 `json:"panics"`
+}
+
+// ShutdownDrain são os payments finalizados pelos workers depois do início
+// do desligamento
+type ShutdownDrain struct {
+	Processed int64 `json:"processed"`
+	Failed    int64 `json:"failed"`
+	Expired   int64 `json:"expired"`
+}
+
+// ShutdownQueue fecha a conta da fila: enqueued = finished + queued +
+// in_flight + unaccounted
+type ShutdownQueue struct {
+	Enqueued     int64  `json:"enqueued"`                // aceitos desde o boot, inclusive os recarregados do spill
+	Finished     int64  `json:"finished"`                // processados, falhos ou vencidos
+	Queued       int    `json:"queued"`                  // ainda na fila no fim
+	QueuedAction string `json:"queued_action,omitempty"` // spilled, pending ou dropped
+	InFlight     int64  `json:"in_flight"`               // retirados da fila e sem desfecho no fim
+	Unaccounted  int64  `json:"unaccounted"`             // fora das demais contas; 0 com a fila em memória
+}
+
+// SelfCheck é a resposta do GET /admin/selfcheck: os payments aceitos por
+// esta instância contra os desfechos, a fila e os em voo. Delta é accepted
+// menos a soma dos demais termos; Consistent, |Delta| dentro de Tolerance.
+type SelfCheck struct {
+	Consistent bool  `json:"consistent"`
+	Delta      int64 `json:"delta"`
+	Tolerance  int64 `json:"tolerance"`
+	Samples    int   `json:"samples"` // leituras até a conta fechar, ou o máximo
+	Exact      bool  `json:"exact"`   // false com a fila no Redis, compartilhada entre instâncias
+
+	Accepted int64 `json:"accepted"` // enqueued + inline + sync
+	Enqueued int64 `json:"enqueued"` // inclusive os recarregados do spill
+	Inline   int64 `json:"inline"`
+	Sync     int64 `json:"sync"`
+
+	DefaultSuccess  int64 `json:"default_success"`
+	FallbackSuccess int64 `json:"fallback_success"`
+	TotalErrors     int64 `json:"total_errors"`
+	TotalExpired    int64 `json:"total_expired"`
+	Queued          int64 `json:"queued"`
+	InFlight        int64 `json:"in_flight"`
+
+	Store *SelfCheckStore `json:"store,omitempty"` // ausente se o store não respondeu
+}
+
+// SelfCheckStore compara os registros do store com os sucessos contados
+type SelfCheckStore struct {
+	Default  int64 `json:"default"`
+	Fallback int64 `json:"fallback"`
+	Lag      int64 `json:"lag"` // sucessos ainda não visíveis no store
 }